@@ -0,0 +1,399 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfggen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/byteconv"
+	"github.com/corestoreio/pkg/util/strs"
+)
+
+// Generator generates Go source code with typed accessors for the
+// configuration routes of the Sections.
+type Generator struct {
+	// Package name of the generated file.
+	Package string
+	// TypeName of the root struct which embeds all section structs. Defaults
+	// to "Config".
+	TypeName          string
+	DisableFileHeader bool
+
+	sections config.Sections
+}
+
+// NewGenerator creates a new generator for the package name. Multiple
+// Sections get merged, the last entry wins.
+func NewGenerator(pkg string, ss ...config.Sections) (*Generator, error) {
+	if pkg == "" {
+		return nil, errors.Empty.Newf("[cfggen] NewGenerator requires a package name")
+	}
+	var sections config.Sections
+	sections = sections.MergeMultiple(ss...)
+	if err := sections.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &Generator{
+		Package:  pkg,
+		TypeName: "Config",
+		sections: sections,
+	}, nil
+}
+
+type genField struct {
+	Name    string // method name
+	Const   string // name of the route constant
+	Route   string
+	Label   string
+	Scope   string // Go expression of the scope.Type
+	GoType  string
+	Getter  string // method name of config.Value
+	Zero    string
+	Default string // Go expression, empty if no default
+	// DefaultDoc the shortened default for the documentation.
+	DefaultDoc string
+	Multi      bool
+}
+
+type genGroup struct {
+	Name   string
+	Route  string
+	Fields []genField
+}
+
+type genSection struct {
+	Name   string
+	ID     string
+	Groups []genGroup
+}
+
+type genData struct {
+	Package    string
+	TypeName   string
+	Header     bool
+	ImportTime bool
+	HasFields  bool
+	Sections   []genSection
+}
+
+// goTypes maps the config.DataType* constants to the Go type, the config.Value
+// getter and the zero value.
+var goTypes = map[string][3]string{
+	config.DataTypeString:   {"string", "Str", `""`},
+	config.DataTypeInt:      {"int", "Int", "0"},
+	config.DataTypeFloat:    {"float64", "Float64", "0"},
+	config.DataTypeBool:     {"bool", "Bool", "false"},
+	config.DataTypeDuration: {"time.Duration", "Duration", "0"},
+	config.DataTypeTime:     {"time.Time", "Time", "time.Time{}"},
+}
+
+var scopeTypes = [...]string{
+	scope.Absent:  "scope.Absent",
+	scope.Default: "scope.Default",
+	scope.Website: "scope.Website",
+	scope.Store:   "scope.Store",
+}
+
+func dataType(f *config.Field) string {
+	switch {
+	case f.DataType != "":
+		return f.DataType
+	case f.Type == config.TypeTime:
+		return config.DataTypeTime
+	case f.Type == config.TypeDuration:
+		return config.DataTypeDuration
+	}
+	return config.DataTypeString
+}
+
+// goDefault converts the default value of a field into a Go expression.
+func goDefault(dt string, def string) (string, error) {
+	switch dt {
+	case config.DataTypeInt:
+		i, err := strconv.ParseInt(def, 10, 64)
+		return strconv.FormatInt(i, 10), err
+	case config.DataTypeFloat:
+		f, err := strconv.ParseFloat(def, 64)
+		return strconv.FormatFloat(f, 'g', -1, 64), err
+	case config.DataTypeBool:
+		b, _, err := byteconv.ParseBool([]byte(def))
+		return strconv.FormatBool(b), err
+	case config.DataTypeDuration:
+		d, err := time.ParseDuration(def)
+		return goDuration(d), err
+	case config.DataTypeTime:
+		t, ok, err := config.NewValue([]byte(def)).Time()
+		if err == nil && !ok {
+			err = errors.NotValid.Newf("[cfggen] Invalid time %q", def)
+		}
+		t = t.UTC()
+		return fmt.Sprintf("time.Date(%d, %d, %d, %d, %d, %d, %d, time.UTC)",
+			t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond()), err
+	}
+	return strconv.Quote(def), nil
+}
+
+func goDuration(d time.Duration) string {
+	for _, u := range [...]struct {
+		d    time.Duration
+		name string
+	}{
+		{time.Hour, "time.Hour"},
+		{time.Minute, "time.Minute"},
+		{time.Second, "time.Second"},
+		{time.Millisecond, "time.Millisecond"},
+	} {
+		if d != 0 && d%u.d == 0 {
+			return fmt.Sprintf("%d * %s", d/u.d, u.name)
+		}
+	}
+	return strconv.FormatInt(int64(d), 10)
+}
+
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// truncate shortens s to max runes including the trailing dots. It never
+// splits a multi-byte character.
+func truncate(s string, max int) string {
+	if utf8.RuneCountInString(s) <= max {
+		return s
+	}
+	var n int
+	for i := range s {
+		if n == max-3 {
+			return s[:i] + "..."
+		}
+		n++
+	}
+	return s
+}
+
+func (g *Generator) data() (*genData, error) {
+	gd := &genData{
+		Package:  g.Package,
+		TypeName: g.TypeName,
+		Header:   !g.DisableFileHeader,
+	}
+	if gd.TypeName == "" {
+		gd.TypeName = "Config"
+	}
+	// idents protects against duplicated identifiers, e.g. the routes aa_bb/cc/dd
+	// and aa/bb_cc/dd result both in AaBbCcDd.
+	idents := map[string]string{gd.TypeName: "root type"}
+	addIdent := func(ident, route string) error {
+		if prev, ok := idents[ident]; ok {
+			return errors.Duplicated.Newf("[cfggen] Identifier %q of %q is already used by %q", ident, route, prev)
+		}
+		idents[ident] = route
+		return nil
+	}
+
+	for _, s := range g.sections {
+		gs := genSection{Name: strs.ToGoCamelCase(s.ID), ID: s.ID}
+		if err := addIdent(gs.Name, s.ID); err != nil {
+			return nil, err
+		}
+		for _, grp := range s.Groups {
+			gg := genGroup{
+				Name:  gs.Name + strs.ToGoCamelCase(grp.ID),
+				Route: s.ID + string(config.PathSeparator) + grp.ID,
+			}
+			if err := addIdent(gg.Name, gg.Route); err != nil {
+				return nil, err
+			}
+			for _, f := range grp.Fields {
+				gf, err := g.field(gg, s, grp, f)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				if err := addIdent(gf.Name, gf.Route); err != nil {
+					return nil, err
+				}
+				if err := addIdent(gf.Const, gf.Route); err != nil {
+					return nil, err
+				}
+				gf.DefaultDoc = truncate(gf.Default, 70)
+				gd.HasFields = true
+				gd.ImportTime = gd.ImportTime || strings.Contains(gf.GoType, "time.")
+				gg.Fields = append(gg.Fields, gf)
+			}
+			gs.Groups = append(gs.Groups, gg)
+		}
+		gd.Sections = append(gd.Sections, gs)
+	}
+	return gd, nil
+}
+
+func (g *Generator) field(gg genGroup, s *config.Section, grp *config.Group, f *config.Field) (gf genField, _ error) {
+	gf.Name = gg.Name + strs.ToGoCamelCase(f.ID)
+	gf.Const = "Route" + gf.Name
+	gf.Route = f.ConfigRoute
+	if gf.Route == "" {
+		gf.Route = gg.Route + string(config.PathSeparator) + f.ID
+	}
+	gf.Label = oneLine(f.Label)
+
+	perm := f.Scopes
+	if perm == 0 {
+		perm = grp.Scopes
+	}
+	if perm == 0 {
+		perm = s.Scopes
+	}
+	gf.Scope = scopeTypes[scope.Absent]
+	if perm > 0 {
+		gf.Scope = scopeTypes[perm.Top()]
+	}
+
+	dt := dataType(f)
+	typ, ok := goTypes[dt]
+	if !ok {
+		return gf, errors.NotSupported.Newf("[cfggen] DataType %q of route %q not supported", dt, gf.Route)
+	}
+	gf.GoType, gf.Getter, gf.Zero = typ[0], typ[1], typ[2]
+
+	if f.Type == config.TypeMultiselect && dt == config.DataTypeString {
+		gf.Multi = true
+		gf.GoType, gf.Zero = "[]string", "nil"
+		if f.Default != "" {
+			var buf strings.Builder
+			buf.WriteString("[]string{")
+			for i, d := range strings.Split(f.Default, string(config.CSVColumnSeparator)) {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				buf.WriteString(strconv.Quote(d))
+			}
+			buf.WriteString("}")
+			gf.Default = buf.String()
+		}
+		return gf, nil
+	}
+
+	if f.Default != "" {
+		var err error
+		if gf.Default, err = goDefault(dt, f.Default); err != nil {
+			return gf, errors.NotValid.New(err, "[cfggen] Default %q of route %q is not a valid %s", f.Default, gf.Route, dt)
+		}
+	}
+	return gf, nil
+}
+
+// WriteGo writes the formatted Go source code.
+func (g *Generator) WriteGo(w io.Writer) error {
+	gd, err := g.data()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	buf := new(bytes.Buffer)
+	if err := goTpl.Execute(buf, gd); err != nil {
+		return errors.WriteFailed.New(err, "[cfggen] Failed to execute template")
+	}
+	fmted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.NotValid.New(err, "[cfggen] Failed to format source:\n%s", buf.String())
+	}
+	_, err = w.Write(fmted)
+	return errors.WithStack(err)
+}
+
+var goTpl = template.Must(template.New("cfggen").Parse(`
+{{- if .Header }}// Auto generated via github.com/corestoreio/pkg/config/cfggen
+
+{{ end -}}
+package {{ .Package }}
+
+import (
+{{- if .ImportTime }}
+	"time"
+{{ end }}
+{{- if .HasFields }}
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/store/scope"
+{{- end }}
+)
+
+// Route* constants contain all configuration routes.
+const (
+{{- range .Sections }}{{ range .Groups }}{{ range .Fields }}
+	{{ .Const }} = {{ printf "%q" .Route }}
+{{- end }}{{ end }}{{ end }}
+)
+
+// {{ .TypeName }} provides typed access to all configuration values. The zero
+// value is ready to use.
+type {{ .TypeName }} struct {
+{{- range .Sections }}
+	{{ .Name }}
+{{- end }}
+}
+{{ range .Sections }}
+// {{ .Name }} provides typed access to the configuration section {{ .ID }}.
+type {{ .Name }} struct {
+{{- range .Groups }}
+	{{ .Name }}
+{{- end }}
+}
+{{ range .Groups }}{{ $g := . }}
+// {{ .Name }} provides typed access to the configuration group {{ .Route }}.
+type {{ .Name }} struct{}
+{{ range .Fields }}
+// {{ .Name }} returns the value of route {{ .Route }}
+// restricted up to {{ .Scope }}.
+{{- if .Label }}
+// Label: {{ .Label }}
+{{- end }}
+{{- if .Default }}
+// Default: {{ .DefaultDoc }}
+{{- end }}
+func ({{ $g.Name }}) {{ .Name }}(sc config.Scoped) ({{ .GoType }}, error) {
+{{- if .Multi }}
+	v := sc.Get({{ .Scope }}, {{ .Const }})
+	if _, ok, err := v.Str(); err != nil {
+		return nil, errors.WithStack(err)
+	} else if !ok {
+		return {{ if .Default }}{{ .Default }}{{ else }}nil{{ end }}, nil
+	}
+	vals, err := v.Strs()
+	return vals, errors.WithStack(err)
+{{- else if .Default }}
+	v, ok, err := sc.Get({{ .Scope }}, {{ .Const }}).{{ .Getter }}()
+	if err != nil {
+		return {{ .Zero }}, errors.WithStack(err)
+	}
+	if !ok {
+		return {{ .Default }}, nil
+	}
+	return v, nil
+{{- else }}
+	v, _, err := sc.Get({{ .Scope }}, {{ .Const }}).{{ .Getter }}()
+	return v, errors.WithStack(err)
+{{- end }}
+}
+{{ end }}{{ end }}{{ end }}`))
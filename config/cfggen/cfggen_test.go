@@ -0,0 +1,221 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfggen_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/cfggen"
+	"github.com/corestoreio/pkg/config/cfggen/testdata"
+	"github.com/corestoreio/pkg/config/storage"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var testSections = config.MustMakeSectionsValidate(
+	&config.Section{
+		ID:     "web",
+		Scopes: scope.PermStore,
+		Groups: config.MakeGroups(
+			&config.Group{
+				ID: "secure",
+				Fields: config.MakeFields(
+					&config.Field{ID: "base_url", Label: "Base URL", Default: "{{unsecure_base_url}}"},
+					&config.Field{ID: "use_in_frontend", Type: config.TypeSelect, DataType: config.DataTypeBool, Scopes: scope.PermWebsite},
+				),
+			},
+			&config.Group{
+				ID:     "cookie",
+				Scopes: scope.PermWebsite,
+				Fields: config.MakeFields(
+					&config.Field{ID: "cookie_lifetime", DataType: config.DataTypeInt, Default: "3600"},
+					&config.Field{ID: "timeout", Type: config.TypeDuration, Default: "90s"},
+					&config.Field{ID: "allowed_methods", Type: config.TypeMultiselect, Default: "GET,POST"},
+				),
+			},
+		),
+	},
+	&config.Section{
+		ID:     "general",
+		Scopes: scope.PermDefault,
+		Groups: config.MakeGroups(
+			&config.Group{
+				ID: "store_information",
+				Fields: config.MakeFields(
+					&config.Field{ID: "name"},
+					&config.Field{ID: "opened", ConfigRoute: "general/store/opened_at", Type: config.TypeTime, Default: "2019-01-02 15:04:05"},
+					&config.Field{ID: "rate", DataType: config.DataTypeFloat, Default: "0.5"},
+				),
+			},
+		),
+	},
+)
+
+// TestGenerator_WriteGo writes the Go file to the testdata directory which
+// gets used by TestGenerated.
+func TestGenerator_WriteGo(t *testing.T) {
+	g, err := cfggen.NewGenerator("testdata", testSections)
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, g.WriteGo(&buf))
+	assert.NoError(t, ioutil.WriteFile("testdata/config_gen.go", buf.Bytes(), 0644))
+
+	code := buf.String()
+	assert.Contains(t, code, "// Auto generated via github.com/corestoreio/pkg/config/cfggen")
+	assert.Contains(t, code, `RouteGeneralStoreInformationOpened = "general/store/opened_at"`)
+	assert.Contains(t, code, "func (WebSecure) WebSecureBaseURL(sc config.Scoped) (string, error) {")
+	assert.Contains(t, code, "sc.Get(scope.Website, RouteWebSecureUseInFrontend).Bool()")
+	assert.Contains(t, code, "return 90 * time.Second, nil")
+	assert.Contains(t, code, `return []string{"GET", "POST"}, nil`)
+	assert.Contains(t, code, "return time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC), nil")
+}
+
+func TestGenerator_WriteGo_LongDefault(t *testing.T) {
+	g, err := cfggen.NewGenerator("testdata", config.MakeSections(&config.Section{ID: "aa", Groups: config.MakeGroups(&config.Group{
+		ID: "bb", Fields: config.MakeFields(&config.Field{ID: "cc", Default: strings.Repeat("ä", 80)}),
+	})}))
+	assert.NoError(t, err)
+
+	var buf bytes.Buffer
+	assert.NoError(t, g.WriteGo(&buf))
+	assert.True(t, utf8.Valid(buf.Bytes()), "generated code must be valid UTF-8")
+	// 70 runes: the opening quote of the Go literal, 66 runes and the dots.
+	assert.Contains(t, buf.String(), "// Default: \""+strings.Repeat("ä", 66)+"...\n")
+}
+
+func TestNewGenerator_Errors(t *testing.T) {
+	newSections := func(sectionID, groupID string, f *config.Field) config.Sections {
+		return config.MakeSections(&config.Section{ID: sectionID, Groups: config.MakeGroups(&config.Group{
+			ID: groupID, Fields: config.MakeFields(f),
+		})})
+	}
+	writeGo := func(ss ...config.Sections) error {
+		g, err := cfggen.NewGenerator("testdata", ss...)
+		if err != nil {
+			return err
+		}
+		return g.WriteGo(ioutil.Discard)
+	}
+
+	t.Run("empty package", func(t *testing.T) {
+		_, err := cfggen.NewGenerator("")
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+	t.Run("duplicated identifier", func(t *testing.T) {
+		err := writeGo(newSections("aa_bb", "cc", &config.Field{ID: "dd"}), newSections("aa", "bb_cc", &config.Field{ID: "dd"}))
+		assert.True(t, errors.Duplicated.Match(err), "%+v", err)
+	})
+	t.Run("invalid default", func(t *testing.T) {
+		err := writeGo(newSections("aa", "bb", &config.Field{ID: "cc", DataType: config.DataTypeInt, Default: "one"}))
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+	t.Run("unsupported data type", func(t *testing.T) {
+		err := writeGo(newSections("aa", "bb", &config.Field{ID: "cc", DataType: "complex128"}))
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+}
+
+func TestGenerated(t *testing.T) {
+	srv := config.MustNewService(storage.NewMap(), config.Options{})
+	defer func() { assert.NoError(t, srv.Close()) }()
+	var cfg testdata.Config
+
+	t.Run("defaults", func(t *testing.T) {
+		sc := srv.Scoped(1, 2)
+		baseURL, err := cfg.WebSecureBaseURL(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, "{{unsecure_base_url}}", baseURL)
+
+		useInFrontend, err := cfg.WebSecureUseInFrontend(sc)
+		assert.NoError(t, err)
+		assert.False(t, useInFrontend)
+
+		lifetime, err := cfg.Web.WebCookieCookieLifetime(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, 3600, lifetime)
+
+		timeout, err := cfg.WebCookieTimeout(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, 90*time.Second, timeout)
+
+		methods, err := cfg.WebCookieAllowedMethods(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, []string{"GET", "POST"}, methods)
+
+		name, err := cfg.GeneralStoreInformationName(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, "", name)
+
+		opened, err := cfg.GeneralStoreInformationOpened(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC), opened)
+
+		rate, err := cfg.GeneralStoreInformationRate(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, 0.5, rate)
+	})
+
+	t.Run("stored values and scope restriction", func(t *testing.T) {
+		set := func(scp scope.TypeID, route, value string) {
+			assert.NoError(t, srv.Set(config.MustNewPathWithScope(scp, route), []byte(value)))
+		}
+		set(scope.Store.WithID(2), testdata.RouteWebSecureBaseURL, "https://shop.test/")
+		set(scope.Store.WithID(2), testdata.RouteWebSecureUseInFrontend, "1") // ignored, website scope
+		set(scope.Website.WithID(1), testdata.RouteWebCookieCookieLifetime, "60")
+		set(scope.DefaultTypeID, testdata.RouteWebCookieAllowedMethods, "PUT")
+		set(scope.DefaultTypeID, testdata.RouteGeneralStoreInformationOpened, "2020-03-04")
+		set(scope.Store.WithID(2), testdata.RouteGeneralStoreInformationName, "ignored, default scope")
+
+		sc := srv.Scoped(1, 2)
+		baseURL, err := cfg.WebSecureBaseURL(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, "https://shop.test/", baseURL)
+
+		useInFrontend, err := cfg.WebSecureUseInFrontend(sc)
+		assert.NoError(t, err)
+		assert.False(t, useInFrontend)
+
+		lifetime, err := cfg.WebCookieCookieLifetime(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, 60, lifetime)
+
+		methods, err := cfg.WebCookieAllowedMethods(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, []string{"PUT"}, methods)
+
+		opened, err := cfg.GeneralStoreInformationOpened(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, time.Date(2020, 3, 4, 0, 0, 0, 0, time.UTC), opened)
+
+		name, err := cfg.GeneralStoreInformationName(sc)
+		assert.NoError(t, err)
+		assert.Exactly(t, "", name)
+	})
+
+	t.Run("invalid value", func(t *testing.T) {
+		assert.NoError(t, srv.Set(config.MustNewPath(testdata.RouteWebCookieTimeout), []byte("ninety seconds")))
+		timeout, err := cfg.WebCookieTimeout(srv.Scoped(0, 0))
+		assert.Error(t, err)
+		assert.Exactly(t, time.Duration(0), timeout)
+	})
+}
@@ -0,0 +1,36 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package cfggen generates strongly typed accessors for configuration values
+// defined in config.Sections.
+//
+// Instead of writing
+//		baseURL, _, err := sc.Get(scope.Store, "web/secure/base_url").Str()
+// all over the code base, the generated code provides
+//		var cfg mypkg.Config
+//		baseURL, err := cfg.WebSecureBaseURL(sc)
+// For each route a constant gets generated, for each section and group an
+// empty struct type. The group struct contains one method per field which
+// restricts the scope to the Scopes of the Field, Group or Section, converts the
+// value to the Go type of the Field.DataType and returns the Field.Default if
+// no value has been stored. Renaming or removing a route in the sections and
+// regenerating the code breaks all callers at compile time.
+//
+// The section definitions of the directory config/_pkgtpl are written against
+// an outdated API and cannot be compiled. ParsePkgTpl reads them with go/ast and
+// converts them into config.Sections.
+//		ss, err := cfggen.ParsePkgTpl("config/_pkgtpl/config_cookie.go")
+//		g, err := cfggen.NewGenerator("cookie", ss)
+//		err = g.WriteGo(w)
+package cfggen
@@ -0,0 +1,266 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfggen
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/store/scope"
+)
+
+var pkgTplFieldTypes = map[string]config.FieldType{
+	"TypeButton":      config.TypeButton,
+	"TypeCustom":      config.TypeCustom,
+	"TypeLabel":       config.TypeLabel,
+	"TypeHidden":      config.TypeHidden,
+	"TypeImage":       config.TypeImage,
+	"TypeObscure":     config.TypeObscure,
+	"TypeMultiselect": config.TypeMultiselect,
+	"TypeSelect":      config.TypeSelect,
+	"TypeText":        config.TypeText,
+	"TypeTextarea":    config.TypeTextarea,
+	"TypeTime":        config.TypeTime,
+	"TypeDuration":    config.TypeDuration,
+	// TypeAllowspecific has been removed from package config.
+	"TypeAllowspecific": config.TypeMultiselect,
+}
+
+var pkgTplPerms = map[string]scope.Perm{
+	"PermDefault": scope.PermDefault,
+	"PermWebsite": scope.PermWebsite,
+	"PermStore":   scope.PermStore,
+}
+
+// ParsePkgTpl parses the section definitions of the files in directory
+// config/_pkgtpl. These files have been generated from the Magento system.xml
+// files and use the removed packages config/element and config/cfgmodel, hence
+// they cannot be compiled. ParsePkgTpl extracts from all Section, Group and
+// Field composite literals the IDs, scopes, field types, labels, config routes
+// and the default values. A bool, integer or float default sets the DataType of
+// the field. The Magento backend model placeholders of the form
+// `{"_value":null,...}` are no default values and get dropped. All files get
+// merged into one validated Sections.
+func ParsePkgTpl(filenames ...string) (config.Sections, error) {
+	var ss config.Sections
+	fset := token.NewFileSet()
+	for _, fn := range filenames {
+		af, err := parser.ParseFile(fset, fn, nil, 0)
+		if err != nil {
+			return nil, errors.NotValid.New(err, "[cfggen] ParsePkgTpl failed to parse file %q", fn)
+		}
+		var lastErr error
+		ast.Inspect(af, func(n ast.Node) bool {
+			cl, ok := n.(*ast.CompositeLit)
+			if !ok || lastErr != nil || typeName(cl.Type) != "Section" {
+				return lastErr == nil
+			}
+			s, err := parsePkgTplSection(cl)
+			if err != nil {
+				lastErr = errors.Wrapf(err, "[cfggen] ParsePkgTpl in file %q at %s", fn, fset.Position(cl.Pos()))
+				return false
+			}
+			ss = ss.Merge(s)
+			return false
+		})
+		if lastErr != nil {
+			return nil, lastErr
+		}
+	}
+	if err := ss.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ss, nil
+}
+
+// typeName returns the name of a type expression like element.Section,
+// *config.Field or Group.
+func typeName(expr ast.Expr) string {
+	switch t := expr.(type) {
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	case *ast.StarExpr:
+		return typeName(t.X)
+	}
+	return ""
+}
+
+// compositeLits returns the composite literals of the type name from a slice
+// literal like config.GroupSlice{...} or a function call like
+// element.MakeFields(...).
+func compositeLits(expr ast.Expr, name string) (cls []*ast.CompositeLit) {
+	var elts []ast.Expr
+	switch e := expr.(type) {
+	case *ast.CompositeLit:
+		elts = e.Elts
+	case *ast.CallExpr:
+		elts = e.Args
+	}
+	for _, elt := range elts {
+		if ue, ok := elt.(*ast.UnaryExpr); ok && ue.Op == token.AND {
+			elt = ue.X
+		}
+		// the type of an element within a slice literal can be omitted.
+		if cl, ok := elt.(*ast.CompositeLit); ok && (cl.Type == nil || typeName(cl.Type) == name) {
+			cls = append(cls, cl)
+		}
+	}
+	return cls
+}
+
+// keyValues calls fn for each key: value pair of the composite literal.
+func keyValues(cl *ast.CompositeLit, fn func(key string, value ast.Expr) error) error {
+	for _, elt := range cl.Elts {
+		kv, ok := elt.(*ast.KeyValueExpr)
+		if !ok {
+			continue
+		}
+		if key, ok := kv.Key.(*ast.Ident); ok {
+			if err := fn(key.Name, kv.Value); err != nil {
+				return errors.Wrapf(err, "[cfggen] Key %q", key.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// stringValue returns the string of a literal or of a function call like
+// text.Long(`...`).
+func stringValue(expr ast.Expr) (string, error) {
+	switch e := expr.(type) {
+	case *ast.BasicLit:
+		if e.Kind != token.STRING {
+			return e.Value, nil
+		}
+		s, err := strconv.Unquote(e.Value)
+		return s, errors.WithStack(err)
+	case *ast.CallExpr:
+		if len(e.Args) == 1 {
+			return stringValue(e.Args[0])
+		}
+	case *ast.Ident: // nil
+		return "", nil
+	}
+	return "", errors.NotSupported.Newf("[cfggen] Expression %T not supported", expr)
+}
+
+func permValue(expr ast.Expr) (scope.Perm, error) {
+	if p, ok := pkgTplPerms[typeName(expr)]; ok {
+		return p, nil
+	}
+	return 0, errors.NotSupported.Newf("[cfggen] Scope %q not supported", typeName(expr))
+}
+
+func parsePkgTplSection(cl *ast.CompositeLit) (*config.Section, error) {
+	s := new(config.Section)
+	err := keyValues(cl, func(key string, value ast.Expr) (err error) {
+		switch key {
+		case "ID":
+			s.ID, err = stringValue(value)
+		case "Label":
+			s.Label, err = stringValue(value)
+		case "Scope", "Scopes":
+			s.Scopes, err = permValue(value)
+		case "Groups":
+			for _, gcl := range compositeLits(value, "Group") {
+				g, err := parsePkgTplGroup(gcl)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				s.Groups = append(s.Groups, g)
+			}
+		}
+		return err
+	})
+	return s, errors.WithStack(err)
+}
+
+func parsePkgTplGroup(cl *ast.CompositeLit) (*config.Group, error) {
+	g := new(config.Group)
+	err := keyValues(cl, func(key string, value ast.Expr) (err error) {
+		switch key {
+		case "ID":
+			g.ID, err = stringValue(value)
+		case "Label":
+			g.Label, err = stringValue(value)
+		case "Scope", "Scopes":
+			g.Scopes, err = permValue(value)
+		case "Fields":
+			for _, fcl := range compositeLits(value, "Field") {
+				f, err := parsePkgTplField(fcl)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				g.Fields = append(g.Fields, f)
+			}
+		}
+		return err
+	})
+	return g, errors.WithStack(err)
+}
+
+func parsePkgTplField(cl *ast.CompositeLit) (*config.Field, error) {
+	f := new(config.Field)
+	err := keyValues(cl, func(key string, value ast.Expr) (err error) {
+		switch key {
+		case "ID":
+			f.ID, err = stringValue(value)
+		case "Label":
+			f.Label, err = stringValue(value)
+		case "ConfigPath", "ConfigRoute":
+			f.ConfigRoute, err = stringValue(value)
+		case "Scope", "Scopes":
+			f.Scopes, err = permValue(value)
+		case "Type":
+			f.Type = pkgTplFieldTypes[typeName(value)]
+		case "Default":
+			f.Default, f.DataType, err = defaultValue(value)
+		}
+		return err
+	})
+	return f, errors.WithStack(err)
+}
+
+func defaultValue(expr ast.Expr) (def, dataType string, err error) {
+	switch e := expr.(type) {
+	case *ast.Ident:
+		switch e.Name {
+		case "true", "false":
+			return e.Name, config.DataTypeBool, nil
+		case "nil":
+			return "", "", nil
+		}
+	case *ast.BasicLit:
+		switch e.Kind {
+		case token.INT:
+			return e.Value, config.DataTypeInt, nil
+		case token.FLOAT:
+			return e.Value, config.DataTypeFloat, nil
+		}
+		def, err = stringValue(e)
+		if strings.HasPrefix(def, `{"_value":`) {
+			def = ""
+		}
+		return def, "", errors.WithStack(err)
+	}
+	return "", "", errors.NotSupported.Newf("[cfggen] Default expression %T not supported", expr)
+}
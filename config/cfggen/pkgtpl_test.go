@@ -0,0 +1,71 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cfggen_test
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/cfggen"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestParsePkgTpl(t *testing.T) {
+	t.Run("cookie", func(t *testing.T) {
+		ss, err := cfggen.ParsePkgTpl("../_pkgtpl/config_cookie.go")
+		assert.NoError(t, err)
+
+		f, idx := ss.FindField("web/cookie/cookie_lifetime")
+		assert.True(t, idx >= 0, "field not found")
+		assert.Exactly(t, "3600", f.Default)
+		assert.Exactly(t, config.DataTypeInt, f.DataType)
+		assert.Exactly(t, config.TypeText, f.Type)
+		assert.Exactly(t, scope.PermStore, f.Scopes)
+
+		f, _ = ss.FindField("web/cookie/cookie_restriction")
+		assert.Exactly(t, "false", f.Default)
+		assert.Exactly(t, config.DataTypeBool, f.DataType)
+		assert.Exactly(t, scope.PermWebsite, f.Scopes)
+
+		f, _ = ss.FindField("web/cookie/cookie_path")
+		assert.Exactly(t, "Cookie Path", f.Label)
+		assert.Exactly(t, "", f.Default)
+	})
+
+	t.Run("all files", func(t *testing.T) {
+		files, err := filepath.Glob("../_pkgtpl/config_*.go")
+		assert.NoError(t, err)
+		ss, err := cfggen.ParsePkgTpl(files...)
+		assert.NoError(t, err)
+
+		f, _ := ss.FindField("payment/account/merchant_country")
+		assert.Exactly(t, "paypal/general/merchant_country", f.ConfigRoute)
+
+		g, err := cfggen.NewGenerator("magento", ss)
+		assert.NoError(t, err)
+		var buf bytes.Buffer
+		assert.NoError(t, g.WriteGo(&buf))
+		assert.Contains(t, buf.String(), "func (WebCookie) WebCookieCookieLifetime(sc config.Scoped) (int, error) {")
+	})
+
+	t.Run("file not found", func(t *testing.T) {
+		_, err := cfggen.ParsePkgTpl("testdata/not_found.go")
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
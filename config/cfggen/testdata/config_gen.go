@@ -0,0 +1,149 @@
+// Auto generated via github.com/corestoreio/pkg/config/cfggen
+
+package testdata
+
+import (
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/store/scope"
+)
+
+// Route* constants contain all configuration routes.
+const (
+	RouteWebSecureBaseURL              = "web/secure/base_url"
+	RouteWebSecureUseInFrontend        = "web/secure/use_in_frontend"
+	RouteWebCookieCookieLifetime       = "web/cookie/cookie_lifetime"
+	RouteWebCookieTimeout              = "web/cookie/timeout"
+	RouteWebCookieAllowedMethods       = "web/cookie/allowed_methods"
+	RouteGeneralStoreInformationName   = "general/store_information/name"
+	RouteGeneralStoreInformationOpened = "general/store/opened_at"
+	RouteGeneralStoreInformationRate   = "general/store_information/rate"
+)
+
+// Config provides typed access to all configuration values. The zero
+// value is ready to use.
+type Config struct {
+	Web
+	General
+}
+
+// Web provides typed access to the configuration section web.
+type Web struct {
+	WebSecure
+	WebCookie
+}
+
+// WebSecure provides typed access to the configuration group web/secure.
+type WebSecure struct{}
+
+// WebSecureBaseURL returns the value of route web/secure/base_url
+// restricted up to scope.Store.
+// Label: Base URL
+// Default: "{{unsecure_base_url}}"
+func (WebSecure) WebSecureBaseURL(sc config.Scoped) (string, error) {
+	v, ok, err := sc.Get(scope.Store, RouteWebSecureBaseURL).Str()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if !ok {
+		return "{{unsecure_base_url}}", nil
+	}
+	return v, nil
+}
+
+// WebSecureUseInFrontend returns the value of route web/secure/use_in_frontend
+// restricted up to scope.Website.
+func (WebSecure) WebSecureUseInFrontend(sc config.Scoped) (bool, error) {
+	v, _, err := sc.Get(scope.Website, RouteWebSecureUseInFrontend).Bool()
+	return v, errors.WithStack(err)
+}
+
+// WebCookie provides typed access to the configuration group web/cookie.
+type WebCookie struct{}
+
+// WebCookieCookieLifetime returns the value of route web/cookie/cookie_lifetime
+// restricted up to scope.Website.
+// Default: 3600
+func (WebCookie) WebCookieCookieLifetime(sc config.Scoped) (int, error) {
+	v, ok, err := sc.Get(scope.Website, RouteWebCookieCookieLifetime).Int()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if !ok {
+		return 3600, nil
+	}
+	return v, nil
+}
+
+// WebCookieTimeout returns the value of route web/cookie/timeout
+// restricted up to scope.Website.
+// Default: 90 * time.Second
+func (WebCookie) WebCookieTimeout(sc config.Scoped) (time.Duration, error) {
+	v, ok, err := sc.Get(scope.Website, RouteWebCookieTimeout).Duration()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if !ok {
+		return 90 * time.Second, nil
+	}
+	return v, nil
+}
+
+// WebCookieAllowedMethods returns the value of route web/cookie/allowed_methods
+// restricted up to scope.Website.
+// Default: []string{"GET", "POST"}
+func (WebCookie) WebCookieAllowedMethods(sc config.Scoped) ([]string, error) {
+	v := sc.Get(scope.Website, RouteWebCookieAllowedMethods)
+	if _, ok, err := v.Str(); err != nil {
+		return nil, errors.WithStack(err)
+	} else if !ok {
+		return []string{"GET", "POST"}, nil
+	}
+	vals, err := v.Strs()
+	return vals, errors.WithStack(err)
+}
+
+// General provides typed access to the configuration section general.
+type General struct {
+	GeneralStoreInformation
+}
+
+// GeneralStoreInformation provides typed access to the configuration group general/store_information.
+type GeneralStoreInformation struct{}
+
+// GeneralStoreInformationName returns the value of route general/store_information/name
+// restricted up to scope.Default.
+func (GeneralStoreInformation) GeneralStoreInformationName(sc config.Scoped) (string, error) {
+	v, _, err := sc.Get(scope.Default, RouteGeneralStoreInformationName).Str()
+	return v, errors.WithStack(err)
+}
+
+// GeneralStoreInformationOpened returns the value of route general/store/opened_at
+// restricted up to scope.Default.
+// Default: time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC)
+func (GeneralStoreInformation) GeneralStoreInformationOpened(sc config.Scoped) (time.Time, error) {
+	v, ok, err := sc.Get(scope.Default, RouteGeneralStoreInformationOpened).Time()
+	if err != nil {
+		return time.Time{}, errors.WithStack(err)
+	}
+	if !ok {
+		return time.Date(2019, 1, 2, 15, 4, 5, 0, time.UTC), nil
+	}
+	return v, nil
+}
+
+// GeneralStoreInformationRate returns the value of route general/store_information/rate
+// restricted up to scope.Default.
+// Default: 0.5
+func (GeneralStoreInformation) GeneralStoreInformationRate(sc config.Scoped) (float64, error) {
+	v, ok, err := sc.Get(scope.Default, RouteGeneralStoreInformationRate).Float64()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if !ok {
+		return 0.5, nil
+	}
+	return v, nil
+}
@@ -143,6 +143,26 @@ func (ss Sections) TotalFields() (fs int) {
 	return fs
 }
 
+// SecretRoutes returns the routes of all fields marked as Secret. A ConfigRoute
+// of a Field takes precedence.
+func (ss Sections) SecretRoutes() (routes []string) {
+	for _, s := range ss {
+		for _, g := range s.Groups {
+			for _, f := range g.Fields {
+				if !f.Secret {
+					continue
+				}
+				route := f.ConfigRoute
+				if route == "" {
+					route = s.ID + string(PathSeparator) + g.ID + string(PathSeparator) + f.ID
+				}
+				routes = append(routes, route)
+			}
+		}
+	}
+	return routes
+}
+
 // MergeMultiple merges n SectionSlices into the current slice. Behaviour for
 // duplicates: Last item wins. Not thread safe.
 func (ss Sections) MergeMultiple(sSlices ...Sections) Sections {
@@ -526,6 +546,23 @@ type Field struct {
 	// bool. An empty string is equal to NULL. A default gets requests if the
 	// value for a path cannot be retrieved from Level1 or Level2 storage.
 	Default string `json:",omitempty"`
+	// DataType defines the type of the stored value and gets checked by the
+	// SchemaValidator. One of the DataType* constants. If empty, TypeTime and
+	// TypeDuration imply their data type, all others are strings.
+	DataType string `json:",omitempty"`
+	// SourceOptions lists the allowed values. A TypeMultiselect value contains
+	// comma separated options. Checked by the SchemaValidator.
+	SourceOptions []string `json:",omitempty"`
+	// Min and Max restrict a numeric value or the length of a string,
+	// inclusive. Max zero means no upper limit. Checked by the
+	// SchemaValidator.
+	Min float64 `json:",omitempty"`
+	Max float64 `json:",omitempty"`
+	// Secret marks the value as sensitive, e.g. a password or an API key. The
+	// value gets encrypted at rest by storage.Secrets and redacted in
+	// Value.String, Value.MarshalJSON and the SchemaValidator. Once a Field
+	// has been marked as secret, an Update cannot revert it.
+	Secret bool `json:",omitempty"`
 }
 
 // MakeFields wrapper to create a new Fields
@@ -621,5 +658,18 @@ func (f *Field) Update(new *Field) *Field {
 	if new.Default != "" {
 		f.Default = new.Default
 	}
+	if new.DataType != "" {
+		f.DataType = new.DataType
+	}
+	if len(new.SourceOptions) > 0 {
+		f.SourceOptions = append([]string(nil), new.SourceOptions...)
+	}
+	if new.Min != 0 {
+		f.Min = new.Min
+	}
+	if new.Max != 0 {
+		f.Max = new.Max
+	}
+	f.Secret = f.Secret || new.Secret
 	return f
 }
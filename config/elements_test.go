@@ -856,3 +856,20 @@ func TestSectionSliceAppendFields(t *testing.T) {
 		t.Errorf("\nWant: %s\nHave: %s\n", want, have)
 	}
 }
+
+func TestSections_SecretRoutes(t *testing.T) {
+	ss := config.MustMakeSectionsValidate(
+		&config.Section{ID: "aa", Groups: config.MakeGroups(&config.Group{ID: "bb", Fields: config.MakeFields(
+			&config.Field{ID: "cc", Secret: true},
+			&config.Field{ID: "dd"},
+			&config.Field{ID: "ee", ConfigRoute: "aa/xx/ee", Secret: true},
+		)})},
+	)
+	assert.Exactly(t, []string{"aa/bb/cc", "aa/xx/ee"}, ss.SecretRoutes())
+
+	// an update cannot remove the secret flag
+	ss.UpdateField("aa/bb/cc", &config.Field{ID: "cc", Label: "Password"})
+	f, _ := ss.FindField("aa/bb/cc")
+	assert.True(t, f.Secret)
+	assert.Exactly(t, "Password", f.Label)
+}
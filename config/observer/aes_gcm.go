@@ -51,6 +51,8 @@ type aesGCM struct {
 // the AES-GCM mode. Only two events are supported: config.EventOnBeforeSet for
 // encryption and config.EventOnAfterGet for decryption. For security reasons
 // this function cannot be accessed via JSON or protocol buffers.
+// The key and the nonce are static. For key rotation and a random nonce per
+// value use storage.Secrets.
 func NewAESGCM(eventType uint8, eo *AESGCMOptions) (config.Observer, error) {
 
 	if eventType != config.EventOnBeforeSet && eventType != config.EventOnAfterGet {
@@ -56,7 +56,9 @@ type Options struct {
 
 	// EnableHotReload if the Service receives an OS signal, it triggers a hot
 	// reload of the cached functions of type LoadDataOption. Errors during hot
-	// reloading do not trigger an exit of the config.Service.
+	// reloading do not trigger an exit of the config.Service. To reload
+	// configuration files when they change, see storage.WatchYAML and
+	// storage.WatchJSON.
 	EnableHotReload bool
 	// HotReloadSignals specifies custom signals to listen to. Defaults to
 	// syscall.SIGUSR2
@@ -204,7 +206,8 @@ func WithFieldMeta(fms ...*FieldMeta) LoadDataOption {
 // routes. This function option cannot handle a default value for a specific
 // website/store scope. Storage level and sort order are not supported. Because
 // of using FieldMeta, it supports hierarchical fall back to the parent scope
-// for default values.
+// for default values. The values of Fields marked as Secret get redacted in
+// Value.String and Value.MarshalJSON.
 func WithApplySections(sections ...*Section) LoadDataOption {
 	secs := Sections(sections)
 	var once bool
@@ -245,6 +248,12 @@ func WithApplySections(sections ...*Section) LoadDataOption {
 					}
 				}
 			}
+			for _, route := range secs.SecretRoutes() {
+				if s.secretRoutes == nil {
+					s.secretRoutes = make(map[Route]struct{})
+				}
+				s.secretRoutes[Route(route)] = struct{}{}
+			}
 			return nil
 		},
 	}
@@ -0,0 +1,269 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/byteconv"
+)
+
+// DataType* constants define the data type of a Field value.
+const (
+	DataTypeString   = "string"
+	DataTypeInt      = "int"
+	DataTypeFloat    = "float"
+	DataTypeBool     = "bool"
+	DataTypeDuration = "duration"
+	DataTypeTime     = "time"
+)
+
+// Schema* constants define the rules of a SchemaViolation.
+const (
+	SchemaRuleUnknownPath   = "unknown_path"
+	SchemaRuleScope         = "scope"
+	SchemaRuleDataType      = "data_type"
+	SchemaRuleSourceOptions = "source_options"
+	SchemaRuleRange         = "range"
+)
+
+// SchemaViolation describes a value which does not match the definition of its
+// Field.
+type SchemaViolation struct {
+	// Path the fully qualified path.
+	Path string
+	// Rule one of the SchemaRule* constants.
+	Rule    string
+	Message string
+}
+
+// SchemaError contains all violations found by the SchemaValidator. The error
+// has the kind errors.NotValid.
+type SchemaError struct {
+	Violations []SchemaViolation
+}
+
+// Error implements the error interface and lists all violations.
+func (se *SchemaError) Error() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "[config] Schema validation failed with %d violation(s):", len(se.Violations))
+	for _, v := range se.Violations {
+		fmt.Fprintf(&buf, "\n\t%s: %s (%s)", v.Path, v.Message, v.Rule)
+	}
+	return buf.String()
+}
+
+// ErrorKind returns errors.NotValid.
+func (se *SchemaError) ErrorKind() errors.Kind { return errors.NotValid }
+
+// SchemaOptions applies options to the SchemaValidator.
+type SchemaOptions struct {
+	// Strict reports paths without a Field definition as violation.
+	Strict bool
+	// Insecure enables printing the values in the violation messages. This
+	// might and will leak sensitive information. Values of Fields marked as
+	// Secret never get printed.
+	Insecure bool
+}
+
+type schemaField struct {
+	*Field
+	scopes scope.Perm
+}
+
+// SchemaValidator checks a complete dataset of configuration values against
+// the Field definitions of Sections: the data type, the allowed scopes, the
+// source options and the min/max range. All violations get reported in one
+// SchemaError. Contrary to the validation observers of package config/observer
+// it does not run on each Set operation. Use it as a startup gate, in a CLI
+// check or as validation function of storage.WatchOptions.
+//		sv, err := config.NewSchemaValidator(sections, config.SchemaOptions{})
+//		pvs, err := storage.ReadYAML(srv, storage.WithFile("config.yaml"))
+//		if err := sv.Validate(pvs); err != nil {
+//			panic(err) // err is a *config.SchemaError
+//		}
+// Safe for concurrent use.
+type SchemaValidator struct {
+	o SchemaOptions
+	// fields the key is the route
+	fields map[string]schemaField
+}
+
+// NewSchemaValidator creates a new validator from the sections. A Field
+// without Scopes inherits them from its Group or Section. Zero Scopes allow
+// all scopes.
+func NewSchemaValidator(ss Sections, o SchemaOptions) (*SchemaValidator, error) {
+	if err := ss.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	sv := &SchemaValidator{
+		o:      o,
+		fields: make(map[string]schemaField, ss.TotalFields()),
+	}
+	for _, s := range ss {
+		for _, g := range s.Groups {
+			for _, f := range g.Fields {
+				route := f.ConfigRoute
+				if route == "" {
+					route = s.ID + string(PathSeparator) + g.ID + string(PathSeparator) + f.ID
+				}
+				switch f.DataType {
+				case "", DataTypeString, DataTypeInt, DataTypeFloat, DataTypeBool, DataTypeDuration, DataTypeTime:
+				default:
+					return nil, errors.NotSupported.Newf("[config] NewSchemaValidator DataType %q of route %q not supported", f.DataType, route)
+				}
+				if f.Max != 0 && f.Min > f.Max {
+					return nil, errors.NotValid.Newf("[config] NewSchemaValidator Min %v is greater than Max %v for route %q", f.Min, f.Max, route)
+				}
+				sf := schemaField{Field: f, scopes: f.Scopes}
+				if sf.scopes == 0 {
+					sf.scopes = g.Scopes
+				}
+				if sf.scopes == 0 {
+					sf.scopes = s.Scopes
+				}
+				sv.fields[route] = sf
+			}
+		}
+	}
+	return sv, nil
+}
+
+// Validate checks all values and returns a *SchemaError with all violations or
+// nil. NULL and empty values are not checked because they are equal to not
+// set.
+func (sv *SchemaValidator) Validate(pvs []PathValue) error {
+	se := new(SchemaError)
+	for i := range pvs {
+		sv.validate(se, &pvs[i].Path, pvs[i].Value)
+	}
+	if len(se.Violations) == 0 {
+		return nil
+	}
+	return se
+}
+
+func (sv *SchemaValidator) validate(se *SchemaError, p *Path, value []byte) {
+	addViolation := func(rule, format string, args ...interface{}) {
+		se.Violations = append(se.Violations, SchemaViolation{
+			Path:    p.String(),
+			Rule:    rule,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	scp, route := p.ScopeRoute()
+	f, ok := sv.fields[route]
+	if !ok {
+		if sv.o.Strict {
+			addViolation(SchemaRuleUnknownPath, "route %q has no field definition", route)
+		}
+		return
+	}
+	if st := scp.Type(); f.scopes > 0 && !f.scopes.Has(st) {
+		addViolation(SchemaRuleScope, "scope %s not allowed, allowed: %s", st, f.scopes)
+	}
+	if len(value) == 0 {
+		return
+	}
+
+	insecure := sv.o.Insecure && !f.Secret
+	values := []string{string(value)}
+	if f.Type == TypeMultiselect {
+		values = strings.Split(values[0], string(CSVColumnSeparator))
+	}
+	for _, v := range values {
+		quoted := valRedacted
+		if insecure {
+			quoted = strconv.Quote(v)
+		}
+		if !utf8.ValidString(v) {
+			addViolation(SchemaRuleDataType, "value %s is not valid UTF-8", quoted)
+			continue
+		}
+
+		num, isNum, err := f.parse(v)
+		if err != nil {
+			addViolation(SchemaRuleDataType, "value %s is not a valid %s", quoted, f.dataType())
+			continue
+		}
+		if len(f.SourceOptions) > 0 && !containsString(f.SourceOptions, v) {
+			addViolation(SchemaRuleSourceOptions, "value %s is not one of the %d source options", quoted, len(f.SourceOptions))
+		}
+		if f.Min == 0 && f.Max == 0 {
+			continue
+		}
+		what := "value"
+		if !isNum {
+			what = "length"
+			num = float64(utf8.RuneCountInString(v))
+		}
+		if num < f.Min || (f.Max != 0 && num > f.Max) {
+			if insecure || (!isNum && !f.Secret) {
+				addViolation(SchemaRuleRange, "%s %v out of range [%v, %v]", what, num, f.Min, f.Max)
+			} else {
+				addViolation(SchemaRuleRange, "%s out of range [%v, %v]", what, f.Min, f.Max)
+			}
+		}
+	}
+}
+
+func (f schemaField) dataType() string {
+	switch {
+	case f.DataType != "":
+		return f.DataType
+	case f.Type == TypeTime:
+		return DataTypeTime
+	case f.Type == TypeDuration:
+		return DataTypeDuration
+	}
+	return DataTypeString
+}
+
+// parse parses the value according to the data type and returns the numeric
+// value for int and float types.
+func (f schemaField) parse(v string) (num float64, isNum bool, err error) {
+	switch f.dataType() {
+	case DataTypeInt:
+		var i int64
+		i, err = strconv.ParseInt(v, 10, 64)
+		return float64(i), true, err
+	case DataTypeFloat:
+		num, err = strconv.ParseFloat(v, 64)
+		return num, true, err
+	case DataTypeBool:
+		_, _, err = byteconv.ParseBool([]byte(v))
+	case DataTypeDuration:
+		_, err = time.ParseDuration(v)
+	case DataTypeTime:
+		_, err = parseDateTime(v, time.UTC)
+	}
+	return 0, false, err
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
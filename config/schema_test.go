@@ -0,0 +1,173 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config_test
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var schemaSections = config.MustMakeSectionsValidate(
+	&config.Section{
+		ID: "web",
+		Groups: config.MakeGroups(
+			&config.Group{
+				ID:     "cors",
+				Scopes: scope.PermWebsite,
+				Fields: config.MakeFields(
+					&config.Field{ID: "allow_credentials", Type: config.TypeSelect, DataType: config.DataTypeBool},
+					&config.Field{ID: "max_age", DataType: config.DataTypeInt, Min: 0, Max: 86400},
+					&config.Field{ID: "allowed_methods", Type: config.TypeMultiselect, SourceOptions: []string{"GET", "POST", "PUT"}},
+					&config.Field{ID: "timeout", Type: config.TypeDuration, Scopes: scope.PermStore},
+				),
+			},
+		),
+	},
+	&config.Section{
+		ID:     "general",
+		Scopes: scope.PermStore,
+		Groups: config.MakeGroups(
+			&config.Group{
+				ID: "store_information",
+				Fields: config.MakeFields(
+					&config.Field{ID: "name", Min: 2, Max: 10},
+					&config.Field{ID: "opened", ConfigRoute: "general/store/opened_at", Type: config.TypeTime},
+					&config.Field{ID: "rate", DataType: config.DataTypeFloat, Min: 0.5},
+				),
+			},
+		),
+	},
+)
+
+func pathValue(scp scope.TypeID, route, value string) config.PathValue {
+	var v []byte
+	if value != "" {
+		v = []byte(value)
+	}
+	return config.PathValue{Path: *config.MustNewPathWithScope(scp, route), Value: v}
+}
+
+func TestNewSchemaValidator(t *testing.T) {
+	t.Run("unsupported data type", func(t *testing.T) {
+		_, err := config.NewSchemaValidator(config.MakeSections(&config.Section{ID: "aa", Groups: config.MakeGroups(&config.Group{
+			ID: "bb", Fields: config.MakeFields(&config.Field{ID: "cc", DataType: "complex128"}),
+		})}), config.SchemaOptions{})
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+	t.Run("min greater max", func(t *testing.T) {
+		_, err := config.NewSchemaValidator(config.MakeSections(&config.Section{ID: "aa", Groups: config.MakeGroups(&config.Group{
+			ID: "bb", Fields: config.MakeFields(&config.Field{ID: "cc", Min: 3, Max: 2}),
+		})}), config.SchemaOptions{})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
+
+func TestSchemaValidator_Validate(t *testing.T) {
+	def := scope.DefaultTypeID
+	ws1 := scope.Website.WithID(1)
+	st2 := scope.Store.WithID(2)
+
+	t.Run("valid", func(t *testing.T) {
+		sv, err := config.NewSchemaValidator(schemaSections, config.SchemaOptions{Strict: true})
+		assert.NoError(t, err)
+		assert.NoError(t, sv.Validate([]config.PathValue{
+			pathValue(def, "web/cors/allow_credentials", "1"),
+			pathValue(ws1, "web/cors/allow_credentials", "false"),
+			pathValue(ws1, "web/cors/max_age", "3600"),
+			pathValue(def, "web/cors/allowed_methods", "GET,POST"),
+			pathValue(st2, "web/cors/timeout", "3s"),
+			pathValue(st2, "general/store_information/name", "Shop"),
+			pathValue(st2, "general/store/opened_at", "2019-01-02 15:04:05"),
+			pathValue(def, "general/store_information/rate", "0.75"),
+			pathValue(def, "web/cors/max_age", ""), // NULL
+		}))
+	})
+
+	t.Run("all violations", func(t *testing.T) {
+		sv, err := config.NewSchemaValidator(schemaSections, config.SchemaOptions{Strict: true})
+		assert.NoError(t, err)
+		err = sv.Validate([]config.PathValue{
+			pathValue(def, "web/cors/allow_credentials", "maybe"),
+			pathValue(st2, "web/cors/max_age", "100000"),
+			pathValue(def, "web/cors/allowed_methods", "GET,DELETE"),
+			pathValue(st2, "web/cors/timeout", "3 seconds"),
+			pathValue(st2, "general/store_information/name", "A"),
+			pathValue(def, "general/store/opened_at", "yesterday"),
+			pathValue(def, "general/store_information/rate", "0.1"),
+			pathValue(def, "general/store_information/phone", "123"),
+		})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		se, ok := err.(*config.SchemaError)
+		assert.True(t, ok, "expecting *config.SchemaError, got %T", err)
+
+		var rules []string
+		for _, v := range se.Violations {
+			rules = append(rules, v.Path+" "+v.Rule)
+		}
+		assert.Exactly(t, []string{
+			"default/0/web/cors/allow_credentials data_type",
+			"stores/2/web/cors/max_age scope",
+			"stores/2/web/cors/max_age range",
+			"default/0/web/cors/allowed_methods source_options",
+			"stores/2/web/cors/timeout data_type",
+			"stores/2/general/store_information/name range",
+			"default/0/general/store/opened_at data_type",
+			"default/0/general/store_information/rate range",
+			"default/0/general/store_information/phone unknown_path",
+		}, rules)
+		assert.NotContains(t, err.Error(), "maybe")
+		assert.Contains(t, err.Error(), "[config] Schema validation failed with 9 violation(s):")
+		assert.Contains(t, err.Error(), "value <redacted> is not a valid bool (data_type)")
+		assert.Contains(t, err.Error(), "length 1 out of range [2, 10] (range)")
+	})
+
+	t.Run("insecure and not strict", func(t *testing.T) {
+		sv, err := config.NewSchemaValidator(schemaSections, config.SchemaOptions{Insecure: true})
+		assert.NoError(t, err)
+		err = sv.Validate([]config.PathValue{
+			pathValue(def, "web/cors/allow_credentials", "maybe"),
+			pathValue(ws1, "web/cors/max_age", "-1"),
+			pathValue(def, "general/store_information/phone", "123"),
+		})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		assert.Len(t, err.(*config.SchemaError).Violations, 2)
+		assert.Contains(t, err.Error(), `value "maybe" is not a valid bool`)
+		assert.Contains(t, err.Error(), `value -1 out of range [0, 86400]`)
+	})
+
+	t.Run("secrets never get printed", func(t *testing.T) {
+		sv, err := config.NewSchemaValidator(config.MustMakeSectionsValidate(&config.Section{
+			ID: "payment",
+			Groups: config.MakeGroups(&config.Group{ID: "stripe", Fields: config.MakeFields(
+				&config.Field{ID: "api_key", Secret: true, Min: 10},
+				&config.Field{ID: "pin", Secret: true, DataType: config.DataTypeInt},
+			)}),
+		}), config.SchemaOptions{Insecure: true})
+		assert.NoError(t, err)
+		err = sv.Validate([]config.PathValue{
+			pathValue(def, "payment/stripe/api_key", "sk_12"),
+			pathValue(def, "payment/stripe/pin", "12x4"),
+		})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		assert.NotContains(t, err.Error(), "sk_12")
+		assert.NotContains(t, err.Error(), "12x4")
+		assert.Contains(t, err.Error(), "length out of range [10, 0] (range)")
+		assert.Contains(t, err.Error(), "value <redacted> is not a valid int (data_type)")
+	})
+}
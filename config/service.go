@@ -90,6 +90,9 @@ type Service struct {
 	// routeConfig contains essential information about a route like scope for
 	// permission, default value or events.
 	routeConfig *trieRoute
+	// secretRoutes contains the routes of the Fields marked as Secret, set via
+	// WithApplySections. Their values get redacted.
+	secretRoutes map[Route]struct{}
 }
 
 // NewService creates the main new configuration for all scopes: default,
@@ -319,41 +322,156 @@ func (s *Service) DeregisterObserver(event uint8, route string) error {
 //		// 6 for example comes from core_store/store database table
 //		err := Write(p.Bind(scope.StoreID, 6), "CHF")
 func (s *Service) Set(p *Path, v []byte) (err error) { // TODO v should be an immutable string
-	// wow so many IFs :-\
-	if p.UseEnvSuffix && p.envSuffix != s.envName {
-		p.envSuffix = s.envName
-	}
 	if s.config.Log != nil && s.config.Log.IsDebug() {
 		defer log.WhenDone(s.config.Log).Debug("config.Service.Set", log.Stringer("path", p), log.Int("data_length", len(v)), log.Err(err))
 	}
-	if err = p.IsValid(); err != nil {
-		err = errors.WithStack(err)
-		return
-	}
 
 	s.mu.RLock()
-	key := p.separatorSuffixRoute() // this can be optimized to move it into the process signature
-	key = buildTrieKey(key, p.ScopeID)
-	if v, _, err = s.routeConfig.process(key, EventOnBeforeSet, p, v, true); err != nil {
-		s.mu.RUnlock()
+	err = s.set(s.level2, p, v)
+	s.mu.RUnlock()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if s.pubSub != nil {
+		s.pubSub.sendMsg(*p)
+	}
+	return nil
+}
+
+// set writes the value into the storage and runs the observers. The caller must
+// hold the lock.
+func (s *Service) set(st Storager, p *Path, v []byte) (err error) {
+	key, v, err := s.beforeSet(p, v)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 	defer func() {
-		var err2 error
-		if v, _, err2 = s.routeConfig.process(key, EventOnAfterSet, p, v, err == nil); err == nil && err2 != nil {
+		if err2 := s.afterSet(key, p, v, err == nil); err == nil && err2 != nil {
 			err = errors.WithStack(err2)
 		}
-		s.mu.RUnlock()
 	}()
 
-	if err := s.level2.Set(p, v); err != nil {
+	if err := st.Set(p, v); err != nil {
 		return errors.Wrap(err, "[config] Service.level2.Set")
 	}
-	if s.pubSub != nil {
-		s.pubSub.sendMsg(*p)
+	return nil
+}
+
+// beforeSet validates the path and runs the EventOnBeforeSet observers. It
+// returns the key of the route trie and the value to write. The caller must
+// hold the lock.
+func (s *Service) beforeSet(p *Path, v []byte) (key string, _ []byte, err error) {
+	// wow so many IFs :-\
+	if p.UseEnvSuffix && p.envSuffix != s.envName {
+		p.envSuffix = s.envName
+	}
+	if err = p.IsValid(); err != nil {
+		return "", nil, errors.WithStack(err)
 	}
 
-	return
+	key = p.separatorSuffixRoute() // this can be optimized to move it into the process signature
+	key = buildTrieKey(key, p.ScopeID)
+	if v, _, err = s.routeConfig.process(key, EventOnBeforeSet, p, v, true); err != nil {
+		return "", nil, errors.WithStack(err)
+	}
+	return key, v, nil
+}
+
+// afterSet runs the EventOnAfterSet observers. Argument ok reports whether the
+// value has been written. The caller must hold the lock.
+func (s *Service) afterSet(key string, p *Path, v []byte, ok bool) error {
+	_, _, err := s.routeConfig.process(key, EventOnAfterSet, p, v, ok)
+	return errors.WithStack(err)
+}
+
+// PathValue contains a path and its value for function Service.SetBatch.
+type PathValue struct {
+	Path  Path
+	Value []byte
+}
+
+// SetBatch writes all values atomically. Concurrent calls to Get and Set block
+// until all values have been written. If a value cannot be written, the
+// previous values of the already written paths get restored and the error gets
+// returned. Paths which did not exist before cannot be removed because the
+// Storager has no delete function. Level 1 writes into Options.Level1, if set,
+// like LoadDataOption.WithUseStorageLevel, any other level writes into the
+// level2 Storager. The EventOnBeforeSet observers of all paths run before the
+// first value gets written and the EventOnAfterSet observers after the last
+// value has been written, hence an observer can call Get. After all values
+// have been written, the subscribers receive a message for each path.
+func (s *Service) SetBatch(level int, pvs ...PathValue) (err error) {
+	st := s.level2
+	if level == 1 && s.config.Level1 != nil {
+		st = s.config.Level1
+	}
+
+	type batchValue struct {
+		p   Path
+		key string
+		v   []byte
+		// prev contains the previous value to restore it.
+		prev  []byte
+		found bool
+	}
+	bvs := make([]batchValue, len(pvs))
+
+	s.mu.RLock()
+	for i := 0; i < len(pvs) && err == nil; i++ {
+		bvs[i].p = pvs[i].Path
+		if bvs[i].key, bvs[i].v, err = s.beforeSet(&bvs[i].p, pvs[i].Value); err != nil {
+			err = errors.Wrapf(err, "[config] Service.SetBatch.Set with path %q", bvs[i].p.String())
+		}
+	}
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	written := 0
+	for ; written < len(bvs); written++ {
+		bv := &bvs[written]
+		if bv.prev, bv.found, err = st.Get(&bv.p); err != nil {
+			err = errors.Wrapf(err, "[config] Service.SetBatch.Get with path %q", bv.p.String())
+			break
+		}
+		if err = st.Set(&bv.p, bv.v); err != nil {
+			err = errors.Wrapf(err, "[config] Service.SetBatch.Set with path %q", bv.p.String())
+			break
+		}
+	}
+	if err != nil {
+		for i := written - 1; i >= 0; i-- {
+			bv := bvs[i]
+			if !bv.found {
+				continue
+			}
+			if err2 := st.Set(&bv.p, bv.prev); err2 != nil && s.config.Log != nil && s.config.Log.IsInfo() {
+				s.config.Log.Info("config.Service.SetBatch.Restore", log.Stringer("path", &bv.p), log.Err(err2))
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	ok := err == nil
+	s.mu.RLock()
+	for i := range bvs {
+		if err2 := s.afterSet(bvs[i].key, &bvs[i].p, bvs[i].v, ok); err == nil && err2 != nil {
+			err = errors.Wrapf(err2, "[config] Service.SetBatch.Set with path %q", bvs[i].p.String())
+		}
+	}
+	s.mu.RUnlock()
+
+	if err != nil {
+		return err
+	}
+	if s.pubSub != nil {
+		for _, bv := range bvs {
+			s.pubSub.sendMsg(bv.p)
+		}
+	}
+	return nil
 }
 
 // Get returns a configuration value from the Service, ignoring the scope
@@ -396,6 +514,9 @@ func (s *Service) Get(p *Path) (v *Value) {
 	}
 
 	s.mu.RLock()
+	if s.secretRoutes != nil {
+		_, v.secret = s.secretRoutes[p.route]
+	}
 	key := p.separatorSuffixRoute() // this can be optimized to move it into the process signature
 	key = buildTrieKey(key, p.ScopeID)
 	if _, _, err := s.routeConfig.process(key, EventOnBeforeGet, p, nil, false); err != nil {
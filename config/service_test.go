@@ -16,6 +16,7 @@ package config_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"os"
 	"sort"
 	"strconv"
@@ -577,6 +578,133 @@ func TestService_DifferentStorageLevels(t *testing.T) {
 	defer func() { assert.NoError(t, srv.Close()) }()
 }
 
+func TestService_SetBatch(t *testing.T) {
+	defer leaktest.Check(t)()
+
+	pName := config.MustNewPath("general/store_information/name")
+	pPhone := config.MustNewPath("general/store_information/phone")
+	pLocked := config.MustNewPath("general/locale/code")
+
+	l1 := storage.NewMap()
+	srv := config.MustNewService(storage.NewMap(), config.Options{
+		Level1:       l1,
+		EnablePubSub: true,
+	})
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	msgs := make(chan string, 10)
+	_, err := srv.Subscribe("default", &testSubscriber{
+		t: t,
+		f: func(p config.Path) error {
+			msgs <- p.String()
+			return nil
+		},
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, srv.SetBatch(1,
+		config.PathValue{Path: *pName, Value: []byte(`Shop`)},
+		config.PathValue{Path: *pPhone, Value: []byte(`0123`)},
+	))
+	assert.Exactly(t, pName.String(), <-msgs)
+	assert.Exactly(t, pPhone.String(), <-msgs)
+
+	v, ok, err := l1.Get(pName)
+	assert.NoError(t, err)
+	assert.True(t, ok, "level 1 must contain the value")
+	assert.Exactly(t, "Shop", string(v))
+
+	t.Run("restore on error", func(t *testing.T) {
+		assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "general/locale/code", testObserver{
+			err: errors.NotAllowed.Newf("Ups"),
+		}))
+		err := srv.SetBatch(1,
+			config.PathValue{Path: *pName, Value: []byte(`Shop2`)},
+			config.PathValue{Path: *pLocked, Value: []byte(`de_CH`)},
+		)
+		assert.True(t, errors.NotAllowed.Match(err), "%+v", err)
+		assert.Exactly(t, `"Shop"`, srv.Get(pName).String())
+		assert.NoError(t, srv.DeregisterObserver(config.EventOnBeforeSet, "general/locale/code"))
+
+		select {
+		case m := <-msgs:
+			t.Errorf("no message expected, got %q", m)
+		case <-time.After(10 * time.Millisecond):
+		}
+	})
+
+	t.Run("observer calls Get", func(t *testing.T) {
+		var got []string
+		getObserver := testObserver{
+			observe: func(p config.Path, rawData []byte, found bool) ([]byte, error) {
+				got = append(got, srv.Get(pName).String())
+				return rawData, nil
+			},
+		}
+		assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "general/store_information/phone", getObserver))
+		assert.NoError(t, srv.RegisterObserver(config.EventOnAfterSet, "general/store_information/phone", getObserver))
+		defer func() {
+			assert.NoError(t, srv.DeregisterObserver(config.EventOnBeforeSet, "general/store_information/phone"))
+			assert.NoError(t, srv.DeregisterObserver(config.EventOnAfterSet, "general/store_information/phone"))
+		}()
+
+		done := make(chan error)
+		go func() {
+			done <- srv.SetBatch(1,
+				config.PathValue{Path: *pName, Value: []byte(`Shop3`)},
+				config.PathValue{Path: *pPhone, Value: []byte(`0456`)},
+			)
+		}()
+		select {
+		case err := <-done:
+			assert.NoError(t, err)
+		case <-time.After(time.Second):
+			t.Fatal("SetBatch deadlocked")
+		}
+		assert.Exactly(t, []string{`"Shop"`, `"Shop3"`}, got)
+		<-msgs
+		<-msgs
+	})
+}
+
+// failingStorage returns an error when a value gets written to the route.
+type failingStorage struct {
+	config.Storager
+	route string
+}
+
+func (fs failingStorage) Set(p *config.Path, value []byte) error {
+	if r, _ := p.FQ(); strings.HasSuffix(r, fs.route) {
+		return errors.WriteFailed.Newf("Ups")
+	}
+	return fs.Storager.Set(p, value)
+}
+
+func TestService_SetBatch_Restore(t *testing.T) {
+	pName := config.MustNewPath("general/store_information/name")
+	pLocked := config.MustNewPath("general/locale/code")
+
+	srv := config.MustNewService(failingStorage{Storager: storage.NewMap(), route: "general/locale/code"}, config.Options{})
+	defer func() { assert.NoError(t, srv.Close()) }()
+	assert.NoError(t, srv.Set(pName, []byte(`Shop`)))
+
+	var afterSet []bool
+	assert.NoError(t, srv.RegisterObserver(config.EventOnAfterSet, "general/store_information/name", testObserver{
+		observe: func(p config.Path, rawData []byte, found bool) ([]byte, error) {
+			afterSet = append(afterSet, found)
+			return rawData, nil
+		},
+	}))
+
+	err := srv.SetBatch(2,
+		config.PathValue{Path: *pName, Value: []byte(`Shop2`)},
+		config.PathValue{Path: *pLocked, Value: []byte(`de_CH`)},
+	)
+	assert.True(t, errors.WriteFailed.Match(err), "%+v", err)
+	assert.Exactly(t, `"Shop"`, srv.Get(pName).String())
+	assert.Exactly(t, []bool{false}, afterSet, "EventOnAfterSet reports the failed write")
+}
+
 type testObserver struct {
 	err     error
 	rawData []byte
@@ -876,3 +1004,57 @@ func TestService_FieldMetaData_Fallbacks(t *testing.T) {
 	})
 
 }
+
+func TestService_SecretRedaction(t *testing.T) {
+	srv := config.MustNewService(storage.NewMap(), config.Options{},
+		config.WithApplySections(
+			&config.Section{
+				ID: "payment",
+				Groups: config.MakeGroups(
+					&config.Group{
+						ID: "stripe",
+						Fields: config.MakeFields(
+							&config.Field{ID: "api_key", Secret: true},
+							&config.Field{ID: "webhook_secret", ConfigRoute: "payment/stripe_webhook/secret", Secret: true},
+							&config.Field{ID: "title"},
+						),
+					},
+				),
+			},
+		),
+	)
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	pKey := config.MustNewPath("payment/stripe/api_key")
+	pWebhook := config.MustNewPath("payment/stripe_webhook/secret")
+	pTitle := config.MustNewPath("payment/stripe/title")
+	assert.NoError(t, srv.Set(pKey, []byte("sk_live_123")))
+	assert.NoError(t, srv.Set(pWebhook, []byte("whsec_456")))
+	assert.NoError(t, srv.Set(pTitle, []byte("Stripe")))
+
+	v := srv.Get(pKey)
+	assert.True(t, v.IsSecret())
+	assert.Exactly(t, "<redacted>", v.String())
+	str, ok, err := v.Str()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Exactly(t, "sk_live_123", str, "the real value must be accessible")
+
+	data, err := json.Marshal(map[string]*config.Value{
+		"key":     v,
+		"webhook": srv.Get(pWebhook),
+		"title":   srv.Get(pTitle),
+		"missing": srv.Get(config.MustNewPath("payment/stripe/missing")),
+	})
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "sk_live")
+	var dump map[string]interface{}
+	assert.NoError(t, json.Unmarshal(data, &dump))
+	assert.Exactly(t, map[string]interface{}{
+		"key": "<redacted>", "missing": nil, "title": "Stripe", "webhook": "<redacted>",
+	}, dump)
+
+	scpd := srv.Scoped(1, 2)
+	assert.Exactly(t, "<redacted>", scpd.Get(scope.Store, "payment/stripe/api_key").String())
+	assert.Exactly(t, `"Stripe"`, scpd.Get(scope.Store, "payment/stripe/title").String())
+}
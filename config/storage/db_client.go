@@ -293,11 +293,7 @@ func (dbs *DB) Set(p *config.Path, value []byte) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		if dbs.stmtWrite == nil {
-			dbs.stmtWrite = stmt.WithArgs()
-		} else {
-			dbs.stmtWrite.WithStmt(stmt.Stmt)
-		}
+		dbs.stmtWrite = stmt.WithArgs()
 		dbs.stmtWriteStat.Open++
 	}
 
@@ -343,11 +339,7 @@ func (dbs *DB) Get(p *config.Path) (v []byte, ok bool, err error) {
 		if err != nil {
 			return nil, false, errors.WithStack(err)
 		}
-		if dbs.stmtRead == nil {
-			dbs.stmtRead = stmt.WithArgs()
-		} else {
-			dbs.stmtRead.WithStmt(stmt.Stmt)
-		}
+		dbs.stmtRead = stmt.WithArgs()
 		dbs.stmtReadStat.Open++
 	}
 
@@ -386,44 +378,60 @@ func (dbs *DB) Statistics() (value dbStats, set dbStats) {
 // overrides existing values. Stops on errors.
 func WithLoadFromDB(tbls *ddl.Tables, o DBOptions) config.LoadDataOption {
 	return config.MakeLoadDataOption(func(s *config.Service) error {
+		return iterateCoreConfigData(tbls, o, func(ccd *TableCoreConfigData, p *config.Path, v []byte) error {
+			if err := s.Set(p, v); err != nil {
+				return errors.Wrapf(err, "[config/storage] WithLoadFromDB.Service.Write Path %q Scope: %q ID: %d", ccd.Path, p.ScopeID, ccd.ConfigID)
+			}
+			return nil
+		})
+	}).WithUseStorageLevel(1)
+}
 
-		tn := o.TableName
-		if tn == "" {
-			tn = TableNameCoreConfigData
-		}
+// ReadDB reads all values of the table core_config_data without applying them
+// to a config.Service, for example to validate them with a
+// config.SchemaValidator.
+func ReadDB(tbls *ddl.Tables, o DBOptions) ([]config.PathValue, error) {
+	var pvs []config.PathValue
+	err := iterateCoreConfigData(tbls, o, func(_ *TableCoreConfigData, p *config.Path, v []byte) error {
+		pvs = append(pvs, config.PathValue{Path: *p, Value: v})
+		return nil
+	})
+	return pvs, errors.WithStack(err)
+}
 
-		tbl, err := tbls.Table(tn)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+func iterateCoreConfigData(tbls *ddl.Tables, o DBOptions, fn func(ccd *TableCoreConfigData, p *config.Path, v []byte) error) error {
+	tn := o.TableName
+	if tn == "" {
+		tn = TableNameCoreConfigData
+	}
 
-		if o.ContextTimeoutRead == 0 {
-			o.ContextTimeoutRead = time.Second * 10 // just a guess
-		}
+	tbl, err := tbls.Table(tn)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-		ctx, cancel := context.WithTimeout(context.Background(), o.ContextTimeoutRead)
-		defer cancel()
+	if o.ContextTimeoutRead == 0 {
+		o.ContextTimeoutRead = time.Second * 10 // just a guess
+	}
 
-		return tbl.SelectAll().WithArgs().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
-			var ccd TableCoreConfigData
-			if err := ccd.MapColumns(cm); err != nil {
-				return errors.Wrapf(err, "[config/storage] dbs.stmtAll.IterateSerial at row %d", cm.Count)
-			}
+	ctx, cancel := context.WithTimeout(context.Background(), o.ContextTimeoutRead)
+	defer cancel()
 
-			var v []byte
-			if ccd.Value.Valid {
-				v = []byte(ccd.Value.String)
-			}
-			scp := scope.FromString(ccd.Scope).WithID(ccd.ScopeID)
-			p, err := config.NewPathWithScope(scp, ccd.Path)
-			if err != nil {
-				return errors.Wrapf(err, "[config/storage] WithLoadFromDB.config.NewPathWithScope Path %q Scope: %q ID: %d", ccd.Path, scp, ccd.ConfigID)
-			}
-			if err = s.Set(p, v); err != nil {
-				return errors.Wrapf(err, "[config/storage] WithLoadFromDB.Service.Write Path %q Scope: %q ID: %d", ccd.Path, scp, ccd.ConfigID)
-			}
+	return tbl.SelectAll().WithArgs().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		var ccd TableCoreConfigData
+		if err := ccd.MapColumns(cm); err != nil {
+			return errors.Wrapf(err, "[config/storage] dbs.stmtAll.IterateSerial at row %d", cm.Count)
+		}
 
-			return nil
-		})
-	}).WithUseStorageLevel(1)
+		var v []byte
+		if ccd.Value.Valid {
+			v = []byte(ccd.Value.String)
+		}
+		scp := scope.FromString(ccd.Scope).WithID(ccd.ScopeID)
+		p, err := config.NewPathWithScope(scp, ccd.Path)
+		if err != nil {
+			return errors.Wrapf(err, "[config/storage] WithLoadFromDB.config.NewPathWithScope Path %q Scope: %q ID: %d", ccd.Path, scp, ccd.ConfigID)
+		}
+		return fn(&ccd, p, v)
+	})
 }
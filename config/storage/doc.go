@@ -17,6 +17,9 @@
 //
 // Use Go build tags to enable special storage clients or file format loading
 // functions. Supported tags are: bigcache (store in big cache), db (store in
-// MySQL/MariaDB), etcdv3 (store in etcd cluster/server), load from json and
-// yaml.
+// MySQL/MariaDB and record an audit trail with History), etcdv3 (store in etcd
+// cluster/server), load from json and yaml.
+//
+// Secrets encrypts the values of secret routes in any other storage with an
+// envelope encryption and supports the rotation of the master keys.
 package storage
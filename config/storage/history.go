@@ -0,0 +1,406 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storage
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/store/scope"
+)
+
+// TableNameCoreConfigDataHistory default database table name of the audit
+// trail.
+const TableNameCoreConfigDataHistory = `core_config_data_history`
+
+// NewHistoryTableCollection creates a new Tables object for
+// TableNameCoreConfigDataHistory. The CREATE TABLE statement can be generated
+// with function ddl.Tables.Diff.
+func NewHistoryTableCollection(db dml.QueryExecPreparer) *ddl.Tables {
+	return ddl.MustNewTables(
+		ddl.WithTable(
+			TableNameCoreConfigDataHistory,
+			&ddl.Column{Field: `history_id`, DataType: `int`, ColumnType: `int(10) unsigned`, Null: `NO`, Key: `PRI`, Extra: `auto_increment`},
+			&ddl.Column{Field: `scope`, DataType: `varchar`, ColumnType: `varchar(8)`, Null: `NO`, Key: `MUL`, Default: null.MakeString(`default`)},
+			&ddl.Column{Field: `scope_id`, DataType: `int`, ColumnType: `int(11)`, Null: `NO`, Default: null.MakeString(`0`)},
+			&ddl.Column{Field: `path`, DataType: `varchar`, ColumnType: `varchar(255)`, Null: `NO`, Default: null.MakeString(`general`)},
+			&ddl.Column{Field: `old_value`, DataType: `text`, ColumnType: `text`, Null: `YES`},
+			&ddl.Column{Field: `new_value`, DataType: `text`, ColumnType: `text`, Null: `YES`},
+			&ddl.Column{Field: `actor`, DataType: `varchar`, ColumnType: `varchar(255)`, Null: `NO`, Default: null.MakeString(``)},
+			&ddl.Column{Field: `created_at`, DataType: `datetime`, ColumnType: `datetime(6)`, Null: `NO`},
+		),
+		ddl.WithDB(db),
+	)
+}
+
+// Change represents a row of the audit trail. The Revision increases with each
+// change. A NULL value has not been set or stores NULL.
+type Change struct {
+	Revision uint64
+	Scope    scope.TypeID
+	Route    string
+	OldValue null.String
+	NewValue null.String
+	Actor    string
+	Created  time.Time
+}
+
+// Path returns the configuration path of the change.
+func (c Change) Path() (*config.Path, error) {
+	return config.NewPathWithScope(c.Scope, c.Route)
+}
+
+// MapColumns implements interface ColumnMapper only partially.
+func (c *Change) MapColumns(cm *dml.ColumnMap) error {
+	for cm.Next() {
+		switch col := cm.Column(); col {
+		case "history_id":
+			cm.Uint64(&c.Revision)
+		case "scope":
+			var s string
+			cm.String(&s)
+			c.Scope = scope.MakeTypeID(scope.FromString(s), c.Scope.ID())
+		case "scope_id":
+			var id int64
+			cm.Int64(&id)
+			c.Scope = scope.MakeTypeID(c.Scope.Type(), id)
+		case "path":
+			cm.String(&c.Route)
+		case "old_value":
+			cm.NullString(&c.OldValue)
+		case "new_value":
+			cm.NullString(&c.NewValue)
+		case "actor":
+			cm.String(&c.Actor)
+		case "created_at":
+			cm.Time(&c.Created)
+		default:
+			return errors.NotFound.Newf("[config/storage] Change Column %q not found", col)
+		}
+	}
+	return cm.Err()
+}
+
+// ValueDiff describes how the value of a path differs between two points in
+// time.
+type ValueDiff struct {
+	Scope scope.TypeID
+	Route string
+	From  null.String
+	To    null.String
+}
+
+// HistoryOptions applies options to the History type.
+type HistoryOptions struct {
+	// TableName if set, specifies the alternate table name, default:
+	// `core_config_data_history` aka constant TableNameCoreConfigDataHistory.
+	TableName string
+	// Actor gets recorded by function Set, defaults to "system". Use function
+	// SetAs to record a different actor.
+	Actor string
+	// ContextTimeout applies to the queries of function Set, default 10s.
+	ContextTimeout time.Duration
+	// Now returns the time of a change, defaults to time.Now.
+	Now func() time.Time
+	Log log.Logger
+}
+
+// History wraps a config.Storager and records each Set operation with the
+// path, scope, old and new value, actor and timestamp in an audit table. It
+// provides functions to list the changes of a path, to diff two points in time
+// and to roll back a path or a whole scope to a previous revision. Writing the
+// value and writing the audit row are not atomic. History implements interface
+// config.Storager.
+//		dbs, err := storage.NewDB(storage.NewTableCollection(db), storage.DBOptions{})
+//		h, err := storage.NewHistory(dbs, storage.NewHistoryTableCollection(db), storage.HistoryOptions{})
+//		cfgSrv, err := config.NewService(h, config.Options{})
+// History records the values as it receives them. A History which wraps a
+// Secrets storage writes the plain text secrets into the audit table. Wrap the
+// History with the Secrets storage instead, so it records and rolls back only
+// encrypted values:
+//		h, err := storage.NewHistory(dbs, storage.NewHistoryTableCollection(db), storage.HistoryOptions{})
+//		s, err := storage.NewSecrets(h, kr, storage.SecretsOptions{Sections: sections})
+//		cfgSrv, err := config.NewService(s, config.Options{})
+// In that case function SetAs bypasses the encryption and must not be used
+// for secret routes.
+type History struct {
+	parent config.Storager
+	tbl    *ddl.Table
+	cfg    HistoryOptions
+	// mu serializes the writes to record the correct old value.
+	mu sync.Mutex
+}
+
+// NewHistory creates a new audit trail for `parent`. The table
+// TableNameCoreConfigDataHistory must be part of `tbls`, see
+// NewHistoryTableCollection.
+func NewHistory(parent config.Storager, tbls *ddl.Tables, o HistoryOptions) (*History, error) {
+	if parent == nil {
+		return nil, errors.Empty.Newf("[config/storage] NewHistory argument parent cannot be nil")
+	}
+	if o.TableName == "" {
+		o.TableName = TableNameCoreConfigDataHistory
+	}
+	tbl, err := tbls.Table(o.TableName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if o.Actor == "" {
+		o.Actor = "system"
+	}
+	if o.ContextTimeout == 0 {
+		o.ContextTimeout = time.Second * 10 // just a guess
+	}
+	if o.Now == nil {
+		o.Now = time.Now
+	}
+	return &History{
+		parent: parent,
+		tbl:    tbl,
+		cfg:    o,
+	}, nil
+}
+
+// Set writes the value to the parent Storager and records the change with the
+// default actor.
+func (h *History) Set(p *config.Path, value []byte) error {
+	return h.SetAs(h.cfg.Actor, p, value)
+}
+
+// Get returns the value of the parent Storager.
+func (h *History) Get(p *config.Path) (v []byte, found bool, err error) {
+	return h.parent.Get(p)
+}
+
+// SetAs writes the value to the parent Storager and records the change with
+// the actor, e.g. a user name.
+func (h *History) SetAs(actor string, p *config.Path, value []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), h.cfg.ContextTimeout)
+	defer cancel()
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.set(ctx, actor, p, value)
+}
+
+func (h *History) set(ctx context.Context, actor string, p *config.Path, value []byte) error {
+	old, found, err := h.parent.Get(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := h.parent.Set(p, value); err != nil {
+		return errors.WithStack(err)
+	}
+
+	var oldVal, newVal null.String
+	if found && old != nil {
+		oldVal = null.MakeString(string(old))
+	}
+	if value != nil {
+		newVal = null.MakeString(string(value))
+	}
+	scp, route := p.ScopeRoute()
+	s, id := scp.Unpack()
+	res, err := h.tbl.Insert().BuildValues().WithArgs().
+		String(s.StrType()).Int64(id).String(route).NullString(oldVal).NullString(newVal).
+		String(actor).Time(h.cfg.Now()).ExecContext(ctx)
+	if err != nil {
+		return errors.Wrapf(err, "[config/storage] History.Set Path %q", p.String())
+	}
+	if h.cfg.Log != nil && h.cfg.Log.IsDebug() {
+		rev, err := res.LastInsertId()
+		h.cfg.Log.Debug("config.storage.History.Set",
+			log.String("path", p.String()), log.String("actor", actor),
+			log.Int64("revision", rev), log.Err(err))
+	}
+	return nil
+}
+
+// load returns the changes matching the conditions ordered by revision.
+func (h *History) load(ctx context.Context, wheres ...*dml.Condition) ([]Change, error) {
+	var ret []Change
+	err := h.tbl.SelectAll().Where(wheres...).OrderBy("history_id").WithArgs().IterateSerial(ctx, func(cm *dml.ColumnMap) error {
+		var c Change
+		if err := c.MapColumns(cm); err != nil {
+			return errors.Wrapf(err, "[config/storage] History at row %d", cm.Count)
+		}
+		ret = append(ret, c)
+		return nil
+	})
+	return ret, errors.WithStack(err)
+}
+
+func scopeConditions(scp scope.TypeID) []*dml.Condition {
+	s, id := scp.Unpack()
+	return []*dml.Condition{
+		dml.Column("scope").Str(s.StrType()),
+		dml.Column("scope_id").Int64(id),
+	}
+}
+
+// Changes returns all changes of a path in the bound scope, ordered by
+// revision.
+func (h *History) Changes(ctx context.Context, p *config.Path) ([]Change, error) {
+	scp, route := p.ScopeRoute()
+	return h.load(ctx, append(scopeConditions(scp), dml.Column("path").Str(route))...)
+}
+
+// LatestRevision returns the revision of the last change or zero if nothing
+// has been changed yet. Save it before a deployment to roll back to it later.
+func (h *History) LatestRevision(ctx context.Context) (uint64, error) {
+	rev, _, err := h.tbl.Select("history_id").OrderByDesc("history_id").Limit(0, 1).WithArgs().LoadNullUint64(ctx)
+	return rev.Uint64, errors.WithStack(err)
+}
+
+type historyKey struct {
+	scope scope.TypeID
+	route string
+}
+
+// valueAt returns the value of a path after all changes up to the revision,
+// including. The changes must belong to the same path, ordered by revision. If
+// no change happened until the revision, the old value of the first change
+// gets returned. `changed` reports whether a change happened after the
+// revision.
+func valueAt(changes []Change, revision uint64) (v null.String, changed bool) {
+	for i, c := range changes {
+		if c.Revision > revision {
+			if i == 0 {
+				return c.OldValue, true
+			}
+			return changes[i-1].NewValue, true
+		}
+	}
+	return changes[len(changes)-1].NewValue, false
+}
+
+func groupChanges(changes []Change) ([]historyKey, map[historyKey][]Change) {
+	var keys []historyKey
+	m := make(map[historyKey][]Change)
+	for _, c := range changes {
+		k := historyKey{scope: c.Scope, route: c.Route}
+		if _, ok := m[k]; !ok {
+			keys = append(keys, k)
+		}
+		m[k] = append(m[k], c)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].scope != keys[j].scope {
+			return keys[i].scope < keys[j].scope
+		}
+		return keys[i].route < keys[j].route
+	})
+	return keys, m
+}
+
+// Diff returns all paths whose values differ between the points in time
+// `from` and `to`, ordered by scope and route.
+func (h *History) Diff(ctx context.Context, from, to time.Time) ([]ValueDiff, error) {
+	if to.Before(from) {
+		from, to = to, from
+	}
+	changes, err := h.load(ctx, dml.Column("created_at").LessOrEqual().Time(to))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// convert the point in time `from` into a revision
+	var fromRev uint64
+	for _, c := range changes {
+		if !c.Created.After(from) {
+			fromRev = c.Revision
+		}
+	}
+
+	keys, m := groupChanges(changes)
+	var ret []ValueDiff
+	for _, k := range keys {
+		cs := m[k]
+		fromVal, changed := valueAt(cs, fromRev)
+		toVal := cs[len(cs)-1].NewValue
+		if !changed || nullStringEqual(fromVal, toVal) {
+			continue
+		}
+		ret = append(ret, ValueDiff{Scope: k.scope, Route: k.route, From: fromVal, To: toVal})
+	}
+	return ret, nil
+}
+
+// RollbackPath restores the value which the path had at the revision. The
+// rollback gets recorded as a new change of the actor. A NULL value gets
+// written as nil because config.Storager cannot delete a path.
+func (h *History) RollbackPath(ctx context.Context, actor string, p *config.Path, revision uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes, err := h.Changes(ctx, p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return h.rollback(ctx, actor, changes, revision)
+}
+
+// RollbackScope restores the values of all paths within a scope, which have
+// been changed after the revision.
+func (h *History) RollbackScope(ctx context.Context, actor string, scp scope.TypeID, revision uint64) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	changes, err := h.load(ctx, scopeConditions(scp)...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return h.rollback(ctx, actor, changes, revision)
+}
+
+func (h *History) rollback(ctx context.Context, actor string, changes []Change, revision uint64) error {
+	keys, m := groupChanges(changes)
+	for _, k := range keys {
+		v, changed := valueAt(m[k], revision)
+		if !changed {
+			continue
+		}
+		p, err := config.NewPathWithScope(k.scope, k.route)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		current, found, err := h.parent.Get(p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if found && current != nil && v.Valid && bytes.Equal(current, []byte(v.String)) {
+			continue
+		}
+		var value []byte
+		if v.Valid {
+			value = []byte(v.String)
+		}
+		if err := h.set(ctx, actor, p, value); err != nil {
+			return errors.Wrapf(err, "[config/storage] History.Rollback to revision %d", revision)
+		}
+	}
+	return nil
+}
+
+func nullStringEqual(a, b null.String) bool {
+	return a.Valid == b.Valid && a.String == b.String
+}
@@ -0,0 +1,224 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall db
+
+package storage_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/storage"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/dmltest/memdb"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ config.Storager = (*storage.History)(nil)
+
+func newTestHistory(t *testing.T) (*storage.History, config.Storager, func()) {
+	tbls := storage.NewHistoryTableCollection(nil)
+	dbc, _ := memdb.MockDB(t, tbls)
+
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls int
+	parent := storage.NewMap()
+	h, err := storage.NewHistory(parent, tbls, storage.HistoryOptions{
+		Now: func() time.Time {
+			calls++
+			return start.Add(time.Duration(calls) * time.Hour)
+		},
+	})
+	dmltest.FatalIfError(t, err)
+	return h, parent, func() { dmltest.Close(t, dbc) }
+}
+
+func hourOf(h int) time.Time {
+	return time.Date(2019, 1, 1, h, 0, 0, 0, time.UTC)
+}
+
+func TestNewHistory(t *testing.T) {
+	t.Parallel()
+	_, err := storage.NewHistory(nil, nil, storage.HistoryOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	_, err = storage.NewHistory(storage.NewMap(), storage.NewHistoryTableCollection(nil), storage.HistoryOptions{
+		TableName: "non-existent",
+	})
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	pDefault := config.MustNewPath("web/cors/allow_credentials")
+	pStore := config.MustNewPath("web/cors/allow_credentials").BindStore(2)
+	pStoreName := config.MustNewPath("general/store_information/name").BindStore(2)
+
+	h, parent, closeFn := newTestHistory(t)
+	defer closeFn()
+
+	assert.NoError(t, h.Set(pDefault, []byte("0")))                      // rev 1, 01:00
+	assert.NoError(t, h.SetAs("alice", pStore, []byte("1")))             // rev 2, 02:00
+	assert.NoError(t, h.SetAs("bob", pStoreName, []byte("Shop")))        // rev 3, 03:00
+	assert.NoError(t, h.SetAs("alice", pStore, []byte("0")))             // rev 4, 04:00
+	assert.NoError(t, h.SetAs("bob", pStoreName, []byte("Better Shop"))) // rev 5, 05:00
+
+	v, found, err := h.Get(pStoreName)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Exactly(t, "Better Shop", string(v))
+
+	t.Run("Changes", func(t *testing.T) {
+		changes, err := h.Changes(ctx, pStore)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 2)
+
+		assert.Exactly(t, uint64(2), changes[0].Revision)
+		assert.Exactly(t, scope.Store.WithID(2), changes[0].Scope)
+		assert.Exactly(t, "web/cors/allow_credentials", changes[0].Route)
+		assert.Exactly(t, null.String{}, changes[0].OldValue)
+		assert.Exactly(t, null.MakeString("1"), changes[0].NewValue)
+		assert.Exactly(t, "alice", changes[0].Actor)
+		assert.Exactly(t, hourOf(2), changes[0].Created.UTC())
+
+		assert.Exactly(t, uint64(4), changes[1].Revision)
+		assert.Exactly(t, null.MakeString("1"), changes[1].OldValue)
+		assert.Exactly(t, null.MakeString("0"), changes[1].NewValue)
+
+		p, err := changes[1].Path()
+		assert.NoError(t, err)
+		assert.Exactly(t, pStore.String(), p.String())
+
+		changes, err = h.Changes(ctx, pDefault)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 1)
+		assert.Exactly(t, "system", changes[0].Actor)
+
+		rev, err := h.LatestRevision(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(5), rev)
+	})
+
+	t.Run("Diff", func(t *testing.T) {
+		diffs, err := h.Diff(ctx, hourOf(2), hourOf(5))
+		assert.NoError(t, err)
+		// pStore changed from 1 to 0 but the default scope did not change.
+		assert.Exactly(t, []storage.ValueDiff{
+			{Scope: scope.Store.WithID(2), Route: "general/store_information/name", From: null.String{}, To: null.MakeString("Better Shop")},
+			{Scope: scope.Store.WithID(2), Route: "web/cors/allow_credentials", From: null.MakeString("1"), To: null.MakeString("0")},
+		}, diffs)
+
+		// arguments get swapped
+		diffs, err = h.Diff(ctx, hourOf(4), hourOf(1))
+		assert.NoError(t, err)
+		assert.Exactly(t, []storage.ValueDiff{
+			{Scope: scope.Store.WithID(2), Route: "general/store_information/name", From: null.String{}, To: null.MakeString("Shop")},
+			{Scope: scope.Store.WithID(2), Route: "web/cors/allow_credentials", From: null.String{}, To: null.MakeString("0")},
+		}, diffs)
+
+		diffs, err = h.Diff(ctx, hourOf(5), hourOf(6))
+		assert.NoError(t, err)
+		assert.Len(t, diffs, 0)
+	})
+
+	t.Run("RollbackPath", func(t *testing.T) {
+		assert.NoError(t, h.RollbackPath(ctx, "carol", pStoreName, 3))
+		v, _, err := parent.Get(pStoreName)
+		assert.NoError(t, err)
+		assert.Exactly(t, "Shop", string(v))
+
+		changes, err := h.Changes(ctx, pStoreName)
+		assert.NoError(t, err)
+		assert.Len(t, changes, 3)
+		assert.Exactly(t, uint64(6), changes[2].Revision)
+		assert.Exactly(t, "carol", changes[2].Actor)
+		assert.Exactly(t, null.MakeString("Better Shop"), changes[2].OldValue)
+		assert.Exactly(t, null.MakeString("Shop"), changes[2].NewValue)
+
+		// nothing to do, already at that value
+		assert.NoError(t, h.RollbackPath(ctx, "carol", pStoreName, 3))
+		rev, err := h.LatestRevision(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(6), rev)
+	})
+
+	t.Run("RollbackScope", func(t *testing.T) {
+		assert.NoError(t, h.SetAs("alice", pDefault, []byte("1"))) // rev 7
+
+		// before revision 1 the store scope had no values
+		assert.NoError(t, h.RollbackScope(ctx, "dave", scope.Store.WithID(2), 1))
+
+		v, found, err := parent.Get(pStore)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Len(t, v, 0)
+		v, _, err = parent.Get(pStoreName)
+		assert.NoError(t, err)
+		assert.Len(t, v, 0)
+
+		v, _, err = parent.Get(pDefault)
+		assert.NoError(t, err)
+		assert.Exactly(t, "1", string(v), "default scope must not be touched")
+
+		rev, err := h.LatestRevision(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(9), rev)
+
+		changes, err := h.Changes(ctx, pStore)
+		assert.NoError(t, err)
+		last := changes[len(changes)-1]
+		assert.Exactly(t, "dave", last.Actor)
+		assert.Exactly(t, null.String{}, last.NewValue)
+	})
+}
+
+func TestHistory_WrappedBySecrets(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	h, parent, closeFn := newTestHistory(t)
+	defer closeFn()
+	s, err := storage.NewSecrets(h, mustParseKeyring(t, keyringEntry("k1", 1)), storage.SecretsOptions{Sections: secretSections})
+	assert.NoError(t, err)
+
+	p := config.MustNewPath("payment/stripe/api_key").BindWebsite(1)
+	assert.NoError(t, s.Set(p, []byte("sk_live_1")))
+	assert.NoError(t, s.Set(p, []byte("sk_live_2")))
+
+	changes, err := h.Changes(ctx, p)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	for _, c := range changes {
+		assert.True(t, strings.HasPrefix(c.NewValue.String, storage.SecretPrefix), "the audit table must not contain plain text: %q", c.NewValue.String)
+		assert.False(t, strings.Contains(c.OldValue.String, "sk_live"), "the audit table must not contain plain text: %q", c.OldValue.String)
+	}
+
+	assert.NoError(t, h.RollbackPath(ctx, "alice", p, changes[0].Revision))
+	v, _, err := parent.Get(p)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(v), storage.SecretPrefix), "stored encrypted: %q", v)
+	v, found, err := s.Get(p)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Exactly(t, "sk_live_1", string(v))
+}
@@ -38,6 +38,19 @@ func WithLoadJSON(opts ...option) config.LoadDataOption {
 	}).WithUseStorageLevel(1)
 }
 
+// ReadJSON reads the configuration values from JSON files without applying
+// them to the config.Service, for example to validate them with a
+// config.SchemaValidator.
+func ReadJSON(s *config.Service, opts ...option) ([]config.PathValue, error) {
+	return readPathValues(s, loadJSON, opts)
+}
+
+// WatchJSON loads the JSON files and watches them for changes. The changed
+// values get applied to the config.Service. See FileWatcher.
+func WatchJSON(s *config.Service, o WatchOptions, opts ...option) (*FileWatcher, error) {
+	return newFileWatcher(s, o, loadJSON, opts)
+}
+
 func loadJSON(s config.Setter, r io.Reader) error {
 	jd := make(map[string]interface{})
 
@@ -79,6 +79,28 @@ func (sp *kvmap) Flush() error {
 	return nil
 }
 
+// IteratePaths implements PathIterator. The paths get collected before fn gets
+// called, hence fn can write into the map.
+func (sp *kvmap) IteratePaths(fn func(p config.Path) error) error {
+	sp.RLock()
+	keys := make([]cacheKey, 0, len(sp.kv))
+	for k := range sp.kv {
+		keys = append(keys, k)
+	}
+	sp.RUnlock()
+
+	for _, k := range keys {
+		p, err := config.NewPathWithScope(k.scp, k.route)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := fn(*p); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
 // Keys returns a randomized slice of all keys. Useful while testing.
 func (sp *kvmap) Keys(ret ...string) []string {
 	sp.RLock()
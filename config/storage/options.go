@@ -46,6 +46,35 @@ func processFile(file string, s *config.Service, cb func(config.Setter, io.Reade
 	return
 }
 
+type pathValueCollector struct {
+	pvs []config.PathValue
+}
+
+// Set implements config.Setter and copies the path and the value.
+func (c *pathValueCollector) Set(p *config.Path, value []byte) error {
+	p2, err := config.NewPathWithScope(p.ScopeRoute())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	c.pvs = append(c.pvs, config.PathValue{Path: *p2, Value: append([]byte(nil), value...)})
+	return nil
+}
+
+// readPathValues decodes the files of the options without writing the values
+// into the config.Service.
+func readPathValues(s *config.Service, decode func(config.Setter, io.Reader) error, opts []option) ([]config.PathValue, error) {
+	var c pathValueCollector
+	cb := func(_ config.Setter, r io.Reader) error {
+		return decode(&c, r)
+	}
+	for _, opt := range opts {
+		if err := opt(s, cb); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	return c.pvs, nil
+}
+
 // If someone needs it, uncomment and add a test
 //func WithIOReader(r io.Reader) option {
 //	return func(s *config.Service, cb func(config.Setter, io.Reader) error) error {
@@ -0,0 +1,533 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/config"
+)
+
+// SecretPrefix gets prepended to each encrypted value, followed by the key ID
+// of the master key and a colon. The format of an encrypted value is:
+//		csenc:v1:<key ID>:<base64 URL encoded envelope>
+// The envelope contains the nonce and the data key encrypted with the master
+// key followed by the nonce and the value encrypted with the data key.
+const SecretPrefix = "csenc:v1:"
+
+const (
+	secretKeyLength   = 32 // AES-256
+	secretNonceLength = 12
+	secretTagLength   = 16
+	// secretEnvelopeMin nonce + encrypted data key + nonce + empty value
+	secretEnvelopeMin = secretNonceLength + secretKeyLength + secretTagLength + secretNonceLength + secretTagLength
+)
+
+// Keyring contains the master keys for the envelope encryption. The primary
+// key encrypts all new values, all other keys only decrypt older values until
+// they got re-encrypted, see Secrets.Reencrypt. A Keyring is immutable and
+// safe for concurrent use.
+type Keyring struct {
+	primary string
+	keys    map[string]cipher.AEAD
+}
+
+// NewKeyring creates a new Keyring. The key IDs can contain the characters
+// [a-zA-Z0-9._-] and each key must be 32 bytes long. The primaryID must be
+// one of the keys.
+func NewKeyring(primaryID string, keys map[string][]byte) (*Keyring, error) {
+	kr := &Keyring{
+		primary: primaryID,
+		keys:    make(map[string]cipher.AEAD, len(keys)),
+	}
+	for id, key := range keys {
+		if !isValidKeyID(id) {
+			return nil, errors.NotValid.Newf("[config/storage] Keyring key ID %q contains invalid characters", id)
+		}
+		if len(key) != secretKeyLength {
+			return nil, errors.NotValid.Newf("[config/storage] Keyring key %q must be %d bytes long, has %d bytes", id, secretKeyLength, len(key))
+		}
+		aead, err := newAEAD(key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		kr.keys[id] = aead
+	}
+	if _, ok := kr.keys[primaryID]; !ok {
+		return nil, errors.NotFound.Newf("[config/storage] Keyring primary key %q not found", primaryID)
+	}
+	return kr, nil
+}
+
+// ParseKeyring parses the keys from the format `<key ID>:<base64 key>`. The
+// entries are separated by new lines or commas. The first entry defines the
+// primary key. Empty lines and lines starting with # get ignored. Create a new
+// key with:
+//		$ echo "$(date +%Y%m%d):$(head -c 32 /dev/urandom | base64)"
+func ParseKeyring(data []byte) (*Keyring, error) {
+	var primaryID string
+	keys := make(map[string][]byte)
+	for _, entry := range strings.FieldsFunc(string(data), func(r rune) bool { return r == '\n' || r == ',' }) {
+		entry = strings.TrimSpace(entry)
+		if entry == "" || entry[0] == '#' {
+			continue
+		}
+		colon := strings.IndexByte(entry, ':')
+		if colon < 1 {
+			return nil, errors.NotValid.Newf("[config/storage] ParseKeyring entry must have the format <key ID>:<base64 key>")
+		}
+		id := entry[:colon]
+		if _, ok := keys[id]; ok {
+			return nil, errors.Duplicated.Newf("[config/storage] ParseKeyring key ID %q appears twice", id)
+		}
+		key, err := base64.StdEncoding.DecodeString(entry[colon+1:])
+		if err != nil {
+			// never add the key to the error message
+			return nil, errors.NotValid.Newf("[config/storage] ParseKeyring key %q is not valid base64", id)
+		}
+		if primaryID == "" {
+			primaryID = id
+		}
+		keys[id] = key
+	}
+	if primaryID == "" {
+		return nil, errors.Empty.Newf("[config/storage] ParseKeyring requires at least one key")
+	}
+	return NewKeyring(primaryID, keys)
+}
+
+// LoadKeyringFile reads the keys from a local file, for example a mounted
+// Kubernetes secret. See ParseKeyring for the format.
+func LoadKeyringFile(filename string) (*Keyring, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.NotFound.New(err, "[config/storage] LoadKeyringFile %q", filename)
+		}
+		return nil, errors.ReadFailed.New(err, "[config/storage] LoadKeyringFile %q", filename)
+	}
+	kr, err := ParseKeyring(data)
+	return kr, errors.Wrapf(err, "[config/storage] LoadKeyringFile %q", filename)
+}
+
+// LoadKeyringEnv reads the keys from an environment variable. See
+// ParseKeyring for the format. If unset is true, the variable gets removed
+// from the environment after reading to not leak it into child processes.
+func LoadKeyringEnv(name string, unset bool) (*Keyring, error) {
+	data, ok := os.LookupEnv(name)
+	if !ok || data == "" {
+		return nil, errors.NotFound.Newf("[config/storage] LoadKeyringEnv variable %q not found", name)
+	}
+	if unset {
+		if err := os.Unsetenv(name); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	kr, err := ParseKeyring([]byte(data))
+	return kr, errors.Wrapf(err, "[config/storage] LoadKeyringEnv %q", name)
+}
+
+// PrimaryKeyID returns the ID of the key which encrypts new values.
+func (kr *Keyring) PrimaryKeyID() string { return kr.primary }
+
+// KeyIDs returns the sorted IDs of all keys.
+func (kr *Keyring) KeyIDs() []string {
+	ids := make([]string, 0, len(kr.keys))
+	for id := range kr.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func isValidKeyID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, r := range id {
+		if ok := r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '_' || r == '-'; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.NotValid.New(err, "[config/storage] The encryption key has a wrong format.")
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.Fatal.New(err, "[config/storage] cipher GCM failed")
+	}
+	return aead, nil
+}
+
+// PathIterator gets implemented by Storager which can list all their paths,
+// like NewMap. Secrets.Reencrypt without arguments requires the parent Storager
+// to implement it.
+type PathIterator interface {
+	IteratePaths(fn func(p config.Path) error) error
+}
+
+// SecretsOptions applies options to the Secrets storage.
+type SecretsOptions struct {
+	// Sections defines the secret routes via the Field.Secret flag.
+	Sections config.Sections
+	// Routes additional secret routes.
+	Routes []string
+	// Log logs never a value, only paths and key IDs.
+	Log log.Logger
+}
+
+// Secrets wraps a Storager and encrypts the values of secret routes at rest
+// with an envelope encryption: Each value gets encrypted with AES-256-GCM and
+// its own random data key. The data key gets encrypted with the primary master
+// key of the Keyring and stored together with the ID of the master key in the
+// value, see SecretPrefix. The full path gets used as additional data, hence
+// an encrypted value cannot be copied to another route or scope. Values of
+// other routes get passed through unchanged.
+//
+// A master key rotation adds a new primary key to the Keyring while the old
+// key stays for decryption:
+//		kr, err := storage.LoadKeyringFile("/etc/shop/config.keys")
+//		s.SetKeyring(kr)
+//		n, err := s.Reencrypt() // re-encrypts the data keys of all values
+// Afterwards the old key can be removed from the Keyring.
+//
+// Unencrypted values of secret routes, e.g. written before the route has been
+// marked as secret, get returned unchanged and encrypted by Reencrypt. A Level1
+// storage of the config.Service caches the decrypted values in memory. Use
+// config.WithApplySections to redact the secret values in Value.String and
+// Value.MarshalJSON. Storages which record the values, like History, must be
+// the parent of Secrets, otherwise they store the plain text. Safe for
+// concurrent use.
+type Secrets struct {
+	parent config.Storager
+	routes map[string]struct{}
+	log    log.Logger
+
+	mu sync.RWMutex
+	kr *Keyring
+}
+
+// NewSecrets creates a new encrypting storage for the secret routes defined in
+// the options.
+func NewSecrets(parent config.Storager, kr *Keyring, o SecretsOptions) (*Secrets, error) {
+	if parent == nil || kr == nil {
+		return nil, errors.Empty.Newf("[config/storage] NewSecrets arguments parent and Keyring cannot be nil")
+	}
+	s := &Secrets{
+		parent: parent,
+		routes: make(map[string]struct{}, len(o.Routes)),
+		log:    o.Log,
+		kr:     kr,
+	}
+	for _, r := range append(o.Sections.SecretRoutes(), o.Routes...) {
+		s.routes[r] = struct{}{}
+	}
+	if len(s.routes) == 0 {
+		return nil, errors.Empty.Newf("[config/storage] NewSecrets requires at least one secret route")
+	}
+	return s, nil
+}
+
+// IsSecret returns true if the values of the route get encrypted.
+func (s *Secrets) IsSecret(route string) bool {
+	_, ok := s.routes[route]
+	return ok
+}
+
+// SetKeyring replaces the Keyring, for example after a master key rotation.
+// The new Keyring must contain all keys which are still in use.
+func (s *Secrets) SetKeyring(kr *Keyring) error {
+	if kr == nil {
+		return errors.Empty.Newf("[config/storage] Secrets.SetKeyring argument cannot be nil")
+	}
+	s.mu.Lock()
+	s.kr = kr
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *Secrets) keyring() *Keyring {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.kr
+}
+
+func secretAdditionalData(p *config.Path) []byte {
+	scp, route := p.ScopeRoute()
+	return []byte(scp.String() + "/" + route)
+}
+
+// Set encrypts the value of a secret route and writes it to the parent. A nil
+// value stays nil.
+func (s *Secrets) Set(p *config.Path, value []byte) error {
+	_, route := p.ScopeRoute()
+	if !s.IsSecret(route) || value == nil {
+		return s.parent.Set(p, value)
+	}
+	kr := s.keyring()
+	enc, err := encryptSecret(kr, kr.primary, secretAdditionalData(p), value)
+	if err != nil {
+		return errors.Wrapf(err, "[config/storage] Secrets.Set Path %q", p.String())
+	}
+	return errors.WithStack(s.parent.Set(p, enc))
+}
+
+// Get reads the value from the parent and decrypts it if the route is secret.
+func (s *Secrets) Get(p *config.Path) (v []byte, found bool, err error) {
+	v, found, err = s.parent.Get(p)
+	if err != nil || !found {
+		return v, found, errors.WithStack(err)
+	}
+	_, route := p.ScopeRoute()
+	if !s.IsSecret(route) || !IsEncrypted(v) {
+		return v, found, nil
+	}
+	v, _, err = decryptSecret(s.keyring(), secretAdditionalData(p), v)
+	if err != nil {
+		return nil, false, errors.Wrapf(err, "[config/storage] Secrets.Get Path %q", p.String())
+	}
+	return v, true, nil
+}
+
+// Reencrypt encrypts the data keys of the values of all secret routes with the
+// primary master key and encrypts unencrypted values. Values already using the
+// primary key get skipped. Without arguments all paths of the parent Storager
+// get checked, which requires the parent to implement PathIterator. Returns the
+// number of written values. A database table can be processed with the paths
+// of ReadDB.
+func (s *Secrets) Reencrypt(paths ...config.Path) (n int, err error) {
+	if len(paths) == 0 {
+		pi, ok := s.parent.(PathIterator)
+		if !ok {
+			return 0, errors.NotSupported.Newf("[config/storage] Secrets.Reencrypt parent %T cannot iterate paths, please provide the paths", s.parent)
+		}
+		if err := pi.IteratePaths(func(p config.Path) error {
+			paths = append(paths, p)
+			return nil
+		}); err != nil {
+			return 0, errors.WithStack(err)
+		}
+	}
+
+	kr := s.keyring()
+	for i := range paths {
+		p := &paths[i]
+		if _, route := p.ScopeRoute(); !s.IsSecret(route) {
+			continue
+		}
+		v, found, err := s.parent.Get(p)
+		if err != nil {
+			return n, errors.WithStack(err)
+		}
+		if !found || v == nil {
+			continue
+		}
+
+		aad := secretAdditionalData(p)
+		var newValue []byte
+		if IsEncrypted(v) {
+			newValue, err = reencryptSecret(kr, aad, v)
+		} else {
+			newValue, err = encryptSecret(kr, kr.primary, aad, v)
+		}
+		if err != nil {
+			return n, errors.Wrapf(err, "[config/storage] Secrets.Reencrypt Path %q", p.String())
+		}
+		if newValue == nil {
+			continue // already uses the primary key
+		}
+		if err := s.parent.Set(p, newValue); err != nil {
+			return n, errors.WithStack(err)
+		}
+		n++
+		if s.log != nil && s.log.IsDebug() {
+			s.log.Debug("config.storage.Secrets.Reencrypt", log.Stringer("path", p), log.String("key_id", kr.primary))
+		}
+	}
+	if s.log != nil && s.log.IsInfo() {
+		s.log.Info("config.storage.Secrets.Reencrypt.Done", log.Int("reencrypted", n), log.Int("paths", len(paths)), log.String("key_id", kr.primary))
+	}
+	return n, nil
+}
+
+// IsEncrypted reports whether the value has been encrypted by Secrets.
+func IsEncrypted(v []byte) bool {
+	return bytes.HasPrefix(v, []byte(SecretPrefix))
+}
+
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, errors.ReadFailed.New(err, "[config/storage] ReadFull failed")
+	}
+	return b, nil
+}
+
+func encodeSecret(keyID string, envelope []byte) []byte {
+	buf := make([]byte, 0, len(SecretPrefix)+len(keyID)+1+base64.RawURLEncoding.EncodedLen(len(envelope)))
+	buf = append(buf, SecretPrefix...)
+	buf = append(buf, keyID...)
+	buf = append(buf, ':')
+	dst := buf[len(buf):cap(buf)]
+	base64.RawURLEncoding.Encode(dst, envelope)
+	return buf[:cap(buf)]
+}
+
+func decodeSecret(v []byte) (keyID string, envelope []byte, err error) {
+	v = v[len(SecretPrefix):]
+	colon := bytes.IndexByte(v, ':')
+	if colon < 1 {
+		return "", nil, errors.NotValid.Newf("[config/storage] Encrypted value has no key ID")
+	}
+	keyID = string(v[:colon])
+	envelope = make([]byte, base64.RawURLEncoding.DecodedLen(len(v)-colon-1))
+	n, err := base64.RawURLEncoding.Decode(envelope, v[colon+1:])
+	if err != nil {
+		return "", nil, errors.NotValid.New(err, "[config/storage] Encrypted value has an invalid encoding")
+	}
+	if n < secretEnvelopeMin {
+		return "", nil, errors.NotValid.Newf("[config/storage] Encrypted value is too short")
+	}
+	return keyID, envelope[:n], nil
+}
+
+func (kr *Keyring) aead(keyID string) (cipher.AEAD, error) {
+	aead, ok := kr.keys[keyID]
+	if !ok {
+		return nil, errors.NotFound.Newf("[config/storage] Keyring key %q not found", keyID)
+	}
+	return aead, nil
+}
+
+// wrapKey encrypts the data key with the master key.
+func wrapKey(kr *Keyring, keyID string, dataKey []byte) ([]byte, error) {
+	master, err := kr.aead(keyID)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nonce, err := randomBytes(secretNonceLength)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return master.Seal(nonce, nonce, dataKey, []byte(keyID)), nil
+}
+
+func encryptSecret(kr *Keyring, keyID string, aad, value []byte) ([]byte, error) {
+	dataKey, err := randomBytes(secretKeyLength)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	envelope, err := wrapKey(kr, keyID, dataKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	nonce, err := randomBytes(secretNonceLength)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	envelope = append(envelope, nonce...)
+	envelope = dataAEAD.Seal(envelope, nonce, value, aad)
+	return encodeSecret(keyID, envelope), nil
+}
+
+// openEnvelope decrypts the data key and returns the AEAD for the value and
+// the remaining encrypted value including its nonce.
+func openEnvelope(kr *Keyring, keyID string, envelope []byte) (dataKey []byte, rest []byte, err error) {
+	master, err := kr.aead(keyID)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	const wrappedLen = secretNonceLength + secretKeyLength + secretTagLength
+	wrapped := envelope[:wrappedLen]
+	dataKey, err = master.Open(nil, wrapped[:secretNonceLength], wrapped[secretNonceLength:], []byte(keyID))
+	if err != nil {
+		return nil, nil, errors.NotValid.New(err, "[config/storage] Failed to decrypt the data key with key %q", keyID)
+	}
+	return dataKey, envelope[wrappedLen:], nil
+}
+
+func decryptSecret(kr *Keyring, aad, v []byte) (_ []byte, keyID string, err error) {
+	keyID, envelope, err := decodeSecret(v)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	dataKey, rest, err := openEnvelope(kr, keyID, envelope)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	value, err := dataAEAD.Open(nil, rest[:secretNonceLength], rest[secretNonceLength:], aad)
+	if err != nil {
+		return nil, "", errors.NotValid.New(err, "[config/storage] Failed to decrypt the value")
+	}
+	if value == nil {
+		value = []byte{} // an empty value is not NULL
+	}
+	return value, keyID, nil
+}
+
+// reencryptSecret encrypts the data key with the primary key. The encrypted
+// value stays the same. Returns nil if the primary key is already in use.
+func reencryptSecret(kr *Keyring, aad, v []byte) ([]byte, error) {
+	keyID, envelope, err := decodeSecret(v)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if keyID == kr.primary {
+		return nil, nil
+	}
+	dataKey, rest, err := openEnvelope(kr, keyID, envelope)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// verify that the value belongs to the path before wrapping the data key
+	// with the new master key.
+	dataAEAD, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := dataAEAD.Open(nil, rest[:secretNonceLength], rest[secretNonceLength:], aad); err != nil {
+		return nil, errors.NotValid.New(err, "[config/storage] Failed to decrypt the value")
+	}
+	newEnvelope, err := wrapKey(kr, kr.primary, dataKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return encodeSecret(kr.primary, append(newEnvelope, rest...)), nil
+}
@@ -0,0 +1,297 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package storage_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/storage"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ config.Storager = (*storage.Secrets)(nil)
+
+func keyringEntry(id string, b byte) string {
+	return id + ":" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+func mustParseKeyring(t *testing.T, entries ...string) *storage.Keyring {
+	kr, err := storage.ParseKeyring([]byte(strings.Join(entries, "\n")))
+	assert.NoError(t, err)
+	return kr
+}
+
+var secretSections = config.MustMakeSectionsValidate(
+	&config.Section{
+		ID: "payment",
+		Groups: config.MakeGroups(
+			&config.Group{
+				ID: "stripe",
+				Fields: config.MakeFields(
+					&config.Field{ID: "api_key", Secret: true},
+					&config.Field{ID: "title"},
+				),
+			},
+		),
+	},
+)
+
+func TestParseKeyring(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		kr, err := storage.ParseKeyring([]byte("# rotated 2019-05-01\n" + keyringEntry("k2", 2) + "\n\n" + keyringEntry("k1", 1) + "\n"))
+		assert.NoError(t, err)
+		assert.Exactly(t, "k2", kr.PrimaryKeyID())
+		assert.Exactly(t, []string{"k1", "k2"}, kr.KeyIDs())
+
+		// comma separated for environment variables
+		kr, err = storage.ParseKeyring([]byte(keyringEntry("k1", 1) + "," + keyringEntry("k2", 2)))
+		assert.NoError(t, err)
+		assert.Exactly(t, "k1", kr.PrimaryKeyID())
+	})
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			data string
+			kind errors.Kind
+		}{
+			{"", errors.Empty},
+			{"# only a comment", errors.Empty},
+			{"missing_colon", errors.NotValid},
+			{"k1:not-base64!", errors.NotValid},
+			{"k1:" + base64.StdEncoding.EncodeToString([]byte("short")), errors.NotValid},
+			{"k/1:" + base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, 32)), errors.NotValid},
+			{keyringEntry("k1", 1) + "\n" + keyringEntry("k1", 2), errors.Duplicated},
+		}
+		for _, test := range tests {
+			_, err := storage.ParseKeyring([]byte(test.data))
+			assert.True(t, test.kind.Match(err), "%q: %+v", test.data, err)
+		}
+		_, err := storage.NewKeyring("k3", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+}
+
+func TestLoadKeyring(t *testing.T) {
+	t.Run("file", func(t *testing.T) {
+		dir, err := ioutil.TempDir("", "cs_keyring")
+		assert.NoError(t, err)
+		defer os.RemoveAll(dir)
+		file := filepath.Join(dir, "config.keys")
+		assert.NoError(t, ioutil.WriteFile(file, []byte(keyringEntry("k1", 1)), 0600))
+
+		kr, err := storage.LoadKeyringFile(file)
+		assert.NoError(t, err)
+		assert.Exactly(t, "k1", kr.PrimaryKeyID())
+
+		_, err = storage.LoadKeyringFile(filepath.Join(dir, "not_found.keys"))
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	t.Run("env", func(t *testing.T) {
+		const envName = "CS_TEST_CONFIG_KEYRING"
+		assert.NoError(t, os.Setenv(envName, keyringEntry("k2", 2)+","+keyringEntry("k1", 1)))
+		defer os.Unsetenv(envName)
+
+		kr, err := storage.LoadKeyringEnv(envName, true)
+		assert.NoError(t, err)
+		assert.Exactly(t, "k2", kr.PrimaryKeyID())
+		_, ok := os.LookupEnv(envName)
+		assert.False(t, ok, "env var must be unset")
+
+		_, err = storage.LoadKeyringEnv(envName, false)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+}
+
+func TestNewSecrets_Errors(t *testing.T) {
+	_, err := storage.NewSecrets(nil, nil, storage.SecretsOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	_, err = storage.NewSecrets(storage.NewMap(), mustParseKeyring(t, keyringEntry("k1", 1)), storage.SecretsOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+}
+
+func TestSecrets(t *testing.T) {
+	parent := storage.NewMap()
+	s, err := storage.NewSecrets(parent, mustParseKeyring(t, keyringEntry("k1", 1)), storage.SecretsOptions{
+		Sections: secretSections,
+		Routes:   []string{"carrier/dhl/password"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, s.IsSecret("payment/stripe/api_key"))
+	assert.True(t, s.IsSecret("carrier/dhl/password"))
+	assert.False(t, s.IsSecret("payment/stripe/title"))
+
+	pKey := config.MustNewPath("payment/stripe/api_key")
+	pKeyStore := config.MustNewPathWithScope(scope.Store.WithID(2), "payment/stripe/api_key")
+	pPassword := config.MustNewPath("carrier/dhl/password")
+	pTitle := config.MustNewPath("payment/stripe/title")
+
+	assert.NoError(t, s.Set(pKey, []byte("sk_live_123")))
+	assert.NoError(t, s.Set(pKeyStore, []byte("sk_live_456")))
+	assert.NoError(t, s.Set(pPassword, []byte{}))
+	assert.NoError(t, s.Set(pTitle, []byte("Stripe")))
+
+	t.Run("encrypted at rest", func(t *testing.T) {
+		raw, _, err := parent.Get(pKey)
+		assert.NoError(t, err)
+		assert.True(t, storage.IsEncrypted(raw), "%q", raw)
+		assert.True(t, bytes.HasPrefix(raw, []byte(storage.SecretPrefix+"k1:")), "%q", raw)
+		assert.False(t, bytes.Contains(raw, []byte("sk_live")))
+
+		raw2, _, err := parent.Get(pKeyStore)
+		assert.NoError(t, err)
+		assert.NotEqual(t, raw, raw2)
+
+		raw, _, err = parent.Get(pTitle)
+		assert.NoError(t, err)
+		assert.Exactly(t, "Stripe", string(raw))
+	})
+
+	t.Run("decrypt", func(t *testing.T) {
+		v, found, err := s.Get(pKey)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Exactly(t, "sk_live_123", string(v))
+
+		v, found, err = s.Get(pPassword)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Exactly(t, []byte{}, v)
+
+		v, found, err = s.Get(config.MustNewPath("payment/stripe/api_key").BindWebsite(3))
+		assert.NoError(t, err)
+		assert.False(t, found)
+		assert.Nil(t, v)
+	})
+
+	t.Run("value bound to its path", func(t *testing.T) {
+		raw, _, err := parent.Get(pKeyStore)
+		assert.NoError(t, err)
+		pOther := config.MustNewPathWithScope(scope.Store.WithID(3), "payment/stripe/api_key")
+		assert.NoError(t, parent.Set(pOther, raw))
+		_, _, err = s.Get(pOther)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+		assert.NotContains(t, err.Error(), "sk_live")
+	})
+
+	t.Run("tampered value", func(t *testing.T) {
+		pTampered := config.MustNewPath("carrier/dhl/password").BindWebsite(1)
+		assert.NoError(t, s.Set(pTampered, []byte("secret")))
+		raw, _, err := parent.Get(pTampered)
+		assert.NoError(t, err)
+		raw[len(raw)-2] ^= 'a'
+		assert.NoError(t, parent.Set(pTampered, raw))
+		_, _, err = s.Get(pTampered)
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		pUnknown := config.MustNewPath("carrier/dhl/password").BindWebsite(2)
+		assert.NoError(t, parent.Set(pUnknown, []byte(storage.SecretPrefix+"k9:"+strings.Repeat("A", 200))))
+		_, _, err := s.Get(pUnknown)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+}
+
+func TestSecrets_Reencrypt(t *testing.T) {
+	parent := storage.NewMap(
+		"default/0/payment/stripe/api_key", "plain_before_marked_secret",
+		"default/0/payment/stripe/title", "Stripe",
+	)
+	s, err := storage.NewSecrets(parent, mustParseKeyring(t, keyringEntry("k1", 1)), storage.SecretsOptions{Sections: secretSections})
+	assert.NoError(t, err)
+
+	pKey := config.MustNewPath("payment/stripe/api_key")
+	pKeyWebsite := config.MustNewPath("payment/stripe/api_key").BindWebsite(1)
+	pTitle := config.MustNewPath("payment/stripe/title")
+	assert.NoError(t, s.Set(pKeyWebsite, []byte("sk_live_website")))
+
+	// plaintext values get returned unchanged
+	v, _, err := s.Get(pKey)
+	assert.NoError(t, err)
+	assert.Exactly(t, "plain_before_marked_secret", string(v))
+
+	n, err := s.Reencrypt()
+	assert.NoError(t, err)
+	assert.Exactly(t, 1, n, "only the plaintext value")
+
+	rawWebsiteK1, _, err := parent.Get(pKeyWebsite)
+	assert.NoError(t, err)
+
+	// rotate the master key
+	assert.NoError(t, s.SetKeyring(mustParseKeyring(t, keyringEntry("k2", 2), keyringEntry("k1", 1))))
+	n, err = s.Reencrypt()
+	assert.NoError(t, err)
+	assert.Exactly(t, 2, n)
+
+	for _, p := range []*config.Path{pKey, pKeyWebsite} {
+		raw, _, err := parent.Get(p)
+		assert.NoError(t, err)
+		assert.True(t, bytes.HasPrefix(raw, []byte(storage.SecretPrefix+"k2:")), "%q", raw)
+	}
+	raw, _, err := parent.Get(pTitle)
+	assert.NoError(t, err)
+	assert.Exactly(t, "Stripe", string(raw))
+
+	n, err = s.Reencrypt(*pKey, *pKeyWebsite, *pTitle)
+	assert.NoError(t, err)
+	assert.Exactly(t, 0, n, "already encrypted with the primary key")
+
+	// remove the old key
+	assert.NoError(t, s.SetKeyring(mustParseKeyring(t, keyringEntry("k2", 2))))
+	v, _, err = s.Get(pKey)
+	assert.NoError(t, err)
+	assert.Exactly(t, "plain_before_marked_secret", string(v))
+	v, _, err = s.Get(pKeyWebsite)
+	assert.NoError(t, err)
+	assert.Exactly(t, "sk_live_website", string(v))
+
+	// an old value encrypted with k1 cannot be read anymore
+	assert.NoError(t, parent.Set(pKeyWebsite, rawWebsiteK1))
+	_, _, err = s.Get(pKeyWebsite)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	_, err = s.Reencrypt(*pKeyWebsite)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+
+	t.Run("parent cannot iterate", func(t *testing.T) {
+		s, err := storage.NewSecrets(storage.MakeMulti(storage.MultiOptions{}, parent), mustParseKeyring(t, keyringEntry("k2", 2)), storage.SecretsOptions{Sections: secretSections})
+		assert.NoError(t, err)
+		_, err = s.Reencrypt()
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+}
+
+func TestSecrets_Service(t *testing.T) {
+	s, err := storage.NewSecrets(storage.NewMap(), mustParseKeyring(t, keyringEntry("k1", 1)), storage.SecretsOptions{Sections: secretSections})
+	assert.NoError(t, err)
+	srv := config.MustNewService(s, config.Options{}, config.WithApplySections(secretSections...))
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	p := config.MustNewPath("payment/stripe/api_key")
+	assert.NoError(t, srv.Set(p, []byte("sk_live_123")))
+	v := srv.Get(p)
+	assert.Exactly(t, "<redacted>", v.String())
+	str, _, err := v.Str()
+	assert.NoError(t, err)
+	assert.Exactly(t, "sk_live_123", str)
+}
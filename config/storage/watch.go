@@ -0,0 +1,263 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall json yaml
+
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/config"
+)
+
+// WatchOptions applies options to the FileWatcher.
+type WatchOptions struct {
+	// Interval defines how often the files get checked for changes. Defaults to
+	// two seconds.
+	Interval time.Duration
+	// Debounce defines how long the content of the files must stay unchanged
+	// before it gets applied. Protects against half written files and
+	// multiple quick writes. Defaults to 500ms.
+	Debounce time.Duration
+	// Notify triggers an immediate check of the files, for example from an
+	// inotify or fsnotify based watcher. The polling continues as a fallback.
+	Notify <-chan struct{}
+	// Validate gets called with all values of the new files before anything
+	// gets applied. Returning an error rejects the whole change. Optional.
+	Validate func(pvs []config.PathValue) error
+	// OnReload gets called after each reload with the changed paths or the
+	// error. Optional.
+	OnReload func(changed []config.Path, err error)
+	// StorageLevel defines where the values get written. Defaults to 1 like
+	// WithLoadYAML and WithLoadJSON, see config.Service.SetBatch.
+	StorageLevel int
+	Log          log.Logger
+}
+
+// FileWatcher watches configuration files and applies their changed values to
+// the config.Service. It polls the content of the files because a Kubernetes
+// ConfigMap replaces a symlink instead of writing to the file. A change gets
+// applied once the content stays unchanged for the debounce duration. The whole
+// new content gets decoded and validated before the changed paths get written
+// atomically via config.Service.SetBatch, which publishes a message for each
+// changed path to the subscribed config.MessageReceiver. Paths removed from a
+// file keep their last value. Create a FileWatcher with WatchYAML or
+// WatchJSON.
+//		fw, err := storage.WatchYAML(srv, storage.WatchOptions{}, storage.WithGlob("/etc/shop/*.yaml"))
+//		defer fw.Close()
+type FileWatcher struct {
+	srv    *config.Service
+	o      WatchOptions
+	opts   []option
+	decode func(config.Setter, io.Reader) error
+
+	closeOnce sync.Once
+	done      chan struct{}
+	wg        sync.WaitGroup
+
+	// mu protects the fields below and serializes the reloads.
+	mu sync.Mutex
+	// hash of the last processed content, either applied or rejected.
+	hash [sha256.Size]byte
+	// values contains the last applied values, the key is the FQ path.
+	values map[string][]byte
+}
+
+func newFileWatcher(srv *config.Service, o WatchOptions, decode func(config.Setter, io.Reader) error, opts []option) (*FileWatcher, error) {
+	if srv == nil {
+		return nil, errors.Empty.Newf("[config/storage] FileWatcher argument config.Service cannot be nil")
+	}
+	if len(opts) == 0 {
+		return nil, errors.Empty.Newf("[config/storage] FileWatcher requires at least one option like WithGlob or WithFile")
+	}
+	if o.Interval <= 0 {
+		o.Interval = 2 * time.Second
+	}
+	if o.Debounce <= 0 {
+		o.Debounce = 500 * time.Millisecond
+	}
+	if o.StorageLevel == 0 {
+		o.StorageLevel = 1
+	}
+	fw := &FileWatcher{
+		srv:    srv,
+		o:      o,
+		opts:   opts,
+		decode: decode,
+		done:   make(chan struct{}),
+		values: make(map[string][]byte),
+	}
+
+	contents, hash, err := fw.read()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := fw.apply(contents, hash); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fw.wg.Add(1)
+	go fw.watch()
+	return fw, nil
+}
+
+// Close stops watching the files.
+func (fw *FileWatcher) Close() error {
+	fw.closeOnce.Do(func() { close(fw.done) })
+	fw.wg.Wait()
+	return nil
+}
+
+func (fw *FileWatcher) watch() {
+	defer fw.wg.Done()
+	ticker := time.NewTicker(fw.o.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-fw.done:
+			return
+		case <-ticker.C:
+		case <-fw.o.Notify: // nil channel blocks forever
+		}
+		if err := fw.Reload(); err != nil && fw.o.Log != nil && fw.o.Log.IsInfo() {
+			fw.o.Log.Info("config.storage.FileWatcher.Reload", log.Err(err))
+		}
+	}
+}
+
+// read loads the content of all files matched by the options.
+func (fw *FileWatcher) read() (contents [][]byte, hash [sha256.Size]byte, err error) {
+	h := sha256.New()
+	collect := func(_ config.Setter, r io.Reader) error {
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		contents = append(contents, data)
+		_, _ = h.Write(data)
+		_, _ = h.Write([]byte{0})
+		return nil
+	}
+	for _, opt := range fw.opts {
+		if err := opt(fw.srv, collect); err != nil {
+			return nil, hash, errors.WithStack(err)
+		}
+	}
+	copy(hash[:], h.Sum(nil))
+	return contents, hash, nil
+}
+
+// Reload checks the files for changes and applies them after the debounce
+// duration. It gets called by the watching goroutine but can be called
+// manually, too.
+func (fw *FileWatcher) Reload() error {
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	contents, hash, err := fw.read()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if hash == fw.hash {
+		return nil
+	}
+	for {
+		select {
+		case <-fw.done:
+			return nil
+		case <-time.After(fw.o.Debounce):
+		}
+		var hash2 [sha256.Size]byte
+		if contents, hash2, err = fw.read(); err != nil {
+			return errors.WithStack(err)
+		}
+		if hash2 == hash {
+			break
+		}
+		hash = hash2
+	}
+
+	changed, err := fw.apply(contents, hash)
+	if fw.o.OnReload != nil {
+		fw.o.OnReload(changed, err)
+	}
+	return errors.WithStack(err)
+}
+
+// apply decodes and validates the contents and writes the changed values.
+// Returns the changed paths. The caller must hold the lock.
+func (fw *FileWatcher) apply(contents [][]byte, hash [sha256.Size]byte) ([]config.Path, error) {
+	// Rejected content gets marked as processed to avoid the same error on
+	// every tick. A failed write gets retried with the next tick.
+	var c pathValueCollector
+	for _, data := range contents {
+		if err := fw.decode(&c, bytes.NewReader(data)); err != nil {
+			fw.hash = hash
+			return nil, errors.NotValid.New(err, "[config/storage] FileWatcher failed to decode file")
+		}
+	}
+	if fw.o.Validate != nil {
+		if err := fw.o.Validate(c.pvs); err != nil {
+			fw.hash = hash
+			return nil, errors.NotValid.New(err, "[config/storage] FileWatcher validation failed")
+		}
+	}
+
+	// the last value wins, like loading the files one after another.
+	newValues := make(map[string][]byte, len(c.pvs))
+	var paths []config.Path
+	for _, pv := range c.pvs {
+		key := pv.Path.String()
+		if _, ok := newValues[key]; !ok {
+			paths = append(paths, pv.Path)
+		}
+		newValues[key] = pv.Value
+	}
+	var changed []config.PathValue
+	for _, p := range paths {
+		v := newValues[p.String()]
+		if old, ok := fw.values[p.String()]; ok && bytes.Equal(old, v) {
+			continue
+		}
+		changed = append(changed, config.PathValue{Path: p, Value: v})
+	}
+	if len(changed) == 0 {
+		fw.hash = hash
+		fw.values = newValues
+		return nil, nil
+	}
+
+	if err := fw.srv.SetBatch(fw.o.StorageLevel, changed...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	fw.hash = hash
+	fw.values = newValues
+
+	paths = paths[:0]
+	for _, pv := range changed {
+		paths = append(paths, pv.Path)
+	}
+	if fw.o.Log != nil && fw.o.Log.IsDebug() {
+		fw.o.Log.Debug("config.storage.FileWatcher.Applied", log.Int("changed_paths", len(paths)), log.Int("total_paths", len(newValues)))
+	}
+	return paths, nil
+}
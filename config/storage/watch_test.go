@@ -0,0 +1,225 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// +build csall yaml
+
+package storage_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/storage"
+	"github.com/corestoreio/pkg/store/scope"
+	"github.com/corestoreio/pkg/util/assert"
+	"github.com/fortytw2/leaktest"
+)
+
+type reloadResult struct {
+	changed []config.Path
+	err     error
+}
+
+type watchSubscriber chan string
+
+func (ws watchSubscriber) MessageConfig(p config.Path) error {
+	ws <- p.String()
+	return nil
+}
+
+type watchObserver struct {
+	err error
+}
+
+func (wo watchObserver) Observe(_ config.Path, rawData []byte, _ bool) ([]byte, error) {
+	return rawData, wo.err
+}
+
+func writeFile(t *testing.T, file, data string) {
+	// write and rename like a ConfigMap update to avoid reading half written
+	// files.
+	tmp := file + ".tmp"
+	assert.NoError(t, ioutil.WriteFile(tmp, []byte(data), 0644))
+	assert.NoError(t, os.Rename(tmp, file))
+}
+
+func TestWatchYAML(t *testing.T) {
+	defer leaktest.CheckTimeout(t, 2*time.Second)()
+
+	dir, err := ioutil.TempDir("", "cs_watch")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "config.yaml")
+
+	writeFile(t, file, `
+web/cors/allow_credentials:
+  default:
+    0: 1
+general/store_information/name:
+  stores:
+    2: Shop
+`)
+
+	srv := config.MustNewService(storage.NewMap(), config.Options{EnablePubSub: true})
+	defer func() { assert.NoError(t, srv.Close()) }()
+	msgs := make(watchSubscriber, 10)
+	_, err = srv.Subscribe("stores", msgs)
+	assert.NoError(t, err)
+
+	pCors := config.MustNewPath("web/cors/allow_credentials")
+	pName := config.MustNewPathWithScope(scope.Store.WithID(2), "general/store_information/name")
+
+	notify := make(chan struct{})
+	reloads := make(chan reloadResult, 1)
+	fw, err := storage.WatchYAML(srv, storage.WatchOptions{
+		Interval: time.Hour, // test uses only Notify
+		Debounce: time.Millisecond,
+		Notify:   notify,
+		Validate: func(pvs []config.PathValue) error {
+			for _, pv := range pvs {
+				if string(pv.Value) == "invalid" {
+					return errors.NotAcceptable.Newf("invalid value for %q", pv.Path.String())
+				}
+			}
+			return nil
+		},
+		OnReload: func(changed []config.Path, err error) {
+			reloads <- reloadResult{changed: changed, err: err}
+		},
+	}, storage.WithFile(file))
+	assert.NoError(t, err)
+	defer func() { assert.NoError(t, fw.Close()) }()
+
+	assert.Exactly(t, `"1"`, srv.Get(pCors).String())
+	assert.Exactly(t, `"Shop"`, srv.Get(pName).String())
+	assert.Exactly(t, pName.String(), <-msgs)
+
+	t.Run("no change", func(t *testing.T) {
+		assert.NoError(t, fw.Reload())
+		select {
+		case r := <-reloads:
+			t.Errorf("unexpected reload %#v", r)
+		default:
+		}
+	})
+
+	t.Run("only changed paths", func(t *testing.T) {
+		writeFile(t, file, `
+web/cors/allow_credentials:
+  default:
+    0: 1
+general/store_information/name:
+  stores:
+    2: Better Shop
+    3: Other Shop
+`)
+		notify <- struct{}{}
+		r := <-reloads
+		assert.NoError(t, r.err)
+		var changed []string
+		for _, p := range r.changed {
+			changed = append(changed, p.String())
+		}
+		sort.Strings(changed)
+		assert.Exactly(t, []string{
+			"stores/2/general/store_information/name",
+			"stores/3/general/store_information/name",
+		}, changed)
+
+		assert.Exactly(t, `"Better Shop"`, srv.Get(pName).String())
+		got := []string{<-msgs, <-msgs}
+		sort.Strings(got)
+		assert.Exactly(t, changed, got)
+	})
+
+	t.Run("malformed file gets rejected", func(t *testing.T) {
+		writeFile(t, file, `
+web/cors/allow_credentials:
+  default:
+    0: 0
+general/store_information/name:
+  stores: [
+`)
+		notify <- struct{}{}
+		r := <-reloads
+		assert.True(t, errors.NotValid.Match(r.err), "%+v", r.err)
+		assert.Exactly(t, `"1"`, srv.Get(pCors).String(), "nothing must be applied")
+	})
+
+	t.Run("validation rejects", func(t *testing.T) {
+		writeFile(t, file, `
+web/cors/allow_credentials:
+  default:
+    0: 0
+general/store_information/name:
+  stores:
+    2: invalid
+`)
+		notify <- struct{}{}
+		r := <-reloads
+		assert.True(t, errors.NotValid.Match(r.err), "%+v", r.err)
+		assert.Exactly(t, `"1"`, srv.Get(pCors).String(), "nothing must be applied")
+		assert.Exactly(t, `"Better Shop"`, srv.Get(pName).String())
+	})
+
+	t.Run("failed write gets retried", func(t *testing.T) {
+		rejecting := watchObserver{err: errors.NotAllowed.Newf("read only")}
+		assert.NoError(t, srv.RegisterObserver(config.EventOnBeforeSet, "web/cors/allow_credentials", rejecting))
+		writeFile(t, file, `
+web/cors/allow_credentials:
+  default:
+    0: 0
+general/store_information/name:
+  stores:
+    2: Better Shop
+`)
+		notify <- struct{}{}
+		r := <-reloads
+		assert.True(t, errors.NotAllowed.Match(r.err), "%+v", r.err)
+		assert.Exactly(t, `"1"`, srv.Get(pCors).String())
+
+		assert.NoError(t, srv.DeregisterObserver(config.EventOnBeforeSet, "web/cors/allow_credentials"))
+		assert.NoError(t, fw.Reload())
+		r = <-reloads
+		assert.NoError(t, r.err)
+		assert.Exactly(t, []config.Path{*pCors}, r.changed)
+		assert.Exactly(t, `"0"`, srv.Get(pCors).String())
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		assert.NoError(t, os.Remove(file))
+		err := fw.Reload()
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+}
+
+func TestWatchYAML_Errors(t *testing.T) {
+	srv := config.MustNewService(storage.NewMap(), config.Options{})
+	defer func() { assert.NoError(t, srv.Close()) }()
+
+	_, err := storage.WatchYAML(nil, storage.WatchOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	_, err = storage.WatchYAML(srv, storage.WatchOptions{})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	_, err = storage.WatchYAML(srv, storage.WatchOptions{}, storage.WithFiles([]string{"testdata", "malformed_yaml.yaml"}))
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
@@ -37,6 +37,19 @@ func WithLoadYAML(opts ...option) config.LoadDataOption {
 	}).WithUseStorageLevel(1)
 }
 
+// ReadYAML reads the configuration values from YAML files without applying
+// them to the config.Service, for example to validate them with a
+// config.SchemaValidator.
+func ReadYAML(s *config.Service, opts ...option) ([]config.PathValue, error) {
+	return readPathValues(s, loadYAML, opts)
+}
+
+// WatchYAML loads the YAML files and watches them for changes. The changed
+// values get applied to the config.Service. See FileWatcher.
+func WatchYAML(s *config.Service, o WatchOptions, opts ...option) (*FileWatcher, error) {
+	return newFileWatcher(s, o, loadYAML, opts)
+}
+
 func loadYAML(s config.Setter, r io.Reader) error {
 
 	d := yaml.NewDecoder(r)
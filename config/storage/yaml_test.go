@@ -27,6 +27,26 @@ import (
 	"github.com/fortytw2/leaktest"
 )
 
+func TestReadYAML(t *testing.T) {
+	cfgSrv := config.MustNewService(storage.NewMap(), config.Options{})
+	defer func() { assert.NoError(t, cfgSrv.Close()) }()
+
+	pvs, err := storage.ReadYAML(cfgSrv, storage.WithFiles([]string{"testdata", "example.yaml"}))
+	assert.NoError(t, err)
+	var found int
+	for _, pv := range pvs {
+		if pv.Path.String() == "stores/2/dev/js/merge_files" {
+			assert.Exactly(t, "2.002", string(pv.Value))
+			found++
+		}
+	}
+	assert.Exactly(t, 1, found)
+	assert.Exactly(t, `<notFound>`, cfgSrv.Get(config.MustNewPathWithScope(scope.Store.WithID(2), "dev/js/merge_files")).String(), "values must not be applied")
+
+	_, err = storage.ReadYAML(cfgSrv, storage.WithFiles([]string{"testdata", "malformed_path.yaml"}))
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
+
 func TestWithLoadYAML(t *testing.T) {
 
 	t.Run("success", func(t *testing.T) {
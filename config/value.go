@@ -19,6 +19,7 @@ import (
 	"crypto/subtle"
 	"encoding"
 	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
@@ -32,6 +33,8 @@ import (
 // CSVColumnSeparator separates CSV values. Default value.
 const CSVColumnSeparator = ','
 
+const valRedacted = "<redacted>"
+
 const (
 	valFoundNo = iota
 	valFoundL2
@@ -67,6 +70,8 @@ type Value struct {
 	// statistical flag to identify where a value comes from, e.g. from level2
 	// or from LRU.
 	found uint8
+	// secret redacts the data in String and MarshalJSON.
+	secret bool
 }
 
 // NewValue makes a new non-pointer value type.
@@ -90,7 +95,7 @@ func (v *Value) init() (found bool, err error) {
 
 // String implements fmt.Stringer and returns the textual representation and Go
 // syntax escaped of the underlying data. It might print the error in the
-// string.
+// string. The data of a secret value gets printed as <redacted>.
 func (v *Value) String() string {
 	if found, err := v.init(); err != nil {
 		return fmt.Sprintf("[config] Value: %+v", err)
@@ -100,9 +105,34 @@ func (v *Value) String() string {
 	if v.data == nil {
 		return "<nil>"
 	}
+	if v.secret {
+		return valRedacted
+	}
 	return fmt.Sprintf("%q", v.data)
 }
 
+// IsSecret returns true if the value belongs to a Field marked as Secret. See
+// WithApplySections.
+func (v *Value) IsSecret() bool {
+	return v.secret
+}
+
+// MarshalJSON implements json.Marshaler and writes the data as a JSON string
+// or null. A secret value gets written as "<redacted>" and a not found value
+// as null.
+func (v *Value) MarshalJSON() ([]byte, error) {
+	found, err := v.init()
+	switch {
+	case err != nil:
+		return nil, errors.WithStack(err)
+	case !found, v.data == nil:
+		return []byte("null"), nil
+	case v.secret:
+		return []byte(`"` + valRedacted + `"`), nil
+	}
+	return json.Marshal(string(v.data))
+}
+
 // UnsafeStr same as Str but ignores errors.
 func (v *Value) UnsafeStr() (s string) {
 	s, _, _ = v.Str()
@@ -15,6 +15,7 @@
 package cspb
 
 import (
+	"github.com/corestoreio/errors"
 	"github.com/gogo/googleapis/google/rpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -42,3 +43,45 @@ func NewStatusBadRequestError(c codes.Code, msg string, FieldDescription ...stri
 
 	return st.Err()
 }
+
+// NewStatusError converts an error into a GRPC status code error. The
+// behaviour of the error, as defined in package github.com/corestoreio/errors,
+// determines the code. A nil error returns nil and errors already carrying a
+// GRPC status get returned unchanged. All other errors map to codes.Internal.
+func NewStatusError(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(errorCode(err), err.Error())
+}
+
+func errorCode(err error) codes.Code {
+	switch {
+	case errors.NotFound.Match(err):
+		return codes.NotFound
+	case errors.NotValid.Match(err), errors.Empty.Match(err), errors.Mismatch.Match(err):
+		return codes.InvalidArgument
+	case errors.AlreadyExists.Match(err), errors.Duplicated.Match(err):
+		return codes.AlreadyExists
+	case errors.OutOfRange.Match(err):
+		return codes.OutOfRange
+	case errors.NotImplemented.Match(err), errors.NotSupported.Match(err):
+		return codes.Unimplemented
+	case errors.Unauthorized.Match(err):
+		return codes.Unauthenticated
+	case errors.NotAllowed.Match(err):
+		return codes.PermissionDenied
+	case errors.NotAcceptable.Match(err):
+		return codes.FailedPrecondition
+	case errors.Timeout.Match(err):
+		return codes.DeadlineExceeded
+	case errors.Aborted.Match(err):
+		return codes.Aborted
+	case errors.Temporary.Match(err), errors.ConnectionFailed.Match(err), errors.ConnectionLost.Match(err):
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
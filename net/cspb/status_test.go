@@ -19,6 +19,7 @@ import (
 	"testing"
 
 	"github.com/alecthomas/assert"
+	csErrors "github.com/corestoreio/errors"
 	"github.com/corestoreio/pkg/net/cspb"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -36,3 +37,27 @@ func TestNewStatusBadRequestError(t *testing.T) {
 		[]interface{}{errors.New("any: message type \"google.rpc.BadRequest\" isn't linked in")},
 		st.Details())
 }
+
+func TestNewStatusError(t *testing.T) {
+	assert.Nil(t, cspb.NewStatusError(nil))
+
+	tests := []struct {
+		err  error
+		code codes.Code
+	}{
+		{csErrors.NotFound.Newf("entity %d not found", 3), codes.NotFound},
+		{csErrors.NotValid.Newf("invalid email"), codes.InvalidArgument},
+		{csErrors.AlreadyExists.Newf("entity exists"), codes.AlreadyExists},
+		{csErrors.NotImplemented.Newf("todo"), codes.Unimplemented},
+		{csErrors.Unauthorized.Newf("missing token"), codes.Unauthenticated},
+		{csErrors.NotAllowed.Newf("admin only"), codes.PermissionDenied},
+		{csErrors.Timeout.Newf("too slow"), codes.DeadlineExceeded},
+		{errors.New("plain error"), codes.Internal},
+		{status.Error(codes.Canceled, "canceled"), codes.Canceled},
+	}
+	for _, test := range tests {
+		st, ok := status.FromError(cspb.NewStatusError(test.err))
+		assert.True(t, ok)
+		assert.Exactly(t, test.code, st.Code(), "%s", test.err)
+	}
+}
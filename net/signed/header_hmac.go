@@ -61,11 +61,17 @@ func (h *ContentHMAC) HeaderKey() string {
 // Content-HMAC: <hash mechanism> <encoded binary HMAC>
 // Content-HMAC: sha1 f1wOnLLwcTexwCSRCNXEAKPDm+U=
 func (h *ContentHMAC) Write(w http.ResponseWriter, signature []byte) {
+	h.SetHeader(w.Header(), signature)
+}
+
+// SetHeader sets the encoded signature in the header map. Useful for signing
+// an outgoing request: hmac.SetHeader(req.Header, signature).
+func (h *ContentHMAC) SetHeader(header http.Header, signature []byte) {
 	encFn := h.EncodeFn
 	if encFn == nil {
 		encFn = hex.EncodeToString
 	}
-	w.Header().Set(h.HeaderKey(), h.Algorithm+" "+encFn(signature))
+	header.Set(h.HeaderKey(), h.Algorithm+" "+encFn(signature))
 }
 
 // Parse looks up the header or trailer for the HeaderKey Content-HMAC in an
@@ -16,6 +16,8 @@
 
 package signed
 
+import "github.com/corestoreio/pkg/config"
+
 // Service creates a middleware that facilitates using a hash function to sign a
 // HTTP body and validate the HTTP body of a request.
 type Service struct {
@@ -26,7 +28,8 @@ type Service struct {
 // The scope.Default and any other scopes have these default settings: InTrailer
 // activated, Content-HMAC header with sha256, allowed HTTP methods set to POST,
 // PUT, PATCH and password for the HMAC SHA 256 from a cryptographically random
-// source with a length of 64 bytes.
-func New(opts ...Option) (*Service, error) {
-	return newService(opts...)
+// source with a length of 64 bytes. Argument cfg can be nil if no scoped
+// configuration gets loaded from the backend.
+func New(cfg config.Scoper, opts ...Option) (*Service, error) {
+	return newService(cfg, opts...)
 }
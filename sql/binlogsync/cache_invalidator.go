@@ -0,0 +1,60 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+var _ RowsEventHandler = (*CacheInvalidator)(nil)
+
+// CacheInvalidator invalidates the tags of a dml.QueryCache whenever rows of a
+// table change. The table name acts as tag, so queries must be cached with the
+// names of the tables they read from.
+//		qc := dml.NewQueryCache(objcacheManager, nil)
+//		canal.RegisterRowsEventHandler("", binlogsync.NewCacheInvalidator(qc))
+//		ids, err := dbc.SelectFrom("customer_entity").AddColumns("entity_id").
+//			WithArgs().WithCache(qc, 0, "customer_entity").LoadInt64s(ctx, nil)
+type CacheInvalidator struct {
+	qc *dml.QueryCache
+	// Tags optionally maps a table name to additional tags which get
+	// invalidated together with the table name.
+	Tags map[string][]string
+}
+
+// NewCacheInvalidator creates a new RowsEventHandler for the query cache.
+func NewCacheInvalidator(qc *dml.QueryCache) *CacheInvalidator {
+	return &CacheInvalidator{qc: qc}
+}
+
+// Do invalidates the name of the changed table and its additional tags. An
+// error does not interrupt the canal.
+func (ci *CacheInvalidator) Do(ctx context.Context, _ string, t *ddl.Table, _ [][]interface{}) error {
+	if t == nil || t.Name == "" {
+		return nil
+	}
+	tags := append([]string{t.Name}, ci.Tags[t.Name]...)
+	return errors.WithStack(ci.qc.Invalidate(ctx, tags...))
+}
+
+// Complete does nothing.
+func (ci *CacheInvalidator) Complete(_ context.Context) error { return nil }
+
+// String returns the name of the handler.
+func (ci *CacheInvalidator) String() string { return "dml.QueryCache invalidator" }
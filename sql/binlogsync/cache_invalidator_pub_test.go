@@ -0,0 +1,67 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/storage/objcache"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestCacheInvalidator(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	m, err := objcache.NewManager(objcache.WithSimpleSlowCacheMap())
+	assert.NoError(t, err)
+	qc := dml.NewQueryCache(m, nil)
+	ci := binlogsync.NewCacheInvalidator(qc)
+	ci.Tags = map[string][]string{"catalog_product_entity": {"catalog"}}
+	ctx := context.TODO()
+
+	load := func(table, tag string) {
+		ids, err := dbc.SelectFrom(table).AddColumns("entity_id").WithArgs().WithCache(qc, 0, tag).LoadInt64s(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []int64{1}, ids)
+	}
+	expect := func(table string) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id` FROM `" + table + "`")).
+			WillReturnRows(sqlmock.NewRows([]string{"entity_id"}).AddRow(1))
+	}
+
+	expect("customer_entity")
+	expect("catalog_category_entity")
+	load("customer_entity", "customer_entity")
+	load("catalog_category_entity", "catalog")
+	load("customer_entity", "customer_entity")
+	load("catalog_category_entity", "catalog")
+
+	assert.NoError(t, ci.Do(ctx, binlogsync.InsertAction, ddl.NewTable("customer_entity"), nil))
+	expect("customer_entity")
+	load("customer_entity", "customer_entity")
+	load("catalog_category_entity", "catalog")
+
+	assert.NoError(t, ci.Do(ctx, binlogsync.UpdateAction, ddl.NewTable("catalog_product_entity"), nil))
+	expect("catalog_category_entity")
+	load("catalog_category_entity", "catalog")
+	load("customer_entity", "customer_entity")
+}
@@ -1,7 +1,6 @@
 package binlogsync
 
 import (
-	"bytes"
 	"context"
 	"crypto/tls"
 	"database/sql"
@@ -22,6 +21,7 @@ import (
 	"github.com/corestoreio/pkg/sync/singleflight"
 	"github.com/corestoreio/pkg/util/conv"
 	"github.com/go-sql-driver/mysql"
+	gmysql "github.com/siddontang/go-mysql/mysql"
 )
 
 // Use flavor for different MySQL versions,
@@ -43,8 +43,7 @@ const (
 
 // Canal can sync your MySQL data. MySQL must use the binlog format ROW.
 type Canal struct {
-	opts                      Options
-	configPathBackendPosition *config.Path
+	opts Options
 	// mclose acts only during the call to Close().
 	mclose sync.Mutex
 	// DSN contains the parsed DSN
@@ -53,9 +52,20 @@ type Canal struct {
 	cfgScope config.Scoped // required
 	syncer   *myreplicator.BinlogSyncer
 
-	masterMu           sync.RWMutex
-	masterStatus       ddl.MasterStatus
-	masterLastSaveTime time.Time
+	masterMu sync.RWMutex
+	// masterStatus contains the position up to which all event handlers have
+	// been completed successfully.
+	masterStatus ddl.MasterStatus
+
+	// checkpointStore gets set from the options or falls back to the
+	// config.Service, might be nil.
+	checkpointStore    CheckpointStore
+	checkpointLastTime time.Time
+	checkpointPending  int
+	// checkpointPos contains the position of the last transaction boundary.
+	checkpointPos ddl.MasterStatus
+	// gset contains the executed GTIDs, nil if GTIDs are not used.
+	gset gmysql.GTIDSet
 
 	rsMu sync.RWMutex
 	// the empty map key declares event handler for all tables, filtered  by the regexes.
@@ -144,8 +154,9 @@ func withExcludeTables(regexes []string) func(c *Canal) error {
 	}
 }
 
-// withUpdateBinlogStart enables to start from a specific position or just start
-// from the current master position. See startSyncBinlog
+// withUpdateBinlogStart enables to start from a specific position, from the
+// last checkpoint or just start from the current master position. See
+// startSyncBinlog
 func withUpdateBinlogStart(c *Canal) error {
 
 	if c.opts.BinlogStartFile != "" && c.opts.BinlogStartPosition > 0 {
@@ -157,14 +168,37 @@ func withUpdateBinlogStart(c *Canal) error {
 	if c.opts.MasterStatusQueryTimeout == 0 {
 		c.opts.MasterStatusQueryTimeout = time.Second * 20
 	}
-
-	var ms ddl.MasterStatus
 	ctx, cancel := context.WithTimeout(context.Background(), c.opts.MasterStatusQueryTimeout)
 	defer cancel()
+
+	if c.checkpointStore != nil {
+		ms, err := c.checkpointStore.LoadCheckpoint(ctx)
+		switch {
+		case err == nil:
+			if c.opts.Log.IsInfo() {
+				c.opts.Log.Info("[binlogsync] Continue from checkpoint", log.Stringer("position", ms), log.String("gtid_set", ms.ExecutedGTIDSet))
+			}
+			c.masterStatus = ms
+			return nil
+		case !errors.NotFound.Match(err):
+			return errors.WithStack(err)
+		}
+	}
+
+	var ms ddl.MasterStatus
 	if _, err := c.dbcp.WithQueryBuilder(&ms).Load(ctx, &ms); err != nil {
 		return errors.WithStack(err)
 	}
 
+	if c.opts.UseGTID && c.opts.Flavor == MariaDBFlavor {
+		const varName = "gtid_current_pos"
+		v := ddl.NewVariables(varName)
+		if _, err := c.dbcp.WithQueryBuilder(v).Load(ctx, v); err != nil {
+			return errors.WithStack(err)
+		}
+		ms.ExecutedGTIDSet, _ = v.String(varName)
+	}
+
 	c.masterStatus = ms
 
 	return nil
@@ -218,7 +252,8 @@ type Options struct {
 	// ConfigScoped defines the configuration to load the following fields from.
 	// If not set the data won't be loaded.
 	ConfigScoped config.Scoped
-	// ConfigSet used to persists the master position of the binlog stream.
+	// ConfigSet used to persists the master position of the binlog stream, if
+	// CheckpointStore has not been set.
 	ConfigSet config.Setter
 	Log       log.Logger
 	TLSConfig *tls.Config // Needs some rework
@@ -238,6 +273,25 @@ type Options struct {
 	// `mariadb`.
 	Flavor                   string
 	MasterStatusQueryTimeout time.Duration
+	// CheckpointStore persists the position after all handlers have
+	// successfully completed and gets used to continue after a restart. If nil
+	// and ConfigSet has been set, the position gets stored in the config.Service
+	// via NewCheckpointConfig.
+	CheckpointStore CheckpointStore
+	// CheckpointTransactions defines the number of committed transactions
+	// after which the handlers get completed and the checkpoint gets written.
+	// Zero disables counting.
+	CheckpointTransactions int
+	// CheckpointInterval defines the duration after which the handlers get
+	// completed and the checkpoint gets written with the next committed
+	// transaction. Defaults to one second if CheckpointTransactions is zero.
+	// Pending transactions get also completed once the binlog stream becomes
+	// idle.
+	CheckpointInterval time.Duration
+	// UseGTID tracks the global transaction identifiers and starts the sync
+	// from the GTID set of the checkpoint or the master status, instead of the
+	// file and position. Requires gtid_mode=ON on MySQL.
+	UseGTID bool
 	// OnClose runs before the database connection gets closed and after the
 	// syncer has been closed. The syncer does not "see" the changes comming
 	// from the queries executed in the call back.
@@ -312,11 +366,17 @@ func NewCanal(dsn string, db DBConFactory, opt *Options) (*Canal, error) {
 	}
 
 	c := &Canal{
-		opts:                      *opt,
-		configPathBackendPosition: config.MustNewPath(ConfigPathBackendPosition),
-		dsn:                       pDSN,
-		closed:                    new(int32),
-		tables:                    ddl.MustNewTables(),
+		opts:            *opt,
+		dsn:             pDSN,
+		closed:          new(int32),
+		tables:          ddl.MustNewTables(),
+		checkpointStore: opt.CheckpointStore,
+	}
+	if c.checkpointStore == nil && c.opts.ConfigSet != nil {
+		c.checkpointStore = NewCheckpointConfig(c.opts.ConfigScoped, c.opts.ConfigSet)
+	}
+	if c.opts.CheckpointTransactions == 0 && c.opts.CheckpointInterval == 0 {
+		c.opts.CheckpointInterval = time.Second
 	}
 
 	atomic.StoreInt32(c.closed, 0)
@@ -347,46 +407,65 @@ func NewCanal(dsn string, db DBConFactory, opt *Options) (*Canal, error) {
 	return c, nil
 }
 
-// TODO continue sync from last stored master position
-
-func (c *Canal) masterSave(fileName string, pos uint) error {
-	c.masterMu.Lock()
-	defer c.masterMu.Unlock()
-
-	c.masterStatus.File = fileName
-	c.masterStatus.Position = pos
-
+// checkpoint records the position of a transaction boundary. If forced or the
+// configured number of transactions or interval has been reached, the event
+// handlers get completed and the position gets saved in the CheckpointStore.
+// Must only be called at transaction boundaries.
+func (c *Canal) checkpoint(ctx context.Context, pos ddl.MasterStatus, force bool) error {
+	c.checkpointPos = pos
+	c.checkpointPending++
 	now := time.Now()
-	if now.Sub(c.masterLastSaveTime) < time.Second {
+	isDue := force ||
+		(c.opts.CheckpointTransactions > 0 && c.checkpointPending >= c.opts.CheckpointTransactions) ||
+		(c.opts.CheckpointInterval > 0 && now.Sub(c.checkpointLastTime) >= c.opts.CheckpointInterval)
+	if !isDue {
 		return nil
 	}
+	return c.completeCheckpoint(ctx, now)
+}
 
-	if c.opts.ConfigSet == nil {
-		if c.opts.Log.IsDebug() {
-			c.opts.Log.Debug("[binlogsync] Warning: Master Status cannot be saved because config.Setter is nil",
-				log.String("database", c.dsn.DBName), log.Stringer("master_status", c.masterStatus))
+// completeCheckpoint completes the event handlers and, after they have
+// succeeded, advances the synced position and saves it in the CheckpointStore.
+// A failed handler keeps the old position, so the checkpoint gets retried
+// with the next transaction.
+func (c *Canal) completeCheckpoint(ctx context.Context, now time.Time) error {
+	pos := c.checkpointPos
+	if err := c.flushEventHandlers(withPosition(ctx, eventPosition{ms: pos})); err != nil {
+		if errors.Is(err, errors.Interrupted) {
+			return errors.WithStack(err)
+		}
+		if c.opts.Log.IsInfo() {
+			c.opts.Log.Info("[binlogsync] Skipping checkpoint because of failed event handler",
+				log.Err(err), log.String("database", c.dsn.DBName), log.Stringer("position", pos))
 		}
 		return nil
 	}
 
-	var buf bytes.Buffer
-	c.masterStatus.WriteTo(&buf)
-	if err := c.opts.ConfigSet.Set(c.configPathBackendPosition, buf.Bytes()); err != nil {
+	c.masterMu.Lock()
+	c.masterStatus = pos
+	c.masterMu.Unlock()
+
+	if c.checkpointStore == nil {
+		if c.opts.Log.IsDebug() {
+			c.opts.Log.Debug("[binlogsync] Warning: Checkpoint cannot be saved because CheckpointStore and config.Setter are nil",
+				log.String("database", c.dsn.DBName), log.Stringer("position", pos))
+		}
+	} else if err := c.checkpointStore.SaveCheckpoint(ctx, pos); err != nil {
+		// Retry with the next transaction.
 		if c.opts.Log.IsInfo() {
-			c.opts.Log.Info("[binlogsync] Failed to store Master Status",
-				log.Time("master_last_save_time", c.masterLastSaveTime),
-				log.Err(err), log.String("database", c.dsn.DBName), log.Stringer("master_status", c.masterStatus))
+			c.opts.Log.Info("[binlogsync] Failed to save checkpoint",
+				log.Err(err), log.String("database", c.dsn.DBName), log.Stringer("position", pos), log.String("gtid_set", pos.ExecutedGTIDSet))
 		}
-		return errors.WithStack(err)
+		return nil
 	}
-
-	c.masterLastSaveTime = now
-
+	c.checkpointPending = 0
+	c.checkpointLastTime = now
 	return nil
 }
 
-// SyncedPosition returns the current synced position as retrieved from the SQl
-// server.
+// SyncedPosition returns the position up to which all row events have been
+// processed and all event handlers have been completed successfully. The
+// position does not advance while a handler fails to complete.
 func (c *Canal) SyncedPosition() ddl.MasterStatus {
 	c.masterMu.RLock()
 	defer c.masterMu.RUnlock()
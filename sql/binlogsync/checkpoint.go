@@ -0,0 +1,253 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/store/scope"
+)
+
+var (
+	_ CheckpointStore = (*CheckpointConfig)(nil)
+	_ CheckpointStore = (*CheckpointFile)(nil)
+	_ CheckpointStore = (*CheckpointDB)(nil)
+)
+
+// CheckpointStore persists the position of the binary log up to which all
+// events have been processed by the RowsEventHandler. The Canal writes a
+// checkpoint only at transaction boundaries and only after function Complete
+// of all RowsEventHandler has succeeded. After a restart the Canal continues
+// from the last checkpoint, so all events after the checkpoint get delivered
+// again. Event handlers must therefore be idempotent, see function
+// IdempotencyKey. This is the at-least-once delivery guarantee.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the last saved position. It must return an error
+	// with behaviour NotFound if no checkpoint has been saved.
+	LoadCheckpoint(ctx context.Context) (ddl.MasterStatus, error)
+	// SaveCheckpoint writes the position atomically. Either the old or the
+	// new position must be readable after a crash.
+	SaveCheckpoint(ctx context.Context, ms ddl.MasterStatus) error
+}
+
+// CheckpointConfig stores the checkpoint in the configuration service under
+// the path ConfigPathBackendPosition in the default scope.
+type CheckpointConfig struct {
+	cg   config.Scoped
+	cs   config.Setter
+	path *config.Path
+}
+
+// NewCheckpointConfig creates a new checkpoint store for the configuration
+// service. The checkpoint gets read from `cg` and written to `cs`.
+func NewCheckpointConfig(cg config.Scoped, cs config.Setter) *CheckpointConfig {
+	return &CheckpointConfig{
+		cg:   cg,
+		cs:   cs,
+		path: config.MustNewPath(ConfigPathBackendPosition),
+	}
+}
+
+// LoadCheckpoint reads the checkpoint from the configuration service.
+func (cc *CheckpointConfig) LoadCheckpoint(_ context.Context) (ms ddl.MasterStatus, err error) {
+	if !cc.cg.IsValid() {
+		return ms, errors.NotFound.Newf("[binlogsync] CheckpointConfig: config.Scoped not set")
+	}
+	v, ok, err := cc.cg.Get(scope.Default, ConfigPathBackendPosition).Str()
+	if err != nil {
+		return ms, errors.WithStack(err)
+	}
+	if !ok || v == "" {
+		return ms, errors.NotFound.Newf("[binlogsync] CheckpointConfig: No checkpoint found in path %q", ConfigPathBackendPosition)
+	}
+	err = ms.FromString(v)
+	return ms, errors.WithStack(err)
+}
+
+// SaveCheckpoint writes the checkpoint into the configuration service.
+func (cc *CheckpointConfig) SaveCheckpoint(_ context.Context, ms ddl.MasterStatus) error {
+	var buf bytes.Buffer
+	if _, err := ms.WriteTo(&buf); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(cc.cs.Set(cc.path, buf.Bytes()))
+}
+
+// CheckpointFile stores the checkpoint in a file. The file gets written to a
+// temporary file in the same directory, synced and then renamed, so a crash
+// never leaves a partially written checkpoint.
+type CheckpointFile struct {
+	Path string
+}
+
+// NewCheckpointFile creates a new file based checkpoint store.
+func NewCheckpointFile(path string) *CheckpointFile {
+	return &CheckpointFile{Path: path}
+}
+
+// LoadCheckpoint reads the checkpoint from the file.
+func (cf *CheckpointFile) LoadCheckpoint(_ context.Context) (ms ddl.MasterStatus, err error) {
+	data, err := ioutil.ReadFile(cf.Path)
+	switch {
+	case os.IsNotExist(err):
+		return ms, errors.NotFound.Newf("[binlogsync] CheckpointFile: File %q not found", cf.Path)
+	case err != nil:
+		return ms, errors.WithStack(err)
+	}
+	err = ms.FromString(string(bytes.TrimSpace(data)))
+	return ms, errors.Wrapf(err, "[binlogsync] CheckpointFile: File %q", cf.Path)
+}
+
+// SaveCheckpoint writes the checkpoint atomically into the file.
+func (cf *CheckpointFile) SaveCheckpoint(_ context.Context, ms ddl.MasterStatus) (err error) {
+	dir, base := filepath.Split(cf.Path)
+	if dir == "" {
+		dir = "."
+	}
+	tmp, err := ioutil.TempFile(dir, base+".tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = ms.WriteTo(tmp); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return errors.WithStack(err)
+	}
+	if err = tmp.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	if err = os.Rename(tmp.Name(), cf.Path); err != nil {
+		return errors.WithStack(err)
+	}
+	if d, errO := os.Open(dir); errO == nil {
+		_ = d.Sync() // persist the rename, not supported on all systems
+		_ = d.Close()
+	}
+	return nil
+}
+
+// CheckpointDB stores the checkpoint in a database table, identified by a
+// name. Multiple Canals can share the same table with different names. The
+// table must be created with function CreateTable.
+//
+// Exactly-once processing can be achieved when an event handler writes into
+// the same database: the handler calls SaveCheckpointTx with the position of
+// the context in its own transaction during function Complete. The data and
+// the checkpoint get then committed together.
+//		func (h *myHandler) Complete(ctx context.Context) error {
+//			pos, _ := binlogsync.PositionFromContext(ctx)
+//			return h.dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+//				// ... write the collected rows
+//				return h.checkpoint.SaveCheckpointTx(ctx, tx, pos)
+//			})
+//		}
+type CheckpointDB struct {
+	db *dml.ConnPool
+	// Table defaults to `binlogsync_checkpoint`.
+	Table string
+	// Name identifies the Canal.
+	Name string
+}
+
+// NewCheckpointDB creates a new database checkpoint store with the default
+// table name.
+func NewCheckpointDB(db *dml.ConnPool, name string) *CheckpointDB {
+	return &CheckpointDB{
+		db:    db,
+		Table: "binlogsync_checkpoint",
+		Name:  name,
+	}
+}
+
+// CreateTable creates the checkpoint table if it does not exists.
+func (cd *CheckpointDB) CreateTable(ctx context.Context) error {
+	_, err := cd.db.DB.ExecContext(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n"+
+		"  `name` varchar(64) NOT NULL,\n"+
+		"  `file` varchar(255) NOT NULL,\n"+
+		"  `position` bigint(20) unsigned NOT NULL,\n"+
+		"  `gtid_set` text NOT NULL,\n"+
+		"  `updated_at` timestamp NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,\n"+
+		"  PRIMARY KEY (`name`)\n"+
+		") ENGINE=InnoDB DEFAULT CHARSET=utf8mb4", dml.Quoter.Name(cd.Table)))
+	return errors.WithStack(err)
+}
+
+// LoadCheckpoint reads the checkpoint from the table.
+func (cd *CheckpointDB) LoadCheckpoint(ctx context.Context) (ms ddl.MasterStatus, err error) {
+	rowCount, err := dml.NewSelect().AddColumnsAliases("file", "File", "position", "Position", "gtid_set", "Executed_Gtid_Set").
+		From(cd.Table).Where(dml.Column("name").PlaceHolder()).
+		WithDB(cd.db.DB).WithArgs().String(cd.Name).Load(ctx, &ms)
+	if err != nil {
+		return ms, errors.WithStack(err)
+	}
+	if rowCount == 0 {
+		return ms, errors.NotFound.Newf("[binlogsync] CheckpointDB: No checkpoint found for name %q in table %q", cd.Name, cd.Table)
+	}
+	return ms, nil
+}
+
+// SaveCheckpoint writes the checkpoint into the table.
+func (cd *CheckpointDB) SaveCheckpoint(ctx context.Context, ms ddl.MasterStatus) error {
+	return cd.save(ctx, cd.db.DB, ms)
+}
+
+// SaveCheckpointTx writes the checkpoint within the transaction `tx`.
+func (cd *CheckpointDB) SaveCheckpointTx(ctx context.Context, tx *dml.Tx, ms ddl.MasterStatus) error {
+	return cd.save(ctx, tx.DB, ms)
+}
+
+func (cd *CheckpointDB) save(ctx context.Context, db dml.QueryExecPreparer, ms ddl.MasterStatus) error {
+	_, err := dml.NewInsert(cd.Table).AddColumns("name", "file", "position", "gtid_set").BuildValues().
+		OnDuplicateKey().AddOnDuplicateKeyExclude("name").
+		WithDB(db).WithArgs().String(cd.Name).String(ms.File).Uint(ms.Position).String(ms.ExecutedGTIDSet).
+		ExecContext(ctx)
+	return errors.Wrapf(err, "[binlogsync] CheckpointDB: Failed to save %q with position %s", cd.Name, ms)
+}
+
+// IdempotencyKey returns a unique key for a row of the currently processed
+// rows event. The context must be the one passed to RowsEventHandler.Do. The
+// argument `row` is the index of the row, for updates the index of the pair of
+// rows. With GTIDs the key contains the global transaction identifier and is
+// stable across a fail over to another server, otherwise the key contains
+// the file name and the position of the binary log. Returns false if the
+// context does not contain the required information.
+func IdempotencyKey(ctx context.Context, row int) (string, bool) {
+	ep, ok := ctx.Value(ctxKeyPosition{}).(eventPosition)
+	if !ok {
+		return "", false
+	}
+	if ep.gtid != "" {
+		return ep.gtid + ";" + strconv.Itoa(ep.event) + ";" + strconv.Itoa(row), true
+	}
+	return ep.ms.String() + ";" + strconv.Itoa(row), true
+}
@@ -0,0 +1,97 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/config"
+	"github.com/corestoreio/pkg/config/storage"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func testCheckpointStore(t *testing.T, cs binlogsync.CheckpointStore) {
+	ctx := context.TODO()
+	_, err := cs.LoadCheckpoint(ctx)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+
+	want := ddl.MasterStatus{File: "mysql-bin.000004", Position: 545460}
+	assert.NoError(t, cs.SaveCheckpoint(ctx, want))
+	have, err := cs.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, want, have)
+
+	want = ddl.MasterStatus{File: "mysql-bin.000005", Position: 4, ExecutedGTIDSet: "0-1-42"}
+	assert.NoError(t, cs.SaveCheckpoint(ctx, want))
+	have, err = cs.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, want, have)
+}
+
+func TestCheckpointFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogsync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	testCheckpointStore(t, binlogsync.NewCheckpointFile(filepath.Join(dir, "checkpoint")))
+
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1, "Temporary files must be renamed")
+}
+
+func TestCheckpointConfig(t *testing.T) {
+	m := storage.NewMap()
+	testCheckpointStore(t, binlogsync.NewCheckpointConfig(config.NewFakeService(m).Scoped(1, 1), m))
+}
+
+func TestCheckpointDB(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	cd := binlogsync.NewCheckpointDB(dbc, "search_index")
+	ctx := context.TODO()
+
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE IF NOT EXISTS `binlogsync_checkpoint`")).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	assert.NoError(t, cd.CreateTable(ctx))
+
+	const selectSQL = "SELECT `file` AS `File`, `position` AS `Position`, `gtid_set` AS `Executed_Gtid_Set` FROM `binlogsync_checkpoint` WHERE (`name` = ?)"
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(selectSQL)).WithArgs("search_index").
+		WillReturnRows(sqlmock.NewRows([]string{"File", "Position", "Executed_Gtid_Set"}))
+	_, err := cd.LoadCheckpoint(ctx)
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `binlogsync_checkpoint` (`name`,`file`,`position`,`gtid_set`) VALUES (?,?,?,?) ON DUPLICATE KEY UPDATE `file`=VALUES(`file`), `position`=VALUES(`position`), `gtid_set`=VALUES(`gtid_set`)")).
+		WithArgs("search_index", "mysql-bin.000004", 545460, "0-1-42").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	want := ddl.MasterStatus{File: "mysql-bin.000004", Position: 545460, ExecutedGTIDSet: "0-1-42"}
+	assert.NoError(t, cd.SaveCheckpoint(ctx, want))
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(selectSQL)).WithArgs("search_index").
+		WillReturnRows(sqlmock.NewRows([]string{"File", "Position", "Executed_Gtid_Set"}).AddRow("mysql-bin.000004", 545460, "0-1-42"))
+	have, err := cd.LoadCheckpoint(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, want, have)
+}
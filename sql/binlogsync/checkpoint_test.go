@@ -0,0 +1,140 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/util/assert"
+	"github.com/go-sql-driver/mysql"
+)
+
+type checkpointRecorder struct {
+	saved []ddl.MasterStatus
+}
+
+func (cr *checkpointRecorder) LoadCheckpoint(_ context.Context) (ddl.MasterStatus, error) {
+	return ddl.MasterStatus{}, errors.NotFound.Newf("not found")
+}
+
+func (cr *checkpointRecorder) SaveCheckpoint(_ context.Context, ms ddl.MasterStatus) error {
+	cr.saved = append(cr.saved, ms)
+	return nil
+}
+
+type completeRecorder struct {
+	err       error
+	completed []ddl.MasterStatus
+}
+
+func (cr *completeRecorder) Do(_ context.Context, _ string, _ *ddl.Table, _ [][]interface{}) error {
+	return nil
+}
+
+func (cr *completeRecorder) Complete(ctx context.Context) error {
+	pos, _ := PositionFromContext(ctx)
+	cr.completed = append(cr.completed, pos)
+	return cr.err
+}
+
+func (cr *completeRecorder) String() string { return "completeRecorder" }
+
+func TestCanal_Checkpoint(t *testing.T) {
+	pos := func(p uint) ddl.MasterStatus { return ddl.MasterStatus{File: "mysql-bin.000001", Position: p} }
+
+	t.Run("batch of transactions", func(t *testing.T) {
+		cs := new(checkpointRecorder)
+		h := new(completeRecorder)
+		c := &Canal{
+			opts:            Options{Log: log.BlackHole{}, CheckpointTransactions: 2},
+			dsn:             &mysql.Config{},
+			checkpointStore: cs,
+		}
+		c.RegisterRowsEventHandler("", h)
+		ctx := context.TODO()
+
+		assert.NoError(t, c.checkpoint(ctx, pos(10), false))
+		assert.Len(t, cs.saved, 0)
+		assert.Exactly(t, ddl.MasterStatus{}, c.SyncedPosition(), "handlers not yet completed")
+		assert.NoError(t, c.checkpoint(ctx, pos(20), false))
+		assert.Exactly(t, []ddl.MasterStatus{pos(20)}, cs.saved)
+		assert.Exactly(t, []ddl.MasterStatus{pos(20)}, h.completed)
+		assert.Exactly(t, pos(20), c.SyncedPosition())
+		assert.NoError(t, c.checkpoint(ctx, pos(30), true))
+		assert.Exactly(t, []ddl.MasterStatus{pos(20), pos(30)}, cs.saved)
+
+		// idle stream completes the pending transaction
+		assert.NoError(t, c.checkpoint(ctx, pos(40), false))
+		assert.Exactly(t, pos(30), c.SyncedPosition())
+		assert.NoError(t, c.completeCheckpoint(ctx, time.Now()))
+		assert.Exactly(t, []ddl.MasterStatus{pos(20), pos(30), pos(40)}, cs.saved)
+		assert.Exactly(t, pos(40), c.SyncedPosition())
+		assert.Exactly(t, 0, c.checkpointPending)
+	})
+
+	t.Run("failed handler skips checkpoint", func(t *testing.T) {
+		cs := new(checkpointRecorder)
+		h := &completeRecorder{err: errors.NotValid.Newf("index unavailable")}
+		c := &Canal{
+			opts:            Options{Log: log.BlackHole{}, CheckpointTransactions: 1},
+			dsn:             &mysql.Config{},
+			checkpointStore: cs,
+		}
+		c.RegisterRowsEventHandler("catalog_product_entity", h)
+		ctx := context.TODO()
+
+		assert.NoError(t, c.checkpoint(ctx, pos(10), false))
+		assert.Len(t, cs.saved, 0)
+		assert.Exactly(t, 1, c.checkpointPending)
+		assert.Exactly(t, ddl.MasterStatus{}, c.SyncedPosition(), "failed handler must not advance the position")
+
+		h.err = errors.Interrupted.Newf("shutdown")
+		err := c.checkpoint(ctx, pos(20), false)
+		assert.True(t, errors.Interrupted.Match(err), "%+v", err)
+		assert.Len(t, cs.saved, 0)
+
+		h.err = nil
+		assert.NoError(t, c.checkpoint(ctx, pos(30), false))
+		assert.Exactly(t, []ddl.MasterStatus{pos(30)}, cs.saved)
+		assert.Exactly(t, pos(30), c.SyncedPosition())
+		assert.Exactly(t, 0, c.checkpointPending)
+	})
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	_, ok := IdempotencyKey(context.TODO(), 0)
+	assert.False(t, ok)
+
+	ms := ddl.MasterStatus{File: "mysql-bin.000001", Position: 4711}
+	key, ok := IdempotencyKey(withPosition(context.TODO(), eventPosition{ms: ms, event: 1}), 3)
+	assert.True(t, ok)
+	assert.Exactly(t, "mysql-bin.000001;4711;3", key)
+
+	key, ok = IdempotencyKey(withPosition(context.TODO(), eventPosition{ms: ms, gtid: "0-1-42", event: 2}), 3)
+	assert.True(t, ok)
+	assert.Exactly(t, "0-1-42;2;3", key)
+}
+
+func TestIsBeginStmt(t *testing.T) {
+	assert.True(t, isBeginStmt([]byte("BEGIN")))
+	assert.True(t, isBeginStmt([]byte(" begin ")))
+	assert.False(t, isBeginStmt([]byte("COMMIT")))
+	assert.False(t, isBeginStmt([]byte("ALTER TABLE `a` ADD COLUMN `b` int")))
+}
@@ -14,4 +14,18 @@
 
 // Package binlogsync adds event listener to a MySQL compatible binlog, based on
 // pkg myreplicator.
+//
+// Delivery guarantees
+//
+// The Canal delivers the events at-least-once. After each committed
+// transaction, or after a batch of transactions configured via
+// Options.CheckpointTransactions and Options.CheckpointInterval, the Canal
+// calls function Complete of all RowsEventHandler and saves afterwards the
+// position in the CheckpointStore. If a handler fails, no checkpoint gets
+// written. After a restart the Canal continues from the last checkpoint,
+// either via file name and position or, with Options.UseGTID, via the executed
+// GTID set. Events after the checkpoint get delivered again, so handlers must
+// be idempotent. The function IdempotencyKey returns a stable key per row for
+// deduplication. Exactly-once processing requires that a handler stores its
+// data and the checkpoint in the same transaction, see CheckpointDB.
 package binlogsync
@@ -0,0 +1,328 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/storage/null"
+)
+
+var (
+	_ RowsEventHandler    = (*EntityEventHandler)(nil)
+	_ SchemaChangeHandler = (*EntityEventHandler)(nil)
+)
+
+// Inserted gets emitted for each new row of a table.
+type Inserted struct {
+	Position ddl.MasterStatus
+	// IdempotencyKey identifies the row, see function IdempotencyKey.
+	IdempotencyKey string
+	// PrimaryKey contains the values of the primary key columns.
+	PrimaryKey []interface{}
+	Table      *ddl.Table
+	Entity     dml.ColumnMapper
+}
+
+// Updated gets emitted for each changed row of a table. Old contains the
+// before image and New the after image of the row.
+type Updated struct {
+	Position ddl.MasterStatus
+	// IdempotencyKey identifies the row, see function IdempotencyKey.
+	IdempotencyKey string
+	// PrimaryKey contains the values of the primary key columns of the after
+	// image.
+	PrimaryKey []interface{}
+	Table      *ddl.Table
+	Old        dml.ColumnMapper
+	New        dml.ColumnMapper
+}
+
+// Deleted gets emitted for each removed row of a table.
+type Deleted struct {
+	Position ddl.MasterStatus
+	// IdempotencyKey identifies the row, see function IdempotencyKey.
+	IdempotencyKey string
+	// PrimaryKey contains the values of the primary key columns.
+	PrimaryKey []interface{}
+	Table      *ddl.Table
+	Entity     dml.ColumnMapper
+}
+
+// EntityHandler receives the typed change data capture events of the
+// EntityEventHandler. The entities are of the type created by the registered
+// factory function of the table and can be type asserted, for example to the
+// structs generated by package dmlgen. Errors follow the same rules as for
+// RowsEventHandler.Do. If an EntityHandler implements additionally the
+// function `Complete(context.Context) error` of the RowsEventHandler, it gets
+// called before a checkpoint.
+type EntityHandler interface {
+	Inserted(context.Context, Inserted) error
+	Updated(context.Context, Updated) error
+	Deleted(context.Context, Deleted) error
+}
+
+// EntityEventHandler decodes the rows of the binary log into entities, for
+// example the structs generated by package dmlgen, and dispatches typed
+// events to an EntityHandler. The rows get decoded via the function
+// MapColumns of the dml.ColumnMapper interface, so the entity must support the
+// mode dml.ColumnMapScan. Rows of tables without a registered factory function
+// get ignored.
+//		eeh := binlogsync.NewEntityEventHandler("customer CDC", myHandler).
+//			Register("customer_entity", func() dml.ColumnMapper { return new(customer.CustomerEntity) })
+//		canal.RegisterRowsEventHandler("customer_entity", eeh)
+// The handler keeps the column names of a table until the canal reports a
+// schema change of that table.
+type EntityEventHandler struct {
+	name string
+	eh   EntityHandler
+
+	mu        sync.RWMutex
+	factories map[string]func() dml.ColumnMapper
+	columns   map[string][]string
+}
+
+// NewEntityEventHandler creates a new RowsEventHandler which dispatches the
+// decoded entities to `eh`.
+func NewEntityEventHandler(name string, eh EntityHandler) *EntityEventHandler {
+	return &EntityEventHandler{
+		name:      name,
+		eh:        eh,
+		factories: make(map[string]func() dml.ColumnMapper),
+		columns:   make(map[string][]string),
+	}
+}
+
+// Register adds a factory function for a table which creates a new empty
+// entity for each decoded row. Register is not thread safe while the canal
+// runs.
+func (ee *EntityEventHandler) Register(tableName string, newEntity func() dml.ColumnMapper) *EntityEventHandler {
+	ee.mu.Lock()
+	defer ee.mu.Unlock()
+	ee.factories[tableName] = newEntity
+	return ee
+}
+
+// Do decodes the rows and calls the EntityHandler for each row, or for each
+// pair of rows in case of an update. The binary log position gets read from
+// the context.
+func (ee *EntityEventHandler) Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	if t == nil {
+		return nil
+	}
+	ee.mu.RLock()
+	newEntity, ok := ee.factories[t.Name]
+	ee.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	pos, _ := PositionFromContext(ctx)
+	cols := ee.fieldNames(t)
+	cm := dml.NewColumnMap(0)
+	decode := func(row []interface{}) (dml.ColumnMapper, error) {
+		if len(row) != len(t.Columns) {
+			return nil, errors.Mismatch.Newf("[binlogsync] EntityEventHandler: Table %q has %d columns but the row contains %d values", t.Name, len(t.Columns), len(row))
+		}
+		values := make([]interface{}, len(row))
+		for i, v := range row {
+			values[i] = ColumnValue(t.Columns[i], v)
+		}
+		if err := cm.ScanValues(cols, values); err != nil {
+			return nil, errors.Wrapf(err, "[binlogsync] EntityEventHandler: Table %q", t.Name)
+		}
+		e := newEntity()
+		if err := e.MapColumns(cm); err != nil {
+			return nil, errors.Wrapf(err, "[binlogsync] EntityEventHandler: Table %q", t.Name)
+		}
+		return e, nil
+	}
+	primaryKey := func(row []interface{}) []interface{} {
+		var pk []interface{}
+		for i, c := range t.Columns {
+			if c.IsPK() {
+				pk = append(pk, ColumnValue(c, row[i]))
+			}
+		}
+		return pk
+	}
+
+	switch action {
+	case InsertAction, DeleteAction:
+		for i, row := range rows {
+			e, err := decode(row)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			key, _ := IdempotencyKey(ctx, i)
+			if action == InsertAction {
+				err = ee.eh.Inserted(ctx, Inserted{Position: pos, IdempotencyKey: key, PrimaryKey: primaryKey(row), Table: t, Entity: e})
+			} else {
+				err = ee.eh.Deleted(ctx, Deleted{Position: pos, IdempotencyKey: key, PrimaryKey: primaryKey(row), Table: t, Entity: e})
+			}
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case UpdateAction:
+		if len(rows)%2 != 0 {
+			return errors.NotSupported.Newf("[binlogsync] EntityEventHandler: Table %q update event contains an odd number of rows: %d", t.Name, len(rows))
+		}
+		for i := 0; i < len(rows); i += 2 {
+			old, err := decode(rows[i])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			nw, err := decode(rows[i+1])
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			key, _ := IdempotencyKey(ctx, i/2)
+			if err := ee.eh.Updated(ctx, Updated{Position: pos, IdempotencyKey: key, PrimaryKey: primaryKey(rows[i+1]), Table: t, Old: old, New: nw}); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	default:
+		return errors.NotSupported.Newf("[binlogsync] EntityEventHandler: Action %q not supported", action)
+	}
+	return nil
+}
+
+func (ee *EntityEventHandler) fieldNames(t *ddl.Table) []string {
+	ee.mu.RLock()
+	cols, ok := ee.columns[t.Name]
+	ee.mu.RUnlock()
+	if ok && len(cols) == len(t.Columns) {
+		return cols
+	}
+	cols = t.Columns.FieldNames()
+	ee.mu.Lock()
+	ee.columns[t.Name] = cols
+	ee.mu.Unlock()
+	return cols
+}
+
+// SchemaChanged removes the cached column names of the table.
+func (ee *EntityEventHandler) SchemaChanged(_ context.Context, _, table string) error {
+	ee.mu.Lock()
+	delete(ee.columns, table)
+	ee.mu.Unlock()
+	return nil
+}
+
+// Complete calls function Complete of the EntityHandler, if implemented.
+func (ee *EntityEventHandler) Complete(ctx context.Context) error {
+	if c, ok := ee.eh.(interface {
+		Complete(context.Context) error
+	}); ok {
+		return errors.WithStack(c.Complete(ctx))
+	}
+	return nil
+}
+
+// String returns the name of the handler.
+func (ee *EntityEventHandler) String() string { return ee.name }
+
+// ColumnValue converts a value decoded from the binary log into a type
+// supported by dml.ColumnMap. The binary log stores unsigned integers as
+// signed values and ENUM and SET columns as their index or bit mask. An
+// unsigned BIGINT gets returned as int64 with the same bits, hence values
+// above math.MaxInt64 are negative. dml.ColumnMap.Uint64 restores the
+// original value, a SQL argument must be converted to uint64 by the caller.
+func ColumnValue(c *ddl.Column, v interface{}) interface{} {
+	switch val := v.(type) {
+	case int8:
+		if c.IsUnsigned() {
+			return int64(uint8(val))
+		}
+		return int64(val)
+	case int16:
+		if c.IsUnsigned() {
+			return int64(uint16(val))
+		}
+		return int64(val)
+	case int32:
+		switch {
+		case c.IsUnsigned() && c.DataType == "mediumint":
+			return int64(uint32(val) & 0xFFFFFF)
+		case c.IsUnsigned():
+			return int64(uint32(val))
+		}
+		return int64(val)
+	case int64:
+		switch c.DataType {
+		case "enum":
+			if opts := enumOptions(c.ColumnType); val > 0 && int(val) <= len(opts) {
+				return []byte(opts[val-1])
+			}
+			return []byte{}
+		case "set":
+			var buf []byte
+			for i, o := range enumOptions(c.ColumnType) {
+				if val&(1<<uint(i)) != 0 {
+					if len(buf) > 0 {
+						buf = append(buf, ',')
+					}
+					buf = append(buf, o...)
+				}
+			}
+			return buf
+		}
+		return val
+	case string:
+		return []byte(val)
+	case null.Decimal:
+		if !val.Valid {
+			return nil
+		}
+		return []byte(val.String())
+	}
+	return v
+}
+
+// enumOptions extracts the quoted values of a column type like
+// `enum('a','b')` or `set('a','b')`.
+func enumOptions(columnType string) []string {
+	start := strings.IndexByte(columnType, '(')
+	end := strings.LastIndexByte(columnType, ')')
+	if start < 0 || end <= start {
+		return nil
+	}
+	var opts []string
+	var buf strings.Builder
+	in := false
+	s := columnType[start+1 : end]
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\'' && in && i+1 < len(s) && s[i+1] == '\'':
+			buf.WriteByte('\'')
+			i++
+		case s[i] == '\'':
+			if in {
+				opts = append(opts, buf.String())
+				buf.Reset()
+			}
+			in = !in
+		case in:
+			buf.WriteByte(s[i])
+		}
+	}
+	return opts
+}
@@ -0,0 +1,155 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+type cdcProduct struct {
+	EntityID uint64
+	Status   string
+	Price    null.Decimal
+	Qty      uint16
+}
+
+func (p *cdcProduct) MapColumns(cm *dml.ColumnMap) error {
+	for cm.Next() {
+		switch c := cm.Column(); c {
+		case "entity_id":
+			cm.Uint64(&p.EntityID)
+		case "status":
+			cm.String(&p.Status)
+		case "price":
+			cm.Decimal(&p.Price)
+		case "qty":
+			cm.Uint16(&p.Qty)
+		default:
+			return errors.NotFound.Newf("[binlogsync_test] Column %q not found", c)
+		}
+	}
+	return cm.Err()
+}
+
+type cdcRecorder struct {
+	inserted []binlogsync.Inserted
+	updated  []binlogsync.Updated
+	deleted  []binlogsync.Deleted
+}
+
+func (r *cdcRecorder) Inserted(_ context.Context, e binlogsync.Inserted) error {
+	r.inserted = append(r.inserted, e)
+	return nil
+}
+
+func (r *cdcRecorder) Updated(_ context.Context, e binlogsync.Updated) error {
+	r.updated = append(r.updated, e)
+	return nil
+}
+
+func (r *cdcRecorder) Deleted(_ context.Context, e binlogsync.Deleted) error {
+	r.deleted = append(r.deleted, e)
+	return nil
+}
+
+func newCDCProductTable() *ddl.Table {
+	return ddl.NewTable("catalog_product",
+		&ddl.Column{Field: "entity_id", Pos: 1, DataType: "bigint", ColumnType: "bigint(20) unsigned", Key: "PRI"},
+		&ddl.Column{Field: "status", Pos: 2, DataType: "enum", ColumnType: "enum('enabled','disabled','it''s')"},
+		&ddl.Column{Field: "price", Pos: 3, Null: "YES", DataType: "decimal", ColumnType: "decimal(12,4)"},
+	)
+}
+
+func TestEntityEventHandler(t *testing.T) {
+	rec := new(cdcRecorder)
+	eeh := binlogsync.NewEntityEventHandler("product CDC", rec).
+		Register("catalog_product", func() dml.ColumnMapper { return new(cdcProduct) })
+	assert.Exactly(t, "product CDC", eeh.String())
+
+	tbl := newCDCProductTable()
+	price := null.MakeDecimalInt64(1999, 2)
+
+	t.Run("unregistered table", func(t *testing.T) {
+		err := eeh.Do(context.TODO(), binlogsync.InsertAction, ddl.NewTable("sales_order"), [][]interface{}{{int64(1)}})
+		assert.NoError(t, err)
+		assert.Len(t, rec.inserted, 0)
+	})
+
+	t.Run("insert without position", func(t *testing.T) {
+		err := eeh.Do(context.TODO(), binlogsync.InsertAction, tbl, [][]interface{}{
+			{int64(-1), int64(1), price},
+			{int64(2), int64(3), nil},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, rec.inserted, 2)
+		assert.Exactly(t, ddl.MasterStatus{}, rec.inserted[0].Position)
+		assert.Exactly(t, &cdcProduct{EntityID: 18446744073709551615, Status: "enabled", Price: price}, rec.inserted[0].Entity)
+		assert.Exactly(t, &cdcProduct{EntityID: 2, Status: "it's"}, rec.inserted[1].Entity)
+		assert.Exactly(t, []interface{}{int64(2)}, rec.inserted[1].PrimaryKey)
+	})
+
+	t.Run("update pairs", func(t *testing.T) {
+		err := eeh.Do(context.TODO(), binlogsync.UpdateAction, tbl, [][]interface{}{
+			{int64(2), int64(1), nil},
+			{int64(2), int64(2), price},
+		})
+		assert.NoError(t, err)
+		assert.Len(t, rec.updated, 1)
+		assert.Exactly(t, &cdcProduct{EntityID: 2, Status: "enabled"}, rec.updated[0].Old)
+		assert.Exactly(t, &cdcProduct{EntityID: 2, Status: "disabled", Price: price}, rec.updated[0].New)
+		assert.Exactly(t, []interface{}{int64(2)}, rec.updated[0].PrimaryKey)
+
+		err = eeh.Do(context.TODO(), binlogsync.UpdateAction, tbl, [][]interface{}{{int64(2), int64(1), nil}})
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+
+	t.Run("row does not match table", func(t *testing.T) {
+		err := eeh.Do(context.TODO(), binlogsync.DeleteAction, tbl, [][]interface{}{{int64(2), int64(1)}})
+		assert.True(t, errors.Mismatch.Match(err), "%+v", err)
+		assert.Len(t, rec.deleted, 0)
+	})
+
+	t.Run("schema change", func(t *testing.T) {
+		assert.NoError(t, eeh.SchemaChanged(context.TODO(), "shop", "catalog_product"))
+		tbl := newCDCProductTable()
+		tbl.Columns = append(tbl.Columns, &ddl.Column{Field: "qty", Pos: 4, DataType: "smallint", ColumnType: "smallint(5) unsigned"})
+
+		err := eeh.Do(context.TODO(), binlogsync.DeleteAction, tbl, [][]interface{}{{int64(3), int64(2), nil, int16(-1)}})
+		assert.NoError(t, err)
+		assert.Len(t, rec.deleted, 1)
+		assert.Exactly(t, &cdcProduct{EntityID: 3, Status: "disabled", Qty: 65535}, rec.deleted[0].Entity)
+	})
+}
+
+func TestColumnValue(t *testing.T) {
+	t.Parallel()
+
+	unsignedBigint := &ddl.Column{Field: "entity_id", DataType: "bigint", ColumnType: "bigint(20) unsigned"}
+	assert.Exactly(t, int64(-1), binlogsync.ColumnValue(unsignedBigint, int64(-1)))
+	assert.Exactly(t, int64(42), binlogsync.ColumnValue(unsignedBigint, int64(42)))
+
+	unsignedInt := &ddl.Column{Field: "qty", DataType: "int", ColumnType: "int(10) unsigned"}
+	assert.Exactly(t, int64(4294967295), binlogsync.ColumnValue(unsignedInt, int32(-1)))
+	unsignedMediumint := &ddl.Column{Field: "qty", DataType: "mediumint", ColumnType: "mediumint(8) unsigned"}
+	assert.Exactly(t, int64(16777215), binlogsync.ColumnValue(unsignedMediumint, int32(-1)))
+}
@@ -2,6 +2,7 @@ package binlogsync
 
 import (
 	"context"
+	"sync"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
@@ -25,14 +26,53 @@ type RowsEventHandler interface {
 	// its own Goroutine. The provided argument `t` of type ddl.Table must only
 	// be used for reading, changing `t` causes race conditions.
 	Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error
-	// Complete runs before a binlog rotation event happens. Same error rules
-	// apply here like for function Do(). The Complete function will run in its
-	// own Goroutine.
+	// Complete runs before a checkpoint gets saved, see CheckpointStore, and
+	// before a binlog rotation event happens. A handler should flush or commit
+	// all changes collected in previous calls to Do. The checkpoint gets only
+	// saved when all handlers return no error, otherwise the events get
+	// delivered again after a restart. An error with behaviour "Interrupted"
+	// stops the syncer. The Complete function will run in its own Goroutine.
 	Complete(context.Context) error
 	// String returns the name of the handler
 	String() string
 }
 
+// SchemaChangeHandler can be optionally implemented by a RowsEventHandler to
+// get notified when a DDL statement (CREATE, ALTER, RENAME or DROP TABLE) has
+// changed the structure of a table and the table cache has been cleared. The
+// next call to RowsEventHandler.Do receives the reloaded table. Returning an
+// error with behaviour "Interrupted" stops the syncer, all other errors get
+// logged.
+type SchemaChangeHandler interface {
+	SchemaChanged(ctx context.Context, db, table string) error
+}
+
+type ctxKeyPosition struct{}
+
+// eventPosition identifies the currently processed event.
+type eventPosition struct {
+	ms ddl.MasterStatus
+	// gtid of the current transaction, if GTIDs are enabled.
+	gtid string
+	// event counts the rows events within the current transaction.
+	event int
+}
+
+func withPosition(ctx context.Context, ep eventPosition) context.Context {
+	return context.WithValue(ctx, ctxKeyPosition{}, ep)
+}
+
+// PositionFromContext returns the binary log position of the event which is
+// currently processed. The context gets passed to RowsEventHandler.Do,
+// RowsEventHandler.Complete and SchemaChangeHandler.SchemaChanged. The
+// position points to the start of the next event, like the position saved in
+// the master status. During Complete the position is the checkpoint which
+// gets saved after all handlers have succeeded.
+func PositionFromContext(ctx context.Context) (ddl.MasterStatus, bool) {
+	ep, ok := ctx.Value(ctxKeyPosition{}).(eventPosition)
+	return ep.ms, ok
+}
+
 // RegisterRowsEventHandler adds a new event handler to the internal list. If a
 // table name gets provided the event handler is bound to that exact table name,
 // if the table has not been excluded via the global regexes. An empty tableName
@@ -80,6 +120,33 @@ func (c *Canal) processRowsEventHandler(ctx context.Context, action string, tabl
 	return errors.WithStack(erg.Wait())
 }
 
+func (c *Canal) processSchemaChangeHandler(ctx context.Context, db, table string) error {
+	c.rsMu.RLock()
+	defer c.rsMu.RUnlock()
+
+	process := func(hs []RowsEventHandler) error {
+		for _, h := range hs {
+			sch, ok := h.(SchemaChangeHandler)
+			if !ok {
+				continue
+			}
+			if err := sch.SchemaChanged(ctx, db, table); err != nil {
+				isInterr := errors.Is(err, errors.Interrupted)
+				c.opts.Log.Info("binlogsync.Canal.processSchemaChangeHandler.SchemaChanged.error", log.Err(err), log.Stringer("handler_name", h),
+					log.Bool("is_interrupted", isInterr), log.String("schema", db), log.String("table", table))
+				if isInterr {
+					return errors.WithStack(err)
+				}
+			}
+		}
+		return nil
+	}
+	if err := process(c.rsHandlers[table]); err != nil || table == "" {
+		return err
+	}
+	return process(c.rsHandlers[""])
+}
+
 func (c *Canal) flushEventHandlers(ctx context.Context) error {
 	defer log.WhenDone(c.opts.Log).Info("binlogsync.Canal.flushEventHandlers")
 	c.rsMu.RLock()
@@ -87,9 +154,12 @@ func (c *Canal) flushEventHandlers(ctx context.Context) error {
 
 	erg, ctx := errgroup.WithContext(ctx)
 
+	var failedMu sync.Mutex
+	var failed error
 	for tblName, hs := range c.rsHandlers {
 		for _, h := range hs {
 			h := h
+			tblName := tblName
 			erg.Go(func() error {
 				if err := h.Complete(ctx); err != nil {
 					isInterr := errors.Is(err, errors.Interrupted)
@@ -98,10 +168,18 @@ func (c *Canal) flushEventHandlers(ctx context.Context) error {
 					if isInterr {
 						return errors.WithStack(err)
 					}
+					failedMu.Lock()
+					if failed == nil {
+						failed = errors.Wrapf(err, "[binlogsync] flushEventHandlers handler %q", h)
+					}
+					failedMu.Unlock()
 				}
 				return nil
 			})
 		}
 	}
-	return errors.Wrap(erg.Wait(), "[binlogsync] flushEventHandlers errgroup Wait")
+	if err := erg.Wait(); err != nil {
+		return errors.Wrap(err, "[binlogsync] flushEventHandlers errgroup Wait")
+	}
+	return failed
 }
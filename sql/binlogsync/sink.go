@@ -0,0 +1,426 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+// Header names of a Message.
+const (
+	HeaderAction         = "Binlog-Action"
+	HeaderTable          = "Binlog-Table"
+	HeaderPosition       = "Binlog-Position"
+	HeaderIdempotencyKey = "Binlog-Idempotency-Key"
+	HeaderContentType    = "Content-Type"
+)
+
+var _ EntityHandler = (*SinkHandler)(nil)
+
+// Message contains a serialized row change which gets published to a Sink.
+type Message struct {
+	// Topic has been determined by the routing of the SinkHandler.
+	Topic string
+	// Key contains the table name and the primary key values of the row,
+	// separated by a colon. Using it for partitioning keeps all changes of a
+	// row in order.
+	Key string
+	// Headers contains at least the action, table name, position,
+	// idempotency key and content type.
+	Headers map[string]string
+	Value   []byte
+}
+
+// Sink publishes messages outside of the process. A Sink gets only called
+// from a single goroutine.
+type Sink interface {
+	// Send publishes the messages in the provided order.
+	Send(ctx context.Context, msgs []Message) error
+	// Flush writes all buffered messages durable.
+	Flush(ctx context.Context) error
+	// Close flushes and releases all resources.
+	Close() error
+}
+
+// Change describes the change of a single row. Old is nil for inserts and New
+// is nil for deletes.
+type Change struct {
+	Action         string           `json:"action"`
+	Table          string           `json:"table"`
+	Position       ddl.MasterStatus `json:"-"`
+	IdempotencyKey string           `json:"idempotency_key"`
+	PrimaryKey     []interface{}    `json:"-"`
+	Old            dml.ColumnMapper `json:"old,omitempty"`
+	New            dml.ColumnMapper `json:"new,omitempty"`
+}
+
+// Encoder serializes a Change into the value of a Message.
+type Encoder interface {
+	Encode(*Change) ([]byte, error)
+	ContentType() string
+}
+
+// JSONEncoder encodes the whole Change including the old and new entity as
+// JSON object.
+type JSONEncoder struct{}
+
+// Encode implements Encoder.
+func (JSONEncoder) Encode(c *Change) ([]byte, error) {
+	v, err := json.Marshal(struct {
+		*Change
+		Position string `json:"position"`
+		GTIDSet  string `json:"gtid_set,omitempty"`
+	}{
+		Change:   c,
+		Position: c.Position.String(),
+		GTIDSet:  c.Position.ExecutedGTIDSet,
+	})
+	return v, errors.WithStack(err)
+}
+
+// ContentType returns application/json.
+func (JSONEncoder) ContentType() string { return "application/json" }
+
+// ProtoEncoder encodes the new entity, or the old entity for a delete, with
+// its protocol buffers function Marshal, as generated by package dmlgen. The
+// other fields of the Change are only available in the headers of the
+// Message.
+type ProtoEncoder struct{}
+
+// Encode implements Encoder.
+func (ProtoEncoder) Encode(c *Change) ([]byte, error) {
+	e := c.New
+	if e == nil {
+		e = c.Old
+	}
+	pm, ok := e.(interface {
+		Marshal() ([]byte, error)
+	})
+	if !ok {
+		return nil, errors.NotImplemented.Newf("[binlogsync] ProtoEncoder: Type %T of table %q does not implement function Marshal() ([]byte, error)", e, c.Table)
+	}
+	v, err := pm.Marshal()
+	return v, errors.WithStack(err)
+}
+
+// ContentType returns application/x-protobuf.
+func (ProtoEncoder) ContentType() string { return "application/x-protobuf" }
+
+// SinkOptions configures a SinkHandler.
+type SinkOptions struct {
+	// Encoder defaults to JSONEncoder.
+	Encoder Encoder
+	// Topics maps a table name to a topic. Tables not in the map use the
+	// TopicPrefix plus the table name.
+	Topics      map[string]string
+	TopicPrefix string
+	// QueueSize defines the number of messages which can be queued before
+	// the handler blocks the canal. Defaults to 1024.
+	QueueSize int
+	// BatchSize defines the maximum number of queued messages passed to one
+	// call of Sink.Send. Defaults to 100.
+	BatchSize int
+	// Retries defines how often a failed Send or Flush gets repeated. Defaults
+	// to zero.
+	Retries int
+	// RetryWait defines the duration between two retries. Doubles with each
+	// retry. Defaults to 100ms.
+	RetryWait time.Duration
+	Log       log.Logger
+}
+
+type sinkItem struct {
+	msg Message
+	// done gets set for a flush request.
+	done chan error
+}
+
+// SinkHandler publishes the row changes of an EntityEventHandler to a Sink.
+// The messages get queued and sent in order by a single goroutine, if the
+// queue is full the canal gets blocked until the Sink catches up. Function
+// Complete waits until all queued messages have been sent and the Sink has been
+// flushed, so a checkpoint gets only written after the messages have been
+// published. Once the Sink fails, even after retries, all further calls
+// return an error with behaviour Interrupted to stop the canal. The events
+// get delivered again after a restart. Per-table routing can be configured via
+// SinkOptions.Topics or by registering different SinkHandler per table.
+//		sh := binlogsync.NewSinkHandler(binlogsync.NewFileSink("/var/log/cdc.ndjson", 1<<30), binlogsync.SinkOptions{})
+//		eeh := binlogsync.NewEntityEventHandler("sink", sh).
+//			Register("catalog_product_entity", func() dml.ColumnMapper { return new(catalog.ProductEntity) })
+//		canal.RegisterRowsEventHandler("catalog_product_entity", eeh)
+type SinkHandler struct {
+	sink  Sink
+	opts  SinkOptions
+	queue chan sinkItem
+	// done gets closed by Close to stop the goroutine. The queue never gets
+	// closed because Inserted, Updated, Deleted and Complete might still send
+	// to it.
+	done chan struct{}
+	// stopped gets closed once the goroutine has drained the queue.
+	stopped chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	closed bool
+}
+
+// NewSinkHandler creates a new handler and starts the goroutine which sends
+// the messages to the sink. Function Close must be called to stop it.
+func NewSinkHandler(s Sink, o SinkOptions) *SinkHandler {
+	if o.Encoder == nil {
+		o.Encoder = JSONEncoder{}
+	}
+	if o.QueueSize < 1 {
+		o.QueueSize = 1024
+	}
+	if o.BatchSize < 1 {
+		o.BatchSize = 100
+	}
+	if o.RetryWait == 0 {
+		o.RetryWait = 100 * time.Millisecond
+	}
+	if o.Log == nil {
+		o.Log = log.BlackHole{}
+	}
+	sh := &SinkHandler{
+		sink:    s,
+		opts:    o,
+		queue:   make(chan sinkItem, o.QueueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go sh.run()
+	return sh
+}
+
+// Inserted implements EntityHandler.
+func (sh *SinkHandler) Inserted(ctx context.Context, e Inserted) error {
+	return sh.enqueue(ctx, &Change{Action: InsertAction, Table: e.Table.Name, Position: e.Position, IdempotencyKey: e.IdempotencyKey, PrimaryKey: e.PrimaryKey, New: e.Entity})
+}
+
+// Updated implements EntityHandler.
+func (sh *SinkHandler) Updated(ctx context.Context, e Updated) error {
+	return sh.enqueue(ctx, &Change{Action: UpdateAction, Table: e.Table.Name, Position: e.Position, IdempotencyKey: e.IdempotencyKey, PrimaryKey: e.PrimaryKey, Old: e.Old, New: e.New})
+}
+
+// Deleted implements EntityHandler.
+func (sh *SinkHandler) Deleted(ctx context.Context, e Deleted) error {
+	return sh.enqueue(ctx, &Change{Action: DeleteAction, Table: e.Table.Name, Position: e.Position, IdempotencyKey: e.IdempotencyKey, PrimaryKey: e.PrimaryKey, Old: e.Entity})
+}
+
+func (sh *SinkHandler) topic(table string) string {
+	if t, ok := sh.opts.Topics[table]; ok {
+		return t
+	}
+	return sh.opts.TopicPrefix + table
+}
+
+// messageKey joins the table name and the primary key values with a colon.
+func messageKey(table string, pk []interface{}) string {
+	var buf strings.Builder
+	buf.WriteString(table)
+	for _, v := range pk {
+		buf.WriteByte(':')
+		switch v := v.(type) {
+		case []byte:
+			buf.Write(v)
+		default:
+			fmt.Fprint(&buf, v)
+		}
+	}
+	return buf.String()
+}
+
+func (sh *SinkHandler) lastErr() error {
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if sh.closed {
+		return errSinkHandlerClosed()
+	}
+	return sh.err
+}
+
+func errSinkHandlerClosed() error {
+	return errors.AlreadyClosed.Newf("[binlogsync] SinkHandler already closed")
+}
+
+func (sh *SinkHandler) enqueue(ctx context.Context, c *Change) error {
+	if err := sh.lastErr(); err != nil {
+		return errors.WithStack(err)
+	}
+	v, err := sh.opts.Encoder.Encode(c)
+	if err != nil {
+		return errors.Wrapf(err, "[binlogsync] SinkHandler failed to encode table %q", c.Table)
+	}
+	msg := Message{
+		Topic: sh.topic(c.Table),
+		Key:   messageKey(c.Table, c.PrimaryKey),
+		Headers: map[string]string{
+			HeaderAction:         c.Action,
+			HeaderTable:          c.Table,
+			HeaderPosition:       c.Position.String(),
+			HeaderIdempotencyKey: c.IdempotencyKey,
+			HeaderContentType:    sh.opts.Encoder.ContentType(),
+		},
+		Value: v,
+	}
+	select {
+	case sh.queue <- sinkItem{msg: msg}:
+		return nil
+	case <-sh.done:
+		return errSinkHandlerClosed()
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Complete waits until all queued messages have been sent and flushes the
+// sink.
+func (sh *SinkHandler) Complete(ctx context.Context) error {
+	if err := sh.lastErr(); err != nil {
+		return errors.WithStack(err)
+	}
+	done := make(chan error, 1)
+	select {
+	case sh.queue <- sinkItem{done: done}:
+	case <-sh.done:
+		return errSinkHandlerClosed()
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+	select {
+	case err := <-done:
+		return errors.WithStack(err)
+	case <-sh.stopped:
+		// the flush request might have been processed while draining.
+		select {
+		case err := <-done:
+			return errors.WithStack(err)
+		default:
+			return errSinkHandlerClosed()
+		}
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// Close sends the remaining messages, stops the goroutine and closes the
+// sink. Close must be called after the canal has been closed.
+func (sh *SinkHandler) Close() error {
+	sh.mu.Lock()
+	if sh.closed {
+		sh.mu.Unlock()
+		return nil
+	}
+	sh.closed = true
+	sh.mu.Unlock()
+
+	close(sh.done)
+	<-sh.stopped
+	if err := sh.sink.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	return sh.err
+}
+
+func (sh *SinkHandler) run() {
+	defer close(sh.stopped)
+	ctx := context.Background()
+	batch := make([]Message, 0, sh.opts.BatchSize)
+
+	send := func() {
+		if len(batch) == 0 {
+			return
+		}
+		sh.retry(func() error { return sh.sink.Send(ctx, batch) })
+		batch = batch[:0]
+	}
+	process := func(item sinkItem) {
+		if item.done == nil {
+			batch = append(batch, item.msg)
+			return
+		}
+		send()
+		sh.retry(func() error { return sh.sink.Flush(ctx) })
+		sh.mu.Lock()
+		item.done <- sh.err
+		sh.mu.Unlock()
+	}
+
+	for {
+		select {
+		case item := <-sh.queue:
+			process(item)
+			// collect further queued messages without blocking
+			for len(batch) > 0 && len(batch) < sh.opts.BatchSize && len(sh.queue) > 0 {
+				process(<-sh.queue)
+			}
+			send()
+		case <-sh.done:
+			// drain the messages queued before Close has been called.
+			for {
+				select {
+				case item := <-sh.queue:
+					process(item)
+					if len(batch) >= sh.opts.BatchSize {
+						send()
+					}
+				default:
+					send()
+					return
+				}
+			}
+		}
+	}
+}
+
+// retry executes fn until it succeeds or the retries are exhausted. A final
+// failure gets stored and stops all further processing.
+func (sh *SinkHandler) retry(fn func() error) {
+	sh.mu.Lock()
+	failed := sh.err != nil
+	sh.mu.Unlock()
+	if failed {
+		return // drop all messages, they get delivered again after a restart.
+	}
+
+	wait := sh.opts.RetryWait
+	var err error
+	for i := 0; i <= sh.opts.Retries; i++ {
+		if err = fn(); err == nil {
+			return
+		}
+		sh.opts.Log.Info("binlogsync.SinkHandler.retry.error", log.Err(err), log.Int("attempt", i+1))
+		if i < sh.opts.Retries {
+			time.Sleep(wait)
+			wait *= 2
+		}
+	}
+	sh.mu.Lock()
+	sh.err = errors.Interrupted.New(err, "[binlogsync] SinkHandler failed after %d retries", sh.opts.Retries)
+	sh.mu.Unlock()
+}
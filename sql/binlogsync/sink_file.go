@@ -0,0 +1,158 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/corestoreio/errors"
+)
+
+var _ Sink = (*FileSink)(nil)
+
+// FileSink writes each message as a line of JSON into a file. The value of the
+// message gets embedded as JSON if it is valid JSON, otherwise it gets base64
+// encoded. The file gets rotated once it exceeds MaxSize. A rotated file gets
+// renamed to the path plus a timestamp suffix. If that name already exists a
+// counter gets appended, e.g. cdc.ndjson.20180102T150405.000000000-2.
+type FileSink struct {
+	// Path to the current file.
+	Path string
+	// MaxSize in bytes, zero disables rotation.
+	MaxSize int64
+	// FileMode defaults to 0644.
+	FileMode os.FileMode
+	// now can be set for testing.
+	now func() time.Time
+
+	f    *os.File
+	w    *bufio.Writer
+	size int64
+}
+
+// NewFileSink creates a new line delimited JSON file sink. The file gets
+// opened with the first message.
+func NewFileSink(path string, maxSize int64) *FileSink {
+	return &FileSink{
+		Path:     path,
+		MaxSize:  maxSize,
+		FileMode: 0644,
+		now:      time.Now,
+	}
+}
+
+type fileSinkLine struct {
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Value   json.RawMessage   `json:"value,omitempty"`
+	Base64  []byte            `json:"value_base64,omitempty"`
+}
+
+func (fs *FileSink) open() error {
+	f, err := os.OpenFile(fs.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, fs.FileMode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return errors.WithStack(err)
+	}
+	fs.f = f
+	fs.w = bufio.NewWriter(f)
+	fs.size = fi.Size()
+	return nil
+}
+
+func (fs *FileSink) rotate() error {
+	if err := fs.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	base := fs.Path + "." + fs.now().UTC().Format("20060102T150405.000000000")
+	target := base
+	for i := 1; ; i++ {
+		if _, err := os.Stat(target); os.IsNotExist(err) {
+			break
+		}
+		target = base + "-" + strconv.Itoa(i)
+	}
+	if err := os.Rename(fs.Path, target); err != nil {
+		return errors.WithStack(err)
+	}
+	return fs.open()
+}
+
+// Send appends the messages to the file and rotates it if necessary.
+func (fs *FileSink) Send(_ context.Context, msgs []Message) error {
+	if fs.f == nil {
+		if err := fs.open(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for _, m := range msgs {
+		l := fileSinkLine{Topic: m.Topic, Key: m.Key, Headers: m.Headers}
+		if json.Valid(m.Value) {
+			l.Value = m.Value
+		} else {
+			l.Base64 = m.Value
+		}
+		data, err := json.Marshal(l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		data = append(data, '\n')
+		if fs.MaxSize > 0 && fs.size > 0 && fs.size+int64(len(data)) > fs.MaxSize {
+			if err := fs.rotate(); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		n, err := fs.w.Write(data)
+		fs.size += int64(n)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffer to disk and syncs the file.
+func (fs *FileSink) Flush(_ context.Context) error {
+	if fs.f == nil {
+		return nil
+	}
+	if err := fs.w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(fs.f.Sync())
+}
+
+// Close flushes and closes the file.
+func (fs *FileSink) Close() error {
+	if fs.f == nil {
+		return nil
+	}
+	if err := fs.Flush(context.Background()); err != nil {
+		return errors.WithStack(err)
+	}
+	err := fs.f.Close()
+	fs.f, fs.w = nil, nil
+	return errors.WithStack(err)
+}
@@ -0,0 +1,54 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestFileSink_RotateCollision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogsync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := NewFileSink(filepath.Join(dir, "cdc.ndjson"), 10)
+	now := time.Date(2018, 1, 2, 15, 4, 5, 0, time.UTC)
+	fs.now = func() time.Time { return now }
+
+	ctx := context.TODO()
+	for i := 0; i < 4; i++ {
+		assert.NoError(t, fs.Send(ctx, []Message{{Topic: "a", Value: []byte(`{"id":1}`)}}))
+	}
+	assert.NoError(t, fs.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "cdc.ndjson*"))
+	assert.NoError(t, err)
+	for i, fn := range files {
+		files[i] = filepath.Base(fn)
+	}
+	assert.Exactly(t, []string{
+		"cdc.ndjson",
+		"cdc.ndjson.20180102T150405.000000000",
+		"cdc.ndjson.20180102T150405.000000000-1",
+		"cdc.ndjson.20180102T150405.000000000-2",
+	}, files)
+}
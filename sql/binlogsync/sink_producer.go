@@ -0,0 +1,69 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+)
+
+var _ Sink = (*ProducerSink)(nil)
+
+// Producer defines the minimal API of a message broker client, for example a
+// Kafka compatible producer or a NATS connection. Implementations wrap the
+// client library of the broker, so this package does not depend on it.
+type Producer interface {
+	// Produce publishes a message to a topic or subject. It may buffer the
+	// message asynchronously.
+	Produce(ctx context.Context, topic string, key []byte, headers map[string]string, value []byte) error
+	// Flush blocks until all buffered messages have been acknowledged by the
+	// broker.
+	Flush(ctx context.Context) error
+	Close() error
+}
+
+// ProducerSink publishes the messages via a Producer. The message key
+// consists of the table name and the primary key values, so a partitioning
+// broker delivers all changes of a row in order. Consumers deduplicate with
+// the header HeaderIdempotencyKey.
+type ProducerSink struct {
+	p Producer
+}
+
+// NewProducerSink creates a new Sink for a message broker producer.
+func NewProducerSink(p Producer) *ProducerSink {
+	return &ProducerSink{p: p}
+}
+
+// Send produces the messages in order.
+func (ps *ProducerSink) Send(ctx context.Context, msgs []Message) error {
+	for _, m := range msgs {
+		if err := ps.p.Produce(ctx, m.Topic, []byte(m.Key), m.Headers, m.Value); err != nil {
+			return errors.Wrapf(err, "[binlogsync] ProducerSink failed to produce to topic %q", m.Topic)
+		}
+	}
+	return nil
+}
+
+// Flush waits for the acknowledgement of the broker.
+func (ps *ProducerSink) Flush(ctx context.Context) error {
+	return errors.WithStack(ps.p.Flush(ctx))
+}
+
+// Close closes the producer.
+func (ps *ProducerSink) Close() error {
+	return errors.WithStack(ps.p.Close())
+}
@@ -0,0 +1,306 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync_test
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/net/signed"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/util/assert"
+	"github.com/corestoreio/pkg/util/hashpool"
+)
+
+// memoryBroker acts as an in-process stand-in for a message broker.
+type memoryBroker struct {
+	mu       sync.Mutex
+	produced []binlogsync.Message
+	flushed  int
+	closed   bool
+	err      error
+	// block blocks Produce until it gets closed.
+	block chan struct{}
+}
+
+func (mb *memoryBroker) Produce(ctx context.Context, topic string, key []byte, headers map[string]string, value []byte) error {
+	if mb.block != nil {
+		select {
+		case <-mb.block:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	if mb.err != nil {
+		return mb.err
+	}
+	mb.produced = append(mb.produced, binlogsync.Message{Topic: topic, Key: string(key), Headers: headers, Value: value})
+	return nil
+}
+
+func (mb *memoryBroker) Flush(_ context.Context) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.flushed++
+	return mb.err
+}
+
+func (mb *memoryBroker) Close() error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	mb.closed = true
+	return nil
+}
+
+func (mb *memoryBroker) messages() []binlogsync.Message {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+	return append([]binlogsync.Message(nil), mb.produced...)
+}
+
+type cdcProtoProduct struct {
+	cdcProduct
+}
+
+func (p *cdcProtoProduct) Marshal() ([]byte, error) {
+	return []byte(p.Status), nil
+}
+
+func newSinkEntityHandler(sh *binlogsync.SinkHandler, newEntity func() dml.ColumnMapper) *binlogsync.EntityEventHandler {
+	return binlogsync.NewEntityEventHandler("sink", sh).Register("catalog_product", newEntity)
+}
+
+func TestSinkHandler_ProducerSink(t *testing.T) {
+	mb := new(memoryBroker)
+	sh := binlogsync.NewSinkHandler(binlogsync.NewProducerSink(mb), binlogsync.SinkOptions{
+		Topics: map[string]string{"catalog_product": "products"},
+	})
+	eeh := newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProduct) })
+	ctx := context.TODO()
+	tbl := newCDCProductTable()
+
+	assert.NoError(t, eeh.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{{int64(1), int64(1), nil}}))
+	assert.NoError(t, eeh.Do(ctx, binlogsync.UpdateAction, tbl, [][]interface{}{{int64(1), int64(1), nil}, {int64(1), int64(2), nil}}))
+	assert.NoError(t, eeh.Do(ctx, binlogsync.DeleteAction, tbl, [][]interface{}{{int64(1), int64(2), nil}}))
+	assert.NoError(t, eeh.Complete(ctx))
+
+	msgs := mb.messages()
+	assert.Len(t, msgs, 3)
+	assert.Exactly(t, 1, mb.flushed)
+	for _, m := range msgs {
+		assert.Exactly(t, "products", m.Topic)
+		assert.Exactly(t, "catalog_product:1", m.Key, "all changes of a row must share the message key")
+		assert.Exactly(t, "catalog_product", m.Headers[binlogsync.HeaderTable])
+		assert.Exactly(t, "application/json", m.Headers[binlogsync.HeaderContentType])
+	}
+	assert.Exactly(t, binlogsync.InsertAction, msgs[0].Headers[binlogsync.HeaderAction])
+	assert.Exactly(t, binlogsync.DeleteAction, msgs[2].Headers[binlogsync.HeaderAction])
+	assert.Exactly(t,
+		`{"action":"update","table":"catalog_product","idempotency_key":"","old":{"EntityID":1,"Status":"enabled","Price":null,"Qty":0},"new":{"EntityID":1,"Status":"disabled","Price":null,"Qty":0},"position":""}`,
+		string(msgs[1].Value))
+
+	assert.NoError(t, sh.Close())
+	assert.True(t, mb.closed)
+	err := eeh.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{{int64(1), int64(1), nil}})
+	assert.True(t, errors.AlreadyClosed.Match(err), "%+v", err)
+}
+
+func TestSinkHandler_ProtoEncoder(t *testing.T) {
+	mb := new(memoryBroker)
+	sh := binlogsync.NewSinkHandler(binlogsync.NewProducerSink(mb), binlogsync.SinkOptions{
+		Encoder:     binlogsync.ProtoEncoder{},
+		TopicPrefix: "cdc.",
+	})
+	defer func() { assert.NoError(t, sh.Close()) }()
+	ctx := context.TODO()
+	tbl := newCDCProductTable()
+
+	eeh := newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProtoProduct) })
+	assert.NoError(t, eeh.Do(ctx, binlogsync.DeleteAction, tbl, [][]interface{}{{int64(1), int64(2), nil}}))
+	assert.NoError(t, eeh.Complete(ctx))
+	msgs := mb.messages()
+	assert.Len(t, msgs, 1)
+	assert.Exactly(t, "cdc.catalog_product", msgs[0].Topic)
+	assert.Exactly(t, "application/x-protobuf", msgs[0].Headers[binlogsync.HeaderContentType])
+	assert.Exactly(t, "disabled", string(msgs[0].Value))
+
+	eeh = newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProduct) })
+	err := eeh.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{{int64(1), int64(1), nil}})
+	assert.True(t, errors.NotImplemented.Match(err), "%+v", err)
+}
+
+func TestSinkHandler_BackPressure(t *testing.T) {
+	mb := &memoryBroker{block: make(chan struct{})}
+	sh := binlogsync.NewSinkHandler(binlogsync.NewProducerSink(mb), binlogsync.SinkOptions{QueueSize: 1})
+	eeh := newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProduct) })
+	tbl := newCDCProductTable()
+	row := [][]interface{}{{int64(1), int64(1), nil}}
+
+	// The goroutine blocks in the sink, so after the queue has been filled
+	// the next call must block until the context gets cancelled.
+	var sent int
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		if err = eeh.Do(ctx, binlogsync.InsertAction, tbl, row); err == nil {
+			sent++
+		}
+		cancel()
+	}
+	assert.Exactly(t, context.DeadlineExceeded, errors.Cause(err))
+	assert.True(t, sent >= 1 && sent <= 3, "sent %d messages", sent)
+
+	close(mb.block)
+	assert.NoError(t, eeh.Complete(context.TODO()))
+	assert.Len(t, mb.messages(), sent)
+	assert.NoError(t, sh.Close())
+}
+
+func TestSinkHandler_CloseWhileSending(t *testing.T) {
+	mb := &memoryBroker{block: make(chan struct{})}
+	sh := binlogsync.NewSinkHandler(binlogsync.NewProducerSink(mb), binlogsync.SinkOptions{QueueSize: 1})
+	eeh := newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProduct) })
+	tbl := newCDCProductTable()
+	row := [][]interface{}{{int64(1), int64(1), nil}}
+
+	// The senders block on the full queue while Close gets called and must
+	// return instead of panicking with a send on a closed channel.
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				if err := eeh.Do(context.TODO(), binlogsync.InsertAction, tbl, row); err != nil {
+					assert.True(t, errors.AlreadyClosed.Match(err), "%+v", err)
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(mb.block)
+	assert.NoError(t, sh.Close())
+	wg.Wait()
+	assert.True(t, mb.closed)
+}
+
+func TestSinkHandler_Failure(t *testing.T) {
+	mb := &memoryBroker{err: errors.ConnectionLost.Newf("broker gone")}
+	sh := binlogsync.NewSinkHandler(binlogsync.NewProducerSink(mb), binlogsync.SinkOptions{
+		Retries:   2,
+		RetryWait: time.Millisecond,
+	})
+	eeh := newSinkEntityHandler(sh, func() dml.ColumnMapper { return new(cdcProduct) })
+	ctx := context.TODO()
+	tbl := newCDCProductTable()
+
+	assert.NoError(t, eeh.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{{int64(1), int64(1), nil}}))
+	err := eeh.Complete(ctx)
+	assert.True(t, errors.Interrupted.Match(err), "%+v", err)
+
+	err = eeh.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{{int64(1), int64(1), nil}})
+	assert.True(t, errors.Interrupted.Match(err), "%+v", err)
+	assert.Error(t, sh.Close())
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "binlogsync")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fs := binlogsync.NewFileSink(filepath.Join(dir, "cdc.ndjson"), 120)
+	ctx := context.TODO()
+	msgs := []binlogsync.Message{
+		{Topic: "a", Key: "k1", Value: []byte(`{"id":1}`)},
+		{Topic: "b", Value: []byte{0xff, 0x00}},
+		{Topic: "c", Key: "k3", Headers: map[string]string{"h": "v"}, Value: []byte(`{"id":3}`)},
+	}
+	assert.NoError(t, fs.Send(ctx, msgs))
+	assert.NoError(t, fs.Flush(ctx))
+	assert.NoError(t, fs.Close())
+
+	files, err := filepath.Glob(filepath.Join(dir, "cdc.ndjson*"))
+	assert.NoError(t, err)
+	assert.Len(t, files, 2, "File must be rotated")
+
+	var lines []string
+	for _, fn := range files {
+		f, err := os.Open(fn)
+		assert.NoError(t, err)
+		s := bufio.NewScanner(f)
+		for s.Scan() {
+			lines = append(lines, s.Text())
+		}
+		assert.NoError(t, f.Close())
+	}
+	// the rotated file sorts after the current file
+	assert.Exactly(t, []string{
+		`{"topic":"c","key":"k3","headers":{"h":"v"},"value":{"id":3}}`,
+		`{"topic":"a","key":"k1","value":{"id":1}}`,
+		`{"topic":"b","value_base64":"/wA="}`,
+	}, lines)
+}
+
+func TestWebhookSink(t *testing.T) {
+	assert.NoError(t, hashpool.Register("sha256", sha256.New))
+	defer hashpool.Deregister("sha256")
+	tank, err := hashpool.FromRegistryHMAC("sha256", []byte("s3cr3t"))
+	assert.NoError(t, err)
+
+	var received []string
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mac, err := signed.NewContentHMAC("sha256").Parse(r)
+		assert.NoError(t, err)
+		assert.True(t, tank.Equal(body, mac), "Signature must match")
+		received = append(received, r.Header.Get(binlogsync.HeaderTopic)+":"+r.Header.Get(binlogsync.HeaderAction)+":"+string(body))
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	ws := binlogsync.NewWebhookSink(srv.URL, &tank)
+	ctx := context.TODO()
+	assert.NoError(t, ws.Send(ctx, []binlogsync.Message{
+		{Topic: "products", Headers: map[string]string{binlogsync.HeaderAction: "insert"}, Value: []byte(`{"id":1}`)},
+		{Topic: "products", Headers: map[string]string{binlogsync.HeaderAction: "delete"}, Value: []byte(`{"id":2}`)},
+	}))
+	assert.Exactly(t, []string{`products:insert:{"id":1}`, `products:delete:{"id":2}`}, received)
+
+	status = http.StatusBadGateway
+	err = ws.Send(ctx, []binlogsync.Message{{Topic: "products", Value: []byte(`{}`)}})
+	assert.True(t, errors.Temporary.Match(err), "%+v", err)
+
+	status = http.StatusUnauthorized
+	err = ws.Send(ctx, []binlogsync.Message{{Topic: "products", Value: []byte(`{}`)}})
+	assert.True(t, errors.NotAcceptable.Match(err), "%+v", err)
+	assert.NoError(t, ws.Flush(ctx))
+	assert.NoError(t, ws.Close())
+}
@@ -0,0 +1,109 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package binlogsync
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/net/signed"
+	"github.com/corestoreio/pkg/util/hashpool"
+)
+
+// HeaderTopic header name of the WebhookSink containing the topic.
+const HeaderTopic = "Binlog-Topic"
+
+var _ Sink = (*WebhookSink)(nil)
+
+// WebhookSink sends each message with a POST request to an URL. The body
+// contains the value and the HTTP header the headers of the message. The body
+// can be signed with a HMAC. The signature gets written by signed.ContentHMAC,
+// `Content-Hmac: <algorithm> <hex encoded HMAC>`, so the receiver can verify it
+// with the middleware of package net/signed. A response status code other than
+// 2xx returns an error.
+type WebhookSink struct {
+	URL    string
+	Client *http.Client
+	// Hash calculates the signature of the body. Nil disables signing.
+	Hash *hashpool.Tank
+	// HMAC writes the signature into the request header. Defaults to the
+	// algorithm sha256 with hex encoding.
+	HMAC *signed.ContentHMAC
+}
+
+// NewWebhookSink creates a new webhook sink with a default client timeout of
+// 30s. Argument hash can be nil.
+//		tank, err := hashpool.FromRegistryHMAC("sha256", secretKey)
+//		ws := binlogsync.NewWebhookSink("https://search.local/cdc", &tank)
+func NewWebhookSink(url string, hash *hashpool.Tank) *WebhookSink {
+	return &WebhookSink{
+		URL:    url,
+		Client: &http.Client{Timeout: 30 * time.Second},
+		Hash:   hash,
+		HMAC:   signed.NewContentHMAC("sha256"),
+	}
+}
+
+// Send posts each message in order.
+func (ws *WebhookSink) Send(ctx context.Context, msgs []Message) error {
+	for _, m := range msgs {
+		if err := ws.post(ctx, m); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (ws *WebhookSink) post(ctx context.Context, m Message) error {
+	req, err := http.NewRequest(http.MethodPost, ws.URL, bytes.NewReader(m.Value))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req = req.WithContext(ctx)
+	for k, v := range m.Headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(HeaderTopic, m.Topic)
+	if ws.Hash != nil {
+		ws.HMAC.SetHeader(req.Header, ws.Hash.Sum(m.Value, nil))
+	}
+
+	resp, err := ws.Client.Do(req)
+	if err != nil {
+		return errors.ConnectionFailed.New(err, "[binlogsync] WebhookSink failed to post to %q", ws.URL)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return nil
+	case resp.StatusCode >= 500:
+		return errors.Temporary.Newf("[binlogsync] WebhookSink %q responded with status %d", ws.URL, resp.StatusCode)
+	default:
+		return errors.NotAcceptable.Newf("[binlogsync] WebhookSink %q responded with status %d", ws.URL, resp.StatusCode)
+	}
+}
+
+// Flush does nothing because each message gets sent immediately.
+func (ws *WebhookSink) Flush(_ context.Context) error { return nil }
+
+// Close does nothing.
+func (ws *WebhookSink) Close() error { return nil }
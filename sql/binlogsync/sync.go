@@ -1,14 +1,17 @@
 package binlogsync
 
 import (
+	"bytes"
 	"context"
 	"regexp"
+	"strings"
 	"time"
 
 	"github.com/corestoreio/errors"
 	"github.com/corestoreio/log"
 	"github.com/corestoreio/pkg/sql/ddl"
 	"github.com/corestoreio/pkg/sql/myreplicator"
+	gmysql "github.com/siddontang/go-mysql/mysql"
 )
 
 // Action constants to figure out the type of an event. Those constants will be
@@ -51,15 +54,18 @@ func extractTableFromQueryEvent(schema, query []byte) (dbName, tableName string)
 	return
 }
 
-func (c *Canal) clearTableCacheOnDDLStmt(schema, query []byte) {
+func (c *Canal) clearTableCacheOnDDLStmt(ctx context.Context, schema, query []byte) error {
 	defer log.WhenDone(c.opts.Log).Info("binlogsync.Canal.clearTableCacheOnDDLStmt")
-	if db, tbl := extractTableFromQueryEvent(schema, query); tbl != "" {
-		c.ClearTableCache(db, tbl)
-		if c.opts.Log.IsInfo() {
-			c.opts.Log.Info("[binlogsync] Table structure changed, clear table cache",
-				log.String("database", db), log.String("table", tbl), log.String("query", string(query)))
-		}
+	db, tbl := extractTableFromQueryEvent(schema, query)
+	if tbl == "" {
+		return nil
 	}
+	c.ClearTableCache(db, tbl)
+	if c.opts.Log.IsInfo() {
+		c.opts.Log.Info("[binlogsync] Table structure changed, clear table cache",
+			log.String("database", db), log.String("table", tbl), log.String("query", string(query)))
+	}
+	return c.processSchemaChangeHandler(ctx, db, tbl)
 }
 
 func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
@@ -69,14 +75,25 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 	pos := c.masterStatus
 
 	if c.opts.Log.IsInfo() {
-		c.opts.Log.Info("[binlogsync] Start syncing of binlog", log.Stringer("position", pos))
+		c.opts.Log.Info("[binlogsync] Start syncing of binlog", log.Stringer("position", pos), log.String("gtid_set", pos.ExecutedGTIDSet))
 	}
 
-	s, err := c.syncer.StartSync(pos)
+	var s *myreplicator.BinlogStreamer
+	var err error
+	if c.opts.UseGTID {
+		if c.gset, err = parseGTIDSet(c.opts.Flavor, pos.ExecutedGTIDSet); err != nil {
+			return errors.WithStack(err)
+		}
+		s, err = c.syncer.StartSyncGTID(c.gset)
+	} else {
+		s, err = c.syncer.StartSync(pos)
+	}
 	if err != nil {
 		return errors.Fatal.Newf("[binlogsync] Start sync replication at %s error %v", pos, err)
 	}
 
+	// ep identifies the GTID and the rows events of the current transaction.
+	var ep eventPosition
 	timeout := time.Second
 	for {
 		ctx, cancel := context.WithTimeout(ctxArg, 2*time.Second)
@@ -85,6 +102,12 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 
 		if err == context.DeadlineExceeded {
 			timeout = 2 * timeout
+			// the stream is idle, complete the pending transactions.
+			if c.checkpointPending > 0 {
+				if err := c.completeCheckpoint(ctxArg, time.Now()); err != nil {
+					return errors.WithStack(err)
+				}
+			}
 			continue
 		}
 		if err != nil {
@@ -98,25 +121,23 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 
 		switch e := ev.Event.(type) {
 		case *myreplicator.RotateEvent:
-			if err := c.flushEventHandlers(ctxArg); err != nil {
-				// todo maybe better err handling ...
-				return errors.WithStack(err)
-			}
 			pos.File = string(e.NextLogName)
 			pos.Position = uint(e.Position)
-			// r.ev <- pos
 
 			if c.opts.Log.IsInfo() {
 				c.opts.Log.Info("[binlogsync] Rotate binlog to a new position", log.Stringer("position", pos))
 			}
-
-			// call event handler OnRotate(e)
+			if err := c.checkpoint(ctxArg, pos, true); err != nil {
+				return errors.WithStack(err)
+			}
 
 		case *myreplicator.RowsEvent:
 			// we only focus row based event.
 			// NotFound errors get ignores. For example table has been deleted
 			// and an old event pops in.
-			if err = c.handleRowsEvent(ctxArg, ev); err != nil {
+			ep.ms = pos
+			ep.event++
+			if err = c.handleRowsEvent(withPosition(ctxArg, ep), ev); err != nil {
 				isNotFound := errors.Is(err, errors.NotFound)
 				if c.opts.Log.IsInfo() {
 					c.opts.Log.Info("[binlogsync] Rotate binlog to a new position", log.Err(err), log.Stringer("position", pos), log.Bool("ignore_not_found_error", isNotFound))
@@ -124,48 +145,66 @@ func (c *Canal) startSyncBinlog(ctxArg context.Context) error {
 				if !isNotFound {
 					return errors.WithStack(err)
 				}
-				continue // to not save the master position, not necessary.
 			}
-		case *myreplicator.XIDEvent:
-			// TODO implement
-			// if e.GSet != nil {
-			// 	c.master.UpdateGTIDSet(e.GSet)
-			// }
-
-			// call event OnXID(pos)
 
 		case *myreplicator.MariadbGTIDEvent:
-			// call event OnGTID(gtid)
+			g := e.GTID
+			g.ServerID = ev.Header.ServerID
+			ep = eventPosition{gtid: g.String()}
 
 		case *myreplicator.GTIDEvent:
-			// call event OnGTID(gtid)
+			ep = eventPosition{gtid: e.GTIDNext()}
+
+		case *myreplicator.XIDEvent:
+			// transaction committed
+			c.commitGTID(&pos, &ep)
+			if err := c.checkpoint(ctxArg, pos, false); err != nil {
+				return errors.WithStack(err)
+			}
 
 		case *myreplicator.QueryEvent:
-			// TODO implement GTID set but review if it makes sense to import siddontang/go-mysql/mysql
-			// if e.GSet != nil {
-			// 	c.master.UpdateGTIDSet(e.GSet)
-			// }
-
-			// handle alert table query
-			c.clearTableCacheOnDDLStmt(e.Schema, e.Query)
-
-			// For now really necessary.
-			// TODO: call two more event handlers: on OnTableChanged(db,table) and OnDDL(pos, e)
-
-			// save master position, so no continue
-		case
-			*myreplicator.TableMapEvent,
-			*myreplicator.FormatDescriptionEvent:
-			// maybe add: *replication.XIDEvent
-			// don't update Master with file and position
-		default:
-			continue
+			if isBeginStmt(e.Query) {
+				continue
+			}
+			// A DDL statement or COMMIT of a non-transactional engine.
+			c.commitGTID(&pos, &ep)
+			if err := c.clearTableCacheOnDDLStmt(withPosition(ctxArg, eventPosition{ms: pos}), e.Schema, e.Query); err != nil {
+				return errors.WithStack(err)
+			}
+			// TODO: call event handler OnDDL(pos, e)
+			if err := c.checkpoint(ctxArg, pos, false); err != nil {
+				return errors.WithStack(err)
+			}
 		}
+	}
+}
 
-		if err := c.masterSave(pos.File, pos.Position); err != nil {
-			c.opts.Log.Info("[binlogsync] startSyncBinlog: Failed to save master position", log.Err(err), log.Stringer("position", pos))
+// commitGTID adds the GTID of the current transaction to the executed GTID set
+// and resets the transaction.
+func (c *Canal) commitGTID(pos *ddl.MasterStatus, ep *eventPosition) {
+	if c.gset != nil && ep.gtid != "" {
+		if err := c.gset.Update(ep.gtid); err != nil {
+			c.opts.Log.Info("[binlogsync] Failed to update GTID set", log.Err(err), log.String("gtid", ep.gtid), log.Stringer("gtid_set", c.gset))
 		}
+		pos.ExecutedGTIDSet = c.gset.String()
+	}
+	*ep = eventPosition{}
+}
+
+func isBeginStmt(query []byte) bool {
+	return bytes.EqualFold(bytes.TrimSpace(query), []byte("BEGIN"))
+}
+
+func parseGTIDSet(flavor, set string) (gmysql.GTIDSet, error) {
+	set = strings.Replace(set, "\n", "", -1) // MySQL separates multiple sources with a new line
+	var gset gmysql.GTIDSet
+	var err error
+	if flavor == MySQLFlavor {
+		gset, err = gmysql.ParseMysqlGTIDSet(set)
+	} else {
+		gset, err = gmysql.ParseMariadbGTIDSet(set)
 	}
+	return gset, errors.Wrapf(err, "[binlogsync] Failed to parse %s GTID set %q", flavor, set)
 }
 
 // handleRowsEvent handles an event on the rows and calls all registered rows
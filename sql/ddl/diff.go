@@ -0,0 +1,572 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/util/bufferpool"
+)
+
+// DiffAction defines what must happen to the database object so that the live
+// schema converges to the expected schema.
+type DiffAction uint8
+
+// Diff actions.
+const (
+	DiffAdd DiffAction = iota + 1
+	DiffDrop
+	DiffModify
+)
+
+func (a DiffAction) String() string {
+	switch a {
+	case DiffAdd:
+		return "add"
+	case DiffDrop:
+		return "drop"
+	case DiffModify:
+		return "modify"
+	}
+	return "unknown"
+}
+
+// DiffObject defines the kind of database object which differs.
+type DiffObject uint8
+
+// Diff objects.
+const (
+	DiffTable DiffObject = iota + 1
+	DiffColumn
+	DiffIndex
+	DiffForeignKey
+)
+
+func (o DiffObject) String() string {
+	switch o {
+	case DiffTable:
+		return "table"
+	case DiffColumn:
+		return "column"
+	case DiffIndex:
+		return "index"
+	case DiffForeignKey:
+		return "foreign key"
+	}
+	return "unknown"
+}
+
+// SchemaDiff describes one difference between an expected table and the live
+// database table.
+type SchemaDiff struct {
+	Table  string
+	Action DiffAction
+	Object DiffObject
+	// Name of the column, index or foreign key. Empty for tables.
+	Name string
+	// Details lists the changed properties of a modified object, e.g.
+	// `type int(10) => int(11)`.
+	Details []string
+	// definition contains the SQL for ADD and MODIFY clauses or the CREATE
+	// TABLE statement.
+	definition string
+	// position contains for added columns either FIRST or AFTER `col`.
+	position string
+	// foreignKeys of a created table get added after all tables exist.
+	foreignKeys ForeignKeys
+}
+
+// String returns a human readable description.
+func (d SchemaDiff) String() string {
+	var buf strings.Builder
+	buf.WriteString(d.Action.String())
+	buf.WriteByte(' ')
+	buf.WriteString(d.Object.String())
+	buf.WriteByte(' ')
+	buf.WriteString(d.Table)
+	if d.Name != "" {
+		buf.WriteByte('.')
+		buf.WriteString(d.Name)
+	}
+	if len(d.Details) > 0 {
+		buf.WriteString(": ")
+		buf.WriteString(strings.Join(d.Details, ", "))
+	}
+	return buf.String()
+}
+
+// SchemaDiffs a list of differences, sorted by table name.
+type SchemaDiffs []SchemaDiff
+
+// String returns each difference in its own line.
+func (ds SchemaDiffs) String() string {
+	lines := make([]string, len(ds))
+	for i, d := range ds {
+		lines[i] = d.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Err returns a Mismatch error listing all differences or nil if the schemas
+// are equal. Useful as a check in the continuous integration.
+func (ds SchemaDiffs) Err() error {
+	if len(ds) == 0 {
+		return nil
+	}
+	return errors.Mismatch.Newf("[ddl] Database schema differs in %d places:\n%s", len(ds), ds.String())
+}
+
+// alterOrder defines the order of the ALTER TABLE clauses. Foreign keys must be
+// dropped before their indexes and columns, and can only be added after them.
+func (d SchemaDiff) alterOrder() int {
+	switch {
+	case d.Action == DiffDrop && d.Object == DiffForeignKey:
+		return 0
+	case d.Action == DiffDrop && d.Object == DiffIndex:
+		return 1
+	case d.Object == DiffColumn && d.Action == DiffModify:
+		return 2
+	case d.Object == DiffColumn && d.Action == DiffAdd:
+		return 3
+	case d.Object == DiffColumn && d.Action == DiffDrop:
+		return 4
+	case d.Object == DiffIndex:
+		return 5
+	}
+	return 6
+}
+
+// AlterStatements returns the CREATE TABLE and ALTER TABLE statements which
+// let the live schema converge to the expected schema. Each table gets one
+// ALTER TABLE statement. Modified indexes and foreign keys get dropped and
+// added again. The foreign keys of created tables get added by trailing ALTER
+// TABLE statements, because the referenced tables might not exist before. Be
+// careful: dropping columns loses data.
+func (ds SchemaDiffs) AlterStatements() []string {
+	var stmts, fkStmts []string
+	clauses := map[string][]SchemaDiff{}
+	var tables []string
+	for _, d := range ds {
+		if d.Object == DiffTable {
+			stmts = append(stmts, d.definition)
+			if len(d.foreignKeys) > 0 {
+				fkStmts = append(fkStmts, addForeignKeysSyntax(d.Table, d.foreignKeys))
+			}
+			continue
+		}
+		if _, ok := clauses[d.Table]; !ok {
+			tables = append(tables, d.Table)
+		}
+		clauses[d.Table] = append(clauses[d.Table], d)
+		if d.Action == DiffModify && d.Object != DiffColumn {
+			// drop and add again
+			dd := d
+			dd.Action = DiffDrop
+			ad := d
+			ad.Action = DiffAdd
+			clauses[d.Table][len(clauses[d.Table])-1] = dd
+			clauses[d.Table] = append(clauses[d.Table], ad)
+		}
+	}
+
+	for _, tn := range tables {
+		cl := clauses[tn]
+		sort.SliceStable(cl, func(i, j int) bool { return cl[i].alterOrder() < cl[j].alterOrder() })
+
+		buf := bufferpool.Get()
+		buf.WriteString("ALTER TABLE ")
+		buf.WriteString(dml.Quoter.Name(tn))
+		for i, d := range cl {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteString("\n  ")
+			buf.WriteString(d.alterClause())
+		}
+		stmts = append(stmts, buf.String())
+		bufferpool.Put(buf)
+	}
+	return append(stmts, fkStmts...)
+}
+
+func addForeignKeysSyntax(table string, fks ForeignKeys) string {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+
+	buf.WriteString("ALTER TABLE ")
+	buf.WriteString(dml.Quoter.Name(table))
+	for i, fk := range fks {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n  ADD ")
+		buf.WriteString(fk.String())
+	}
+	return buf.String()
+}
+
+func (d SchemaDiff) alterClause() string {
+	switch {
+	case d.Object == DiffColumn && d.Action == DiffAdd:
+		return "ADD COLUMN " + d.definition + " " + d.position
+	case d.Object == DiffColumn && d.Action == DiffModify:
+		return "MODIFY COLUMN " + d.definition
+	case d.Object == DiffColumn && d.Action == DiffDrop:
+		return "DROP COLUMN " + dml.Quoter.Name(d.Name)
+	case d.Object == DiffIndex && d.Action == DiffDrop && d.Name == IndexPrimary:
+		return "DROP PRIMARY KEY"
+	case d.Object == DiffIndex && d.Action == DiffDrop:
+		return "DROP INDEX " + dml.Quoter.Name(d.Name)
+	case d.Object == DiffForeignKey && d.Action == DiffDrop:
+		return "DROP FOREIGN KEY " + dml.Quoter.Name(d.Name)
+	}
+	return "ADD " + d.definition
+}
+
+// Schema contains the live structure of tables as loaded from the
+// information_schema. Map keys are the table names.
+type Schema struct {
+	Columns     map[string]Columns
+	Indexes     map[string]Indexes
+	ForeignKeys map[string]ForeignKeys
+}
+
+// LoadSchema loads the columns, indexes and foreign keys of the provided
+// tables. Tables which do not exist are not part of the maps.
+func LoadSchema(ctx context.Context, db dml.Querier, tables ...string) (*Schema, error) {
+	cols, err := LoadColumns(ctx, db, tables...)
+	if err != nil && !errors.NotFound.Match(err) {
+		return nil, errors.WithStack(err)
+	}
+	s := &Schema{
+		Columns: cols,
+	}
+	if len(cols) == 0 {
+		return s, nil
+	}
+	if s.Indexes, err = LoadIndexes(ctx, db, tables...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if s.ForeignKeys, err = LoadForeignKeys(ctx, db, tables...); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s, nil
+}
+
+// Diff compares the tables, excluding views, with the current database
+// schema. See DiffSchema.
+func (tm *Tables) Diff(ctx context.Context) (SchemaDiffs, error) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	tables := make([]*Table, 0, len(tm.tm))
+	tblNames := make([]string, 0, len(tm.tm))
+	for tn, t := range tm.tm {
+		if !t.IsView {
+			tables = append(tables, t)
+			tblNames = append(tblNames, tn)
+		}
+	}
+	if len(tables) == 0 {
+		return nil, nil
+	}
+
+	s, err := LoadSchema(ctx, tm.DB, tblNames...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return DiffSchema(s, tables...), nil
+}
+
+// DiffSchema compares the expected tables with the live schema and reports
+// added, removed and changed columns, indexes and foreign keys. A column gets
+// only checked for its type, nullability, default and extra attributes if the
+// expected column has a ColumnType. Indexes get only compared if
+// Table.Indexes is not nil, otherwise the primary key gets derived from the
+// columns with Key PRI. Foreign keys get only compared if Table.ForeignKeys
+// is not nil.
+func DiffSchema(have *Schema, want ...*Table) SchemaDiffs {
+	want = append([]*Table(nil), want...)
+	sort.Slice(want, func(i, j int) bool { return want[i].Name < want[j].Name })
+
+	var ds SchemaDiffs
+	for _, t := range want {
+		haveCols, ok := have.Columns[t.Name]
+		if !ok {
+			ds = append(ds, SchemaDiff{
+				Table:       t.Name,
+				Action:      DiffAdd,
+				Object:      DiffTable,
+				definition:  createTableSyntax(t),
+				foreignKeys: t.ForeignKeys,
+			})
+			continue
+		}
+		ds = diffColumns(ds, t, haveCols)
+		ds = diffIndexes(ds, t, have.Indexes[t.Name])
+		if t.ForeignKeys != nil {
+			ds = diffForeignKeys(ds, t, have.ForeignKeys[t.Name])
+		}
+	}
+	return ds
+}
+
+func diffColumns(ds SchemaDiffs, t *Table, haveCols Columns) SchemaDiffs {
+	position := "FIRST"
+	for _, c := range t.Columns {
+		hc := haveCols.ByField(c.Field)
+		switch {
+		case hc.Field == "":
+			ds = append(ds, SchemaDiff{
+				Table:      t.Name,
+				Action:     DiffAdd,
+				Object:     DiffColumn,
+				Name:       c.Field,
+				definition: columnDefinition(c),
+				position:   position,
+			})
+		case c.ColumnType != "":
+			if details := compareColumn(c, hc); len(details) > 0 {
+				ds = append(ds, SchemaDiff{
+					Table:      t.Name,
+					Action:     DiffModify,
+					Object:     DiffColumn,
+					Name:       c.Field,
+					Details:    details,
+					definition: columnDefinition(c),
+				})
+			}
+		}
+		position = "AFTER " + dml.Quoter.Name(c.Field)
+	}
+	for _, hc := range haveCols {
+		if !t.Columns.Contains(hc.Field) {
+			ds = append(ds, SchemaDiff{
+				Table:  t.Name,
+				Action: DiffDrop,
+				Object: DiffColumn,
+				Name:   hc.Field,
+			})
+		}
+	}
+	return ds
+}
+
+func compareColumn(want, have *Column) (details []string) {
+	if !strings.EqualFold(want.ColumnType, have.ColumnType) {
+		details = append(details, "type "+have.ColumnType+" => "+want.ColumnType)
+	}
+	if want.IsNull() != have.IsNull() {
+		details = append(details, "null "+have.Null+" => "+want.Null)
+	}
+	if wd, hd := normalizeDefault(want.Default), normalizeDefault(have.Default); wd != hd {
+		details = append(details, "default "+defaultString(have.Default)+" => "+defaultString(want.Default))
+	}
+	if we, he := normalizeExtra(want.Extra), normalizeExtra(have.Extra); we != he {
+		details = append(details, "extra "+he+" => "+we)
+	}
+	return details
+}
+
+// normalizeDefault removes the differences between MySQL and MariaDB. MariaDB
+// quotes string defaults and writes current_timestamp().
+func normalizeDefault(d null.String) null.String {
+	if !d.Valid || d.String == "NULL" {
+		return null.String{}
+	}
+	s := d.String
+	if len(s) > 1 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		s = strings.Replace(s[1:len(s)-1], "''", "'", -1)
+	}
+	if strings.EqualFold(strings.TrimSuffix(s, "()"), "CURRENT_TIMESTAMP") {
+		s = "CURRENT_TIMESTAMP"
+	}
+	return null.String{String: s, Valid: true}
+}
+
+func defaultString(d null.String) string {
+	if d = normalizeDefault(d); !d.Valid {
+		return "NULL"
+	}
+	return d.String
+}
+
+// normalizeExtra removes the MySQL 8 marker DEFAULT_GENERATED.
+func normalizeExtra(e string) string {
+	e = strings.TrimSpace(strings.Replace(strings.ToLower(e), "default_generated", "", 1))
+	return strings.Replace(e, "current_timestamp()", "current_timestamp", -1)
+}
+
+func diffIndexes(ds SchemaDiffs, t *Table, haveIdx Indexes) SchemaDiffs {
+	wantIdx := t.Indexes
+	if wantIdx == nil {
+		// compare only the primary key
+		if pk := t.Columns.PrimaryKeys(); len(pk) > 0 {
+			wantIdx = Indexes{{Name: IndexPrimary, Unique: true, Columns: pk.FieldNames()}}
+		}
+		if hpk := haveIdx.ByName(IndexPrimary); hpk != nil {
+			haveIdx = Indexes{hpk}
+		} else {
+			haveIdx = nil
+		}
+	}
+
+	for _, wi := range wantIdx {
+		hi := haveIdx.ByName(wi.Name)
+		switch {
+		case hi == nil:
+			ds = append(ds, SchemaDiff{
+				Table:      t.Name,
+				Action:     DiffAdd,
+				Object:     DiffIndex,
+				Name:       wi.Name,
+				definition: wi.String(),
+			})
+		case !wi.Equal(hi):
+			ds = append(ds, SchemaDiff{
+				Table:      t.Name,
+				Action:     DiffModify,
+				Object:     DiffIndex,
+				Name:       wi.Name,
+				Details:    []string{hi.String() + " => " + wi.String()},
+				definition: wi.String(),
+			})
+		}
+	}
+	for _, hi := range haveIdx {
+		if wantIdx.ByName(hi.Name) == nil {
+			ds = append(ds, SchemaDiff{
+				Table:  t.Name,
+				Action: DiffDrop,
+				Object: DiffIndex,
+				Name:   hi.Name,
+			})
+		}
+	}
+	return ds
+}
+
+func diffForeignKeys(ds SchemaDiffs, t *Table, haveFKs ForeignKeys) SchemaDiffs {
+	for _, wfk := range t.ForeignKeys {
+		hfk := haveFKs.ByName(wfk.Name)
+		switch {
+		case hfk == nil:
+			ds = append(ds, SchemaDiff{
+				Table:      t.Name,
+				Action:     DiffAdd,
+				Object:     DiffForeignKey,
+				Name:       wfk.Name,
+				definition: wfk.String(),
+			})
+		case !wfk.Equal(hfk):
+			ds = append(ds, SchemaDiff{
+				Table:      t.Name,
+				Action:     DiffModify,
+				Object:     DiffForeignKey,
+				Name:       wfk.Name,
+				Details:    []string{hfk.String() + " => " + wfk.String()},
+				definition: wfk.String(),
+			})
+		}
+	}
+	for _, hfk := range haveFKs {
+		if t.ForeignKeys.ByName(hfk.Name) == nil {
+			ds = append(ds, SchemaDiff{
+				Table:  t.Name,
+				Action: DiffDrop,
+				Object: DiffForeignKey,
+				Name:   hfk.Name,
+			})
+		}
+	}
+	return ds
+}
+
+// columnDefinition writes the column as used in CREATE and ALTER TABLE.
+func columnDefinition(c *Column) string {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+
+	buf.WriteString(dml.Quoter.Name(c.Field))
+	buf.WriteByte(' ')
+	buf.WriteString(c.ColumnType)
+	if c.IsNull() {
+		buf.WriteString(" NULL")
+	} else {
+		buf.WriteString(" NOT NULL")
+	}
+	if d := normalizeDefault(c.Default); d.Valid {
+		buf.WriteString(" DEFAULT ")
+		switch {
+		case d.String == "CURRENT_TIMESTAMP", isNumericType(c.DataType):
+			buf.WriteString(d.String)
+		default:
+			dml.DialectMySQL().EscapeString(buf, d.String)
+		}
+	}
+	if e := normalizeExtra(c.Extra); e != "" {
+		buf.WriteByte(' ')
+		buf.WriteString(strings.ToUpper(e))
+	}
+	if c.Comment != "" {
+		buf.WriteString(" COMMENT ")
+		dml.DialectMySQL().EscapeString(buf, c.Comment)
+	}
+	return buf.String()
+}
+
+func isNumericType(dataType string) bool {
+	switch strings.ToLower(dataType) {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint",
+		"decimal", "numeric", "float", "double", "real", "bit", "year":
+		return true
+	}
+	return false
+}
+
+// createTableSyntax writes the CREATE TABLE statement for a missing table
+// without the foreign keys.
+func createTableSyntax(t *Table) string {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+
+	buf.WriteString("CREATE TABLE ")
+	buf.WriteString(dml.Quoter.Name(t.Name))
+	buf.WriteString(" (")
+	for i, c := range t.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("\n  ")
+		buf.WriteString(columnDefinition(c))
+	}
+	idx := t.Indexes
+	if idx == nil {
+		if pk := t.Columns.PrimaryKeys(); len(pk) > 0 {
+			idx = Indexes{{Name: IndexPrimary, Unique: true, Columns: pk.FieldNames()}}
+		}
+	}
+	for _, i := range idx {
+		buf.WriteString(",\n  ")
+		buf.WriteString(i.String())
+	}
+	buf.WriteString("\n)")
+	return buf.String()
+}
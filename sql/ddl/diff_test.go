@@ -0,0 +1,202 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestDiffSchema(t *testing.T) {
+	t.Parallel()
+
+	have := &ddl.Schema{
+		Columns: map[string]ddl.Columns{
+			"customer": {
+				&ddl.Column{Field: "id", Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+				&ddl.Column{Field: "store_id", Null: "YES", DataType: "smallint", ColumnType: "smallint(5)", Default: null.MakeString("0")},
+				&ddl.Column{Field: "name", Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Default: null.MakeString("'unknown'")},
+				&ddl.Column{Field: "legacy", Null: "YES", DataType: "text", ColumnType: "text"},
+			},
+		},
+		Indexes: map[string]ddl.Indexes{
+			"customer": {
+				{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+				{Name: "IDX_STORE", Columns: []string{"store_id"}},
+				{Name: "IDX_LEGACY", Columns: []string{"legacy"}},
+			},
+		},
+		ForeignKeys: map[string]ddl.ForeignKeys{
+			"customer": {
+				{Name: "FK_STORE", Columns: []string{"store_id"}, ReferencedTable: "store", ReferencedColumns: []string{"store_id"}, OnDelete: "CASCADE", OnUpdate: "NO ACTION"},
+			},
+		},
+	}
+
+	customer := ddl.NewTable("customer",
+		&ddl.Column{Field: "id", Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+		&ddl.Column{Field: "email", Null: "YES", DataType: "varchar", ColumnType: "varchar(255)", Comment: "E-Mail"},
+		&ddl.Column{Field: "store_id", Null: "NO", DataType: "smallint", ColumnType: "smallint(5) unsigned", Default: null.MakeString("0")},
+		&ddl.Column{Field: "name", Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Default: null.MakeString("unknown")},
+	)
+	customer.Indexes = ddl.Indexes{
+		{Name: "PRIMARY", Unique: true, Columns: []string{"id"}},
+		{Name: "IDX_STORE", Unique: true, Columns: []string{"store_id"}},
+		{Name: "IDX_EMAIL", Columns: []string{"email"}},
+	}
+	customer.ForeignKeys = ddl.ForeignKeys{
+		{Name: "FK_STORE", Columns: []string{"store_id"}, ReferencedTable: "store", ReferencedColumns: []string{"store_id"}, OnDelete: "CASCADE"},
+	}
+
+	store := ddl.NewTable("store",
+		&ddl.Column{Field: "store_id", Null: "NO", DataType: "smallint", ColumnType: "smallint(5) unsigned", Key: "PRI", Extra: "auto_increment"},
+		&ddl.Column{Field: "code", Null: "NO", DataType: "varchar", ColumnType: "varchar(32)", Default: null.MakeString("it's")},
+	)
+
+	ds := ddl.DiffSchema(have, store, customer)
+	assert.Exactly(t, `add column customer.email
+modify column customer.store_id: type smallint(5) => smallint(5) unsigned, null YES => NO
+drop column customer.legacy
+modify index customer.IDX_STORE: KEY `+"`IDX_STORE` (`store_id`) => UNIQUE KEY `IDX_STORE` (`store_id`)"+`
+add index customer.IDX_EMAIL
+drop index customer.IDX_LEGACY
+add table store`, ds.String())
+
+	assert.Exactly(t, []string{
+		"CREATE TABLE `store` (\n  `store_id` smallint(5) unsigned NOT NULL AUTO_INCREMENT,\n  `code` varchar(32) NOT NULL DEFAULT 'it\\'s',\n  PRIMARY KEY (`store_id`)\n)",
+		"ALTER TABLE `customer`" +
+			"\n  DROP INDEX `IDX_STORE`," +
+			"\n  DROP INDEX `IDX_LEGACY`," +
+			"\n  MODIFY COLUMN `store_id` smallint(5) unsigned NOT NULL DEFAULT 0," +
+			"\n  ADD COLUMN `email` varchar(255) NULL COMMENT 'E-Mail' AFTER `id`," +
+			"\n  DROP COLUMN `legacy`," +
+			"\n  ADD UNIQUE KEY `IDX_STORE` (`store_id`)," +
+			"\n  ADD KEY `IDX_EMAIL` (`email`)",
+	}, ds.AlterStatements())
+
+	err := ds.Err()
+	assert.True(t, errors.Mismatch.Match(err), "%+v", err)
+
+	t.Run("equal", func(t *testing.T) {
+		customer.ForeignKeys[0].Name = "FK_OTHER"
+		customer.Indexes = nil
+		ds := ddl.DiffSchema(have, ddl.NewTable("customer", customer.Columns[0], customer.Columns[3],
+			&ddl.Column{Field: "store_id"}, &ddl.Column{Field: "legacy"}))
+		assert.NoError(t, ds.Err())
+
+		ds = ddl.DiffSchema(have, ddl.NewTable("customer", customer.Columns...))
+		assert.Len(t, ds, 3)
+	})
+
+	t.Run("foreign key", func(t *testing.T) {
+		tbl := ddl.NewTable("customer", have.Columns["customer"]...)
+		tbl.ForeignKeys = ddl.ForeignKeys{
+			{Name: "FK_STORE", Columns: []string{"store_id"}, ReferencedTable: "store", ReferencedColumns: []string{"store_id"}},
+		}
+		ds := ddl.DiffSchema(have, tbl)
+		assert.Exactly(t, []string{
+			"ALTER TABLE `customer`\n  DROP FOREIGN KEY `FK_STORE`,\n  ADD CONSTRAINT `FK_STORE` FOREIGN KEY (`store_id`) REFERENCES `store` (`store_id`) ON DELETE RESTRICT ON UPDATE RESTRICT",
+		}, ds.AlterStatements())
+	})
+
+	t.Run("foreign key of created table", func(t *testing.T) {
+		website := ddl.NewTable("website",
+			&ddl.Column{Field: "website_id", Null: "NO", DataType: "smallint", ColumnType: "smallint(5) unsigned", Key: "PRI"},
+		)
+		store := ddl.NewTable("store", store.Columns...)
+		store.ForeignKeys = ddl.ForeignKeys{
+			{Name: "FK_WEBSITE", Columns: []string{"website_id"}, ReferencedTable: "website", ReferencedColumns: []string{"website_id"}, OnDelete: "CASCADE"},
+		}
+		ds := ddl.DiffSchema(&ddl.Schema{}, website, store)
+		assert.Exactly(t, []string{
+			"CREATE TABLE `store` (\n  `store_id` smallint(5) unsigned NOT NULL AUTO_INCREMENT,\n  `code` varchar(32) NOT NULL DEFAULT 'it\\'s',\n  PRIMARY KEY (`store_id`)\n)",
+			"CREATE TABLE `website` (\n  `website_id` smallint(5) unsigned NOT NULL,\n  PRIMARY KEY (`website_id`)\n)",
+			"ALTER TABLE `store`\n  ADD CONSTRAINT `FK_WEBSITE` FOREIGN KEY (`website_id`) REFERENCES `website` (`website_id`) ON DELETE CASCADE ON UPDATE RESTRICT",
+		}, ds.AlterStatements())
+	})
+
+	t.Run("index type and prefix", func(t *testing.T) {
+		have := &ddl.Schema{
+			Columns: have.Columns,
+			Indexes: map[string]ddl.Indexes{
+				"customer": {
+					{Name: "IDX_NAME", Type: "BTREE", Columns: []string{"name", "store_id"}, SubParts: []int{100, 0}},
+					{Name: "FTI_LEGACY", Type: "BTREE", Columns: []string{"legacy"}, SubParts: []int{0}},
+				},
+			},
+		}
+		tbl := ddl.NewTable("customer", have.Columns["customer"]...)
+		tbl.Indexes = ddl.Indexes{
+			{Name: "IDX_NAME", Columns: []string{"name", "store_id"}, SubParts: []int{100}},
+			{Name: "FTI_LEGACY", Type: "FULLTEXT", Columns: []string{"legacy"}},
+			{Name: "IDX_HASH", Type: "HASH", Columns: []string{"store_id"}},
+		}
+		ds := ddl.DiffSchema(have, tbl)
+		assert.Exactly(t, "modify index customer.FTI_LEGACY: KEY `FTI_LEGACY` (`legacy`) => FULLTEXT KEY `FTI_LEGACY` (`legacy`)\n"+
+			"add index customer.IDX_HASH", ds.String())
+
+		tbl.Indexes[0].SubParts = []int{200}
+		ds = ddl.DiffSchema(have, tbl)
+		assert.Exactly(t, []string{
+			"ALTER TABLE `customer`" +
+				"\n  DROP INDEX `IDX_NAME`," +
+				"\n  DROP INDEX `FTI_LEGACY`," +
+				"\n  ADD KEY `IDX_NAME` (`name`(200),`store_id`)," +
+				"\n  ADD FULLTEXT KEY `FTI_LEGACY` (`legacy`)," +
+				"\n  ADD KEY `IDX_HASH` (`store_id`) USING HASH",
+		}, ds.AlterStatements())
+	})
+}
+
+func TestTables_Diff(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery("SELECT.+FROM information_schema.COLUMNS WHERE").
+		WillReturnRows(dmltest.MustMockRows(dmltest.WithFile("testdata/core_config_data_columns.csv")))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("FROM information_schema.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME IN ('core_config_data')")).
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "INDEX_NAME", "NON_UNIQUE", "COLUMN_NAME", "SUB_PART", "INDEX_TYPE"}).
+			AddRow("core_config_data", "PRIMARY", 0, "config_id", nil, "BTREE").
+			AddRow("core_config_data", "CORE_CONFIG_DATA_SCOPE_SCOPE_ID_PATH", 0, "scope", nil, "BTREE").
+			AddRow("core_config_data", "CORE_CONFIG_DATA_SCOPE_SCOPE_ID_PATH", 0, "scope_id", nil, "BTREE").
+			AddRow("core_config_data", "CORE_CONFIG_DATA_SCOPE_SCOPE_ID_PATH", 0, "path", 100, "BTREE"))
+	dbMock.ExpectQuery("SELECT kcu.TABLE_NAME.+FROM information_schema.KEY_COLUMN_USAGE kcu").
+		WillReturnRows(sqlmock.NewRows([]string{"TABLE_NAME", "CONSTRAINT_NAME", "COLUMN_NAME", "REFERENCED_TABLE_NAME", "REFERENCED_COLUMN_NAME", "DELETE_RULE", "UPDATE_RULE"}))
+
+	tm := ddl.MustNewTables(
+		ddl.WithDB(dbc.DB),
+		ddl.WithTable("core_config_data",
+			&ddl.Column{Field: "config_id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment", Comment: "Config Id"},
+			&ddl.Column{Field: "scope", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(8)", Default: null.MakeString("default"), Key: "MUL", Comment: "Config Scope"},
+			&ddl.Column{Field: "scope_id", Pos: 3, Null: "NO", DataType: "int", ColumnType: "int(11)", Default: null.MakeString("0"), Comment: "Config Scope Id"},
+			&ddl.Column{Field: "path", Pos: 4, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Default: null.MakeString("general"), Comment: "Config Path"},
+			&ddl.Column{Field: "value", Pos: 5, Null: "YES", DataType: "text", ColumnType: "mediumtext", Comment: "Config Value"},
+		),
+	)
+
+	ds, err := tm.Diff(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, "modify column core_config_data.value: type text => mediumtext", ds.String())
+	assert.Exactly(t, []string{"ALTER TABLE `core_config_data`\n  MODIFY COLUMN `value` mediumtext NULL COMMENT 'Config Value'"}, ds.AlterStatements())
+}
@@ -0,0 +1,297 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ddl
+
+import (
+	"context"
+	"database/sql"
+	"strconv"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+// IndexPrimary defines the name of the primary key index.
+const IndexPrimary = "PRIMARY"
+
+// Index describes an index of a table as stored in
+// information_schema.STATISTICS.
+type Index struct {
+	// Name of the index, IndexPrimary for the primary key.
+	Name   string
+	Unique bool
+	// Type contains the index type BTREE, HASH, FULLTEXT or SPATIAL. Empty
+	// means BTREE.
+	Type    string
+	Columns []string
+	// SubParts contains per column the number of indexed characters of a
+	// prefix index or zero if the whole column gets indexed. Can be nil.
+	SubParts []int
+}
+
+// IsPrimary returns true if the index is the primary key.
+func (i *Index) IsPrimary() bool { return i.Name == IndexPrimary }
+
+func (i *Index) indexType() string {
+	if i.Type == "" {
+		return "BTREE"
+	}
+	return strings.ToUpper(i.Type)
+}
+
+func (i *Index) subPart(col int) int {
+	if col < len(i.SubParts) {
+		return i.SubParts[col]
+	}
+	return 0
+}
+
+// Equal compares the uniqueness, the type, the columns and the prefix lengths
+// of both indexes.
+func (i *Index) Equal(o *Index) bool {
+	if i.Unique != o.Unique || i.indexType() != o.indexType() || !strSliceEqualFold(i.Columns, o.Columns) {
+		return false
+	}
+	for j := range i.Columns {
+		if i.subPart(j) != o.subPart(j) {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the definition as used in ALTER TABLE ... ADD.
+func (i *Index) String() string {
+	var buf strings.Builder
+	switch typ := i.indexType(); {
+	case i.IsPrimary():
+		buf.WriteString("PRIMARY KEY")
+	case i.Unique:
+		buf.WriteString("UNIQUE KEY")
+	case typ == "FULLTEXT", typ == "SPATIAL":
+		buf.WriteString(typ)
+		buf.WriteString(" KEY")
+	default:
+		buf.WriteString("KEY")
+	}
+	if !i.IsPrimary() {
+		buf.WriteByte(' ')
+		buf.WriteString(dml.Quoter.Name(i.Name))
+	}
+	buf.WriteString(" (")
+	for j, c := range i.Columns {
+		if j > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(dml.Quoter.Name(c))
+		if sp := i.subPart(j); sp > 0 {
+			buf.WriteByte('(')
+			buf.WriteString(strconv.Itoa(sp))
+			buf.WriteByte(')')
+		}
+	}
+	buf.WriteByte(')')
+	if i.indexType() == "HASH" {
+		buf.WriteString(" USING HASH")
+	}
+	return buf.String()
+}
+
+// Indexes a list of indexes.
+type Indexes []*Index
+
+// ByName returns an index by its name, case-insensitive, or nil.
+func (is Indexes) ByName(name string) *Index {
+	for _, i := range is {
+		if strings.EqualFold(i.Name, name) {
+			return i
+		}
+	}
+	return nil
+}
+
+// ForeignKey describes a foreign key constraint as stored in
+// information_schema.KEY_COLUMN_USAGE and REFERENTIAL_CONSTRAINTS.
+type ForeignKey struct {
+	Name              string
+	Columns           []string
+	ReferencedTable   string
+	ReferencedColumns []string
+	// OnDelete and OnUpdate contain the referential actions like CASCADE,
+	// SET NULL, RESTRICT or NO ACTION. Empty means the default RESTRICT.
+	OnDelete string
+	OnUpdate string
+}
+
+func fkRule(r string) string {
+	if r == "" || strings.EqualFold(r, "NO ACTION") {
+		return "RESTRICT"
+	}
+	return strings.ToUpper(r)
+}
+
+// Equal compares the columns, the referenced table and columns and the
+// referential actions of both foreign keys.
+func (fk *ForeignKey) Equal(o *ForeignKey) bool {
+	return strSliceEqualFold(fk.Columns, o.Columns) &&
+		strings.EqualFold(fk.ReferencedTable, o.ReferencedTable) &&
+		strSliceEqualFold(fk.ReferencedColumns, o.ReferencedColumns) &&
+		fkRule(fk.OnDelete) == fkRule(o.OnDelete) &&
+		fkRule(fk.OnUpdate) == fkRule(o.OnUpdate)
+}
+
+// String returns the definition as used in ALTER TABLE ... ADD.
+func (fk *ForeignKey) String() string {
+	var buf strings.Builder
+	buf.WriteString("CONSTRAINT ")
+	buf.WriteString(dml.Quoter.Name(fk.Name))
+	buf.WriteString(" FOREIGN KEY (")
+	for i, c := range fk.Columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(dml.Quoter.Name(c))
+	}
+	buf.WriteString(") REFERENCES ")
+	buf.WriteString(dml.Quoter.Name(fk.ReferencedTable))
+	buf.WriteString(" (")
+	for i, c := range fk.ReferencedColumns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(dml.Quoter.Name(c))
+	}
+	buf.WriteString(") ON DELETE ")
+	buf.WriteString(fkRule(fk.OnDelete))
+	buf.WriteString(" ON UPDATE ")
+	buf.WriteString(fkRule(fk.OnUpdate))
+	return buf.String()
+}
+
+// ForeignKeys a list of foreign keys.
+type ForeignKeys []*ForeignKey
+
+// ByName returns a foreign key by its name, case-insensitive, or nil.
+func (fks ForeignKeys) ByName(name string) *ForeignKey {
+	for _, fk := range fks {
+		if strings.EqualFold(fk.Name, name) {
+			return fk
+		}
+	}
+	return nil
+}
+
+func strSliceEqualFold(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+const selIndexes = `SELECT TABLE_NAME, INDEX_NAME, NON_UNIQUE, COLUMN_NAME, SUB_PART, INDEX_TYPE
+	 FROM information_schema.STATISTICS WHERE TABLE_SCHEMA=DATABASE() AND TABLE_NAME IN ?
+	 ORDER BY TABLE_NAME, INDEX_NAME, SEQ_IN_INDEX`
+
+// LoadIndexes returns all indexes from a list of table names in the current
+// database. Map key contains the table name. Tables without an index are not
+// part of the map.
+func LoadIndexes(ctx context.Context, db dml.Querier, tables ...string) (_ map[string]Indexes, err error) {
+	rows, err := queryTables(ctx, db, selIndexes, tables)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[ddl] LoadIndexes QueryContext for tables %v", tables)
+	}
+	defer func() {
+		if err2 := rows.Close(); err2 != nil && err == nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+
+	tc := make(map[string]Indexes)
+	for rows.Next() {
+		var tableName, indexName, columnName, indexType string
+		var nonUnique int64
+		var subPart sql.NullInt64
+		if err = rows.Scan(&tableName, &indexName, &nonUnique, &columnName, &subPart, &indexType); err != nil {
+			return nil, errors.Wrapf(err, "[ddl] LoadIndexes Scan Query for tables: %v", tables)
+		}
+		idx := tc[tableName].ByName(indexName)
+		if idx == nil {
+			idx = &Index{Name: indexName, Unique: nonUnique == 0, Type: indexType}
+			tc[tableName] = append(tc[tableName], idx)
+		}
+		idx.Columns = append(idx.Columns, columnName)
+		idx.SubParts = append(idx.SubParts, int(subPart.Int64))
+	}
+	return tc, errors.WithStack(rows.Err())
+}
+
+const selForeignKeys = `SELECT kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.COLUMN_NAME,
+	kcu.REFERENCED_TABLE_NAME, kcu.REFERENCED_COLUMN_NAME, rc.DELETE_RULE, rc.UPDATE_RULE
+	 FROM information_schema.KEY_COLUMN_USAGE kcu
+	 JOIN information_schema.REFERENTIAL_CONSTRAINTS rc ON rc.CONSTRAINT_SCHEMA = kcu.CONSTRAINT_SCHEMA
+	  AND rc.TABLE_NAME = kcu.TABLE_NAME AND rc.CONSTRAINT_NAME = kcu.CONSTRAINT_NAME
+	 WHERE kcu.TABLE_SCHEMA=DATABASE() AND kcu.TABLE_NAME IN ?
+	 ORDER BY kcu.TABLE_NAME, kcu.CONSTRAINT_NAME, kcu.ORDINAL_POSITION`
+
+// LoadForeignKeys returns all foreign keys from a list of table names in the
+// current database. Map key contains the table name which owns the foreign
+// key, contrary to LoadKeyColumnUsage. Tables without a foreign key are not
+// part of the map.
+func LoadForeignKeys(ctx context.Context, db dml.Querier, tables ...string) (_ map[string]ForeignKeys, err error) {
+	rows, err := queryTables(ctx, db, selForeignKeys, tables)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[ddl] LoadForeignKeys QueryContext for tables %v", tables)
+	}
+	defer func() {
+		if err2 := rows.Close(); err2 != nil && err == nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+
+	tc := make(map[string]ForeignKeys)
+	for rows.Next() {
+		var tableName, name, column, refTable, refColumn, onDelete, onUpdate string
+		if err = rows.Scan(&tableName, &name, &column, &refTable, &refColumn, &onDelete, &onUpdate); err != nil {
+			return nil, errors.Wrapf(err, "[ddl] LoadForeignKeys Scan Query for tables: %v", tables)
+		}
+		fk := tc[tableName].ByName(name)
+		if fk == nil {
+			fk = &ForeignKey{Name: name, ReferencedTable: refTable, OnDelete: onDelete, OnUpdate: onUpdate}
+			tc[tableName] = append(tc[tableName], fk)
+		}
+		fk.Columns = append(fk.Columns, column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, refColumn)
+	}
+	return tc, errors.WithStack(rows.Err())
+}
+
+// queryTables expands the place holder in sqlStr with the table names.
+func queryTables(ctx context.Context, db dml.Querier, sqlStr string, tables []string) (*sql.Rows, error) {
+	if len(tables) == 0 {
+		return nil, errors.Empty.Newf("[ddl] At least one table name is required")
+	}
+	sqlStr, _, err := dml.Interpolate(sqlStr).Strs(tables...).ToSQL()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	rows, err := db.QueryContext(ctx, sqlStr)
+	return rows, errors.WithStack(err)
+}
@@ -81,6 +81,8 @@ func TestMasterStatus_FromString(t *testing.T) {
 		wantString   string
 	}{
 		{"mysql-bin.000004;545460", "mysql-bin.000004", 545460, errors.NoKind, "mysql-bin.000004;545460"},
+		{"mysql-bin.000004;545460;0-1-42", "mysql-bin.000004", 545460, errors.NoKind, "mysql-bin.000004;545460"},
+		{"mysql-bin.000004;x;0-1-42", "", 0, errors.NotValid, ""},
 		{"mysql-bin.000004;", "", 0, errors.NotValid, ""},
 		{"mysql-bin.000004", "", 0, errors.NotFound, ""},
 	}
@@ -113,4 +115,14 @@ func TestMasterStatus_WriteTo(t *testing.T) {
 	assert.NoError(t, err)
 
 	assert.Exactly(t, "mysql-bin.000004;545460", buf.String())
+
+	buf.Reset()
+	ms.ExecutedGTIDSet = "3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5"
+	_, err = ms.WriteTo(&buf)
+	assert.NoError(t, err)
+	assert.Exactly(t, "mysql-bin.000004;545460;3E11FA47-71CA-11E1-9E33-C80AA9429562:1-5", buf.String())
+
+	var ms2 ddl.MasterStatus
+	assert.NoError(t, ms2.FromString(buf.String()))
+	assert.Exactly(t, *ms, ms2)
 }
@@ -38,6 +38,10 @@ type Table struct {
 	// Columns all table columns. They do not get used to create or alter a
 	// table.
 	Columns Columns
+	// Indexes and ForeignKeys are optional and only used by DiffSchema to
+	// compare the expected table with the live database table.
+	Indexes     Indexes
+	ForeignKeys ForeignKeys
 	// Listeners specific pre defined listeners which gets dispatches to each
 	// DML statement (SELECT, INSERT, UPDATE or DELETE).
 	Listeners dml.ListenerBucket
@@ -174,7 +178,9 @@ func (t *Table) Rename(ctx context.Context, execer dml.Execer, new string) error
 // Swap swaps the current table with the other table of the same structure.
 // Renaming is an atomic operation in the database. Note: indexes won't get
 // swapped! As long as two databases are on the same file system, you can use
-// RENAME TABLE to move a table from one database to another.
+// RENAME TABLE to move a table from one database to another. Swapping tables
+// locked with LOCK TABLES requires at least MySQL 8.0.13, older versions
+// reject RENAME TABLE within LOCK TABLES.
 func (t *Table) Swap(ctx context.Context, execer dml.Execer, other string) error {
 	if err := dml.IsValidIdentifier(t.Name); err != nil {
 		return errors.WithStack(err)
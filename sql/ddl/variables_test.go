@@ -29,10 +29,11 @@ import (
 )
 
 var (
-	_ dml.ColumnMapper = (*Variables)(nil)
-	_ dml.QueryBuilder = (*Variables)(nil)
-	_ errors.Kinder    = (*errTableNotFound)(nil)
-	_ error            = (*errTableNotFound)(nil)
+	_ dml.ColumnMapper   = (*Variables)(nil)
+	_ dml.QueryBuilder   = (*Variables)(nil)
+	_ dml.VariableReader = (*Variables)(nil)
+	_ errors.Kinder      = (*errTableNotFound)(nil)
+	_ error              = (*errTableNotFound)(nil)
 )
 
 func TestErrTableNotFound(t *testing.T) {
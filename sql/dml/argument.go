@@ -72,6 +72,16 @@ func (arg *argument) set(v interface{}) {
 	arg.value = v
 }
 
+// isSlice reports whether the value is a slice type, even if it contains only
+// one element.
+func (arg *argument) isSlice() bool {
+	switch arg.value.(type) {
+	case nil, int, int64, uint64, float64, bool, string, []byte, time.Time, null.String, null.Int64, null.Float64, null.Bool, null.Time:
+		return false
+	}
+	return true
+}
+
 func (arg *argument) len() (l int) {
 	switch v := arg.value.(type) {
 	case nil, int, int64, uint64, float64, bool, string, []byte, time.Time, null.String, null.Int64, null.Float64, null.Bool, null.Time:
@@ -113,6 +123,11 @@ func (arg *argument) len() (l int) {
 
 // writeTo mainly used in interpolate function
 func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
+	return arg.writeToDialect(dialect, w, pos)
+}
+
+// writeToDialect same as writeTo but escapes the values with the dialect `d`.
+func (arg argument) writeToDialect(d Dialect, w *bytes.Buffer, pos uint) (err error) {
 	if !arg.isSet {
 		return nil
 	}
@@ -153,17 +168,17 @@ func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
 			w.WriteByte(')')
 		}
 	case null.Int64:
-		err = v.WriteTo(dialect, w)
+		err = v.WriteTo(d, w)
 	case []null.Int64:
 		if requestPos {
-			err = v[pos].WriteTo(dialect, w)
+			err = v[pos].WriteTo(d, w)
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = v[i].WriteTo(dialect, w)
+				err = v[i].WriteTo(d, w)
 			}
 			w.WriteByte(')')
 		}
@@ -219,47 +234,47 @@ func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
 			w.WriteByte(')')
 		}
 	case null.Float64:
-		err = v.WriteTo(dialect, w)
+		err = v.WriteTo(d, w)
 	case []null.Float64:
 		if requestPos {
-			err = v[pos].WriteTo(dialect, w)
+			err = v[pos].WriteTo(d, w)
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = v[i].WriteTo(dialect, w)
+				err = v[i].WriteTo(d, w)
 			}
 			w.WriteByte(')')
 		}
 	case bool:
-		dialect.EscapeBool(w, v)
+		d.EscapeBool(w, v)
 	case []bool:
 		if requestPos {
-			dialect.EscapeBool(w, v[pos])
+			d.EscapeBool(w, v[pos])
 		} else {
 			w.WriteByte('(')
 			for i, val := range v {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				dialect.EscapeBool(w, val)
+				d.EscapeBool(w, val)
 			}
 			w.WriteByte(')')
 		}
 	case null.Bool:
-		v.WriteTo(dialect, w)
+		v.WriteTo(d, w)
 	case []null.Bool:
 		if requestPos {
-			v[pos].WriteTo(dialect, w)
+			v[pos].WriteTo(d, w)
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = v[i].WriteTo(dialect, w)
+				err = v[i].WriteTo(d, w)
 			}
 			w.WriteByte(')')
 		}
@@ -267,11 +282,11 @@ func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
 		if !utf8.ValidString(v) {
 			return errors.NotValid.Newf("[dml] Argument.WriteTo: String is not UTF-8: %q", v)
 		}
-		dialect.EscapeString(w, v)
+		d.EscapeString(w, v)
 	case []string:
 		if requestPos {
 			if nv := v[pos]; utf8.ValidString(nv) {
-				dialect.EscapeString(w, nv)
+				d.EscapeString(w, nv)
 			} else {
 				err = errors.NotValid.Newf("[dml] Argument.WriteTo: String is not UTF-8: %q", nv)
 			}
@@ -282,7 +297,7 @@ func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
 					w.WriteByte(',')
 				}
 				if nv := v[i]; utf8.ValidString(nv) {
-					dialect.EscapeString(w, nv)
+					d.EscapeString(w, nv)
 				} else {
 					err = errors.NotValid.Newf("[dml] Argument.WriteTo: String is not UTF-8: %q", nv)
 				}
@@ -290,63 +305,63 @@ func (arg argument) writeTo(w *bytes.Buffer, pos uint) (err error) {
 			w.WriteByte(')')
 		}
 	case null.String:
-		err = v.WriteTo(dialect, w)
+		err = v.WriteTo(d, w)
 	case []null.String:
 		if requestPos {
-			err = v[pos].WriteTo(dialect, w)
+			err = v[pos].WriteTo(d, w)
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = v[i].WriteTo(dialect, w)
+				err = v[i].WriteTo(d, w)
 			}
 			w.WriteByte(')')
 		}
 	case []byte:
-		err = writeBytes(w, v)
+		err = writeBytes(d, w, v)
 
 	case [][]byte:
 		if requestPos {
-			err = writeBytes(w, v[pos])
+			err = writeBytes(d, w, v[pos])
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = writeBytes(w, v[i])
+				err = writeBytes(d, w, v[i])
 			}
 			w.WriteByte(')')
 		}
 	case time.Time:
-		dialect.EscapeTime(w, v)
+		d.EscapeTime(w, v)
 	case []time.Time:
 		if requestPos {
-			dialect.EscapeTime(w, v[pos])
+			d.EscapeTime(w, v[pos])
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					err = w.WriteByte(',')
 				}
-				dialect.EscapeTime(w, v[i])
+				d.EscapeTime(w, v[i])
 			}
 			w.WriteByte(')')
 		}
 	case null.Time:
-		err = v.WriteTo(dialect, w)
+		err = v.WriteTo(d, w)
 	case []null.Time:
 		if requestPos {
-			err = v[pos].WriteTo(dialect, w)
+			err = v[pos].WriteTo(d, w)
 		} else {
 			w.WriteByte('(')
 			for l, i := len(v), 0; i < l && err == nil; i++ {
 				if i > 0 {
 					w.WriteByte(',')
 				}
-				err = v[i].WriteTo(dialect, w)
+				err = v[i].WriteTo(d, w)
 			}
 			w.WriteByte(')')
 		}
@@ -549,6 +564,16 @@ func (as arguments) Len() int {
 	return l
 }
 
+// hasSlice reports whether at least one argument is a slice type.
+func (as arguments) hasSlice() bool {
+	for _, arg := range as {
+		if arg.isSlice() {
+			return true
+		}
+	}
+	return false
+}
+
 // Write writes all arguments into buf and separates by a comma.
 func (as arguments) Write(buf *bytes.Buffer) error {
 	if len(as) > 1 {
@@ -65,8 +65,14 @@ type Artisan struct {
 	hasNamedArgs      uint8 // 0 not checked, 1=no, 2=yes
 	nextUnnamedArgPos int
 	raw               []interface{}
+	// span of the running query, ended after reading all rows.
+	span Span
 	arguments
 	recs []QualifiedRecord
+	// cache, cacheTTL and cacheTags are set via WithCache.
+	cache     *QueryCache
+	cacheTTL  time.Duration
+	cacheTags []string
 }
 
 const (
@@ -158,8 +164,19 @@ func (a *Artisan) isEmpty() bool {
 // its arguments to the `extArgs` arguments from the Exec+ or Query+ function.
 // This allows for a developer to reuse the interface slice and save
 // allocations. All method receivers are not thread safe. The returned interface
-// slice is the same as `extArgs`.
-func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}, err error) {
+// slice is the same as `extArgs`. The returned SQL string has been translated
+// into the dialect of the connection.
+func (a *Artisan) prepareArgs(extArgs ...interface{}) (string, []interface{}, error) {
+	sqlStr, args, err := a.prepareArgsCanonical(extArgs...)
+	if err != nil || sqlStr == "" || a.base.dialect == nil {
+		return sqlStr, args, err
+	}
+	return translateSQL(a.base.dialect, sqlStr), args, nil
+}
+
+// prepareArgsCanonical creates the MySQL flavoured SQL string and collects the
+// arguments.
+func (a *Artisan) prepareArgsCanonical(extArgs ...interface{}) (_ string, _ []interface{}, err error) {
 	if a.base.ärgErr != nil {
 		return "", nil, errors.WithStack(a.base.ärgErr)
 	}
@@ -181,9 +198,7 @@ func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}
 		}
 		buf := bufferpool.Get()
 		defer bufferpool.Put(buf)
-		buf.Write(a.base.cachedSQL)
-		sqlWriteOrderBy(buf, a.OrderBys, false)
-		sqlWriteLimitOffset(buf, a.LimitValid, a.OffsetValid, a.OffsetCount, a.LimitCount)
+		a.writeCachedSQL(buf)
 		return buf.String(), extArgs, nil
 	}
 
@@ -223,12 +238,7 @@ func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}
 	// worst case. Best case would be no modification and hence we don't need a
 	// bytes.Buffer from the pool! TODO(CYS) optimize this and only acquire a
 	// buffer from the pool in the worse case.
-	if _, err := sqlBuf.First.Write(a.base.cachedSQL); err != nil {
-		return "", nil, errors.WithStack(err)
-	}
-
-	sqlWriteOrderBy(sqlBuf.First, a.OrderBys, false)
-	sqlWriteLimitOffset(sqlBuf.First, a.LimitValid, a.OffsetValid, a.OffsetCount, a.LimitCount)
+	a.writeCachedSQL(sqlBuf.First)
 
 	// `switch` statement no suitable.
 	if a.Options > 0 && len(extArgs) > 0 && len(a.recs) == 0 && len(a.arguments) == 0 {
@@ -236,7 +246,7 @@ func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}
 	}
 
 	if a.Options&argOptionExpandPlaceholder != 0 {
-		if phCount := bytes.Count(sqlBuf.First.Bytes(), placeHolderByte); phCount < a.Len() {
+		if phCount := bytes.Count(sqlBuf.First.Bytes(), placeHolderByte); phCount < a.Len() || collectedArgs.hasSlice() {
 			if err := expandPlaceHolders(sqlBuf.Second, sqlBuf.First.Bytes(), collectedArgs); err != nil {
 				return "", nil, errors.WithStack(err)
 			}
@@ -246,7 +256,7 @@ func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}
 		}
 	}
 	if a.Options&argOptionInterpolate != 0 {
-		if err := writeInterpolateBytes(sqlBuf.Second, sqlBuf.First.Bytes(), collectedArgs); err != nil {
+		if err := writeInterpolateBytes(a.base.getDialect(), sqlBuf.Second, sqlBuf.First.Bytes(), collectedArgs); err != nil {
 			return "", nil, errors.Wrapf(err, "[dml] Interpolation failed: %q", sqlBuf.String())
 		}
 		return sqlBuf.Second.String(), nil, nil
@@ -255,6 +265,24 @@ func (a *Artisan) prepareArgs(extArgs ...interface{}) (_ string, _ []interface{}
 	return sqlBuf.First.String(), collectedArgs.Interfaces(extArgs...), nil
 }
 
+// writeCachedSQL writes the cached SQL and appends the ORDER BY and LIMIT
+// clauses. The clauses get inserted before an existing RETURNING clause.
+func (a *Artisan) writeCachedSQL(w *bytes.Buffer) {
+	cachedSQL := a.base.cachedSQL
+	if len(a.OrderBys) == 0 && !a.LimitValid {
+		w.Write(cachedSQL)
+		return
+	}
+	var tail []byte
+	if pos := bytes.Index(cachedSQL, returningPart); pos > 0 {
+		cachedSQL, tail = cachedSQL[:pos], cachedSQL[pos:]
+	}
+	w.Write(cachedSQL)
+	sqlWriteOrderBy(w, a.OrderBys, false)
+	sqlWriteLimitOffset(w, a.LimitValid, a.OffsetValid, a.OffsetCount, a.LimitCount)
+	w.Write(tail)
+}
+
 func (a *Artisan) appendConvertedRecordsToArguments(collectedArgs arguments) (arguments, error) {
 	if a.base.templateStmtCount == 0 {
 		a.base.templateStmtCount = 1
@@ -380,7 +408,7 @@ func (a *Artisan) prepareArgsInsert(extArgs ...interface{}) (string, []interface
 	totalArgLen := uint(len(cm.arguments) + len(extArgs))
 
 	if !a.insertIsBuildValues && lenInsertCachedSQL == 0 { // Write placeholder list e.g. "VALUES (?,?),(?,?)"
-		odkPos := bytes.Index(a.base.cachedSQL, onDuplicateKeyPart)
+		odkPos := insertTailPos(a.base.cachedSQL)
 		if odkPos > 0 {
 			sqlBuf.First.Reset()
 			sqlBuf.First.Write(a.base.cachedSQL[:odkPos])
@@ -409,7 +437,7 @@ func (a *Artisan) prepareArgsInsert(extArgs ...interface{}) (string, []interface
 		}
 
 		if a.Options&argOptionInterpolate != 0 {
-			if err := writeInterpolateBytes(sqlBuf.Second, sqlBuf.First.Bytes(), cm.arguments); err != nil {
+			if err := writeInterpolateBytes(a.base.getDialect(), sqlBuf.Second, sqlBuf.First.Bytes(), cm.arguments); err != nil {
 				return "", nil, errors.Wrapf(err, "[dml] Interpolation failed: %q", sqlBuf.First.String())
 			}
 			return sqlBuf.Second.String(), nil, nil
@@ -683,16 +711,58 @@ func (a *Artisan) ExecContext(ctx context.Context, args ...interface{}) (sql.Res
 
 // QueryContext traditional way of the databasel/sql package.
 func (a *Artisan) QueryContext(ctx context.Context, args ...interface{}) (*sql.Rows, error) {
-	return a.query(ctx, args...)
+	rows, err := a.query(ctx, args...)
+	if a.span != nil { // the rows get read by the caller
+		endSpan(a.span, err)
+		a.span = nil
+	}
+	return rows, err
 }
 
-// QueryRowContext traditional way of the databasel/sql package.
-func (a *Artisan) QueryRowContext(ctx context.Context, args ...interface{}) *sql.Row {
+// QueryRowContext traditional way of the databasel/sql package. The returned
+// Row must be scanned to end the tracing span, see WithTracer.
+func (a *Artisan) QueryRowContext(ctx context.Context, args ...interface{}) *Row {
 	sqlStr, args, err := a.prepareArgs(args...)
 	if a.base.Log != nil && a.base.Log.IsDebug() {
 		defer log.WhenDone(a.base.Log).Debug("QueryRowContext", log.String("sql", sqlStr), log.String("source", string(a.base.source)), log.Err(err))
 	}
-	return a.base.DB.QueryRowContext(ctx, sqlStr, args...)
+	ctx, span := a.startSpan(ctx, SpanNameQueryRow, sqlStr)
+	if err != nil {
+		endSpan(span, err)
+		span = nil
+	}
+	return &Row{
+		Row:  a.base.DB.QueryRowContext(ctx, sqlStr, args...),
+		span: span,
+	}
+}
+
+// Row wraps the result of QueryRowContext. The tracing span of the query ends
+// with the call to Scan because the query runs until the row has been read.
+type Row struct {
+	*sql.Row
+	span Span
+}
+
+// Scan copies the columns from the matched row into the values pointed at by
+// dest, see sql.Row.Scan. Returns sql.ErrNoRows if no row matches, which does
+// not count as an error of the tracing span.
+func (r *Row) Scan(dest ...interface{}) error {
+	err := r.Row.Scan(dest...)
+	if r.span != nil {
+		switch err {
+		case nil:
+			r.span.SetAttribute(SpanAttrRowsReturned, uint64(1))
+			endSpan(r.span, nil)
+		case sql.ErrNoRows:
+			r.span.SetAttribute(SpanAttrRowsReturned, uint64(0))
+			endSpan(r.span, nil)
+		default:
+			endSpan(r.span, err)
+		}
+		r.span = nil
+	}
+	return err
 }
 
 // IterateSerial iterates in serial order over the result set by loading one row each
@@ -708,6 +778,8 @@ func (a *Artisan) IterateSerial(ctx context.Context, callBack func(*ColumnMap) e
 		err = errors.Wrapf(err, "[dml] IterateSerial.Query with query ID %q", a.base.id)
 		return
 	}
+	var rowCount uint64
+	defer func() { a.endQuerySpan(rowCount, err) }()
 	cmr := pooledColumnMapGet() // this sync.Pool might not work correctly, write a complex test.
 	defer pooledBufferColumnMapPut(cmr, nil, func() {
 		// Not testable with the sqlmock package :-(
@@ -725,6 +797,7 @@ func (a *Artisan) IterateSerial(ctx context.Context, callBack func(*ColumnMap) e
 			err = errors.WithStack(err)
 			return
 		}
+		rowCount++
 	}
 	err = errors.WithStack(r.Err())
 	return
@@ -733,7 +806,7 @@ func (a *Artisan) IterateSerial(ctx context.Context, callBack func(*ColumnMap) e
 // iterateParallelForNextLoop has been extracted from IterateParallel to not
 // mess around with closing channels in different locations of the source code
 // when an error occurs.
-func iterateParallelForNextLoop(r *sql.Rows, rowChan chan<- *ColumnMap, errChan <-chan error) (err error) {
+func iterateParallelForNextLoop(r *sql.Rows, rowChan chan<- *ColumnMap, errChan <-chan error) (idx uint64, err error) {
 	defer func() {
 		if err2 := r.Err(); err2 != nil && err == nil {
 			err = errors.WithStack(err)
@@ -743,7 +816,6 @@ func iterateParallelForNextLoop(r *sql.Rows, rowChan chan<- *ColumnMap, errChan
 		}
 	}()
 
-	var idx uint64
 	for r.Next() {
 		var cm ColumnMap // must be empty because we're not collecting data
 		if errS := cm.Scan(r); errS != nil {
@@ -802,9 +874,11 @@ func (a *Artisan) IterateParallel(ctx context.Context, concurrencyLevel int, cal
 		}(&wg, rowChan, errChan)
 	}
 
-	if err2 := iterateParallelForNextLoop(r, rowChan, errChan); err2 != nil {
+	rowCount, err2 := iterateParallelForNextLoop(r, rowChan, errChan)
+	if err2 != nil {
 		err = err2
 	}
+	defer func() { a.endQuerySpan(rowCount, err) }()
 	close(rowChan)
 	wg.Wait()
 	close(errChan)
@@ -831,12 +905,16 @@ func (a *Artisan) Load(ctx context.Context, s ColumnMapper, args ...interface{})
 	if a.base.Log != nil && a.base.Log.IsDebug() {
 		defer log.WhenDone(a.base.Log).Debug("Load", log.String("id", a.base.id), log.Err(err), log.ObjectTypeOf("ColumnMapper", s), log.Uint64("row_count", rowCount))
 	}
+	if a.cache != nil {
+		return a.loadCachedColumnMapper(ctx, s, args...)
+	}
 
 	r, err := a.query(ctx, args...)
 	if err != nil {
 		err = errors.Wrapf(err, "[dml] Artisan.Load.QueryContext failed with queryID %q and ColumnMapper %T", a.base.id, s)
 		return
 	}
+	defer func() { a.endQuerySpan(rowCount, err) }()
 	cm := pooledColumnMapGet()
 	defer pooledBufferColumnMapPut(cm, nil, func() {
 		a.Reset()
@@ -929,6 +1007,11 @@ func (a *Artisan) loadPrimitive(ctx context.Context, ptr interface{}, args ...in
 		if errC := rows.Close(); err == nil && errC != nil {
 			err = errors.WithStack(errC)
 		}
+		var rowCount uint64
+		if found {
+			rowCount = 1
+		}
+		a.endQuerySpan(rowCount, err)
 	}()
 
 	for rows.Next() && !found {
@@ -952,17 +1035,22 @@ func (a *Artisan) LoadInt64s(ctx context.Context, dest []int64, args ...interfac
 		// do not use fullSQL because we might log sensitive data
 		defer log.WhenDone(a.base.Log).Debug("LoadInt64s", log.Int("row_count", rowCount), log.Err(err))
 	}
+	if a.cache != nil {
+		return a.loadCachedInt64s(ctx, dest, args...)
+	}
 	var r *sql.Rows
 	r, err = a.query(ctx, args...)
 	if err != nil {
 		err = errors.WithStack(err)
 		return
 	}
+	var scanned uint64
 	defer func() {
 		a.Reset() // reset the internal slices to avoid adding more and more arguments when a query gets executed
 		if cErr := r.Close(); err == nil && cErr != nil {
 			err = errors.WithStack(cErr)
 		}
+		a.endQuerySpan(scanned, err)
 	}()
 	for r.Next() {
 		var nv null.Int64
@@ -970,6 +1058,7 @@ func (a *Artisan) LoadInt64s(ctx context.Context, dest []int64, args ...interfac
 			err = errors.WithStack(err)
 			return
 		}
+		scanned++
 		if nv.Valid {
 			dest = append(dest, nv.Int64)
 		}
@@ -991,17 +1080,22 @@ func (a *Artisan) LoadUint64s(ctx context.Context, dest []uint64, args ...interf
 		// do not use fullSQL because we might log sensitive data
 		defer log.WhenDone(a.base.Log).Debug("LoadUint64s", log.Int("row_count", rowCount), log.String("id", a.base.id), log.Err(err))
 	}
+	if a.cache != nil {
+		return a.loadCachedUint64s(ctx, dest, args...)
+	}
 
 	rows, err := a.query(ctx, args...)
 	if err != nil {
 		err = errors.WithStack(err)
 		return
 	}
+	var scanned uint64
 	defer func() {
 		a.Reset() // reset the internal slices to avoid adding more and more arguments when a query gets executed
 		if errC := rows.Close(); errC != nil && err == nil {
 			err = errors.WithStack(errC)
 		}
+		a.endQuerySpan(scanned, err)
 	}()
 
 	for rows.Next() {
@@ -1010,6 +1104,7 @@ func (a *Artisan) LoadUint64s(ctx context.Context, dest []uint64, args ...interf
 			err = errors.WithStack(err)
 			return
 		}
+		scanned++
 		if nv.Valid {
 			dest = append(dest, nv.Uint64)
 		}
@@ -1029,17 +1124,22 @@ func (a *Artisan) LoadFloat64s(ctx context.Context, dest []float64, args ...inte
 		// do not use fullSQL because we might log sensitive data
 		defer log.WhenDone(a.base.Log).Debug("LoadFloat64s", log.String("id", a.base.id), log.Err(err))
 	}
+	if a.cache != nil {
+		return a.loadCachedFloat64s(ctx, dest, args...)
+	}
 
 	var rows *sql.Rows
 	if rows, err = a.query(ctx, args...); err != nil {
 		err = errors.WithStack(err)
 		return
 	}
+	var scanned uint64
 	defer func() {
 		a.Reset() // reset the internal slices to avoid adding more and more arguments when a query gets executed
 		if errC := rows.Close(); errC != nil && err == nil {
 			err = errors.WithStack(errC)
 		}
+		a.endQuerySpan(scanned, err)
 	}()
 
 	for rows.Next() {
@@ -1048,6 +1148,7 @@ func (a *Artisan) LoadFloat64s(ctx context.Context, dest []float64, args ...inte
 			err = errors.WithStack(err)
 			return
 		}
+		scanned++
 		if nv.Valid {
 			dest = append(dest, nv.Float64)
 		}
@@ -1067,17 +1168,22 @@ func (a *Artisan) LoadStrings(ctx context.Context, dest []string, args ...interf
 		// do not use fullSQL because we might log sensitive data
 		defer log.WhenDone(a.base.Log).Debug("LoadStrings", log.Int("row_count", rowCount), log.String("id", a.base.id), log.Err(err))
 	}
+	if a.cache != nil {
+		return a.loadCachedStrings(ctx, dest, args...)
+	}
 
 	rows, err := a.query(ctx, args...)
 	if err != nil {
 		err = errors.WithStack(err)
 		return
 	}
+	var scanned uint64
 	defer func() {
 		a.Reset() // reset the internal slices to avoid adding more and more arguments when a query gets executed
 		if errC := rows.Close(); errC != nil && err == nil {
 			err = errors.WithStack(errC)
 		}
+		a.endQuerySpan(scanned, err)
 	}()
 
 	for rows.Next() {
@@ -1086,6 +1192,7 @@ func (a *Artisan) LoadStrings(ctx context.Context, dest []string, args ...interf
 			err = errors.WithStack(err)
 			return
 		}
+		scanned++
 		if value.Valid {
 			dest = append(dest, value.String)
 		}
@@ -1104,7 +1211,9 @@ func (a *Artisan) query(ctx context.Context, args ...interface{}) (rows *sql.Row
 	if a.base.Log != nil && a.base.Log.IsDebug() {
 		defer log.WhenDone(a.base.Log).Debug("Query", log.String("sql", sqlStr), log.String("source", string(a.base.source)), log.Err(err))
 	}
+	ctx, a.span = a.startSpan(ctx, SpanNameQuery, sqlStr)
 	if err != nil {
+		a.endQuerySpan(0, err)
 		return nil, errors.WithStack(err)
 	}
 
@@ -1114,16 +1223,37 @@ func (a *Artisan) query(ctx context.Context, args ...interface{}) (rows *sql.Row
 			sqlStr = "PREPARED:" + string(a.base.cachedSQL)
 		}
 		err = errors.Wrapf(err, "[dml] Query.QueryContext with query %q", sqlStr)
+		a.endQuerySpan(0, err)
 	}
 	return
 }
 
+// startSpan starts a span for a query, see WithTracer.
+func (a *Artisan) startSpan(ctx context.Context, name, sqlStr string) (context.Context, Span) {
+	ctx, span := a.base.startSpan(ctx, name, sqlStr)
+	if span != nil && a.isPrepared {
+		span.SetAttribute(SpanAttrPrepared, true)
+	}
+	return ctx, span
+}
+
 func (a *Artisan) exec(ctx context.Context, args ...interface{}) (result sql.Result, err error) {
 	sqlStr, args, err2 := a.prepareArgs(args...)
 	err = err2
 	if a.base.Log != nil && a.base.Log.IsDebug() {
 		defer log.WhenDone(a.base.Log).Debug("Exec", log.String("sql", sqlStr), log.String("source", string(a.base.source)), log.Err(err))
 	}
+	ctx, span := a.startSpan(ctx, SpanNameExec, sqlStr)
+	if span != nil {
+		defer func() {
+			if err == nil {
+				if ra, errRA := result.RowsAffected(); errRA == nil {
+					span.SetAttribute(SpanAttrRowsAffected, ra)
+				}
+			}
+			endSpan(span, err)
+		}()
+	}
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -1134,7 +1264,9 @@ func (a *Artisan) exec(ctx context.Context, args ...interface{}) (result sql.Res
 		return
 	}
 
-	if a.recs == nil {
+	// UPDATE and DELETE statements do not generate an ID, hence the records
+	// must not get overwritten.
+	if a.recs == nil || a.base.source == dmlSourceUpdate || a.base.source == dmlSourceDelete {
 		return result, nil
 	}
 	lID, err := result.LastInsertId()
@@ -1142,6 +1274,9 @@ func (a *Artisan) exec(ctx context.Context, args ...interface{}) (result sql.Res
 		err = errors.WithStack(err)
 		return
 	}
+	if lID == 0 { // e.g. no auto increment column or an ON DUPLICATE KEY UPDATE
+		return
+	}
 	for i, rec := range a.recs {
 		if a, ok := rec.Record.(LastInsertIDAssigner); ok {
 			a.AssignLastInsertID(lID + int64(i))
@@ -0,0 +1,521 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/storage/objcache"
+)
+
+// QueryCacheOptions applies optional settings to a QueryCache.
+type QueryCacheOptions struct {
+	Log log.Logger
+	// KeyPrefix gets prepended to all keys in the cache. Defaults to "dml:".
+	KeyPrefix string
+	// DefaultTTL applies when Artisan.WithCache receives a zero TTL. Zero
+	// means the entries never expire and only invalidation removes them.
+	DefaultTTL time.Duration
+}
+
+// QueryCache stores the result sets of read queries in an objcache.Manager.
+// The cache key gets derived from the final SQL string, the arguments and the
+// current versions of the tags of a query. Invalidating a tag assigns a new
+// version to it, hence all queries carrying that tag will miss the cache and
+// the old entries expire or get evicted by the backend. This works with any
+// objcache backend, also when shared by several processes. Use table names as
+// tags to invalidate the cache automatically via binlogsync.CacheInvalidator.
+// A failing cache never fails a query, errors get logged and the query hits
+// the database.
+type QueryCache struct {
+	m    *objcache.Manager
+	opts QueryCacheOptions
+	// now returns the current time, replaceable in tests.
+	now func() time.Time
+}
+
+// NewQueryCache creates a new query cache which stores the result sets with
+// Manager `m`. Argument `o` can be nil.
+func NewQueryCache(m *objcache.Manager, o *QueryCacheOptions) *QueryCache {
+	qc := &QueryCache{
+		m:   m,
+		now: time.Now,
+	}
+	if o != nil {
+		qc.opts = *o
+	}
+	if qc.opts.Log == nil {
+		qc.opts.Log = log.BlackHole{}
+	}
+	if qc.opts.KeyPrefix == "" {
+		qc.opts.KeyPrefix = "dml:"
+	}
+	return qc
+}
+
+// Invalidate assigns new versions to the tags, which removes all cached
+// queries carrying at least one of the tags.
+func (qc *QueryCache) Invalidate(ctx context.Context, tags ...string) error {
+	for _, tag := range tags {
+		v := queryCacheTagVersion(qc.now().UnixNano())
+		var prev queryCacheTagVersion
+		if err := qc.m.Get(ctx, qc.tagKey(tag), &prev, nil); err == nil && prev >= v {
+			v = prev + 1 // coarse clocks
+		}
+		if err := qc.m.Set(ctx, qc.tagKey(tag), &v, nil); err != nil {
+			return errors.Wrapf(err, "[dml] QueryCache.Invalidate tag %q", tag)
+		}
+	}
+	if qc.opts.Log.IsDebug() {
+		qc.opts.Log.Debug("QueryCache.Invalidate", log.Strings("tags", tags...))
+	}
+	return nil
+}
+
+func (qc *QueryCache) tagKey(tag string) string {
+	return qc.opts.KeyPrefix + "tag:" + tag
+}
+
+// key hashes the SQL string, the arguments and the tag versions. A tag without
+// a version gets initialized, otherwise an evicted tag version would revive
+// outdated entries.
+func (qc *QueryCache) key(ctx context.Context, sqlStr string, args []interface{}, tags []string) (string, error) {
+	h := sha256.New()
+	h.Write([]byte(sqlStr))
+	for _, arg := range args {
+		fmt.Fprintf(h, "\x00%T:%v", arg, arg)
+	}
+	for _, tag := range tags {
+		var v queryCacheTagVersion
+		if err := qc.m.Get(ctx, qc.tagKey(tag), &v, nil); err != nil || v == 0 {
+			v = queryCacheTagVersion(qc.now().UnixNano())
+			if err := qc.m.Set(ctx, qc.tagKey(tag), &v, nil); err != nil {
+				return "", errors.Wrapf(err, "[dml] QueryCache tag %q", tag)
+			}
+		}
+		fmt.Fprintf(h, "\x01%s:%d", tag, v)
+	}
+	return qc.opts.KeyPrefix + "q:" + hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// WithCache enables the caching of the result set for the functions Load,
+// LoadInt64s, LoadUint64s, LoadFloat64s and LoadStrings. A zero ttl applies
+// QueryCacheOptions.DefaultTTL. Tags are usually the names of the tables the
+// query reads from. A nil QueryCache disables the caching.
+//		var qc = dml.NewQueryCache(objcacheManager, nil)
+//		ids, err := dbc.SelectFrom("customer_entity").AddColumns("entity_id").
+//			WithArgs().WithCache(qc, time.Minute, "customer_entity").LoadInt64s(ctx, nil)
+func (a *Artisan) WithCache(qc *QueryCache, ttl time.Duration, tags ...string) *Artisan {
+	a.cache = qc
+	a.cacheTTL = ttl
+	a.cacheTags = tags
+	return a
+}
+
+// loadCached returns the rows from the cache or queries the database and
+// stores the rows in the cache.
+func (a *Artisan) loadCached(ctx context.Context, args ...interface{}) (*queryCacheRows, error) {
+	qc := a.cache
+	sqlStr, qArgs, err := a.prepareArgs(args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	keySQL := sqlStr
+	if keySQL == "" {
+		keySQL = "PREPARED:" + string(a.base.cachedSQL)
+	}
+
+	key, err := qc.key(ctx, keySQL, qArgs, a.cacheTags)
+	if err != nil {
+		qc.opts.Log.Info("QueryCache.key.error", log.Err(err), log.String("id", a.base.id))
+	} else {
+		var qcr queryCacheRows
+		err := qc.m.Get(ctx, key, &qcr, nil)
+		switch {
+		case err == nil && (qcr.expires == 0 || qc.now().UnixNano() < qcr.expires):
+			if qc.opts.Log.IsDebug() {
+				qc.opts.Log.Debug("QueryCache.hit", log.String("id", a.base.id), log.String("key", key))
+			}
+			return &qcr, nil
+		case err != nil && !errors.NotFound.Match(err):
+			qc.opts.Log.Info("QueryCache.Get.error", log.Err(err), log.String("id", a.base.id), log.String("key", key))
+		}
+	}
+
+	rows, err := a.base.DB.QueryContext(ctx, sqlStr, qArgs...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[dml] Query.QueryContext with query %q", keySQL)
+	}
+	qcr, err := scanQueryCacheRows(rows)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if key == "" {
+		return qcr, nil
+	}
+
+	ttl := a.cacheTTL
+	if ttl == 0 {
+		ttl = qc.opts.DefaultTTL
+	}
+	if ttl > 0 {
+		qcr.expires = qc.now().Add(ttl).UnixNano()
+	}
+	if err := qc.m.Set(ctx, key, qcr, nil); err != nil {
+		qc.opts.Log.Info("QueryCache.Set.error", log.Err(err), log.String("id", a.base.id), log.String("key", key))
+	}
+	return qcr, nil
+}
+
+// loadCachedColumnMapper replays the cached rows through the ColumnMapper.
+func (a *Artisan) loadCachedColumnMapper(ctx context.Context, s ColumnMapper, args ...interface{}) (rowCount uint64, err error) {
+	defer a.Reset()
+	qcr, err := a.loadCached(ctx, args...)
+	if err != nil {
+		return 0, errors.Wrapf(err, "[dml] Artisan.Load.QueryContext failed with queryID %q and ColumnMapper %T", a.base.id, s)
+	}
+	cm := pooledColumnMapGet()
+	defer pooledBufferColumnMapPut(cm, nil, func() {
+		if rc, ok := s.(ioCloser); ok {
+			if err2 := rc.Close(); err2 != nil && err == nil {
+				err = errors.Wrap(err2, "[dml] Artisan.Load.ColumnMapper.Close")
+			}
+		}
+	})
+	for _, row := range qcr.rows {
+		cm.scanCached(qcr.columns, row)
+		if err = s.MapColumns(cm); err != nil {
+			return 0, errors.Wrapf(err, "[dml] Artisan.Load failed with queryID %q and ColumnMapper %T", a.base.id, s)
+		}
+	}
+	return uint64(len(qcr.rows)), nil
+}
+
+// loadCachedFirstColumn replays the first column of all cached rows through
+// the callback which must use the current column of the ColumnMap.
+func (a *Artisan) loadCachedFirstColumn(ctx context.Context, fn func(*ColumnMap), args ...interface{}) error {
+	defer a.Reset()
+	qcr, err := a.loadCached(ctx, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	cm := pooledColumnMapGet()
+	defer pooledBufferColumnMapPut(cm, nil, nil)
+	for _, row := range qcr.rows {
+		cm.scanCached(qcr.columns, row)
+		if cm.Next() {
+			fn(cm)
+		}
+		if err := cm.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func (a *Artisan) loadCachedInt64s(ctx context.Context, dest []int64, args ...interface{}) ([]int64, error) {
+	err := a.loadCachedFirstColumn(ctx, func(cm *ColumnMap) {
+		var nv null.Int64
+		if cm.NullInt64(&nv); nv.Valid {
+			dest = append(dest, nv.Int64)
+		}
+	}, args...)
+	return dest, err
+}
+
+func (a *Artisan) loadCachedUint64s(ctx context.Context, dest []uint64, args ...interface{}) ([]uint64, error) {
+	err := a.loadCachedFirstColumn(ctx, func(cm *ColumnMap) {
+		if cm.scanCol[cm.index].field == 'n' {
+			return
+		}
+		var v uint64
+		cm.Uint64(&v)
+		dest = append(dest, v)
+	}, args...)
+	return dest, err
+}
+
+func (a *Artisan) loadCachedFloat64s(ctx context.Context, dest []float64, args ...interface{}) ([]float64, error) {
+	err := a.loadCachedFirstColumn(ctx, func(cm *ColumnMap) {
+		var nv null.Float64
+		if cm.NullFloat64(&nv); nv.Valid {
+			dest = append(dest, nv.Float64)
+		}
+	}, args...)
+	return dest, err
+}
+
+func (a *Artisan) loadCachedStrings(ctx context.Context, dest []string, args ...interface{}) ([]string, error) {
+	err := a.loadCachedFirstColumn(ctx, func(cm *ColumnMap) {
+		var nv null.String
+		if cm.NullString(&nv); nv.Valid {
+			dest = append(dest, nv.String)
+		}
+	}, args...)
+	return dest, err
+}
+
+// scanCached assigns a cached row to the ColumnMap like Scan does with a row
+// of a sql.Rows.
+func (b *ColumnMap) scanCached(cols []string, row []scannedColumn) {
+	if !b.initialized {
+		b.setColumns(cols)
+		b.scanCol = append(b.scanCol[:0], row...)
+		b.scanArgs = b.scanArgs[:0]
+		for i := range b.scanCol {
+			b.scanArgs = append(b.scanArgs, &b.scanCol[i])
+		}
+		b.initialized = true
+		b.Count = 0
+		b.HasRows = true
+		return
+	}
+	b.Count++
+	copy(b.scanCol, row)
+}
+
+type queryCacheTagVersion int64
+
+func (v *queryCacheTagVersion) Marshal() ([]byte, error) {
+	return appendVarint(nil, int64(*v)), nil
+}
+
+func (v *queryCacheTagVersion) Unmarshal(data []byte) error {
+	i, n := binary.Varint(data)
+	if n <= 0 {
+		return errors.NotFound.Newf("[dml] QueryCache tag version not found or invalid")
+	}
+	*v = queryCacheTagVersion(i)
+	return nil
+}
+
+// queryCacheRows represents a cached result set. It encodes itself into a
+// compact binary format independent of the codec of the objcache.Manager.
+type queryCacheRows struct {
+	expires int64 // unix nano, zero never expires
+	columns []string
+	rows    [][]scannedColumn
+}
+
+func scanQueryCacheRows(r interface {
+	Columns() ([]string, error)
+	Next() bool
+	Scan(...interface{}) error
+	Err() error
+	Close() error
+}) (_ *queryCacheRows, err error) {
+	defer func() {
+		if err2 := r.Close(); err2 != nil && err == nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+	cols, err := r.Columns()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	qcr := &queryCacheRows{columns: cols}
+	scanArgs := make([]interface{}, len(cols))
+	for r.Next() {
+		row := make([]scannedColumn, len(cols))
+		for i := range row {
+			scanArgs[i] = &row[i]
+		}
+		if err := r.Scan(scanArgs...); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for i := range row {
+			if row[i].field == 'y' { // the driver reuses the byte slice
+				row[i].byte = append([]byte{}, row[i].byte...)
+			}
+		}
+		qcr.rows = append(qcr.rows, row)
+	}
+	return qcr, errors.WithStack(r.Err())
+}
+
+func appendVarint(buf []byte, i int64) []byte {
+	var vb [binary.MaxVarintLen64]byte
+	return append(buf, vb[:binary.PutVarint(vb[:], i)]...)
+}
+
+func appendUvarint(buf []byte, i uint64) []byte {
+	var vb [binary.MaxVarintLen64]byte
+	return append(buf, vb[:binary.PutUvarint(vb[:], i)]...)
+}
+
+func appendUvarintBytes(buf []byte, b []byte) []byte {
+	buf = appendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// Marshal encodes the result set for the objcache.Manager.
+func (qcr *queryCacheRows) Marshal() ([]byte, error) {
+	buf := make([]byte, 0, 256)
+	buf = appendVarint(buf, qcr.expires)
+	buf = appendUvarint(buf, uint64(len(qcr.columns)))
+	for _, c := range qcr.columns {
+		buf = appendUvarintBytes(buf, []byte(c))
+	}
+	buf = appendUvarint(buf, uint64(len(qcr.rows)))
+	for _, row := range qcr.rows {
+		for _, s := range row {
+			buf = append(buf, s.field)
+			switch s.field {
+			case 'i':
+				buf = appendVarint(buf, s.int64)
+			case 'f':
+				var fb [8]byte
+				binary.LittleEndian.PutUint64(fb[:], math.Float64bits(s.float64))
+				buf = append(buf, fb[:]...)
+			case 'b':
+				if s.bool {
+					buf = append(buf, 1)
+				} else {
+					buf = append(buf, 0)
+				}
+			case 'y':
+				buf = appendUvarintBytes(buf, s.byte)
+			case 's':
+				buf = appendUvarintBytes(buf, []byte(s.string))
+			case 't':
+				tb, err := s.time.MarshalBinary()
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				buf = appendUvarintBytes(buf, tb)
+			}
+		}
+	}
+	return buf, nil
+}
+
+type queryCacheDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *queryCacheDecoder) fail() {
+	if d.err == nil {
+		d.err = errors.BadEncoding.Newf("[dml] QueryCache entry is corrupt")
+	}
+	d.data = nil
+}
+
+func (d *queryCacheDecoder) varint() int64 {
+	i, n := binary.Varint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return i
+}
+
+func (d *queryCacheDecoder) uvarint() uint64 {
+	i, n := binary.Uvarint(d.data)
+	if n <= 0 {
+		d.fail()
+		return 0
+	}
+	d.data = d.data[n:]
+	return i
+}
+
+// length reads the number of the following items. Each item occupies at
+// least `minSize` bytes, hence a number which does not fit into the remaining
+// data marks the entry as corrupt.
+func (d *queryCacheDecoder) length(minSize int) int {
+	n := d.uvarint()
+	if minSize < 1 {
+		minSize = 1
+	}
+	if d.err != nil || n > uint64(len(d.data)/minSize) {
+		d.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (d *queryCacheDecoder) bytes(n uint64) []byte {
+	if uint64(len(d.data)) < n {
+		d.fail()
+		return nil
+	}
+	b := d.data[:n:n]
+	d.data = d.data[n:]
+	return b
+}
+
+// Unmarshal decodes a result set. Empty data returns a NotFound error
+// because some objcache backends do not report a missing key.
+func (qcr *queryCacheRows) Unmarshal(data []byte) error {
+	if len(data) == 0 {
+		return errors.NotFound.Newf("[dml] QueryCache entry not found")
+	}
+	d := queryCacheDecoder{data: append([]byte{}, data...)}
+	qcr.expires = d.varint()
+	qcr.columns = make([]string, 0, d.length(1))
+	for i := cap(qcr.columns); i > 0 && d.err == nil; i-- {
+		qcr.columns = append(qcr.columns, string(d.bytes(d.uvarint())))
+	}
+	rowCount := d.length(len(qcr.columns))
+	qcr.rows = make([][]scannedColumn, 0, rowCount)
+	for r := 0; r < rowCount && d.err == nil; r++ {
+		row := make([]scannedColumn, len(qcr.columns))
+		for i := range row {
+			fb := d.bytes(1)
+			if d.err != nil {
+				break
+			}
+			s := &row[i]
+			switch s.field = fb[0]; s.field {
+			case 'i':
+				s.int64 = d.varint()
+			case 'f':
+				if b := d.bytes(8); d.err == nil {
+					s.float64 = math.Float64frombits(binary.LittleEndian.Uint64(b))
+				}
+			case 'b':
+				if b := d.bytes(1); d.err == nil {
+					s.bool = b[0] == 1
+				}
+			case 'y':
+				s.byte = d.bytes(d.uvarint())
+			case 's':
+				s.string = string(d.bytes(d.uvarint()))
+			case 't':
+				if b := d.bytes(d.uvarint()); d.err == nil {
+					if err := s.time.UnmarshalBinary(b); err != nil {
+						d.err = errors.BadEncoding.New(err, "[dml] QueryCache entry contains an invalid time")
+					}
+				}
+			case 'n':
+			default:
+				d.fail()
+			}
+		}
+		qcr.rows = append(qcr.rows, row)
+	}
+	return d.err
+}
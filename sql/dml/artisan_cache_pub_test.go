@@ -0,0 +1,131 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/storage/objcache"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func newQueryCache(t *testing.T) *dml.QueryCache {
+	m, err := objcache.NewManager(objcache.WithSimpleSlowCacheMap())
+	assert.NoError(t, err)
+	return dml.NewQueryCache(m, nil)
+}
+
+func TestArtisan_WithCache_Load(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	qc := newQueryCache(t)
+	ctx := context.TODO()
+
+	const sqlStr = "SELECT `config_id`, `scope`, `scope_id`, `path`, `value` FROM `core_config_data` WHERE (`path` = ?)"
+	newRows := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"config_id", "scope", "scope_id", "path", "value"}).
+			AddRow(1, "default", 0, "web/url", "https://x.com").
+			AddRow(2, "stores", 3, "web/url", nil)
+	}
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlStr)).WithArgs("web/url").WillReturnRows(newRows())
+
+	sel := dbc.SelectFrom("core_config_data").AddColumns("config_id", "scope", "scope_id", "path", "value").
+		Where(dml.Column("path").PlaceHolder())
+
+	for i := 0; i < 3; i++ { // only the first call hits the database
+		ccd := &TableCoreConfigDataSlice{}
+		rc, err := sel.WithArgs().WithCache(qc, time.Minute, "core_config_data").Load(ctx, ccd, "web/url")
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(2), rc)
+		assert.Exactly(t, []*TableCoreConfigData{
+			{ConfigID: 1, Scope: "default", Path: "web/url", Value: null.MakeString("https://x.com")},
+			{ConfigID: 2, Scope: "stores", ScopeID: 3, Path: "web/url"},
+		}, ccd.Data)
+	}
+
+	// different arguments create a different key
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlStr)).WithArgs("web/cookie").
+		WillReturnRows(sqlmock.NewRows([]string{"config_id", "scope", "scope_id", "path", "value"}))
+	ccd := &TableCoreConfigDataSlice{}
+	rc, err := sel.WithArgs().WithCache(qc, time.Minute, "core_config_data").Load(ctx, ccd, "web/cookie")
+	assert.NoError(t, err)
+	assert.Exactly(t, uint64(0), rc)
+
+	// invalidation of the tag requires a new query
+	assert.NoError(t, qc.Invalidate(ctx, "core_config_data"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlStr)).WithArgs("web/url").WillReturnRows(newRows())
+	ccd = &TableCoreConfigDataSlice{}
+	rc, err = sel.WithArgs().WithCache(qc, time.Minute, "core_config_data").Load(ctx, ccd, "web/url")
+	assert.NoError(t, err)
+	assert.Exactly(t, uint64(2), rc)
+}
+
+func TestArtisan_WithCache_LoadPrimitives(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	qc := newQueryCache(t)
+	ctx := context.TODO()
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id` FROM `customer_entity`")).
+		WillReturnRows(sqlmock.NewRows([]string{"entity_id"}).AddRow(3).AddRow(nil).AddRow([]byte("5")))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `email` FROM `customer_entity`")).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("a@b.c").AddRow(nil))
+
+	for i := 0; i < 2; i++ {
+		ids, err := dbc.SelectFrom("customer_entity").AddColumns("entity_id").
+			WithArgs().WithCache(qc, 0, "customer_entity").LoadInt64s(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []int64{3, 5}, ids)
+
+		uids, err := dbc.SelectFrom("customer_entity").AddColumns("entity_id").
+			WithArgs().WithCache(qc, 0, "customer_entity").LoadUint64s(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []uint64{3, 5}, uids)
+
+		emails, err := dbc.SelectFrom("customer_entity").AddColumns("email").
+			WithArgs().WithCache(qc, 0, "customer_entity").LoadStrings(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []string{"a@b.c"}, emails)
+	}
+}
+
+func TestArtisan_WithCache_TTL(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	qc := newQueryCache(t)
+	ctx := context.TODO()
+
+	for i := int64(1); i <= 2; i++ {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `entity_id` FROM `customer_entity`")).
+			WillReturnRows(sqlmock.NewRows([]string{"entity_id"}).AddRow(i))
+		ids, err := dbc.SelectFrom("customer_entity").AddColumns("entity_id").
+			WithArgs().WithCache(qc, time.Nanosecond).LoadInt64s(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []int64{i}, ids)
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestQueryCacheRows_Marshal(t *testing.T) {
+	t.Parallel()
+
+	ts := time.Date(2018, 3, 4, 5, 6, 7, 8, time.UTC)
+	qcr := &queryCacheRows{
+		expires: 1234567,
+		columns: []string{"i", "f", "b", "y", "s", "t", "n"},
+		rows: [][]scannedColumn{
+			{
+				{field: 'i', int64: -42}, {field: 'f', float64: 3.14159}, {field: 'b', bool: true},
+				{field: 'y', byte: []byte("bytes")}, {field: 's', string: "Gophér"}, {field: 't', time: ts}, {field: 'n'},
+			},
+			{
+				{field: 'i', int64: 1 << 40}, {field: 'f'}, {field: 'b'},
+				{field: 'y', byte: []byte{}}, {field: 's'}, {field: 't', time: ts.Add(time.Hour)}, {field: 'n'},
+			},
+		},
+	}
+	data, err := qcr.Marshal()
+	assert.NoError(t, err)
+
+	var have queryCacheRows
+	assert.NoError(t, have.Unmarshal(data))
+	assert.Exactly(t, qcr.expires, have.expires)
+	assert.Exactly(t, qcr.columns, have.columns)
+	assert.Len(t, have.rows, 2)
+	for r, row := range qcr.rows {
+		for c := range row {
+			assert.Exactly(t, row[c].String(), have.rows[r][c].String(), "row %d column %d", r, c)
+		}
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		var have queryCacheRows
+		err := have.Unmarshal(nil)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	t.Run("corrupt", func(t *testing.T) {
+		var have queryCacheRows
+		err := have.Unmarshal(data[:len(data)-3])
+		assert.True(t, errors.BadEncoding.Match(err), "%+v", err)
+	})
+	t.Run("column count exceeds data", func(t *testing.T) {
+		var have queryCacheRows
+		corrupt := appendUvarint(appendVarint(nil, 1), 1<<62)
+		err := have.Unmarshal(append(corrupt, 1, 'a'))
+		assert.True(t, errors.BadEncoding.Match(err), "%+v", err)
+	})
+	t.Run("row count exceeds data", func(t *testing.T) {
+		var have queryCacheRows
+		corrupt := appendUvarint(appendVarint(nil, 1), 1)
+		corrupt = appendUvarintBytes(corrupt, []byte("a"))
+		corrupt = appendUvarint(corrupt, 1<<63)
+		err := have.Unmarshal(append(corrupt, 'n'))
+		assert.True(t, errors.BadEncoding.Match(err), "%+v", err)
+	})
+}
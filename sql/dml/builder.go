@@ -96,6 +96,12 @@ type builderCommon struct {
 	// dedicated database session) or a *sql.Tx (an in-progress database
 	// transaction).
 	DB QueryExecPreparer
+	// dialect gets inherited from the connection. Nil means MySQL.
+	dialect Dialect
+	// tracer gets inherited from the connection. Can be nil.
+	tracer Tracer
+	// table contains the name of the main table for tracing.
+	table string
 	// IsBuildCacheDisabled disable the caching and destroying of the DML statement objects
 	IsBuildCacheDisabled bool // see DisableBuildCache()
 	// EstimatedCachedSQLSize specifies the estimated size in bytes of the final
@@ -194,18 +200,23 @@ func (bb *BuilderBase) prepare(ctx context.Context, db Preparer, qb queryBuilder
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	sqlStmt, err := db.PrepareContext(ctx, string(rawQuery))
-	if err != nil {
-		return nil, errors.Wrapf(err, "[dml] Prepare.PrepareContext with query %q", rawQuery)
-	}
-
 	stmt := &Stmt{
 		base: bb.builderCommon,
-		Stmt: sqlStmt,
 	}
 	stmt.base.cachedSQL = rawQuery
-	stmt.base.DB = stmtWrapper{stmt: sqlStmt}
 	stmt.base.source = source
+	if bb.Table.Name != "" {
+		stmt.base.table = bb.Table.Name
+	}
+
+	ctx, span := stmt.base.startSpan(ctx, SpanNamePrepare, "")
+	sqlStmt, err := db.PrepareContext(ctx, translateSQL(bb.dialect, string(rawQuery)))
+	endSpan(span, err)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[dml] Prepare.PrepareContext with query %q", rawQuery)
+	}
+	stmt.Stmt = sqlStmt
+	stmt.base.DB = stmtWrapper{stmt: sqlStmt}
 	return stmt, nil
 }
 
@@ -225,6 +236,9 @@ func (bb *BuilderBase) withArtisan(qb queryBuilder) *Artisan {
 		arguments: args[:0],
 	}
 	bb.rwmu.Unlock()
+	if bb.Table.Name != "" {
+		a.base.table = bb.Table.Name
+	}
 	a.base.cachedSQL = sqlBytes
 	a.base.ärgErr = errors.WithStack(err)
 	return &a
@@ -327,6 +341,22 @@ func sqlWriteUnionAll(w *bytes.Buffer, isAll bool, isIntersect bool, isExcept bo
 	w.WriteByte('\n')
 }
 
+var returningPart = []byte(` RETURNING `)
+
+// sqlWriteReturning writes the columns of the Select `returning` as RETURNING
+// clause. Supported by MariaDB and PostgreSQL. The other parts of `returning`
+// get ignored.
+func sqlWriteReturning(w *bytes.Buffer, returning *Select, placeHolders []string) (_ []string, err error) {
+	if returning == nil {
+		return placeHolders, nil
+	}
+	if len(returning.Columns) == 0 {
+		return nil, errors.Empty.Newf("[dml] RETURNING requires at least one column")
+	}
+	w.Write(returningPart)
+	return returning.Columns.writeQuoted(w, placeHolders)
+}
+
 func sqlWriteOrderBy(w *bytes.Buffer, orderBys ids, br bool) {
 	if len(orderBys) == 0 {
 		return
@@ -375,14 +405,14 @@ func writeUint64(w *bytes.Buffer, i uint64) (err error) {
 	return err
 }
 
-func writeBytes(w *bytes.Buffer, p []byte) (err error) {
+func writeBytes(d Dialect, w *bytes.Buffer, p []byte) (err error) {
 	switch {
 	case p == nil:
 		_, err = w.WriteString(sqlStrNullUC)
 	case !utf8.Valid(p):
-		dialect.EscapeBinary(w, p)
+		d.EscapeBinary(w, p)
 	default:
-		dialect.EscapeString(w, string(p)) // maybe create an EscapeByteString version to avoid one alloc ;-)
+		d.EscapeString(w, string(p)) // maybe create an EscapeByteString version to avoid one alloc ;-)
 	}
 	return
 }
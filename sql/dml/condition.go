@@ -253,6 +253,9 @@ type Condition struct {
 	// creation in the JOIN part for the USING syntax. Additionally used in ON
 	// DUPLICATE KEY.
 	Columns []string
+	// Window turns the expression in field Left into a window function when
+	// used as a column. See function Over.
+	Window *Window
 }
 
 // Clone creates a new clone of the current object. It resets the internal error
@@ -266,6 +269,7 @@ func (c *Condition) Clone() *Condition {
 	c2.Right.args = c.Right.args.Clone()
 	c2.Right.Sub = c.Right.Sub.Clone()
 	c2.Columns = cloneStringSlice(c.Columns)
+	c2.Window = c.Window.Clone()
 	return &c2
 }
 
@@ -287,6 +291,18 @@ func (c *Condition) Or() *Condition {
 	return c
 }
 
+// Over applies a window to an expression and turns it into a window function.
+// Only supported when the condition gets used as a column, see
+// Select.AddColumnsConditions.
+//		Expr("ROW_NUMBER()").Over(NewWindow().PartitionBy("store_id")).Alias("rn")
+//		// ROW_NUMBER() OVER (PARTITION BY `store_id`) AS `rn`
+//		Expr("SUM(grand_total)").Over(NamedWindow("w")).Alias("total")
+//		// SUM(grand_total) OVER `w` AS `total`
+func (c *Condition) Over(w *Window) *Condition {
+	c.Window = w
+	return c
+}
+
 func (c *Condition) isExpression() bool {
 	return c.IsLeftExpression || c.Right.IsExpression
 }
@@ -1026,23 +1042,74 @@ func (cs Conditions) writeSetClauses(w *bytes.Buffer, placeHolders []string) ([]
 	return placeHolders, nil
 }
 
-func writeValues(w *bytes.Buffer, column string) {
+func writeValues(w *bytes.Buffer, column string, isExcluded bool) {
+	if isExcluded {
+		w.WriteString("EXCLUDED.")
+		Quoter.quote(w, column)
+		return
+	}
 	w.WriteString("VALUES(")
 	Quoter.quote(w, column)
 	w.WriteByte(')')
 }
 
-var onDuplicateKeyPart = []byte(` ON DUPLICATE KEY UPDATE `)
+var (
+	onDuplicateKeyPart = []byte(` ON DUPLICATE KEY UPDATE `)
+	onConflictPart     = []byte(` ON CONFLICT `)
+)
+
+// writeConflictTarget writes the quoted columns in parentheses followed by a
+// space. Writes nothing if `columns` is empty.
+func writeConflictTarget(w *bytes.Buffer, columns []string) {
+	if len(columns) == 0 {
+		return
+	}
+	w.WriteByte('(')
+	for i, c := range columns {
+		if i > 0 {
+			w.WriteByte(',')
+		}
+		Quoter.quote(w, c)
+	}
+	w.WriteString(") ")
+}
+
+// insertTailPos returns the position of the first clause after the VALUES part
+// of an INSERT statement or -1 if there is no such clause.
+func insertTailPos(sql []byte) int {
+	pos := -1
+	for _, part := range [...][]byte{onDuplicateKeyPart, onConflictPart, returningPart} {
+		if p := bytes.Index(sql, part); p > 0 && (pos < 0 || p < pos) {
+			pos = p
+		}
+	}
+	return pos
+}
 
 // writeOnDuplicateKey writes the columns to `w` and appends the arguments to
 // `args` and returns `args`.
 // https://dev.mysql.com/doc/refman/5.7/en/insert-on-duplicate.html
 func (cs Conditions) writeOnDuplicateKey(w *bytes.Buffer, placeHolders []string) ([]string, error) {
+	return cs.writeUpsert(w, nil, placeHolders)
+}
+
+// writeUpsert same as writeOnDuplicateKey but if `conflictTarget` contains
+// columns, the syntax ON CONFLICT (conflictTarget) DO UPDATE SET gets written
+// and the VALUES function gets replaced by the EXCLUDED table.
+// https://www.postgresql.org/docs/current/sql-insert.html#SQL-ON-CONFLICT
+func (cs Conditions) writeUpsert(w *bytes.Buffer, conflictTarget []string, placeHolders []string) ([]string, error) {
 	if len(cs) == 0 {
 		return placeHolders, nil
 	}
 
-	w.Write(onDuplicateKeyPart)
+	isExcluded := len(conflictTarget) > 0
+	if isExcluded {
+		w.Write(onConflictPart)
+		writeConflictTarget(w, conflictTarget)
+		w.WriteString("DO UPDATE SET ")
+	} else {
+		w.Write(onDuplicateKeyPart)
+	}
 	for i, cnd := range cs {
 		addColon := false
 		for j, col := range cnd.Columns {
@@ -1051,7 +1118,7 @@ func (cs Conditions) writeOnDuplicateKey(w *bytes.Buffer, placeHolders []string)
 			}
 			Quoter.quote(w, col)
 			w.WriteByte('=')
-			writeValues(w, col)
+			writeValues(w, col, isExcluded)
 			addColon = true
 		}
 		if cnd.Left == "" {
@@ -1086,7 +1153,7 @@ func (cs Conditions) writeOnDuplicateKey(w *bytes.Buffer, placeHolders []string)
 			}
 
 		case !cnd.Right.arg.isSet:
-			writeValues(w, cnd.Left)
+			writeValues(w, cnd.Left, isExcluded)
 		case cnd.Right.arg.isSet:
 			if err := cnd.Right.arg.writeTo(w, 0); err != nil {
 				return nil, errors.WithStack(err)
@@ -50,7 +50,15 @@ type connCommon struct {
 	// comment-end-termination pattern: `*/`.
 	makeUniqueID uniqueIDFn
 	mapTableName func(oldName string) (newName string)
-	runOnClose   []ConnPoolOption
+	// dialect translates the generated SQL and escapes the interpolated
+	// arguments. Nil means MySQL. See WithDialect.
+	dialect Dialect
+	// tracer starts a span for each query and transaction. See WithTracer.
+	tracer     Tracer
+	runOnClose []ConnPoolOption
+	// txRetry replays a Transaction after a retryable error. See
+	// WithTxRetryPolicy.
+	txRetry *TxRetryPolicy
 }
 
 // ConnPool at a connection to the database with an EventReceiver to send
@@ -60,6 +68,9 @@ type ConnPool struct {
 	// DB must be set using one of the ConnPoolOption function.
 	DB  *sql.DB
 	dsn *mysql.Config
+	// connector gets set by WithDSN and WithConnector and allows to wrap the
+	// driver, e.g. with WithQueryStats.
+	connector driver.Connector
 }
 
 // Conn represents a single database session rather a pool of database sessions.
@@ -90,6 +101,10 @@ type Conn struct {
 type Tx struct {
 	connCommon
 	DB *sql.Tx
+	// savepointCount generates the savepoint names for nested transactions.
+	savepointCount int
+	// span gets ended by Commit or Rollback.
+	span Span
 }
 
 // ConnPoolOption can be used at an argument in NewConnPool to configure a
@@ -259,6 +274,19 @@ func WithDB(db *sql.DB) ConnPoolOption {
 	}
 }
 
+// WithConnector opens the DB with a driver.Connector. Contrary to WithDB it
+// supports WithQueryStats.
+func WithConnector(con driver.Connector) ConnPoolOption {
+	return ConnPoolOption{
+		sortOrder: 1,
+		fn: func(c *ConnPool) error {
+			c.connector = con
+			c.DB = sql.OpenDB(con)
+			return nil
+		},
+	}
+}
+
 // WithDSN sets the data source name for a connection.
 // Second argument DriverCallBack adds a low level call back function on MySQL driver level to
 // create a a new instrumented driver. No need to call `sql.Register`!
@@ -279,7 +307,8 @@ func WithDSN(dsn string, cb ...DriverCallBack) ConnPoolOption {
 			if len(cb) == 1 {
 				drv = wrapDriver(drv, cb[0])
 			}
-			c.DB = sql.OpenDB(dsnConnector{dsn: dsn, driver: drv})
+			c.connector = dsnConnector{dsn: dsn, driver: drv}
+			c.DB = sql.OpenDB(c.connector)
 			return nil
 		},
 	}
@@ -439,8 +468,10 @@ func (c *ConnPool) Close() error {
 func (c *ConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	start := now()
 
+	ctx, span := c.startTxSpan(ctx)
 	dbTx, err := c.DB.BeginTx(ctx, opts)
 	if err != nil {
+		endSpan(span, err)
 		return nil, errors.WithStack(err)
 	}
 	l := c.Log
@@ -456,8 +487,11 @@ func (c *ConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error
 			Log:          l,
 			makeUniqueID: c.makeUniqueID,
 			mapTableName: c.mapTableName,
+			dialect:      c.dialect,
+			tracer:       c.tracerOfTx(span),
 		},
-		DB: dbTx,
+		DB:   dbTx,
+		span: span,
 	}, nil
 }
 
@@ -477,22 +511,17 @@ func (c *ConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error
 //           panic(err.Error()) // you could gracefully handle the error also
 //      }
 // It logs the time taken, if a logger has been set with Debug logging enabled.
-// The provided context gets used only for starting the transaction.
+// The provided context gets used only for starting the transaction. If a
+// TxRetryPolicy has been set, all functions get replayed in a new transaction
+// after a deadlock or a lock wait timeout.
 func (c *ConnPool) Transaction(ctx context.Context, opts *sql.TxOptions, fns ...func(*Tx) error) error {
-	tx, err := c.BeginTx(ctx, opts)
-	if err != nil {
-		return err
-	}
-	for i, f := range fns {
-		if err := f(tx); err != nil {
-			err = errors.Wrapf(err, "[dml] ConnPool.Transaction.error at index %d", i)
-			if rErr := tx.Rollback(); rErr != nil && err == nil {
-				err = errors.Wrapf(rErr, "[dml] ConnPool.Transaction.Rollback.error at index %d", i)
-			}
+	return c.txRetry.retry(ctx, c.Log, func() error {
+		tx, err := c.BeginTx(ctx, opts)
+		if err != nil {
 			return err
 		}
-	}
-	return errors.WithStack(tx.Commit())
+		return runTransaction(tx, fns...)
+	})
 }
 
 // WithQueryBuilder creates a new Artisan for handling the arguments with the
@@ -508,6 +537,8 @@ func (c *ConnPool) WithQueryBuilder(qb QueryBuilder) *Artisan {
 			id:        c.makeUniqueID(),
 			DB:        c.DB,
 			ärgErr:    errors.WithStack(err),
+			dialect:   c.dialect,
+			tracer:    c.tracer,
 		},
 		raw:       argsRaw,
 		arguments: args[:0],
@@ -533,6 +564,9 @@ func (c *ConnPool) Conn(ctx context.Context) (*Conn, error) {
 			Log:          l,
 			makeUniqueID: c.makeUniqueID,
 			mapTableName: c.mapTableName,
+			dialect:      c.dialect,
+			tracer:       c.tracer,
+			txRetry:      c.txRetry,
 		},
 		DB: dbc,
 	}, errors.WithStack(err)
@@ -553,6 +587,8 @@ func (c *ConnPool) WithRawSQL(query string) *Artisan {
 			Log:       l,
 			id:        id,
 			DB:        c.DB,
+			dialect:   c.dialect,
+			tracer:    c.tracer,
 		},
 		arguments: args[:0],
 	}
@@ -571,15 +607,19 @@ func (c *ConnPool) WithPrepare(ctx context.Context, query string) *Artisan {
 		l = l.With(log.String("conn_pool_prepare_sql_id", id), log.String("query", query))
 	}
 
-	stmt, err := c.DB.PrepareContext(ctx, query)
+	ctx, span := c.startPrepareSpan(ctx, id, query)
+	stmt, err := c.DB.PrepareContext(ctx, translateSQL(c.dialect, query))
+	endSpan(span, err)
 
 	var args [defaultArgumentsCapacity]argument
 	a := &Artisan{
 		base: builderCommon{
-			id:     id,
-			ärgErr: err,
-			Log:    l,
-			DB:     stmtWrapper{stmt: stmt},
+			id:      id,
+			ärgErr:  err,
+			Log:     l,
+			DB:      stmtWrapper{stmt: stmt},
+			dialect: c.dialect,
+			tracer:  c.tracer,
 		},
 		arguments:  args[:0],
 		isPrepared: true,
@@ -600,8 +640,10 @@ func (c *ConnPool) WithPrepare(ctx context.Context, query string) *Artisan {
 func (c *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 	start := now()
 
+	ctx, span := c.startTxSpan(ctx)
 	dbTx, err := c.DB.BeginTx(ctx, opts)
 	if err != nil {
+		endSpan(span, err)
 		return nil, errors.WithStack(err)
 	}
 	l := c.Log
@@ -617,8 +659,11 @@ func (c *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 			Log:          l,
 			makeUniqueID: c.makeUniqueID,
 			mapTableName: c.mapTableName,
+			dialect:      c.dialect,
+			tracer:       c.tracerOfTx(span),
 		},
-		DB: dbTx,
+		DB:   dbTx,
+		span: span,
 	}, nil
 }
 
@@ -638,22 +683,17 @@ func (c *Conn) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
 //           panic(err.Error()) // you could gracefully handle the error also
 //      }
 // It logs the time taken, if a logger has been set with Debug logging enabled.
-// The provided context gets used only for starting the transaction.
+// The provided context gets used only for starting the transaction. If a
+// TxRetryPolicy has been set, all functions get replayed in a new transaction
+// after a deadlock or a lock wait timeout.
 func (c *Conn) Transaction(ctx context.Context, opts *sql.TxOptions, fns ...func(*Tx) error) error {
-	tx, err := c.BeginTx(ctx, opts)
-	if err != nil {
-		return err
-	}
-	for i, f := range fns {
-		if err := f(tx); err != nil {
-			err = errors.Wrapf(err, "[dml] ConnPool.Transaction.error at index %d", i)
-			if rErr := tx.Rollback(); rErr != nil {
-				err = errors.Wrapf(rErr, "[dml] ConnPool.Transaction.Rollback.error at index %d", i)
-			}
+	return c.txRetry.retry(ctx, c.Log, func() error {
+		tx, err := c.BeginTx(ctx, opts)
+		if err != nil {
 			return err
 		}
-	}
-	return errors.WithStack(tx.Commit())
+		return runTransaction(tx, fns...)
+	})
 }
 
 // Close returns the connection to the connection pool. All operations after a
@@ -686,6 +726,8 @@ func (c *Conn) WithQueryBuilder(qb QueryBuilder) *Artisan {
 			id:        id,
 			DB:        c.DB,
 			ärgErr:    errors.WithStack(err),
+			dialect:   c.dialect,
+			tracer:    c.tracer,
 		},
 		raw:       argsRaw,
 		arguments: args[:0],
@@ -707,6 +749,8 @@ func (c *Conn) WithRawSQL(sql string) *Artisan {
 			Log:       l,
 			id:        id,
 			DB:        c.DB,
+			dialect:   c.dialect,
+			tracer:    c.tracer,
 		},
 		arguments: args[:0],
 	}
@@ -727,6 +771,8 @@ func (tx *Tx) WithRawSQL(sql string) *Artisan {
 			Log:       l,
 			id:        id,
 			DB:        tx.DB,
+			dialect:   tx.dialect,
+			tracer:    tx.tracer,
 		},
 		arguments: args[:0],
 	}
@@ -745,15 +791,19 @@ func (tx *Tx) WithPrepare(ctx context.Context, query string) *Artisan {
 		l = l.With(log.String("tx_prepare_sql_id", id), log.String("query", query))
 	}
 
-	stmt, err := tx.DB.PrepareContext(ctx, query)
+	ctx, span := tx.startPrepareSpan(ctx, id, query)
+	stmt, err := tx.DB.PrepareContext(ctx, translateSQL(tx.dialect, query))
+	endSpan(span, err)
 
 	var args [defaultArgumentsCapacity]argument
 	a := &Artisan{
 		base: builderCommon{
-			id:     id,
-			ärgErr: err,
-			Log:    l,
-			DB:     stmtWrapper{stmt: stmt},
+			id:      id,
+			ärgErr:  err,
+			Log:     l,
+			DB:      stmtWrapper{stmt: stmt},
+			dialect: tx.dialect,
+			tracer:  tx.tracer,
 		},
 		arguments:  args[:0],
 		isPrepared: true,
@@ -767,7 +817,9 @@ func (tx *Tx) Commit() error {
 	if tx.Log != nil && tx.Log.IsDebug() {
 		defer tx.Log.Debug("Commit", log.Duration("duration", now().Sub(tx.start)))
 	}
-	return tx.DB.Commit()
+	err := tx.DB.Commit()
+	tx.endSpan("commit", err)
+	return err
 }
 
 // Rollback cancels the transaction. It logs the time taken, if a logger has
@@ -776,7 +828,9 @@ func (tx *Tx) Rollback() error {
 	if tx.Log != nil && tx.Log.IsDebug() {
 		defer tx.Log.Debug("Rollback", log.Duration("duration", now().Sub(tx.start)))
 	}
-	return tx.DB.Rollback()
+	err := tx.DB.Rollback()
+	tx.endSpan("rollback", err)
+	return err
 }
 
 // WithQueryBuilder creates a new Artisan for handling the arguments with the
@@ -792,6 +846,8 @@ func (tx *Tx) WithQueryBuilder(qb QueryBuilder) *Artisan {
 			id:        tx.makeUniqueID(),
 			DB:        tx.DB,
 			ärgErr:    errors.WithStack(err),
+			dialect:   tx.dialect,
+			tracer:    tx.tracer,
 		},
 		raw:       argsRaw,
 		arguments: args[:0],
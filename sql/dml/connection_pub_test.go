@@ -339,6 +339,31 @@ func TestTx_WithPrepare(t *testing.T) {
 	assert.NoError(t, err, "%+v", err)
 }
 
+func TestWithDialect_Inheritance(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t, dml.WithDialect(dml.DialectPostgreSQL()))
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(`UPDATE "tableZ" SET "a"=$1 WHERE ("b" = $2)`)).WithArgs(1, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectPrepare(dmltest.SQLMockQuoteMeta(`SELECT "a" FROM "tableZ" WHERE ("b" = $1)`))
+	dbMock.ExpectPrepare(dmltest.SQLMockQuoteMeta(`DELETE FROM "tableZ" WHERE "a" = $1`)).ExpectExec().WithArgs(3).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+
+	err := dbc.Transaction(context.TODO(), nil, func(tx *dml.Tx) error {
+		if _, err := tx.Update("tableZ").Set(dml.Column("a").PlaceHolder()).Where(dml.Column("b").PlaceHolder()).
+			WithArgs().ExecContext(context.TODO(), 1, 2); err != nil {
+			return err
+		}
+		if _, err := tx.SelectFrom("tableZ").AddColumns("a").Where(dml.Column("b").PlaceHolder()).Prepare(context.TODO()); err != nil {
+			return err
+		}
+		_, err := tx.WithPrepare(context.TODO(), "DELETE FROM `tableZ` WHERE `a` = ?").ExecContext(context.TODO(), 3)
+		return err
+	})
+	assert.NoError(t, err, "%+v", err)
+}
+
 func TestWithCreateDatabase(t *testing.T) {
 	t.Parallel()
 	dbc, dbMock := dmltest.MockDB(t)
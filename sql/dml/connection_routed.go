@@ -0,0 +1,392 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// ReplicaStrategy defines how RoutedConnPool picks a replica for reading.
+type ReplicaStrategy uint8
+
+// Supported replica strategies.
+const (
+	// ReplicaRoundRobin cycles through all healthy replicas.
+	ReplicaRoundRobin ReplicaStrategy = iota
+	// ReplicaLeastLag picks the healthy replica with the lowest replication
+	// lag as measured by the last call to CheckReplicationLag.
+	ReplicaLeastLag
+)
+
+// RoutedConnPoolOptions applies optional settings to a RoutedConnPool.
+type RoutedConnPoolOptions struct {
+	Strategy ReplicaStrategy
+	// MaxReplicationLag removes a replica from the rotation when its
+	// Seconds_Behind_Master, as measured by CheckReplicationLag, exceeds the
+	// duration. A replica whose replication does not run gets removed, too.
+	// Zero disables the check.
+	MaxReplicationLag time.Duration
+}
+
+type replicaState struct {
+	// lag in seconds, math.MaxInt64 if the replication is broken.
+	lag     int64
+	healthy uint32
+}
+
+// RoutedConnPool splits reads and writes between one primary and several read
+// replicas. Select, Union, With and Show statements run on a replica,
+// Insert, Update, Delete, Conn and all transactions run on the primary. If no
+// replica is healthy, the primary serves all reads. Raw SQL and QueryBuilder
+// statements send queries to the replicas and executions to the primary.
+//
+// The Log, the unique ID generator, the table name mapper and the dialect of
+// the primary get used for all statements.
+type RoutedConnPool struct {
+	Primary  *ConnPool
+	Replicas []*ConnPool
+	opts     RoutedConnPoolOptions
+	state    []replicaState
+	next     uint64
+	reader   routedDB
+	writer   routedDB
+}
+
+// NewRoutedConnPool creates a new routed connection pool. Argument `replicas`
+// can be empty, then the primary serves all reads. Argument `o` can be nil.
+func NewRoutedConnPool(primary *ConnPool, replicas []*ConnPool, o *RoutedConnPoolOptions) (*RoutedConnPool, error) {
+	if primary == nil {
+		return nil, errors.Empty.Newf("[dml] NewRoutedConnPool requires a primary connection pool")
+	}
+	r := &RoutedConnPool{
+		Primary:  primary,
+		Replicas: replicas,
+		state:    make([]replicaState, len(replicas)),
+	}
+	if o != nil {
+		r.opts = *o
+	}
+	for i := range r.state {
+		r.state[i].healthy = 1
+	}
+	r.reader = routedDB{r: r, read: true}
+	r.writer = routedDB{r: r}
+	return r, nil
+}
+
+// Close closes the primary and all replicas.
+func (r *RoutedConnPool) Close() error {
+	var err error
+	for _, c := range r.Replicas {
+		if cErr := c.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}
+	if pErr := r.Primary.Close(); pErr != nil && err == nil {
+		err = pErr
+	}
+	return err
+}
+
+type ctxKeyReadYourWrites struct{}
+
+type readYourWrites struct {
+	written uint32
+}
+
+// WithReadYourWrites returns a context which makes the reads sticky to the
+// primary as soon as a write has been executed with that context through a
+// RoutedConnPool, e.g. for the duration of an HTTP request. Reads before the
+// first write still run on the replicas.
+func WithReadYourWrites(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(ctxKeyReadYourWrites{}).(*readYourWrites); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, ctxKeyReadYourWrites{}, new(readYourWrites))
+}
+
+// WithPrimary returns a context which routes all reads to the primary.
+func WithPrimary(ctx context.Context) context.Context {
+	ryw := new(readYourWrites)
+	ryw.written = 1
+	return context.WithValue(ctx, ctxKeyReadYourWrites{}, ryw)
+}
+
+func markWritten(ctx context.Context) {
+	if ryw, ok := ctx.Value(ctxKeyReadYourWrites{}).(*readYourWrites); ok {
+		atomic.StoreUint32(&ryw.written, 1)
+	}
+}
+
+func isSticky(ctx context.Context) bool {
+	ryw, ok := ctx.Value(ctxKeyReadYourWrites{}).(*readYourWrites)
+	return ok && atomic.LoadUint32(&ryw.written) == 1
+}
+
+// ReplicaDB returns the replica for reading or the primary if the context is
+// sticky or no replica is healthy.
+func (r *RoutedConnPool) ReplicaDB(ctx context.Context) *sql.DB {
+	if idx := r.pickReplica(ctx); idx >= 0 {
+		return r.Replicas[idx].DB
+	}
+	return r.Primary.DB
+}
+
+// pickReplica returns the index of a replica or -1 for the primary.
+func (r *RoutedConnPool) pickReplica(ctx context.Context) int {
+	if len(r.Replicas) == 0 || isSticky(ctx) {
+		return -1
+	}
+
+	if r.opts.Strategy == ReplicaLeastLag {
+		idx := -1
+		var minLag int64 = math.MaxInt64
+		for i := range r.state {
+			if atomic.LoadUint32(&r.state[i].healthy) == 0 {
+				continue
+			}
+			if lag := atomic.LoadInt64(&r.state[i].lag); idx < 0 || lag < minLag {
+				idx, minLag = i, lag
+			}
+		}
+		return idx
+	}
+
+	n := uint64(len(r.Replicas))
+	start := atomic.AddUint64(&r.next, 1)
+	for i := uint64(0); i < n; i++ {
+		idx := int((start + i) % n)
+		if atomic.LoadUint32(&r.state[idx].healthy) == 1 {
+			return idx
+		}
+	}
+	return -1
+}
+
+// IsReplicaHealthy reports whether the replica at index `idx` is part of the
+// rotation.
+func (r *RoutedConnPool) IsReplicaHealthy(idx int) bool {
+	return atomic.LoadUint32(&r.state[idx].healthy) == 1
+}
+
+// CheckReplicationLag queries SHOW SLAVE STATUS on each replica and removes
+// replicas from the rotation whose Seconds_Behind_Master exceeds
+// MaxReplicationLag or whose replication does not run. Replicas which have
+// caught up get added back. An unreachable replica gets removed and its error
+// returned after all replicas have been checked.
+func (r *RoutedConnPool) CheckReplicationLag(ctx context.Context) error {
+	var firstErr error
+	for i, c := range r.Replicas {
+		lag, err := replicationLag(ctx, c.DB)
+		if err != nil && firstErr == nil {
+			firstErr = errors.Wrapf(err, "[dml] CheckReplicationLag replica index %d", i)
+		}
+		if err != nil {
+			lag = math.MaxInt64
+		}
+		atomic.StoreInt64(&r.state[i].lag, lag)
+
+		healthy := uint32(1)
+		if lag == math.MaxInt64 || (r.opts.MaxReplicationLag > 0 && time.Duration(lag)*time.Second > r.opts.MaxReplicationLag) {
+			healthy = 0
+		}
+		if old := atomic.SwapUint32(&r.state[i].healthy, healthy); old != healthy && r.Primary.Log != nil && r.Primary.Log.IsInfo() {
+			r.Primary.Log.Info("RoutedConnPool.CheckReplicationLag", log.Int("replica_index", i),
+				log.Int64("seconds_behind_master", lag), log.Bool("healthy", healthy == 1))
+		}
+	}
+	return firstErr
+}
+
+// MonitorReplicationLag calls CheckReplicationLag in the provided interval
+// until the context gets canceled. Errors get logged with Info level. Run it
+// in its own goroutine.
+func (r *RoutedConnPool) MonitorReplicationLag(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		if err := r.CheckReplicationLag(ctx); err != nil && r.Primary.Log != nil && r.Primary.Log.IsInfo() {
+			r.Primary.Log.Info("RoutedConnPool.MonitorReplicationLag", log.Err(err))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// replicationLag returns Seconds_Behind_Master or math.MaxInt64 if the value
+// is NULL, which means the replication does not run. A server without
+// replication configured returns NotFound.
+func replicationLag(ctx context.Context, db Querier) (_ int64, err error) {
+	rows, err := db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer func() {
+		if cErr := rows.Close(); cErr != nil && err == nil {
+			err = errors.WithStack(cErr)
+		}
+	}()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, errors.WithStack(err)
+		}
+		return 0, errors.NotFound.Newf("[dml] SHOW SLAVE STATUS returned no rows, replication not configured")
+	}
+	vals := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	for i, c := range cols {
+		if c != "Seconds_Behind_Master" {
+			continue
+		}
+		if vals[i] == nil {
+			return math.MaxInt64, nil
+		}
+		lag, err := strconv.ParseInt(string(vals[i]), 10, 64)
+		return lag, errors.WithStack(err)
+	}
+	return 0, errors.NotFound.Newf("[dml] Column Seconds_Behind_Master not found in SHOW SLAVE STATUS")
+}
+
+// routedDB implements QueryExecPreparer. The reader routes queries and
+// prepared statements to a replica and executions to the primary. The writer
+// routes everything to the primary and marks the context as written.
+type routedDB struct {
+	r    *RoutedConnPool
+	read bool
+}
+
+func (db routedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	if db.read {
+		return db.r.ReplicaDB(ctx).PrepareContext(ctx, query)
+	}
+	markWritten(ctx)
+	return db.r.Primary.DB.PrepareContext(ctx, query)
+}
+
+func (db routedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	if db.read {
+		return db.r.ReplicaDB(ctx).QueryContext(ctx, query, args...)
+	}
+	markWritten(ctx) // e.g. INSERT ... RETURNING
+	return db.r.Primary.DB.QueryContext(ctx, query, args...)
+}
+
+func (db routedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	if db.read {
+		return db.r.ReplicaDB(ctx).QueryRowContext(ctx, query, args...)
+	}
+	markWritten(ctx)
+	return db.r.Primary.DB.QueryRowContext(ctx, query, args...)
+}
+
+func (db routedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	markWritten(ctx)
+	return db.r.Primary.DB.ExecContext(ctx, query, args...)
+}
+
+// SelectFrom creates a new Select which runs on a replica.
+func (r *RoutedConnPool) SelectFrom(fromAlias ...string) *Select {
+	return newSelect(r.reader, &r.Primary.connCommon, fromAlias)
+}
+
+// Union creates a new Union which runs on a replica.
+func (r *RoutedConnPool) Union(selects ...*Select) *Union {
+	u := r.Primary.Union(selects...)
+	u.DB = r.reader
+	return u
+}
+
+// With creates a new With statement which runs on a replica.
+func (r *RoutedConnPool) With(expressions ...WithCTE) *With {
+	return r.Primary.With(expressions...).WithDB(r.reader)
+}
+
+// Show creates a new Show statement which runs on a replica.
+func (r *RoutedConnPool) Show() *Show {
+	return r.Primary.Show().WithDB(r.reader)
+}
+
+// InsertInto creates a new Insert which runs on the primary.
+func (r *RoutedConnPool) InsertInto(into string) *Insert {
+	return newInsertInto(r.writer, &r.Primary.connCommon, into)
+}
+
+// Update creates a new Update which runs on the primary.
+func (r *RoutedConnPool) Update(table string) *Update {
+	return newUpdate(r.writer, &r.Primary.connCommon, table)
+}
+
+// DeleteFrom creates a new Delete which runs on the primary.
+func (r *RoutedConnPool) DeleteFrom(from string) *Delete {
+	return newDeleteFrom(r.writer, &r.Primary.connCommon, from)
+}
+
+// WithQueryBuilder creates a new Artisan whose queries run on a replica and
+// whose executions run on the primary.
+func (r *RoutedConnPool) WithQueryBuilder(qb QueryBuilder) *Artisan {
+	a := r.Primary.WithQueryBuilder(qb)
+	a.base.DB = r.reader
+	return a
+}
+
+// WithRawSQL creates a new Artisan whose queries run on a replica and whose
+// executions run on the primary. Use WithPrimary for queries like SELECT ...
+// FOR UPDATE.
+func (r *RoutedConnPool) WithRawSQL(query string) *Artisan {
+	a := r.Primary.WithRawSQL(query)
+	a.base.DB = r.reader
+	return a
+}
+
+// BeginTx starts a transaction on the primary and marks the context as
+// written.
+func (r *RoutedConnPool) BeginTx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	markWritten(ctx)
+	return r.Primary.BeginTx(ctx, opts)
+}
+
+// Transaction runs the functions in a transaction on the primary and marks the
+// context as written. See ConnPool.Transaction.
+func (r *RoutedConnPool) Transaction(ctx context.Context, opts *sql.TxOptions, fns ...func(*Tx) error) error {
+	markWritten(ctx)
+	return r.Primary.Transaction(ctx, opts, fns...)
+}
+
+// Conn returns a single connection to the primary.
+func (r *RoutedConnPool) Conn(ctx context.Context) (*Conn, error) {
+	return r.Primary.Conn(ctx)
+}
@@ -0,0 +1,153 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func newRoutedConnPool(t *testing.T, o *dml.RoutedConnPoolOptions) (*dml.RoutedConnPool, []sqlmock.Sqlmock, func()) {
+	primary, pMock := dmltest.MockDB(t)
+	r1, r1Mock := dmltest.MockDB(t)
+	r2, r2Mock := dmltest.MockDB(t)
+	rcp, err := dml.NewRoutedConnPool(primary, []*dml.ConnPool{r1, r2}, o)
+	assert.NoError(t, err)
+	return rcp, []sqlmock.Sqlmock{pMock, r1Mock, r2Mock}, func() {
+		dmltest.MockClose(t, primary, pMock)
+		dmltest.MockClose(t, r1, r1Mock)
+		dmltest.MockClose(t, r2, r2Mock)
+	}
+}
+
+func expectSlaveStatus(m sqlmock.Sqlmock, secondsBehind interface{}) {
+	m.ExpectQuery("SHOW SLAVE STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"Slave_IO_State", "Master_Host", "Seconds_Behind_Master"}).
+			AddRow("Waiting for master to send event", "primary", secondsBehind))
+}
+
+func TestRoutedConnPool_RoundRobin(t *testing.T) {
+	t.Parallel()
+	rcp, mocks, closeFn := newRoutedConnPool(t, nil)
+	defer closeFn()
+
+	ctx := context.TODO()
+	mocks[2].ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `a` FROM `t`")).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(2))
+	mocks[1].ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `a` FROM `t`")).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(1))
+	mocks[2].ExpectQuery(dmltest.SQLMockQuoteMeta("(SELECT `a` FROM `t`) UNION (SELECT `b` FROM `t2`)")).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(3))
+
+	for _, want := range []int64{2, 1} {
+		v, _, err := rcp.SelectFrom("t").AddColumns("a").WithArgs().LoadNullInt64(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, want, v.Int64)
+	}
+	v, _, err := rcp.Union(dml.NewSelect("a").From("t"), dml.NewSelect("b").From("t2")).WithArgs().LoadNullInt64(ctx)
+	assert.NoError(t, err)
+	assert.Exactly(t, int64(3), v.Int64)
+
+	mocks[0].ExpectExec(dmltest.SQLMockQuoteMeta("SET @x = 1")).WillReturnResult(sqlmock.NewResult(0, 0))
+	_, err = rcp.WithRawSQL("SET @x = 1").ExecContext(ctx)
+	assert.NoError(t, err)
+}
+
+func TestRoutedConnPool_Writes(t *testing.T) {
+	t.Parallel()
+	rcp, mocks, closeFn := newRoutedConnPool(t, nil)
+	defer closeFn()
+
+	ctx := dml.WithReadYourWrites(context.TODO())
+
+	mocks[2].ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `a` FROM `t`")).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(2))
+	mocks[0].ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `t` (`a`) VALUES (?)")).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	mocks[0].ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `t` SET `a`=2")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mocks[0].ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `t` WHERE (`a` = 2)")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mocks[0].ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `a` FROM `t`")).WillReturnRows(sqlmock.NewRows([]string{"a"}).AddRow(0))
+	mocks[0].ExpectBegin()
+	mocks[0].ExpectCommit()
+
+	_, _, err := rcp.SelectFrom("t").AddColumns("a").WithArgs().LoadNullInt64(ctx)
+	assert.NoError(t, err)
+
+	_, err = rcp.InsertInto("t").AddColumns("a").WithArgs().ExecContext(ctx, 1)
+	assert.NoError(t, err)
+	_, err = rcp.Update("t").Set(dml.Column("a").Int(2)).WithArgs().ExecContext(ctx)
+	assert.NoError(t, err)
+	_, err = rcp.DeleteFrom("t").Where(dml.Column("a").Int(2)).WithArgs().ExecContext(ctx)
+	assert.NoError(t, err)
+
+	// sticky
+	_, _, err = rcp.SelectFrom("t").AddColumns("a").WithArgs().LoadNullInt64(ctx)
+	assert.NoError(t, err)
+
+	assert.NoError(t, rcp.Transaction(context.TODO(), nil, func(tx *dml.Tx) error { return nil }))
+}
+
+func TestRoutedConnPool_ReplicationLag(t *testing.T) {
+	t.Parallel()
+	rcp, mocks, closeFn := newRoutedConnPool(t, &dml.RoutedConnPoolOptions{
+		Strategy:          dml.ReplicaLeastLag,
+		MaxReplicationLag: 10 * time.Second,
+	})
+	defer closeFn()
+	ctx := context.TODO()
+
+	t.Run("least lag", func(t *testing.T) {
+		expectSlaveStatus(mocks[1], 3)
+		expectSlaveStatus(mocks[2], 1)
+		assert.NoError(t, rcp.CheckReplicationLag(ctx))
+		assert.True(t, rcp.IsReplicaHealthy(0))
+		assert.True(t, rcp.IsReplicaHealthy(1))
+		assert.Exactly(t, rcp.Replicas[1].DB, rcp.ReplicaDB(ctx))
+		assert.Exactly(t, rcp.Primary.DB, rcp.ReplicaDB(dml.WithPrimary(ctx)))
+	})
+
+	t.Run("lagging and broken replicas get dropped", func(t *testing.T) {
+		expectSlaveStatus(mocks[1], 11)
+		expectSlaveStatus(mocks[2], nil)
+		assert.NoError(t, rcp.CheckReplicationLag(ctx))
+		assert.False(t, rcp.IsReplicaHealthy(0))
+		assert.False(t, rcp.IsReplicaHealthy(1))
+		assert.Exactly(t, rcp.Primary.DB, rcp.ReplicaDB(ctx))
+	})
+
+	t.Run("replica caught up, other replica unreachable", func(t *testing.T) {
+		expectSlaveStatus(mocks[1], 0)
+		mocks[2].ExpectQuery("SHOW SLAVE STATUS").WillReturnError(errors.ConnectionFailed.Newf("Ups"))
+		err := rcp.CheckReplicationLag(ctx)
+		assert.True(t, errors.ConnectionFailed.Match(err), "%+v", err)
+		assert.True(t, rcp.IsReplicaHealthy(0))
+		assert.False(t, rcp.IsReplicaHealthy(1))
+		assert.Exactly(t, rcp.Replicas[0].DB, rcp.ReplicaDB(ctx))
+	})
+}
+
+func TestNewRoutedConnPool(t *testing.T) {
+	t.Parallel()
+	_, err := dml.NewRoutedConnPool(nil, nil, nil)
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	primary, pMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, primary, pMock)
+	rcp, err := dml.NewRoutedConnPool(primary, nil, nil)
+	assert.NoError(t, err)
+	assert.Exactly(t, primary.DB, rcp.ReplicaDB(context.TODO()))
+}
@@ -0,0 +1,187 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/go-sql-driver/mysql"
+)
+
+// MySQL error numbers which abort a transaction and where a replay of the
+// transaction might succeed.
+const (
+	mysqlErrLockWaitTimeout uint16 = 1205
+	mysqlErrLockDeadlock    uint16 = 1213
+)
+
+// IsRetryableTxError returns true if the cause of the error is a MySQL
+// deadlock (1213) or a lock wait timeout (1205).
+func IsRetryableTxError(err error) bool {
+	if err == nil {
+		return false
+	}
+	me, ok := errors.Cause(err).(*mysql.MySQLError)
+	return ok && (me.Number == mysqlErrLockDeadlock || me.Number == mysqlErrLockWaitTimeout)
+}
+
+// TxRetryPolicy defines how the functions Transaction of ConnPool and Conn
+// replay all functions in a new transaction after a retryable error. The wait
+// time between two attempts doubles with each attempt and contains a random
+// jitter of up to 50 percent.
+type TxRetryPolicy struct {
+	// MaxAttempts includes the first attempt. Values smaller than two disable
+	// the retries.
+	MaxAttempts int
+	// Backoff defines the wait time after the first failed attempt. Defaults
+	// to 10ms.
+	Backoff time.Duration
+	// MaxBackoff limits the wait time between two attempts. Defaults to one
+	// second.
+	MaxBackoff time.Duration
+	// IsRetryable checks if an error returned from a transaction allows a new
+	// attempt. Defaults to IsRetryableTxError.
+	IsRetryable func(error) bool
+}
+
+// WithTxRetryPolicy applies a retry policy to the Transaction functions. The
+// policy gets inherited to type Conn.
+func WithTxRetryPolicy(p TxRetryPolicy) ConnPoolOption {
+	return ConnPoolOption{
+		fn: func(c *ConnPool) error {
+			if p.Backoff <= 0 {
+				p.Backoff = 10 * time.Millisecond
+			}
+			if p.MaxBackoff <= 0 {
+				p.MaxBackoff = time.Second
+			}
+			if p.IsRetryable == nil {
+				p.IsRetryable = IsRetryableTxError
+			}
+			c.txRetry = &p
+			return nil
+		},
+	}
+}
+
+// retry runs function fn until it succeeds, returns a non retryable error, the
+// maximum attempts have been reached or the context gets canceled.
+func (p *TxRetryPolicy) retry(ctx context.Context, l log.Logger, fn func() error) error {
+	if p == nil || p.MaxAttempts < 2 {
+		return fn()
+	}
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !p.IsRetryable(err) {
+			return err
+		}
+
+		wait := backoff/2 + time.Duration(rand.Int63n(int64(backoff/2)+1))
+		if l != nil && l.IsInfo() {
+			l.Info("Transaction.retry", log.Err(err), log.Int("attempt", attempt), log.Duration("wait", wait))
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "[dml] Transaction retry canceled after attempt %d: %s", attempt, err)
+		case <-time.After(wait):
+		}
+		if backoff *= 2; backoff > p.MaxBackoff {
+			backoff = p.MaxBackoff
+		}
+	}
+}
+
+// runTransaction executes the functions and commits the transaction or rolls
+// it back on the first error.
+func runTransaction(tx *Tx, fns ...func(*Tx) error) error {
+	for i, f := range fns {
+		if err := f(tx); err != nil {
+			err = errors.Wrapf(err, "[dml] Transaction.error at index %d", i)
+			if rErr := tx.Rollback(); rErr != nil {
+				err = errors.Wrapf(rErr, "[dml] Transaction.Rollback.error at index %d after %s", i, err)
+			}
+			return err
+		}
+	}
+	return errors.WithStack(tx.Commit())
+}
+
+// Savepoint creates a named savepoint within the transaction. Setting a
+// savepoint with an already existing name overwrites the previous one.
+func (tx *Tx) Savepoint(ctx context.Context, name string) error {
+	return tx.execSavepoint(ctx, "SAVEPOINT ", name)
+}
+
+// RollbackTo rolls back all changes made after the savepoint was set. The
+// savepoint and the transaction remain active.
+func (tx *Tx) RollbackTo(ctx context.Context, name string) error {
+	return tx.execSavepoint(ctx, "ROLLBACK TO SAVEPOINT ", name)
+}
+
+// ReleaseSavepoint removes the savepoint without changing the data.
+func (tx *Tx) ReleaseSavepoint(ctx context.Context, name string) error {
+	return tx.execSavepoint(ctx, "RELEASE SAVEPOINT ", name)
+}
+
+func (tx *Tx) execSavepoint(ctx context.Context, stmt, name string) error {
+	if name == "" {
+		return errors.Empty.Newf("[dml] Savepoint name cannot be empty")
+	}
+	if tx.Log != nil && tx.Log.IsDebug() {
+		defer tx.Log.Debug("Savepoint", log.String("statement", stmt), log.String("name", name))
+	}
+	_, err := tx.DB.ExecContext(ctx, stmt+Quoter.Name(name))
+	return errors.Wrapf(err, "[dml] %s%s", stmt, name)
+}
+
+// Nested runs the functions in a nested transaction using a savepoint. If a
+// function returns an error, all changes of the nested transaction get rolled
+// back to the savepoint and the error gets returned. The outer transaction
+// remains active and can decide whether to continue or to roll back. On
+// success the savepoint gets released. Nested transactions can be nested.
+//
+//      err := dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+//			// SQL
+//			if err := tx.Nested(ctx, func(tx *dml.Tx) error {
+//				// optional SQL
+//				return nil
+//			}); err != nil {
+//				// log error, outer transaction continues
+//			}
+//			return nil
+//		})
+func (tx *Tx) Nested(ctx context.Context, fns ...func(*Tx) error) error {
+	tx.savepointCount++
+	name := "sp_" + strconv.Itoa(tx.savepointCount)
+	if err := tx.Savepoint(ctx, name); err != nil {
+		return errors.WithStack(err)
+	}
+	for i, f := range fns {
+		if err := f(tx); err != nil {
+			err = errors.Wrapf(err, "[dml] Tx.Nested.error at index %d", i)
+			if rErr := tx.RollbackTo(ctx, name); rErr != nil {
+				err = errors.Wrapf(rErr, "[dml] Tx.Nested.RollbackTo.error at index %d after %s", i, err)
+			}
+			return err
+		}
+	}
+	return errors.WithStack(tx.ReleaseSavepoint(ctx, name))
+}
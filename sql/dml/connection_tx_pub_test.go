@@ -0,0 +1,153 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/util/assert"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestIsRetryableTxError(t *testing.T) {
+	t.Parallel()
+	assert.True(t, dml.IsRetryableTxError(&mysql.MySQLError{Number: 1213}))
+	assert.True(t, dml.IsRetryableTxError(errors.Wrapf(&mysql.MySQLError{Number: 1205}, "wrapped")))
+	assert.False(t, dml.IsRetryableTxError(&mysql.MySQLError{Number: 1062}))
+	assert.False(t, dml.IsRetryableTxError(errors.NotFound.Newf("x")))
+	assert.False(t, dml.IsRetryableTxError(nil))
+}
+
+func TestTx_Nested(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec("SAVEPOINT `sp_1`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `a` SET `b`=1")).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("SAVEPOINT `sp_2`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("ROLLBACK TO SAVEPOINT `sp_2`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("RELEASE SAVEPOINT `sp_1`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectCommit()
+
+	ctx := context.TODO()
+	err := dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+		return tx.Nested(ctx, func(tx *dml.Tx) error {
+			if _, err := tx.WithRawSQL("UPDATE `a` SET `b`=1").ExecContext(ctx); err != nil {
+				return err
+			}
+			err := tx.Nested(ctx, func(tx *dml.Tx) error {
+				return errors.AlreadyExists.Newf("duplicate")
+			})
+			assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+			return nil
+		})
+	})
+	assert.NoError(t, err)
+}
+
+func TestTx_Savepoint_EmptyName(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectBegin()
+	dbMock.ExpectRollback()
+	err := dbc.Transaction(context.TODO(), nil, func(tx *dml.Tx) error {
+		return tx.Savepoint(context.TODO(), "")
+	})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+}
+
+func TestConnPool_Transaction_Retry(t *testing.T) {
+	t.Parallel()
+
+	newDB := func(t *testing.T, maxAttempts int) (*dml.ConnPool, sqlmock.Sqlmock) {
+		dbc, dbMock := dmltest.MockDB(t)
+		assert.NoError(t, dbc.Options(dml.WithTxRetryPolicy(dml.TxRetryPolicy{
+			MaxAttempts: maxAttempts,
+			Backoff:     time.Microsecond,
+		})))
+		return dbc, dbMock
+	}
+	update := func(tx *dml.Tx) error {
+		_, err := tx.WithRawSQL("UPDATE `stock` SET `qty`=`qty`-1").ExecContext(context.TODO())
+		return err
+	}
+
+	t.Run("deadlock then success", func(t *testing.T) {
+		dbc, dbMock := newDB(t, 3)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectBegin()
+			dbMock.ExpectExec("UPDATE").WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+			dbMock.ExpectRollback()
+		}
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec("UPDATE").WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		assert.NoError(t, dbc.Transaction(context.TODO(), nil, update))
+	})
+
+	t.Run("max attempts reached", func(t *testing.T) {
+		dbc, dbMock := newDB(t, 2)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		for i := 0; i < 2; i++ {
+			dbMock.ExpectBegin()
+			dbMock.ExpectExec("UPDATE").WillReturnError(&mysql.MySQLError{Number: 1205, Message: "Lock wait timeout"})
+			dbMock.ExpectRollback()
+		}
+		err := dbc.Transaction(context.TODO(), nil, update)
+		assert.True(t, dml.IsRetryableTxError(err), "%+v", err)
+	})
+
+	t.Run("not retryable", func(t *testing.T) {
+		dbc, dbMock := newDB(t, 5)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec("UPDATE").WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+		dbMock.ExpectRollback()
+		err := dbc.Transaction(context.TODO(), nil, update)
+		assert.Error(t, err)
+	})
+
+	t.Run("context canceled", func(t *testing.T) {
+		dbc, dbMock := newDB(t, 5)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec("UPDATE").WillReturnError(&mysql.MySQLError{Number: 1213, Message: "Deadlock found"})
+		dbMock.ExpectRollback()
+		err := dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+			cancel()
+			return update(tx)
+		})
+		assert.Exactly(t, context.Canceled, errors.Cause(err), "%+v", err)
+	})
+}
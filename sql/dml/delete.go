@@ -51,7 +51,8 @@ type Delete struct {
 	// SQL expression that can be calculated from a single row fields is
 	// allowed. Subqueries are allowed. The AS keyword is allowed, so it is
 	// possible to use aliases. The use of aggregate functions is not allowed.
-	// RETURNING cannot be used in multi-table DELETEs.
+	// RETURNING cannot be used in multi-table DELETEs. Only the columns of the
+	// Select get written. PostgreSQL supports RETURNING too.
 	Returning *Select
 	// Listeners allows to dispatch certain functions in different
 	// situations.
@@ -80,9 +81,11 @@ func newDeleteFrom(db QueryExecPreparer, cCom *connCommon, from string) *Delete
 	return &Delete{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  db,
+				id:      id,
+				Log:     l,
+				DB:      db,
+				dialect: cCom.dialect,
+				tracer:  cCom.tracer,
 			},
 			Table: MakeIdentifier(from),
 		},
@@ -322,12 +325,8 @@ func (b *Delete) toSQL(w *bytes.Buffer, placeHolders []string) (_ []string, err
 	sqlWriteOrderBy(w, b.OrderBys, false)
 	sqlWriteLimitOffset(w, b.LimitValid, false, 0, b.LimitCount)
 
-	if b.Returning != nil {
-		w.WriteString(" RETURNING ")
-		placeHolders, err = b.Returning.toSQL(w, placeHolders)
-		if err != nil {
-			return nil, errors.WithStack(err)
-		}
+	if placeHolders, err = sqlWriteReturning(w, b.Returning, placeHolders); err != nil {
+		return nil, errors.WithStack(err)
 	}
 
 	return placeHolders, nil
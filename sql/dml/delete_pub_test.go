@@ -268,8 +268,10 @@ func TestDelete_Returning(t *testing.T) {
 				dml.Column("ce.entity_id").GreaterOrEqual().PlaceHolder(),
 			)
 		del.Returning = dml.NewSelect("entity_id", "created_at").From("customer_entity")
+		// Only the columns of the Select get written. A whole SELECT statement
+		// after RETURNING is invalid SQL in MariaDB and PostgreSQL.
 		compareToSQL(t, del, errors.NoKind,
-			"DELETE FROM `customer_entity` WHERE (`ce`.`entity_id` >= ?) RETURNING SELECT `entity_id`, `created_at` FROM `customer_entity`",
+			"DELETE FROM `customer_entity` WHERE (`ce`.`entity_id` >= ?) RETURNING `entity_id`, `created_at`",
 			"",
 		)
 	})
@@ -19,6 +19,9 @@ import (
 	"encoding/hex"
 	"strings"
 	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/util/bufferpool"
 )
 
 const (
@@ -27,19 +30,88 @@ const (
 	namedArgStartByte   = ':'
 )
 
-var dialect dialecter = mysqlDialect{
+// dialect defines the canonical dialect in which all builders write their SQL.
+var dialect Dialect = mysqlDialect{
 	identR: strings.NewReplacer("`", "``", ".", "`.`"),
 }
 
-// dialecter at an interface that wraps the diverse properties of individual
-// SQL drivers.
-type dialecter interface {
+// Dialect at an interface that wraps the diverse properties of individual
+// SQL drivers. All builders generate MySQL flavoured SQL. A Dialect escapes
+// the interpolated arguments and translates the generated SQL into its own
+// flavour before the query gets sent to the server. Set a Dialect with the
+// ConnPoolOption WithDialect. Conn, Tx and all statement types inherit the
+// Dialect from the ConnPool. Function ToSQL of the builders returns the
+// untranslated SQL whereas Artisan.ToSQL returns the translated SQL.
+type Dialect interface {
+	// Name returns the unique name of the dialect.
+	Name() string
 	EscapeIdent(w *bytes.Buffer, ident string)
 	EscapeBool(w *bytes.Buffer, b bool)
 	EscapeString(w *bytes.Buffer, s string)
 	EscapeTime(w *bytes.Buffer, t time.Time)
 	EscapeBinary(w *bytes.Buffer, b []byte)
-	ApplyLimitAndOffset(w *bytes.Buffer, limit, offset uint64)
+	// SupportsOnDuplicateKey reports if the dialect understands the MySQL
+	// syntax ON DUPLICATE KEY UPDATE. If not, type Insert writes an ON
+	// CONFLICT (...) DO UPDATE SET clause.
+	SupportsOnDuplicateKey() bool
+	// Translate rewrites the MySQL flavoured SQL statement `sql` into the
+	// dialect and writes it to `w`.
+	Translate(w *bytes.Buffer, sql string)
+}
+
+// Names of the supported dialects.
+const (
+	DialectNameMySQL      = "mysql"
+	DialectNamePostgreSQL = "postgres"
+)
+
+// DialectMySQL returns the default dialect for MySQL, MariaDB and Percona.
+func DialectMySQL() Dialect {
+	return dialect
+}
+
+// WithDialect sets the dialect of the connection pool. All queries
+// created by the pool, its connections and transactions get translated into
+// and interpolated with that dialect. Default dialect is MySQL.
+//		dml.NewConnPool(dml.WithDB(db), dml.WithDialect(dml.DialectPostgreSQL()))
+func WithDialect(d Dialect) ConnPoolOption {
+	return ConnPoolOption{
+		sortOrder: 3,
+		fn: func(c *ConnPool) error {
+			if d == nil {
+				return errors.Empty.Newf("[dml] WithDialect argument Dialect cannot be nil")
+			}
+			c.dialect = d
+			return nil
+		},
+	}
+}
+
+// translateSQL rewrites the canonical MySQL flavoured `sql` into dialect `d`. A
+// nil or the MySQL dialect returns `sql` unchanged.
+func translateSQL(d Dialect, sql string) string {
+	if d == nil || d.Name() == DialectNameMySQL {
+		return sql
+	}
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+	d.Translate(buf, sql)
+	return buf.String()
+}
+
+// isOnConflict reports if the ON DUPLICATE KEY clause must be written in the
+// ON CONFLICT syntax.
+func (bc *builderCommon) isOnConflict() bool {
+	return bc.dialect != nil && !bc.dialect.SupportsOnDuplicateKey()
+}
+
+// getDialect returns the dialect inherited from the connection or the
+// canonical MySQL dialect.
+func (bc *builderCommon) getDialect() Dialect {
+	if bc.dialect == nil {
+		return dialect
+	}
+	return bc.dialect
 }
 
 const mysqlTimeFormat = "2006-01-02 15:04:05"
@@ -48,6 +120,12 @@ type mysqlDialect struct {
 	identR *strings.Replacer
 }
 
+func (d mysqlDialect) Name() string { return DialectNameMySQL }
+
+func (d mysqlDialect) SupportsOnDuplicateKey() bool { return true }
+
+func (d mysqlDialect) Translate(w *bytes.Buffer, sql string) { w.WriteString(sql) }
+
 func (d mysqlDialect) EscapeIdent(w *bytes.Buffer, ident string) {
 	w.WriteByte('`')
 	w.WriteString(d.identR.Replace(ident))
@@ -112,20 +190,6 @@ func (d mysqlDialect) EscapeTime(w *bytes.Buffer, t time.Time) {
 	w.WriteByte('\'')
 }
 
-func (d mysqlDialect) ApplyLimitAndOffset(w *bytes.Buffer, limit, offset uint64) {
-	w.WriteString(" LIMIT ")
-	if limit == 0 {
-		// In MYSQL, OFFSET cannot be used alone. Set the limit to the max possible value.
-		w.WriteString("18446744073709551615")
-	} else {
-		writeUint64(w, limit)
-	}
-	if offset > 0 {
-		w.WriteString(" OFFSET ")
-		writeUint64(w, offset)
-	}
-}
-
 func cutNamedArgStartStr(s string) (string, bool) {
 	lp := namedArgStartStrLen
 	if len(s) >= lp && s[0:lp] == namedArgStartStr {
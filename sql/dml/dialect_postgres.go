@@ -0,0 +1,285 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+const postgresTimeFormat = "2006-01-02 15:04:05.999999-07:00"
+
+var postgresIdentR = strings.NewReplacer(`"`, `""`, ".", `"."`)
+
+// DialectPostgreSQL returns the dialect for PostgreSQL. The translation of the
+// MySQL flavoured SQL covers:
+//		- backtick quoted identifiers become double quoted identifiers.
+//		- place holders `?` become positional place holders `$1`, `$2`, ...
+//		- string literals containing backslash escapes become E'...' literals.
+//		- hex literals 0xABCD become decode('abcd','hex').
+//		- LIMIT offset,count becomes LIMIT count OFFSET offset. Both operands
+//		  can be numbers or place holders.
+//		- INSERT ... ON DUPLICATE KEY UPDATE becomes INSERT ... ON CONFLICT
+//		  (OnConflictTarget) DO UPDATE SET `col`=EXCLUDED.`col`.
+//		- INSERT IGNORE becomes INSERT ... ON CONFLICT [(OnConflictTarget)]
+//		  DO NOTHING.
+// Double quoted strings in raw SQL are treated as identifiers. Booleans
+// written into the SQL at build time, like Column("a").Bool(true), render as
+// 1 or 0, hence use place holders for boolean columns. MySQL specific
+// functions, e.g. VALUES(`col`) in custom expressions, won't get translated.
+func DialectPostgreSQL() Dialect {
+	return postgresDialect{}
+}
+
+type postgresDialect struct{}
+
+func (d postgresDialect) Name() string { return DialectNamePostgreSQL }
+
+func (d postgresDialect) SupportsOnDuplicateKey() bool { return false }
+
+func (d postgresDialect) EscapeIdent(w *bytes.Buffer, ident string) {
+	w.WriteByte('"')
+	w.WriteString(postgresIdentR.Replace(ident))
+	w.WriteByte('"')
+}
+
+func (d postgresDialect) EscapeBool(w *bytes.Buffer, b bool) {
+	if b {
+		w.WriteString("TRUE")
+	} else {
+		w.WriteString("FALSE")
+	}
+}
+
+func (d postgresDialect) EscapeBinary(w *bytes.Buffer, b []byte) {
+	if b == nil {
+		w.WriteString(sqlStrNullUC)
+		return
+	}
+	w.WriteString("decode('")
+	w.WriteString(hex.EncodeToString(b))
+	w.WriteString("','hex')")
+}
+
+// EscapeString writes a standard conforming string and doubles the single
+// quotes. A string containing a backslash gets written as an escape string
+// constant E'...'.
+func (d postgresDialect) EscapeString(w *bytes.Buffer, s string) {
+	hasBackslash := strings.IndexByte(s, '\\') >= 0
+	if hasBackslash {
+		w.WriteByte('E')
+	}
+	w.WriteByte('\'')
+	for _, char := range s {
+		switch {
+		case char == '\'':
+			w.WriteString(`''`)
+		case char == '\\':
+			w.WriteString(`\\`)
+		default:
+			w.WriteRune(char)
+		}
+	}
+	w.WriteByte('\'')
+}
+
+func (d postgresDialect) EscapeTime(w *bytes.Buffer, t time.Time) {
+	w.WriteByte('\'')
+	b := w.Bytes()
+	w.Reset()
+	w.Write(t.AppendFormat(b, postgresTimeFormat))
+	w.WriteByte('\'')
+}
+
+// Translate rewrites the MySQL flavoured `sql` into PostgreSQL. Comments get
+// copied unchanged.
+func (d postgresDialect) Translate(w *bytes.Buffer, sql string) {
+	var phCounter uint64
+	pos := 0
+	for pos < len(sql) {
+		c := sql[pos]
+		switch {
+		case c == '`':
+			end := literalEnd(sql, pos+1, '`', false)
+			ident := sql[pos+1 : end]
+			if end < len(sql) {
+				end++
+			}
+			w.WriteByte('"')
+			w.WriteString(strings.Replace(strings.Replace(ident, "``", "`", -1), `"`, `""`, -1))
+			w.WriteByte('"')
+			pos = end
+
+		case c == '"':
+			end := literalEnd(sql, pos+1, '"', false)
+			if end < len(sql) {
+				end++
+			}
+			w.WriteString(sql[pos:end])
+			pos = end
+
+		case c == '\'':
+			end := literalEnd(sql, pos+1, '\'', true)
+			if end < len(sql) {
+				end++
+			}
+			lit := sql[pos:end]
+			isEscapeString := pos > 0 && (sql[pos-1] == 'E' || sql[pos-1] == 'e') && (pos < 2 || !isIdentByte(sql[pos-2]))
+			if !isEscapeString && strings.IndexByte(lit, '\\') >= 0 {
+				w.WriteByte('E')
+			}
+			w.WriteString(lit)
+			pos = end
+
+		case c == '/' && strings.HasPrefix(sql[pos:], "/*"):
+			end := strings.Index(sql[pos+2:], "*/")
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += pos + 4
+			}
+			w.WriteString(sql[pos:end])
+			pos = end
+
+		case c == '-' && strings.HasPrefix(sql[pos:], "--"):
+			end := strings.IndexByte(sql[pos:], '\n')
+			if end < 0 {
+				end = len(sql)
+			} else {
+				end += pos + 1
+			}
+			w.WriteString(sql[pos:end])
+			pos = end
+
+		case c == placeHolderRune:
+			phCounter++
+			w.WriteByte('$')
+			writeUint64(w, phCounter)
+			pos++
+
+		case c == '0' && (pos == 0 || !isIdentByte(sql[pos-1])) && strings.HasPrefix(sql[pos:], "0x"):
+			end := pos + 2
+			for end < len(sql) && isHexByte(sql[end]) {
+				end++
+			}
+			if end == pos+2 || (end < len(sql) && isIdentByte(sql[end])) {
+				w.WriteString(sql[pos:end])
+			} else {
+				w.WriteString("decode('")
+				w.WriteString(strings.ToLower(sql[pos+2 : end]))
+				w.WriteString("','hex')")
+			}
+			pos = end
+
+		case c == 'L' && (pos == 0 || !isIdentByte(sql[pos-1])) && strings.HasPrefix(sql[pos:], "LIMIT "):
+			offset, limit, end := parseLimitOffset(sql, pos+6)
+			if end > 0 {
+				// The place holders keep their position in the argument list.
+				offsetPH, limitPH := offset == placeHolderStr, limit == placeHolderStr
+				if offsetPH {
+					phCounter++
+				}
+				offsetN := phCounter
+				if limitPH {
+					phCounter++
+				}
+				w.WriteString("LIMIT ")
+				writeLimitOperand(w, limit, limitPH, phCounter)
+				w.WriteString(" OFFSET ")
+				writeLimitOperand(w, offset, offsetPH, offsetN)
+				pos = end
+			} else {
+				w.WriteString("LIMIT ")
+				pos += 6
+			}
+
+		default:
+			w.WriteByte(c)
+			pos++
+		}
+	}
+}
+
+// literalEnd returns the position of the closing quote character `q` starting
+// at `pos`. Doubled quote characters and, if enabled, backslash escaped
+// characters get skipped. Returns len(sql) if the literal isn't terminated.
+func literalEnd(sql string, pos int, q byte, backslashEscapes bool) int {
+	for pos < len(sql) {
+		switch c := sql[pos]; {
+		case backslashEscapes && c == '\\':
+			pos += 2
+		case c == q && pos+1 < len(sql) && sql[pos+1] == q:
+			pos += 2
+		case c == q:
+			return pos
+		default:
+			pos++
+		}
+	}
+	return len(sql)
+}
+
+// parseLimitOffset parses the MySQL syntax `offset,count` starting at `pos`.
+// An operand can be a number or a place holder and spaces around the comma
+// are allowed. Returns zero `end` if the syntax does not match.
+func parseLimitOffset(sql string, pos int) (offset, limit string, end int) {
+	operandEnd := func(p int) int {
+		if p < len(sql) && sql[p] == placeHolderRune {
+			return p + 1
+		}
+		for p < len(sql) && sql[p] >= '0' && sql[p] <= '9' {
+			p++
+		}
+		return p
+	}
+	skipSpaces := func(p int) int {
+		for p < len(sql) && sql[p] == ' ' {
+			p++
+		}
+		return p
+	}
+	oEnd := operandEnd(pos)
+	comma := skipSpaces(oEnd)
+	if oEnd == pos || comma >= len(sql) || sql[comma] != ',' {
+		return "", "", 0
+	}
+	lStart := skipSpaces(comma + 1)
+	lEnd := operandEnd(lStart)
+	if lEnd == lStart || (lEnd < len(sql) && isIdentByte(sql[lEnd])) {
+		return "", "", 0
+	}
+	return sql[pos:oEnd], sql[lStart:lEnd], lEnd
+}
+
+// writeLimitOperand writes the number `op` or, if `isPH` is true, the
+// positional place holder `n`.
+func writeLimitOperand(w *bytes.Buffer, op string, isPH bool, n uint64) {
+	if !isPH {
+		w.WriteString(op)
+		return
+	}
+	w.WriteByte('$')
+	writeUint64(w, n)
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isHexByte(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F'
+}
@@ -0,0 +1,211 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func newPostgresConnPool(t *testing.T) *ConnPool {
+	c, err := NewConnPool(WithDialect(DialectPostgreSQL()))
+	assert.NoError(t, err)
+	return c
+}
+
+func TestPostgresDialect_Translate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		have string
+		want string
+	}{
+		{"SELECT `a`, `b``c` FROM `db`.`t` WHERE (`a` = ?) AND (`b` IN (?,?))", `SELECT "a", "b` + "`" + `c" FROM "db"."t" WHERE ("a" = $1) AND ("b" IN ($2,$3))`},
+		{"SELECT `a` FROM `t` WHERE (`a` = 'Sel?ect') AND (`b` = ?)", `SELECT "a" FROM "t" WHERE ("a" = 'Sel?ect') AND ("b" = $1)`},
+		{"SELECT `a` FROM `t` WHERE (`a` = 'O\\'Reilly')", `SELECT "a" FROM "t" WHERE ("a" = E'O\'Reilly')`},
+		{"SELECT `a` FROM `t` WHERE (`a` = E'x\\\\y') AND (`b` = 'x''y')", `SELECT "a" FROM "t" WHERE ("a" = E'x\\y') AND ("b" = 'x''y')`},
+		{"SELECT `a` FROM `t` WHERE (`a` = 0xDEAD) AND (`b0x1` = 1)", `SELECT "a" FROM "t" WHERE ("a" = decode('dead','hex')) AND ("b0x1" = 1)`},
+		{"SELECT `a` FROM `t` LIMIT 10,20", `SELECT "a" FROM "t" LIMIT 20 OFFSET 10`},
+		{"SELECT `a` FROM `t` LIMIT 20", `SELECT "a" FROM "t" LIMIT 20`},
+		{"SELECT `a` FROM `t` LIMIT 10, 20", `SELECT "a" FROM "t" LIMIT 20 OFFSET 10`},
+		{"SELECT `a` FROM `t` WHERE `a`=? LIMIT ?,?", `SELECT "a" FROM "t" WHERE "a"=$1 LIMIT $3 OFFSET $2`},
+		{"SELECT `a` FROM `t` LIMIT ? , 5", `SELECT "a" FROM "t" LIMIT 5 OFFSET $1`},
+		{"SELECT `a` FROM `t` LIMIT ?", `SELECT "a" FROM "t" LIMIT $1`},
+		{"SELECT `a` FROM `t` LIMIT 1,2x", `SELECT "a" FROM "t" LIMIT 1,2x`},
+		{"SELECT /*ID$`x`?*/ `a` FROM \"t\" -- `c` ?\nWHERE `a`=?", `SELECT /*ID$` + "`x`" + `?*/ "a" FROM "t" -- ` + "`c`" + ` ?` + "\n" + `WHERE "a"=$1`},
+	}
+	d := DialectPostgreSQL()
+	for i, test := range tests {
+		var buf bytes.Buffer
+		d.Translate(&buf, test.have)
+		assert.Exactly(t, test.want, buf.String(), "Index %d", i)
+	}
+}
+
+func TestPostgresDialect_Escape(t *testing.T) {
+	t.Parallel()
+
+	d := DialectPostgreSQL()
+	var buf bytes.Buffer
+
+	d.EscapeIdent(&buf, `db.ta"ble`)
+	d.EscapeBool(&buf, true)
+	d.EscapeBool(&buf, false)
+	d.EscapeString(&buf, `it's`)
+	d.EscapeString(&buf, `C:\it's`)
+	d.EscapeBinary(&buf, []byte{0xde, 0xad})
+	d.EscapeBinary(&buf, nil)
+	d.EscapeTime(&buf, time.Date(2018, 3, 4, 5, 6, 7, 800, time.FixedZone("x", 3600)))
+
+	assert.Exactly(t,
+		`"db"."ta""ble"TRUEFALSE'it''s'E'C:\\it''s'decode('dead','hex')NULL'2018-03-04 05:06:07+01:00'`,
+		buf.String())
+}
+
+func TestWithDialect(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil", func(t *testing.T) {
+		_, err := NewConnPool(WithDialect(nil))
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+	t.Run("MySQL unchanged", func(t *testing.T) {
+		c, err := NewConnPool(WithDialect(DialectMySQL()))
+		assert.NoError(t, err)
+		compareToSQL(t, c.SelectFrom("t").AddColumns("a").Where(Column("a").PlaceHolder()).Limit(2, 3).WithArgs().Bool(true), errors.NoKind,
+			"SELECT `a` FROM `t` WHERE (`a` = ?) LIMIT 2,3",
+			"SELECT `a` FROM `t` WHERE (`a` = 1) LIMIT 2,3",
+			true,
+		)
+	})
+}
+
+func TestPostgresDialect_Select(t *testing.T) {
+	t.Parallel()
+	c := newPostgresConnPool(t)
+
+	t.Run("placeholders and interpolation", func(t *testing.T) {
+		sel := c.SelectFrom("customer_entity", "ce").AddColumns("ce.entity_id", "ce.email").
+			Where(
+				Column("ce.is_active").PlaceHolder(),
+				Column("ce.email").Like().PlaceHolder(),
+				Column("ce.created_at").Less().PlaceHolder(),
+				Column("ce.hash").PlaceHolder(),
+				Column("ce.group_id").In().PlaceHolder(),
+			).
+			OrderBy("ce.entity_id").
+			Limit(20, 10)
+
+		compareToSQL(t, sel.WithArgs().Bool(true).String(`%o'b\r%`).Time(time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC)).Bytes([]byte{0xff, 0xfe}).Ints(1, 2), errors.NoKind,
+			`SELECT "ce"."entity_id", "ce"."email" FROM "customer_entity" AS "ce" WHERE ("ce"."is_active" = $1) AND ("ce"."email" LIKE $2) AND ("ce"."created_at" < $3) AND ("ce"."hash" = $4) AND ("ce"."group_id" IN $5) ORDER BY "ce"."entity_id" LIMIT 10 OFFSET 20`,
+			`SELECT "ce"."entity_id", "ce"."email" FROM "customer_entity" AS "ce" WHERE ("ce"."is_active" = TRUE) AND ("ce"."email" LIKE E'%o''b\\r%') AND ("ce"."created_at" < '2019-01-02 03:04:05+00:00') AND ("ce"."hash" = decode('fffe','hex')) AND ("ce"."group_id" IN (1,2)) ORDER BY "ce"."entity_id" LIMIT 10 OFFSET 20`,
+			true, `%o'b\r%`, time.Date(2019, 1, 2, 3, 4, 5, 0, time.UTC), []byte{0xff, 0xfe}, int64(1), int64(2),
+		)
+	})
+
+	t.Run("artisan limit", func(t *testing.T) {
+		sel := c.SelectFrom("t").AddColumns("a")
+		compareToSQL(t, sel.WithArgs().Limit(5, 7), errors.NoKind,
+			`SELECT "a" FROM "t" LIMIT 7 OFFSET 5`,
+			"",
+		)
+	})
+}
+
+func TestPostgresDialect_Insert(t *testing.T) {
+	t.Parallel()
+	c := newPostgresConnPool(t)
+
+	t.Run("ON CONFLICT DO UPDATE with RETURNING", func(t *testing.T) {
+		ins := c.InsertInto("catalog_product_entity").AddColumns("entity_id", "sku", "qty").
+			AddOnConflictTarget("entity_id").AddOnDuplicateKeyExclude("entity_id").OnDuplicateKey().
+			AddOnDuplicateKey(Column("updated_at").Expr("now()"))
+		ins.Returning = NewSelect("entity_id", "sku")
+
+		compareToSQL(t, ins.WithArgs().Int(1).String("a").Int(3).Int(2).String("b").Int(4), errors.NoKind,
+			`INSERT INTO "catalog_product_entity" ("entity_id","sku","qty") VALUES ($1,$2,$3),($4,$5,$6) ON CONFLICT ("entity_id") DO UPDATE SET "sku"=EXCLUDED."sku", "qty"=EXCLUDED."qty", "updated_at"=now() RETURNING "entity_id", "sku"`,
+			`INSERT INTO "catalog_product_entity" ("entity_id","sku","qty") VALUES (1,'a',3),(2,'b',4) ON CONFLICT ("entity_id") DO UPDATE SET "sku"=EXCLUDED."sku", "qty"=EXCLUDED."qty", "updated_at"=now() RETURNING "entity_id", "sku"`,
+			int64(1), "a", int64(3), int64(2), "b", int64(4),
+		)
+	})
+
+	t.Run("IGNORE becomes DO NOTHING", func(t *testing.T) {
+		ins := c.InsertInto("t").AddColumns("a", "b").Ignore()
+		compareToSQL(t, ins.WithArgs().Int(1).Bool(false), errors.NoKind,
+			`INSERT INTO "t" ("a","b") VALUES ($1,$2) ON CONFLICT DO NOTHING`,
+			`INSERT INTO "t" ("a","b") VALUES (1,FALSE) ON CONFLICT DO NOTHING`,
+			int64(1), false,
+		)
+	})
+
+	t.Run("conflict target with IGNORE", func(t *testing.T) {
+		ins := c.InsertInto("t").AddColumns("a", "b").AddOnConflictTarget("a").Ignore()
+		compareToSQL(t, ins.WithArgs().Int(1).Int(2), errors.NoKind,
+			`INSERT INTO "t" ("a","b") VALUES ($1,$2) ON CONFLICT ("a") DO NOTHING`,
+			`INSERT INTO "t" ("a","b") VALUES (1,2) ON CONFLICT ("a") DO NOTHING`,
+			int64(1), int64(2),
+		)
+	})
+
+	t.Run("exclude is not the conflict target", func(t *testing.T) {
+		ins := c.InsertInto("t").AddColumns("a", "b").AddOnDuplicateKeyExclude("a")
+		compareToSQL(t, ins.WithArgs().Int(1).Int(2), errors.NotValid, "", "")
+	})
+
+	t.Run("missing conflict target", func(t *testing.T) {
+		ins := c.InsertInto("t").AddColumns("a", "b").OnDuplicateKey()
+		compareToSQL(t, ins.WithArgs().Int(1).Int(2), errors.NotValid, "", "")
+	})
+
+	t.Run("REPLACE not supported", func(t *testing.T) {
+		ins := c.InsertInto("t").AddColumns("a").Replace()
+		compareToSQL(t, ins.WithArgs().Int(1), errors.NotSupported, "", "")
+	})
+}
+
+func TestPostgresDialect_UpdateDelete(t *testing.T) {
+	t.Parallel()
+	c := newPostgresConnPool(t)
+
+	t.Run("update returning", func(t *testing.T) {
+		up := c.Update("t").Set(Column("a").PlaceHolder()).Where(Column("b").PlaceHolder())
+		up.Returning = NewSelect("a", "b")
+		compareToSQL(t, up.WithArgs().String("x").Int(2), errors.NoKind,
+			`UPDATE "t" SET "a"=$1 WHERE ("b" = $2) RETURNING "a", "b"`,
+			`UPDATE "t" SET "a"='x' WHERE ("b" = 2) RETURNING "a", "b"`,
+			"x", int64(2),
+		)
+	})
+
+	t.Run("delete returning with artisan order by", func(t *testing.T) {
+		del := c.DeleteFrom("t").Where(Column("b").PlaceHolder())
+		del.Returning = NewSelect("a")
+		compareToSQL(t, del.WithArgs().Int(2).OrderBy("a"), errors.NoKind,
+			`DELETE FROM "t" WHERE ("b" = $1) ORDER BY "a" RETURNING "a"`,
+			"",
+			int64(2),
+		)
+	})
+
+	t.Run("returning without columns", func(t *testing.T) {
+		del := c.DeleteFrom("t")
+		del.Returning = NewSelect()
+		compareToSQL(t, del.WithArgs(), errors.Empty, "", "")
+	})
+}
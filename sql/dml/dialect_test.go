@@ -24,7 +24,8 @@ import (
 
 // They both must be kept in sync
 var _ null.Dialecter = (*mysqlDialect)(nil)
-var _ dialecter = (*mysqlDialect)(nil)
+var _ Dialect = (*mysqlDialect)(nil)
+var _ Dialect = (*postgresDialect)(nil)
 
 func TestEscapeWith_NaughtyStrings(t *testing.T) {
 	s := createRealSessionWithFixtures(t, nil)
@@ -19,7 +19,10 @@
 // parts of the query. No reflection magic has been used so we must achieve
 // type safety with code generation.
 //
-// This package works only with MySQL and its derivates like MariaDB or Percona.
+// This package has been written for MySQL and its derivates like MariaDB or
+// Percona. The builders generate MySQL flavoured SQL which gets translated into
+// the dialect of the ConnPool. PostgreSQL can be used via the option
+// WithDialect(DialectPostgreSQL()).
 //
 // Abbreviations
 //
@@ -48,7 +51,8 @@
 //
 // TODO(CyS) refactor some parts of the code once Go implements generics ;-)
 //
-// TODO(CyS) implement usage of window functions:
+// Window functions: see type Window, function Condition.Over and
+// Select.Window.
 //    - https://mariadb.com/kb/en/library/window-functions/
 //    - https://dev.mysql.com/doc/refman/8.0/en/window-functions-usage.html
 //    - https://blog.statsbot.co/sql-window-functions-tutorial-b5075b87d129
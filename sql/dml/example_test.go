@@ -737,6 +737,34 @@ func ExampleSelect_AddColumnsConditions() {
 	//(`promotion_id` NOT IN (4711,815,42))
 }
 
+func ExampleSelect_Window() {
+	s := dml.NewSelect("entity_id", "customer_id", "grand_total").
+		AddColumnsConditions(
+			dml.Expr("ROW_NUMBER()").Over(dml.NamedWindow("w")).Alias("order_seq"),
+			dml.Expr("SUM(grand_total)").Over(
+				dml.NamedWindow("w").RowsBetween(dml.FrameUnboundedPreceding(), dml.FrameCurrentRow()),
+			).Alias("running_total"),
+		).
+		From("sales_order").
+		Where(dml.Column("store_id").PlaceHolder()).
+		Window("w", dml.NewWindow().PartitionBy("customer_id").OrderBy("created_at"))
+	writeToSQLAndInterpolate(s.WithArgs().Int(1))
+
+	// Output:
+	//Prepared Statement:
+	//SELECT `entity_id`, `customer_id`, `grand_total`, ROW_NUMBER() OVER `w` AS
+	//`order_seq`, SUM(grand_total) OVER (`w` ROWS BETWEEN UNBOUNDED PRECEDING AND
+	//CURRENT ROW) AS `running_total` FROM `sales_order` WHERE (`store_id` = ?) WINDOW
+	//`w` AS (PARTITION BY `customer_id` ORDER BY `created_at`)
+	//Arguments: [1]
+	//
+	//Interpolated Statement:
+	//SELECT `entity_id`, `customer_id`, `grand_total`, ROW_NUMBER() OVER `w` AS
+	//`order_seq`, SUM(grand_total) OVER (`w` ROWS BETWEEN UNBOUNDED PRECEDING AND
+	//CURRENT ROW) AS `running_total` FROM `sales_order` WHERE (`store_id` = 1) WINDOW
+	//`w` AS (PARTITION BY `customer_id` ORDER BY `created_at`)
+}
+
 func ExampleParenthesisOpen() {
 	s := dml.NewSelect("columnA", "columnB").
 		Distinct().
@@ -102,11 +102,22 @@ type Insert struct {
 	OnDuplicateKeyExclude []string
 	// IsOnDuplicateKey if enabled adds all columns to the ON DUPLICATE KEY
 	// claus. Takes the OnDuplicateKeyExclude field into consideration.
+	//
+	// If the dialect of the connection does not support ON DUPLICATE KEY, like
+	// PostgreSQL, the clause gets written as ON CONFLICT (...) DO UPDATE SET
+	// with the columns of field `OnConflictTarget`.
 	IsOnDuplicateKey bool
+	// OnConflictTarget contains the columns of the unique index which the
+	// ON CONFLICT clause checks for a violation. Only used by dialects which do
+	// not support ON DUPLICATE KEY, like PostgreSQL. MySQL ignores this field.
+	OnConflictTarget []string
 	// IsReplace uses the REPLACE syntax. See function Replace().
 	IsReplace bool
 	// IsIgnore ignores error. See function Ignore().
 	IsIgnore bool
+	// Returning writes the columns of the Select as RETURNING clause to
+	// return the inserted rows. Supported by MariaDB >= 10.5 and PostgreSQL.
+	Returning *Select
 	// IsBuildValues if true the VALUES part gets build when calling ToSQL.
 	// VALUES do not need to get build by default because mostly WithArgs gets
 	// called to build the VALUES part dynamically.
@@ -135,9 +146,12 @@ func newInsertInto(db QueryExecPreparer, cCom *connCommon, into string) *Insert
 	return &Insert{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  db,
+				id:      id,
+				Log:     l,
+				DB:      db,
+				dialect: cCom.dialect,
+				tracer:  cCom.tracer,
+				table:   into,
 			},
 		},
 		Into: into,
@@ -243,6 +257,13 @@ func (b *Insert) AddOnDuplicateKeyExclude(columns ...string) *Insert {
 	return b
 }
 
+// AddOnConflictTarget adds columns to the conflict target of the ON CONFLICT
+// clause. See field `OnConflictTarget`.
+func (b *Insert) AddOnConflictTarget(columns ...string) *Insert {
+	b.OnConflictTarget = append(b.OnConflictTarget, columns...)
+	return b
+}
+
 // OnDuplicateKey enables for all columns to be written into the ON DUPLICATE
 // KEY claus. Takes the field OnDuplicateKeyExclude into consideration.
 func (b *Insert) OnDuplicateKey() *Insert {
@@ -324,6 +345,7 @@ func (b *Insert) writeBuildCache(sql []byte, qualifiedColumns []string) {
 		b.Pairs = nil
 		b.OnDuplicateKeys = nil
 		b.OnDuplicateKeyExclude = nil
+		b.Returning = nil
 	}
 	b.qualifiedColumns = qualifiedColumns
 }
@@ -351,13 +373,18 @@ func (b *Insert) toSQL(buf *bytes.Buffer, placeHolders []string) ([]string, erro
 		return nil, errors.Empty.Newf("[dml] Inserted table is missing")
 	}
 
+	isOnConflict := b.isOnConflict()
+	if b.IsReplace && isOnConflict {
+		return nil, errors.NotSupported.Newf("[dml] Insert: REPLACE is not supported by dialect %q", b.dialect.Name())
+	}
+
 	ior := "INSERT "
 	if b.IsReplace {
 		ior = "REPLACE "
 	}
 	buf.WriteString(ior)
 	writeStmtID(buf, b.id)
-	if b.IsIgnore {
+	if b.IsIgnore && !isOnConflict {
 		buf.WriteString("IGNORE ")
 	}
 
@@ -380,7 +407,7 @@ func (b *Insert) toSQL(buf *bytes.Buffer, placeHolders []string) ([]string, erro
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
-		return b.writeOnDuplicateKey(buf, ph)
+		return b.writeTail(buf, ph)
 	}
 
 	if len(b.Columns) > 0 {
@@ -443,7 +470,15 @@ func (b *Insert) toSQL(buf *bytes.Buffer, placeHolders []string) ([]string, erro
 		}
 	}
 
-	return b.writeOnDuplicateKey(buf, placeHolders)
+	return b.writeTail(buf, placeHolders)
+}
+
+// writeTail writes the clauses after the VALUES or SELECT part.
+func (b *Insert) writeTail(buf *bytes.Buffer, placeHolders []string) (_ []string, err error) {
+	if placeHolders, err = b.writeOnDuplicateKey(buf, placeHolders); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return sqlWriteReturning(buf, b.Returning, placeHolders)
 }
 
 func (b *Insert) writeOnDuplicateKey(buf *bytes.Buffer, placeHolders []string) ([]string, error) {
@@ -468,7 +503,21 @@ func (b *Insert) writeOnDuplicateKey(buf *bytes.Buffer, placeHolders []string) (
 		}
 	}
 
-	return b.OnDuplicateKeys.writeOnDuplicateKey(buf, placeHolders)
+	if !b.isOnConflict() {
+		return b.OnDuplicateKeys.writeOnDuplicateKey(buf, placeHolders)
+	}
+	if len(b.OnDuplicateKeys) == 0 {
+		if b.IsIgnore {
+			buf.Write(onConflictPart)
+			writeConflictTarget(buf, b.OnConflictTarget)
+			buf.WriteString("DO NOTHING")
+		}
+		return placeHolders, nil
+	}
+	if len(b.OnConflictTarget) == 0 {
+		return nil, errors.NotValid.Newf("[dml] Insert: ON CONFLICT requires the conflict target columns in field OnConflictTarget")
+	}
+	return b.OnDuplicateKeys.writeUpsert(buf, b.OnConflictTarget, placeHolders)
 }
 
 func strInSlice(search string, sl []string) bool {
@@ -500,8 +549,10 @@ func (b *Insert) Clone() *Insert {
 	c.BuilderBase = b.BuilderBase.Clone()
 	c.Columns = cloneStringSlice(b.Columns)
 	c.OnDuplicateKeyExclude = cloneStringSlice(b.OnDuplicateKeyExclude)
+	c.OnConflictTarget = cloneStringSlice(b.OnConflictTarget)
 	c.OnDuplicateKeys = b.OnDuplicateKeys.Clone()
 	c.Select = b.Select.Clone()
 	c.Pairs = b.Pairs.Clone()
+	c.Returning = b.Returning.Clone()
 	return &c
 }
@@ -0,0 +1,279 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"sort"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/util/bufferpool"
+)
+
+// Default limits for type BatchInsert.
+const (
+	// DefaultMaxAllowedPacket defines the default value of the MySQL 5.7
+	// server variable max_allowed_packet in bytes.
+	DefaultMaxAllowedPacket uint64 = 4 << 20
+	// MaxPlaceholders defines the maximum number of place holders a prepared
+	// statement can contain.
+	MaxPlaceholders uint = 65535
+)
+
+// VariableReader reads the value of a server variable. Type ddl.Variables
+// implements this interface.
+type VariableReader interface {
+	Uint64(key string) (val uint64, ok bool)
+}
+
+// BatchResult contains the outcome of an executed chunk of a BatchInsert.
+type BatchResult struct {
+	// Chunk zero based index of the chunk in the order of the incoming
+	// records.
+	Chunk int
+	// Offset zero based position of the first record of the chunk in the
+	// stream of records.
+	Offset int
+	// RowCount contains the number of records in the chunk.
+	RowCount     int
+	LastInsertID int64
+	RowsAffected int64
+	// Err contains the error of a failed chunk.
+	Err error
+}
+
+// BatchInsert splits a stream of records into several INSERT statements. A
+// chunk gets executed as soon as the next record would exceed the size of the
+// max_allowed_packet, the maximum number of place holders or the maximum
+// number of rows. The Insert object acts as template and must have its DB
+// set, e.g. created by ConnPool.InsertInto or Tx.InsertInto. The Columns field
+// must contain the columns to insert. ON DUPLICATE KEY, IGNORE and RETURNING
+// clauses get applied to each chunk.
+//
+// If the Insert has been created by a ConnPool, the chunks can run
+// concurrently. Inside a Tx they run sequentially. A record which implements
+// LastInsertIDAssigner gets its ID assigned after its chunk has been executed.
+//		bi := dml.NewBatchInsert(dbc.InsertInto("catalog_product_entity").AddColumns("sku", "type_id")).
+//			WithVariables(vars) // vars loaded with ddl.NewVariables("max_allowed_packet")
+//		bi.Concurrency = 4
+//		results, err := bi.ExecContext(ctx, recordsChan)
+type BatchInsert struct {
+	Insert *Insert
+	// MaxAllowedPacket defines the maximum size in bytes of a single SQL
+	// statement. Defaults to DefaultMaxAllowedPacket. See WithVariables.
+	MaxAllowedPacket uint64
+	// MaxPlaceholders defines the maximum number of place holders in a single
+	// statement. Defaults to MaxPlaceholders.
+	MaxPlaceholders uint
+	// MaxRows optional maximum number of records in a single statement.
+	MaxRows uint
+	// Concurrency defines the number of chunks which can run in parallel. Zero
+	// or one executes the chunks sequentially. Values greater one are only
+	// allowed when the DB of the Insert is a connection pool. Reading the
+	// next records blocks until a worker becomes available.
+	Concurrency uint
+	// ContinueOnError if set executes the remaining chunks after a chunk has
+	// failed. Otherwise the execution stops after the first failure.
+	ContinueOnError bool
+}
+
+// NewBatchInsert creates a new BatchInsert with the default limits.
+func NewBatchInsert(ins *Insert) *BatchInsert {
+	return &BatchInsert{
+		Insert:           ins,
+		MaxAllowedPacket: DefaultMaxAllowedPacket,
+		MaxPlaceholders:  MaxPlaceholders,
+	}
+}
+
+// WithVariables reads the server variable max_allowed_packet to limit the
+// size of a chunk.
+func (bi *BatchInsert) WithVariables(vr VariableReader) *BatchInsert {
+	if v, ok := vr.Uint64("max_allowed_packet"); ok && v > 0 {
+		bi.MaxAllowedPacket = v
+	}
+	return bi
+}
+
+// ExecRecords same as ExecContext but for a slice of records.
+func (bi *BatchInsert) ExecRecords(ctx context.Context, records ...ColumnMapper) ([]BatchResult, error) {
+	recChan := make(chan ColumnMapper, len(records))
+	for _, rec := range records {
+		recChan <- rec
+	}
+	close(recChan)
+	return bi.ExecContext(ctx, recChan)
+}
+
+// ExecContext reads the records from the channel until it gets closed, splits
+// them into chunks and executes them. The returned results are sorted by the
+// chunk index. If a chunk fails, the returned error contains the error of the
+// first failed chunk. A record exceeding a limit on its own returns an
+// OutOfRange error.
+func (bi *BatchInsert) ExecContext(ctx context.Context, records <-chan ColumnMapper) ([]BatchResult, error) {
+	if bi.Insert == nil || bi.Insert.DB == nil {
+		return nil, errors.Empty.Newf("[dml] BatchInsert requires an Insert object with a DB")
+	}
+	workers := int(bi.Concurrency)
+	if workers < 1 {
+		workers = 1
+	}
+	if _, ok := bi.Insert.DB.(*sql.DB); workers > 1 && !ok {
+		return nil, errors.NotAllowed.Newf("[dml] BatchInsert: Concurrent execution requires a connection pool but got %T", bi.Insert.DB)
+	}
+	maxPacket, maxPH := bi.MaxAllowedPacket, bi.MaxPlaceholders
+	if maxPacket == 0 {
+		maxPacket = DefaultMaxAllowedPacket
+	}
+	if maxPH == 0 || maxPH > MaxPlaceholders {
+		maxPH = MaxPlaceholders
+	}
+
+	baseSQL, _, err := bi.Insert.ToSQL()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	baseSize := uint64(len(baseSQL))
+	columns := bi.Insert.qualifiedColumns
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		results []BatchResult
+		sem     = make(chan struct{}, workers)
+	)
+
+	run := func(br BatchResult, recs []QualifiedRecord) {
+		res, err := bi.Insert.WithArgs().Records(recs...).ExecContext(ctx)
+		if err == nil {
+			if br.LastInsertID, err = res.LastInsertId(); err == nil {
+				br.RowsAffected, err = res.RowsAffected()
+			}
+		}
+		br.Err = errors.WithStack(err)
+		if bi.Insert.Log != nil && bi.Insert.Log.IsDebug() {
+			bi.Insert.Log.Debug("BatchInsert.ExecContext", log.Int("chunk", br.Chunk), log.Int("row_count", br.RowCount), log.Err(err))
+		}
+		if err != nil && !bi.ContinueOnError {
+			cancel()
+		}
+		mu.Lock()
+		results = append(results, br)
+		mu.Unlock()
+	}
+
+	var (
+		chunk     []QualifiedRecord
+		chunkSize = baseSize
+		chunkPH   uint
+		chunkIdx  int
+		offset    int
+	)
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		br, recs := BatchResult{Chunk: chunkIdx, Offset: offset, RowCount: len(chunk)}, chunk
+		chunkIdx++
+		offset += len(chunk)
+		chunk, chunkSize, chunkPH = nil, baseSize, 0
+
+		if workers == 1 {
+			run(br, recs)
+			return
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			run(br, recs)
+		}()
+	}
+
+	cm := NewColumnMap(len(columns))
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+
+	var recErr, ctxErr error
+	pos := 0
+RecordLoop:
+	for {
+		if ctxErr = ctx.Err(); ctxErr != nil {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			ctxErr = ctx.Err()
+			break RecordLoop
+		case rec, ok := <-records:
+			if !ok {
+				flush()
+				break RecordLoop
+			}
+			rowSize, rowPH, err := estimateInsertRecord(cm, buf, columns, rec)
+			if err != nil {
+				recErr = errors.Wrapf(err, "[dml] BatchInsert: Failed to map record at position %d", pos)
+				break RecordLoop
+			}
+			if baseSize+rowSize > maxPacket || rowPH > maxPH {
+				recErr = errors.OutOfRange.Newf("[dml] BatchInsert: Record at position %d with %d bytes and %d place holders exceeds the limits of %d bytes and %d place holders", pos, rowSize, rowPH, maxPacket, maxPH)
+				break RecordLoop
+			}
+			if len(chunk) > 0 && (chunkSize+rowSize > maxPacket || chunkPH+rowPH > maxPH || (bi.MaxRows > 0 && uint(len(chunk)) >= bi.MaxRows)) {
+				flush()
+			}
+			chunk = append(chunk, Qualify("", rec))
+			chunkSize += rowSize
+			chunkPH += rowPH
+			pos++
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].Chunk < results[j].Chunk })
+
+	if recErr != nil {
+		return results, recErr
+	}
+	for _, br := range results {
+		if br.Err != nil {
+			return results, errors.Wrapf(br.Err, "[dml] BatchInsert: Chunk %d with offset %d failed", br.Chunk, br.Offset)
+		}
+	}
+	return results, errors.WithStack(ctxErr)
+}
+
+// estimateInsertRecord returns the interpolated size in bytes of a record and
+// its number of place holders.
+func estimateInsertRecord(cm *ColumnMap, buf *bytes.Buffer, columns []string, rec ColumnMapper) (size uint64, placeHolders uint, err error) {
+	cm.arguments = cm.arguments[:0]
+	cm.setColumns(columns)
+	if err = rec.MapColumns(cm); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	buf.Reset()
+	if err = cm.arguments.Write(buf); err != nil {
+		return 0, 0, errors.WithStack(err)
+	}
+	// +1 for the comma separating the rows.
+	return uint64(buf.Len()) + 1, uint(cm.arguments.Len()), nil
+}
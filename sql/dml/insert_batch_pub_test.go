@@ -0,0 +1,206 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+var _ dml.VariableReader = (*batchVariables)(nil)
+
+type batchVariables map[string]uint64
+
+func (bv batchVariables) Uint64(key string) (uint64, bool) {
+	v, ok := bv[key]
+	return v, ok
+}
+
+func batchRecords(n int) []dml.ColumnMapper {
+	recs := make([]dml.ColumnMapper, n)
+	for i := range recs {
+		recs[i] = someRecord{SomethingID: i + 1, UserID: int64(i + 10), Other: i%2 == 0}
+	}
+	return recs
+}
+
+const (
+	batchSQL2Rows = "INSERT INTO `a` (`something_id`,`user_id`,`other`) VALUES (?,?,?),(?,?,?)"
+	batchSQL1Row  = "INSERT INTO `a` (`something_id`,`user_id`,`other`) VALUES (?,?,?)"
+)
+
+func TestBatchInsert_Sequential(t *testing.T) {
+	t.Parallel()
+
+	t.Run("chunked by place holders", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL2Rows)).
+			WithArgs(1, 10, true, 2, 11, false).WillReturnResult(sqlmock.NewResult(1, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL2Rows)).
+			WithArgs(3, 12, true, 4, 13, false).WillReturnResult(sqlmock.NewResult(3, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).
+			WithArgs(5, 14, true).WillReturnResult(sqlmock.NewResult(5, 1))
+
+		bi := dml.NewBatchInsert(dbc.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+		bi.MaxPlaceholders = 6
+		res, err := bi.ExecRecords(context.TODO(), batchRecords(5)...)
+		assert.NoError(t, err)
+		assert.Exactly(t, []dml.BatchResult{
+			{Chunk: 0, Offset: 0, RowCount: 2, LastInsertID: 1, RowsAffected: 2},
+			{Chunk: 1, Offset: 2, RowCount: 2, LastInsertID: 3, RowsAffected: 2},
+			{Chunk: 2, Offset: 4, RowCount: 1, LastInsertID: 5, RowsAffected: 1},
+		}, res)
+	})
+
+	t.Run("chunked by max_allowed_packet and MaxRows", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		ins := dbc.InsertInto("a").AddColumns("something_id", "user_id", "other")
+		baseSQL, _, err := ins.ToSQL()
+		assert.NoError(t, err)
+
+		// Each row `(1,10,1),` has 10 bytes, so two rows fit into the packet.
+		bi := dml.NewBatchInsert(ins).WithVariables(batchVariables{"max_allowed_packet": uint64(len(baseSQL) + 25)})
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL2Rows)).WillReturnResult(sqlmock.NewResult(1, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(3, 1))
+
+		res, err := bi.ExecRecords(context.TODO(), batchRecords(3)...)
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+
+		bi.MaxRows = 1
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(4, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(5, 1))
+		res, err = bi.ExecRecords(context.TODO(), batchRecords(2)...)
+		assert.NoError(t, err)
+		assert.Len(t, res, 2)
+	})
+
+	t.Run("record exceeds max_allowed_packet", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		bi := dml.NewBatchInsert(dbc.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+		bi.MaxAllowedPacket = 10
+		res, err := bi.ExecRecords(context.TODO(), batchRecords(1)...)
+		assert.True(t, errors.OutOfRange.Match(err), "%+v", err)
+		assert.Len(t, res, 0)
+	})
+
+	t.Run("stops after failed chunk", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(1, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnError(errors.Duplicated.Newf("Duplicate entry"))
+
+		bi := dml.NewBatchInsert(dbc.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+		bi.MaxRows = 1
+		res, err := bi.ExecRecords(context.TODO(), batchRecords(4)...)
+		assert.True(t, errors.Duplicated.Match(err), "%+v", err)
+		assert.Len(t, res, 2)
+		assert.NoError(t, res[0].Err)
+		assert.True(t, errors.Duplicated.Match(res[1].Err), "%+v", res[1].Err)
+	})
+
+	t.Run("continues after failed chunk", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnError(errors.Duplicated.Newf("Duplicate entry"))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(2, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(3, 1))
+
+		bi := dml.NewBatchInsert(dbc.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+		bi.MaxRows = 1
+		bi.ContinueOnError = true
+		res, err := bi.ExecRecords(context.TODO(), batchRecords(3)...)
+		assert.True(t, errors.Duplicated.Match(err), "%+v", err)
+		assert.Len(t, res, 3)
+		assert.Exactly(t, int64(3), res[2].LastInsertID)
+	})
+
+	t.Run("within a transaction", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL2Rows)).WillReturnResult(sqlmock.NewResult(1, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL1Row)).WillReturnResult(sqlmock.NewResult(3, 1))
+		dbMock.ExpectCommit()
+
+		tx, err := dbc.BeginTx(context.TODO(), nil)
+		assert.NoError(t, err)
+
+		bi := dml.NewBatchInsert(tx.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+		bi.MaxRows = 2
+		_, err = bi.ExecRecords(context.TODO(), batchRecords(3)...)
+		assert.NoError(t, err)
+
+		bi.Concurrency = 2
+		_, err = bi.ExecRecords(context.TODO(), batchRecords(3)...)
+		assert.True(t, errors.NotAllowed.Match(err), "%+v", err)
+
+		assert.NoError(t, tx.Commit())
+	})
+
+	t.Run("missing DB", func(t *testing.T) {
+		_, err := dml.NewBatchInsert(dml.NewInsert("a")).ExecRecords(context.TODO())
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+}
+
+func TestBatchInsert_Concurrent(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	dbMock.MatchExpectationsInOrder(false)
+
+	for i := 0; i < 5; i++ {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(batchSQL2Rows)).WillReturnResult(sqlmock.NewResult(int64(i*2+1), 2))
+	}
+
+	bi := dml.NewBatchInsert(dbc.InsertInto("a").AddColumns("something_id", "user_id", "other"))
+	bi.MaxRows = 2
+	bi.Concurrency = 3
+
+	recChan := make(chan dml.ColumnMapper)
+	go func() {
+		for _, rec := range batchRecords(10) {
+			recChan <- rec
+		}
+		close(recChan)
+	}()
+
+	res, err := bi.ExecContext(context.TODO(), recChan)
+	assert.NoError(t, err)
+	assert.Len(t, res, 5)
+	for i, br := range res {
+		assert.Exactly(t, i, br.Chunk)
+		assert.Exactly(t, i*2, br.Offset)
+		assert.Exactly(t, 2, br.RowCount)
+		assert.NoError(t, br.Err)
+	}
+}
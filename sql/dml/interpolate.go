@@ -75,7 +75,8 @@ func expandPlaceHolders(buf writer, sql []byte, args arguments) error {
 		case placeHolderRune:
 			if i < len(args) {
 				reps := args[i].len()
-				if reps > 1 {
+				parens := reps > 1 || args[i].isSlice()
+				if parens {
 					buf.WriteByte('(')
 				}
 				for r := 0; r < reps; r++ {
@@ -84,7 +85,7 @@ func expandPlaceHolders(buf writer, sql []byte, args arguments) error {
 						buf.WriteByte(',')
 					}
 				}
-				if reps > 1 {
+				if parens {
 					buf.WriteByte(')')
 				}
 			}
@@ -284,7 +285,8 @@ func writeInterpolate(buf *bytes.Buffer, sql string, args arguments) error {
 // writeInterpolateByte same as writeInterpolate. Maybe package unsafe can do
 // here some magic to avoid duplicate code, but for now we stick with a copy of
 // the above original function writeInterpolateByte.
-func writeInterpolateBytes(buf *bytes.Buffer, sql []byte, args arguments) error {
+// The arguments and the identifiers in brackets get escaped with dialect `d`.
+func writeInterpolateBytes(d Dialect, buf *bytes.Buffer, sql []byte, args arguments) error {
 
 	phCount, argCount := bytes.Count(sql, placeHolderByte), len(args)
 	if argCount > 0 && phCount != argCount {
@@ -300,7 +302,7 @@ func writeInterpolateBytes(buf *bytes.Buffer, sql []byte, args arguments) error
 		switch {
 		case r == placeHolderRune && argCount > 0:
 			if phCounter < argCount { // protect for index out of bounds
-				if err := args[phCounter].writeTo(buf, 0); err != nil {
+				if err := args[phCounter].writeToDialect(d, buf, 0); err != nil {
 					return errors.WithStack(err)
 				}
 			}
@@ -319,7 +321,7 @@ func writeInterpolateBytes(buf *bytes.Buffer, sql []byte, args arguments) error
 		case r == '[':
 			w = bytes.IndexByte(sql[pos:], ']')
 			col := sql[pos : pos+w]
-			dialect.EscapeIdent(buf, string(col))
+			d.EscapeIdent(buf, string(col))
 			pos += w + 1 // size of ']'
 		default:
 			buf.Write(sql[pos-w : pos])
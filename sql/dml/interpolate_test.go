@@ -54,6 +54,13 @@ func TestExpandPlaceHolders(t *testing.T) {
 		assert.Exactly(t, "SELECT * FROM `table` WHERE id IN (?)", s)
 		assert.Exactly(t, []interface{}{int64(1)}, args.Interfaces())
 	})
+	t.Run("one arg with a slice of one value", func(t *testing.T) {
+		args := MakeArgs(1).Int64s(7)
+		s, err := ExpandPlaceHolders("SELECT * FROM `table` WHERE id IN ?", args)
+		assert.NoError(t, err)
+		assert.Exactly(t, "SELECT * FROM `table` WHERE id IN (?)", s)
+		assert.Exactly(t, []interface{}{int64(7)}, args.Interfaces())
+	})
 	t.Run("one arg with three values", func(t *testing.T) {
 		args := MakeArgs(1).Int64s(11, 3, 5)
 		s, err := ExpandPlaceHolders("SELECT * FROM `table` WHERE id IN ?", args)
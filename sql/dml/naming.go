@@ -51,6 +51,9 @@ type id struct {
 	// Sort applies only to GROUP BY and ORDER BY clauses. 'd'=descending,
 	// 0=default or nothing; 'a'=ascending.
 	Sort byte
+	// Window if set, writes the OVER clause after the Name or Expression
+	// field and turns the identifier into a window function.
+	Window *Window
 }
 
 const (
@@ -70,6 +73,7 @@ func (a id) Clone() id {
 	if nil != a.DerivedTable {
 		a.DerivedTable = a.DerivedTable.Clone()
 	}
+	a.Window = a.Window.Clone()
 	return a
 }
 
@@ -127,6 +131,11 @@ func (a id) writeQuoted(w *bytes.Buffer, placeHolders []string) (_ []string, err
 	} else {
 		Quoter.WriteIdentifier(w, a.Name)
 	}
+	if a.Window != nil {
+		if placeHolders, err = a.Window.writeOver(w, placeHolders); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
 	if a.Aliased != "" {
 		w.WriteString(" AS ")
 		Quoter.quote(w, a.Aliased)
@@ -230,7 +239,7 @@ func (idc ids) AppendColumnsAliases(isUnsafe bool, columns ...string) ids {
 func (idc ids) appendConditions(expressions Conditions) (ids, error) {
 	buf := bufferpool.Get()
 	for _, e := range expressions {
-		idf := id{Name: e.Left, Aliased: e.Aliased}
+		idf := id{Name: e.Left, Aliased: e.Aliased, Window: e.Window}
 		if e.IsLeftExpression {
 			idf.Expression = idf.Name
 			idf.Name = ""
@@ -0,0 +1,713 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+)
+
+// QueryStatsBuckets defines the upper bounds of the latency histogram in
+// QueryStat.Histogram. The last histogram entry counts all queries slower than
+// the last bound.
+var QueryStatsBuckets = [...]time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+}
+
+// queryStatsOther collects all queries once QueryStats.MaxFingerprints has
+// been reached.
+const queryStatsOther = "(other)"
+
+// QueryStat contains the aggregated statistics of all queries with the same
+// fingerprint.
+type QueryStat struct {
+	Fingerprint string `json:"fingerprint"`
+	Calls       uint64 `json:"calls"`
+	Errors      uint64 `json:"errors"`
+	// Slow counts the queries which took longer than the slow threshold.
+	Slow         uint64 `json:"slow"`
+	RowsReturned uint64 `json:"rows_returned"`
+	RowsAffected uint64 `json:"rows_affected"`
+	// Total, Max and Avg are the latencies in nano seconds. The latency of a
+	// SELECT query gets measured until the driver returns the first result,
+	// without reading the rows.
+	Total     time.Duration                      `json:"total_ns"`
+	Max       time.Duration                      `json:"max_ns"`
+	Avg       time.Duration                      `json:"avg_ns"`
+	Histogram [len(QueryStatsBuckets) + 1]uint64 `json:"histogram"`
+	// Plan contains the last output of EXPLAIN FORMAT=JSON for a slow query.
+	Plan json.RawMessage `json:"plan,omitempty"`
+
+	explainedAt time.Time
+}
+
+// QueryStats collects statistics per normalized query fingerprint, see
+// function QueryFingerprint. Queries slower than SlowThreshold get logged and
+// explained with EXPLAIN FORMAT=JSON. QueryStats implements http.Handler to
+// expose the top-N queries as JSON. Use function WithQueryStats to collect the
+// statistics of a connection pool. QueryStats is safe for concurrent use.
+//		qs := dml.NewQueryStats(200*time.Millisecond, logger)
+//		dbc, err := dml.NewConnPool(dml.WithDSN(dsn), dml.WithQueryStats(qs))
+//		http.Handle("/debug/queries", qs) // GET /debug/queries?n=20&sort=calls
+type QueryStats struct {
+	// SlowThreshold logs all queries which took longer and explains them. Zero
+	// disables the slow query log.
+	SlowThreshold time.Duration
+	// ExplainInterval defines how often a slow query with the same fingerprint
+	// gets explained again. Zero explains each fingerprint only once.
+	ExplainInterval time.Duration
+	// ExplainTimeout limits the runtime of an EXPLAIN query. Defaults to five
+	// seconds.
+	ExplainTimeout time.Duration
+	// MaxFingerprints limits the number of collected fingerprints to protect
+	// against unbounded memory usage. All further queries get collected as
+	// "(other)". Defaults to 1000.
+	MaxFingerprints int
+	// Log logs slow queries and their plans with level Info. Can be nil.
+	Log log.Logger
+
+	mu      sync.Mutex
+	queries map[string]*QueryStat
+	// db runs the EXPLAIN queries and gets set by WithQueryStats.
+	db *sql.DB
+	// explaining limits the concurrently running EXPLAIN queries to one.
+	explaining chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewQueryStats creates a new statistics collector. A zero slowThreshold
+// disables the slow query log. Logger can be nil.
+func NewQueryStats(slowThreshold time.Duration, l log.Logger) *QueryStats {
+	return &QueryStats{
+		SlowThreshold:   slowThreshold,
+		ExplainTimeout:  5 * time.Second,
+		MaxFingerprints: 1000,
+		Log:             l,
+		queries:         make(map[string]*QueryStat),
+		explaining:      make(chan struct{}, 1),
+	}
+}
+
+// WithQueryStats collects the statistics of all queries running on the
+// connection pool. It wraps the driver of WithDSN or WithConnector and does not
+// support WithDB. It replaces the DB of the connection pool, hence it must be
+// applied before any other option uses the DB. EXPLAIN queries do not get
+// collected.
+func WithQueryStats(qs *QueryStats) ConnPoolOption {
+	return ConnPoolOption{
+		sortOrder: 2, // must run after WithDSN and WithConnector
+		fn: func(c *ConnPool) error {
+			if c.connector == nil {
+				return errors.NotSupported.Newf("[dml] WithQueryStats requires option WithDSN or WithConnector")
+			}
+			if c.DB != nil {
+				if err := c.DB.Close(); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			c.connector = statsConnector{parent: c.connector, qs: qs}
+			c.DB = sql.OpenDB(c.connector)
+			qs.mu.Lock()
+			qs.db = c.DB
+			qs.mu.Unlock()
+			return nil
+		},
+	}
+}
+
+// Reset removes all collected statistics.
+func (qs *QueryStats) Reset() {
+	qs.mu.Lock()
+	qs.queries = make(map[string]*QueryStat)
+	qs.mu.Unlock()
+}
+
+// Wait blocks until the running EXPLAIN query has been finished.
+func (qs *QueryStats) Wait() {
+	qs.wg.Wait()
+}
+
+// queryStatsSorters defines the allowed values for the sort argument of
+// function Top.
+var queryStatsSorters = map[string]func(a, b *QueryStat) bool{
+	"total":         func(a, b *QueryStat) bool { return a.Total > b.Total },
+	"calls":         func(a, b *QueryStat) bool { return a.Calls > b.Calls },
+	"max":           func(a, b *QueryStat) bool { return a.Max > b.Max },
+	"avg":           func(a, b *QueryStat) bool { return a.Avg > b.Avg },
+	"errors":        func(a, b *QueryStat) bool { return a.Errors > b.Errors },
+	"slow":          func(a, b *QueryStat) bool { return a.Slow > b.Slow },
+	"rows_returned": func(a, b *QueryStat) bool { return a.RowsReturned > b.RowsReturned },
+	"rows_affected": func(a, b *QueryStat) bool { return a.RowsAffected > b.RowsAffected },
+}
+
+// Top returns a copy of the n most expensive queries, sorted descending by one
+// of: total (default), calls, max, avg, errors, slow, rows_returned or
+// rows_affected. n <= 0 returns all queries.
+func (qs *QueryStats) Top(n int, sortBy string) ([]QueryStat, error) {
+	if sortBy == "" {
+		sortBy = "total"
+	}
+	less, ok := queryStatsSorters[sortBy]
+	if !ok {
+		return nil, errors.NotSupported.Newf("[dml] QueryStats.Top sort argument %q not supported", sortBy)
+	}
+
+	qs.mu.Lock()
+	all := make([]*QueryStat, 0, len(qs.queries))
+	for _, s := range qs.queries {
+		all = append(all, s)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if less(all[i], all[j]) {
+			return true
+		}
+		if less(all[j], all[i]) {
+			return false
+		}
+		return all[i].Fingerprint < all[j].Fingerprint
+	})
+	if n > 0 && n < len(all) {
+		all = all[:n]
+	}
+	ret := make([]QueryStat, len(all))
+	for i, s := range all {
+		ret[i] = *s
+		ret[i].Plan = append(json.RawMessage(nil), s.Plan...)
+	}
+	qs.mu.Unlock()
+	return ret, nil
+}
+
+// ServeHTTP writes the top-N queries as JSON. The query parameter `n` limits
+// the number of queries, defaults to 10, and `sort` defines the sort order,
+// see function Top.
+func (qs *QueryStats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n := 10
+	if v := r.URL.Query().Get("n"); v != "" {
+		var err error
+		if n, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "invalid parameter n: "+v, http.StatusBadRequest)
+			return
+		}
+	}
+	top, err := qs.Top(n, r.URL.Query().Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	buckets := make([]int64, len(QueryStatsBuckets))
+	for i, b := range QueryStatsBuckets {
+		buckets[i] = int64(b)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	if err := json.NewEncoder(w).Encode(struct {
+		Buckets []int64     `json:"buckets_ns"`
+		Queries []QueryStat `json:"queries"`
+	}{buckets, top}); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// stat returns the statistics for a fingerprint. The caller must hold the lock.
+func (qs *QueryStats) stat(fingerprint string) *QueryStat {
+	s, ok := qs.queries[fingerprint]
+	if ok {
+		return s
+	}
+	if max := qs.MaxFingerprints; max > 0 && len(qs.queries) >= max {
+		fingerprint = queryStatsOther
+		if s, ok = qs.queries[fingerprint]; ok {
+			return s
+		}
+	}
+	s = &QueryStat{Fingerprint: fingerprint}
+	qs.queries[fingerprint] = s
+	return s
+}
+
+// record adds the result of a query to the statistics and explains slow
+// queries.
+func (qs *QueryStats) record(fingerprint, query string, args []driver.NamedValue, took time.Duration, rowsAffected int64, err error) {
+	if err == driver.ErrSkip {
+		return // database/sql retries with a prepared statement
+	}
+	isSlow := qs.SlowThreshold > 0 && took >= qs.SlowThreshold
+
+	qs.mu.Lock()
+	s := qs.stat(fingerprint)
+	s.Calls++
+	s.Total += took
+	s.Avg = s.Total / time.Duration(s.Calls)
+	if took > s.Max {
+		s.Max = took
+	}
+	bucket := len(QueryStatsBuckets)
+	for i, b := range QueryStatsBuckets {
+		if took <= b {
+			bucket = i
+			break
+		}
+	}
+	s.Histogram[bucket]++
+	if err != nil {
+		s.Errors++
+	}
+	if rowsAffected > 0 {
+		s.RowsAffected += uint64(rowsAffected)
+	}
+	var explain bool
+	if isSlow {
+		s.Slow++
+		explain = err == nil && qs.db != nil && isExplainable(fingerprint) &&
+			(s.explainedAt.IsZero() || (qs.ExplainInterval > 0 && time.Since(s.explainedAt) >= qs.ExplainInterval))
+	}
+	qs.mu.Unlock()
+
+	if !isSlow {
+		return
+	}
+	if qs.Log != nil && qs.Log.IsInfo() {
+		qs.Log.Info("QueryStats.SlowQuery", log.String("sql", query), log.String("fingerprint", fingerprint), log.Duration("took", took), log.Err(err))
+	}
+	if explain {
+		qs.explain(s, query, args)
+	}
+}
+
+func (qs *QueryStats) addRows(fingerprint string, rows uint64) {
+	qs.mu.Lock()
+	qs.stat(fingerprint).RowsReturned += rows
+	qs.mu.Unlock()
+}
+
+// explain runs EXPLAIN FORMAT=JSON in the background. If another EXPLAIN is
+// still running the query gets explained the next time it is slow. The
+// WaitGroup gets only incremented after the slot has been taken, so a
+// rejected EXPLAIN never calls Add while Wait runs.
+func (qs *QueryStats) explain(s *QueryStat, query string, args []driver.NamedValue) {
+	select {
+	case qs.explaining <- struct{}{}:
+	default:
+		return
+	}
+	qs.wg.Add(1)
+	qs.mu.Lock()
+	s.explainedAt = time.Now()
+	db := qs.db
+	qs.mu.Unlock()
+
+	iArgs := make([]interface{}, len(args))
+	for i, a := range args {
+		iArgs[i] = a.Value
+		if a.Name != "" {
+			iArgs[i] = sql.Named(a.Name, a.Value)
+		}
+	}
+
+	go func() {
+		defer func() {
+			<-qs.explaining
+			qs.wg.Done()
+		}()
+		timeout := qs.ExplainTimeout
+		if timeout <= 0 {
+			timeout = 5 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		var plan []byte
+		err := db.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+query, iArgs...).Scan(&plan)
+		if err == nil && !json.Valid(plan) {
+			err = errors.NotValid.Newf("[dml] EXPLAIN returned invalid JSON: %q", plan)
+		}
+		if err == nil {
+			qs.mu.Lock()
+			s.Plan = plan
+			qs.mu.Unlock()
+		}
+		if qs.Log != nil && qs.Log.IsInfo() {
+			qs.Log.Info("QueryStats.Explain", log.String("sql", query), log.String("fingerprint", s.Fingerprint), log.String("plan", string(plan)), log.Err(err))
+		}
+	}()
+}
+
+func isExplainable(fingerprint string) bool {
+	for _, kw := range [...]string{"SELECT ", "INSERT ", "REPLACE ", "UPDATE ", "DELETE "} {
+		if len(fingerprint) > len(kw) && strings.EqualFold(fingerprint[:len(kw)], kw) {
+			return true
+		}
+	}
+	return false
+}
+
+func isExplain(query string) bool {
+	query = strings.TrimLeft(query, " \t\r\n")
+	return len(query) > 8 && strings.EqualFold(query[:8], "EXPLAIN ")
+}
+
+// QueryFingerprint normalizes a query to group the same queries with different
+// arguments. Comments get removed, literals get replaced by a question mark,
+// lists of placeholders and multiple rows in VALUES get collapsed and white
+// space gets reduced to one space.
+//		SELECT /*ID$1*/ * FROM `a` WHERE id IN (1,2, 3) AND b = 'x'
+//		SELECT * FROM `a` WHERE id IN (?+) AND b = ?
+func QueryFingerprint(query string) string {
+	var buf strings.Builder
+	buf.Grow(len(query))
+	space := false
+	writeSpace := func() {
+		if space && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		space = false
+	}
+	isIdent := func(c byte) bool {
+		return c == '_' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+	}
+
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end + 3
+			}
+			space = true
+		case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "-- ")):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				i = len(query)
+			} else {
+				i += end
+			}
+			space = true
+		case c == '\'' || c == '"':
+			for i++; i < len(query); i++ {
+				if query[i] == '\\' {
+					i++
+				} else if query[i] == c {
+					if i+1 >= len(query) || query[i+1] != c {
+						break
+					}
+					i++ // doubled quote
+				}
+			}
+			writeSpace()
+			buf.WriteByte('?')
+		case c == '`':
+			end := len(query)
+			if j := strings.IndexByte(query[i+1:], '`'); j >= 0 {
+				end = i + j + 2
+			}
+			writeSpace()
+			buf.WriteString(query[i:end])
+			i = end - 1
+		case c >= '0' && c <= '9' && (i == 0 || !isIdent(query[i-1])):
+			for i+1 < len(query) && (isIdent(query[i+1]) || query[i+1] == '.' ||
+				((query[i+1] == '-' || query[i+1] == '+') && (query[i] == 'e' || query[i] == 'E'))) {
+				i++
+			}
+			writeSpace()
+			buf.WriteByte('?')
+		default:
+			writeSpace()
+			buf.WriteByte(c)
+		}
+	}
+	return collapsePlaceholders(buf.String())
+}
+
+// collapsePlaceholders replaces lists of placeholders like (?,?,?) with (?+)
+// and repeated lists like (?+),(?+) with (?+).
+func collapsePlaceholders(fp string) string {
+	if !strings.Contains(fp, "(?") {
+		return fp
+	}
+	var buf strings.Builder
+	buf.Grow(len(fp))
+	for i := 0; i < len(fp); i++ {
+		if fp[i] != '(' {
+			buf.WriteByte(fp[i])
+			continue
+		}
+		end := placeholderListEnd(fp, i)
+		if end < 0 {
+			buf.WriteByte(fp[i])
+			continue
+		}
+		buf.WriteString("(?+)")
+		i = end
+		// skip further lists, e.g. in INSERT VALUES (?,?),(?,?)
+		for {
+			j := i + 1
+			for j < len(fp) && (fp[j] == ',' || fp[j] == ' ') {
+				j++
+			}
+			if j == i+1 || j >= len(fp) || fp[j] != '(' {
+				break
+			}
+			e := placeholderListEnd(fp, j)
+			if e < 0 {
+				break
+			}
+			i = e
+		}
+	}
+	return buf.String()
+}
+
+// placeholderListEnd returns the index of the closing bracket if the bracket at
+// position start contains only placeholders, otherwise -1.
+func placeholderListEnd(fp string, start int) int {
+	hasPlaceholder := false
+	for i := start + 1; i < len(fp); i++ {
+		switch fp[i] {
+		case '?':
+			hasPlaceholder = true
+		case ',', ' ':
+		case ')':
+			if hasPlaceholder {
+				return i
+			}
+			return -1
+		default:
+			return -1
+		}
+	}
+	return -1
+}
+
+// statsConnector wraps a driver.Connector to collect the query statistics.
+type statsConnector struct {
+	parent driver.Connector
+	qs     *QueryStats
+}
+
+func (sc statsConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := sc.parent.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	fc, ok := conn.(fullConner)
+	if !ok {
+		_ = conn.Close()
+		return nil, errors.NotSupported.Newf("[dml] Driver does not support all required interfaces (fullConner)")
+	}
+	return statsConn{fullConner: fc, qs: sc.qs}, nil
+}
+
+func (sc statsConnector) Driver() driver.Driver { return sc.parent.Driver() }
+
+type statsConn struct {
+	fullConner
+	qs *QueryStats
+}
+
+func (c statsConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nvc, ok := c.fullConner.(driver.NamedValueChecker); ok {
+		return nvc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c statsConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	stmt, err := c.fullConner.PrepareContext(ctx, query)
+	if err != nil || isExplain(query) {
+		return stmt, err
+	}
+	return c.wrapStmt(stmt, query)
+}
+
+func (c statsConn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c statsConn) wrapStmt(stmt driver.Stmt, query string) (driver.Stmt, error) {
+	fStmt, ok := stmt.(fullStmter)
+	if !ok {
+		_ = stmt.Close()
+		return nil, errors.NotSupported.Newf("[dml] Driver does not support all required interfaces (fullStmter)")
+	}
+	return &statsStmt{fullStmter: fStmt, qs: c.qs, query: query, fingerprint: QueryFingerprint(query)}, nil
+}
+
+func (c statsConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if isExplain(query) {
+		return c.fullConner.ExecContext(ctx, query, args)
+	}
+	now := time.Now()
+	res, err := c.fullConner.ExecContext(ctx, query, args)
+	c.qs.record(QueryFingerprint(query), query, args, time.Since(now), rowsAffected(res, err), err)
+	return res, err
+}
+
+func (c statsConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if isExplain(query) {
+		return c.fullConner.QueryContext(ctx, query, args)
+	}
+	now := time.Now()
+	rows, err := c.fullConner.QueryContext(ctx, query, args)
+	fp := QueryFingerprint(query)
+	c.qs.record(fp, query, args, time.Since(now), 0, err)
+	return wrapStatsRows(rows, err, c.qs, fp), err
+}
+
+type statsStmt struct {
+	fullStmter
+	qs          *QueryStats
+	query       string
+	fingerprint string
+}
+
+func (s *statsStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	now := time.Now()
+	res, err := s.fullStmter.ExecContext(ctx, args)
+	s.qs.record(s.fingerprint, s.query, args, time.Since(now), rowsAffected(res, err), err)
+	return res, err
+}
+
+func (s *statsStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	now := time.Now()
+	rows, err := s.fullStmter.QueryContext(ctx, args)
+	s.qs.record(s.fingerprint, s.query, args, time.Since(now), 0, err)
+	return wrapStatsRows(rows, err, s.qs, s.fingerprint), err
+}
+
+func (s *statsStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), driverValueToNamed(args))
+}
+
+func (s *statsStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), driverValueToNamed(args))
+}
+
+func rowsAffected(res driver.Result, err error) int64 {
+	if err != nil || res == nil {
+		return 0
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return 0
+	}
+	return ra
+}
+
+func wrapStatsRows(rows driver.Rows, err error, qs *QueryStats, fingerprint string) driver.Rows {
+	if err != nil || rows == nil {
+		return rows
+	}
+	return &statsRows{Rows: rows, qs: qs, fingerprint: fingerprint}
+}
+
+// statsRows counts the returned rows. It forwards the optional column type
+// interfaces because database/sql checks them with a type assertion.
+type statsRows struct {
+	driver.Rows
+	qs          *QueryStats
+	fingerprint string
+	count       uint64
+	closed      bool
+}
+
+func (r *statsRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	if err == nil {
+		r.count++
+	}
+	return err
+}
+
+func (r *statsRows) Close() error {
+	if !r.closed {
+		r.closed = true
+		r.qs.addRows(r.fingerprint, r.count)
+	}
+	return r.Rows.Close()
+}
+
+func (r *statsRows) HasNextResultSet() bool {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.HasNextResultSet()
+	}
+	return false
+}
+
+func (r *statsRows) NextResultSet() error {
+	if rs, ok := r.Rows.(driver.RowsNextResultSet); ok {
+		return rs.NextResultSet()
+	}
+	return io.EOF
+}
+
+func (r *statsRows) ColumnTypeScanType(index int) reflect.Type {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeScanType); ok {
+		return ct.ColumnTypeScanType(index)
+	}
+	return reflect.TypeOf(new(interface{})).Elem()
+}
+
+func (r *statsRows) ColumnTypeDatabaseTypeName(index int) string {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+		return ct.ColumnTypeDatabaseTypeName(index)
+	}
+	return ""
+}
+
+func (r *statsRows) ColumnTypeLength(index int) (length int64, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeLength); ok {
+		return ct.ColumnTypeLength(index)
+	}
+	return 0, false
+}
+
+func (r *statsRows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypeNullable); ok {
+		return ct.ColumnTypeNullable(index)
+	}
+	return false, false
+}
+
+func (r *statsRows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	if ct, ok := r.Rows.(driver.RowsColumnTypePrecisionScale); ok {
+		return ct.ColumnTypePrecisionScale(index)
+	}
+	return 0, 0, false
+}
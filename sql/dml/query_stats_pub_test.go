@@ -0,0 +1,182 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/dmltest/memdb"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestQueryFingerprint(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"SELECT /*ID$1*/ * FROM `a` WHERE id IN (1,2, 3) AND b = 'x'", "SELECT * FROM `a` WHERE id IN (?+) AND b = ?"},
+		{"SELECT * FROM `a`  WHERE\n\tid = ? -- comment\n", "SELECT * FROM `a` WHERE id = ?"},
+		{"SELECT `col1`, t2.col2 FROM `t1` WHERE x = -1.5e-3 # c", "SELECT `col1`, t2.col2 FROM `t1` WHERE x = -?"},
+		{`UPDATE a SET s = "it\"s", d = 'it''s' WHERE id = 0x1F`, "UPDATE a SET s = ?, d = ? WHERE id = ?"},
+		{"INSERT INTO `a` (`b`,`c`) VALUES (?,?),(?,?), (1,'2')", "INSERT INTO `a` (`b`,`c`) VALUES (?+)"},
+		{"SELECT COUNT(*) FROM a WHERE b IN (?) AND c NOT IN (SELECT d FROM e)", "SELECT COUNT(*) FROM a WHERE b IN (?+) AND c NOT IN (SELECT d FROM e)"},
+	}
+	for _, test := range tests {
+		assert.Exactly(t, test.want, dml.QueryFingerprint(test.query), "%q", test.query)
+	}
+}
+
+func newQueryStatsDB(t *testing.T, qs *dml.QueryStats) *dml.ConnPool {
+	tbls, err := ddl.NewTables(ddl.WithTable("customer",
+		&ddl.Column{Field: "id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+		&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(64)", Key: "UNI"},
+	))
+	dmltest.FatalIfError(t, err)
+	dbc, _ := memdb.MockDB(t, tbls, dml.WithQueryStats(qs))
+	return dbc
+}
+
+func TestWithQueryStats(t *testing.T) {
+	t.Parallel()
+
+	t.Run("requires connector", func(t *testing.T) {
+		_, err := dml.NewConnPool(dml.WithQueryStats(dml.NewQueryStats(0, nil)))
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+	})
+
+	t.Run("collects", func(t *testing.T) {
+		qs := dml.NewQueryStats(0, nil)
+		dbc := newQueryStatsDB(t, qs)
+		defer dmltest.Close(t, dbc)
+		ctx := context.Background()
+
+		for _, email := range []string{"a@b.c", "d@e.f", "g@h.i"} {
+			_, err := dbc.DB.ExecContext(ctx, "INSERT INTO `customer` (`email`) VALUES (?)", email)
+			assert.NoError(t, err)
+		}
+		_, err := dbc.DB.ExecContext(ctx, "INSERT INTO `customer` (`email`) VALUES ('a@b.c')")
+		assert.Error(t, err) // duplicate entry
+
+		res, err := dbc.DB.ExecContext(ctx, "UPDATE `customer` SET `email` = CONCAT(`email`, 'x') WHERE `id` > 1")
+		assert.NoError(t, err)
+		ra, _ := res.RowsAffected()
+		assert.Exactly(t, int64(2), ra)
+
+		for i := 0; i < 2; i++ {
+			rows, err := dbc.DB.QueryContext(ctx, "SELECT * FROM `customer` WHERE `id` > ?", i)
+			assert.NoError(t, err)
+			for rows.Next() {
+			}
+			assert.NoError(t, rows.Close())
+		}
+
+		top, err := qs.Top(0, "calls")
+		assert.NoError(t, err)
+		assert.Len(t, top, 3)
+
+		assert.Exactly(t, "INSERT INTO `customer` (`email`) VALUES (?+)", top[0].Fingerprint)
+		assert.Exactly(t, uint64(4), top[0].Calls)
+		assert.Exactly(t, uint64(1), top[0].Errors)
+		assert.Exactly(t, uint64(3), top[0].RowsAffected)
+
+		assert.Exactly(t, "SELECT * FROM `customer` WHERE `id` > ?", top[1].Fingerprint)
+		assert.Exactly(t, uint64(2), top[1].Calls)
+		assert.Exactly(t, uint64(5), top[1].RowsReturned)
+		var hist uint64
+		for _, h := range top[1].Histogram {
+			hist += h
+		}
+		assert.Exactly(t, uint64(2), hist)
+		assert.True(t, top[1].Max >= top[1].Avg && top[1].Total >= top[1].Max, "%#v", top[1])
+
+		assert.Exactly(t, uint64(2), top[2].RowsAffected)
+		assert.Exactly(t, uint64(0), top[2].Slow)
+
+		_, err = qs.Top(1, "unknown")
+		assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+
+		qs.Reset()
+		top, err = qs.Top(0, "")
+		assert.NoError(t, err)
+		assert.Len(t, top, 0)
+	})
+
+	t.Run("slow query explain", func(t *testing.T) {
+		qs := dml.NewQueryStats(time.Nanosecond, nil)
+		dbc := newQueryStatsDB(t, qs)
+		defer dmltest.Close(t, dbc)
+
+		_, err := dbc.DB.Exec("INSERT INTO `customer` (`email`) VALUES (?)", "a@b.c")
+		assert.NoError(t, err)
+		qs.Wait()
+
+		var email string
+		assert.NoError(t, dbc.DB.QueryRow("SELECT `email` FROM `customer` WHERE `id` = ?", 1).Scan(&email))
+		qs.Wait()
+
+		top, err := qs.Top(0, "slow")
+		assert.NoError(t, err)
+		assert.Len(t, top, 2)
+		for _, s := range top {
+			assert.Exactly(t, uint64(1), s.Slow, "%s", s.Fingerprint)
+			assert.True(t, json.Valid(s.Plan), "%s: %q", s.Fingerprint, s.Plan)
+			assert.Contains(t, string(s.Plan), `"table_name":"customer"`)
+		}
+	})
+
+	t.Run("ServeHTTP", func(t *testing.T) {
+		qs := dml.NewQueryStats(0, nil)
+		dbc := newQueryStatsDB(t, qs)
+		defer dmltest.Close(t, dbc)
+
+		for i := 0; i < 3; i++ {
+			_, err := dbc.DB.Exec("INSERT INTO `customer` (`email`) VALUES (?)", string(rune('a'+i)))
+			assert.NoError(t, err)
+		}
+		_, err := dbc.DB.Exec("DELETE FROM `customer` WHERE `id` = 1")
+		assert.NoError(t, err)
+
+		rec := httptest.NewRecorder()
+		qs.ServeHTTP(rec, httptest.NewRequest("GET", "/?n=1&sort=calls", nil))
+		assert.Exactly(t, http.StatusOK, rec.Code)
+		assert.Exactly(t, "application/json; charset=utf-8", rec.Header().Get("Content-Type"))
+
+		var have struct {
+			Buckets []int64         `json:"buckets_ns"`
+			Queries []dml.QueryStat `json:"queries"`
+		}
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &have))
+		assert.Len(t, have.Buckets, len(dml.QueryStatsBuckets))
+		assert.Len(t, have.Queries, 1)
+		assert.Exactly(t, uint64(3), have.Queries[0].Calls)
+
+		rec = httptest.NewRecorder()
+		qs.ServeHTTP(rec, httptest.NewRequest("GET", "/?n=x", nil))
+		assert.Exactly(t, http.StatusBadRequest, rec.Code)
+
+		rec = httptest.NewRecorder()
+		qs.ServeHTTP(rec, httptest.NewRequest("GET", "/?sort=x", nil))
+		assert.Exactly(t, http.StatusBadRequest, rec.Code)
+	})
+}
@@ -253,21 +253,7 @@ func (b *ColumnMap) Scan(r *sql.Rows) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-
-		b.setColumns(cols)
-		if cap(b.scanCol) >= b.columnsLen { // reuse from pool!
-			b.scanCol = b.scanCol[:b.columnsLen]
-			b.scanArgs = b.scanArgs[:b.columnsLen]
-		} else {
-			b.scanCol = make([]scannedColumn, b.columnsLen)
-			b.scanArgs = make([]interface{}, b.columnsLen)
-			for i := 0; i < b.columnsLen; i++ {
-				b.scanArgs[i] = &b.scanCol[i]
-			}
-		}
-		b.initialized = true
-		b.Count = 0
-		b.HasRows = true
+		b.initScan(cols)
 	} else {
 		b.Count++
 	}
@@ -277,6 +263,45 @@ func (b *ColumnMap) Scan(r *sql.Rows) error {
 	return nil
 }
 
+// ScanValues builds the internal stack from already decoded values of a row,
+// for example from a row of a binary log event, for further processing and
+// type conversion. The column names get only applied during the first call,
+// each further call increments the field Count. The values must be one of the
+// types supported by the database/sql/driver package.
+func (b *ColumnMap) ScanValues(columns []string, values []interface{}) error {
+	if !b.initialized {
+		b.initScan(columns)
+	} else {
+		b.Count++
+	}
+	if len(values) != b.columnsLen {
+		return errors.Mismatch.Newf("[dml] ColumnMap.ScanValues: Number of values %d does not match the number of columns %d", len(values), b.columnsLen)
+	}
+	for i, v := range values {
+		if err := b.scanCol[i].Scan(v); err != nil {
+			return errors.Wrapf(err, "[dml] ColumnMap.ScanValues: Column %q", b.columns[i])
+		}
+	}
+	return nil
+}
+
+func (b *ColumnMap) initScan(cols []string) {
+	b.setColumns(cols)
+	if cap(b.scanCol) >= b.columnsLen { // reuse from pool!
+		b.scanCol = b.scanCol[:b.columnsLen]
+		b.scanArgs = b.scanArgs[:b.columnsLen]
+	} else {
+		b.scanCol = make([]scannedColumn, b.columnsLen)
+		b.scanArgs = make([]interface{}, b.columnsLen)
+		for i := 0; i < b.columnsLen; i++ {
+			b.scanArgs[i] = &b.scanCol[i]
+		}
+	}
+	b.initialized = true
+	b.Count = 0
+	b.HasRows = true
+}
+
 // Err returns the delayed error from one of the scans and parsings. Function is
 // idempotent.
 func (b *ColumnMap) Err() error {
@@ -993,3 +1018,39 @@ func (b *ColumnMap) Strings(values ...string) *ColumnMap {
 func (b *ColumnMap) NullStrings(values ...null.String) *ColumnMap {
 	return b.addSlice("NullStrings", values)
 }
+
+func (b *ColumnMap) Int64s(values ...int64) *ColumnMap {
+	return b.addSlice("Int64s", values)
+}
+
+func (b *ColumnMap) NullInt64s(values ...null.Int64) *ColumnMap {
+	return b.addSlice("NullInt64s", values)
+}
+
+func (b *ColumnMap) Float64s(values ...float64) *ColumnMap {
+	return b.addSlice("Float64s", values)
+}
+
+func (b *ColumnMap) NullFloat64s(values ...null.Float64) *ColumnMap {
+	return b.addSlice("NullFloat64s", values)
+}
+
+func (b *ColumnMap) Bools(values ...bool) *ColumnMap {
+	return b.addSlice("Bools", values)
+}
+
+func (b *ColumnMap) NullBools(values ...null.Bool) *ColumnMap {
+	return b.addSlice("NullBools", values)
+}
+
+func (b *ColumnMap) Times(values ...time.Time) *ColumnMap {
+	return b.addSlice("Times", values)
+}
+
+func (b *ColumnMap) NullTimes(values ...null.Time) *ColumnMap {
+	return b.addSlice("NullTimes", values)
+}
+
+func (b *ColumnMap) BytesSlice(values ...[]byte) *ColumnMap {
+	return b.addSlice("BytesSlice", values)
+}
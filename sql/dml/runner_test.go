@@ -118,6 +118,56 @@ func TestScannedColumn_Scan(t *testing.T) {
 
 }
 
+func TestColumnMap_ScanValues(t *testing.T) {
+	t.Parallel()
+
+	cm := NewColumnMap(0)
+	assert.NoError(t, cm.ScanValues([]string{"id", "name", "price"}, []interface{}{int64(3), []byte(`Gopher`), nil}))
+	assert.Exactly(t, ColumnMapScan, cm.Mode())
+	assert.Exactly(t, uint64(0), cm.Count)
+
+	var id uint64
+	var name string
+	var price null.Float64
+	for cm.Next() {
+		switch cm.Column() {
+		case "id":
+			cm.Uint64(&id)
+		case "name":
+			cm.String(&name)
+		case "price":
+			cm.NullFloat64(&price)
+		}
+	}
+	assert.NoError(t, cm.Err())
+	assert.Exactly(t, uint64(3), id)
+	assert.Exactly(t, "Gopher", name)
+	assert.False(t, price.Valid)
+
+	assert.NoError(t, cm.ScanValues(nil, []interface{}{int64(4), `Rust`, 2.5}))
+	assert.Exactly(t, uint64(1), cm.Count)
+	for cm.Next() {
+		switch cm.Column() {
+		case "id":
+			cm.Uint64(&id)
+		case "name":
+			cm.String(&name)
+		case "price":
+			cm.NullFloat64(&price)
+		}
+	}
+	assert.NoError(t, cm.Err())
+	assert.Exactly(t, uint64(4), id)
+	assert.Exactly(t, "Rust", name)
+	assert.Exactly(t, null.MakeFloat64(2.5), price)
+
+	err := cm.ScanValues(nil, []interface{}{int64(5)})
+	assert.True(t, errors.Is(err, errors.Mismatch), "Should be error kind Mismatch\n%+v", err)
+
+	err = cm.ScanValues(nil, []interface{}{uint8(5), nil, nil})
+	assert.True(t, errors.Is(err, errors.NotSupported), "Should be error kind NotSupported\n%+v", err)
+}
+
 func TestColumnMap_Scan_Empty_Bytes(t *testing.T) {
 	t.Parallel()
 
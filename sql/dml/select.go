@@ -41,6 +41,7 @@ type Select struct {
 
 	GroupBys             ids
 	Havings              Conditions
+	Windows              Windows // See Window()
 	IsStar               bool // IsStar generates a SELECT * FROM query
 	IsCountStar          bool // IsCountStar retains the column names but executes a COUNT(*) query.
 	IsDistinct           bool // See Distinct()
@@ -94,9 +95,11 @@ func newSelect(db QueryExecPreparer, cCom *connCommon, from []string) *Select {
 	s := &Select{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  db,
+				id:      id,
+				Log:     l,
+				DB:      db,
+				dialect: cCom.dialect,
+				tracer:  cCom.tracer,
 			},
 			Table: MakeIdentifier(from[0]),
 		},
@@ -289,6 +292,17 @@ func (b *Select) Having(wf ...*Condition) *Select {
 	return b
 }
 
+// Window appends a named window to the WINDOW clause. The name can be
+// referenced in the OVER clause of a window function with NamedWindow or
+// another named window can inherit from it. The window `w` gets modified.
+//		Window("w", NewWindow().PartitionBy("customer_id").OrderBy("created_at"))
+//		// WINDOW `w` AS (PARTITION BY `customer_id` ORDER BY `created_at`)
+func (b *Select) Window(name string, w *Window) *Select {
+	w.Name = name
+	b.Windows = append(b.Windows, w)
+	return b
+}
+
 // OrderByDeactivated deactivates ordering of the result set by applying ORDER
 // BY NULL to the SELECT statement. Very useful for GROUP BY queries.
 func (b *Select) OrderByDeactivated() *Select {
@@ -408,6 +422,7 @@ func (b *Select) writeBuildCache(sql []byte, qualifiedColumns []string) {
 		b.Columns = nil
 		b.GroupBys = nil
 		b.Havings = nil
+		b.Windows = nil
 	}
 }
 
@@ -518,6 +533,10 @@ func (b *Select) toSQL(w *bytes.Buffer, placeHolders []string) (_ []string, err
 		return nil, errors.WithStack(err)
 	}
 
+	if placeHolders, err = b.Windows.write(w, placeHolders); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	switch {
 	case b.IsOrderByDeactivated:
 		w.WriteString(" ORDER BY NULL")
@@ -560,5 +579,6 @@ func (b *Select) Clone() *Select {
 	c.Columns = b.Columns.Clone()
 	c.GroupBys = b.GroupBys.Clone()
 	c.Havings = b.Havings.Clone()
+	c.Windows = b.Windows.Clone()
 	return &c
 }
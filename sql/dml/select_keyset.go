@@ -0,0 +1,305 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/util/bufferpool"
+)
+
+// KeysetColumn defines a column and its sort direction for keyset (seek)
+// pagination. The combination of all key columns must be unique, e.g. by
+// adding the primary key as last column, otherwise rows get skipped.
+type KeysetColumn struct {
+	Name       string
+	Descending bool
+}
+
+// KeysetAsc creates ascending keyset columns.
+func KeysetAsc(columns ...string) []KeysetColumn {
+	kcs := make([]KeysetColumn, len(columns))
+	for i, c := range columns {
+		kcs[i] = KeysetColumn{Name: c}
+	}
+	return kcs
+}
+
+// KeysetDesc creates descending keyset columns.
+func KeysetDesc(columns ...string) []KeysetColumn {
+	kcs := make([]KeysetColumn, len(columns))
+	for i, c := range columns {
+		kcs[i] = KeysetColumn{Name: c, Descending: true}
+	}
+	return kcs
+}
+
+func keysetIsMixed(keys []KeysetColumn) bool {
+	for _, k := range keys[1:] {
+		if k.Descending != keys[0].Descending {
+			return true
+		}
+	}
+	return false
+}
+
+func keysetOperator(k KeysetColumn) string {
+	if k.Descending {
+		return " < "
+	}
+	return " > "
+}
+
+// KeysetCondition creates the predicate which selects all rows after the last
+// seen row. Columns with the same sort direction get compared with a row
+// constructor, mixed directions get expanded into OR conditions, because
+// MySQL cannot compare row constructors with different directions. The
+// placeholders must be filled with the values returned by KeysetArgs.
+//		(`a`,`b`) > (?,?)
+//		((`a` > ?) OR (`a` = ? AND `b` < ?))
+func KeysetCondition(keys ...KeysetColumn) *Condition {
+	buf := bufferpool.Get()
+	defer bufferpool.Put(buf)
+
+	switch {
+	case len(keys) == 1:
+		Quoter.WriteIdentifier(buf, keys[0].Name)
+		buf.WriteString(keysetOperator(keys[0]))
+		buf.WriteByte(placeHolderRune)
+
+	case !keysetIsMixed(keys):
+		buf.WriteByte('(')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			Quoter.WriteIdentifier(buf, k.Name)
+		}
+		buf.WriteByte(')')
+		buf.WriteString(keysetOperator(keys[0]))
+		buf.WriteByte('(')
+		for i := range keys {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.WriteByte(placeHolderRune)
+		}
+		buf.WriteByte(')')
+
+	default:
+		buf.WriteByte('(')
+		for i, k := range keys {
+			if i > 0 {
+				buf.WriteString(" OR ")
+			}
+			buf.WriteByte('(')
+			for _, eq := range keys[:i] {
+				Quoter.WriteIdentifier(buf, eq.Name)
+				buf.WriteString(" = ? AND ")
+			}
+			Quoter.WriteIdentifier(buf, k.Name)
+			buf.WriteString(keysetOperator(k))
+			buf.WriteByte(placeHolderRune)
+			buf.WriteByte(')')
+		}
+		buf.WriteByte(')')
+	}
+	return Expr(buf.String())
+}
+
+// KeysetArgs returns the arguments for the placeholders of KeysetCondition.
+// Argument `last` contains the values of the key columns of the last seen row
+// in the same order as `keys`.
+func KeysetArgs(keys []KeysetColumn, last ...interface{}) []interface{} {
+	if len(keys) < 2 || !keysetIsMixed(keys) {
+		return last
+	}
+	args := make([]interface{}, 0, len(keys)*(len(keys)+1)/2)
+	for i := range keys {
+		args = append(args, last[:i+1]...)
+	}
+	return args
+}
+
+// PaginateKeyset sets the ORDER BY clause to the key columns and the LIMIT.
+// Use it for the first page of a keyset pagination. Any existing ORDER BY
+// clause gets overwritten. Keyset pagination stays fast on large tables
+// contrary to Paginate whose OFFSET must skip all previous rows.
+func (b *Select) PaginateKeyset(limit uint64, keys ...KeysetColumn) *Select {
+	b.OrderBys = nil
+	for _, k := range keys {
+		if k.Descending {
+			b.OrderByDesc(k.Name)
+		} else {
+			b.OrderBy(k.Name)
+		}
+	}
+	return b.Limit(0, limit)
+}
+
+// PaginateKeysetAfter works like PaginateKeyset and adds the predicate of
+// KeysetCondition to the WHERE clause. Use it for all pages after the first
+// page and provide the values of the last seen row with KeysetArgs when
+// executing the query.
+//		sel := dml.NewSelect("entity_id", "created_at").From("sales_order").
+//			PaginateKeysetAfter(100, dml.KeysetDesc("created_at", "entity_id")...)
+//		keys := dml.KeysetDesc("created_at", "entity_id")
+//		err := sel.WithArgs().Load(ctx, orders, dml.KeysetArgs(keys, lastCreatedAt, lastEntityID)...)
+func (b *Select) PaginateKeysetAfter(limit uint64, keys ...KeysetColumn) *Select {
+	if len(keys) == 0 {
+		return b.PaginateKeyset(limit)
+	}
+	b.Where(KeysetCondition(keys...))
+	return b.PaginateKeyset(limit, keys...)
+}
+
+// KeysetIterator walks a whole table in stable chunks ordered by the key
+// columns. Each chunk gets loaded with its own query which seeks after the
+// last processed row, hence the iteration does not slow down with an
+// increasing offset and can be resumed by setting the Cursor.
+type KeysetIterator struct {
+	// Cursor contains the values of the key columns of the last successfully
+	// processed row. Persist the Cursor to resume an interrupted iteration
+	// later by assigning it to a new iterator. An empty Cursor starts at the
+	// beginning.
+	Cursor []interface{}
+	// Chunks counts the executed queries.
+	Chunks uint64
+
+	keys  []KeysetColumn
+	limit uint64
+	first *Artisan
+	next  *Artisan
+}
+
+// KeysetIterator creates a new iterator for the Select. The Select must
+// contain the key columns, it gets cloned and must not contain an ORDER BY or
+// LIMIT clause. Argument `chunkSize` defines the LIMIT of each query.
+func (b *Select) KeysetIterator(chunkSize uint64, keys ...KeysetColumn) *KeysetIterator {
+	it := &KeysetIterator{
+		keys:  keys,
+		limit: chunkSize,
+		first: b.Clone().PaginateKeyset(chunkSize, keys...).WithArgs(),
+		next:  b.Clone().PaginateKeysetAfter(chunkSize, keys...).WithArgs(),
+	}
+	if len(keys) == 0 {
+		it.first.base.ärgErr = errors.Empty.Newf("[dml] KeysetIterator requires at least one key column")
+	}
+	if chunkSize == 0 {
+		it.first.base.ärgErr = errors.OutOfRange.Newf("[dml] KeysetIterator chunkSize must be greater zero")
+	}
+	return it
+}
+
+// Iterate calls the callBack for each row of the table, chunk by chunk, using
+// Artisan.IterateSerial. The Cursor gets updated after each successfully
+// processed row. The iteration stops at the first error or when the context
+// has been canceled; the Cursor then points to the last processed row.
+func (it *KeysetIterator) Iterate(ctx context.Context, callBack func(*ColumnMap) error, args ...interface{}) error {
+	if it.first.base.ärgErr != nil {
+		return errors.WithStack(it.first.base.ärgErr)
+	}
+	var keyIdx []int
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+
+		a := it.first
+		qArgs := args
+		if len(it.Cursor) > 0 {
+			if len(it.Cursor) != len(it.keys) {
+				return errors.Mismatch.Newf("[dml] KeysetIterator.Cursor has %d values but %d key columns are defined", len(it.Cursor), len(it.keys))
+			}
+			a = it.next
+			qArgs = append(append(make([]interface{}, 0, len(args)+len(it.keys)), args...), KeysetArgs(it.keys, it.Cursor...)...)
+		}
+
+		var rows uint64
+		err := a.IterateSerial(ctx, func(cm *ColumnMap) error {
+			if keyIdx == nil {
+				var err error
+				if keyIdx, err = keysetColumnIndexes(cm.columns, it.keys); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			if err := callBack(cm); err != nil {
+				return errors.WithStack(err)
+			}
+			cursor := make([]interface{}, len(keyIdx))
+			for i, idx := range keyIdx {
+				cursor[i] = cm.scanCol[idx].value()
+			}
+			it.Cursor = cursor
+			rows++
+			return nil
+		}, qArgs...)
+		it.Chunks++
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if a.base.Log != nil && a.base.Log.IsDebug() {
+			a.base.Log.Debug("KeysetIterator.Iterate", log.Uint64("chunk", it.Chunks), log.Uint64("rows", rows))
+		}
+		if rows < it.limit {
+			return nil
+		}
+	}
+}
+
+// keysetColumnIndexes finds the position of the key columns in the result
+// set. Qualified key columns match the unqualified result columns.
+func keysetColumnIndexes(columns []string, keys []KeysetColumn) ([]int, error) {
+	idx := make([]int, len(keys))
+	for i, k := range keys {
+		name := k.Name
+		if pos := strings.LastIndexByte(name, '.'); pos >= 0 {
+			name = name[pos+1:]
+		}
+		idx[i] = -1
+		for j, c := range columns {
+			if c == name {
+				idx[i] = j
+			}
+		}
+		if idx[i] < 0 {
+			return nil, errors.NotFound.Newf("[dml] KeysetIterator key column %q not found in the result set %v", k.Name, columns)
+		}
+	}
+	return idx, nil
+}
+
+// value returns the scanned value as a type supported by the driver. The
+// underlying byte slice gets copied because it gets reused by the next scan.
+func (s scannedColumn) value() interface{} {
+	switch s.field {
+	case 'i':
+		return s.int64
+	case 'f':
+		return s.float64
+	case 'b':
+		return s.bool
+	case 'y':
+		return string(s.byte)
+	case 's':
+		return s.string
+	case 't':
+		return s.time
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestSelect_PaginateKeyset(t *testing.T) {
+	t.Parallel()
+
+	t.Run("first page", func(t *testing.T) {
+		compareToSQL(t,
+			dml.NewSelect("a", "b").From("c").OrderBy("x").PaginateKeyset(10, dml.KeysetAsc("a", "b")...),
+			errors.NoKind,
+			"SELECT `a`, `b` FROM `c` ORDER BY `a`, `b` LIMIT 0,10",
+			"",
+		)
+	})
+	t.Run("single column", func(t *testing.T) {
+		compareToSQL(t,
+			dml.NewSelect("a").From("c").PaginateKeysetAfter(10, dml.KeysetDesc("a")...),
+			errors.NoKind,
+			"SELECT `a` FROM `c` WHERE (`a` < ?) ORDER BY `a` DESC LIMIT 0,10",
+			"",
+		)
+	})
+	t.Run("row constructor", func(t *testing.T) {
+		compareToSQL(t,
+			dml.NewSelect("a", "b").From("c").Where(dml.Column("d").Int(1)).
+				PaginateKeysetAfter(10, dml.KeysetAsc("c.a", "b")...),
+			errors.NoKind,
+			"SELECT `a`, `b` FROM `c` WHERE (`d` = 1) AND ((`c`.`a`,`b`) > (?,?)) ORDER BY `c`.`a`, `b` LIMIT 0,10",
+			"",
+		)
+	})
+	t.Run("mixed directions", func(t *testing.T) {
+		keys := []dml.KeysetColumn{{Name: "a"}, {Name: "b", Descending: true}, {Name: "c"}}
+		compareToSQL(t,
+			dml.NewSelect("a", "b", "c").From("t").PaginateKeysetAfter(5, keys...),
+			errors.NoKind,
+			"SELECT `a`, `b`, `c` FROM `t` WHERE (((`a` > ?) OR (`a` = ? AND `b` < ?) OR (`a` = ? AND `b` = ? AND `c` > ?))) ORDER BY `a`, `b` DESC, `c` LIMIT 0,5",
+			"",
+		)
+		assert.Exactly(t, []interface{}{1, 1, 2, 1, 2, 3}, dml.KeysetArgs(keys, 1, 2, 3))
+		assert.Exactly(t, []interface{}{1, 2}, dml.KeysetArgs(dml.KeysetAsc("a", "b"), 1, 2))
+	})
+}
+
+func TestKeysetIterator(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `name` FROM `customer` ORDER BY `id` LIMIT 0,2")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(1, "a").AddRow(2, "b"))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `name` FROM `customer` WHERE (`id` > ?) ORDER BY `id` LIMIT 0,2")).
+		WithArgs(int64(2)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name"}).AddRow(3, "c"))
+
+	it := dbc.SelectFrom("customer").AddColumns("id", "name").KeysetIterator(2, dml.KeysetAsc("id")...)
+
+	var names []string
+	err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error {
+		for cm.Next() {
+			if cm.Column() == "name" {
+				var n string
+				cm.String(&n)
+				names = append(names, n)
+			}
+		}
+		return cm.Err()
+	})
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{"a", "b", "c"}, names)
+	assert.Exactly(t, []interface{}{int64(3)}, it.Cursor)
+	assert.Exactly(t, uint64(2), it.Chunks)
+}
+
+func TestKeysetIterator_Resume(t *testing.T) {
+	t.Parallel()
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id`, `store_id` FROM `customer` WHERE ((`store_id`,`id`) < (?,?)) ORDER BY `store_id` DESC, `id` DESC LIMIT 0,5")).
+		WithArgs(4, 7).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "store_id"}).AddRow(6, 4))
+
+	it := dbc.SelectFrom("customer").AddColumns("id", "store_id").KeysetIterator(5, dml.KeysetDesc("store_id", "id")...)
+	it.Cursor = []interface{}{4, 7}
+
+	var rows int
+	err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error {
+		rows++
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Exactly(t, 1, rows)
+	assert.Exactly(t, []interface{}{int64(4), int64(6)}, it.Cursor)
+}
+
+func TestKeysetIterator_Errors(t *testing.T) {
+	t.Parallel()
+
+	t.Run("missing key column", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `name` FROM `customer` ORDER BY `id` LIMIT 0,2")).
+			WillReturnRows(sqlmock.NewRows([]string{"name"}).AddRow("a"))
+
+		it := dbc.SelectFrom("customer").AddColumns("name").KeysetIterator(2, dml.KeysetAsc("id")...)
+		err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error { return nil })
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+		assert.Nil(t, it.Cursor)
+	})
+	t.Run("callback error keeps cursor", func(t *testing.T) {
+		dbc, dbMock := dmltest.MockDB(t)
+		defer dmltest.MockClose(t, dbc, dbMock)
+
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `id` FROM `customer` ORDER BY `id` LIMIT 0,5")).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1).AddRow(2).AddRow(3))
+
+		it := dbc.SelectFrom("customer").AddColumns("id").KeysetIterator(5, dml.KeysetAsc("id")...)
+		var rows int
+		err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error {
+			if rows++; rows == 3 {
+				return errors.Blocked.Newf("stop")
+			}
+			return nil
+		})
+		assert.True(t, errors.Blocked.Match(err), "%+v", err)
+		assert.Exactly(t, []interface{}{int64(2)}, it.Cursor)
+	})
+	t.Run("no keys", func(t *testing.T) {
+		it := dml.NewSelect("id").From("customer").KeysetIterator(5)
+		err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error { return nil })
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+	t.Run("cursor mismatch", func(t *testing.T) {
+		it := dml.NewSelect("id").From("customer").KeysetIterator(5, dml.KeysetAsc("id")...)
+		it.Cursor = []interface{}{1, 2}
+		err := it.Iterate(context.TODO(), func(cm *dml.ColumnMap) error { return nil })
+		assert.True(t, errors.Mismatch.Match(err), "%+v", err)
+	})
+}
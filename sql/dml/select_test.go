@@ -148,6 +148,18 @@ func TestSelect_BasicToSQL(t *testing.T) {
 		)
 	})
 
+	t.Run("IN with expand and one value slices", func(t *testing.T) {
+		sel := NewSelect("sku", "name").From("products").Where(
+			Column("id").In().PlaceHolder(),
+			Column("name").NotIn().PlaceHolder(),
+		)
+		compareToSQL(t, sel.WithArgs().ExpandPlaceHolders().Ints(3).Strings("A1"), errors.NoKind,
+			"SELECT `sku`, `name` FROM `products` WHERE (`id` IN (?)) AND (`name` NOT IN (?))",
+			"",
+			int64(3), "A1",
+		)
+	})
+
 	t.Run("IN with PlaceHolders", func(t *testing.T) {
 		sel := NewSelect("email").From("tableX").Where(Column("id").In().PlaceHolders(2))
 		compareToSQL2(t, sel, errors.NoKind,
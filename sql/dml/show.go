@@ -56,9 +56,11 @@ func (c *ConnPool) Show() *Show {
 	return &Show{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  c.DB,
+				id:      id,
+				Log:     l,
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 	}
@@ -74,9 +76,11 @@ func (c *Conn) Show() *Show {
 	return &Show{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  c.DB,
+				id:      id,
+				Log:     l,
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 	}
@@ -92,9 +96,11 @@ func (tx *Tx) Show() *Show {
 	return &Show{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  tx.DB,
+				id:      id,
+				Log:     l,
+				DB:      tx.DB,
+				dialect: tx.dialect,
+				tracer:  tx.tracer,
 			},
 		},
 	}
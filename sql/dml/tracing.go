@@ -0,0 +1,215 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+)
+
+// Span names used by the instrumentation.
+const (
+	SpanNameQuery    = "dml.Query"
+	SpanNameQueryRow = "dml.QueryRow"
+	SpanNameExec     = "dml.Exec"
+	SpanNamePrepare  = "dml.Prepare"
+	SpanNameTx       = "dml.Tx"
+)
+
+// Span attribute keys. They follow the OpenTelemetry semantic conventions for
+// databases where applicable.
+const (
+	SpanAttrSystem       = "db.system"
+	SpanAttrStatement    = "db.statement"
+	SpanAttrTable        = "db.sql.table"
+	SpanAttrRowsReturned = "db.rows_returned"
+	SpanAttrRowsAffected = "db.rows_affected"
+	SpanAttrBuilder      = "dml.builder"
+	SpanAttrID           = "dml.id"
+	SpanAttrPrepared     = "dml.prepared"
+	SpanAttrTxResult     = "dml.tx.result"
+)
+
+// Tracer starts spans. It is a minimal interface to attach any tracing
+// backend, e.g. an adapter for OpenTelemetry:
+//		type otelTracer struct{ t trace.Tracer }
+//		func (o otelTracer) StartSpan(ctx context.Context, name string) (context.Context, dml.Span) {
+//			ctx, s := o.t.Start(ctx, name, trace.WithSpanKind(trace.SpanKindClient))
+//			return ctx, otelSpan{s}
+//		}
+//		func (o otelTracer) ContextWithSpan(ctx context.Context, s dml.Span) context.Context {
+//			return trace.ContextWithSpan(ctx, s.(otelSpan).Span)
+//		}
+// The returned context must contain the new span, so that further spans, e.g.
+// of the driver, become its children. Set a Tracer with the ConnPoolOption
+// WithTracer. Conn, Tx and all statement types inherit the Tracer.
+type Tracer interface {
+	StartSpan(ctx context.Context, spanName string) (context.Context, Span)
+	// ContextWithSpan returns a copy of ctx with span as the current span. It
+	// gets used to make the statements of a transaction children of the span
+	// of the transaction, while keeping the deadline and cancellation of ctx.
+	ContextWithSpan(ctx context.Context, span Span) context.Context
+}
+
+// Span represents a single operation, a query or a transaction.
+type Span interface {
+	// SetAttribute sets a key/value pair. Value is a string, bool, int64 or
+	// uint64.
+	SetAttribute(key string, value interface{})
+	// RecordError marks the span as failed.
+	RecordError(err error)
+	// End completes the span. No further calls are allowed.
+	End()
+}
+
+// WithTracer sets the tracer of the connection pool. Each query, prepared
+// statement and transaction creates a span with the normalized SQL, see
+// QueryFingerprint, the table, the builder type, the returned or affected rows
+// and the error. The spans are children of the span in the context passed to
+// e.g. ExecContext, QueryContext, Load or BeginTx.
+//		dml.NewConnPool(dml.WithDSN(dsn), dml.WithTracer(myTracer))
+func WithTracer(t Tracer) ConnPoolOption {
+	return ConnPoolOption{
+		sortOrder: 3,
+		fn: func(c *ConnPool) error {
+			if t == nil {
+				return errors.Empty.Newf("[dml] WithTracer argument Tracer cannot be nil")
+			}
+			c.tracer = t
+			return nil
+		},
+	}
+}
+
+func dialectName(d Dialect) string {
+	if d == nil {
+		return DialectNameMySQL
+	}
+	return d.Name()
+}
+
+func dmlSourceName(source rune) string {
+	switch source {
+	case dmlSourceSelect:
+		return "select"
+	case dmlSourceInsert:
+		return "insert"
+	case dmlSourceInsertSelect:
+		return "insert_select"
+	case dmlSourceUpdate:
+		return "update"
+	case dmlSourceDelete:
+		return "delete"
+	case dmlSourceWith:
+		return "with"
+	case dmlSourceUnion:
+		return "union"
+	case dmlSourceShow:
+		return "show"
+	}
+	return "raw"
+}
+
+// startSpan starts a span with the common attributes of a statement. Returns a
+// nil Span if no tracer has been set.
+func (bc *builderCommon) startSpan(ctx context.Context, name, sqlStr string) (context.Context, Span) {
+	if bc.tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := bc.tracer.StartSpan(ctx, name)
+	span.SetAttribute(SpanAttrSystem, dialectName(bc.dialect))
+	if sqlStr == "" {
+		sqlStr = string(bc.cachedSQL)
+	}
+	span.SetAttribute(SpanAttrStatement, QueryFingerprint(sqlStr))
+	span.SetAttribute(SpanAttrBuilder, dmlSourceName(bc.source))
+	if bc.table != "" {
+		span.SetAttribute(SpanAttrTable, bc.table)
+	}
+	if bc.id != "" {
+		span.SetAttribute(SpanAttrID, bc.id)
+	}
+	return ctx, span
+}
+
+// endSpan records the error and ends the span. A nil span gets ignored.
+func endSpan(span Span, err error) {
+	if span == nil {
+		return
+	}
+	if err != nil {
+		span.RecordError(err)
+	}
+	span.End()
+}
+
+// endQuerySpan ends the span started in Artisan.query after all rows have been
+// read.
+func (a *Artisan) endQuerySpan(rowCount uint64, err error) {
+	if a.span == nil {
+		return
+	}
+	if err == nil {
+		a.span.SetAttribute(SpanAttrRowsReturned, rowCount)
+	}
+	endSpan(a.span, err)
+	a.span = nil
+}
+
+// startPrepareSpan starts the span of WithPrepare.
+func (cc *connCommon) startPrepareSpan(ctx context.Context, id, query string) (context.Context, Span) {
+	bc := builderCommon{id: id, dialect: cc.dialect, tracer: cc.tracer}
+	return bc.startSpan(ctx, SpanNamePrepare, query)
+}
+
+// startTxSpan starts the span of a transaction.
+func (cc *connCommon) startTxSpan(ctx context.Context) (context.Context, Span) {
+	if cc.tracer == nil {
+		return ctx, nil
+	}
+	ctx, span := cc.tracer.StartSpan(ctx, SpanNameTx)
+	span.SetAttribute(SpanAttrSystem, dialectName(cc.dialect))
+	return ctx, span
+}
+
+// tracerOfTx returns the Tracer of a transaction which starts the spans of the
+// statements as children of the span of the transaction.
+func (cc *connCommon) tracerOfTx(span Span) Tracer {
+	if span == nil {
+		return cc.tracer
+	}
+	return txTracer{Tracer: cc.tracer, span: span}
+}
+
+// txTracer starts all spans as children of the span of the transaction.
+type txTracer struct {
+	Tracer
+	span Span
+}
+
+func (t txTracer) StartSpan(ctx context.Context, spanName string) (context.Context, Span) {
+	return t.Tracer.StartSpan(t.Tracer.ContextWithSpan(ctx, t.span), spanName)
+}
+
+// endSpan ends the span of the transaction with the result commit or rollback.
+func (tx *Tx) endSpan(result string, err error) {
+	if tx.span == nil {
+		return
+	}
+	tx.span.SetAttribute(SpanAttrTxResult, result)
+	endSpan(tx.span, err)
+	tx.span = nil
+}
@@ -0,0 +1,187 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/dmltest/memdb"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func newTracedDB(t *testing.T) (*dml.ConnPool, *dmltest.TraceRecorder) {
+	tbls, err := ddl.NewTables(ddl.WithTable("customer",
+		&ddl.Column{Field: "id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+		&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(64)", Key: "UNI"},
+	))
+	dmltest.FatalIfError(t, err)
+	rec := dmltest.NewTraceRecorder()
+	dbc, _ := memdb.MockDB(t, tbls, dml.WithTracer(rec))
+	return dbc, rec
+}
+
+func TestWithTracer(t *testing.T) {
+	t.Parallel()
+
+	t.Run("nil tracer", func(t *testing.T) {
+		_, err := dml.NewConnPool(dml.WithTracer(nil))
+		assert.True(t, errors.Empty.Match(err), "%+v", err)
+	})
+
+	t.Run("exec and query", func(t *testing.T) {
+		dbc, rec := newTracedDB(t)
+		defer dmltest.Close(t, dbc)
+
+		ctx, parent := rec.StartSpan(context.Background(), "parent")
+		ins := dbc.InsertInto("customer").AddColumns("email").BuildValues().WithArgs()
+		_, err := ins.ExecContext(ctx, "a@b.c")
+		assert.NoError(t, err)
+		_, err = ins.ExecContext(ctx, "d@e.f")
+		assert.NoError(t, err)
+		_, err = ins.ExecContext(ctx, "a@b.c")
+		assert.Error(t, err, "duplicate entry")
+		parent.End()
+
+		ids, err := dbc.SelectFrom("customer").AddColumns("id").
+			Where(dml.Column("id").Greater().PlaceHolder()).
+			WithArgs().LoadInt64s(context.Background(), nil, 0)
+		assert.NoError(t, err)
+		assert.Exactly(t, []int64{1, 2}, ids)
+
+		rows, err := dbc.WithRawSQL("SELECT * FROM `customer`").QueryContext(context.Background())
+		assert.NoError(t, err)
+		assert.NoError(t, rows.Close())
+
+		execs := rec.SpansByName(dml.SpanNameExec)
+		assert.Len(t, execs, 3)
+		for _, s := range execs {
+			assert.Exactly(t, 1, s.ParentID)
+			assert.True(t, s.Ended)
+			assert.Exactly(t, "mysql", s.Attributes[dml.SpanAttrSystem])
+			assert.Exactly(t, "insert", s.Attributes[dml.SpanAttrBuilder])
+			assert.Exactly(t, "customer", s.Attributes[dml.SpanAttrTable])
+			assert.Exactly(t, "INSERT INTO `customer` (`email`) VALUES (?+)", s.Attributes[dml.SpanAttrStatement])
+		}
+		assert.Exactly(t, int64(1), execs[0].Attributes[dml.SpanAttrRowsAffected])
+		assert.Len(t, execs[0].Errors, 0)
+		assert.Len(t, execs[2].Errors, 1)
+		_, ok := execs[2].Attributes[dml.SpanAttrRowsAffected]
+		assert.False(t, ok)
+
+		queries := rec.SpansByName(dml.SpanNameQuery)
+		assert.Len(t, queries, 2)
+		assert.Exactly(t, 0, queries[0].ParentID)
+		assert.Exactly(t, "select", queries[0].Attributes[dml.SpanAttrBuilder])
+		assert.Exactly(t, "SELECT `id` FROM `customer` WHERE (`id` > ?)", queries[0].Attributes[dml.SpanAttrStatement])
+		assert.Exactly(t, uint64(2), queries[0].Attributes[dml.SpanAttrRowsReturned])
+		assert.True(t, queries[0].Ended)
+
+		assert.Exactly(t, "raw", queries[1].Attributes[dml.SpanAttrBuilder])
+		assert.True(t, queries[1].Ended, "QueryContext ends the span")
+		_, ok = queries[1].Attributes[dml.SpanAttrRowsReturned]
+		assert.False(t, ok)
+	})
+
+	t.Run("prepared statement", func(t *testing.T) {
+		dbc, rec := newTracedDB(t)
+		defer dmltest.Close(t, dbc)
+		ctx := context.Background()
+
+		stmt, err := dbc.SelectFrom("customer").AddColumns("id").
+			Where(dml.Column("id").Greater().PlaceHolder()).Prepare(ctx)
+		assert.NoError(t, err)
+		defer dmltest.Close(t, stmt)
+
+		ids, err := stmt.WithArgs().LoadInt64s(ctx, nil, 0)
+		assert.NoError(t, err)
+		assert.Len(t, ids, 0)
+
+		spans := rec.Spans()
+		assert.Len(t, spans, 2)
+		assert.Exactly(t, dml.SpanNamePrepare, spans[0].Name)
+		assert.Exactly(t, "customer", spans[0].Attributes[dml.SpanAttrTable])
+		assert.Exactly(t, dml.SpanNameQuery, spans[1].Name)
+		assert.Exactly(t, true, spans[1].Attributes[dml.SpanAttrPrepared])
+		assert.Exactly(t, "SELECT `id` FROM `customer` WHERE (`id` > ?)", spans[1].Attributes[dml.SpanAttrStatement])
+		assert.Exactly(t, uint64(0), spans[1].Attributes[dml.SpanAttrRowsReturned])
+	})
+
+	t.Run("query row", func(t *testing.T) {
+		dbc, rec := newTracedDB(t)
+		defer dmltest.Close(t, dbc)
+		ctx := context.Background()
+		_, err := dbc.WithRawSQL("INSERT INTO `customer` (`email`) VALUES ('a@b.c')").ExecContext(ctx)
+		assert.NoError(t, err)
+
+		var email string
+		row := dbc.SelectFrom("customer").AddColumns("email").Where(dml.Column("id").PlaceHolder()).WithArgs().QueryRowContext(ctx, 1)
+		spans := rec.SpansByName(dml.SpanNameQueryRow)
+		assert.Len(t, spans, 1)
+		assert.False(t, spans[0].Ended, "the span ends with Scan")
+		assert.NoError(t, row.Scan(&email))
+		assert.Exactly(t, "a@b.c", email)
+
+		row = dbc.SelectFrom("customer").AddColumns("email").Where(dml.Column("id").PlaceHolder()).WithArgs().QueryRowContext(ctx, 2)
+		assert.Exactly(t, sql.ErrNoRows, row.Scan(&email))
+
+		spans = rec.SpansByName(dml.SpanNameQueryRow)
+		assert.Len(t, spans, 2)
+		assert.True(t, spans[0].Ended && spans[1].Ended)
+		assert.Exactly(t, uint64(1), spans[0].Attributes[dml.SpanAttrRowsReturned])
+		assert.Exactly(t, uint64(0), spans[1].Attributes[dml.SpanAttrRowsReturned])
+		assert.Len(t, spans[1].Errors, 0, "sql.ErrNoRows is not an error of the span")
+	})
+
+	t.Run("transaction", func(t *testing.T) {
+		dbc, rec := newTracedDB(t)
+		defer dmltest.Close(t, dbc)
+		ctx := context.Background()
+
+		assert.NoError(t, dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+			_, err := tx.WithRawSQL("INSERT INTO `customer` (`email`) VALUES ('a@b.c')").ExecContext(ctx)
+			if err != nil {
+				return err
+			}
+			var id int64
+			return tx.SelectFrom("customer").AddColumns("id").WithArgs().QueryRowContext(ctx).Scan(&id)
+		}))
+		errTx := errors.AlreadyClosed.Newf("abort")
+		err := dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+			return errTx
+		})
+		assert.True(t, errors.AlreadyClosed.Match(err), "%+v", err)
+
+		txs := rec.SpansByName(dml.SpanNameTx)
+		assert.Len(t, txs, 2)
+		assert.Exactly(t, "commit", txs[0].Attributes[dml.SpanAttrTxResult])
+		assert.Exactly(t, "rollback", txs[1].Attributes[dml.SpanAttrTxResult])
+		assert.True(t, txs[0].Ended && txs[1].Ended)
+		execs := rec.SpansByName(dml.SpanNameExec)
+		assert.Len(t, execs, 1)
+		assert.Exactly(t, txs[0].ID, execs[0].ParentID, "statements are children of the transaction")
+		queryRows := rec.SpansByName(dml.SpanNameQueryRow)
+		assert.Len(t, queryRows, 1)
+		assert.Exactly(t, txs[0].ID, queryRows[0].ParentID, "statements are children of the transaction")
+
+		rec.Reset()
+		assert.Len(t, rec.Spans(), 0)
+	})
+}
@@ -67,9 +67,11 @@ func (c *ConnPool) Union(selects ...*Select) *Union {
 	return &Union{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: unionInitLog(c.Log, selects, id),
-				DB:  c.DB,
+				id:      id,
+				Log:     unionInitLog(c.Log, selects, id),
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 		Selects: selects,
@@ -82,9 +84,11 @@ func (c *Conn) Union(selects ...*Select) *Union {
 	return &Union{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: unionInitLog(c.Log, selects, id),
-				DB:  c.DB,
+				id:      id,
+				Log:     unionInitLog(c.Log, selects, id),
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 		Selects: selects,
@@ -98,9 +102,11 @@ func (tx *Tx) Union(selects ...*Select) *Union {
 	return &Union{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: unionInitLog(tx.Log, selects, id),
-				DB:  tx.DB,
+				id:      id,
+				Log:     unionInitLog(tx.Log, selects, id),
+				DB:      tx.DB,
+				dialect: tx.dialect,
+				tracer:  tx.tracer,
 			},
 		},
 		Selects: selects,
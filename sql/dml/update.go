@@ -30,6 +30,10 @@ type Update struct {
 	// SetClauses contains the column/argument association. For each column
 	// there must be one argument.
 	SetClauses Conditions
+	// Returning writes the columns of the Select as RETURNING clause to
+	// return the updated rows. Supported by PostgreSQL. MySQL and MariaDB do
+	// not support it.
+	Returning *Select
 	// Listeners allows to dispatch certain functions in different
 	// situations.
 	Listeners ListenersUpdate
@@ -54,9 +58,11 @@ func newUpdate(db QueryExecPreparer, cComm *connCommon, table string) *Update {
 	return &Update{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: l,
-				DB:  db,
+				id:      id,
+				Log:     l,
+				DB:      db,
+				dialect: cComm.dialect,
+				tracer:  cComm.tracer,
 			},
 			Table: MakeIdentifier(table),
 		},
@@ -174,6 +180,7 @@ func (b *Update) writeBuildCache(sql []byte, qualifiedColumns []string) {
 	if !b.IsBuildCacheDisabled {
 		b.BuilderConditional = BuilderConditional{}
 		b.SetClauses = nil
+		b.Returning = nil
 		b.cachedSQL = sql
 	}
 }
@@ -220,7 +227,7 @@ func (b *Update) toSQL(buf *bytes.Buffer, placeHolders []string) ([]string, erro
 
 	sqlWriteOrderBy(buf, b.OrderBys, false)
 	sqlWriteLimitOffset(buf, b.LimitValid, false, 0, b.LimitCount)
-	return placeHolders, nil
+	return sqlWriteReturning(buf, b.Returning, placeHolders)
 }
 
 // Prepare executes the statement represented by the Update to create a prepared
@@ -243,5 +250,6 @@ func (b *Update) Clone() *Update {
 	c.BuilderBase = b.BuilderBase.Clone()
 	c.BuilderConditional = b.BuilderConditional.Clone()
 	c.SetClauses = b.SetClauses.Clone()
+	c.Returning = b.Returning.Clone()
 	return &c
 }
@@ -382,3 +382,19 @@ func TestUpdate_Clone(t *testing.T) {
 		assert.Exactly(t, d.Log, d2.Log)
 	})
 }
+
+func TestUpdate_Record_KeepsID(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `dml_person` SET `name`=? WHERE (`id` = ?)")).
+		WithArgs("Hans", int64(33)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	p := &dmlPerson{ID: 33, Name: "Hans"}
+	_, err := dbc.Update("dml_person").AddColumns("name").
+		Where(dml.Column("id").PlaceHolder()).
+		WithArgs().Record("", p).ExecContext(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, int64(33), p.ID, "ID must not be overwritten by LastInsertId")
+}
@@ -0,0 +1,311 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"bytes"
+
+	"github.com/corestoreio/errors"
+)
+
+const (
+	frameUnitRows  byte = 'r'
+	frameUnitRange byte = 'g'
+)
+
+const (
+	frameUnboundedPreceding byte = 'p'
+	framePreceding          byte = '<'
+	frameCurrentRow         byte = 'c'
+	frameFollowing          byte = '>'
+	frameUnboundedFollowing byte = 'f'
+)
+
+// FrameBound defines the start or the end of a window frame. Please use the
+// helper functions Frame* to create a bound.
+type FrameBound struct {
+	// Expression contains the offset for the PRECEDING and FOLLOWING bounds.
+	// It can be an unsigned integer, an INTERVAL expression for RANGE frames
+	// or the place holder character `?`. The expression gets written
+	// unchanged into the SQL string.
+	Expression string
+	kind       byte
+}
+
+// FrameUnboundedPreceding sets the bound to the first partition row.
+func FrameUnboundedPreceding() FrameBound { return FrameBound{kind: frameUnboundedPreceding} }
+
+// FrameCurrentRow sets the bound to the current row for ROWS frames and to the
+// peers of the current row for RANGE frames.
+func FrameCurrentRow() FrameBound { return FrameBound{kind: frameCurrentRow} }
+
+// FrameUnboundedFollowing sets the bound to the last partition row.
+func FrameUnboundedFollowing() FrameBound { return FrameBound{kind: frameUnboundedFollowing} }
+
+// FramePreceding sets the bound `expression` rows or values before the current
+// row.
+//		FramePreceding("3")                // 3 PRECEDING
+//		FramePreceding("INTERVAL 7 DAY")   // INTERVAL 7 DAY PRECEDING
+//		FramePreceding("?")                // ? PRECEDING
+func FramePreceding(expression string) FrameBound {
+	return FrameBound{Expression: expression, kind: framePreceding}
+}
+
+// FrameFollowing sets the bound `expression` rows or values after the current
+// row. See FramePreceding for the possible expressions.
+func FrameFollowing(expression string) FrameBound {
+	return FrameBound{Expression: expression, kind: frameFollowing}
+}
+
+func (fb FrameBound) write(w *bytes.Buffer) (err error) {
+	switch fb.kind {
+	case frameUnboundedPreceding:
+		w.WriteString("UNBOUNDED PRECEDING")
+	case frameCurrentRow:
+		w.WriteString("CURRENT ROW")
+	case frameUnboundedFollowing:
+		w.WriteString("UNBOUNDED FOLLOWING")
+	case framePreceding, frameFollowing:
+		if fb.Expression == "" {
+			return errors.Empty.Newf("[dml] Window frame bound requires an expression")
+		}
+		writeExpression(w, fb.Expression, nil)
+		if fb.kind == framePreceding {
+			w.WriteString(" PRECEDING")
+		} else {
+			w.WriteString(" FOLLOWING")
+		}
+	default:
+		return errors.NotSupported.Newf("[dml] Window frame bound %q not supported", fb.kind)
+	}
+	return nil
+}
+
+// Window defines the window specification of a window function. A window can
+// be used in the OVER clause of a column or as a named window in the WINDOW
+// clause of a SELECT statement. Window functions are supported since MySQL 8.0
+// and MariaDB 10.2.
+//		ROW_NUMBER() OVER (PARTITION BY `store_id` ORDER BY `grand_total` DESC)
+// https://dev.mysql.com/doc/refman/8.0/en/window-functions-usage.html
+// https://mariadb.com/kb/en/library/window-functions/
+type Window struct {
+	// Name defines the name of the window in the WINDOW clause. Gets set by
+	// the function Select.Window and is ignored in an OVER clause.
+	Name string
+	// Ref references the name of a window defined in the WINDOW clause. If Ref
+	// is the only set field the OVER clause writes the name without
+	// parenthesis. Otherwise the current window inherits the named window and
+	// may add ORDER BY and frame clauses.
+	Ref          string
+	PartitionBys ids
+	OrderBys     ids
+	// IsUnsafe if set to true the functions PartitionBy and OrderBy* will turn
+	// any non valid identifier into an expression.
+	IsUnsafe   bool
+	frameUnit  byte
+	frameStart FrameBound
+	frameEnd   FrameBound
+}
+
+// NewWindow creates a new anonymous window specification.
+func NewWindow() *Window {
+	return new(Window)
+}
+
+// NamedWindow creates a window which references a named window defined with
+// function Select.Window.
+//		NamedWindow("w")                      // OVER `w`
+//		NamedWindow("w").OrderBy("entity_id") // OVER (`w` ORDER BY `entity_id`)
+func NamedWindow(name string) *Window {
+	return &Window{Ref: name}
+}
+
+// Unsafe see Window.IsUnsafe. This function must be called before calling
+// PartitionBy or OrderBy*.
+func (wi *Window) Unsafe() *Window {
+	wi.IsUnsafe = true
+	return wi
+}
+
+// PartitionBy appends columns to the PARTITION BY clause. A column gets always
+// quoted if it is a valid identifier otherwise it will be treated as an
+// expression, if the window is unsafe.
+func (wi *Window) PartitionBy(columns ...string) *Window {
+	wi.PartitionBys = wi.PartitionBys.AppendColumns(wi.IsUnsafe, columns...)
+	return wi
+}
+
+// OrderBy appends columns to the ORDER BY clause of the window for ascending
+// sorting.
+func (wi *Window) OrderBy(columns ...string) *Window {
+	wi.OrderBys = wi.OrderBys.AppendColumns(wi.IsUnsafe, columns...)
+	return wi
+}
+
+// OrderByDesc appends columns to the ORDER BY clause of the window for
+// descending sorting.
+func (wi *Window) OrderByDesc(columns ...string) *Window {
+	wi.OrderBys = wi.OrderBys.AppendColumns(wi.IsUnsafe, columns...).applySort(len(columns), sortDescending)
+	return wi
+}
+
+// Rows sets a ROWS frame which starts at `start` and ends at the current row.
+//		ROWS UNBOUNDED PRECEDING
+func (wi *Window) Rows(start FrameBound) *Window {
+	return wi.setFrame(frameUnitRows, start, FrameBound{})
+}
+
+// RowsBetween sets a ROWS frame with a start and an end bound.
+//		ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING
+func (wi *Window) RowsBetween(start, end FrameBound) *Window {
+	return wi.setFrame(frameUnitRows, start, end)
+}
+
+// Range sets a RANGE frame which starts at `start` and ends at the current
+// row.
+//		RANGE INTERVAL 7 DAY PRECEDING
+func (wi *Window) Range(start FrameBound) *Window {
+	return wi.setFrame(frameUnitRange, start, FrameBound{})
+}
+
+// RangeBetween sets a RANGE frame with a start and an end bound. The ORDER BY
+// clause must contain a single numeric or temporal column when using offsets.
+//		RANGE BETWEEN INTERVAL 7 DAY PRECEDING AND CURRENT ROW
+func (wi *Window) RangeBetween(start, end FrameBound) *Window {
+	return wi.setFrame(frameUnitRange, start, end)
+}
+
+func (wi *Window) setFrame(unit byte, start, end FrameBound) *Window {
+	wi.frameUnit = unit
+	wi.frameStart = start
+	wi.frameEnd = end
+	return wi
+}
+
+// Clone creates a clone of the current object.
+func (wi *Window) Clone() *Window {
+	if wi == nil {
+		return nil
+	}
+	c := *wi
+	c.PartitionBys = wi.PartitionBys.Clone()
+	c.OrderBys = wi.OrderBys.Clone()
+	return &c
+}
+
+func (wi *Window) isRefOnly() bool {
+	return wi.Ref != "" && len(wi.PartitionBys) == 0 && len(wi.OrderBys) == 0 && wi.frameUnit == 0
+}
+
+// writeOver writes the OVER clause for a window function.
+func (wi *Window) writeOver(w *bytes.Buffer, placeHolders []string) (_ []string, err error) {
+	w.WriteString(" OVER ")
+	if wi.isRefOnly() {
+		Quoter.quote(w, wi.Ref)
+		return placeHolders, nil
+	}
+	return wi.writeSpec(w, placeHolders)
+}
+
+// writeSpec writes the window specification enclosed in parenthesis.
+func (wi *Window) writeSpec(w *bytes.Buffer, placeHolders []string) (_ []string, err error) {
+	w.WriteByte('(')
+	sep := false
+	if wi.Ref != "" {
+		Quoter.quote(w, wi.Ref)
+		sep = true
+	}
+	if len(wi.PartitionBys) > 0 {
+		if sep {
+			w.WriteByte(' ')
+		}
+		w.WriteString("PARTITION BY ")
+		if placeHolders, err = wi.PartitionBys.writeQuoted(w, placeHolders); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sep = true
+	}
+	if len(wi.OrderBys) > 0 {
+		if sep {
+			w.WriteByte(' ')
+		}
+		w.WriteString("ORDER BY ")
+		if placeHolders, err = wi.OrderBys.writeQuoted(w, placeHolders); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		sep = true
+	}
+	if wi.frameUnit > 0 {
+		if sep {
+			w.WriteByte(' ')
+		}
+		if wi.frameUnit == frameUnitRange {
+			w.WriteString("RANGE ")
+		} else {
+			w.WriteString("ROWS ")
+		}
+		if wi.frameEnd.kind > 0 {
+			w.WriteString("BETWEEN ")
+		}
+		if err = wi.frameStart.write(w); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if wi.frameEnd.kind > 0 {
+			w.WriteString(" AND ")
+			if err = wi.frameEnd.write(w); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+	w.WriteByte(')')
+	return placeHolders, nil
+}
+
+// Windows defines a list of named windows used in the WINDOW clause.
+type Windows []*Window
+
+// Clone creates a clone of the current object.
+func (ws Windows) Clone() Windows {
+	if ws == nil {
+		return nil
+	}
+	c := make(Windows, len(ws))
+	for i, wi := range ws {
+		c[i] = wi.Clone()
+	}
+	return c
+}
+
+// write writes the WINDOW clause.
+func (ws Windows) write(w *bytes.Buffer, placeHolders []string) (_ []string, err error) {
+	if len(ws) == 0 {
+		return placeHolders, nil
+	}
+	w.WriteString(" WINDOW ")
+	for i, wi := range ws {
+		if i > 0 {
+			w.WriteString(", ")
+		}
+		if wi.Name == "" {
+			return nil, errors.Empty.Newf("[dml] Window at index %d requires a name", i)
+		}
+		Quoter.quote(w, wi.Name)
+		w.WriteString(" AS ")
+		if placeHolders, err = wi.writeSpec(w, placeHolders); err != nil {
+			return nil, errors.Wrapf(err, "[dml] Window %q", wi.Name)
+		}
+	}
+	return placeHolders, nil
+}
@@ -0,0 +1,173 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dml
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestWindow_ToSQL(t *testing.T) {
+	t.Parallel()
+
+	t.Run("anonymous windows", func(t *testing.T) {
+		sel := NewSelect("entity_id", "store_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("ROW_NUMBER()").Over(NewWindow().PartitionBy("store_id").OrderByDesc("grand_total")).Alias("rn"),
+				Expr("RANK()").Over(NewWindow().OrderBy("created_at")).Alias("rnk"),
+				Expr("SUM(grand_total)").Over(NewWindow()).Alias("total"),
+			)
+		compareToSQL2(t, sel, errors.NoKind,
+			"SELECT `entity_id`, `store_id`, ROW_NUMBER() OVER (PARTITION BY `store_id` ORDER BY `grand_total` DESC) AS `rn`, RANK() OVER (ORDER BY `created_at`) AS `rnk`, SUM(grand_total) OVER () AS `total` FROM `sales_order`",
+		)
+	})
+
+	t.Run("named windows", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("LAG(grand_total)").Over(NamedWindow("w")).Alias("prev_total"),
+				Expr("LEAD(grand_total)").Over(NamedWindow("w")).Alias("next_total"),
+				Expr("SUM(grand_total)").Over(NamedWindow("w2").RowsBetween(FrameUnboundedPreceding(), FrameCurrentRow())).Alias("running"),
+			).
+			Where(Column("store_id").Int(2)).
+			Window("w", NewWindow().PartitionBy("customer_id").OrderBy("created_at")).
+			Window("w2", NamedWindow("w").OrderByDesc("entity_id")).
+			OrderBy("entity_id")
+		compareToSQL2(t, sel, errors.NoKind,
+			"SELECT `entity_id`, LAG(grand_total) OVER `w` AS `prev_total`, LEAD(grand_total) OVER `w` AS `next_total`, SUM(grand_total) OVER (`w2` ROWS BETWEEN UNBOUNDED PRECEDING AND CURRENT ROW) AS `running` FROM `sales_order` WHERE (`store_id` = 2) WINDOW `w` AS (PARTITION BY `customer_id` ORDER BY `created_at`), `w2` AS (`w` ORDER BY `entity_id` DESC) ORDER BY `entity_id`",
+		)
+	})
+
+	t.Run("frames", func(t *testing.T) {
+		sel := NewSelect("sku").From("cataloginventory_stock_item").
+			AddColumnsConditions(
+				Expr("AVG(qty)").Over(NewWindow().OrderBy("sku").Rows(FramePreceding("3"))).Alias("a"),
+				Expr("AVG(qty)").Over(NewWindow().OrderBy("sku").RowsBetween(FramePreceding("1"), FrameFollowing("1"))).Alias("b"),
+				Expr("SUM(qty)").Over(NewWindow().OrderBy("updated_at").RangeBetween(FramePreceding("INTERVAL 7 DAY"), FrameCurrentRow())).Alias("c"),
+				Expr("MAX(qty)").Over(NewWindow().Range(FrameUnboundedPreceding())).Alias("d"),
+				Expr("MIN(qty)").Over(NewWindow().RowsBetween(FrameCurrentRow(), FrameUnboundedFollowing())).Alias("e"),
+			)
+		compareToSQL2(t, sel, errors.NoKind,
+			"SELECT `sku`, AVG(qty) OVER (ORDER BY `sku` ROWS 3 PRECEDING) AS `a`, AVG(qty) OVER (ORDER BY `sku` ROWS BETWEEN 1 PRECEDING AND 1 FOLLOWING) AS `b`, SUM(qty) OVER (ORDER BY `updated_at` RANGE BETWEEN INTERVAL 7 DAY PRECEDING AND CURRENT ROW) AS `c`, MAX(qty) OVER (RANGE UNBOUNDED PRECEDING) AS `d`, MIN(qty) OVER (ROWS BETWEEN CURRENT ROW AND UNBOUNDED FOLLOWING) AS `e` FROM `cataloginventory_stock_item`",
+		)
+	})
+
+	t.Run("unsafe partition by expression", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("DENSE_RANK()").Over(NewWindow().Unsafe().PartitionBy("YEAR(created_at)").OrderByDesc("grand_total")).Alias("dr"),
+			)
+		compareToSQL2(t, sel, errors.NoKind,
+			"SELECT `entity_id`, DENSE_RANK() OVER (PARTITION BY YEAR(created_at) ORDER BY `grand_total` DESC) AS `dr` FROM `sales_order`",
+		)
+	})
+
+	t.Run("placeholders and interpolation", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("LAG(grand_total, ?)").Over(NamedWindow("w")).Alias("lagged"),
+			).
+			Where(Column("store_id").PlaceHolder()).
+			Window("w", NewWindow().OrderBy("entity_id").RowsBetween(FramePreceding("?"), FrameCurrentRow()))
+
+		compareToSQL(t, sel.WithArgs().Int(2).Int(5).Int(3), errors.NoKind,
+			"SELECT `entity_id`, LAG(grand_total, ?) OVER `w` AS `lagged` FROM `sales_order` WHERE (`store_id` = ?) WINDOW `w` AS (ORDER BY `entity_id` ROWS BETWEEN ? PRECEDING AND CURRENT ROW)",
+			"SELECT `entity_id`, LAG(grand_total, 2) OVER `w` AS `lagged` FROM `sales_order` WHERE (`store_id` = 5) WINDOW `w` AS (ORDER BY `entity_id` ROWS BETWEEN 3 PRECEDING AND CURRENT ROW)",
+			int64(2), int64(5), int64(3),
+		)
+	})
+
+	t.Run("arguments in expression", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("NTH_VALUE(grand_total, ?)").Int(2).Over(NewWindow().OrderBy("entity_id")).Alias("second"),
+			)
+		compareToSQL2(t, sel, errors.NoKind,
+			"SELECT `entity_id`, NTH_VALUE(grand_total, 2) OVER (ORDER BY `entity_id`) AS `second` FROM `sales_order`",
+		)
+	})
+
+	t.Run("unnamed WINDOW clause", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order")
+		sel.Windows = append(sel.Windows, NewWindow())
+		compareToSQL2(t, sel, errors.Empty, "")
+	})
+
+	t.Run("frame bound without expression", func(t *testing.T) {
+		sel := NewSelect("entity_id").From("sales_order").
+			AddColumnsConditions(
+				Expr("COUNT(*)").Over(NewWindow().Rows(FramePreceding(""))).Alias("c"),
+			)
+		compareToSQL2(t, sel, errors.Empty, "")
+	})
+}
+
+func TestWindow_CTE_Union(t *testing.T) {
+	t.Parallel()
+
+	t.Run("WithCTE", func(t *testing.T) {
+		cte := NewWith(
+			WithCTE{
+				Name: "ranked",
+				Select: NewSelect("entity_id", "customer_id").From("sales_order").
+					AddColumnsConditions(
+						Expr("ROW_NUMBER()").Over(NamedWindow("w")).Alias("rn"),
+					).
+					Window("w", NewWindow().PartitionBy("customer_id").OrderByDesc("created_at")),
+			},
+		).Select(NewSelect().Star().From("ranked").Where(Column("rn").LessOrEqual().PlaceHolder()))
+
+		compareToSQL(t, cte.WithArgs().Int(3), errors.NoKind,
+			"WITH `ranked` AS (SELECT `entity_id`, `customer_id`, ROW_NUMBER() OVER `w` AS `rn` FROM `sales_order` WINDOW `w` AS (PARTITION BY `customer_id` ORDER BY `created_at` DESC))\nSELECT * FROM `ranked` WHERE (`rn` <= ?)",
+			"WITH `ranked` AS (SELECT `entity_id`, `customer_id`, ROW_NUMBER() OVER `w` AS `rn` FROM `sales_order` WINDOW `w` AS (PARTITION BY `customer_id` ORDER BY `created_at` DESC))\nSELECT * FROM `ranked` WHERE (`rn` <= 3)",
+			int64(3),
+		)
+	})
+
+	t.Run("Union", func(t *testing.T) {
+		u := NewUnion(
+			NewSelect("entity_id").From("sales_order").
+				AddColumnsConditions(Expr("RANK()").Over(NewWindow().OrderByDesc("grand_total")).Alias("rnk")),
+			NewSelect("entity_id").From("sales_order_archive").
+				AddColumnsConditions(Expr("RANK()").Over(NamedWindow("w")).Alias("rnk")).
+				Window("w", NewWindow().OrderByDesc("grand_total")),
+		).All()
+		compareToSQL2(t, u, errors.NoKind,
+			"(SELECT `entity_id`, RANK() OVER (ORDER BY `grand_total` DESC) AS `rnk` FROM `sales_order`)\nUNION ALL\n(SELECT `entity_id`, RANK() OVER `w` AS `rnk` FROM `sales_order_archive` WINDOW `w` AS (ORDER BY `grand_total` DESC))",
+		)
+	})
+}
+
+func TestWindow_BuildCache_Clone(t *testing.T) {
+	t.Parallel()
+
+	const wantSQL = "SELECT `entity_id`, SUM(grand_total) OVER `w` AS `total` FROM `sales_order` WINDOW `w` AS (PARTITION BY `customer_id`)"
+
+	sel := NewSelect("entity_id").From("sales_order").
+		AddColumnsConditions(Expr("SUM(grand_total)").Over(NamedWindow("w")).Alias("total")).
+		Window("w", NewWindow().PartitionBy("customer_id"))
+	selClone := sel.Clone()
+
+	compareToSQL2(t, sel, errors.NoKind, wantSQL)
+	assert.Nil(t, sel.Windows, "Windows should be nil after caching the SQL")
+	compareToSQL2(t, sel, errors.NoKind, wantSQL) // from cache
+
+	selClone.Windows[0].OrderBy("created_at")
+	compareToSQL2(t, selClone, errors.NoKind,
+		"SELECT `entity_id`, SUM(grand_total) OVER `w` AS `total` FROM `sales_order` WINDOW `w` AS (PARTITION BY `customer_id` ORDER BY `created_at`)",
+	)
+}
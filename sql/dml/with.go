@@ -100,9 +100,11 @@ func (c *ConnPool) With(expressions ...WithCTE) *With {
 	return &With{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: withInitLog(c.Log, expressions, id),
-				DB:  c.DB,
+				id:      id,
+				Log:     withInitLog(c.Log, expressions, id),
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 		Subclauses: expressions,
@@ -115,9 +117,11 @@ func (c *Conn) With(expressions ...WithCTE) *With {
 	return &With{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: withInitLog(c.Log, expressions, id),
-				DB:  c.DB,
+				id:      id,
+				Log:     withInitLog(c.Log, expressions, id),
+				DB:      c.DB,
+				dialect: c.dialect,
+				tracer:  c.tracer,
 			},
 		},
 		Subclauses: expressions,
@@ -130,9 +134,11 @@ func (tx *Tx) With(expressions ...WithCTE) *With {
 	return &With{
 		BuilderBase: BuilderBase{
 			builderCommon: builderCommon{
-				id:  id,
-				Log: withInitLog(tx.Log, expressions, id),
-				DB:  tx.DB,
+				id:      id,
+				Log:     withInitLog(tx.Log, expressions, id),
+				DB:      tx.DB,
+				dialect: tx.dialect,
+				tracer:  tx.tracer,
 			},
 		},
 		Subclauses: expressions,
@@ -18,21 +18,25 @@ func Make{{.Collection}}() {{.Collection}} {
 	}
 }
 
-func (cc {{.Collection}}) scanColumns(cm *dml.ColumnMap,e *{{.Entity}}, idx uint64) error {
-	if err := cc.BeforeMapColumns(idx, e); err != nil {
-		return errors.WithStack(err)
+func (cc *{{.Collection}}) scanColumns(cm *dml.ColumnMap,e *{{.Entity}}, idx uint64) error {
+	if cc.BeforeMapColumns != nil {
+		if err := cc.BeforeMapColumns(idx, e); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 	if err := e.MapColumns(cm); err != nil {
 		return errors.WithStack(err)
 	}
-	if err := cc.AfterMapColumns(idx, e); err != nil {
-		return errors.WithStack(err)
+	if cc.AfterMapColumns != nil {
+		if err := cc.AfterMapColumns(idx, e); err != nil {
+			return errors.WithStack(err)
+		}
 	}
 	return nil
 }
 
 // MapColumns implements dml.ColumnMapper interface. Auto generated.
-func (cc {{.Collection}}) MapColumns(cm *dml.ColumnMap) error {
+func (cc *{{.Collection}}) MapColumns(cm *dml.ColumnMap) error {
 	switch m := cm.Mode(); m {
 	case dml.ColumnMapEntityReadAll, dml.ColumnMapEntityReadSet:
 		for i, e := range cc.Data {
@@ -52,13 +56,17 @@ func (cc {{.Collection}}) MapColumns(cm *dml.ColumnMap) error {
 	case dml.ColumnMapCollectionReadSet:
 		for cm.Next() {
 			switch c := cm.Column(); c {
-			{{- range .Columns.UniqueColumns -}}
+			{{- range .Columns.UniqueColumns}}
 			case "{{.Field}}"{{range .Aliases}},"{{.}}"{{end}}:
-				cm.Args = cm.Args.{{GoFuncNull .}}s(cc.{{ToGoCamelCase .Field}}s()...)
+			{{- if GoArgsFuncNull .}}
+				cm.{{GoArgsFuncNull .}}(cc.{{ToGoCamelCase .Field}}s()...)
+			{{- else}}
+				return errors.NotSupported.Newf("[{{$.Package}}] {{$.Collection}} Column %q does not support a slice of values", c)
+			{{- end}}
 			{{- end}}
 			{{- range .Columns.UniquifiedColumns}}
 			case "{{.Field}}"{{range .Aliases}},"{{.}}"{{end}}:
-				cm.Args = cm.Args.{{GoFunc .}}s(cc.{{ToGoCamelCase .Field}}s()...){{end}}
+				cm.{{GoFunc .}}s(cc.{{ToGoCamelCase .Field}}s()...){{end}}
 			default:
 				return errors.NotFound.Newf("[{{.Package}}] {{.Collection}} Column %q not found", c)
 			}
@@ -4,6 +4,8 @@
 type {{.Entity}} struct {
 {{range .Columns}}{{ToGoCamelCase .Field}} {{GoTypeNull .}}
 		{{- if ne .StructTag "" -}}`{{.StructTag}}`{{- end}} {{.GoComment}}
+{{end -}}
+{{range .Relationships}}{{.FieldName}} *{{if .ToMany}}{{.RefCollection}}{{else}}{{.RefEntity}}{{end}} // loaded by {{$.Collection}}.Load{{.FieldName}}
 {{end}} }
 
 // New{{.Entity}} creates a new pointer with pre-initialized fields. Auto
@@ -15,7 +17,9 @@ func New{{.Entity}}() *{{.Entity}} {
 // AssignLastInsertID updates the increment ID field with the last inserted ID
 // from an INSERT operation. Implements dml.InsertIDAssigner. Auto generated.
 func (e *{{.Entity}}) AssignLastInsertID(id int64) {
-	{{range .Columns}}{{if .IsPK}} e.{{ToGoCamelCase .Field}} = {{GoTypeNull .}}(id) {{end}} {{end}}
+	{{- range .Columns}}{{if .IsAutoIncrement}}
+	e.{{ToGoCamelCase .Field}} = {{GoTypeNull .}}(id)
+	{{- end}}{{end}}
 }
 
 // MapColumns implements interface ColumnMapper only partially. Auto generated.
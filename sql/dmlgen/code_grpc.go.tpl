@@ -0,0 +1,94 @@
+{{- $pks := .Columns.PrimaryKeys -}}
+{{- if $pks}}
+// {{.Entity}}PrimaryKey identifies a row of table `{{.TableName}}` in the
+// GRPC service {{.Entity}}Service. Auto generated.
+type {{.Entity}}PrimaryKey struct {
+	{{- range $pks}}
+	{{ToGoCamelCase .Field}} {{GoTypeNull .}}
+	{{- end}}
+}
+{{- end}}
+
+// {{.Entity}}RowsAffected returns the number of affected rows of a write
+// operation in the GRPC service {{.Entity}}Service. Auto generated.
+type {{.Entity}}RowsAffected struct {
+	RowsAffected int64
+}
+
+// {{.Entity}}Server implements the GRPC service {{.Entity}}Service, defined
+// in the generated .proto file, with the {{.Entity}}Repository. The entities get
+// validated before any write and a failed validation returns the status code
+// InvalidArgument with the field violations. All other errors get converted
+// with cspb.NewStatusError. Auto generated.
+type {{.Entity}}Server struct {
+	Repository *{{.Entity}}Repository
+}
+
+// New{{.Entity}}Server creates a new server for the GRPC service
+// {{.Entity}}Service. Auto generated.
+func New{{.Entity}}Server(r *{{.Entity}}Repository) *{{.Entity}}Server {
+	return &{{.Entity}}Server{Repository: r}
+}
+
+func (s *{{.Entity}}Server) validate(e *{{.Entity}}) error {
+	if fv := e.fieldViolations(); len(fv) > 0 {
+		return cspb.NewStatusBadRequestError(codes.InvalidArgument, "[{{.Package}}] {{.Entity}} validation failed", fv...)
+	}
+	return nil
+}
+
+func (s *{{.Entity}}Server) rowsAffected(res sql.Result, err error) (*{{.Entity}}RowsAffected, error) {
+	if err != nil {
+		return nil, cspb.NewStatusError(err)
+	}
+	ra, err := res.RowsAffected()
+	if err != nil {
+		return nil, cspb.NewStatusError(err)
+	}
+	return &{{.Entity}}RowsAffected{RowsAffected: ra}, nil
+}
+
+// Insert validates and inserts the entity and returns it with the assigned
+// auto increment value. Auto generated.
+func (s *{{.Entity}}Server) Insert(ctx context.Context, e *{{.Entity}}) (*{{.Entity}}, error) {
+	if err := s.validate(e); err != nil {
+		return nil, err
+	}
+	if _, err := s.Repository.Insert(ctx, e); err != nil {
+		return nil, cspb.NewStatusError(err)
+	}
+	return e, nil
+}
+
+// Upsert validates and inserts or updates the entity. Auto generated.
+func (s *{{.Entity}}Server) Upsert(ctx context.Context, e *{{.Entity}}) (*{{.Entity}}RowsAffected, error) {
+	if err := s.validate(e); err != nil {
+		return nil, err
+	}
+	return s.rowsAffected(s.Repository.Upsert(ctx, e))
+}
+{{- if $pks}}
+
+// LoadByPK loads the entity identified by its primary key. Auto generated.
+func (s *{{.Entity}}Server) LoadByPK(ctx context.Context, pk *{{.Entity}}PrimaryKey) (*{{.Entity}}, error) {
+	e, err := s.Repository.LoadByPK(ctx{{range $pks}}, pk.{{ToGoCamelCase .Field}}{{end}})
+	if err != nil {
+		return nil, cspb.NewStatusError(err)
+	}
+	return e, nil
+}
+
+// UpdateByPK validates and updates the entity identified by its primary key.
+// Auto generated.
+func (s *{{.Entity}}Server) UpdateByPK(ctx context.Context, e *{{.Entity}}) (*{{.Entity}}RowsAffected, error) {
+	if err := s.validate(e); err != nil {
+		return nil, err
+	}
+	return s.rowsAffected(s.Repository.UpdateByPK(ctx, e))
+}
+
+// DeleteByPK deletes the entity identified by its primary key. Auto generated.
+func (s *{{.Entity}}Server) DeleteByPK(ctx context.Context, pk *{{.Entity}}PrimaryKey) (*{{.Entity}}RowsAffected, error) {
+	return s.rowsAffected(s.Repository.DeleteByPK(ctx{{range $pks}}, pk.{{ToGoCamelCase .Field}}{{end}}))
+}
+{{- end}}
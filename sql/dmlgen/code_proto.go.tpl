@@ -9,3 +9,31 @@ message {{.Entity}} {
 message {{.Collection}} {
 	repeated {{.Entity}} Data = 1;
 }
+{{- if .GRPC}}
+{{- $pks := .Columns.PrimaryKeys}}
+{{- if $pks}}
+
+// {{.Entity}}PrimaryKey identifies a row of table `{{.TableName}}`. Auto generated.
+message {{.Entity}}PrimaryKey {
+	{{- range $pks}}
+	{{ProtoType .}} {{.Field}} = {{.Pos}} [(gogoproto.customname)="{{ToGoCamelCase .Field}}" {{- ProtoCustomType .}}];
+	{{- end}}
+}
+{{- end}}
+
+// {{.Entity}}RowsAffected returns the number of affected rows of a write operation. Auto generated.
+message {{.Entity}}RowsAffected {
+	int64 rows_affected = 1 [(gogoproto.customname)="RowsAffected"];
+}
+
+// {{.Entity}}Service provides the CRUD operations for table `{{.TableName}}`. Auto generated.
+service {{.Entity}}Service {
+	rpc Insert({{.Entity}}) returns ({{.Entity}});
+	rpc Upsert({{.Entity}}) returns ({{.Entity}}RowsAffected);
+	{{- if $pks}}
+	rpc LoadByPK({{.Entity}}PrimaryKey) returns ({{.Entity}});
+	rpc UpdateByPK({{.Entity}}) returns ({{.Entity}}RowsAffected);
+	rpc DeleteByPK({{.Entity}}PrimaryKey) returns ({{.Entity}}RowsAffected);
+	{{- end}}
+}
+{{- end}}
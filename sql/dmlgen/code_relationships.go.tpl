@@ -0,0 +1,93 @@
+{{- range .Relationships}}
+{{- if .ToMany}}
+
+// Load{{.FieldName}} loads with a single query all rows of table
+// `{{.RefTable}}` referencing the entities of the collection via column
+// `{{.RefColumn.Field}}`, assigns them to field {{.FieldName}} of each entity and
+// returns all loaded rows. Auto generated.
+func (cc *{{$.Collection}}) Load{{.FieldName}}(ctx context.Context, db dml.QueryExecPreparer) ({{.RefCollection}}, error) {
+	refs := Make{{.RefCollection}}()
+	keys := make([]{{GoType .Column}}, 0, len(cc.Data))
+	byKey := make(map[{{GoType .Column}}][]*{{$.Entity}}, len(cc.Data))
+	for _, e := range cc.Data {
+		e.{{.FieldName}} = &{{.RefCollection}}{}
+		{{- if .Column.IsNull}}
+		if !e.{{ToGoCamelCase .Column.Field}}.Valid {
+			continue
+		}
+		{{- end}}
+		k := {{GoType .Column}}(e.{{GoPrimitive .Column}})
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], e)
+	}
+	if len(keys) == 0 {
+		return refs, nil
+	}
+	_, err := dml.NewSelect(
+		{{- range .RefColumns}}"{{.Field}}",{{end -}}
+	).From("{{.RefTable}}").Where(dml.Column("{{.RefColumn.Field}}").In().PlaceHolder()).WithDB(db).WithArgs().
+		ExpandPlaceHolders().{{GoArgsFunc .Column}}(keys...).Load(ctx, &refs)
+	if err != nil {
+		return refs, errors.WithStack(err)
+	}
+	for _, r := range refs.Data {
+		{{- if .RefColumn.IsNull}}
+		if !r.{{ToGoCamelCase .RefColumn.Field}}.Valid {
+			continue
+		}
+		{{- end}}
+		for _, e := range byKey[{{GoType .Column}}(r.{{GoPrimitive .RefColumn}})] {
+			e.{{.FieldName}}.Data = append(e.{{.FieldName}}.Data, r)
+		}
+	}
+	return refs, nil
+}
+{{- else}}
+
+// Load{{.FieldName}} loads with a single query all rows of table
+// `{{.RefTable}}` referenced by column `{{.Column.Field}}` of the entities of the
+// collection, assigns them to field {{.FieldName}} of each entity and returns
+// all loaded rows. Auto generated.
+func (cc *{{$.Collection}}) Load{{.FieldName}}(ctx context.Context, db dml.QueryExecPreparer) ({{.RefCollection}}, error) {
+	refs := Make{{.RefCollection}}()
+	keys := make([]{{GoType .RefColumn}}, 0, len(cc.Data))
+	byKey := make(map[{{GoType .RefColumn}}][]*{{$.Entity}}, len(cc.Data))
+	for _, e := range cc.Data {
+		e.{{.FieldName}} = nil
+		{{- if .Column.IsNull}}
+		if !e.{{ToGoCamelCase .Column.Field}}.Valid {
+			continue
+		}
+		{{- end}}
+		k := {{GoType .RefColumn}}(e.{{GoPrimitive .Column}})
+		if _, ok := byKey[k]; !ok {
+			keys = append(keys, k)
+		}
+		byKey[k] = append(byKey[k], e)
+	}
+	if len(keys) == 0 {
+		return refs, nil
+	}
+	_, err := dml.NewSelect(
+		{{- range .RefColumns}}"{{.Field}}",{{end -}}
+	).From("{{.RefTable}}").Where(dml.Column("{{.RefColumn.Field}}").In().PlaceHolder()).WithDB(db).WithArgs().
+		ExpandPlaceHolders().{{GoArgsFunc .RefColumn}}(keys...).Load(ctx, &refs)
+	if err != nil {
+		return refs, errors.WithStack(err)
+	}
+	for _, r := range refs.Data {
+		{{- if .RefColumn.IsNull}}
+		if !r.{{ToGoCamelCase .RefColumn.Field}}.Valid {
+			continue
+		}
+		{{- end}}
+		for _, e := range byKey[{{GoType .RefColumn}}(r.{{GoPrimitive .RefColumn}})] {
+			e.{{.FieldName}} = r
+		}
+	}
+	return refs, nil
+}
+{{- end}}
+{{- end}}
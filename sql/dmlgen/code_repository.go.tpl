@@ -0,0 +1,233 @@
+{{- $pks := .Columns.PrimaryKeys -}}
+// {{.Entity}}Repository loads and stores the entities of table
+// `{{.TableName}}`. The statements run on the DB of the ddl.Table or within the
+// transaction set by WithTx. Auto generated.
+type {{.Entity}}Repository struct {
+	Table *ddl.Table
+	tx    *dml.Tx
+}
+
+// New{{.Entity}}Repository creates a new repository for table
+// `{{.TableName}}`, which must be available in argument tbls. Auto generated.
+func New{{.Entity}}Repository(tbls *ddl.Tables) (*{{.Entity}}Repository, error) {
+	t, err := tbls.Table("{{.TableName}}")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &{{.Entity}}Repository{Table: t}, nil
+}
+
+// WithTx returns a new repository which runs all statements within the
+// transaction. Auto generated.
+func (r *{{.Entity}}Repository) WithTx(tx *dml.Tx) *{{.Entity}}Repository {
+	return &{{.Entity}}Repository{Table: r.Table, tx: tx}
+}
+
+func (r *{{.Entity}}Repository) db() dml.QueryExecPreparer {
+	if r.tx != nil {
+		return r.tx.DB
+	}
+	return r.Table.DB
+}
+
+func (r *{{.Entity}}Repository) insert() *dml.Insert {
+	i := dml.NewInsert(r.Table.Name).AddColumns(
+		{{- range .Columns}}{{if not .IsAutoIncrement}}"{{.Field}}",{{end}}{{end -}}
+	)
+	i.Listeners = i.Listeners.Merge(r.Table.Listeners.Insert)
+	return i.WithDB(r.db())
+}
+
+func (r *{{.Entity}}Repository) upsert() *dml.Insert {
+	i := dml.NewInsert(r.Table.Name).AddColumns(
+		{{- range .Columns}}"{{.Field}}",{{end -}}
+	).OnDuplicateKey(){{if $pks}}.AddOnDuplicateKeyExclude(
+		{{- range $pks}}"{{.Field}}",{{end -}}
+	){{end}}
+	i.Listeners = i.Listeners.Merge(r.Table.Listeners.Insert)
+	return i.WithDB(r.db())
+}
+
+// Insert inserts a new row and assigns the auto increment value to the entity.
+// Auto generated.
+func (r *{{.Entity}}Repository) Insert(ctx context.Context, e *{{.Entity}}) (sql.Result, error) {
+	{{- if .Validation}}
+	if err := e.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	{{- end}}
+	res, err := r.insert().WithArgs().Record("", e).ExecContext(ctx)
+	return res, errors.WithStack(err)
+}
+
+// InsertCollection inserts all entities of the collection with as few
+// statements as possible and assigns the auto increment values. Auto
+// generated.
+func (r *{{.Entity}}Repository) InsertCollection(ctx context.Context, cc *{{.Collection}}) ([]dml.BatchResult, error) {
+	return r.execBatch(ctx, r.insert(), cc)
+}
+
+// Upsert inserts a new row or updates all non primary key columns of the
+// existing row. Auto generated.
+func (r *{{.Entity}}Repository) Upsert(ctx context.Context, e *{{.Entity}}) (sql.Result, error) {
+	{{- if .Validation}}
+	if err := e.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	{{- end}}
+	res, err := r.upsert().WithArgs().Record("", e).ExecContext(ctx)
+	return res, errors.WithStack(err)
+}
+
+// UpsertCollection inserts or updates all entities of the collection with as
+// few statements as possible. Auto generated.
+func (r *{{.Entity}}Repository) UpsertCollection(ctx context.Context, cc *{{.Collection}}) ([]dml.BatchResult, error) {
+	return r.execBatch(ctx, r.upsert(), cc)
+}
+
+func (r *{{.Entity}}Repository) execBatch(ctx context.Context, ins *dml.Insert, cc *{{.Collection}}) ([]dml.BatchResult, error) {
+	{{- if .Validation}}
+	if err := cc.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	{{- end}}
+	recs := make([]dml.ColumnMapper, len(cc.Data))
+	for i, e := range cc.Data {
+		recs[i] = e
+	}
+	res, err := dml.NewBatchInsert(ins).ExecRecords(ctx, recs...)
+	return res, errors.WithStack(err)
+}
+{{- if $pks}}
+
+func (r *{{.Entity}}Repository) wherePK() dml.Conditions {
+	return dml.Conditions{
+		{{- range $pks}}
+		dml.Column("{{.Field}}").PlaceHolder(),
+		{{- end}}
+	}
+}
+
+// LoadByPK loads the entity identified by its primary key. Returns a NotFound
+// error if the row does not exist. Auto generated.
+func (r *{{.Entity}}Repository) LoadByPK(ctx context.Context{{range $pks}}, {{GoParamName .}} {{GoTypeNull .}}{{end}}) (*{{.Entity}}, error) {
+	e := New{{.Entity}}()
+	rowCount, err := r.Table.SelectAll().WithDB(r.db()).Where(r.wherePK()...).WithArgs().
+		{{- range $pks}}{{GoArgFuncNull .}}({{GoParamName .}}).{{end}}Load(ctx, e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if rowCount == 0 {
+		return nil, errors.NotFound.Newf("[{{.Package}}] {{.Entity}} not found with primary key{{range $pks}} %v{{end}}"{{range $pks}}, {{GoParamName .}}{{end}})
+	}
+	return e, nil
+}
+
+// UpdateByPK updates all non primary key columns of the row identified by the
+// primary key of the entity. Auto generated.
+func (r *{{.Entity}}Repository) UpdateByPK(ctx context.Context, e *{{.Entity}}) (sql.Result, error) {
+	{{- if .Validation}}
+	if err := e.Validate(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	{{- end}}
+	res, err := r.update().WithArgs().Record("", e).ExecContext(ctx)
+	return res, errors.WithStack(err)
+}
+
+// UpdateCollectionByPK updates all entities of the collection with a
+// prepared statement and returns the number of affected rows. Auto generated.
+func (r *{{.Entity}}Repository) UpdateCollectionByPK(ctx context.Context, cc *{{.Collection}}) (rowsAffected int64, err error) {
+	{{- if .Validation}}
+	if err := cc.Validate(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	{{- end}}
+	stmt, err := r.update().Prepare(ctx)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer func() {
+		if errC := stmt.Close(); errC != nil && err == nil {
+			err = errors.WithStack(errC)
+		}
+	}()
+	for _, e := range cc.Data {
+		res, err := stmt.WithArgs().Record("", e).ExecContext(ctx)
+		if err != nil {
+			return rowsAffected, errors.WithStack(err)
+		}
+		ra, err := res.RowsAffected()
+		if err != nil {
+			return rowsAffected, errors.WithStack(err)
+		}
+		rowsAffected += ra
+	}
+	return rowsAffected, nil
+}
+
+func (r *{{.Entity}}Repository) update() *dml.Update {
+	u := dml.NewUpdate(r.Table.Name).AddColumns(
+		{{- range .Columns}}{{if not .IsPK}}"{{.Field}}",{{end}}{{end -}}
+	).Where(r.wherePK()...)
+	u.Listeners = u.Listeners.Merge(r.Table.Listeners.Update)
+	return u.WithDB(r.db())
+}
+
+// DeleteByPK deletes the row identified by its primary key. Auto generated.
+func (r *{{.Entity}}Repository) DeleteByPK(ctx context.Context{{range $pks}}, {{GoParamName .}} {{GoTypeNull .}}{{end}}) (sql.Result, error) {
+	res, err := r.delete(r.wherePK()...).WithArgs().
+		{{- range $pks}}{{GoArgFuncNull .}}({{GoParamName .}}).{{end}}ExecContext(ctx)
+	return res, errors.WithStack(err)
+}
+
+func (r *{{.Entity}}Repository) delete(wf ...*dml.Condition) *dml.Delete {
+	d := dml.NewDelete(r.Table.Name).Where(wf...)
+	d.Listeners = d.Listeners.Merge(r.Table.Listeners.Delete)
+	return d.WithDB(r.db())
+}
+{{- end}}
+{{- if eq (len $pks) 1}}{{with index $pks 0}}{{if GoArgsFuncNull .}}
+
+// LoadByPKs loads all entities identified by the primary keys into a new
+// collection. Auto generated.
+func (r *{{$.Entity}}Repository) LoadByPKs(ctx context.Context, {{GoParamName .}}s ...{{GoTypeNull .}}) ({{$.Collection}}, error) {
+	cc := Make{{$.Collection}}()
+	if len({{GoParamName .}}s) == 0 {
+		return cc, nil
+	}
+	_, err := r.Table.SelectAll().WithDB(r.db()).Where(dml.Column("{{.Field}}").In().PlaceHolder()).WithArgs().
+		ExpandPlaceHolders().{{GoArgsFuncNull .}}({{GoParamName .}}s...).Load(ctx, &cc)
+	return cc, errors.WithStack(err)
+}
+
+// DeleteCollectionByPK deletes all rows identified by the primary keys of the
+// entities in the collection. An empty collection returns a nil result. Auto
+// generated.
+func (r *{{$.Entity}}Repository) DeleteCollectionByPK(ctx context.Context, cc *{{$.Collection}}) (sql.Result, error) {
+	if len(cc.Data) == 0 {
+		return nil, nil
+	}
+	res, err := r.delete(dml.Column("{{.Field}}").In().PlaceHolder()).WithArgs().
+		ExpandPlaceHolders().{{GoArgsFuncNull .}}(cc.{{ToGoCamelCase .Field}}s()...).ExecContext(ctx)
+	return res, errors.WithStack(err)
+}
+{{- end}}{{end}}{{end}}
+{{- range .Columns.UniqueColumns}}{{if not .IsPK}}
+
+// LoadByUniqueKey loads the entity identified by the unique key column
+// `{{.Field}}`. Returns a NotFound error if the row does not exist. Auto
+// generated.
+func (r *{{$.Entity}}Repository) LoadByUniqueKey(ctx context.Context, {{GoParamName .}} {{GoTypeNull .}}) (*{{$.Entity}}, error) {
+	e := New{{$.Entity}}()
+	rowCount, err := r.Table.SelectAll().WithDB(r.db()).Where(dml.Column("{{.Field}}").PlaceHolder()).WithArgs().
+		{{GoArgFuncNull .}}({{GoParamName .}}).Load(ctx, e)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if rowCount == 0 {
+		return nil, errors.NotFound.Newf("[{{$.Package}}] {{$.Entity}} not found with unique key %v", {{GoParamName .}})
+	}
+	return e, nil
+}
+{{- end}}{{end}}
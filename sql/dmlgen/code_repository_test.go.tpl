@@ -0,0 +1,183 @@
+{{- $pks := .Columns.PrimaryKeys -}}
+// new{{.Entity}}Fixture creates an entity whose required columns contain
+// valid values.
+func new{{.Entity}}Fixture() *{{.Entity}} {
+	e := New{{.Entity}}()
+	{{- range .Columns}}{{with GoFixture .}}
+	{{.}}
+	{{- end}}{{end}}
+	return e
+}
+
+func Test{{.Entity}}Repository(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	tbls, err := NewTables(ddl.WithDB(dbc.DB))
+	require.NoError(t, err)
+	r, err := New{{.Entity}}Repository(tbls)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	t.Run("Insert", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `{{.TableName}}`")).
+			WillReturnResult(sqlmock.NewResult(11, 1))
+
+		e := new{{.Entity}}Fixture()
+		res, err := r.Insert(ctx, e)
+		require.NoError(t, err)
+		rowsAffected, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Exactly(t, int64(1), rowsAffected)
+		{{- range .Columns}}{{if .IsAutoIncrement}}
+		assert.Exactly(t, {{GoTypeNull .}}(11), e.{{ToGoCamelCase .Field}})
+		{{- end}}{{end}}
+	})
+
+	t.Run("InsertCollection", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `{{.TableName}}`")).
+			WillReturnResult(sqlmock.NewResult(20, 2))
+
+		cc := Make{{.Collection}}()
+		cc.Data = append(cc.Data, new{{.Entity}}Fixture(), new{{.Entity}}Fixture())
+		results, err := r.InsertCollection(ctx, &cc)
+		require.NoError(t, err)
+		assert.Len(t, results, 1)
+		{{- range .Columns}}{{if .IsAutoIncrement}}
+		assert.Exactly(t, {{GoTypeNull .}}(21), cc.Data[1].{{ToGoCamelCase .Field}})
+		{{- end}}{{end}}
+	})
+
+	t.Run("Upsert", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `{{.TableName}}`") + ".+ON DUPLICATE KEY UPDATE").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		_, err := r.Upsert(ctx, new{{.Entity}}Fixture())
+		require.NoError(t, err)
+	})
+
+	t.Run("UpsertCollection", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `{{.TableName}}`") + ".+ON DUPLICATE KEY UPDATE").
+			WillReturnResult(sqlmock.NewResult(0, 4))
+
+		cc := Make{{.Collection}}()
+		cc.Data = append(cc.Data, new{{.Entity}}Fixture(), new{{.Entity}}Fixture())
+		results, err := r.UpsertCollection(ctx, &cc)
+		require.NoError(t, err)
+		assert.Len(t, results, 1)
+	})
+	{{- if $pks}}
+
+	t.Run("LoadByPK not found", func(t *testing.T) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT") + ".+" + dmltest.SQLMockQuoteMeta("FROM `{{.TableName}}`")).
+			WillReturnRows(sqlmock.NewRows([]string{ {{- range .Columns}}"{{.Field}}",{{end -}} }))
+
+		{{range $pks}}var {{GoParamName .}} {{GoTypeNull .}}
+		{{end -}}
+		e, err := r.LoadByPK(ctx{{range $pks}}, {{GoParamName .}}{{end}})
+		assert.Nil(t, e)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+
+	t.Run("UpdateByPK", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UPDATE `{{.TableName}}` SET")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		res, err := r.UpdateByPK(ctx, new{{.Entity}}Fixture())
+		require.NoError(t, err)
+		rowsAffected, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Exactly(t, int64(1), rowsAffected)
+	})
+
+	t.Run("UpdateCollectionByPK", func(t *testing.T) {
+		prep := dbMock.ExpectPrepare(dmltest.SQLMockQuoteMeta("UPDATE `{{.TableName}}` SET"))
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+		prep.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 1))
+
+		cc := Make{{.Collection}}()
+		cc.Data = append(cc.Data, new{{.Entity}}Fixture(), new{{.Entity}}Fixture())
+		rowsAffected, err := r.UpdateCollectionByPK(ctx, &cc)
+		require.NoError(t, err)
+		assert.Exactly(t, int64(2), rowsAffected)
+	})
+
+	t.Run("DeleteByPK", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `{{.TableName}}`")).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		{{range $pks}}var {{GoParamName .}} {{GoTypeNull .}}
+		{{end -}}
+		res, err := r.DeleteByPK(ctx{{range $pks}}, {{GoParamName .}}{{end}})
+		require.NoError(t, err)
+		rowsAffected, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Exactly(t, int64(1), rowsAffected)
+	})
+	{{- end}}
+	{{- if eq (len $pks) 1}}{{with index $pks 0}}{{if GoArgsFuncNull .}}
+
+	t.Run("LoadByPKs", func(t *testing.T) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT") + ".+" + dmltest.SQLMockQuoteMeta("FROM `{{$.TableName}}`")).
+			WillReturnRows(sqlmock.NewRows([]string{ {{- range $.Columns}}"{{.Field}}",{{end -}} }))
+
+		var {{GoParamName .}} {{GoTypeNull .}}
+		cc, err := r.LoadByPKs(ctx, {{GoParamName .}}, {{GoParamName .}})
+		require.NoError(t, err)
+		assert.Len(t, cc.Data, 0)
+	})
+
+	t.Run("DeleteCollectionByPK", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `{{$.TableName}}`")).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+
+		cc := Make{{$.Collection}}()
+		cc.Data = append(cc.Data, new{{$.Entity}}Fixture(), new{{$.Entity}}Fixture())
+		res, err := r.DeleteCollectionByPK(ctx, &cc)
+		require.NoError(t, err)
+		rowsAffected, err := res.RowsAffected()
+		require.NoError(t, err)
+		assert.Exactly(t, int64(2), rowsAffected)
+	})
+	{{- end}}{{end}}{{end}}
+	{{- range .Columns.UniqueColumns}}{{if not .IsPK}}
+
+	t.Run("LoadByUniqueKey not found", func(t *testing.T) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT") + ".+" + dmltest.SQLMockQuoteMeta("FROM `{{$.TableName}}`")).
+			WillReturnRows(sqlmock.NewRows([]string{ {{- range $.Columns}}"{{.Field}}",{{end -}} }))
+
+		var {{GoParamName .}} {{GoTypeNull .}}
+		e, err := r.LoadByUniqueKey(ctx, {{GoParamName .}})
+		assert.Nil(t, e)
+		assert.True(t, errors.NotFound.Match(err), "%+v", err)
+	})
+	{{- end}}{{end}}
+	{{- if .Validation}}
+
+	t.Run("Validate", func(t *testing.T) {
+		assert.NoError(t, new{{.Entity}}Fixture().Validate())
+	})
+	{{- end}}
+	{{- if .GRPC}}
+
+	t.Run("Server Insert", func(t *testing.T) {
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `{{.TableName}}`")).
+			WillReturnResult(sqlmock.NewResult(12, 1))
+
+		e, err := New{{.Entity}}Server(r).Insert(ctx, new{{.Entity}}Fixture())
+		require.NoError(t, err)
+		assert.NotNil(t, e)
+	})
+	{{- if $pks}}
+
+	t.Run("Server LoadByPK not found", func(t *testing.T) {
+		dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT") + ".+" + dmltest.SQLMockQuoteMeta("FROM `{{.TableName}}`")).
+			WillReturnRows(sqlmock.NewRows([]string{ {{- range .Columns}}"{{.Field}}",{{end -}} }))
+
+		e, err := New{{.Entity}}Server(r).LoadByPK(ctx, &{{.Entity}}PrimaryKey{})
+		assert.Nil(t, e)
+		assert.Exactly(t, codes.NotFound, status.Code(err), "%+v", err)
+	})
+	{{- end}}
+	{{- end}}
+}
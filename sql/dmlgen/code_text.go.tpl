@@ -1,6 +1,6 @@
 // UnmarshalJSON implements interface json.Unmarshaler.
 func (cc *{{$.Collection}}) UnmarshalJSON(b []byte) (err error) {
-	return json.Unmarshal(b, cc.Data)
+	return json.Unmarshal(b, &cc.Data)
 }
 
 // MarshalJSON implements interface json.Marshaler.
@@ -0,0 +1,45 @@
+
+// fieldViolations checks the field values against the column definitions of
+// table `{{.TableName}}`. Returns a balanced slice of column names and their
+// violation descriptions. Auto generated.
+func (e *{{.Entity}}) fieldViolations() (fv []string) {
+	{{- range .Columns}}{{$field := .Field}}{{range GoValidations .}}
+	if {{.Cond}} {
+		fv = append(fv, "{{$field}}", "{{.Message}}")
+	}
+	{{- end}}{{end}}
+	return fv
+}
+
+// Validate checks the field values against the column definitions of table
+// `{{.TableName}}` and returns a NotValid error listing all violations. Auto
+// generated.
+func (e *{{.Entity}}) Validate() error {
+	if fv := e.fieldViolations(); len(fv) > 0 {
+		return errors.NotValid.Newf("[{{.Package}}] {{.Entity}} validation failed: %q", fv)
+	}
+	return nil
+}
+
+// Validate validates all entities of the collection and returns the first
+// error. Auto generated.
+func (cc *{{.Collection}}) Validate() error {
+	for i, e := range cc.Data {
+		if err := e.Validate(); err != nil {
+			return errors.Wrapf(err, "[{{.Package}}] {{.Collection}} at index %d", i)
+		}
+	}
+	return nil
+}
+{{- if .TextMarshaler}}
+
+// UnmarshalJSON implements interface json.Unmarshaler and validates the
+// decoded entity. Auto generated.
+func (e *{{.Entity}}) UnmarshalJSON(b []byte) error {
+	type entity {{.Entity}} // without methods to avoid the recursion
+	if err := json.Unmarshal(b, (*entity)(e)); err != nil {
+		return errors.WithStack(err)
+	}
+	return e.Validate()
+}
+{{- end}}
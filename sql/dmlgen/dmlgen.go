@@ -101,7 +101,26 @@ type TableOption struct {
 	// but should have a dedicated function to extract their unique primitive
 	// values as a slice.
 	UniquifiedColumns []string
-	lastErr           error
+	// Repository generates a repository type for the table which loads,
+	// inserts, upserts, updates and deletes entities and collections. The
+	// repository requires the generated function NewTables, hence the
+	// field DisableTableSchemas of type Tables must be false. Use
+	// Tables.WriteGoTest to generate the tests for the repositories.
+	Repository bool
+	// Validation generates the method Validate for the entity and its
+	// collection. The checks derive from the column definitions: NOT NULL
+	// columns without default value must not be empty, strings must not
+	// exceed the maximum character length and integers must fit into the
+	// range of the MySQL type. The repository validates before each write and
+	// the JSON decoding validates each entity, if the text encoder has been
+	// enabled.
+	Validation bool
+	// GRPC writes a CRUD service into the .proto file and a server type which
+	// implements the service with the repository and returns the errors as
+	// GRPC status codes. GRPC enables the protobuf encoder and the validation
+	// and requires the option Repository.
+	GRPC    bool
+	lastErr error
 }
 
 func (to *TableOption) applyEncoders(ts *Tables, t *table) {
@@ -230,6 +249,31 @@ func (to *TableOption) applyColumnAliases(t *table) {
 	}
 }
 
+func (to *TableOption) applyRepository(t *table) {
+	if to.Repository {
+		t.Repository = true
+	}
+}
+
+func (to *TableOption) applyValidation(t *table) {
+	if to.Validation || to.GRPC {
+		t.Validation = true
+	}
+}
+
+func (to *TableOption) applyGRPC(ts *Tables, t *table) {
+	if !to.GRPC || to.lastErr != nil {
+		return
+	}
+	if !t.Repository {
+		to.lastErr = errors.NotAcceptable.Newf("[dmlgen] WithTableOption: Table %q option GRPC requires option Repository.", t.TableName)
+		return
+	}
+	ts.writeProto = true
+	t.Protobuf = true
+	t.GRPC = true
+}
+
 func (to *TableOption) applyUniquifiedColumns(t *table) {
 	for i := 0; i < len(to.UniquifiedColumns) && to.lastErr == nil; i++ {
 		cn := to.UniquifiedColumns[i]
@@ -266,6 +310,9 @@ func WithTableOption(tableName string, opt *TableOption) (o Option) {
 		opt.applyComments(t)
 		opt.applyColumnAliases(t)
 		opt.applyUniquifiedColumns(t)
+		opt.applyRepository(t)
+		opt.applyValidation(t)
+		opt.applyGRPC(ts, t)
 		return opt.lastErr
 	}
 	return
@@ -362,12 +409,17 @@ func NewTables(packageName string, opts ...Option) (*Tables, error) {
 		Tables:  make(map[string]*table),
 		Package: packageName,
 		ImportPaths: []string{
+			"context",
 			"database/sql",
 			"encoding/json",
 			"github.com/corestoreio/pkg/sql/dml",
 			"github.com/corestoreio/pkg/sql/ddl",
+			"github.com/corestoreio/pkg/storage/null",
 			"github.com/corestoreio/errors",
+			"github.com/corestoreio/pkg/net/cspb",
+			"google.golang.org/grpc/codes",
 			"time",
+			"unicode/utf8",
 		},
 		FuncMap: make(template.FuncMap, 10),
 	}
@@ -377,6 +429,12 @@ func NewTables(packageName string, opts ...Option) (*Tables, error) {
 	ts.FuncMap["GoFuncNull"] = toGoFuncNull
 	ts.FuncMap["GoFunc"] = toGoFunc
 	ts.FuncMap["GoPrimitive"] = toGoPrimitive
+	ts.FuncMap["GoArgFuncNull"] = toGoArgFuncNull
+	ts.FuncMap["GoArgsFuncNull"] = toGoArgsFuncNull
+	ts.FuncMap["GoArgsFunc"] = toGoArgsFunc
+	ts.FuncMap["GoParamName"] = toGoParamName
+	ts.FuncMap["GoValidations"] = toGoValidations
+	ts.FuncMap["GoFixture"] = toGoFixture
 	ts.FuncMap["ProtoType"] = toProtoType
 	ts.FuncMap["ProtoCustomType"] = toProtoCustomType
 
@@ -412,8 +470,9 @@ func NewTables(packageName string, opts ...Option) (*Tables, error) {
 	return ts, nil
 }
 
-// findUsedPackages checks for needed packages which we must import.
-func (ts *Tables) findUsedPackages(file []byte) ([]string, error) {
+// findUsedPackages checks for needed packages which we must import. A prefix
+// "go-" of the last path element gets ignored.
+func findUsedPackages(file []byte, importPaths []string) ([]string, error) {
 
 	af, err := parser.ParseFile(token.NewFileSet(), "virtual_file.go", append([]byte("package temporarily_main\n\n"), file...), 0)
 	if err != nil {
@@ -429,9 +488,10 @@ func (ts *Tables) findUsedPackages(file []byte) ([]string, error) {
 		return true
 	})
 
-	ret := make([]string, 0, len(ts.ImportPaths))
-	for _, path := range ts.ImportPaths {
+	ret := make([]string, 0, len(importPaths))
+	for _, path := range importPaths {
 		_, pkg := filepath.Split(path)
+		pkg = strings.TrimPrefix(pkg, "go-")
 		if _, ok := idents[pkg]; ok {
 			ret = append(ret, path)
 		}
@@ -511,6 +571,18 @@ func (ts *Tables) WriteGo(w io.Writer) error {
 		if t.BinaryMarshaler {
 			ts.execTpl(buf, t, "code_binary.go.tpl")
 		}
+		if t.Validation {
+			ts.execTpl(buf, t, "code_validation.go.tpl")
+		}
+		if t.Repository {
+			ts.execTpl(buf, t, "code_repository.go.tpl")
+		}
+		if t.GRPC {
+			ts.execTpl(buf, t, "code_grpc.go.tpl")
+		}
+		if len(t.Relationships) > 0 {
+			ts.execTpl(buf, t, "code_relationships.go.tpl")
+		}
 		if ts.lastError != nil {
 			return ts.lastError
 		}
@@ -519,7 +591,7 @@ func (ts *Tables) WriteGo(w io.Writer) error {
 	if !ts.DisableFileHeader {
 		// now figure out all used package names in the buffer.
 		fmt.Fprintf(w, "// Auto generated via github.com/corestoreio/pkg/sql/dmlgen\n\npackage %s\n\nimport (\n", ts.Package)
-		pkgs, err := ts.findUsedPackages(buf.Bytes())
+		pkgs, err := findUsedPackages(buf.Bytes(), ts.ImportPaths)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -539,6 +611,58 @@ func (ts *Tables) WriteGo(w io.Writer) error {
 	return err
 }
 
+// WriteGoTest writes the Go test source code for all tables with enabled
+// repository into `w`. The tests mock the database with package dmltest and
+// must be placed in the same package as the code generated by WriteGo.
+func (ts *Tables) WriteGoTest(w io.Writer) error {
+	buf := new(bytes.Buffer)
+	ts.tpls = ts.tpls.Funcs(ts.FuncMap)
+
+	for _, tblname := range ts.sortedTableNames() {
+		t := ts.Tables[tblname] // must panic if table name not found
+		if t.Repository {
+			ts.execTpl(buf, t, "code_repository_test.go.tpl")
+		}
+		if ts.lastError != nil {
+			return ts.lastError
+		}
+	}
+	if buf.Len() == 0 {
+		return errors.NotAcceptable.Newf("[dmlgen] Repository generation not enabled.")
+	}
+
+	if !ts.DisableFileHeader {
+		fmt.Fprintf(w, "// Auto generated via github.com/corestoreio/pkg/sql/dmlgen\n\npackage %s\n\nimport (\n", ts.Package)
+		pkgs, err := findUsedPackages(buf.Bytes(), []string{
+			"context",
+			"testing",
+			"github.com/DATA-DOG/go-sqlmock",
+			"github.com/corestoreio/errors",
+			"github.com/corestoreio/pkg/sql/ddl",
+			"github.com/corestoreio/pkg/sql/dmltest",
+			"github.com/stretchr/testify/assert",
+			"github.com/stretchr/testify/require",
+			"google.golang.org/grpc/codes",
+			"google.golang.org/grpc/status",
+			"time",
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, path := range pkgs {
+			fmt.Fprintf(w, "\t%q\n", path)
+		}
+		fmt.Fprint(w, "\n)\n")
+	}
+
+	fmted, err := format.Source(buf.Bytes())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = w.Write(fmted)
+	return err
+}
+
 // table writes one database table into Go source code.
 type table struct {
 	Package                  string      // Name of the package
@@ -549,6 +673,10 @@ type table struct {
 	BinaryMarshaler          bool
 	Protobuf                 bool // writes the .proto file if true
 	DisableCollectionMethods bool
+	Repository               bool            // writes the repository type if true
+	Validation               bool            // writes the Validate methods if true
+	GRPC                     bool            // writes the GRPC service and server if true
+	Relationships            []*relationship // foreign key fields and loaders
 }
 
 // WriteTo implements io.WriterTo and writes the generated source code into w.
@@ -584,7 +712,7 @@ func GenerateProto(path string) error {
 	// To generate PHP Code replace `gogo_out` with `php_out`.
 	// Java bit similar. Java has ~15k LOC, Go ~3.7k
 	args := []string{
-		"--gogo_out", "Mgoogle/protobuf/timestamp.proto=github.com/gogo/protobuf/types:.",
+		"--gogo_out", "plugins=grpc,Mgoogle/protobuf/timestamp.proto=github.com/gogo/protobuf/types:.",
 		"--proto_path", fmt.Sprintf("%s/src/:%s/src/github.com/gogo/protobuf/protobuf/:.", build.Default.GOPATH, build.Default.GOPATH),
 	}
 	args = append(args, protoFiles...)
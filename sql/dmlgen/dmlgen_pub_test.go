@@ -15,6 +15,7 @@
 package dmlgen_test
 
 import (
+	"bytes"
 	"context"
 	"io"
 	"os"
@@ -277,3 +278,185 @@ func TestWithUniquifiedColumns(t *testing.T) {
 		assert.True(t, errors.NotFound.Match(err), "%+v", err)
 	})
 }
+
+func TestWithRepository(t *testing.T) {
+	t.Parallel()
+
+	newTables := func(repository bool) (*dmlgen.Tables, error) {
+		return dmlgen.NewTables("customer",
+			dmlgen.WithTableOption("customer_entity", &dmlgen.TableOption{
+				Repository: repository,
+			}),
+			dmlgen.WithTable("customer_entity", ddl.Columns{
+				&ddl.Column{Field: "entity_id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+				&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Key: "UNI"},
+				&ddl.Column{Field: "firstname", Pos: 3, Null: "YES", DataType: "varchar", ColumnType: "varchar(255)"},
+			}),
+		)
+	}
+
+	t.Run("repository and tests", func(t *testing.T) {
+		ts, err := newTables(true)
+		require.NoError(t, err)
+
+		var goBuf, testBuf bytes.Buffer
+		require.NoError(t, ts.WriteGo(&goBuf))
+		require.NoError(t, ts.WriteGoTest(&testBuf))
+
+		for _, want := range []string{
+			"\t\"context\"\n",
+			"func NewCustomerEntityRepository(tbls *ddl.Tables) (*CustomerEntityRepository, error) {",
+			"func (r *CustomerEntityRepository) WithTx(tx *dml.Tx) *CustomerEntityRepository {",
+			"func (r *CustomerEntityRepository) Insert(ctx context.Context, e *CustomerEntity) (sql.Result, error) {",
+			"func (r *CustomerEntityRepository) InsertCollection(ctx context.Context, cc *CustomerEntityCollection) ([]dml.BatchResult, error) {",
+			"func (r *CustomerEntityRepository) Upsert(ctx context.Context, e *CustomerEntity) (sql.Result, error) {",
+			"func (r *CustomerEntityRepository) LoadByPK(ctx context.Context, entityID uint64) (*CustomerEntity, error) {",
+			"func (r *CustomerEntityRepository) LoadByPKs(ctx context.Context, entityIDs ...uint64) (CustomerEntityCollection, error) {",
+			"func (r *CustomerEntityRepository) LoadByUniqueKey(ctx context.Context, email string) (*CustomerEntity, error) {",
+			"func (r *CustomerEntityRepository) UpdateByPK(ctx context.Context, e *CustomerEntity) (sql.Result, error) {",
+			"func (r *CustomerEntityRepository) DeleteByPK(ctx context.Context, entityID uint64) (sql.Result, error) {",
+			"func (r *CustomerEntityRepository) DeleteCollectionByPK(ctx context.Context, cc *CustomerEntityCollection) (sql.Result, error) {",
+			`i := dml.NewInsert(r.Table.Name).AddColumns("email", "firstname")`,
+			`).OnDuplicateKey().AddOnDuplicateKeyExclude("entity_id")`,
+		} {
+			assert.Contains(t, goBuf.String(), want)
+		}
+		for _, want := range []string{
+			"\t\"github.com/DATA-DOG/go-sqlmock\"\n",
+			"func TestCustomerEntityRepository(t *testing.T) {",
+			"r.LoadByUniqueKey(ctx, email)",
+			"assert.Exactly(t, uint64(11), e.EntityID)",
+		} {
+			assert.Contains(t, testBuf.String(), want)
+		}
+	})
+
+	t.Run("decimal primary key", func(t *testing.T) {
+		ts, err := dmlgen.NewTables("catalog",
+			dmlgen.WithTableOption("catalog_price", &dmlgen.TableOption{
+				Repository: true,
+			}),
+			dmlgen.WithTable("catalog_price", ddl.Columns{
+				&ddl.Column{Field: "price", Pos: 1, Null: "NO", DataType: "decimal", ColumnType: "decimal(12,4)", Key: "PRI"},
+				&ddl.Column{Field: "label", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)"},
+			}),
+		)
+		require.NoError(t, err)
+
+		var goBuf bytes.Buffer
+		require.NoError(t, ts.WriteGo(&goBuf))
+		assert.Contains(t, goBuf.String(), `return errors.NotSupported.Newf("[catalog] CatalogPriceCollection Column %q does not support a slice of values", c)`)
+		assert.NotContains(t, goBuf.String(), "LoadByPKs")
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		ts, err := newTables(false)
+		require.NoError(t, err)
+
+		var goBuf bytes.Buffer
+		require.NoError(t, ts.WriteGo(&goBuf))
+		assert.NotContains(t, goBuf.String(), "Repository")
+		err = ts.WriteGoTest(&goBuf)
+		assert.True(t, errors.NotAcceptable.Match(err), "%+v", err)
+	})
+}
+
+func TestWithForeignKeyRelationships(t *testing.T) {
+	t.Parallel()
+
+	dbc, mock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, mock)
+
+	mock.ExpectQuery("SELECT.+information_schema.KEY_COLUMN_USAGE.+").WillReturnRows(dmltest.MustMockRows(
+		dmltest.WithFile("testdata/INFORMATION_SCHEMA.KEY_COLUMN_USAGE.csv"),
+	))
+
+	ts, err := dmlgen.NewTables("customer",
+		dmlgen.WithTable("customer_entity", ddl.Columns{
+			&ddl.Column{Field: "entity_id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+			&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Key: "UNI"},
+		}),
+		dmlgen.WithTable("customer_address_entity", ddl.Columns{
+			&ddl.Column{Field: "entity_id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+			&ddl.Column{Field: "parent_id", Pos: 2, Null: "YES", DataType: "int", ColumnType: "int(10) unsigned", Key: "MUL"},
+			&ddl.Column{Field: "city", Pos: 3, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)"},
+		}),
+		dmlgen.WithForeignKeyRelationships(context.Background(), dbc.DB),
+	)
+	require.NoError(t, err)
+
+	var goBuf bytes.Buffer
+	require.NoError(t, ts.WriteGo(&goBuf))
+
+	for _, want := range []string{
+		"CustomerAddressEntities *CustomerAddressEntityCollection",
+		"CustomerEntity *CustomerEntity // loaded by CustomerAddressEntityCollection.LoadCustomerEntity",
+		"func (cc *CustomerEntityCollection) LoadCustomerAddressEntities(ctx context.Context, db dml.QueryExecPreparer) (CustomerAddressEntityCollection, error) {",
+		"func (cc *CustomerAddressEntityCollection) LoadCustomerEntity(ctx context.Context, db dml.QueryExecPreparer) (CustomerEntityCollection, error) {",
+		"Where(dml.Column(\"parent_id\").In().PlaceHolder())",
+		"ExpandPlaceHolders().Uint64s(keys...).Load(ctx, &refs)",
+		"k := uint64(e.ParentID.Int64)",
+		"byKey[uint64(r.ParentID.Int64)]",
+	} {
+		assert.Contains(t, goBuf.String(), want)
+	}
+}
+
+func TestWithGRPC(t *testing.T) {
+	t.Parallel()
+
+	newTables := func(opt *dmlgen.TableOption) (*dmlgen.Tables, error) {
+		return dmlgen.NewTables("customer",
+			dmlgen.WithTableOption("customer_entity", opt),
+			dmlgen.WithTable("customer_entity", ddl.Columns{
+				&ddl.Column{Field: "entity_id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+				&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(255)", Key: "UNI", CharMaxLength: null.MakeInt64(255)},
+			}),
+		)
+	}
+
+	t.Run("service, server and validation", func(t *testing.T) {
+		ts, err := newTables(&dmlgen.TableOption{Repository: true, GRPC: true, Encoders: []string{"text"}})
+		require.NoError(t, err)
+
+		var goBuf, protoBuf, testBuf bytes.Buffer
+		require.NoError(t, ts.WriteGo(&goBuf))
+		require.NoError(t, ts.WriteProto(&protoBuf))
+		require.NoError(t, ts.WriteGoTest(&testBuf))
+
+		for _, want := range []string{
+			"\t\"github.com/corestoreio/pkg/net/cspb\"\n",
+			"\t\"google.golang.org/grpc/codes\"\n",
+			"\t\"unicode/utf8\"\n",
+			"if utf8.RuneCountInString(e.Email) > 255 {\n\t\tfv = append(fv, \"email\", \"must not exceed 255 characters\")",
+			"func (e *CustomerEntity) Validate() error {",
+			"func (cc *CustomerEntityCollection) Validate() error {",
+			"func (e *CustomerEntity) UnmarshalJSON(b []byte) error {",
+			"type CustomerEntityPrimaryKey struct {\n\tEntityID uint64\n}",
+			"func (s *CustomerEntityServer) Insert(ctx context.Context, e *CustomerEntity) (*CustomerEntity, error) {",
+			"func (s *CustomerEntityServer) LoadByPK(ctx context.Context, pk *CustomerEntityPrimaryKey) (*CustomerEntity, error) {",
+			"func (s *CustomerEntityServer) DeleteByPK(ctx context.Context, pk *CustomerEntityPrimaryKey) (*CustomerEntityRowsAffected, error) {",
+			"cspb.NewStatusBadRequestError(codes.InvalidArgument, \"[customer] CustomerEntity validation failed\", fv...)",
+		} {
+			assert.Contains(t, goBuf.String(), want)
+		}
+		// the repository validates before writing
+		assert.Contains(t, goBuf.String(), "(sql.Result, error) {\n\tif err := e.Validate(); err != nil {")
+
+		for _, want := range []string{
+			"message CustomerEntityPrimaryKey {\n\tuint64 entity_id = 1",
+			"service CustomerEntityService {",
+			"rpc LoadByPK(CustomerEntityPrimaryKey) returns (CustomerEntity);",
+		} {
+			assert.Contains(t, protoBuf.String(), want)
+		}
+		assert.Contains(t, testBuf.String(), "e.Email = \"a\"")
+		assert.Contains(t, testBuf.String(), "assert.Exactly(t, codes.NotFound, status.Code(err), \"%+v\", err)")
+	})
+
+	t.Run("requires repository", func(t *testing.T) {
+		ts, err := newTables(&dmlgen.TableOption{GRPC: true})
+		assert.Nil(t, ts)
+		assert.True(t, errors.NotAcceptable.Match(err), "%+v", err)
+	})
+}
@@ -0,0 +1,154 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmlgen
+
+import (
+	"context"
+	"sort"
+	"strings"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/util/strs"
+)
+
+// relationship describes a foreign key between two generated tables from the
+// point of view of one table. A one-to-many relationship belongs to the
+// referenced (parent) table, a many-to-one relationship to the table
+// containing the foreign key (child).
+type relationship struct {
+	ToMany bool
+	// FieldName names the struct field of the entity and the loader method of
+	// the collection.
+	FieldName string
+	// Column of the own table, either the referenced or the foreign key column.
+	Column *ddl.Column
+	// RefTable, RefColumns, RefColumn, RefEntity and RefCollection describe
+	// the other table.
+	RefTable      string
+	RefColumns    ddl.Columns
+	RefColumn     *ddl.Column
+	RefEntity     string
+	RefCollection string
+}
+
+// WithForeignKeyRelationships generates relationship fields and batch loaders
+// from single column foreign keys, if both tables are part of the generated
+// code. The referenced (parent) table gets a one-to-many field, pointing to a
+// collection of the child table, and the child table gets a many-to-one
+// field, pointing to the parent entity. The loaders are methods of the
+// collections and fetch the related rows for all entities of a collection
+// with a single IN query to avoid N+1 queries. For example the foreign key
+// from customer_address_entity.parent_id to customer_entity.entity_id
+// generates:
+//
+//	type CustomerEntity struct {
+//		// ...
+//		CustomerAddressEntities *CustomerAddressEntityCollection
+//	}
+//	func (cc *CustomerEntityCollection) LoadCustomerAddressEntities(ctx context.Context, db dml.QueryExecPreparer) (CustomerAddressEntityCollection, error)
+//	type CustomerAddressEntity struct {
+//		// ...
+//		CustomerEntity *CustomerEntity
+//	}
+//	func (cc *CustomerAddressEntityCollection) LoadCustomerEntity(ctx context.Context, db dml.QueryExecPreparer) (CustomerEntityCollection, error)
+//
+// If a child table references the same parent table with more than one
+// column, the field names get the suffix "By" and the name of the column.
+func WithForeignKeyRelationships(ctx context.Context, db dml.Querier) (opt Option) {
+	opt.sortOrder = 210 // after WithColumnAliasesFromForeignKeys
+	opt.fn = func(ts *Tables) error {
+		tblFks, err := ddl.LoadKeyColumnUsage(ctx, db, ts.sortedTableNames()...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var kcus []*ddl.KeyColumnUsage
+		constraintCols := map[string]int{} // key: table.constraint
+		refCount := map[string]int{}       // key: child table.parent table
+		for _, kcuc := range tblFks {
+			for _, kcu := range kcuc.Data {
+				kcus = append(kcus, kcu)
+				constraintCols[kcu.TableName+"."+kcu.ConstraintName]++
+				refCount[kcu.TableName+"."+kcu.ReferencedTableName.String]++
+			}
+		}
+		sort.Slice(kcus, func(i, j int) bool {
+			if kcus[i].TableName != kcus[j].TableName {
+				return kcus[i].TableName < kcus[j].TableName
+			}
+			return kcus[i].ColumnName < kcus[j].ColumnName
+		})
+
+		for _, kcu := range kcus {
+			if constraintCols[kcu.TableName+"."+kcu.ConstraintName] > 1 {
+				continue // composite foreign keys are not supported
+			}
+			child, parent := ts.Tables[kcu.TableName], ts.Tables[kcu.ReferencedTableName.String]
+			if child == nil || parent == nil {
+				continue
+			}
+			childCol := child.Columns.ByField(kcu.ColumnName)
+			parentCol := parent.Columns.UniqueColumns().ByField(kcu.ReferencedColumnName.String)
+			if childCol.Field == "" || parentCol.Field == "" {
+				continue
+			}
+			if toGoArgsFunc(parentCol) == "" || strings.HasPrefix(toGoType(parentCol), "[]") {
+				continue // the key must be an IN argument and a map key
+			}
+
+			var suffix string
+			if refCount[kcu.TableName+"."+kcu.ReferencedTableName.String] > 1 {
+				suffix = "By" + strs.ToGoCamelCase(kcu.ColumnName)
+			}
+			childEntity, parentEntity := strs.ToGoCamelCase(child.TableName), strs.ToGoCamelCase(parent.TableName)
+
+			parent.Relationships = append(parent.Relationships, &relationship{
+				ToMany:        true,
+				FieldName:     pluralize(childEntity) + suffix,
+				Column:        parentCol,
+				RefTable:      child.TableName,
+				RefColumns:    child.Columns,
+				RefColumn:     childCol,
+				RefEntity:     childEntity,
+				RefCollection: childEntity + "Collection",
+			})
+			child.Relationships = append(child.Relationships, &relationship{
+				FieldName:     parentEntity + suffix,
+				Column:        childCol,
+				RefTable:      parent.TableName,
+				RefColumns:    parent.Columns,
+				RefColumn:     parentCol,
+				RefEntity:     parentEntity,
+				RefCollection: parentEntity + "Collection",
+			})
+		}
+		return nil
+	}
+	return
+}
+
+// pluralize appends the English plural suffix to a Go identifier.
+// Entity->Entities, Address->Addresses, Item->Items
+func pluralize(s string) string {
+	switch {
+	case strings.HasSuffix(s, "y") && len(s) > 1 && !strings.ContainsRune("aeiou", rune(s[len(s)-2])):
+		return s[:len(s)-1] + "ies"
+	case strings.HasSuffix(s, "s"), strings.HasSuffix(s, "x"), strings.HasSuffix(s, "ch"), strings.HasSuffix(s, "sh"):
+		return s + "es"
+	}
+	return s + "s"
+}
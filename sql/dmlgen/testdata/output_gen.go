@@ -611,7 +611,7 @@ func (s *sliceCustomerEntity) Prepend(n *CustomerEntity) {
 
 // UnmarshalJSON implements interface json.Unmarshaler.
 func (cc *CustomerEntityCollection) UnmarshalJSON(b []byte) (err error) {
-	return json.Unmarshal(b, cc.Data)
+	return json.Unmarshal(b, &cc.Data)
 }
 
 // MarshalJSON implements interface json.Marshaler.
@@ -1069,7 +1069,7 @@ func (s *sliceDmlgenTypes) Prepend(n *DmlgenTypes) {
 
 // UnmarshalJSON implements interface json.Unmarshaler.
 func (cc *DmlgenTypesCollection) UnmarshalJSON(b []byte) (err error) {
-	return json.Unmarshal(b, cc.Data)
+	return json.Unmarshal(b, &cc.Data)
 }
 
 // MarshalJSON implements interface json.Marshaler.
@@ -16,6 +16,7 @@ package dmlgen
 
 import (
 	"fmt"
+	"go/token"
 	"strings"
 	"unicode"
 	"unicode/utf8"
@@ -220,7 +221,7 @@ func toGoPrimitive(c *ddl.Column) string {
 	t := mySQLToGoType(c, true)
 	field := strs.ToGoCamelCase(c.Field)
 	if strings.HasPrefix(t, "null.") {
-		t = field + "." + t[8:]
+		t = field + "." + t[5:]
 	} else {
 		t = field
 	}
@@ -243,6 +244,9 @@ func mySQLToGoFunc(c *ddl.Column, withNull bool) string {
 		return "Byte"
 	}
 
+	if strings.HasPrefix(gt, "null.") {
+		return "Null" + gt[5:]
+	}
 	if dot := strings.IndexByte(gt, '.'); dot > 0 {
 		return gt[dot+1:]
 	}
@@ -250,6 +254,169 @@ func mySQLToGoFunc(c *ddl.Column, withNull bool) string {
 	return string(unicode.ToUpper(r)) + gt[n:]
 }
 
+// toGoArgFuncNull returns the name of the method of type dml.Artisan which
+// appends the value of a column as an argument. Types without a dedicated
+// method must implement driver.Valuer.
+func toGoArgFuncNull(c *ddl.Column) string {
+	return mySQLToGoArgFunc(c, true)
+}
+
+// toGoArgsFuncNull returns the name of the variadic method of type
+// dml.Artisan which appends a slice of column values as an argument. Returns
+// an empty string if dml.Artisan does not provide a method for the type.
+func toGoArgsFuncNull(c *ddl.Column) string {
+	return mySQLToGoArgsFunc(c, true)
+}
+
+// toGoArgsFunc same as toGoArgsFuncNull but for the not-null Go type.
+func toGoArgsFunc(c *ddl.Column) string {
+	return mySQLToGoArgsFunc(c, false)
+}
+
+func mySQLToGoArgFunc(c *ddl.Column, withNull bool) string {
+	switch gt := mySQLToGoType(c, withNull); {
+	case gt == "[]byte":
+		return "Bytes"
+	case strings.HasSuffix(gt, ".Decimal"):
+		return "DriverValue"
+	}
+	return mySQLToGoFunc(c, withNull)
+}
+
+func mySQLToGoArgsFunc(c *ddl.Column, withNull bool) string {
+	switch fn := mySQLToGoArgFunc(c, withNull); fn {
+	case "Bytes":
+		return "BytesSlice"
+	case "DriverValue":
+		return ""
+	default:
+		return fn + "s"
+	}
+}
+
+// toGoParamName converts a column name into the name of a function parameter.
+// entity_id->entityID, id->id, type->typeVal
+func toGoParamName(c *ddl.Column) string {
+	cc := []rune(strs.ToGoCamelCase(c.Field))
+	for i := range cc {
+		if !unicode.IsUpper(cc[i]) || (i > 0 && i+1 < len(cc) && unicode.IsLower(cc[i+1])) {
+			break
+		}
+		cc[i] = unicode.ToLower(cc[i])
+	}
+	name := string(cc)
+	if token.Lookup(name).IsKeyword() {
+		name += "Val"
+	}
+	return name
+}
+
+// mysqlIntRanges contains the value ranges of the MySQL integer types whose
+// ranges are smaller than the ranges of the Go types. Index 0 defines the
+// signed minimum, index 1 the signed maximum and index 2 the unsigned maximum.
+var mysqlIntRanges = map[string][3]int64{
+	"tinyint":   {-1 << 7, 1<<7 - 1, 1<<8 - 1},
+	"smallint":  {-1 << 15, 1<<15 - 1, 1<<16 - 1},
+	"mediumint": {-1 << 23, 1<<23 - 1, 1<<24 - 1},
+	"int":       {-1 << 31, 1<<31 - 1, 1<<32 - 1},
+}
+
+// validation represents a generated check of a single column. Cond contains a
+// Go expression which reports the violation for the entity `e`.
+type validation struct {
+	Cond    string
+	Message string
+}
+
+// toGoValidations creates the validation checks for a column from its
+// definition: NOT NULL columns without a default value must not be empty,
+// strings must not exceed the maximum character length and integers must fit
+// into the range of the MySQL type.
+func toGoValidations(c *ddl.Column) (vs []validation) {
+	field := "e." + strs.ToGoCamelCase(c.Field)
+	required := !c.IsNull() && !c.Default.Valid && !c.IsAutoIncrement()
+	isText := c.DataType != "enum" && c.DataType != "set" && c.CharMaxLength.Valid
+
+	switch gt := mySQLToGoType(c, true); gt {
+	case "string":
+		if required {
+			vs = append(vs, validation{Cond: field + ` == ""`, Message: "must not be empty"})
+		}
+		if isText {
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("utf8.RuneCountInString(%s) > %d", field, c.CharMaxLength.Int64),
+				Message: fmt.Sprintf("must not exceed %d characters", c.CharMaxLength.Int64),
+			})
+		}
+	case "null.String":
+		if isText {
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("%s.Valid && utf8.RuneCountInString(%s.String) > %d", field, field, c.CharMaxLength.Int64),
+				Message: fmt.Sprintf("must not exceed %d characters", c.CharMaxLength.Int64),
+			})
+		}
+	case "time.Time":
+		if required && !c.IsCurrentTimestamp() {
+			vs = append(vs, validation{Cond: field + ".IsZero()", Message: "must not be empty"})
+		}
+	case "[]byte":
+		if required {
+			vs = append(vs, validation{Cond: "len(" + field + ") == 0", Message: "must not be empty"})
+		}
+	case "uint64":
+		if r, ok := mysqlIntRanges[c.DataType]; ok {
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("%s > %d", field, r[2]),
+				Message: fmt.Sprintf("must be between 0 and %d", r[2]),
+			})
+		}
+	case "int64":
+		if r, ok := mysqlIntRanges[c.DataType]; ok {
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("(%s < %d || %s > %d)", field, r[0], field, r[1]),
+				Message: fmt.Sprintf("must be between %d and %d", r[0], r[1]),
+			})
+		}
+	case "null.Int64":
+		r, ok := mysqlIntRanges[c.DataType]
+		switch {
+		case c.IsUnsigned() && ok:
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("%s.Valid && (%s.Int64 < 0 || %s.Int64 > %d)", field, field, field, r[2]),
+				Message: fmt.Sprintf("must be between 0 and %d", r[2]),
+			})
+		case c.IsUnsigned():
+			vs = append(vs, validation{Cond: field + ".Valid && " + field + ".Int64 < 0", Message: "must not be negative"})
+		case ok:
+			vs = append(vs, validation{
+				Cond:    fmt.Sprintf("%s.Valid && (%s.Int64 < %d || %s.Int64 > %d)", field, field, r[0], field, r[1]),
+				Message: fmt.Sprintf("must be between %d and %d", r[0], r[1]),
+			})
+		}
+	}
+	return vs
+}
+
+// toGoFixture returns a Go statement which assigns a valid value to a
+// required column of the entity `e`. The generated tests use it to create
+// entities passing the validation. Returns an empty string if the zero value
+// is valid.
+func toGoFixture(c *ddl.Column) string {
+	if c.IsNull() || c.Default.Valid || c.IsAutoIncrement() {
+		return ""
+	}
+	field := "e." + strs.ToGoCamelCase(c.Field)
+	switch mySQLToGoType(c, true) {
+	case "string":
+		return field + ` = "a"`
+	case "time.Time":
+		return field + " = time.Now()"
+	case "[]byte":
+		return field + ` = []byte("a")`
+	}
+	return ""
+}
+
 func toProto(c *ddl.Column, withNull bool) string {
 
 	goType := findType(c)
@@ -68,3 +68,64 @@ func TestGetGoPrimitive(t *testing.T) {
 		require.Exactly(t, test.want, have, "%#v", test)
 	}
 }
+
+func TestToGoArgFuncNull(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		c        ddl.Column
+		wantArg  string
+		wantArgs string
+		wantName string
+	}{
+		{ddl.Column{Field: `entity_id`, DataType: `int`, ColumnType: `int(10) unsigned`}, "Uint64", "Uint64s", "entityID"},
+		{ddl.Column{Field: `id`, DataType: `bigint`, ColumnType: `bigint`}, "Int64", "Int64s", "id"},
+		{ddl.Column{Field: `email`, DataType: `varchar`, Null: "YES"}, "NullString", "NullStrings", "email"},
+		{ddl.Column{Field: `parent_id`, DataType: `int`, Null: "YES"}, "NullInt64", "NullInt64s", "parentID"},
+		{ddl.Column{Field: `type`, DataType: `varchar`}, "String", "Strings", "typeVal"},
+		{ddl.Column{Field: `created_at`, DataType: `datetime`}, "Time", "Times", "createdAt"},
+		{ddl.Column{Field: `image`, DataType: `varbinary`}, "Bytes", "BytesSlice", "image"},
+		{ddl.Column{Field: `price`, DataType: `decimal`}, "DriverValue", "", "price"},
+	}
+	for _, test := range tests {
+		require.Exactly(t, test.wantArg, toGoArgFuncNull(&test.c), "%#v", test.c)
+		require.Exactly(t, test.wantArgs, toGoArgsFuncNull(&test.c), "%#v", test.c)
+		require.Exactly(t, test.wantName, toGoParamName(&test.c), "%#v", test.c)
+	}
+}
+
+func TestToGoValidations(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		c    ddl.Column
+		want []validation
+	}{
+		{ddl.Column{Field: `entity_id`, DataType: `int`, ColumnType: `int(10) unsigned`, Extra: "auto_increment"}, []validation{
+			{Cond: "e.EntityID > 4294967295", Message: "must be between 0 and 4294967295"},
+		}},
+		{ddl.Column{Field: `id`, DataType: `bigint`, ColumnType: `bigint(20) unsigned`}, nil},
+		{ddl.Column{Field: `qty`, DataType: `smallint`, ColumnType: `smallint(5)`, Null: "YES"}, []validation{
+			{Cond: "e.Qty.Valid && (e.Qty.Int64 < -32768 || e.Qty.Int64 > 32767)", Message: "must be between -32768 and 32767"},
+		}},
+		{ddl.Column{Field: `parent_id`, DataType: `bigint`, ColumnType: `bigint(20) unsigned`, Null: "YES"}, []validation{
+			{Cond: "e.ParentID.Valid && e.ParentID.Int64 < 0", Message: "must not be negative"},
+		}},
+		{ddl.Column{Field: `email`, DataType: `varchar`, CharMaxLength: null.MakeInt64(255)}, []validation{
+			{Cond: `e.Email == ""`, Message: "must not be empty"},
+			{Cond: "utf8.RuneCountInString(e.Email) > 255", Message: "must not exceed 255 characters"},
+		}},
+		{ddl.Column{Field: `email`, DataType: `varchar`, Default: null.MakeString(""), CharMaxLength: null.MakeInt64(10)}, []validation{
+			{Cond: "utf8.RuneCountInString(e.Email) > 10", Message: "must not exceed 10 characters"},
+		}},
+		{ddl.Column{Field: `firstname`, DataType: `varchar`, Null: "YES", CharMaxLength: null.MakeInt64(32)}, []validation{
+			{Cond: "e.Firstname.Valid && utf8.RuneCountInString(e.Firstname.String) > 32", Message: "must not exceed 32 characters"},
+		}},
+		{ddl.Column{Field: `created_at`, DataType: `datetime`}, []validation{
+			{Cond: "e.CreatedAt.IsZero()", Message: "must not be empty"},
+		}},
+		{ddl.Column{Field: `updated_at`, DataType: `timestamp`, Default: null.MakeString("CURRENT_TIMESTAMP")}, nil},
+		{ddl.Column{Field: `is_active`, DataType: `smallint`, ColumnType: `smallint(5) unsigned`}, nil},
+	}
+	for _, test := range tests {
+		require.Exactly(t, test.want, toGoValidations(&test.c), "%#v", test.c)
+	}
+}
@@ -13,4 +13,7 @@
 // limitations under the License.
 
 // Package dmltest provides functions for testing the dml package.
+//
+// Subpackage memdb provides an in-memory fake MySQL driver to run tests of
+// tables and repositories without a MySQL server.
 package dmltest
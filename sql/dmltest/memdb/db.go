@@ -0,0 +1,195 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"database/sql/driver"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+// DB contains the in-memory tables and records all executed queries. All
+// connections share the same tables.
+type DB struct {
+	// Now returns the current time for CURRENT_TIMESTAMP and NOW(). Defaults
+	// to time.Now. Must be set before the first query.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	tables  map[string]*table
+	queries []Query
+}
+
+// Query represents an executed query with its arguments. Transactions
+// started with database/sql appear as BEGIN, COMMIT and ROLLBACK.
+type Query struct {
+	SQL  string
+	Args []driver.Value
+}
+
+// New creates an empty in-memory database with the tables and their columns.
+// The ddl.Table types must contain the columns.
+func New(tbls *ddl.Tables) (*DB, error) {
+	db := &DB{
+		Now:    time.Now,
+		tables: make(map[string]*table, tbls.Len()),
+	}
+	for _, name := range tbls.Tables() {
+		t, err := tbls.Table(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if len(t.Columns) == 0 {
+			return nil, errors.NotValid.Newf("[memdb] Table %q does not contain any columns", name)
+		}
+		db.tables[name] = newTable(t)
+	}
+	return db, nil
+}
+
+func (db *DB) now() time.Time {
+	return db.Now().UTC()
+}
+
+// Connector returns a connector for sql.OpenDB.
+func (db *DB) Connector() driver.Connector {
+	return connector{db: db}
+}
+
+// WithDB sets the in-memory database as connection of a dml.ConnPool, like
+// dml.WithDSN does for a MySQL server. Supports dml.WithQueryStats.
+func WithDB(db *DB) dml.ConnPoolOption {
+	return dml.WithConnector(db.Connector())
+}
+
+// MockDB creates an in-memory database for the tables and a connection pool
+// to it. It sets the connection pool as DB of all tables, so tables and
+// generated repositories can be used without a MySQL server. Fatals on error.
+//		dbc, mdb := memdb.MockDB(t, tbls)
+//		defer dmltest.Close(t, dbc)
+func MockDB(t testing.TB, tbls *ddl.Tables, opts ...dml.ConnPoolOption) (*dml.ConnPool, *DB) {
+	if t != nil { // t can be nil in Example functions
+		t.Helper()
+	}
+	db, err := New(tbls)
+	fatalIfError(t, err)
+	dbc, err := dml.NewConnPool(append([]dml.ConnPoolOption{WithDB(db)}, opts...)...)
+	fatalIfError(t, err)
+	fatalIfError(t, tbls.Options(ddl.WithDB(dbc.DB)))
+	return dbc, db
+}
+
+func fatalIfError(t testing.TB, err error) {
+	if err != nil {
+		if t != nil {
+			t.Fatalf("%+v", err)
+		} else {
+			panic(err)
+		}
+	}
+}
+
+// record appends a query to the log. The caller must hold the lock.
+func (db *DB) record(query string, args []driver.Value) {
+	db.queries = append(db.queries, Query{SQL: query, Args: args})
+}
+
+// Rows returns a copy of all rows of a table, ordered by the primary key. The
+// values are nil, int64, uint64, float64, string or time.Time. DECIMAL
+// columns return a string.
+func (db *DB) Rows(table string) ([]map[string]interface{}, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, ok := db.tables[table]
+	if !ok {
+		return nil, errors.NotFound.Newf("[memdb] Table %q not found", table)
+	}
+	rows := t.sortedRows()
+	ret := make([]map[string]interface{}, len(rows))
+	for i, r := range rows {
+		m := make(map[string]interface{}, len(r))
+		for j, v := range r {
+			if d, ok := v.(decimal); ok {
+				v = string(d)
+			}
+			m[t.cols[j].Field] = v
+		}
+		ret[i] = m
+	}
+	return ret, nil
+}
+
+// Queries returns all executed queries since the creation or the last call to
+// ResetQueries.
+func (db *DB) Queries() []Query {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	return append([]Query(nil), db.queries...)
+}
+
+// ResetQueries clears the query log, e.g. after inserting the fixtures.
+func (db *DB) ResetQueries() {
+	db.mu.Lock()
+	db.queries = nil
+	db.mu.Unlock()
+}
+
+// AssertQueries checks that the executed queries match the regular
+// expressions in the same order and that no other query has been executed.
+// Use regexp.QuoteMeta or dmltest.SQLMockQuoteMeta to match the SQL exactly.
+func (db *DB) AssertQueries(t testing.TB, patterns ...string) bool {
+	t.Helper()
+	queries := db.Queries()
+	ok := len(queries) == len(patterns)
+	for i := 0; i < len(queries) || i < len(patterns); i++ {
+		switch {
+		case i >= len(patterns):
+			t.Errorf("[memdb] Unexpected query %d: %s", i+1, queries[i].SQL)
+		case i >= len(queries):
+			t.Errorf("[memdb] Missing query %d matching: %s", i+1, patterns[i])
+		case !regexp.MustCompile(patterns[i]).MatchString(queries[i].SQL):
+			ok = false
+			t.Errorf("[memdb] Query %d\n%s\ndoes not match\n%s", i+1, queries[i].SQL, patterns[i])
+		}
+	}
+	return ok
+}
+
+// AssertQueryCount checks how often queries matching the regular expression
+// have been executed. Useful to detect N+1 queries.
+func (db *DB) AssertQueryCount(t testing.TB, pattern string, want int) bool {
+	t.Helper()
+	re := regexp.MustCompile(pattern)
+	var have int
+	var matched []string
+	for _, q := range db.Queries() {
+		if re.MatchString(q.SQL) {
+			have++
+			matched = append(matched, q.SQL)
+		}
+	}
+	if have != want {
+		t.Errorf("[memdb] Expected %d queries matching %s, got %d:\n%s", want, pattern, have, strings.Join(matched, "\n"))
+		return false
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package memdb provides an in-memory fake MySQL database/sql driver for
+// tests. Contrary to sqlmock it executes the queries against tables defined by
+// ddl.Tables, hence tests check the resulting data instead of the exact SQL.
+//
+//		tbls, _ := ddl.NewTables(ddl.WithTable("customer", cols...))
+//		dbc, mdb := memdb.MockDB(t, tbls)
+//		defer dmltest.Close(t, dbc)
+//		// use dbc or the tables ...
+//		rows, err := mdb.Rows("customer")
+//		mdb.AssertQueryCount(t, "^SELECT", 1)
+//
+// The driver understands the statements generated by the dml package: SELECT
+// on a single table with WHERE, GROUP BY, HAVING, ORDER BY and LIMIT; INSERT,
+// REPLACE and INSERT IGNORE with ON DUPLICATE KEY UPDATE or a SELECT; UPDATE
+// and DELETE with ORDER BY and LIMIT; transactions and save points. JOINs,
+// UNIONs and sub queries return a NotSupported error. EXPLAIN returns a plan
+// with a full table scan.
+//
+// The values get converted to the column types in strict mode. Primary and
+// unique keys, NOT NULL, default values and auto increment behave like in
+// InnoDB and cause the same MySQL error numbers, e.g. 1062 for a duplicate
+// entry. Strings compare case insensitive. Transactions are not isolated:
+// a ROLLBACK restores all tables to the state at BEGIN, including the changes
+// made by other connections meanwhile.
+package memdb
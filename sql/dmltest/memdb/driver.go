@@ -0,0 +1,327 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/corestoreio/errors"
+)
+
+var (
+	_ driver.Connector          = (*connector)(nil)
+	_ driver.Conn               = (*conn)(nil)
+	_ driver.ConnBeginTx        = (*conn)(nil)
+	_ driver.Pinger             = (*conn)(nil)
+	_ driver.ConnPrepareContext = (*conn)(nil)
+	_ driver.ExecerContext      = (*conn)(nil)
+	_ driver.QueryerContext     = (*conn)(nil)
+	_ driver.NamedValueChecker  = (*conn)(nil)
+	_ driver.StmtExecContext    = (*stmt)(nil)
+	_ driver.StmtQueryContext   = (*stmt)(nil)
+	_ driver.Rows               = (*rows)(nil)
+)
+
+// connector implements driver.Connector and driver.Driver for the in-memory
+// DB.
+type connector struct {
+	db *DB
+}
+
+func (c connector) Connect(_ context.Context) (driver.Conn, error) { return &conn{db: c.db}, nil }
+func (c connector) Driver() driver.Driver                          { return c }
+func (c connector) Open(_ string) (driver.Conn, error)             { return &conn{db: c.db}, nil }
+
+type savepoint struct {
+	name string
+	snap snapshot
+}
+
+// conn represents a connection. Each connection has its own transaction.
+type conn struct {
+	db *DB
+	// tx gets set when a transaction has been started. It contains the state
+	// to restore on ROLLBACK.
+	tx         snapshot
+	savepoints []savepoint
+	closed     bool
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(_ context.Context, query string) (driver.Stmt, error) {
+	if c.closed {
+		return nil, driver.ErrBadConn
+	}
+	s, n, err := parse(query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return &stmt{conn: c, query: query, stmt: s, numInput: n}, nil
+}
+
+func (c *conn) Close() error {
+	if c.tx != nil {
+		c.db.mu.Lock()
+		c.rollback()
+		c.db.mu.Unlock()
+	}
+	c.closed = true
+	return nil
+}
+
+func (c *conn) Ping(_ context.Context) error {
+	if c.closed {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(_ context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.record(txBegin, nil)
+	c.begin()
+	return c, nil
+}
+
+// Commit implements driver.Tx.
+func (c *conn) Commit() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.record(txCommit, nil)
+	c.tx, c.savepoints = nil, nil
+	return nil
+}
+
+// Rollback implements driver.Tx.
+func (c *conn) Rollback() error {
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+	c.db.record(txRollback, nil)
+	c.rollback()
+	return nil
+}
+
+// begin starts a transaction, an open transaction gets committed implicitly.
+func (c *conn) begin() {
+	c.tx, c.savepoints = c.db.snapshot(), nil
+}
+
+func (c *conn) rollback() {
+	if c.tx != nil {
+		c.db.restore(c.tx)
+	}
+	c.tx, c.savepoints = nil, nil
+}
+
+func (c *conn) savepoint(name string) int {
+	for i := len(c.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(c.savepoints[i].name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (c *conn) txStmt(s *txStmt) error {
+	switch s.kind {
+	case txBegin:
+		c.begin()
+	case txCommit:
+		c.tx, c.savepoints = nil, nil
+	case txRollback:
+		c.rollback()
+	case txSavepoint:
+		if c.tx == nil {
+			return nil // like autocommit mode
+		}
+		if i := c.savepoint(s.savepoint); i >= 0 {
+			c.savepoints = append(c.savepoints[:i:i], c.savepoints[i+1:]...)
+		}
+		c.savepoints = append(c.savepoints, savepoint{name: s.savepoint, snap: c.db.snapshot()})
+	case txRollbackTo, txRelease:
+		i := c.savepoint(s.savepoint)
+		if i < 0 {
+			return mysqlErrorf(errNoSuchSavepoint, "SAVEPOINT %s does not exist", s.savepoint)
+		}
+		if s.kind == txRelease {
+			c.savepoints = c.savepoints[:i]
+			return nil
+		}
+		c.db.restore(c.savepoints[i].snap)
+		c.savepoints = c.savepoints[:i+1]
+	}
+	return nil
+}
+
+// CheckNamedValue converts the arguments like the MySQL driver, but keeps
+// uint64 values.
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	switch v := nv.Value.(type) {
+	case uint64:
+		if v > math.MaxInt64 {
+			return nil
+		}
+	case uint:
+		if uint64(v) > math.MaxInt64 {
+			nv.Value = uint64(v)
+			return nil
+		}
+	}
+	v, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	nv.Value = v
+	return nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	s, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s.(*stmt).ExecContext(ctx, args)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	s, err := c.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return s.(*stmt).QueryContext(ctx, args)
+}
+
+// exec runs a parsed statement and records it.
+func (c *conn) exec(query string, s interface{}, args []driver.NamedValue) (*resultSet, driver.Result, error) {
+	if c.closed {
+		return nil, nil, driver.ErrBadConn
+	}
+	c.db.mu.Lock()
+	defer c.db.mu.Unlock()
+
+	values := make([]driver.Value, len(args))
+	ex := &executor{db: c.db, args: make([]interface{}, len(args)), now: c.db.now()}
+	for i, a := range args {
+		values[i] = a.Value
+		ex.args[i] = normalizeArg(a.Value)
+	}
+	c.db.record(query, values)
+
+	var err error
+	var rs *resultSet
+	res := result{}
+	switch s := s.(type) {
+	case *selectStmt:
+		rs, err = ex.selectRows(s)
+	case *insertStmt:
+		res, err = ex.insert(s)
+	case *updateStmt:
+		res, err = ex.updateRows(s)
+	case *deleteStmt:
+		res, err = ex.deleteRows(s)
+	case *explainStmt:
+		rs, err = ex.explain(s)
+	case *txStmt:
+		err = c.txStmt(s)
+	case noopStmt:
+	default:
+		err = errors.NotSupported.Newf("[memdb] Statement %T not supported", s)
+	}
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	return rs, res, nil
+}
+
+// stmt implements driver.Stmt.
+type stmt struct {
+	conn     *conn
+	query    string
+	stmt     interface{}
+	numInput int
+}
+
+func (s *stmt) Close() error  { return nil }
+func (s *stmt) NumInput() int { return s.numInput }
+
+func (s *stmt) Exec(args []driver.Value) (driver.Result, error) {
+	return s.ExecContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) Query(args []driver.Value) (driver.Rows, error) {
+	return s.QueryContext(context.Background(), namedValues(args))
+}
+
+func (s *stmt) ExecContext(_ context.Context, args []driver.NamedValue) (driver.Result, error) {
+	if len(args) != s.numInput {
+		return nil, errors.NotValid.Newf("[memdb] Query %q expects %d arguments, got %d", s.query, s.numInput, len(args))
+	}
+	_, res, err := s.conn.exec(s.query, s.stmt, args)
+	return res, err
+}
+
+func (s *stmt) QueryContext(_ context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if len(args) != s.numInput {
+		return nil, errors.NotValid.Newf("[memdb] Query %q expects %d arguments, got %d", s.query, s.numInput, len(args))
+	}
+	rs, _, err := s.conn.exec(s.query, s.stmt, args)
+	if err != nil {
+		return nil, err
+	}
+	if rs == nil {
+		rs = &resultSet{}
+	}
+	return &rows{rs: rs}, nil
+}
+
+func namedValues(args []driver.Value) []driver.NamedValue {
+	nv := make([]driver.NamedValue, len(args))
+	for i, a := range args {
+		nv[i] = driver.NamedValue{Ordinal: i + 1, Value: a}
+	}
+	return nv
+}
+
+// rows implements driver.Rows.
+type rows struct {
+	rs  *resultSet
+	pos int
+}
+
+func (r *rows) Columns() []string { return r.rs.columns }
+func (r *rows) Close() error      { return nil }
+
+func (r *rows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rs.rows) {
+		return io.EOF
+	}
+	for i, v := range r.rs.rows[r.pos] {
+		dest[i] = driverValue(v)
+	}
+	r.pos++
+	return nil
+}
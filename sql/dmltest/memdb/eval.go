@@ -0,0 +1,625 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/errors"
+)
+
+// functions contains the supported scalar functions.
+var functions = map[string]bool{
+	"NOW": true, "CURRENT_TIMESTAMP": true, "LOCALTIMESTAMP": true, "UTC_TIMESTAMP": true, "CURDATE": true,
+	"CURRENT_DATE": true, "COALESCE": true, "IFNULL": true, "NULLIF": true, "IF": true, "ISNULL": true,
+	"LOWER": true, "LCASE": true, "UPPER": true, "UCASE": true, "CONCAT": true, "CONCAT_WS": true,
+	"LENGTH": true, "CHAR_LENGTH": true, "TRIM": true, "ABS": true,
+}
+
+// env contains the state to evaluate an expression.
+type env struct {
+	t *table
+	// row contains the current row, might be nil.
+	row []interface{}
+	// values contains the new row in ON DUPLICATE KEY UPDATE.
+	values []interface{}
+	// group contains the rows of a group when aggregating.
+	group    [][]interface{}
+	grouping bool
+	args     []interface{}
+	now      time.Time
+}
+
+func (e *env) column(name string) (interface{}, error) {
+	if e.t == nil {
+		return nil, mysqlErrorf(errBadField, "Unknown column '%s' in 'field list'", name)
+	}
+	i, ok := e.t.index(name)
+	if !ok {
+		return nil, mysqlErrorf(errBadField, "Unknown column '%s' in 'field list'", name)
+	}
+	if e.row == nil {
+		return nil, nil
+	}
+	return e.row[i], nil
+}
+
+func (e *env) eval(x expr) (interface{}, error) {
+	switch x := x.(type) {
+	case exprLit:
+		return x.val, nil
+	case exprParam:
+		if x.idx >= len(e.args) {
+			return nil, errors.NotValid.Newf("[memdb] Missing argument for place holder %d", x.idx+1)
+		}
+		return e.args[x.idx], nil
+	case exprCol:
+		return e.column(x.name)
+	case exprValues:
+		if e.values == nil {
+			return nil, nil
+		}
+		i, ok := e.t.index(x.name)
+		if !ok {
+			return nil, mysqlErrorf(errBadField, "Unknown column '%s' in 'field list'", x.name)
+		}
+		return e.values[i], nil
+	case exprUnary:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		switch x.op {
+		case "-":
+			switch v := v.(type) {
+			case nil:
+				return nil, nil
+			case int64:
+				return -v, nil
+			case float64:
+				return -v, nil
+			}
+			return decimal(new(big.Rat).Neg(toRat(v)).FloatString(scale(v))), nil
+		case "NOT":
+			b, null := truth(v)
+			if null {
+				return nil, nil
+			}
+			return boolValue(!b), nil
+		case "IS TRUE":
+			b, _ := truth(v)
+			return boolValue(b), nil
+		case "IS FALSE":
+			b, null := truth(v)
+			return boolValue(!b && !null), nil
+		}
+	case exprBinary:
+		return e.binary(x)
+	case exprIsNull:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		return boolValue((v == nil) != x.not), nil
+	case exprIn:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		var found, null bool
+		for _, item := range x.list {
+			iv, err := e.eval(item)
+			if err != nil {
+				return nil, err
+			}
+			eq, err := equal(v, iv)
+			if err != nil {
+				return nil, err
+			}
+			if eq == nil {
+				null = true
+			} else if eq.(int64) == 1 {
+				found = true
+				break
+			}
+		}
+		if !found && null {
+			return nil, nil
+		}
+		return boolValue(found != x.not), nil
+	case exprBetween:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		lo, err := e.eval(x.lo)
+		if err != nil {
+			return nil, err
+		}
+		hi, err := e.eval(x.hi)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || lo == nil || hi == nil {
+			return nil, nil
+		}
+		return boolValue((compare(v, lo) >= 0 && compare(v, hi) <= 0) != x.not), nil
+	case exprLike:
+		v, err := e.eval(x.x)
+		if err != nil {
+			return nil, err
+		}
+		p, err := e.eval(x.pattern)
+		if err != nil {
+			return nil, err
+		}
+		if v == nil || p == nil {
+			return nil, nil
+		}
+		return boolValue(likeRegexp(formatValue(p)).MatchString(formatValue(v)) != x.not), nil
+	case exprTuple:
+		return nil, errors.NotSupported.Newf("[memdb] Row constructor not supported in this context")
+	case exprFunc:
+		return e.function(x)
+	}
+	return nil, errors.NotSupported.Newf("[memdb] Expression %#v not supported", x)
+}
+
+func (e *env) binary(x exprBinary) (interface{}, error) {
+	if x.op == "AND" || x.op == "OR" {
+		l, err := e.eval(x.l)
+		if err != nil {
+			return nil, err
+		}
+		lb, lNull := truth(l)
+		if !lNull && ((x.op == "AND" && !lb) || (x.op == "OR" && lb)) {
+			return boolValue(lb), nil // short circuit
+		}
+		r, err := e.eval(x.r)
+		if err != nil {
+			return nil, err
+		}
+		rb, rNull := truth(r)
+		if x.op == "AND" {
+			switch {
+			case !rNull && !rb:
+				return boolValue(false), nil
+			case lNull || rNull:
+				return nil, nil
+			}
+			return boolValue(true), nil
+		}
+		switch {
+		case !rNull && rb:
+			return boolValue(true), nil
+		case lNull || rNull:
+			return nil, nil
+		}
+		return boolValue(false), nil
+	}
+
+	if lt, ok := x.l.(exprTuple); ok {
+		rt, ok := x.r.(exprTuple)
+		if !ok || len(lt.list) != len(rt.list) {
+			return nil, errors.NotValid.Newf("[memdb] Operand should contain %d column(s)", len(lt.list))
+		}
+		return e.compareTuples(x.op, lt.list, rt.list)
+	}
+
+	l, err := e.eval(x.l)
+	if err != nil {
+		return nil, err
+	}
+	r, err := e.eval(x.r)
+	if err != nil {
+		return nil, err
+	}
+	if x.op == "<=>" {
+		if l == nil || r == nil {
+			return boolValue(l == nil && r == nil), nil
+		}
+		return boolValue(compare(l, r) == 0), nil
+	}
+	if l == nil || r == nil {
+		return nil, nil
+	}
+	switch x.op {
+	case "=", "<>", "<", "<=", ">", ">=":
+		return boolValue(compareOp(x.op, compare(l, r))), nil
+	}
+	return arithmetic(x.op, l, r), nil
+}
+
+// compareTuples compares row constructors lexicographically, e.g.
+// (a,b) > (?,?).
+func (e *env) compareTuples(op string, ls, rs []expr) (interface{}, error) {
+	for i := range ls {
+		l, err := e.eval(ls[i])
+		if err != nil {
+			return nil, err
+		}
+		r, err := e.eval(rs[i])
+		if err != nil {
+			return nil, err
+		}
+		if l == nil || r == nil {
+			return nil, nil
+		}
+		if c := compare(l, r); c != 0 || i == len(ls)-1 {
+			return boolValue(compareOp(op, c)), nil
+		}
+	}
+	return nil, nil
+}
+
+func compareOp(op string, c int) bool {
+	switch op {
+	case "=":
+		return c == 0
+	case "<>":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func equal(a, b interface{}) (interface{}, error) {
+	if a == nil || b == nil {
+		return nil, nil
+	}
+	return boolValue(compare(a, b) == 0), nil
+}
+
+func scale(v interface{}) int {
+	switch v := v.(type) {
+	case decimal:
+		if i := strings.IndexByte(string(v), '.'); i >= 0 {
+			return len(v) - i - 1
+		}
+	case string:
+		if i := strings.IndexByte(v, '.'); i >= 0 {
+			return len(v) - i - 1
+		}
+	}
+	return 0
+}
+
+func arithmetic(op string, l, r interface{}) interface{} {
+	switch op {
+	case "+", "-", "*":
+		if li, ok := l.(int64); ok {
+			if ri, ok := r.(int64); ok {
+				switch op {
+				case "+":
+					return li + ri
+				case "-":
+					return li - ri
+				}
+				return li * ri
+			}
+		}
+		_, lf := l.(float64)
+		_, rf := r.(float64)
+		_, ls := l.(string)
+		_, rs := r.(string)
+		if lf || rf || ls || rs {
+			a, b := toFloat(l), toFloat(r)
+			switch op {
+			case "+":
+				return a + b
+			case "-":
+				return a - b
+			}
+			return a * b
+		}
+		a, b := toRat(l), toRat(r)
+		s := scale(l)
+		switch op {
+		case "+":
+			if scale(r) > s {
+				s = scale(r)
+			}
+			return decimal(a.Add(a, b).FloatString(s))
+		case "-":
+			if scale(r) > s {
+				s = scale(r)
+			}
+			return decimal(a.Sub(a, b).FloatString(s))
+		}
+		return decimal(a.Mul(a, b).FloatString(s + scale(r)))
+	case "/":
+		b := toRat(r)
+		if b.Sign() == 0 {
+			return nil
+		}
+		return decimal(new(big.Rat).Quo(toRat(l), b).FloatString(scale(l) + 4))
+	case "DIV":
+		b := toRat(r)
+		if b.Sign() == 0 {
+			return nil
+		}
+		q := new(big.Rat).Quo(toRat(l), b)
+		return new(big.Int).Quo(q.Num(), q.Denom()).Int64()
+	case "%", "MOD":
+		if isInteger(l) && isInteger(r) {
+			if toInt(r) == 0 {
+				return nil
+			}
+			return toInt(l) % toInt(r)
+		}
+		b := toFloat(r)
+		if b == 0 {
+			return nil
+		}
+		return math.Mod(toFloat(l), b)
+	}
+	return nil
+}
+
+// likeRegexp converts a LIKE pattern into a case insensitive regular
+// expression. The backslash escapes the wildcards.
+func likeRegexp(pattern string) *regexp.Regexp {
+	var buf strings.Builder
+	buf.WriteString("(?is)^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case c == '\\' && i+1 < len(pattern):
+			i++
+			buf.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		case c == '%':
+			buf.WriteString(".*")
+		case c == '_':
+			buf.WriteString(".")
+		default:
+			_, n := utf8.DecodeRuneInString(pattern[i:])
+			buf.WriteString(regexp.QuoteMeta(pattern[i : i+n]))
+			i += n - 1
+		}
+	}
+	buf.WriteString("$")
+	return regexp.MustCompile(buf.String())
+}
+
+// hasAggregate reports whether the expression contains an aggregate function.
+func hasAggregate(x expr) bool {
+	switch x := x.(type) {
+	case exprFunc:
+		if aggregates[x.name] {
+			return true
+		}
+		for _, a := range x.args {
+			if hasAggregate(a) {
+				return true
+			}
+		}
+	case exprUnary:
+		return hasAggregate(x.x)
+	case exprBinary:
+		return hasAggregate(x.l) || hasAggregate(x.r)
+	case exprIsNull:
+		return hasAggregate(x.x)
+	case exprIn:
+		if hasAggregate(x.x) {
+			return true
+		}
+		for _, a := range x.list {
+			if hasAggregate(a) {
+				return true
+			}
+		}
+	case exprBetween:
+		return hasAggregate(x.x) || hasAggregate(x.lo) || hasAggregate(x.hi)
+	case exprLike:
+		return hasAggregate(x.x) || hasAggregate(x.pattern)
+	}
+	return false
+}
+
+func (e *env) function(f exprFunc) (interface{}, error) {
+	if aggregates[f.name] {
+		return e.aggregate(f)
+	}
+
+	args := make([]interface{}, len(f.args))
+	for i, a := range f.args {
+		v, err := e.eval(a)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	argc := func(n int) error {
+		if len(args) != n {
+			return errors.NotValid.Newf("[memdb] Incorrect parameter count in the call to native function '%s'", f.name)
+		}
+		return nil
+	}
+
+	switch f.name {
+	case "NOW", "CURRENT_TIMESTAMP", "LOCALTIMESTAMP", "UTC_TIMESTAMP":
+		return e.now, nil
+	case "CURDATE", "CURRENT_DATE":
+		y, m, d := e.now.Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC), nil
+	case "COALESCE":
+		for _, a := range args {
+			if a != nil {
+				return a, nil
+			}
+		}
+		return nil, nil
+	case "IFNULL":
+		if err := argc(2); err != nil {
+			return nil, err
+		}
+		if args[0] != nil {
+			return args[0], nil
+		}
+		return args[1], nil
+	case "NULLIF":
+		if err := argc(2); err != nil {
+			return nil, err
+		}
+		if args[0] != nil && args[1] != nil && compare(args[0], args[1]) == 0 {
+			return nil, nil
+		}
+		return args[0], nil
+	case "IF":
+		if err := argc(3); err != nil {
+			return nil, err
+		}
+		if b, _ := truth(args[0]); b {
+			return args[1], nil
+		}
+		return args[2], nil
+	case "ISNULL":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		return boolValue(args[0] == nil), nil
+	case "ABS":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		switch v := args[0].(type) {
+		case nil:
+			return nil, nil
+		case int64:
+			if v < 0 {
+				return -v, nil
+			}
+			return v, nil
+		case float64:
+			return math.Abs(v), nil
+		}
+		return decimal(new(big.Rat).Abs(toRat(args[0])).FloatString(scale(args[0]))), nil
+	}
+
+	// string functions return NULL for a NULL argument
+	for _, a := range args {
+		if a == nil && f.name != "CONCAT_WS" {
+			return nil, nil
+		}
+	}
+	switch f.name {
+	case "LOWER", "LCASE", "UPPER", "UCASE", "LENGTH", "CHAR_LENGTH", "TRIM":
+		if err := argc(1); err != nil {
+			return nil, err
+		}
+		s := formatValue(args[0])
+		switch f.name {
+		case "LOWER", "LCASE":
+			return strings.ToLower(s), nil
+		case "UPPER", "UCASE":
+			return strings.ToUpper(s), nil
+		case "LENGTH":
+			return int64(len(s)), nil
+		case "CHAR_LENGTH":
+			return int64(utf8.RuneCountInString(s)), nil
+		}
+		return strings.Trim(s, " "), nil
+	case "CONCAT":
+		var buf strings.Builder
+		for _, a := range args {
+			buf.WriteString(formatValue(a))
+		}
+		return buf.String(), nil
+	case "CONCAT_WS":
+		if len(args) == 0 || args[0] == nil {
+			return nil, nil
+		}
+		parts := make([]string, 0, len(args)-1)
+		for _, a := range args[1:] {
+			if a != nil {
+				parts = append(parts, formatValue(a))
+			}
+		}
+		return strings.Join(parts, formatValue(args[0])), nil
+	}
+	return nil, errors.NotSupported.Newf("[memdb] Function %s not supported", f.name)
+}
+
+func (e *env) aggregate(f exprFunc) (interface{}, error) {
+	if !e.grouping {
+		return nil, mysqlErrorf(errInvalidGroupFunc, "Invalid use of group function")
+	}
+	if f.star {
+		return int64(len(e.group)), nil
+	}
+	if len(f.args) != 1 {
+		return nil, errors.NotValid.Newf("[memdb] Incorrect parameter count in the call to function '%s'", f.name)
+	}
+
+	var vals []interface{}
+	seen := map[string]bool{}
+	for _, row := range e.group {
+		re := &env{t: e.t, row: row, args: e.args, now: e.now}
+		v, err := re.eval(f.args[0])
+		if err != nil {
+			return nil, err
+		}
+		if v == nil {
+			continue
+		}
+		if f.distinct {
+			k := keyString([]interface{}{v})
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+		}
+		vals = append(vals, v)
+	}
+
+	if f.name == "COUNT" {
+		return int64(len(vals)), nil
+	}
+	if len(vals) == 0 {
+		return nil, nil
+	}
+	switch f.name {
+	case "MIN", "MAX":
+		m := vals[0]
+		for _, v := range vals[1:] {
+			if c := compare(v, m); (f.name == "MIN" && c < 0) || (f.name == "MAX" && c > 0) {
+				m = v
+			}
+		}
+		return m, nil
+	}
+
+	sum := vals[0]
+	for _, v := range vals[1:] {
+		sum = arithmetic("+", sum, v)
+	}
+	if f.name == "SUM" {
+		return sum, nil
+	}
+	// AVG
+	if f, ok := sum.(float64); ok {
+		return f / float64(len(vals)), nil
+	}
+	return arithmetic("/", sum, int64(len(vals))), nil
+}
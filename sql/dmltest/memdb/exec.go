@@ -0,0 +1,782 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"encoding/json"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/corestoreio/pkg/sql/ddl"
+)
+
+// table contains the rows of a table in the order of the columns.
+type table struct {
+	name    string
+	cols    ddl.Columns
+	idx     map[string]int
+	pk      []int
+	uniques []uniqueKey
+	autoInc int // index of the auto increment column or -1
+	lastID  uint64
+	rows    [][]interface{}
+}
+
+type uniqueKey struct {
+	name string
+	cols []int
+}
+
+func newTable(t *ddl.Table) *table {
+	mt := &table{
+		name:    t.Name,
+		cols:    t.Columns,
+		idx:     make(map[string]int, len(t.Columns)),
+		autoInc: -1,
+	}
+	for i, c := range t.Columns {
+		mt.idx[strings.ToLower(c.Field)] = i
+		switch {
+		case c.IsPK():
+			mt.pk = append(mt.pk, i)
+		case c.IsUnique():
+			mt.uniques = append(mt.uniques, uniqueKey{name: c.Field, cols: []int{i}})
+		}
+		if c.IsAutoIncrement() {
+			mt.autoInc = i
+		}
+	}
+	if len(mt.pk) > 0 {
+		mt.uniques = append([]uniqueKey{{name: "PRIMARY", cols: mt.pk}}, mt.uniques...)
+	}
+	return mt
+}
+
+// index returns the position of a column, case insensitive.
+func (t *table) index(name string) (int, bool) {
+	i, ok := t.idx[strings.ToLower(name)]
+	return i, ok
+}
+
+// sortedRows returns the rows ordered by the primary key, like InnoDB does.
+func (t *table) sortedRows() [][]interface{} {
+	rows := make([][]interface{}, len(t.rows))
+	copy(rows, t.rows)
+	if len(t.pk) > 0 {
+		sort.SliceStable(rows, func(i, j int) bool {
+			for _, k := range t.pk {
+				if c := compareNullable(rows[i][k], rows[j][k]); c != 0 {
+					return c < 0
+				}
+			}
+			return false
+		})
+	}
+	return rows
+}
+
+// conflict returns the position of the first row which has the same value in
+// a unique key as the row. The row at position skip gets ignored.
+func (t *table) conflict(row []interface{}, skip int) (int, error) {
+	for _, uk := range t.uniques {
+		vals := make([]interface{}, len(uk.cols))
+		null := false
+		for i, c := range uk.cols {
+			vals[i] = row[c]
+			null = null || row[c] == nil
+		}
+		if null {
+			continue
+		}
+		key := keyString(vals)
+		for ri, r := range t.rows {
+			if ri == skip {
+				continue
+			}
+			other := make([]interface{}, len(uk.cols))
+			for i, c := range uk.cols {
+				other[i] = r[c]
+			}
+			if keyString(other) == key {
+				entries := make([]string, len(vals))
+				for i, v := range vals {
+					entries[i] = formatValue(v)
+				}
+				return ri, mysqlErrorf(errDupEntry, "Duplicate entry '%s' for key '%s'", strings.Join(entries, "-"), uk.name)
+			}
+		}
+	}
+	return -1, nil
+}
+
+// defaultValue returns the value of a column, which has been omitted in the
+// INSERT statement.
+func (t *table) defaultValue(c *ddl.Column, now time.Time) (interface{}, error) {
+	if !c.Default.Valid {
+		if !c.IsNull() && !c.IsAutoIncrement() {
+			return nil, mysqlErrorf(errNoDefault, "Field '%s' doesn't have a default value", c.Field)
+		}
+		return nil, nil
+	}
+	d := c.Default.String
+	switch {
+	case strings.EqualFold(d, "NULL"):
+		return nil, nil
+	case c.IsCurrentTimestamp(), strings.HasPrefix(strings.ToLower(d), "current_timestamp"):
+		return coerce(c, now)
+	case len(d) > 1 && d[0] == '\'' && d[len(d)-1] == '\'':
+		// MariaDB quotes the default values
+		d = strings.Replace(d[1:len(d)-1], "''", "'", -1)
+	}
+	return coerce(c, d)
+}
+
+func isOnUpdateCurrentTimestamp(c *ddl.Column) bool {
+	return strings.Contains(strings.ToLower(c.Extra), "on update current_timestamp")
+}
+
+// assign sets the value of a column in a row, with type conversion and NOT
+// NULL check.
+func (t *table) assign(row []interface{}, i int, v interface{}) error {
+	c := t.cols[i]
+	v, err := coerce(c, v)
+	if err != nil {
+		return err
+	}
+	if v == nil && !c.IsNull() && i != t.autoInc {
+		return mysqlErrorf(errBadNull, "Column '%s' cannot be null", c.Field)
+	}
+	row[i] = v
+	return nil
+}
+
+// nextID assigns the auto increment value, if the row does not contain one.
+// It reports whether an ID has been generated.
+func (t *table) nextID(row []interface{}) (uint64, bool) {
+	if t.autoInc < 0 {
+		return 0, false
+	}
+	if v := row[t.autoInc]; v != nil && toRat(v).Sign() != 0 {
+		if id := uint64(toInt(v)); id > t.lastID {
+			t.lastID = id
+		}
+		return uint64(toInt(v)), false
+	}
+	t.lastID++
+	row[t.autoInc] = int64(t.lastID)
+	return t.lastID, true
+}
+
+// result implements driver.Result.
+type result struct {
+	lastInsertID int64
+	rowsAffected int64
+}
+
+func (r result) LastInsertId() (int64, error) { return r.lastInsertID, nil }
+func (r result) RowsAffected() (int64, error) { return r.rowsAffected, nil }
+
+// resultSet contains the rows of a SELECT statement.
+type resultSet struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// executor runs a statement. The caller must hold the lock of the DB.
+type executor struct {
+	db   *DB
+	args []interface{}
+	now  time.Time
+}
+
+func (ex *executor) table(name string) (*table, error) {
+	t, ok := ex.db.tables[name]
+	if !ok {
+		return nil, mysqlErrorf(errNoSuchTable, "Table '%s' doesn't exist", name)
+	}
+	return t, nil
+}
+
+func (ex *executor) env(t *table, row []interface{}) *env {
+	return &env{t: t, row: row, args: ex.args, now: ex.now}
+}
+
+// where returns the rows which match the condition, ordered and limited.
+func (ex *executor) where(t *table, cond expr, orderBy []orderItem, limit expr) ([][]interface{}, error) {
+	var rows [][]interface{}
+	for _, r := range t.sortedRows() {
+		if cond != nil {
+			v, err := ex.env(t, r).eval(cond)
+			if err != nil {
+				return nil, err
+			}
+			if b, _ := truth(v); !b {
+				continue
+			}
+		}
+		rows = append(rows, r)
+	}
+
+	if len(orderBy) > 0 {
+		envs := make([]*env, len(rows))
+		for i, r := range rows {
+			envs[i] = ex.env(t, r)
+		}
+		keys, err := sortKeys(envs, orderBy, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		sortByKeys(rows, keys, orderBy)
+	}
+
+	if limit != nil {
+		n, err := ex.rowCount(limit, "LIMIT", len(rows))
+		if err != nil {
+			return nil, err
+		}
+		rows = rows[:n]
+	}
+	return rows, nil
+}
+
+// rowCount evaluates the value of a LIMIT or OFFSET clause. Values larger than
+// max, e.g. LIMIT 18446744073709551615, get clamped to max. Negative values
+// and NULL return the MySQL error 1210.
+func (ex *executor) rowCount(x expr, clause string, max int) (int, error) {
+	v, err := ex.env(nil, nil).eval(x)
+	if err != nil {
+		return 0, err
+	}
+	if v == nil {
+		return 0, mysqlErrorf(errWrongArguments, "Incorrect arguments to %s", clause)
+	}
+	r := toRat(v)
+	if r.Sign() < 0 {
+		return 0, mysqlErrorf(errWrongArguments, "Incorrect arguments to %s", clause)
+	}
+	if r.Cmp(new(big.Rat).SetInt64(int64(max))) >= 0 {
+		return max, nil
+	}
+	return int(toInt(v)), nil
+}
+
+// sortKeys evaluates the ORDER BY expressions. An expression can refer to an
+// alias or the position of a selected column. A position outside of the
+// selected columns returns error 1054 like MySQL.
+func sortKeys(envs []*env, orderBy []orderItem, aliases []string, out [][]interface{}) ([][]interface{}, error) {
+	if out != nil {
+		for _, o := range orderBy {
+			if lit, ok := o.x.(exprLit); ok {
+				if n, ok := lit.val.(int64); ok && (n < 1 || int(n) > len(aliases)) {
+					return nil, mysqlErrorf(errBadField, "Unknown column '%d' in 'order clause'", n)
+				}
+			}
+		}
+	}
+	keys := make([][]interface{}, len(envs))
+	for i, e := range envs {
+		keys[i] = make([]interface{}, len(orderBy))
+		for j, o := range orderBy {
+			if out != nil {
+				if lit, ok := o.x.(exprLit); ok {
+					if n, ok := lit.val.(int64); ok {
+						keys[i][j] = out[i][n-1]
+						continue
+					}
+				}
+				if c, ok := o.x.(exprCol); ok {
+					if k := aliasIndex(aliases, c.name); k >= 0 {
+						keys[i][j] = out[i][k]
+						continue
+					}
+				}
+			}
+			v, err := e.eval(o.x)
+			if err != nil {
+				return nil, err
+			}
+			keys[i][j] = v
+		}
+	}
+	return keys, nil
+}
+
+func aliasIndex(aliases []string, name string) int {
+	for i, a := range aliases {
+		if strings.EqualFold(a, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortByKeys sorts the rows with the keys from sortKeys.
+func sortByKeys(rows [][]interface{}, keys [][]interface{}, orderBy []orderItem) {
+	idx := make([]int, len(rows))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		for j, o := range orderBy {
+			c := compareNullable(keys[idx[a]][j], keys[idx[b]][j])
+			if o.desc {
+				c = -c
+			}
+			if c != 0 {
+				return c < 0
+			}
+		}
+		return false
+	})
+	sorted := make([][]interface{}, len(rows))
+	for i, k := range idx {
+		sorted[i] = rows[k]
+	}
+	copy(rows, sorted)
+}
+
+func (ex *executor) selectRows(s *selectStmt) (*resultSet, error) {
+	var t *table
+	source := [][]interface{}{nil}
+	if s.table != "" {
+		var err error
+		if t, err = ex.table(s.table); err != nil {
+			return nil, err
+		}
+		if source, err = ex.where(t, s.where, nil, nil); err != nil {
+			return nil, err
+		}
+	} else if s.where != nil {
+		v, err := ex.env(nil, nil).eval(s.where)
+		if err != nil {
+			return nil, err
+		}
+		if b, _ := truth(v); !b {
+			source = nil
+		}
+	}
+
+	grouping := len(s.groupBy) > 0 || s.having != nil
+	for _, it := range s.items {
+		grouping = grouping || hasAggregate(it.x)
+	}
+
+	var envs []*env
+	switch {
+	case !grouping:
+		for _, r := range source {
+			envs = append(envs, ex.env(t, r))
+		}
+	case len(s.groupBy) == 0:
+		e := ex.env(t, nil)
+		e.grouping, e.group = true, source
+		if len(source) > 0 {
+			e.row = source[0]
+		}
+		envs = append(envs, e)
+	default:
+		groups := map[string]*env{}
+		for _, r := range source {
+			re := ex.env(t, r)
+			vals := make([]interface{}, len(s.groupBy))
+			for i, g := range s.groupBy {
+				v, err := re.eval(g)
+				if err != nil {
+					return nil, err
+				}
+				vals[i] = v
+			}
+			k := keyString(vals)
+			e, ok := groups[k]
+			if !ok {
+				e = re
+				e.grouping = true
+				groups[k] = e
+				envs = append(envs, e)
+			}
+			e.group = append(e.group, r)
+		}
+	}
+
+	if s.having != nil {
+		filtered := envs[:0]
+		for _, e := range envs {
+			v, err := e.eval(s.having)
+			if err != nil {
+				return nil, err
+			}
+			if b, _ := truth(v); b {
+				filtered = append(filtered, e)
+			}
+		}
+		envs = filtered
+	}
+
+	rs := &resultSet{}
+	for _, it := range s.items {
+		if !it.star {
+			rs.columns = append(rs.columns, it.alias)
+			continue
+		}
+		if t == nil {
+			return nil, mysqlErrorf(errNoTablesUsed, "No tables used")
+		}
+		for _, c := range t.cols {
+			rs.columns = append(rs.columns, c.Field)
+		}
+	}
+
+	out := make([][]interface{}, 0, len(envs))
+	for _, e := range envs {
+		row := make([]interface{}, 0, len(rs.columns))
+		for _, it := range s.items {
+			if it.star {
+				if e.row == nil {
+					row = append(row, make([]interface{}, len(t.cols))...)
+				} else {
+					row = append(row, e.row...)
+				}
+				continue
+			}
+			v, err := e.eval(it.x)
+			if err != nil {
+				return nil, err
+			}
+			row = append(row, v)
+		}
+		out = append(out, row)
+	}
+
+	if len(s.orderBy) > 0 {
+		keys, err := sortKeys(envs, s.orderBy, rs.columns, out)
+		if err != nil {
+			return nil, err
+		}
+		sortByKeys(out, keys, s.orderBy)
+	}
+
+	if s.distinct {
+		seen := map[string]bool{}
+		unique := out[:0]
+		for _, r := range out {
+			if k := keyString(r); !seen[k] {
+				seen[k] = true
+				unique = append(unique, r)
+			}
+		}
+		out = unique
+	}
+
+	if s.offset != nil {
+		n, err := ex.rowCount(s.offset, "OFFSET", len(out))
+		if err != nil {
+			return nil, err
+		}
+		if out = out[n:]; len(out) == 0 {
+			out = nil
+		}
+	}
+	if s.limit != nil {
+		n, err := ex.rowCount(s.limit, "LIMIT", len(out))
+		if err != nil {
+			return nil, err
+		}
+		out = out[:n]
+	}
+	rs.rows = out
+	return rs, nil
+}
+
+func (ex *executor) insert(s *insertStmt) (_ result, err error) {
+	t, err := ex.table(s.table)
+	if err != nil {
+		return result{}, err
+	}
+	// statements are atomic
+	prev := append([][]interface{}(nil), t.rows...)
+	defer func() {
+		if err != nil {
+			t.rows = prev
+		}
+	}()
+
+	cols := make([]int, 0, len(t.cols))
+	if len(s.columns) == 0 {
+		for i := range t.cols {
+			cols = append(cols, i)
+		}
+	}
+	for _, name := range s.columns {
+		i, ok := t.index(name)
+		if !ok {
+			return result{}, mysqlErrorf(errBadField, "Unknown column '%s' in 'field list'", name)
+		}
+		cols = append(cols, i)
+	}
+
+	var values [][]interface{}
+	if s.from != nil {
+		rs, err := ex.selectRows(s.from)
+		if err != nil {
+			return result{}, err
+		}
+		values = rs.rows
+	}
+	for _, row := range s.rows {
+		vals := make([]interface{}, len(row))
+		for i, x := range row {
+			if vals[i], err = ex.env(t, nil).eval(x); err != nil {
+				return result{}, err
+			}
+		}
+		values = append(values, vals)
+	}
+
+	var res result
+	var explicitID int64
+	for rowNum, vals := range values {
+		if len(vals) != len(cols) {
+			return result{}, mysqlErrorf(errValueCount, "Column count doesn't match value count at row %d", rowNum+1)
+		}
+		row := make([]interface{}, len(t.cols))
+		set := make([]bool, len(t.cols))
+		for i, c := range cols {
+			if err := t.assign(row, c, vals[i]); err != nil {
+				return result{}, err
+			}
+			set[c] = true
+		}
+		for i, c := range t.cols {
+			if !set[i] {
+				if row[i], err = t.defaultValue(c, ex.now); err != nil {
+					return result{}, err
+				}
+			}
+		}
+		id, generated := t.nextID(row)
+		switch {
+		case generated && res.lastInsertID == 0:
+			res.lastInsertID = int64(id)
+		case !generated && explicitID == 0:
+			explicitID = int64(id)
+		}
+
+		pos, dupErr := t.conflict(row, -1)
+		switch {
+		case dupErr == nil:
+			t.rows = append(t.rows, row)
+			res.rowsAffected++
+
+		case s.replace:
+			for ; dupErr != nil; pos, dupErr = t.conflict(row, -1) {
+				t.rows = append(t.rows[:pos:pos], t.rows[pos+1:]...)
+				res.rowsAffected++
+			}
+			t.rows = append(t.rows, row)
+			res.rowsAffected++
+
+		case len(s.onDup) > 0:
+			old := t.rows[pos]
+			e := ex.env(t, append([]interface{}(nil), old...))
+			e.values = row
+			n, err := ex.update(t, pos, e, s.onDup)
+			if err != nil {
+				return result{}, err
+			}
+			res.rowsAffected += 2 * n
+			if t.autoInc >= 0 && res.lastInsertID == 0 {
+				res.lastInsertID = toInt(t.rows[pos][t.autoInc])
+			}
+
+		case s.ignore:
+			// MySQL only raises a warning
+
+		default:
+			return result{}, dupErr
+		}
+	}
+	if res.lastInsertID == 0 && res.rowsAffected > 0 {
+		res.lastInsertID = explicitID
+	}
+	return res, nil
+}
+
+// update applies the assignments from left to right to the row at position
+// pos. e.row must contain a copy of the row. It returns one if the row has
+// been changed.
+func (ex *executor) update(t *table, pos int, e *env, set []assignment) (int64, error) {
+	old, row := t.rows[pos], e.row
+	assigned := make([]bool, len(t.cols))
+	for _, a := range set {
+		i, ok := t.index(a.col)
+		if !ok {
+			return 0, mysqlErrorf(errBadField, "Unknown column '%s' in 'field list'", a.col)
+		}
+		v, err := e.eval(a.x)
+		if err != nil {
+			return 0, err
+		}
+		if err := t.assign(row, i, v); err != nil {
+			return 0, err
+		}
+		assigned[i] = true
+	}
+
+	changed := false
+	for i := range row {
+		changed = changed || !sameValue(old[i], row[i])
+	}
+	if !changed {
+		return 0, nil
+	}
+	for i, c := range t.cols {
+		if !assigned[i] && isOnUpdateCurrentTimestamp(c) {
+			row[i], _ = coerce(c, ex.now)
+		}
+	}
+	if t.autoInc >= 0 && row[t.autoInc] != nil {
+		if id := uint64(toInt(row[t.autoInc])); id > t.lastID {
+			t.lastID = id
+		}
+	}
+	if _, err := t.conflict(row, pos); err != nil {
+		return 0, err
+	}
+	t.rows[pos] = row
+	return 1, nil
+}
+
+func (ex *executor) updateRows(s *updateStmt) (_ result, err error) {
+	t, err := ex.table(s.table)
+	if err != nil {
+		return result{}, err
+	}
+	prev := append([][]interface{}(nil), t.rows...)
+	defer func() {
+		if err != nil {
+			t.rows = prev
+		}
+	}()
+
+	rows, err := ex.where(t, s.where, s.orderBy, s.limit)
+	if err != nil {
+		return result{}, err
+	}
+	var res result
+	for _, r := range rows {
+		pos := rowIndex(t.rows, r)
+		n, err := ex.update(t, pos, ex.env(t, append([]interface{}(nil), r...)), s.set)
+		if err != nil {
+			return result{}, err
+		}
+		res.rowsAffected += n
+	}
+	return res, nil
+}
+
+func (ex *executor) deleteRows(s *deleteStmt) (result, error) {
+	t, err := ex.table(s.table)
+	if err != nil {
+		return result{}, err
+	}
+	rows, err := ex.where(t, s.where, s.orderBy, s.limit)
+	if err != nil {
+		return result{}, err
+	}
+	for _, r := range rows {
+		pos := rowIndex(t.rows, r)
+		t.rows = append(t.rows[:pos:pos], t.rows[pos+1:]...)
+	}
+	return result{rowsAffected: int64(len(rows))}, nil
+}
+
+// explain returns a plan in the format of EXPLAIN FORMAT=JSON with a full
+// table scan, because there are no indexes.
+func (ex *executor) explain(s *explainStmt) (*resultSet, error) {
+	var name string
+	switch s := s.stmt.(type) {
+	case *selectStmt:
+		name = s.table
+	case *insertStmt:
+		name = s.table
+	case *updateStmt:
+		name = s.table
+	case *deleteStmt:
+		name = s.table
+	}
+	t, err := ex.table(name)
+	if err != nil {
+		return nil, err
+	}
+	type plan struct {
+		TableName  string `json:"table_name"`
+		AccessType string `json:"access_type"`
+		Rows       int    `json:"rows_examined_per_scan"`
+	}
+	var qb struct {
+		QueryBlock struct {
+			SelectID int  `json:"select_id"`
+			Table    plan `json:"table"`
+		} `json:"query_block"`
+	}
+	qb.QueryBlock.SelectID = 1
+	qb.QueryBlock.Table = plan{TableName: t.name, AccessType: "ALL", Rows: len(t.rows)}
+	j, err := json.Marshal(qb)
+	if err != nil {
+		return nil, err
+	}
+	return &resultSet{columns: []string{"EXPLAIN"}, rows: [][]interface{}{{string(j)}}}, nil
+}
+
+// rowIndex finds the position of a row by its identity.
+func rowIndex(rows [][]interface{}, row []interface{}) int {
+	for i, r := range rows {
+		if len(r) > 0 && &r[0] == &row[0] {
+			return i
+		}
+	}
+	return -1
+}
+
+// snapshot contains the state of all tables for a transaction or a save
+// point.
+type snapshot map[string]tableState
+
+type tableState struct {
+	rows   [][]interface{}
+	lastID uint64
+}
+
+// snapshot copies the rows of all tables. Rows never get modified in place,
+// so copying the slices suffices.
+func (db *DB) snapshot() snapshot {
+	s := make(snapshot, len(db.tables))
+	for name, t := range db.tables {
+		s[name] = tableState{rows: append([][]interface{}(nil), t.rows...), lastID: t.lastID}
+	}
+	return s
+}
+
+// restore resets all tables to the snapshot. The auto increment values do
+// not get reset, like in InnoDB.
+func (db *DB) restore(s snapshot) {
+	for name, ts := range s {
+		if t, ok := db.tables[name]; ok {
+			t.rows = append([][]interface{}(nil), ts.rows...)
+		}
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"encoding/hex"
+	"strings"
+
+	"github.com/corestoreio/errors"
+)
+
+type tokenKind uint8
+
+const (
+	tkEOF tokenKind = iota
+	tkIdent
+	tkQuotedIdent
+	tkString
+	tkNumber
+	tkPlaceholder
+	tkSymbol
+)
+
+type token struct {
+	kind tokenKind
+	val  string
+	// pos and end contain the byte offsets in the SQL string.
+	pos, end int
+}
+
+// is reports whether the token is the keyword or symbol, case insensitive.
+func (t token) is(s string) bool {
+	return (t.kind == tkIdent || t.kind == tkSymbol) && strings.EqualFold(t.val, s)
+}
+
+// lex splits a SQL string into tokens. Comments get skipped.
+func lex(sql string) ([]token, error) {
+	var toks []token
+	i := 0
+	for i < len(sql) {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '/' && strings.HasPrefix(sql[i:], "/*"):
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				return nil, errors.NotValid.Newf("[memdb] Unterminated comment in %q", sql)
+			}
+			i += end + 4
+		case c == '#' || (c == '-' && strings.HasPrefix(sql[i:], "-- ")):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end < 0 {
+				end = len(sql) - i
+			}
+			i += end
+		case c == '`':
+			var buf strings.Builder
+			j := i + 1
+			for ; j < len(sql); j++ {
+				if sql[j] == '`' {
+					if j+1 < len(sql) && sql[j+1] == '`' {
+						buf.WriteByte('`')
+						j++
+						continue
+					}
+					break
+				}
+				buf.WriteByte(sql[j])
+			}
+			if j >= len(sql) {
+				return nil, errors.NotValid.Newf("[memdb] Unterminated identifier in %q", sql)
+			}
+			toks = append(toks, token{kind: tkQuotedIdent, val: buf.String(), pos: i, end: j + 1})
+			i = j + 1
+		case c == '\'' || c == '"':
+			s, n, err := lexString(sql[i:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "[memdb] In %q", sql)
+			}
+			toks = append(toks, token{kind: tkString, val: s, pos: i, end: i + n})
+			i += n
+		case c == '0' && i+1 < len(sql) && (sql[i+1] == 'x' || sql[i+1] == 'X'):
+			j := i + 2
+			for j < len(sql) && isHex(sql[j]) {
+				j++
+			}
+			b, err := hex.DecodeString(sql[i+2 : j])
+			if err != nil {
+				return nil, errors.NotValid.New(err, "[memdb] Invalid hex literal in %q", sql)
+			}
+			toks = append(toks, token{kind: tkString, val: string(b), pos: i, end: j})
+			i = j
+		case isDigit(c) || (c == '.' && i+1 < len(sql) && isDigit(sql[i+1])):
+			j := i
+			for j < len(sql) && (isDigit(sql[j]) || sql[j] == '.') {
+				j++
+			}
+			if j < len(sql) && (sql[j] == 'e' || sql[j] == 'E') {
+				j++
+				if j < len(sql) && (sql[j] == '+' || sql[j] == '-') {
+					j++
+				}
+				for j < len(sql) && isDigit(sql[j]) {
+					j++
+				}
+			}
+			toks = append(toks, token{kind: tkNumber, val: sql[i:j], pos: i, end: j})
+			i = j
+		case isIdentChar(c):
+			j := i
+			for j < len(sql) && isIdentChar(sql[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tkIdent, val: sql[i:j], pos: i, end: j})
+			i = j
+		case c == '?':
+			toks = append(toks, token{kind: tkPlaceholder, val: "?", pos: i, end: i + 1})
+			i++
+		default:
+			n := 1
+			if strings.HasPrefix(sql[i:], "<=>") {
+				n = 3
+			} else if i+1 < len(sql) {
+				switch sql[i : i+2] {
+				case "<=", ">=", "<>", "!=", "||", "&&":
+					n = 2
+				}
+			}
+			if !strings.ContainsRune("(),.=<>*+-/%;!", rune(c)) {
+				return nil, errors.NotSupported.Newf("[memdb] Unexpected character %q at position %d in %q", c, i, sql)
+			}
+			toks = append(toks, token{kind: tkSymbol, val: sql[i : i+n], pos: i, end: i + n})
+			i += n
+		}
+	}
+	return append(toks, token{kind: tkEOF, pos: len(sql), end: len(sql)}), nil
+}
+
+// lexString decodes a quoted string with the MySQL escape sequences and
+// returns the number of consumed bytes.
+func lexString(s string) (string, int, error) {
+	quote := s[0]
+	var buf strings.Builder
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch s[i] {
+			case '0':
+				buf.WriteByte(0)
+			case 'n':
+				buf.WriteByte('\n')
+			case 'r':
+				buf.WriteByte('\r')
+			case 't':
+				buf.WriteByte('\t')
+			case 'b':
+				buf.WriteByte('\b')
+			case 'Z':
+				buf.WriteByte(0x1a)
+			case '%', '_':
+				// stays escaped for the LIKE pattern
+				buf.WriteByte('\\')
+				buf.WriteByte(s[i])
+			default:
+				buf.WriteByte(s[i])
+			}
+		case c == quote && i+1 < len(s) && s[i+1] == quote:
+			buf.WriteByte(quote)
+			i++
+		case c == quote:
+			return buf.String(), i + 1, nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", 0, errors.NotValid.Newf("[memdb] Unterminated string")
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+func isHex(c byte) bool {
+	return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,419 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/dmltest/memdb"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/util/assert"
+	"github.com/go-sql-driver/mysql"
+)
+
+var now = time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+
+type customer struct {
+	ID      uint64
+	Email   string
+	Name    null.String
+	Balance float64
+	Created time.Time
+	Code    null.String
+}
+
+func (c *customer) AssignLastInsertID(id int64) { c.ID = uint64(id) }
+
+func (c *customer) MapColumns(cm *dml.ColumnMap) error {
+	for cm.Next() {
+		switch col := cm.Column(); col {
+		case "id":
+			cm.Uint64(&c.ID)
+		case "email":
+			cm.String(&c.Email)
+		case "name":
+			cm.NullString(&c.Name)
+		case "balance":
+			cm.Float64(&c.Balance)
+		case "created_at":
+			cm.Time(&c.Created)
+		case "code":
+			cm.NullString(&c.Code)
+		default:
+			return errors.NotFound.Newf("[memdb_test] Column %q not found", col)
+		}
+	}
+	return cm.Err()
+}
+
+type customers struct {
+	Data []*customer
+}
+
+func (cc *customers) MapColumns(cm *dml.ColumnMap) error {
+	if cm.Mode() != dml.ColumnMapScan {
+		return errors.NotSupported.Newf("[memdb_test] Mode %q not supported", string(cm.Mode()))
+	}
+	c := new(customer)
+	if err := c.MapColumns(cm); err != nil {
+		return errors.WithStack(err)
+	}
+	cc.Data = append(cc.Data, c)
+	return nil
+}
+
+func newTables(t *testing.T) *ddl.Tables {
+	tbls, err := ddl.NewTables(ddl.WithTable("customer",
+		&ddl.Column{Field: "id", Pos: 1, Null: "NO", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI", Extra: "auto_increment"},
+		&ddl.Column{Field: "email", Pos: 2, Null: "NO", DataType: "varchar", ColumnType: "varchar(64)", Key: "MUL"},
+		&ddl.Column{Field: "name", Pos: 3, Null: "YES", DataType: "varchar", ColumnType: "varchar(16)"},
+		&ddl.Column{Field: "balance", Pos: 4, Default: null.MakeString("0.0000"), Null: "NO", DataType: "decimal", ColumnType: "decimal(12,4)"},
+		&ddl.Column{Field: "created_at", Pos: 5, Default: null.MakeString("CURRENT_TIMESTAMP"), Null: "NO", DataType: "timestamp", ColumnType: "timestamp"},
+		&ddl.Column{Field: "code", Pos: 6, Null: "YES", DataType: "varchar", ColumnType: "varchar(8)", Key: "UNI"},
+	))
+	dmltest.FatalIfError(t, err)
+	return tbls
+}
+
+func newDB(t *testing.T) (*dml.ConnPool, *memdb.DB, *ddl.Table) {
+	tbls := newTables(t)
+	dbc, mdb := memdb.MockDB(t, tbls)
+	mdb.Now = func() time.Time { return now }
+	return dbc, mdb, tbls.MustTable("customer")
+}
+
+func insertCustomers(t *testing.T, tbl *ddl.Table, cs ...*customer) {
+	ins := tbl.Insert().WithArgs()
+	for _, c := range cs {
+		ins.Record("", c)
+	}
+	_, err := ins.ExecContext(context.Background())
+	dmltest.FatalIfError(t, err)
+}
+
+func mysqlErrNumber(err error) uint16 {
+	if me, ok := errors.Cause(err).(*mysql.MySQLError); ok {
+		return me.Number
+	}
+	return 0
+}
+
+func TestNew(t *testing.T) {
+	tbls, err := ddl.NewTables(ddl.WithTable("empty"))
+	assert.NoError(t, err)
+	_, err = memdb.New(tbls)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
+
+func TestDB_Insert_Select(t *testing.T) {
+	dbc, mdb, tbl := newDB(t)
+	defer dmltest.Close(t, dbc)
+	ctx := context.Background()
+
+	c1 := &customer{Email: "gopher@example.com", Name: null.MakeString("Gopher"), Balance: 12.5}
+	c2 := &customer{Email: "alice@example.com", Balance: 3}
+	c3 := &customer{Email: "bob@example.com", Name: null.MakeString("Bob")}
+	insertCustomers(t, tbl, c1, c2, c3)
+	assert.Exactly(t, []uint64{1, 2, 3}, []uint64{c1.ID, c2.ID, c3.ID})
+
+	rows, err := mdb.Rows("customer")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 3)
+	assert.Exactly(t, map[string]interface{}{
+		"id": int64(2), "email": "alice@example.com", "name": nil, "balance": "3.0000", "created_at": time.Time{}, "code": nil,
+	}, rows[1])
+
+	t.Run("SelectByPK", func(t *testing.T) {
+		var c customer
+		found, err := tbl.SelectByPK().WithArgs().Load(ctx, &c, 3)
+		assert.NoError(t, err)
+		assert.Exactly(t, uint64(1), found)
+		assert.Exactly(t, customer{ID: 3, Email: "bob@example.com", Name: null.MakeString("Bob")}, c)
+	})
+
+	t.Run("IN expanded", func(t *testing.T) {
+		var cs customers
+		_, err := tbl.SelectByPK().WithArgs().ExpandPlaceHolders().Int64s(3, 1, 7).Load(ctx, &cs)
+		assert.NoError(t, err)
+		assert.Len(t, cs.Data, 2)
+		assert.Exactly(t, "gopher@example.com", cs.Data[0].Email)
+		assert.Exactly(t, 12.5, cs.Data[0].Balance)
+		assert.Exactly(t, "bob@example.com", cs.Data[1].Email)
+	})
+
+	t.Run("WHERE ORDER BY LIMIT", func(t *testing.T) {
+		emails, err := tbl.Select("email").
+			Where(dml.Column("name").NotNull(), dml.Column("balance").GreaterOrEqual().Float64(0)).
+			OrderByDesc("email").Limit(0, 1).WithArgs().LoadStrings(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []string{"gopher@example.com"}, emails)
+
+		emails, err = tbl.Select("email").Where(dml.Column("email").Like().Str("%O%")).
+			OrderBy("id").Limit(1, 5).WithArgs().LoadStrings(ctx, nil)
+		assert.NoError(t, err)
+		assert.Exactly(t, []string{"alice@example.com", "bob@example.com"}, emails, "case insensitive LIKE")
+	})
+
+	t.Run("COUNT SUM", func(t *testing.T) {
+		cnt, found, err := tbl.Select().Count().WithArgs().LoadNullInt64(ctx)
+		assert.NoError(t, err)
+		assert.True(t, found)
+		assert.Exactly(t, int64(3), cnt.Int64)
+
+		sum, _, err := tbl.Select().AddColumnsConditions(dml.Expr("SUM(`balance`)")).Where(dml.Column("id").In().Int64s(1, 2)).
+			WithArgs().Interpolate().LoadNullFloat64(ctx)
+		assert.NoError(t, err)
+		assert.Exactly(t, 15.5, sum.Float64)
+	})
+
+	t.Run("unknown table", func(t *testing.T) {
+		_, err := dbc.WithQueryBuilder(dml.NewSelect("a").From("unknown")).ExecContext(ctx)
+		assert.Exactly(t, uint16(1146), mysqlErrNumber(err), "%+v", err)
+	})
+
+	mdb.AssertQueryCount(t, "^INSERT INTO `customer`", 1)
+	mdb.AssertQueryCount(t, "^SELECT", 7)
+}
+
+func TestDB_Constraints(t *testing.T) {
+	dbc, mdb, tbl := newDB(t)
+	defer dmltest.Close(t, dbc)
+	insertCustomers(t, tbl, &customer{Email: "gopher@example.com"})
+
+	tests := []struct {
+		c      *customer
+		number uint16
+	}{
+		{&customer{Email: "gopher2@example.com", Name: null.MakeString("A name which is too long")}, 1406},
+		{&customer{Email: "gopher2@example.com", Balance: -5}, 0},
+		{&customer{Email: "gopher3@example.com", Balance: 1e9}, 1264},
+	}
+	for _, test := range tests {
+		_, err := tbl.Insert().WithArgs().Record("", test.c).ExecContext(context.Background())
+		assert.Exactly(t, test.number, mysqlErrNumber(err), "%+v", err)
+	}
+
+	_, err := dbc.DB.Exec("INSERT INTO `customer` (`id`,`email`) VALUES (1,'dup@example.com')")
+	assert.Exactly(t, uint16(1062), mysqlErrNumber(err), "%+v", err)
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`email`,`code`) VALUES ('a@example.com','ABC'),('b@example.com',NULL)")
+	assert.NoError(t, err)
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`email`,`code`) VALUES ('c@example.com','abc')")
+	assert.Exactly(t, uint16(1062), mysqlErrNumber(err), "case insensitive unique key: %+v", err)
+	_, err = dbc.DB.Exec("INSERT IGNORE INTO `customer` (`email`,`code`) VALUES ('c@example.com','abc')")
+	assert.NoError(t, err)
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`email`) VALUES (NULL)")
+	assert.Exactly(t, uint16(1048), mysqlErrNumber(err), "%+v", err)
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`id`,`email`) VALUES (-1,'neg@example.com')")
+	assert.Exactly(t, uint16(1264), mysqlErrNumber(err), "%+v", err)
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`name`) VALUES ('Nobody')")
+	assert.Exactly(t, uint16(1364), mysqlErrNumber(err), "%+v", err)
+	_, err = dbc.DB.Exec("SELECT * FROM `customer` AS `c` INNER JOIN `customer` AS `d`")
+	assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+
+	// failed multi row statements are atomic
+	_, err = dbc.DB.Exec("INSERT INTO `customer` (`email`,`code`) VALUES ('x@example.com','x'),('y@example.com','ABC')")
+	assert.Exactly(t, uint16(1062), mysqlErrNumber(err), "%+v", err)
+
+	rows, err := mdb.Rows("customer")
+	assert.NoError(t, err)
+	assert.Len(t, rows, 4)
+	assert.Exactly(t, map[string]interface{}{
+		"id": int64(3), "email": "a@example.com", "name": nil, "balance": "0.0000", "created_at": now, "code": "ABC",
+	}, rows[2], "default values")
+}
+
+func TestDB_LimitOffset(t *testing.T) {
+	dbc, _, tbl := newDB(t)
+	defer dmltest.Close(t, dbc)
+	insertCustomers(t, tbl,
+		&customer{Email: "a@example.com"},
+		&customer{Email: "b@example.com"},
+		&customer{Email: "c@example.com"},
+	)
+
+	loadEmails := func(query string, args ...interface{}) ([]string, error) {
+		rows, err := dbc.DB.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		var emails []string
+		for rows.Next() {
+			var e string
+			if err := rows.Scan(&e); err != nil {
+				return nil, err
+			}
+			emails = append(emails, e)
+		}
+		return emails, rows.Err()
+	}
+
+	emails, err := loadEmails("SELECT `email` FROM `customer` ORDER BY `id` LIMIT 1, 18446744073709551615")
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{"b@example.com", "c@example.com"}, emails)
+
+	emails, err = loadEmails("SELECT `email` FROM `customer` ORDER BY `id` LIMIT ? OFFSET ?", uint64(18446744073709551615), uint64(18446744073709551615))
+	assert.NoError(t, err)
+	assert.Nil(t, emails)
+
+	emails, err = loadEmails("SELECT `email` FROM `customer` ORDER BY 1 DESC LIMIT 1")
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{"c@example.com"}, emails)
+	for _, ordinal := range []string{"0", "2"} {
+		_, err = loadEmails("SELECT `email` FROM `customer` ORDER BY " + ordinal)
+		assert.Exactly(t, uint16(1054), mysqlErrNumber(err), "%+v", err)
+		assert.Contains(t, err.Error(), "Unknown column '"+ordinal+"' in 'order clause'")
+	}
+
+	_, err = loadEmails("SELECT `email` FROM `customer` LIMIT ?", -1)
+	assert.Exactly(t, uint16(1210), mysqlErrNumber(err), "%+v", err)
+	_, err = loadEmails("SELECT `email` FROM `customer` LIMIT 1 OFFSET ?", -1)
+	assert.Exactly(t, uint16(1210), mysqlErrNumber(err), "%+v", err)
+
+	res, err := dbc.DB.Exec("UPDATE `customer` SET `name`='x' ORDER BY `id` LIMIT 18446744073709551615")
+	assert.NoError(t, err)
+	ra, _ := res.RowsAffected()
+	assert.Exactly(t, int64(3), ra)
+	_, err = dbc.DB.Exec("DELETE FROM `customer` LIMIT ?", -1)
+	assert.Exactly(t, uint16(1210), mysqlErrNumber(err), "%+v", err)
+}
+
+func TestDB_Upsert_Update_Delete(t *testing.T) {
+	dbc, mdb, tbl := newDB(t)
+	defer dmltest.Close(t, dbc)
+	ctx := context.Background()
+	insertCustomers(t, tbl,
+		&customer{Email: "a@example.com", Name: null.MakeString("A")},
+		&customer{Email: "b@example.com", Name: null.MakeString("B")},
+	)
+	mdb.ResetQueries()
+
+	t.Run("upsert", func(t *testing.T) {
+		c := &customer{ID: 2, Email: "b@example.com", Name: null.MakeString("B2"), Balance: 1}
+		upsert := dml.NewInsert("customer").AddColumns("id", "email", "name", "balance").OnDuplicateKey().WithDB(dbc.DB)
+		res, err := upsert.WithArgs().Record("", c).ExecContext(ctx)
+		assert.NoError(t, err)
+		ra, _ := res.RowsAffected()
+		assert.Exactly(t, int64(2), ra)
+		id, _ := res.LastInsertId()
+		assert.Exactly(t, int64(2), id)
+
+		res, err = upsert.WithArgs().Record("", c).ExecContext(ctx)
+		assert.NoError(t, err)
+		ra, _ = res.RowsAffected()
+		assert.Exactly(t, int64(0), ra, "unchanged row")
+	})
+
+	t.Run("UpdateByPK", func(t *testing.T) {
+		c := &customer{ID: 1, Email: "a@example.org", Balance: 2.25}
+		res, err := tbl.UpdateByPK().WithArgs().Record("", c).ExecContext(ctx)
+		assert.NoError(t, err)
+		ra, _ := res.RowsAffected()
+		assert.Exactly(t, int64(1), ra)
+
+		res, err = dbc.WithQueryBuilder(dml.NewUpdate("customer").
+			Set(dml.Column("balance").Expr("`balance` + ?").Float64(0.5)).
+			Where(dml.Column("email").Like().Str("%.org"))).ExecContext(ctx)
+		assert.NoError(t, err)
+		ra, _ = res.RowsAffected()
+		assert.Exactly(t, int64(1), ra)
+	})
+
+	t.Run("DeleteByPK", func(t *testing.T) {
+		res, err := tbl.DeleteByPK().WithArgs().ExecContext(ctx, 2)
+		assert.NoError(t, err)
+		ra, _ := res.RowsAffected()
+		assert.Exactly(t, int64(1), ra)
+	})
+
+	rows, err := mdb.Rows("customer")
+	assert.NoError(t, err)
+	assert.Exactly(t, []map[string]interface{}{
+		{"id": int64(1), "email": "a@example.org", "name": nil, "balance": "2.7500", "created_at": time.Time{}, "code": nil},
+	}, rows)
+
+	mdb.AssertQueries(t,
+		"^INSERT INTO `customer` .+ ON DUPLICATE KEY UPDATE",
+		"^INSERT INTO `customer` .+ ON DUPLICATE KEY UPDATE",
+		"^UPDATE `customer` SET `email`=\\?, `name`=\\?, `balance`=\\?, `created_at`=\\? WHERE \\(`id` = \\?\\)$",
+		"^UPDATE `customer` SET `balance`=`balance` \\+ 0.5 WHERE",
+		"^DELETE FROM `customer` WHERE \\(`id` IN \\?\\)$",
+	)
+}
+
+func TestDB_Transaction(t *testing.T) {
+	dbc, mdb, tbl := newDB(t)
+	defer dmltest.Close(t, dbc)
+	ctx := context.Background()
+	insertCustomers(t, tbl, &customer{Email: "a@example.com"})
+	mdb.ResetQueries()
+
+	errRollback := errors.AlreadyClosed.Newf("rollback")
+	err := dbc.Transaction(ctx, nil, func(tx *dml.Tx) error {
+		_, err := tx.WithQueryBuilder(dml.NewDelete("customer")).ExecContext(ctx)
+		assert.NoError(t, err)
+		return errRollback
+	})
+	assert.True(t, errors.AlreadyClosed.Match(err), "%+v", err)
+
+	err = dbc.Transaction(ctx, &sql.TxOptions{}, func(tx *dml.Tx) error {
+		_, err := tx.WithQueryBuilder(dml.NewInsert("customer").AddColumns("email").BuildValues()).ExecContext(ctx, "b@example.com")
+		assert.NoError(t, err)
+
+		_, err = tx.DB.ExecContext(ctx, "SAVEPOINT sp1")
+		assert.NoError(t, err)
+		_, err = tx.WithQueryBuilder(dml.NewInsert("customer").AddColumns("email").BuildValues()).ExecContext(ctx, "c@example.com")
+		assert.NoError(t, err)
+		_, err = tx.DB.ExecContext(ctx, "ROLLBACK TO SAVEPOINT sp1")
+		assert.NoError(t, err)
+		_, err = tx.DB.ExecContext(ctx, "RELEASE SAVEPOINT sp2")
+		assert.Exactly(t, uint16(1305), mysqlErrNumber(err), "%+v", err)
+		return nil
+	})
+	assert.NoError(t, err)
+
+	emails, err := tbl.Select("email").WithArgs().LoadStrings(ctx, nil)
+	assert.NoError(t, err)
+	assert.Exactly(t, []string{"a@example.com", "b@example.com"}, emails)
+
+	mdb.AssertQueries(t, "^BEGIN$", "^DELETE", "^ROLLBACK$", "^BEGIN$", "^INSERT", "^SAVEPOINT", "^INSERT",
+		"^ROLLBACK TO", "^RELEASE", "^COMMIT$", "^SELECT `email`")
+}
+
+func TestDB_Interpolate(t *testing.T) {
+	dbc, mdb, _ := newDB(t)
+	defer dmltest.Close(t, dbc)
+	ctx := context.Background()
+
+	_, err := dbc.WithQueryBuilder(dml.NewInsert("customer").AddColumns("email", "name", "created_at").BuildValues()).
+		String("o'neil@example.com").String("Line\n\"2\"\\").Time(time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC)).
+		Interpolate().ExecContext(ctx)
+	assert.NoError(t, err)
+
+	rows, err := mdb.Rows("customer")
+	assert.NoError(t, err)
+	assert.Exactly(t, map[string]interface{}{
+		"id": int64(1), "email": "o'neil@example.com", "name": "Line\n\"2\"\\", "balance": "0.0000",
+		"created_at": time.Date(2018, 1, 2, 3, 4, 5, 0, time.UTC), "code": nil,
+	}, rows[0])
+	assert.Len(t, mdb.Queries()[0].Args, 0)
+}
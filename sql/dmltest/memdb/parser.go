@@ -0,0 +1,957 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/corestoreio/errors"
+)
+
+// Expressions
+
+type expr interface{}
+
+type (
+	exprLit struct {
+		val interface{}
+	}
+	exprParam struct {
+		idx int
+	}
+	exprCol struct {
+		name string
+	}
+	// exprValues represents VALUES(col) in ON DUPLICATE KEY UPDATE.
+	exprValues struct {
+		name string
+	}
+	exprUnary struct {
+		op string
+		x  expr
+	}
+	exprBinary struct {
+		op   string
+		l, r expr
+	}
+	exprIsNull struct {
+		x   expr
+		not bool
+	}
+	exprIn struct {
+		x    expr
+		list []expr
+		not  bool
+	}
+	exprBetween struct {
+		x, lo, hi expr
+		not       bool
+	}
+	exprLike struct {
+		x, pattern expr
+		not        bool
+	}
+	exprTuple struct {
+		list []expr
+	}
+	exprFunc struct {
+		name     string // upper case
+		args     []expr
+		star     bool
+		distinct bool
+	}
+)
+
+// Statements
+
+type (
+	selectItem struct {
+		x     expr
+		alias string
+		star  bool
+	}
+	orderItem struct {
+		x    expr
+		desc bool
+	}
+	assignment struct {
+		col string
+		x   expr
+	}
+	selectStmt struct {
+		distinct bool
+		items    []selectItem
+		table    string // empty for SELECT without FROM
+		where    expr
+		groupBy  []expr
+		having   expr
+		orderBy  []orderItem
+		limit    expr
+		offset   expr
+	}
+	insertStmt struct {
+		table   string
+		replace bool
+		ignore  bool
+		columns []string
+		rows    [][]expr
+		from    *selectStmt
+		onDup   []assignment
+	}
+	updateStmt struct {
+		table   string
+		set     []assignment
+		where   expr
+		orderBy []orderItem
+		limit   expr
+	}
+	deleteStmt struct {
+		table   string
+		where   expr
+		orderBy []orderItem
+		limit   expr
+	}
+	// txStmt contains BEGIN, COMMIT, ROLLBACK, SAVEPOINT, ROLLBACK TO and
+	// RELEASE.
+	txStmt struct {
+		kind      string
+		savepoint string
+	}
+	// noopStmt gets executed without any effect, e.g. SET NAMES.
+	noopStmt struct{}
+	// explainStmt returns a fake plan for a SELECT, INSERT, UPDATE or DELETE.
+	explainStmt struct {
+		stmt interface{}
+	}
+)
+
+const (
+	txBegin      = "BEGIN"
+	txCommit     = "COMMIT"
+	txRollback   = "ROLLBACK"
+	txSavepoint  = "SAVEPOINT"
+	txRollbackTo = "ROLLBACK TO"
+	txRelease    = "RELEASE"
+)
+
+// aggregates contains the supported aggregate functions.
+var aggregates = map[string]bool{"COUNT": true, "SUM": true, "MIN": true, "MAX": true, "AVG": true}
+
+type parser struct {
+	sql  string
+	toks []token
+	pos  int
+	// params counts the place holders.
+	params int
+}
+
+// parse parses a single SQL statement and returns the statement and the
+// number of place holders.
+func parse(sql string) (interface{}, int, error) {
+	toks, err := lex(sql)
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	p := &parser{sql: sql, toks: toks}
+	stmt, err := p.statement()
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	p.accept(";")
+	if p.peek().kind != tkEOF {
+		return nil, 0, p.errorf("unexpected %q", p.peek().val)
+	}
+	return stmt, p.params, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.pos] }
+
+func (p *parser) peekN(n int) token {
+	if p.pos+n < len(p.toks) {
+		return p.toks[p.pos+n]
+	}
+	return p.toks[len(p.toks)-1]
+}
+
+func (p *parser) next() token {
+	t := p.toks[p.pos]
+	if t.kind != tkEOF {
+		p.pos++
+	}
+	return t
+}
+
+// accept consumes the keywords or symbols if all of them match.
+func (p *parser) accept(words ...string) bool {
+	for i, w := range words {
+		if !p.peekN(i).is(w) {
+			return false
+		}
+	}
+	p.pos += len(words)
+	return true
+}
+
+func (p *parser) expect(words ...string) error {
+	if !p.accept(words...) {
+		return p.errorf("expected %q but got %q", strings.Join(words, " "), p.peek().val)
+	}
+	return nil
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return errors.NotSupported.Newf("[memdb] Failed to parse %q at position %d: "+format, append([]interface{}{p.sql, p.peek().pos}, args...)...)
+}
+
+// ident parses an identifier. Keywords are allowed when quoted.
+func (p *parser) ident() (string, error) {
+	t := p.peek()
+	if t.kind != tkIdent && t.kind != tkQuotedIdent {
+		return "", p.errorf("expected identifier but got %q", t.val)
+	}
+	p.next()
+	return t.val, nil
+}
+
+// tableName parses a maybe database qualified table name and returns the
+// table name.
+func (p *parser) tableName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	if p.accept(".") {
+		return p.ident()
+	}
+	return name, nil
+}
+
+// tableAlias skips an optional table alias.
+func (p *parser) tableAlias() {
+	if p.accept("AS") {
+		p.next()
+		return
+	}
+	if t := p.peek(); t.kind == tkQuotedIdent || (t.kind == tkIdent && !isKeyword(t.val)) {
+		p.next()
+	}
+}
+
+var keywords = map[string]bool{
+	"WHERE": true, "ORDER": true, "GROUP": true, "HAVING": true, "LIMIT": true, "OFFSET": true,
+	"FOR": true, "LOCK": true, "ON": true, "SET": true, "VALUES": true, "JOIN": true, "LEFT": true,
+	"RIGHT": true, "INNER": true, "CROSS": true, "STRAIGHT_JOIN": true, "UNION": true, "FROM": true,
+	"AND": true, "OR": true, "NOT": true, "AS": true, "SELECT": true, "INTO": true, "USING": true,
+	"NATURAL": true, "OUTER": true, "WINDOW": true,
+}
+
+func isKeyword(s string) bool { return keywords[strings.ToUpper(s)] }
+
+func (p *parser) statement() (interface{}, error) {
+	t := p.peek()
+	switch {
+	case t.is("SELECT"):
+		return p.selectStmt()
+	case t.is("INSERT"), t.is("REPLACE"):
+		return p.insertStmt()
+	case t.is("UPDATE"):
+		return p.updateStmt()
+	case t.is("DELETE"):
+		return p.deleteStmt()
+	case t.is("BEGIN"):
+		p.next()
+		p.accept("WORK")
+		return &txStmt{kind: txBegin}, nil
+	case t.is("START"):
+		p.next()
+		if err := p.expect("TRANSACTION"); err != nil {
+			return nil, err
+		}
+		return &txStmt{kind: txBegin}, nil
+	case t.is("COMMIT"):
+		p.next()
+		p.accept("WORK")
+		return &txStmt{kind: txCommit}, nil
+	case t.is("ROLLBACK"):
+		p.next()
+		p.accept("WORK")
+		if !p.accept("TO") {
+			return &txStmt{kind: txRollback}, nil
+		}
+		p.accept("SAVEPOINT")
+		name, err := p.ident()
+		return &txStmt{kind: txRollbackTo, savepoint: name}, err
+	case t.is("SAVEPOINT"):
+		p.next()
+		name, err := p.ident()
+		return &txStmt{kind: txSavepoint, savepoint: name}, err
+	case t.is("RELEASE"):
+		p.next()
+		if err := p.expect("SAVEPOINT"); err != nil {
+			return nil, err
+		}
+		name, err := p.ident()
+		return &txStmt{kind: txRelease, savepoint: name}, err
+	case t.is("EXPLAIN"):
+		p.next()
+		if p.accept("FORMAT", "=") {
+			if _, err := p.ident(); err != nil {
+				return nil, err
+			}
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		switch s.(type) {
+		case *selectStmt, *insertStmt, *updateStmt, *deleteStmt:
+			return &explainStmt{stmt: s}, nil
+		}
+		return nil, p.errorf("EXPLAIN supports only SELECT, INSERT, UPDATE and DELETE")
+	case t.is("SET"):
+		// SET NAMES, SET SESSION ... have no effect.
+		for p.peek().kind != tkEOF {
+			if p.next().kind == tkPlaceholder {
+				p.params++
+			}
+		}
+		return noopStmt{}, nil
+	}
+	return nil, p.errorf("statement %q not supported", t.val)
+}
+
+func (p *parser) selectStmt() (*selectStmt, error) {
+	if err := p.expect("SELECT"); err != nil {
+		return nil, err
+	}
+	s := &selectStmt{}
+	s.distinct = p.accept("DISTINCT")
+	p.accept("SQL_NO_CACHE")
+	p.accept("SQL_CALC_FOUND_ROWS")
+	for {
+		var it selectItem
+		switch {
+		case p.accept("*"):
+			it.star = true
+		case (p.peek().kind == tkIdent || p.peek().kind == tkQuotedIdent) && p.peekN(1).is(".") && p.peekN(2).is("*"):
+			p.pos += 3
+			it.star = true
+		default:
+			start := p.peek().pos
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			it.x = x
+			switch {
+			case p.accept("AS"):
+				if it.alias, err = p.aliasName(); err != nil {
+					return nil, err
+				}
+			case p.peek().kind == tkQuotedIdent || p.peek().kind == tkString || (p.peek().kind == tkIdent && !isKeyword(p.peek().val)):
+				it.alias = p.next().val
+			default:
+				if c, ok := x.(exprCol); ok {
+					it.alias = c.name
+				} else {
+					it.alias = strings.TrimSpace(p.sql[start:p.toks[p.pos-1].end])
+				}
+			}
+		}
+		s.items = append(s.items, it)
+		if !p.accept(",") {
+			break
+		}
+	}
+
+	if p.accept("FROM") {
+		if p.peek().is("(") {
+			return nil, p.errorf("sub queries not supported")
+		}
+		var err error
+		if s.table, err = p.tableName(); err != nil {
+			return nil, err
+		}
+		p.tableAlias()
+		if t := p.peek(); t.is(",") || t.is("JOIN") || t.is("LEFT") || t.is("RIGHT") || t.is("INNER") ||
+			t.is("CROSS") || t.is("STRAIGHT_JOIN") || t.is("NATURAL") {
+			return nil, p.errorf("joins not supported")
+		}
+	}
+
+	var err error
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("GROUP", "BY") {
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			s.groupBy = append(s.groupBy, x)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if p.accept("HAVING") {
+		if s.having, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if s.orderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	if p.accept("LIMIT") {
+		first, err := p.primary()
+		if err != nil {
+			return nil, err
+		}
+		s.limit = first
+		switch {
+		case p.accept(","):
+			s.offset = first
+			if s.limit, err = p.primary(); err != nil {
+				return nil, err
+			}
+		case p.accept("OFFSET"):
+			if s.offset, err = p.primary(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	// Locking reads have no effect.
+	switch {
+	case p.accept("FOR", "UPDATE"), p.accept("FOR", "SHARE"), p.accept("LOCK", "IN", "SHARE", "MODE"):
+		p.accept("NOWAIT")
+		p.accept("SKIP", "LOCKED")
+	}
+	if p.peek().is("UNION") {
+		return nil, p.errorf("UNION not supported")
+	}
+	return s, nil
+}
+
+func (p *parser) aliasName() (string, error) {
+	if t := p.peek(); t.kind == tkString {
+		p.next()
+		return t.val, nil
+	}
+	return p.ident()
+}
+
+func (p *parser) orderBy() ([]orderItem, error) {
+	if !p.accept("ORDER", "BY") {
+		return nil, nil
+	}
+	var items []orderItem
+	for {
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		it := orderItem{x: x}
+		if p.accept("DESC") {
+			it.desc = true
+		} else {
+			p.accept("ASC")
+		}
+		items = append(items, it)
+		if !p.accept(",") {
+			return items, nil
+		}
+	}
+}
+
+func (p *parser) limit() (expr, error) {
+	if !p.accept("LIMIT") {
+		return nil, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) insertStmt() (*insertStmt, error) {
+	s := &insertStmt{replace: p.next().is("REPLACE")}
+	p.accept("LOW_PRIORITY")
+	p.accept("DELAYED")
+	p.accept("HIGH_PRIORITY")
+	s.ignore = p.accept("IGNORE")
+	p.accept("INTO")
+	var err error
+	if s.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+
+	if p.peek().is("(") && !p.peekN(1).is("SELECT") {
+		p.next()
+		for {
+			col, err := p.ident()
+			if err != nil {
+				return nil, err
+			}
+			s.columns = append(s.columns, col)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case p.accept("VALUES"), p.accept("VALUE"):
+		for {
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			var row []expr
+			for !p.peek().is(")") {
+				x, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				row = append(row, x)
+				if !p.accept(",") {
+					break
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			s.rows = append(s.rows, row)
+			if !p.accept(",") {
+				break
+			}
+		}
+	case p.accept("SET"):
+		set, err := p.assignments()
+		if err != nil {
+			return nil, err
+		}
+		row := make([]expr, len(set))
+		for i, a := range set {
+			s.columns = append(s.columns, a.col)
+			row[i] = a.x
+		}
+		s.rows = [][]expr{row}
+	default:
+		paren := p.accept("(")
+		if s.from, err = p.selectStmt(); err != nil {
+			return nil, err
+		}
+		if paren {
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if p.accept("ON", "DUPLICATE", "KEY", "UPDATE") {
+		if s.onDup, err = p.assignments(); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) assignments() ([]assignment, error) {
+	var as []assignment
+	for {
+		col, err := p.columnName()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect("="); err != nil {
+			return nil, err
+		}
+		x, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		as = append(as, assignment{col: col, x: x})
+		if !p.accept(",") {
+			return as, nil
+		}
+	}
+}
+
+// columnName parses a maybe table qualified column name.
+func (p *parser) columnName() (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	for p.accept(".") {
+		if name, err = p.ident(); err != nil {
+			return "", err
+		}
+	}
+	return name, nil
+}
+
+func (p *parser) updateStmt() (*updateStmt, error) {
+	p.next()
+	p.accept("LOW_PRIORITY")
+	p.accept("IGNORE")
+	s := &updateStmt{}
+	var err error
+	if s.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	p.tableAlias()
+	if err := p.expect("SET"); err != nil {
+		return nil, err
+	}
+	if s.set, err = p.assignments(); err != nil {
+		return nil, err
+	}
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if s.orderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	s.limit, err = p.limit()
+	return s, err
+}
+
+func (p *parser) deleteStmt() (*deleteStmt, error) {
+	p.next()
+	p.accept("LOW_PRIORITY")
+	p.accept("QUICK")
+	p.accept("IGNORE")
+	if err := p.expect("FROM"); err != nil {
+		return nil, err
+	}
+	s := &deleteStmt{}
+	var err error
+	if s.table, err = p.tableName(); err != nil {
+		return nil, err
+	}
+	p.tableAlias()
+	if p.accept("WHERE") {
+		if s.where, err = p.expr(); err != nil {
+			return nil, err
+		}
+	}
+	if s.orderBy, err = p.orderBy(); err != nil {
+		return nil, err
+	}
+	s.limit, err = p.limit()
+	return s, err
+}
+
+// expr parses an expression with the operator precedence of MySQL.
+func (p *parser) expr() (expr, error) {
+	l, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") || p.accept("||") {
+		r, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: "OR", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) and() (expr, error) {
+	l, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") || p.accept("&&") {
+		r, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: "AND", l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) not() (expr, error) {
+	if p.accept("NOT") || p.accept("!") {
+		x, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{op: "NOT", x: x}, nil
+	}
+	return p.predicate()
+}
+
+func (p *parser) predicate() (expr, error) {
+	l, err := p.additive()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		switch {
+		case p.accept("IS"):
+			not := p.accept("NOT")
+			switch {
+			case p.accept("NULL"):
+				l = exprIsNull{x: l, not: not}
+			case p.accept("TRUE"):
+				l = exprUnary{op: "IS TRUE", x: l}
+				if not {
+					l = exprUnary{op: "IS FALSE", x: l}
+				}
+			case p.accept("FALSE"):
+				l = exprUnary{op: "IS FALSE", x: l}
+				if not {
+					l = exprUnary{op: "IS FALSE", x: l}
+				}
+			default:
+				return nil, p.errorf("expected NULL, TRUE or FALSE after IS")
+			}
+		case p.peek().is("IN") || (p.peek().is("NOT") && p.peekN(1).is("IN")):
+			in := exprIn{x: l, not: p.accept("NOT")}
+			p.next()
+			if p.peek().kind == tkPlaceholder {
+				x, err := p.primary()
+				if err != nil {
+					return nil, err
+				}
+				in.list = []expr{x}
+			} else {
+				if err := p.expect("("); err != nil {
+					return nil, err
+				}
+				if p.peek().is("SELECT") {
+					return nil, p.errorf("sub queries not supported")
+				}
+				for {
+					x, err := p.expr()
+					if err != nil {
+						return nil, err
+					}
+					in.list = append(in.list, x)
+					if !p.accept(",") {
+						break
+					}
+				}
+				if err := p.expect(")"); err != nil {
+					return nil, err
+				}
+			}
+			l = in
+		case p.peek().is("BETWEEN") || (p.peek().is("NOT") && p.peekN(1).is("BETWEEN")):
+			b := exprBetween{x: l, not: p.accept("NOT")}
+			p.next()
+			if b.lo, err = p.additive(); err != nil {
+				return nil, err
+			}
+			if err := p.expect("AND"); err != nil {
+				return nil, err
+			}
+			if b.hi, err = p.additive(); err != nil {
+				return nil, err
+			}
+			l = b
+		case p.peek().is("LIKE") || (p.peek().is("NOT") && p.peekN(1).is("LIKE")):
+			lk := exprLike{x: l, not: p.accept("NOT")}
+			p.next()
+			if lk.pattern, err = p.additive(); err != nil {
+				return nil, err
+			}
+			l = lk
+		case p.peek().is("=") || p.peek().is("<>") || p.peek().is("!=") || p.peek().is("<") ||
+			p.peek().is("<=") || p.peek().is(">") || p.peek().is(">=") || p.peek().is("<=>"):
+			op := p.next().val
+			if op == "!=" {
+				op = "<>"
+			}
+			r, err := p.additive()
+			if err != nil {
+				return nil, err
+			}
+			l = exprBinary{op: op, l: l, r: r}
+		default:
+			return l, nil
+		}
+	}
+}
+
+func (p *parser) additive() (expr, error) {
+	l, err := p.multiplicative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("+") || p.peek().is("-") {
+		op := p.next().val
+		r, err := p.multiplicative()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) multiplicative() (expr, error) {
+	l, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("*") || p.peek().is("/") || p.peek().is("%") || p.peek().is("DIV") || p.peek().is("MOD") {
+		op := strings.ToUpper(p.next().val)
+		r, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		l = exprBinary{op: op, l: l, r: r}
+	}
+	return l, nil
+}
+
+func (p *parser) unary() (expr, error) {
+	if p.accept("-") {
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{op: "-", x: x}, nil
+	}
+	p.accept("+")
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	t := p.peek()
+	switch t.kind {
+	case tkPlaceholder:
+		p.next()
+		p.params++
+		return exprParam{idx: p.params - 1}, nil
+	case tkString:
+		p.next()
+		return exprLit{val: t.val}, nil
+	case tkNumber:
+		p.next()
+		if i, err := strconv.ParseInt(t.val, 10, 64); err == nil {
+			return exprLit{val: i}, nil
+		}
+		if u, err := strconv.ParseUint(t.val, 10, 64); err == nil {
+			return exprLit{val: u}, nil
+		}
+		if strings.ContainsAny(t.val, "eE") {
+			f, err := strconv.ParseFloat(t.val, 64)
+			if err != nil {
+				return nil, p.errorf("invalid number %q", t.val)
+			}
+			return exprLit{val: f}, nil
+		}
+		return exprLit{val: decimal(t.val)}, nil
+	case tkQuotedIdent:
+		name, err := p.columnName()
+		return exprCol{name: name}, err
+	case tkSymbol:
+		if !p.accept("(") {
+			break
+		}
+		if p.peek().is("SELECT") {
+			return nil, p.errorf("sub queries not supported")
+		}
+		var list []expr
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, x)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+		if len(list) == 1 {
+			return list[0], nil
+		}
+		return exprTuple{list: list}, nil
+	case tkIdent:
+		switch {
+		case t.is("NULL"):
+			p.next()
+			return exprLit{}, nil
+		case t.is("TRUE"):
+			p.next()
+			return exprLit{val: int64(1)}, nil
+		case t.is("FALSE"):
+			p.next()
+			return exprLit{val: int64(0)}, nil
+		case t.is("ROW") && p.peekN(1).is("("):
+			p.next()
+			return p.primary()
+		case t.is("VALUES") && p.peekN(1).is("("):
+			p.pos += 2
+			name, err := p.columnName()
+			if err != nil {
+				return nil, err
+			}
+			return exprValues{name: name}, p.expect(")")
+		case (t.is("CURRENT_TIMESTAMP") || t.is("CURRENT_DATE") || t.is("LOCALTIMESTAMP")) && !p.peekN(1).is("("):
+			p.next()
+			return exprFunc{name: strings.ToUpper(t.val)}, nil
+		case p.peekN(1).is("("):
+			return p.function()
+		case isKeyword(t.val):
+			return nil, p.errorf("unexpected keyword %q", t.val)
+		}
+		name, err := p.columnName()
+		return exprCol{name: name}, err
+	}
+	return nil, p.errorf("unexpected %q", t.val)
+}
+
+func (p *parser) function() (expr, error) {
+	f := exprFunc{name: strings.ToUpper(p.next().val)}
+	p.next() // (
+	if !functions[f.name] && !aggregates[f.name] {
+		return nil, p.errorf("function %s not supported", f.name)
+	}
+	if aggregates[f.name] {
+		f.distinct = p.accept("DISTINCT")
+	}
+	switch {
+	case p.peek().is("*"):
+		p.next()
+		f.star = true
+	case !p.peek().is(")"):
+		for {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			f.args = append(f.args, x)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	return f, p.expect(")")
+}
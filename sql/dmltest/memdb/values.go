@@ -0,0 +1,436 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memdb
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/go-sql-driver/mysql"
+)
+
+// The values of a row are nil, int64, uint64, float64, decimal, string or
+// time.Time. Strings contain also binary data.
+
+// decimal represents a fixed point number, e.g. of a DECIMAL column.
+type decimal string
+
+// MySQL error numbers returned by the fake server.
+const (
+	errDupEntry          uint16 = 1062
+	errBadNull           uint16 = 1048
+	errBadField          uint16 = 1054
+	errNoSuchTable       uint16 = 1146
+	errNoDefault         uint16 = 1364
+	errOutOfRange        uint16 = 1264
+	errTruncatedValue    uint16 = 1366
+	errTruncatedDateTime uint16 = 1292
+	errDataTooLong       uint16 = 1406
+	errValueCount        uint16 = 1136
+	errInvalidGroupFunc  uint16 = 1111
+	errNoSuchSavepoint   uint16 = 1305
+	errNoTablesUsed      uint16 = 1096
+	errWrongArguments    uint16 = 1210
+)
+
+func mysqlErrorf(number uint16, format string, args ...interface{}) error {
+	return &mysql.MySQLError{Number: number, Message: fmt.Sprintf(format, args...)}
+}
+
+// normalizeArg converts a driver argument into a row value.
+func normalizeArg(v interface{}) interface{} {
+	switch v := v.(type) {
+	case []byte:
+		if v == nil {
+			return nil
+		}
+		return string(v)
+	case bool:
+		if v {
+			return int64(1)
+		}
+		return int64(0)
+	case time.Time:
+		return v.UTC()
+	}
+	return v
+}
+
+// driverValue converts a row value into a value as returned by the MySQL
+// driver with parseTime=true.
+func driverValue(v interface{}) driver.Value {
+	switch v := v.(type) {
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return []byte(strconv.FormatUint(v, 10))
+	case decimal:
+		return []byte(v)
+	case string:
+		return []byte(v)
+	}
+	return v
+}
+
+func isInteger(v interface{}) bool {
+	switch v.(type) {
+	case int64, uint64:
+		return true
+	}
+	return false
+}
+
+var numericPrefix = regexp.MustCompile(`^\s*[+-]?(\d+\.?\d*|\.\d+)([eE][+-]?\d+)?`)
+
+// isNumeric reports whether the string contains only a number.
+func isNumeric(s string) bool {
+	m := numericPrefix.FindString(s)
+	return m != "" && strings.TrimSpace(m) == strings.TrimSpace(s)
+}
+
+// toRat converts a value into a number. Strings get converted like MySQL does
+// by parsing the numeric prefix.
+func toRat(v interface{}) *big.Rat {
+	r := new(big.Rat)
+	switch v := v.(type) {
+	case int64:
+		r.SetInt64(v)
+	case uint64:
+		r.SetUint64(v)
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return r
+		}
+		r.SetFloat64(v)
+	case decimal:
+		r.SetString(string(v))
+	case string:
+		if m := numericPrefix.FindString(v); m != "" {
+			r.SetString(strings.TrimSpace(strings.TrimPrefix(m, "+")))
+		}
+	case time.Time:
+		r.SetString(v.Format("20060102150405"))
+	}
+	return r
+}
+
+func toFloat(v interface{}) float64 {
+	if f, ok := v.(float64); ok {
+		return f
+	}
+	f, _ := toRat(v).Float64()
+	return f
+}
+
+func toInt(v interface{}) int64 {
+	switch v := v.(type) {
+	case int64:
+		return v
+	case uint64:
+		return int64(v)
+	}
+	return int64(math.Round(toFloat(v)))
+}
+
+// truth evaluates a value as a condition. The second return value reports
+// NULL.
+func truth(v interface{}) (bool, bool) {
+	switch v := v.(type) {
+	case nil:
+		return false, true
+	case int64:
+		return v != 0, false
+	case time.Time:
+		return true, false
+	}
+	return toRat(v).Sign() != 0, false
+}
+
+func boolValue(b bool) interface{} {
+	if b {
+		return int64(1)
+	}
+	return int64(0)
+}
+
+func parseTime(s string) (time.Time, bool) {
+	s = strings.TrimSpace(s)
+	if strings.HasPrefix(s, "0000-00-00") {
+		return time.Time{}, true
+	}
+	for _, layout := range [...]string{"2006-01-02 15:04:05.999999999", "2006-01-02T15:04:05.999999999Z07:00", "2006-01-02T15:04:05.999999999", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// compare compares two non NULL values like MySQL: strings case insensitive,
+// temporal values as time and everything else numerically.
+func compare(a, b interface{}) int {
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr && bStr {
+		return strings.Compare(strings.ToLower(as), strings.ToLower(bs))
+	}
+	at, aTime := a.(time.Time)
+	bt, bTime := b.(time.Time)
+	switch {
+	case aTime && bTime:
+	case aTime && bStr:
+		var ok bool
+		if bt, ok = parseTime(bs); !ok {
+			return strings.Compare(at.Format("2006-01-02 15:04:05"), bs)
+		}
+		bTime = true
+	case bTime && aStr:
+		var ok bool
+		if at, ok = parseTime(as); !ok {
+			return strings.Compare(as, bt.Format("2006-01-02 15:04:05"))
+		}
+		aTime = true
+	}
+	if aTime && bTime {
+		switch {
+		case at.Before(bt):
+			return -1
+		case at.After(bt):
+			return 1
+		}
+		return 0
+	}
+	if ai, ok := a.(int64); ok {
+		if bi, ok := b.(int64); ok {
+			switch {
+			case ai < bi:
+				return -1
+			case ai > bi:
+				return 1
+			}
+			return 0
+		}
+	}
+	return toRat(a).Cmp(toRat(b))
+}
+
+// compareNullable sorts NULL before all other values.
+func compareNullable(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	return compare(a, b)
+}
+
+// keyString creates a comparison key for unique checks, GROUP BY and
+// DISTINCT. Strings are case insensitive.
+func keyString(vals []interface{}) string {
+	var buf strings.Builder
+	for _, v := range vals {
+		switch v := v.(type) {
+		case nil:
+			buf.WriteString("N")
+		case string:
+			buf.WriteString("S" + strings.ToLower(v))
+		case time.Time:
+			buf.WriteString("T" + strconv.FormatInt(v.UnixNano(), 10))
+		default:
+			buf.WriteString("R" + toRat(v).RatString())
+		}
+		buf.WriteByte(0)
+	}
+	return buf.String()
+}
+
+// sameValue reports whether a value has not been changed. Contrary to
+// compare, the case of strings matters.
+func sameValue(a, b interface{}) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	as, aStr := a.(string)
+	bs, bStr := b.(string)
+	if aStr || bStr {
+		return aStr && bStr && as == bs
+	}
+	return compare(a, b) == 0
+}
+
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return v
+	case decimal:
+		return string(v)
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05")
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+var columnTypeSize = regexp.MustCompile(`\((\d+)(?:,(\d+))?\)`)
+
+// typeSize returns the length and scale of a column type like decimal(12,4).
+func typeSize(columnType string) (int, int) {
+	m := columnTypeSize.FindStringSubmatch(columnType)
+	if m == nil {
+		return 0, 0
+	}
+	l, _ := strconv.Atoi(m[1])
+	s, _ := strconv.Atoi(m[2])
+	return l, s
+}
+
+var integerBits = map[string]uint{"tinyint": 8, "smallint": 16, "mediumint": 24, "int": 32, "integer": 32, "bigint": 64, "year": 16, "bit": 64}
+
+// coerce converts a value into the type of the column, in strict mode.
+func coerce(c *ddl.Column, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	dt := strings.ToLower(c.DataType)
+	switch dt {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "year", "bit":
+		return coerceInteger(c, integerBits[dt], v)
+
+	case "float", "double", "real":
+		if s, ok := v.(string); ok && !isNumeric(s) {
+			return nil, mysqlErrorf(errTruncatedValue, "Incorrect double value: '%s' for column '%s' at row 1", s, c.Field)
+		}
+		f := toFloat(v)
+		if f < 0 && c.IsUnsigned() {
+			return nil, mysqlErrorf(errOutOfRange, "Out of range value for column '%s' at row 1", c.Field)
+		}
+		return f, nil
+
+	case "decimal", "numeric":
+		if s, ok := v.(string); ok && !isNumeric(s) {
+			return nil, mysqlErrorf(errTruncatedValue, "Incorrect decimal value: '%s' for column '%s' at row 1", s, c.Field)
+		}
+		r := toRat(v)
+		if r.Sign() < 0 && c.IsUnsigned() {
+			return nil, mysqlErrorf(errOutOfRange, "Out of range value for column '%s' at row 1", c.Field)
+		}
+		precision, scale := typeSize(c.ColumnType)
+		d := r.FloatString(scale)
+		if i := strings.IndexByte(strings.TrimPrefix(d, "-"), '.'); precision > 0 && (i > precision-scale || (i < 0 && len(strings.TrimPrefix(d, "-")) > precision)) {
+			return nil, mysqlErrorf(errOutOfRange, "Out of range value for column '%s' at row 1", c.Field)
+		}
+		return decimal(d), nil
+
+	case "date", "datetime", "timestamp":
+		var t time.Time
+		switch v := v.(type) {
+		case time.Time:
+			t = v.UTC()
+		case string:
+			var ok bool
+			if t, ok = parseTime(v); !ok {
+				return nil, mysqlErrorf(errTruncatedDateTime, "Incorrect %s value: '%s' for column '%s' at row 1", dt, v, c.Field)
+			}
+		default:
+			return nil, mysqlErrorf(errTruncatedDateTime, "Incorrect %s value: '%v' for column '%s' at row 1", dt, v, c.Field)
+		}
+		if t.IsZero() {
+			return t, nil
+		}
+		if dt == "date" {
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+		}
+		fsp, _ := typeSize(c.ColumnType)
+		d := time.Second
+		for i := 0; i < fsp; i++ {
+			d /= 10
+		}
+		return t.Round(d), nil
+	}
+
+	var s string
+	switch v := v.(type) {
+	case string:
+		s = v
+	case time.Time:
+		s = v.Format("2006-01-02 15:04:05")
+		if dt == "time" {
+			s = v.Format("15:04:05")
+		}
+	default:
+		s = formatValue(v)
+	}
+	if dt == "char" || dt == "varchar" {
+		if l, _ := typeSize(c.ColumnType); l > 0 && utf8.RuneCountInString(s) > l {
+			return nil, mysqlErrorf(errDataTooLong, "Data too long for column '%s' at row 1", c.Field)
+		}
+	}
+	return s, nil
+}
+
+func coerceInteger(c *ddl.Column, bits uint, v interface{}) (interface{}, error) {
+	outOfRange := mysqlErrorf(errOutOfRange, "Out of range value for column '%s' at row 1", c.Field)
+	unsigned := c.IsUnsigned() || c.DataType == "bit"
+
+	var r *big.Rat
+	switch v := v.(type) {
+	case int64:
+		r = new(big.Rat).SetInt64(v)
+	case uint64:
+		r = new(big.Rat).SetUint64(v)
+	case string:
+		if !isNumeric(v) {
+			return nil, mysqlErrorf(errTruncatedValue, "Incorrect integer value: '%s' for column '%s' at row 1", v, c.Field)
+		}
+		r = toRat(v)
+	default:
+		r = toRat(v)
+	}
+	// round half away from zero
+	n := new(big.Int).Quo(r.Num(), r.Denom())
+	if rem := new(big.Rat).Sub(r, new(big.Rat).SetInt(n)); rem.Abs(rem).Cmp(big.NewRat(1, 2)) >= 0 {
+		n.Add(n, big.NewInt(int64(r.Sign())))
+	}
+
+	lo, hi := new(big.Int), new(big.Int)
+	if unsigned {
+		hi.Lsh(big.NewInt(1), bits).Sub(hi, big.NewInt(1))
+	} else {
+		lo.Lsh(big.NewInt(1), bits-1).Neg(lo)
+		hi.Lsh(big.NewInt(1), bits-1).Sub(hi, big.NewInt(1))
+	}
+	if n.Cmp(lo) < 0 || n.Cmp(hi) > 0 {
+		return nil, outOfRange
+	}
+	if n.IsInt64() {
+		return n.Int64(), nil
+	}
+	return n.Uint64(), nil
+}
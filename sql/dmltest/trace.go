@@ -0,0 +1,143 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dmltest
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+var _ dml.Tracer = (*TraceRecorder)(nil)
+
+// RecordedSpan contains the data of a span recorded by TraceRecorder.
+type RecordedSpan struct {
+	// ID starts at one. ParentID is zero for root spans.
+	ID         int
+	ParentID   int
+	Name       string
+	Attributes map[string]interface{}
+	Errors     []error
+	Start      time.Time
+	End        time.Time
+	// Ended reports whether function End has been called.
+	Ended bool
+}
+
+// TraceRecorder implements dml.Tracer and records all spans in memory for
+// tests. A span is a child of the span found in the context passed to
+// StartSpan.
+//		rec := dmltest.NewTraceRecorder()
+//		dbc, err := dml.NewConnPool(dml.WithDB(db), dml.WithTracer(rec))
+//		// run queries
+//		spans := rec.Spans()
+type TraceRecorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// NewTraceRecorder creates a new empty recorder.
+func NewTraceRecorder() *TraceRecorder {
+	return &TraceRecorder{}
+}
+
+type traceRecorderKey struct{}
+
+// StartSpan implements dml.Tracer.
+func (tr *TraceRecorder) StartSpan(ctx context.Context, spanName string) (context.Context, dml.Span) {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	rs := &RecordedSpan{
+		ID:         len(tr.spans) + 1,
+		Name:       spanName,
+		Attributes: make(map[string]interface{}),
+		Start:      time.Now(),
+	}
+	if parent, ok := ctx.Value(traceRecorderKey{}).(*recordedSpan); ok && parent.tr == tr {
+		rs.ParentID = parent.rs.ID
+	}
+	tr.spans = append(tr.spans, rs)
+	s := &recordedSpan{tr: tr, rs: rs}
+	return context.WithValue(ctx, traceRecorderKey{}, s), s
+}
+
+// ContextWithSpan implements dml.Tracer.
+func (tr *TraceRecorder) ContextWithSpan(ctx context.Context, span dml.Span) context.Context {
+	if s, ok := span.(*recordedSpan); ok {
+		return context.WithValue(ctx, traceRecorderKey{}, s)
+	}
+	return ctx
+}
+
+// Spans returns a copy of all recorded spans in the order they have been
+// started.
+func (tr *TraceRecorder) Spans() []RecordedSpan {
+	tr.mu.Lock()
+	defer tr.mu.Unlock()
+	ret := make([]RecordedSpan, len(tr.spans))
+	for i, s := range tr.spans {
+		ret[i] = *s
+		ret[i].Attributes = make(map[string]interface{}, len(s.Attributes))
+		for k, v := range s.Attributes {
+			ret[i].Attributes[k] = v
+		}
+		ret[i].Errors = append([]error(nil), s.Errors...)
+	}
+	return ret
+}
+
+// SpansByName returns a copy of all recorded spans with the name.
+func (tr *TraceRecorder) SpansByName(spanName string) []RecordedSpan {
+	var ret []RecordedSpan
+	for _, s := range tr.Spans() {
+		if s.Name == spanName {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+// Reset removes all recorded spans.
+func (tr *TraceRecorder) Reset() {
+	tr.mu.Lock()
+	tr.spans = nil
+	tr.mu.Unlock()
+}
+
+type recordedSpan struct {
+	tr *TraceRecorder
+	rs *RecordedSpan
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) {
+	s.tr.mu.Lock()
+	s.rs.Attributes[key] = value
+	s.tr.mu.Unlock()
+}
+
+func (s *recordedSpan) RecordError(err error) {
+	s.tr.mu.Lock()
+	s.rs.Errors = append(s.rs.Errors, err)
+	s.tr.mu.Unlock()
+}
+
+func (s *recordedSpan) End() {
+	s.tr.mu.Lock()
+	s.rs.End = time.Now()
+	s.rs.Ended = true
+	s.tr.mu.Unlock()
+}
@@ -14,27 +14,16 @@
 
 // Package migration provides tools for database schema migrations.
 //
-// TODO(CyS): https://povilasv.me/2017/02/20/go-schema-migration-tools/
-//
-// TL;DR If your looking for schema migration tool you can use:
-//
-// mattes/migrate, SQL defined schema migrations, with a well defined and
-// documented API, large database support and a useful CLI tool. This tool is
-// actively maintained, has a lot of stars and an A+ from goreport.
-//
-// rubenv/sql-migrate, go struct based or SQL defined schema migrations, with a
-// config file, migration history, prod-dev-test environments. The only drawback
-// is that it got B from goreport.
-// SQL Schema migration tool for Go. Based on gorp and goose.
-// Is better because the API for using it within your code (FOSDEM2016).
-//
-// https://bitbucket.org/liamstask/goose
-// goose is a database migration tool. You can manage your database's evolution by
-// creating incremental SQL or Go scripts.
-// Cons: https://www.reddit.com/r/golang/comments/2dlbz5/database_migration_handling_in_go/
-//
-// github.com/mattes/migrate 744 Stars
-// A migration helper written in Go. Use it in your existing Golang code or run
-// commands via the CLI.
+// A Migrator runs versioned migrations, registered as Go functions or as SQL
+// files via RegisterDir, and records the applied versions in a history table.
+// Up, Down and To execute each migration within a transaction, unless the
+// migration sets NoTx, because MySQL commits DDL statements implicitly.
+// RegisterDir sets NoTx for all SQL files which contain DDL statements.
+// The advisory lock GET_LOCK guarantees that only one application instance
+// migrates at a time. Options.DryRun prints the SQL instead of executing it.
+//
+//		m, err := migration.NewMigrator(dbc, nil)
+//		err = m.RegisterDir("migrations")
+//		applied, err := m.Up(ctx)
 
 package migration
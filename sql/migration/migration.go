@@ -0,0 +1,298 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+const (
+	// DefaultTableName defines the name of the history table which stores the
+	// applied migrations.
+	DefaultTableName = "schema_migrations"
+	// DefaultLockName defines the name of the MySQL advisory lock, see
+	// GET_LOCK.
+	DefaultLockName = "corestore_schema_migration"
+	// DefaultLockTimeout defines how long to wait for the advisory lock.
+	DefaultLockTimeout = 30 * time.Second
+)
+
+// Func defines a migration step written in Go. The Execer is either a
+// transaction, a single connection for migrations with NoTx or, in dry-run
+// mode, a writer which prints the SQL.
+type Func func(ctx context.Context, db dml.Execer) error
+
+// Migration defines a versioned schema change. Either the functions or the SQL
+// statements get executed, where the functions take precedence.
+type Migration struct {
+	// Version must be unique and greater zero. The migrations run sorted by
+	// version, a timestamp like 20190203040506 is a good choice.
+	Version uint64
+	Name    string
+	Up      Func
+	Down    Func
+	UpSQL   []string
+	DownSQL []string
+	// NoTx runs the migration without a transaction. MySQL commits DDL
+	// statements like CREATE, ALTER or DROP implicitly, hence a transaction
+	// would only give a wrong feeling of safety.
+	NoTx bool
+}
+
+// hasDown reports whether the migration can be rolled back.
+func (m *Migration) hasDown() bool { return m.Down != nil || len(m.DownSQL) > 0 }
+
+// Options applies optional settings to a Migrator.
+type Options struct {
+	Log log.Logger
+	// TableName of the history table. Defaults to DefaultTableName.
+	TableName string
+	// LockName of the MySQL advisory lock which guarantees that only one
+	// application instance migrates the database. Defaults to
+	// DefaultLockName.
+	LockName string
+	// LockTimeout defaults to DefaultLockTimeout.
+	LockTimeout time.Duration
+	// DryRun, if set, writes the SQL statements to the writer instead of
+	// executing them. The history table and the advisory lock stay untouched.
+	DryRun io.Writer
+}
+
+// Migrator runs the registered migrations against a database and keeps track
+// of them in a history table.
+type Migrator struct {
+	opts Options
+	dbcp *dml.ConnPool
+
+	mu         sync.Mutex
+	migrations []*Migration
+}
+
+// NewMigrator creates a new Migrator. Argument o can be nil.
+func NewMigrator(dbcp *dml.ConnPool, o *Options) (*Migrator, error) {
+	if dbcp == nil {
+		return nil, errors.Empty.Newf("[migration] A database connection pool is required")
+	}
+	m := &Migrator{
+		dbcp: dbcp,
+	}
+	if o != nil {
+		m.opts = *o
+	}
+	if m.opts.Log == nil {
+		m.opts.Log = log.BlackHole{}
+	}
+	if m.opts.TableName == "" {
+		m.opts.TableName = DefaultTableName
+	}
+	if err := dml.IsValidIdentifier(m.opts.TableName); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if m.opts.LockName == "" {
+		m.opts.LockName = DefaultLockName
+	}
+	if m.opts.LockTimeout == 0 {
+		m.opts.LockTimeout = DefaultLockTimeout
+	}
+	return m, nil
+}
+
+// Register adds migrations. It returns an error if a version has already been
+// registered or a migration has neither an up function nor up SQL.
+func (m *Migrator) Register(migs ...Migration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i := range migs {
+		mig := migs[i]
+		if mig.Version == 0 {
+			return errors.NotValid.Newf("[migration] Migration %q requires a version greater zero", mig.Name)
+		}
+		if mig.Up == nil && len(mig.UpSQL) == 0 {
+			return errors.Empty.Newf("[migration] Migration %d %q has no up step", mig.Version, mig.Name)
+		}
+		if prev, ok := m.find(mig.Version); ok {
+			return errors.AlreadyExists.Newf("[migration] Migration %d %q already registered as %q", mig.Version, mig.Name, prev.Name)
+		}
+		m.migrations = append(m.migrations, &mig)
+	}
+	sort.Slice(m.migrations, func(i, j int) bool { return m.migrations[i].Version < m.migrations[j].Version })
+	return nil
+}
+
+func (m *Migrator) find(version uint64) (*Migration, bool) {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return mig, true
+		}
+	}
+	return nil, false
+}
+
+// regexFileName matches e.g. 20190203040506_create_table.up.sql
+var regexFileName = regexp.MustCompile(`^([0-9]+)_([a-zA-Z0-9_\-]+)\.(up|down)\.sql$`)
+
+// RegisterDir registers all SQL files in directory `dir` whose names follow
+// the pattern `<version>_<name>.(up|down).sql`. Other files get ignored. A file
+// can contain several statements separated by a semicolon. The migration runs
+// without a transaction if the up or down file contains a DDL statement, see
+// isDDL, or if the first line of the up file contains the comment
+// `-- migration:notx`.
+//		001_create_customer.up.sql
+//		001_create_customer.down.sql
+//		002_add_customer_email.up.sql
+func (m *Migrator) RegisterDir(dir string) error {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	byVersion := map[uint64]*Migration{}
+	var versions []uint64
+	for _, fi := range files {
+		matches := regexFileName.FindStringSubmatch(fi.Name())
+		if fi.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseUint(matches[1], 10, 64)
+		if err != nil {
+			return errors.NotValid.New(err, "[migration] Invalid version in file %q", fi.Name())
+		}
+		data, err := ioutil.ReadFile(filepath.Join(dir, fi.Name()))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = mig
+			versions = append(versions, version)
+		}
+		if mig.Name != matches[2] {
+			return errors.Mismatch.Newf("[migration] Files of version %d have different names: %q and %q", version, mig.Name, matches[2])
+		}
+		stmts := splitStatements(string(data))
+		if matches[3] == "up" {
+			mig.UpSQL = stmts
+			mig.NoTx = mig.NoTx || strings.HasPrefix(strings.TrimSpace(string(data)), "-- migration:notx")
+		} else {
+			mig.DownSQL = stmts
+		}
+		for _, s := range stmts {
+			mig.NoTx = mig.NoTx || isDDL(s)
+		}
+	}
+
+	migs := make([]Migration, 0, len(versions))
+	for _, v := range versions {
+		migs = append(migs, *byVersion[v])
+	}
+	return errors.WithStack(m.Register(migs...))
+}
+
+// splitStatements splits the SQL at semicolons which are not part of a quoted
+// string or a comment. Empty statements get dropped.
+func splitStatements(sqlStr string) []string {
+	var stmts []string
+	var buf strings.Builder
+	var quote rune
+	var lineComment bool
+
+	flush := func() {
+		if s := strings.TrimSpace(buf.String()); s != "" && !isOnlyComment(s) {
+			stmts = append(stmts, s)
+		}
+		buf.Reset()
+	}
+
+	runes := []rune(sqlStr)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case lineComment:
+			if r == '\n' {
+				lineComment = false
+			}
+		case quote != 0:
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				buf.WriteRune(r)
+				i++
+				r = runes[i]
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'', r == '"', r == '`':
+			quote = r
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#':
+			lineComment = true
+		case r == ';':
+			flush()
+			continue
+		}
+		buf.WriteRune(r)
+	}
+	flush()
+	return stmts
+}
+
+// ddlKeywords lists the statements which cause an implicit commit.
+var ddlKeywords = [...]string{"ALTER", "CREATE", "DROP", "RENAME", "TRUNCATE"}
+
+// isDDL reports whether the statement, after leading comments, starts with a
+// keyword of ddlKeywords.
+func isDDL(stmt string) bool {
+	for _, line := range strings.Split(stmt, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "--") || strings.HasPrefix(line, "#") {
+			continue
+		}
+		word := line
+		if i := strings.IndexFunc(line, unicode.IsSpace); i > 0 {
+			word = line[:i]
+		}
+		for _, kw := range ddlKeywords {
+			if strings.EqualFold(word, kw) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func isOnlyComment(s string) bool {
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "--") && !strings.HasPrefix(line, "#") {
+			return false
+		}
+	}
+	return true
+}
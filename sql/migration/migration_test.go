@@ -0,0 +1,125 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func TestSplitStatements(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"-- only a comment\n;\n", nil},
+		{"SELECT 1;SELECT 2", []string{"SELECT 1", "SELECT 2"}},
+		{"INSERT INTO a VALUES ('x;y', \"z;\", 'it\\'s;');\n# c;omment\nSELECT `a;b` FROM t;", []string{
+			"INSERT INTO a VALUES ('x;y', \"z;\", 'it\\'s;')",
+			"# c;omment\nSELECT `a;b` FROM t",
+		}},
+	}
+	for i, test := range tests {
+		assert.Exactly(t, test.want, splitStatements(test.in), "Index %d", i)
+	}
+}
+
+func TestIsDDL(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{"-- only a comment", false},
+		{"CREATE TABLE a (id INT)", true},
+		{"-- comment\n# comment\n  alter TABLE a ADD b INT", true},
+		{"DROP TABLE a", true},
+		{"RENAME TABLE a TO b", true},
+		{"TRUNCATE a", true},
+		{"INSERT INTO a VALUES ('CREATE')", false},
+		{"UPDATE a SET b='DROP'", false},
+		{"CREATED", false},
+	}
+	for i, test := range tests {
+		assert.Exactly(t, test.want, isDDL(test.in), "Index %d", i)
+	}
+}
+
+func TestMigrator_RegisterDir(t *testing.T) {
+	t.Parallel()
+
+	dbc, err := dml.NewConnPool()
+	assert.NoError(t, err)
+	m, err := NewMigrator(dbc, nil)
+	assert.NoError(t, err)
+
+	assert.NoError(t, m.RegisterDir("testdata"))
+	assert.Len(t, m.migrations, 3)
+
+	mig := m.migrations[0]
+	assert.Exactly(t, uint64(1), mig.Version)
+	assert.Exactly(t, "create_customer", mig.Name)
+	assert.True(t, mig.NoTx, "DDL must run without a transaction")
+	assert.Exactly(t, []string{
+		"-- Creates the customer table\nCREATE TABLE `customer` (\n  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,\n  `note` VARCHAR(255) NOT NULL DEFAULT 'a;b',\n  PRIMARY KEY (`id`)\n)",
+	}, mig.UpSQL)
+	assert.Exactly(t, []string{"DROP TABLE `customer`"}, mig.DownSQL)
+
+	mig = m.migrations[1]
+	assert.Exactly(t, uint64(2), mig.Version)
+	assert.True(t, mig.NoTx, "DDL must run without a transaction")
+	assert.False(t, mig.hasDown())
+
+	mig = m.migrations[2]
+	assert.Exactly(t, uint64(3), mig.Version)
+	assert.False(t, mig.NoTx, "DML must run within a transaction")
+	assert.Exactly(t, []string{"INSERT INTO `customer` (`note`) VALUES ('it\\'s; fine')"}, mig.UpSQL)
+	assert.Exactly(t, []string{"DELETE FROM `customer`"}, mig.DownSQL)
+
+	err = m.RegisterDir("testdata")
+	assert.True(t, errors.AlreadyExists.Match(err), "%+v", err)
+}
+
+func TestMigrator_Register(t *testing.T) {
+	t.Parallel()
+
+	dbc, err := dml.NewConnPool()
+	assert.NoError(t, err)
+	m, err := NewMigrator(dbc, nil)
+	assert.NoError(t, err)
+
+	err = m.Register(Migration{Name: "zero", UpSQL: []string{"SELECT 1"}})
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	err = m.Register(Migration{Version: 1, Name: "empty"})
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+
+	assert.NoError(t, m.Register(
+		Migration{Version: 3, Name: "c", UpSQL: []string{"SELECT 3"}},
+		Migration{Version: 1, Name: "a", UpSQL: []string{"SELECT 1"}},
+	))
+	assert.Exactly(t, uint64(1), m.migrations[0].Version)
+	assert.Exactly(t, uint64(3), m.migrations[1].Version)
+
+	_, err = NewMigrator(nil, nil)
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+}
@@ -0,0 +1,365 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+// Status describes the state of a migration.
+type Status struct {
+	Version   uint64
+	Name      string
+	Applied   bool
+	AppliedAt time.Time
+	// Unknown gets set if the migration has been found in the history table
+	// but has not been registered.
+	Unknown bool
+}
+
+// history maps the rows of the history table.
+type history struct {
+	data []Status
+}
+
+func (h *history) MapColumns(cm *dml.ColumnMap) error {
+	if cm.Mode() != dml.ColumnMapScan {
+		return errors.NotSupported.Newf("[migration] Unknown Mode: %q", string(cm.Mode()))
+	}
+	s := Status{Applied: true}
+	for cm.Next() {
+		switch c := cm.Column(); c {
+		case "version":
+			cm.Uint64(&s.Version)
+		case "name":
+			cm.String(&s.Name)
+		case "applied_at":
+			cm.Time(&s.AppliedAt)
+		default:
+			return errors.NotFound.Newf("[migration] Column %q not found", c)
+		}
+	}
+	h.data = append(h.data, s)
+	return cm.Err()
+}
+
+func (h *history) applied(version uint64) bool {
+	for _, s := range h.data {
+		if s.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Status returns all registered migrations and all unknown migrations of the
+// history table, sorted by version. Status neither acquires the advisory lock
+// nor creates the history table.
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	var ret []Status
+	err := m.withConn(ctx, false, func(conn *dml.Conn, h *history) error {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		ret = make([]Status, 0, len(m.migrations))
+		for _, mig := range m.migrations {
+			s := Status{Version: mig.Version, Name: mig.Name}
+			for _, hs := range h.data {
+				if hs.Version == mig.Version {
+					s.Applied = true
+					s.AppliedAt = hs.AppliedAt
+				}
+			}
+			ret = append(ret, s)
+		}
+		for _, hs := range h.data {
+			if _, ok := m.find(hs.Version); !ok {
+				hs.Unknown = true
+				ret = append(ret, hs)
+			}
+		}
+		return nil
+	})
+	sort.Slice(ret, func(i, j int) bool { return ret[i].Version < ret[j].Version })
+	return ret, errors.WithStack(err)
+}
+
+// Up applies all pending migrations and returns the number of applied
+// migrations.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	m.mu.Lock()
+	var last uint64
+	if l := len(m.migrations); l > 0 {
+		last = m.migrations[l-1].Version
+	}
+	m.mu.Unlock()
+	return m.To(ctx, last)
+}
+
+// Down rolls back the applied migration with the highest version. Returns zero
+// if there is nothing to roll back.
+func (m *Migrator) Down(ctx context.Context) (int, error) {
+	var n int
+	err := m.withConn(ctx, true, func(conn *dml.Conn, h *history) error {
+		if len(h.data) == 0 {
+			return nil
+		}
+		last := h.data[len(h.data)-1]
+		m.mu.Lock()
+		mig, ok := m.find(last.Version)
+		m.mu.Unlock()
+		if !ok {
+			return errors.NotFound.Newf("[migration] Applied migration %d %q has not been registered", last.Version, last.Name)
+		}
+		if err := m.run(ctx, conn, mig, false); err != nil {
+			return errors.WithStack(err)
+		}
+		n = 1
+		return nil
+	})
+	return n, errors.WithStack(err)
+}
+
+// To migrates the database to `version`. All pending migrations up to and
+// including `version` get applied in ascending order and all applied
+// migrations greater than `version` get rolled back in descending order. To
+// migrate down to an empty database, use version zero. Returns the number of
+// applied plus rolled back migrations.
+func (m *Migrator) To(ctx context.Context, version uint64) (int, error) {
+	var n int
+	err := m.withConn(ctx, true, func(conn *dml.Conn, h *history) error {
+		m.mu.Lock()
+		migs := make([]*Migration, len(m.migrations))
+		copy(migs, m.migrations)
+		m.mu.Unlock()
+
+		// roll back, highest version first
+		for i := len(h.data) - 1; i >= 0; i-- {
+			hs := h.data[i]
+			if hs.Version <= version {
+				continue
+			}
+			var mig *Migration
+			for _, mg := range migs {
+				if mg.Version == hs.Version {
+					mig = mg
+				}
+			}
+			if mig == nil {
+				return errors.NotFound.Newf("[migration] Applied migration %d %q has not been registered", hs.Version, hs.Name)
+			}
+			if err := m.run(ctx, conn, mig, false); err != nil {
+				return errors.WithStack(err)
+			}
+			n++
+		}
+
+		for _, mig := range migs {
+			if mig.Version > version || h.applied(mig.Version) {
+				continue
+			}
+			if err := m.run(ctx, conn, mig, true); err != nil {
+				return errors.WithStack(err)
+			}
+			n++
+		}
+		return nil
+	})
+	return n, errors.WithStack(err)
+}
+
+// withConn acquires a single connection, optionally the advisory lock,
+// creates the history table and loads the history. Without the lock or in
+// dry-run mode the history table does not get created and the history stays
+// empty if the table does not exist.
+func (m *Migrator) withConn(ctx context.Context, lock bool, fn func(*dml.Conn, *history) error) (err error) {
+	conn, err := m.dbcp.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if cErr := conn.Close(); cErr != nil && err == nil {
+			err = errors.WithStack(cErr)
+		}
+	}()
+
+	if lock && m.opts.DryRun == nil {
+		if err := m.lock(ctx, conn); err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() {
+			if uErr := m.unlock(ctx, conn); uErr != nil && err == nil {
+				err = errors.WithStack(uErr)
+			}
+		}()
+	}
+
+	exists := true
+	if !lock || m.opts.DryRun != nil {
+		if exists, err = m.tableExists(ctx, conn); err != nil {
+			return errors.WithStack(err)
+		}
+		if !exists && lock {
+			if _, err := fmt.Fprintf(m.opts.DryRun, "%s;\n", m.createTableSyntax()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	} else if _, err := conn.DB.ExecContext(ctx, m.createTableSyntax()); err != nil {
+		return errors.Wrapf(err, "[migration] Failed to create history table %q", m.opts.TableName)
+	}
+
+	h := new(history)
+	if exists {
+		sel := dml.NewSelect("version", "name", "applied_at").From(m.opts.TableName).OrderBy("version")
+		if _, err := conn.WithQueryBuilder(sel).Load(ctx, h); err != nil {
+			return errors.Wrapf(err, "[migration] Failed to load history from table %q", m.opts.TableName)
+		}
+	}
+	return fn(conn, h)
+}
+
+func (m *Migrator) createTableSyntax() string {
+	return "CREATE TABLE IF NOT EXISTS " + dml.Quoter.Name(m.opts.TableName) + ` (
+  ` + "`version`" + ` BIGINT UNSIGNED NOT NULL,
+  ` + "`name`" + ` VARCHAR(255) NOT NULL DEFAULT '',
+  ` + "`applied_at`" + ` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (` + "`version`" + `)
+)`
+}
+
+func (m *Migrator) tableExists(ctx context.Context, conn *dml.Conn) (bool, error) {
+	var count int64
+	err := conn.DB.QueryRowContext(ctx,
+		"SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		m.opts.TableName).Scan(&count)
+	return count > 0, errors.WithStack(err)
+}
+
+// lock acquires the advisory lock. GET_LOCK binds the lock to the session,
+// hence all statements must run on the same connection.
+func (m *Migrator) lock(ctx context.Context, conn *dml.Conn) error {
+	var res sql.NullInt64
+	if err := conn.DB.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", m.opts.LockName, int64(m.opts.LockTimeout/time.Second)).Scan(&res); err != nil {
+		return errors.Wrapf(err, "[migration] Failed to acquire lock %q", m.opts.LockName)
+	}
+	switch {
+	case !res.Valid:
+		return errors.Fatal.Newf("[migration] Failed to acquire lock %q", m.opts.LockName)
+	case res.Int64 != 1:
+		return errors.AlreadyInUse.Newf("[migration] Lock %q is held by another migration, waited %s", m.opts.LockName, m.opts.LockTimeout)
+	}
+	return nil
+}
+
+func (m *Migrator) unlock(ctx context.Context, conn *dml.Conn) error {
+	var res sql.NullInt64
+	err := conn.DB.QueryRowContext(ctx, "SELECT RELEASE_LOCK(?)", m.opts.LockName).Scan(&res)
+	return errors.Wrapf(err, "[migration] Failed to release lock %q", m.opts.LockName)
+}
+
+// run applies or rolls back one migration including its history entry.
+func (m *Migrator) run(ctx context.Context, conn *dml.Conn, mig *Migration, up bool) error {
+	direction := "up"
+	if !up {
+		direction = "down"
+		if !mig.hasDown() {
+			return errors.NotSupported.Newf("[migration] Migration %d %q cannot be rolled back", mig.Version, mig.Name)
+		}
+	}
+	start := time.Now()
+
+	if w := m.opts.DryRun; w != nil {
+		if _, err := fmt.Fprintf(w, "-- Migration %d %s %s\n", mig.Version, mig.Name, direction); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(m.exec(ctx, dryRunExecer{w: w}, mig, up))
+	}
+
+	var err error
+	if mig.NoTx {
+		err = m.exec(ctx, conn.DB, mig, up)
+	} else {
+		err = conn.Transaction(ctx, nil, func(tx *dml.Tx) error {
+			return m.exec(ctx, tx.DB, mig, up)
+		})
+	}
+	if err != nil {
+		return errors.Wrapf(err, "[migration] Migration %d %q %s failed", mig.Version, mig.Name, direction)
+	}
+	if m.opts.Log.IsInfo() {
+		m.opts.Log.Info("migration.Migrator.run", log.Uint64("version", mig.Version), log.String("name", mig.Name),
+			log.String("direction", direction), log.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+func (m *Migrator) exec(ctx context.Context, db dml.Execer, mig *Migration, up bool) error {
+	fn, stmts := mig.Up, mig.UpSQL
+	if !up {
+		fn, stmts = mig.Down, mig.DownSQL
+	}
+	if fn != nil {
+		if err := fn(ctx, db); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		for _, s := range stmts {
+			if _, err := db.ExecContext(ctx, s); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	if up {
+		ins := dml.NewInsert(m.opts.TableName).AddColumns("version", "name").BuildValues()
+		sqlStr, _, err := ins.ToSQL()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = db.ExecContext(ctx, sqlStr, mig.Version, mig.Name)
+		return errors.WithStack(err)
+	}
+	del := dml.NewDelete(m.opts.TableName).Where(dml.Column("version").PlaceHolder())
+	sqlStr, _, err := del.ToSQL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = db.ExecContext(ctx, sqlStr, mig.Version)
+	return errors.WithStack(err)
+}
+
+// dryRunExecer writes the queries and their arguments to w.
+type dryRunExecer struct {
+	w io.Writer
+}
+
+func (d dryRunExecer) ExecContext(_ context.Context, query string, args ...interface{}) (sql.Result, error) {
+	if len(args) > 0 {
+		if _, err := fmt.Fprintf(d.w, "-- args: %v\n", args); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	_, err := fmt.Fprintf(d.w, "%s;\n", query)
+	return driver.RowsAffected(0), errors.WithStack(err)
+}
@@ -0,0 +1,246 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package migration_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/migration"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+const (
+	sqlSelectHistory = "SELECT `version`, `name`, `applied_at` FROM `schema_migrations` ORDER BY `version`"
+	sqlInsertHistory = "INSERT INTO `schema_migrations` (`version`,`name`) VALUES (?,?)"
+	sqlDeleteHistory = "DELETE FROM `schema_migrations` WHERE (`version` = ?)"
+)
+
+var appliedAt = time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)
+
+func newMigrator(t *testing.T, dbc *dml.ConnPool, o *migration.Options) *migration.Migrator {
+	m, err := migration.NewMigrator(dbc, o)
+	assert.NoError(t, err)
+	assert.NoError(t, m.Register(
+		migration.Migration{
+			Version: 1, Name: "create_customer", NoTx: true,
+			UpSQL:   []string{"CREATE TABLE `customer` (`id` INT)"},
+			DownSQL: []string{"DROP TABLE `customer`"},
+		},
+		migration.Migration{
+			Version: 2, Name: "seed_customer",
+			Up: func(ctx context.Context, db dml.Execer) error {
+				_, err := db.ExecContext(ctx, "INSERT INTO `customer` (`id`) VALUES (?)", 1)
+				return err
+			},
+			Down: func(ctx context.Context, db dml.Execer) error {
+				_, err := db.ExecContext(ctx, "DELETE FROM `customer`")
+				return err
+			},
+		},
+	))
+	return m
+}
+
+func expectLock(dbMock sqlmock.Sqlmock, history *sqlmock.Rows) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT GET_LOCK(?, ?)")).WithArgs("corestore_schema_migration", 30).
+		WillReturnRows(sqlmock.NewRows([]string{"l"}).AddRow(1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE IF NOT EXISTS `schema_migrations`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlSelectHistory)).WillReturnRows(history)
+}
+
+func expectTableExists(dbMock sqlmock.Sqlmock, count int) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?")).
+		WithArgs("schema_migrations").WillReturnRows(sqlmock.NewRows([]string{"c"}).AddRow(count))
+}
+
+func expectUnlock(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT RELEASE_LOCK(?)")).WithArgs("corestore_schema_migration").
+		WillReturnRows(sqlmock.NewRows([]string{"l"}).AddRow(1))
+}
+
+func historyRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"version", "name", "applied_at"})
+}
+
+func TestMigrator_Up(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectLock(dbMock, historyRows())
+	// NoTx
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE `customer` (`id` INT)")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlInsertHistory)).WithArgs(1, "create_customer").WillReturnResult(sqlmock.NewResult(0, 1))
+	// Tx
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `customer` (`id`) VALUES (?)")).WithArgs(1).WillReturnResult(sqlmock.NewResult(1, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlInsertHistory)).WithArgs(2, "seed_customer").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	expectUnlock(dbMock)
+
+	n, err := newMigrator(t, dbc, nil).Up(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, 2, n)
+}
+
+func TestMigrator_Up_Rollback(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectLock(dbMock, historyRows().AddRow(1, "create_customer", appliedAt))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `customer` (`id`) VALUES (?)")).WithArgs(1).WillReturnError(errors.Duplicated.Newf("Duplicate entry"))
+	dbMock.ExpectRollback()
+	expectUnlock(dbMock)
+
+	n, err := newMigrator(t, dbc, nil).Up(context.TODO())
+	assert.True(t, errors.Duplicated.Match(err), "%+v", err)
+	assert.Exactly(t, 0, n)
+}
+
+func TestMigrator_Up_Rollback_RegisterDir(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectLock(dbMock, historyRows())
+	// DDL runs without a transaction
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE `customer`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlInsertHistory)).WithArgs(1, "create_customer").WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("ALTER TABLE `customer` ADD COLUMN `email`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlInsertHistory)).WithArgs(2, "add_customer_email").WillReturnResult(sqlmock.NewResult(0, 1))
+	// DML runs within a transaction which gets rolled back
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `customer` (`note`)")).WillReturnError(errors.Duplicated.Newf("Duplicate entry"))
+	dbMock.ExpectRollback()
+	expectUnlock(dbMock)
+
+	m, err := migration.NewMigrator(dbc, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, m.RegisterDir("testdata"))
+
+	n, err := m.Up(context.TODO())
+	assert.True(t, errors.Duplicated.Match(err), "%+v", err)
+	assert.Exactly(t, 2, n)
+}
+
+func TestMigrator_Down(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectLock(dbMock, historyRows().AddRow(1, "create_customer", appliedAt).AddRow(2, "seed_customer", appliedAt))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `customer`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlDeleteHistory)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	expectUnlock(dbMock)
+
+	n, err := newMigrator(t, dbc, nil).Down(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, 1, n)
+}
+
+func TestMigrator_To(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectLock(dbMock, historyRows().AddRow(1, "create_customer", appliedAt).AddRow(2, "seed_customer", appliedAt))
+	dbMock.ExpectBegin()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DELETE FROM `customer`")).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlDeleteHistory)).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectCommit()
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DROP TABLE `customer`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlDeleteHistory)).WithArgs(1).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectUnlock(dbMock)
+
+	n, err := newMigrator(t, dbc, nil).To(context.TODO(), 0)
+	assert.NoError(t, err)
+	assert.Exactly(t, 2, n)
+}
+
+func TestMigrator_Lock_Timeout(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT GET_LOCK(?, ?)")).WithArgs("app_migration", 5).
+		WillReturnRows(sqlmock.NewRows([]string{"l"}).AddRow(0))
+
+	n, err := newMigrator(t, dbc, &migration.Options{
+		LockName:    "app_migration",
+		LockTimeout: 5 * time.Second,
+	}).Up(context.TODO())
+	assert.True(t, errors.AlreadyInUse.Match(err), "%+v", err)
+	assert.Exactly(t, 0, n)
+}
+
+func TestMigrator_Status(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectTableExists(dbMock, 1)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlSelectHistory)).
+		WillReturnRows(historyRows().AddRow(1, "create_customer", appliedAt).AddRow(7, "removed", appliedAt))
+
+	s, err := newMigrator(t, dbc, nil).Status(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, []migration.Status{
+		{Version: 1, Name: "create_customer", Applied: true, AppliedAt: appliedAt},
+		{Version: 2, Name: "seed_customer"},
+		{Version: 7, Name: "removed", Applied: true, AppliedAt: appliedAt, Unknown: true},
+	}, s)
+}
+
+func TestMigrator_Status_NoTable(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectTableExists(dbMock, 0)
+
+	s, err := newMigrator(t, dbc, nil).Status(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, []migration.Status{
+		{Version: 1, Name: "create_customer"},
+		{Version: 2, Name: "seed_customer"},
+	}, s)
+}
+
+func TestMigrator_DryRun(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	expectTableExists(dbMock, 1)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlSelectHistory)).
+		WillReturnRows(historyRows().AddRow(1, "create_customer", appliedAt))
+
+	var buf bytes.Buffer
+	n, err := newMigrator(t, dbc, &migration.Options{DryRun: &buf}).Up(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, 1, n)
+	assert.Exactly(t, "-- Migration 2 seed_customer up\n-- args: [1]\nINSERT INTO `customer` (`id`) VALUES (?);\n-- args: [2 seed_customer]\nINSERT INTO `schema_migrations` (`version`,`name`) VALUES (?,?);\n", buf.String())
+}
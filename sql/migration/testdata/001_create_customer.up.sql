@@ -0,0 +1,6 @@
+-- Creates the customer table
+CREATE TABLE `customer` (
+  `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  `note` VARCHAR(255) NOT NULL DEFAULT 'a;b',
+  PRIMARY KEY (`id`)
+);
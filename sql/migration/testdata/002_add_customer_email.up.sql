@@ -0,0 +1 @@
+ALTER TABLE `customer` ADD COLUMN `email` VARCHAR(255) NULL;
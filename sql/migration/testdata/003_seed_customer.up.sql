@@ -0,0 +1 @@
+INSERT INTO `customer` (`note`) VALUES ('it\'s; fine');
@@ -0,0 +1,72 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mview
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+func (v *View) createCheckpointSyntax() string {
+	return "CREATE TABLE IF NOT EXISTS " + dml.Quoter.Name(v.opts.CheckpointTable) + ` (
+  ` + "`view_name`" + ` VARCHAR(64) NOT NULL,
+  ` + "`binlog_file`" + ` VARCHAR(255) NOT NULL DEFAULT '',
+  ` + "`binlog_position`" + ` INT UNSIGNED NOT NULL DEFAULT 0,
+  ` + "`updated_at`" + ` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (` + "`view_name`" + `)
+)`
+}
+
+// saveCheckpoint persists the binlog position. An empty position gets ignored
+// because the binlog might be disabled.
+func (v *View) saveCheckpoint(ctx context.Context, db dml.Execer, ms ddl.MasterStatus) error {
+	if ms.File == "" {
+		return nil
+	}
+	ins := dml.NewInsert(v.opts.CheckpointTable).
+		AddColumns("view_name", "binlog_file", "binlog_position").BuildValues().
+		AddOnDuplicateKey(dml.Column("binlog_file").Values(), dml.Column("binlog_position").Values())
+	sqlStr, _, err := ins.ToSQL()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := db.ExecContext(ctx, sqlStr, v.Name, ms.File, ms.Position); err != nil {
+		return errors.Wrapf(err, "[mview] Failed to save checkpoint %q for view %q", ms.String(), v.Name)
+	}
+	v.checkpoint = ms
+	return nil
+}
+
+// Checkpoint loads the last applied binlog position from the checkpoint table.
+// Use the position to start the binlogsync.Canal after a restart. Returns an
+// empty MasterStatus if the view has no checkpoint.
+func (v *View) Checkpoint(ctx context.Context) (ddl.MasterStatus, error) {
+	sel := v.dbcp.SelectFrom(v.opts.CheckpointTable).
+		AddColumnsAliases("binlog_file", "File", "binlog_position", "Position").
+		Where(dml.Column("view_name").PlaceHolder())
+
+	var ms ddl.MasterStatus
+	if _, err := sel.WithArgs().String(v.Name).Load(ctx, &ms); err != nil {
+		return ms, errors.Wrapf(err, "[mview] Failed to load checkpoint for view %q", v.Name)
+	}
+
+	v.mu.Lock()
+	v.checkpoint = ms
+	v.mu.Unlock()
+	return ms, nil
+}
@@ -14,6 +14,24 @@
 
 // Package mview adds materialized views via events on the MySQL binary log.
 //
+// A View gets defined by a *dml.Select which aggregates one source table with
+// COUNT, SUM, MIN or MAX and groups by at least one column. Create builds the
+// view table, whose primary key consists of the GROUP BY columns, and fills
+// it with a full Refresh. Registering the View with a binlogsync.Canal via
+// RegisterCanal applies each insert, update and delete of the source table
+// incrementally. Every incremental update stores the end position of its
+// binlog event in a checkpoint table within the same transaction, hence events
+// already applied get skipped after a restart. A failed update marks the view as stale and
+// the next Complete call triggers a full refresh.
+//
+//		sel := dml.NewSelect("customer_id").From("sales_order").
+//			AddColumnsConditions(
+//				dml.Expr("COUNT(*)").Alias("order_count"),
+//				dml.Expr("SUM(grand_total)").Alias("revenue"),
+//			).GroupBy("customer_id")
+//		v, err := mview.NewView(dbc, "mview_customer_revenue", sel, nil)
+//		err = v.Create(ctx)
+//		v.RegisterCanal(canal)
 //
 // https://de.slideshare.net/MySQLGeek/flexviews-materialized-views-for-my-sql
 // https://github.com/greenlion/swanhart-tools
@@ -0,0 +1,210 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mview
+
+import (
+	"context"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+var _ binlogsync.RowsEventHandler = (*View)(nil)
+
+// RegisterCanal registers the view as event handler for its source table. The
+// canal passes the position of each row event within the context to Do.
+func (v *View) RegisterCanal(c *binlogsync.Canal) {
+	c.RegisterRowsEventHandler(v.Source, v)
+}
+
+// IsStale returns true if an incremental update has failed and the view waits
+// for a full refresh.
+func (v *View) IsStale() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.stale
+}
+
+// Do applies the row events of the source table to the view table within one
+// transaction, including the end position of the event as checkpoint. Events
+// at or before the checkpoint have already been applied and get skipped. If
+// the update fails, the view gets marked as stale and the next call to
+// Complete performs a full refresh.
+func (v *View) Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	if t == nil || t.Name != v.Source || len(rows) == 0 {
+		return nil
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.stale {
+		return nil // refresh pending, the event is part of the refresh.
+	}
+
+	pos, _ := v.opts.Position(ctx)
+	if pos.File != "" && pos.Compare(v.checkpoint) <= 0 {
+		if v.opts.Log.IsDebug() {
+			v.opts.Log.Debug("mview.View.Do.skip", log.String("view", v.Name), log.Stringer("position", pos), log.Stringer("checkpoint", v.checkpoint))
+		}
+		return nil
+	}
+
+	err := v.apply(ctx, action, t, rows, pos)
+	if err != nil {
+		v.stale = true
+		if v.opts.Log.IsInfo() {
+			v.opts.Log.Info("mview.View.Do.error", log.Err(err), log.String("view", v.Name), log.String("action", action), log.Bool("is_stale", true))
+		}
+	}
+	return errors.WithStack(err)
+}
+
+// Complete performs a full refresh of a stale view.
+func (v *View) Complete(ctx context.Context) error {
+	if !v.IsStale() {
+		return nil
+	}
+	return errors.WithStack(v.Refresh(ctx))
+}
+
+func (v *View) apply(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}, pos ddl.MasterStatus) error {
+	idxGroup := make([]int, len(v.groupBys))
+	for i, g := range v.groupBys {
+		if idxGroup[i] = columnIndex(t.Columns, g); idxGroup[i] < 0 {
+			return errors.NotFound.Newf("[mview] Column %q not found in table %q", g, t.Name)
+		}
+	}
+	idxAgg := make([]int, len(v.aggregates))
+	for i, a := range v.aggregates {
+		idxAgg[i] = -1
+		if a.column != "" {
+			if idxAgg[i] = columnIndex(t.Columns, a.column); idxAgg[i] < 0 {
+				return errors.NotFound.Newf("[mview] Column %q not found in table %q", a.column, t.Name)
+			}
+		}
+	}
+
+	var removed, added [][]interface{}
+	switch action {
+	case binlogsync.InsertAction:
+		added = rows
+	case binlogsync.DeleteAction:
+		removed = rows
+	case binlogsync.UpdateAction:
+		if len(rows)%2 == 1 {
+			return errors.NotValid.Newf("[mview] Update event for table %q requires an even number of rows, got %d", t.Name, len(rows))
+		}
+		for i := 0; i < len(rows); i += 2 {
+			removed = append(removed, rows[i])
+			added = append(added, rows[i+1])
+		}
+	default:
+		return errors.NotSupported.Newf("[mview] Action %q not supported", action)
+	}
+
+	return v.dbcp.Transaction(ctx, nil, func(tx *dml.Tx) error {
+		for _, row := range removed {
+			if err := v.remove(ctx, tx, row, idxGroup, idxAgg); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		for _, row := range added {
+			if err := v.add(ctx, tx, row, idxGroup, idxAgg); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		return errors.WithStack(v.saveCheckpoint(ctx, tx.DB, pos))
+	})
+}
+
+// add upserts the group of a new row.
+func (v *View) add(ctx context.Context, tx *dml.Tx, row []interface{}, idxGroup, idxAgg []int) error {
+	args := make([]interface{}, 0, len(idxGroup)+len(idxAgg)+1)
+	args = appendGroupArgs(args, row, idxGroup)
+	for i, a := range v.aggregates {
+		switch {
+		case a.fn == aggCount && a.column == "":
+			args = append(args, 1)
+		case a.fn == aggCount && row[idxAgg[i]] == nil:
+			args = append(args, 0)
+		case a.fn == aggCount:
+			args = append(args, 1)
+		default:
+			args = append(args, row[idxAgg[i]])
+		}
+	}
+	args = append(args, 1)
+	_, err := tx.WithQueryBuilder(v.stmtUpsert).ExecContext(ctx, args...)
+	return errors.Wrapf(err, "[mview] Failed to add row to view %q", v.Name)
+}
+
+// remove subtracts a deleted row from its group, recalculates MIN and MAX
+// values if necessary and deletes empty groups.
+func (v *View) remove(ctx context.Context, tx *dml.Tx, row []interface{}, idxGroup, idxAgg []int) error {
+	args := make([]interface{}, 0, len(idxGroup)+len(idxAgg))
+	for i, a := range v.aggregates {
+		switch {
+		case a.fn == aggCount && a.column == "":
+			args = append(args, 1)
+		case a.fn == aggCount && row[idxAgg[i]] == nil:
+			args = append(args, 0)
+		case a.fn == aggCount:
+			args = append(args, 1)
+		case a.fn == aggSum:
+			args = append(args, row[idxAgg[i]])
+		}
+	}
+	args = appendGroupArgs(args, row, idxGroup)
+	if _, err := tx.WithQueryBuilder(v.stmtRemove).ExecContext(ctx, args...); err != nil {
+		return errors.Wrapf(err, "[mview] Failed to remove row from view %q", v.Name)
+	}
+
+	for i, a := range v.aggregates {
+		up, ok := v.stmtRecompute[i]
+		if !ok || row[idxAgg[i]] == nil {
+			continue
+		}
+		args = appendGroupArgs(args[:0], row, idxGroup)
+		args = appendGroupArgs(args, row, idxGroup)
+		args = append(args, row[idxAgg[i]])
+		if _, err := tx.WithQueryBuilder(up).ExecContext(ctx, args...); err != nil {
+			return errors.Wrapf(err, "[mview] Failed to recalculate %s(%s) in view %q", a.fn, a.column, v.Name)
+		}
+	}
+
+	args = appendGroupArgs(args[:0], row, idxGroup)
+	_, err := tx.WithQueryBuilder(v.stmtCleanup).ExecContext(ctx, args...)
+	return errors.Wrapf(err, "[mview] Failed to delete empty group from view %q", v.Name)
+}
+
+func appendGroupArgs(args []interface{}, row []interface{}, idxGroup []int) []interface{} {
+	for _, idx := range idxGroup {
+		args = append(args, row[idx])
+	}
+	return args
+}
+
+func columnIndex(cols ddl.Columns, field string) int {
+	for i, c := range cols {
+		if c.Field == field {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,479 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mview
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+const (
+	// DefaultCheckpointTable defines the name of the table which stores the
+	// last applied binlog position of each view.
+	DefaultCheckpointTable = "mview_checkpoint"
+	// ColumnRowCount defines the name of the additional column in each view
+	// table which counts the rows of a group in the source table. A group gets
+	// deleted once the counter reaches zero.
+	ColumnRowCount = "mview_row_count"
+)
+
+// Supported aggregate functions.
+const (
+	aggCount = "COUNT"
+	aggSum   = "SUM"
+	aggMin   = "MIN"
+	aggMax   = "MAX"
+)
+
+// regexAggregate matches e.g. SUM(`so`.`grand_total`) or COUNT(*).
+var regexAggregate = regexp.MustCompile(`(?i)^\s*(COUNT|SUM|MIN|MAX)\s*\(\s*(\*|(?:[a-z0-9_$]+\.)?([a-z0-9_$]+))\s*\)\s*$`)
+
+type aggregate struct {
+	fn string
+	// column contains the source column, empty for COUNT(*).
+	column string
+	alias  string
+}
+
+// Options applies optional settings to a View.
+type Options struct {
+	Log log.Logger
+	// Position returns the binlog end position of the currently processed
+	// row event. Row events whose position is not after the stored checkpoint
+	// get skipped and the position gets persisted with each applied event.
+	// Defaults to function binlogsync.PositionFromContext.
+	Position func(context.Context) (ddl.MasterStatus, bool)
+	// CheckpointTable defines the table which stores the last applied binlog
+	// position. Defaults to DefaultCheckpointTable.
+	CheckpointTable string
+}
+
+// View defines a materialized view whose content gets calculated from a
+// single source table with GROUP BY aggregates. The view table gets updated
+// incrementally by the binlog row events of the source table. View implements
+// the interface binlogsync.RowsEventHandler.
+type View struct {
+	// Name of the table which stores the materialized view.
+	Name string
+	// Source defines the name of the table the view gets calculated from.
+	Source string
+	opts   Options
+	dbcp   *dml.ConnPool
+
+	groupBys   []string
+	aggregates []aggregate
+
+	// mu serializes the incremental updates and the full refresh.
+	mu sync.Mutex
+	// stale gets set when an incremental update fails. The next call to
+	// Complete performs a full refresh.
+	stale      bool
+	checkpoint ddl.MasterStatus
+
+	// prepared statements for the incremental updates
+	stmtUpsert  *dml.Insert
+	stmtRemove  *dml.Update
+	stmtCleanup *dml.Delete
+	// stmtRecompute contains for each MIN/MAX aggregate an UPDATE statement.
+	// The key is the index of the aggregate.
+	stmtRecompute map[int]*dml.Update
+}
+
+// NewView creates a new materialized view `name` from the SELECT statement
+// `definition`. The definition must contain a FROM table, at least one GROUP BY
+// column and supports as columns only the GROUP BY columns and the aggregate
+// functions COUNT(*), COUNT(col), SUM(col), MIN(col) and MAX(col). Each
+// aggregate must have an alias which is the column name in the view table.
+// WHERE, JOIN, HAVING and DISTINCT are not supported. The group columns of the
+// source table must be NOT NULL because they build the primary key of the view
+// table.
+//		sel := dml.NewSelect("customer_id").From("sales_order").
+//			AddColumnsConditions(
+//				dml.Expr("COUNT(*)").Alias("order_count"),
+//				dml.Expr("SUM(grand_total)").Alias("revenue"),
+//				dml.Expr("MAX(created_at)").Alias("last_order_at"),
+//			).
+//			GroupBy("customer_id")
+//		v, err := mview.NewView(dbc, "mview_customer_revenue", sel, nil)
+func NewView(dbcp *dml.ConnPool, name string, definition *dml.Select, o *Options) (*View, error) {
+	if dbcp == nil {
+		return nil, errors.Empty.Newf("[mview] A database connection pool is required for view %q", name)
+	}
+	if err := dml.IsValidIdentifier(name); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if definition == nil {
+		return nil, errors.Empty.Newf("[mview] View %q requires a SELECT definition", name)
+	}
+
+	v := &View{
+		Name:   name,
+		Source: definition.Table.Name,
+		dbcp:   dbcp,
+	}
+	if o != nil {
+		v.opts = *o
+	}
+	if v.opts.Log == nil {
+		v.opts.Log = log.BlackHole{}
+	}
+	if v.opts.CheckpointTable == "" {
+		v.opts.CheckpointTable = DefaultCheckpointTable
+	}
+	if v.opts.Position == nil {
+		v.opts.Position = binlogsync.PositionFromContext
+	}
+
+	if err := v.parseDefinition(definition); err != nil {
+		return nil, errors.Wrapf(err, "[mview] Invalid definition for view %q", name)
+	}
+	v.prepareStatements()
+	return v, nil
+}
+
+// String returns the name of the view.
+func (v *View) String() string { return "mview." + v.Name }
+
+func (v *View) parseDefinition(sel *dml.Select) error {
+	switch {
+	case sel.Table.DerivedTable != nil || sel.Table.Expression != "":
+		return errors.NotSupported.Newf("[mview] Derived tables are not supported")
+	case v.Source == "":
+		return errors.Empty.Newf("[mview] FROM table is missing")
+	case len(sel.Wheres) > 0, len(sel.Joins) > 0, len(sel.Havings) > 0:
+		return errors.NotSupported.Newf("[mview] WHERE, JOIN and HAVING are not supported")
+	case sel.IsDistinct, sel.IsStar, sel.IsCountStar:
+		return errors.NotSupported.Newf("[mview] DISTINCT, * and COUNT(*) queries are not supported")
+	case len(sel.GroupBys) == 0:
+		return errors.Empty.Newf("[mview] At least one GROUP BY column is required")
+	}
+
+	for _, gb := range sel.GroupBys {
+		if gb.Expression != "" {
+			return errors.NotSupported.Newf("[mview] GROUP BY expression %q not supported", gb.Expression)
+		}
+		v.groupBys = append(v.groupBys, unqualify(gb.Name))
+	}
+
+	for _, c := range sel.Columns {
+		if c.Window != nil || c.DerivedTable != nil {
+			return errors.NotSupported.Newf("[mview] Window functions and sub selects are not supported")
+		}
+		if c.Expression == "" {
+			name := unqualify(c.Name)
+			if !strInSlice(name, v.groupBys) {
+				return errors.NotValid.Newf("[mview] Column %q must be part of the GROUP BY clause", c.Name)
+			}
+			if c.Aliased != "" && c.Aliased != name {
+				return errors.NotSupported.Newf("[mview] GROUP BY column %q cannot have an alias", c.Name)
+			}
+			continue
+		}
+
+		m := regexAggregate.FindStringSubmatch(strings.Replace(c.Expression, "`", "", -1))
+		if m == nil {
+			return errors.NotSupported.Newf("[mview] Expression %q not supported", c.Expression)
+		}
+		if c.Aliased == "" {
+			return errors.Empty.Newf("[mview] Expression %q requires an alias", c.Expression)
+		}
+		if err := dml.IsValidIdentifier(c.Aliased); err != nil {
+			return errors.WithStack(err)
+		}
+		agg := aggregate{fn: strings.ToUpper(m[1]), column: m[3], alias: c.Aliased}
+		if agg.column == "" && agg.fn != aggCount {
+			return errors.NotSupported.Newf("[mview] %s(*) not supported", agg.fn)
+		}
+		if agg.alias == ColumnRowCount || strInSlice(agg.alias, v.groupBys) {
+			return errors.AlreadyExists.Newf("[mview] Alias %q already in use", agg.alias)
+		}
+		v.aggregates = append(v.aggregates, agg)
+	}
+	if len(v.aggregates) == 0 {
+		return errors.Empty.Newf("[mview] At least one aggregate function is required")
+	}
+	return nil
+}
+
+// columns returns all column names of the view table in the correct order.
+func (v *View) columns() []string {
+	cols := make([]string, 0, len(v.groupBys)+len(v.aggregates)+1)
+	cols = append(cols, v.groupBys...)
+	for _, a := range v.aggregates {
+		cols = append(cols, a.alias)
+	}
+	return append(cols, ColumnRowCount)
+}
+
+// selectDefinition creates the SELECT statement which calculates the whole
+// view or, with placeholders for the group columns, a single group.
+func (v *View) selectDefinition() *dml.Select {
+	sel := dml.NewSelect(v.groupBys...).From(v.Source)
+	for _, a := range v.aggregates {
+		arg := "*"
+		if a.column != "" {
+			arg = dml.Quoter.Name(a.column)
+		}
+		sel.AddColumnsConditions(dml.Expr(a.fn + "(" + arg + ")").Alias(a.alias))
+	}
+	return sel.
+		AddColumnsConditions(dml.Expr("COUNT(*)").Alias(ColumnRowCount)).
+		GroupBy(v.groupBys...)
+}
+
+func (v *View) groupConditions() dml.Conditions {
+	cnds := make(dml.Conditions, len(v.groupBys))
+	for i, g := range v.groupBys {
+		cnds[i] = dml.Column(g).PlaceHolder()
+	}
+	return cnds
+}
+
+func (v *View) prepareStatements() {
+	qRC := dml.Quoter.Name(ColumnRowCount)
+
+	v.stmtUpsert = dml.NewInsert(v.Name).AddColumns(v.columns()...).BuildValues()
+	v.stmtRemove = dml.NewUpdate(v.Name).Set(dml.Column(ColumnRowCount).Expr(qRC + "-1"))
+	v.stmtRecompute = make(map[int]*dml.Update)
+
+	for i, a := range v.aggregates {
+		qa := dml.Quoter.Name(a.alias)
+		var expr string
+		switch a.fn {
+		case aggCount:
+			expr = qa + "+VALUES(" + qa + ")"
+			v.stmtRemove.Set(dml.Column(a.alias).Expr(qa + "-?"))
+		case aggSum:
+			expr = "IF(VALUES(" + qa + ") IS NULL," + qa + ",COALESCE(" + qa + ",0)+VALUES(" + qa + "))"
+			v.stmtRemove.Set(dml.Column(a.alias).Expr(qa + "-COALESCE(?,0)"))
+		case aggMin, aggMax:
+			fn := "LEAST"
+			if a.fn == aggMax {
+				fn = "GREATEST"
+			}
+			expr = fn + "(COALESCE(" + qa + ",VALUES(" + qa + ")),COALESCE(VALUES(" + qa + ")," + qa + "))"
+
+			// A removed row which contains the current MIN or MAX value
+			// requires to recalculate the group from the source table.
+			var buf bytes.Buffer
+			buf.WriteString("(SELECT " + a.fn + "(" + dml.Quoter.Name(a.column) + ") FROM " + dml.Quoter.Name(v.Source) + " WHERE ")
+			for j, g := range v.groupBys {
+				if j > 0 {
+					buf.WriteString(" AND ")
+				}
+				buf.WriteString(dml.Quoter.Name(g) + " = ?")
+			}
+			buf.WriteByte(')')
+			v.stmtRecompute[i] = dml.NewUpdate(v.Name).
+				Set(dml.Column(a.alias).Expr(buf.String())).
+				Where(v.groupConditions()...).
+				Where(dml.Column(a.alias).PlaceHolder())
+		}
+		v.stmtUpsert.AddOnDuplicateKey(dml.Column(a.alias).Expr(expr))
+	}
+	v.stmtUpsert.AddOnDuplicateKey(dml.Column(ColumnRowCount).Expr(qRC + "+VALUES(" + qRC + ")"))
+	v.stmtRemove.Where(v.groupConditions()...)
+	v.stmtCleanup = dml.NewDelete(v.Name).Where(v.groupConditions()...).Where(dml.Column(ColumnRowCount).LessOrEqual().Int(0))
+}
+
+// createSyntax generates the CREATE TABLE statement of the view table. The
+// column types get derived from the source table.
+func (v *View) createSyntax(sourceCols ddl.Columns) (string, error) {
+	var buf bytes.Buffer
+	buf.WriteString("CREATE TABLE IF NOT EXISTS ")
+	dml.Quoter.WriteIdentifier(&buf, v.Name)
+	buf.WriteString(" (\n")
+
+	for _, g := range v.groupBys {
+		c := sourceCols.ByField(g)
+		if c.Field == "" {
+			return "", errors.NotFound.Newf("[mview] Column %q not found in table %q", g, v.Source)
+		}
+		if c.IsNull() {
+			return "", errors.NotSupported.Newf("[mview] GROUP BY column %q of table %q must be NOT NULL", g, v.Source)
+		}
+		buf.WriteString("  ")
+		dml.Quoter.WriteIdentifier(&buf, g)
+		buf.WriteString(" " + c.ColumnType + " NOT NULL,\n")
+	}
+	for _, a := range v.aggregates {
+		var typ string
+		if a.column != "" {
+			c := sourceCols.ByField(a.column)
+			if c.Field == "" {
+				return "", errors.NotFound.Newf("[mview] Column %q not found in table %q", a.column, v.Source)
+			}
+			typ = aggregateColumnType(a.fn, c)
+		} else {
+			typ = aggregateColumnType(a.fn, nil)
+		}
+		buf.WriteString("  ")
+		dml.Quoter.WriteIdentifier(&buf, a.alias)
+		buf.WriteString(" " + typ + ",\n")
+	}
+	buf.WriteString("  ")
+	dml.Quoter.WriteIdentifier(&buf, ColumnRowCount)
+	buf.WriteString(" BIGINT NOT NULL DEFAULT 0,\n  PRIMARY KEY (")
+	for i, g := range v.groupBys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		dml.Quoter.WriteIdentifier(&buf, g)
+	}
+	buf.WriteString(")\n)")
+	return buf.String(), nil
+}
+
+func aggregateColumnType(fn string, c *ddl.Column) string {
+	switch fn {
+	case aggCount:
+		return "BIGINT NOT NULL DEFAULT 0"
+	case aggSum:
+		switch c.DataType {
+		case "float", "double":
+			return "DOUBLE NULL"
+		case "decimal":
+			return "DECIMAL(65," + strconv.FormatInt(c.Scale.Int64, 10) + ") NULL"
+		}
+		return "DECIMAL(65,0) NULL"
+	}
+	return c.ColumnType + " NULL"
+}
+
+// Create creates the view table and the checkpoint table, if they do not yet
+// exist, and fills the view table with the data of the source table.
+func (v *View) Create(ctx context.Context) error {
+	tc, err := ddl.LoadColumns(ctx, v.dbcp.DB, v.Source)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(tc[v.Source]) == 0 {
+		return errors.NotFound.Newf("[mview] Source table %q for view %q not found", v.Source, v.Name)
+	}
+	createView, err := v.createSyntax(tc[v.Source])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, stmt := range [...]string{createView, v.createCheckpointSyntax()} {
+		if _, err := v.dbcp.DB.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "[mview] Failed to execute %q", stmt)
+		}
+	}
+	return errors.WithStack(v.Refresh(ctx))
+}
+
+// Refresh calculates the whole view from the source table into a new table
+// and swaps it atomically with the current view table. The source table stays
+// read locked while the binlog position gets loaded and the new table gets
+// filled. The position gets stored as checkpoint, hence row events contained
+// in the refresh won't be applied again.
+func (v *View) Refresh(ctx context.Context) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	tmpName := ddl.TableName("", v.Name, "new")
+	qTmp, qName := dml.Quoter.Name(tmpName), dml.Quoter.Name(v.Name)
+	dropTmp := "DROP TABLE IF EXISTS " + qTmp
+
+	for _, stmt := range [...]string{dropTmp, "CREATE TABLE " + qTmp + " LIKE " + qName} {
+		if _, err := v.dbcp.DB.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "[mview] Failed to execute %q", stmt)
+		}
+	}
+
+	ms, err := v.fill(ctx, tmpName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	vt := ddl.NewTable(v.Name)
+	if err := vt.Swap(ctx, v.dbcp.DB, tmpName); err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := v.dbcp.DB.ExecContext(ctx, dropTmp); err != nil {
+		return errors.Wrapf(err, "[mview] Failed to execute %q", dropTmp)
+	}
+
+	if err := v.saveCheckpoint(ctx, v.dbcp.DB, ms); err != nil {
+		return errors.WithStack(err)
+	}
+	v.stale = false
+
+	if v.opts.Log.IsInfo() {
+		v.opts.Log.Info("mview.View.Refresh", log.String("view", v.Name), log.String("source", v.Source), log.Stringer("checkpoint", ms))
+	}
+	return nil
+}
+
+// fill loads the binlog position and copies the view data into table
+// `tmpName`. Both happen on one connection while the source table is read
+// locked, so the copy contains exactly the row events up to the position.
+func (v *View) fill(ctx context.Context, tmpName string) (ms ddl.MasterStatus, err error) {
+	conn, err := v.dbcp.Conn(ctx)
+	if err != nil {
+		return ms, errors.WithStack(err)
+	}
+	defer func() {
+		if errC := conn.Close(); err == nil && errC != nil {
+			err = errors.WithStack(errC)
+		}
+	}()
+
+	lock := "LOCK TABLES " + dml.Quoter.Name(v.Source) + " READ, " + dml.Quoter.Name(tmpName) + " WRITE"
+	if _, err = conn.DB.ExecContext(ctx, lock); err != nil {
+		return ms, errors.Wrapf(err, "[mview] Failed to execute %q", lock)
+	}
+	defer func() {
+		if _, errU := conn.DB.ExecContext(ctx, "UNLOCK TABLES"); err == nil && errU != nil {
+			err = errors.Wrapf(errU, "[mview] Failed to unlock tables for view %q", v.Name)
+		}
+	}()
+
+	if _, err = conn.WithQueryBuilder(&ms).Load(ctx, &ms); err != nil {
+		return ms, errors.Wrapf(err, "[mview] Failed to load master status for view %q", v.Name)
+	}
+	ins := conn.InsertInto(tmpName).AddColumns(v.columns()...).FromSelect(v.selectDefinition())
+	if _, err = ins.WithArgs().ExecContext(ctx); err != nil {
+		return ms, errors.Wrapf(err, "[mview] Failed to fill table %q for view %q", tmpName, v.Name)
+	}
+	return ms, nil
+}
+
+func unqualify(name string) string {
+	if pos := strings.LastIndexByte(name, '.'); pos >= 0 {
+		return name[pos+1:]
+	}
+	return name
+}
+
+func strInSlice(search string, sl []string) bool {
+	for _, s := range sl {
+		if s == search {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,189 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mview_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/mview"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+const (
+	sqlUpsert  = "INSERT INTO `mview_customer_revenue` (`customer_id`,`order_count`,`revenue`,`last_order_at`,`mview_row_count`) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE"
+	sqlRemove  = "UPDATE `mview_customer_revenue` SET `mview_row_count`=`mview_row_count`-1, `order_count`=`order_count`-?, `revenue`=`revenue`-COALESCE(?,0) WHERE (`customer_id` = ?)"
+	sqlMax     = "UPDATE `mview_customer_revenue` SET `last_order_at`=(SELECT MAX(`created_at`) FROM `sales_order` WHERE `customer_id` = ?)"
+	sqlCleanup = "DELETE FROM `mview_customer_revenue` WHERE (`customer_id` = ?) AND (`mview_row_count` <= 0)"
+	sqlCheckpt = "INSERT INTO `mview_checkpoint` (`view_name`,`binlog_file`,`binlog_position`) VALUES (?,?,?) ON DUPLICATE KEY UPDATE"
+)
+
+func newView(t *testing.T, dbc *dml.ConnPool, o *mview.Options) *mview.View {
+	sel := dml.NewSelect("customer_id").From("sales_order").
+		AddColumnsConditions(
+			dml.Expr("COUNT(*)").Alias("order_count"),
+			dml.Expr("SUM(grand_total)").Alias("revenue"),
+			dml.Expr("MAX(created_at)").Alias("last_order_at"),
+		).
+		GroupBy("customer_id")
+	v, err := mview.NewView(dbc, "mview_customer_revenue", sel, o)
+	assert.NoError(t, err)
+	return v
+}
+
+func salesOrderTable() *ddl.Table {
+	return ddl.NewTable("sales_order",
+		&ddl.Column{Field: "entity_id"},
+		&ddl.Column{Field: "customer_id"},
+		&ddl.Column{Field: "grand_total"},
+		&ddl.Column{Field: "created_at"},
+	)
+}
+
+func expectRefresh(dbMock sqlmock.Sqlmock, file string, pos int) {
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DROP TABLE IF EXISTS `mview_customer_revenue_new`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE `mview_customer_revenue_new` LIKE `mview_customer_revenue`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("LOCK TABLES `sales_order` READ, `mview_customer_revenue_new` WRITE")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow(file, pos, "", "", ""))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("INSERT INTO `mview_customer_revenue_new` (`customer_id`,`order_count`,`revenue`,`last_order_at`,`mview_row_count`) SELECT `customer_id`, COUNT(*) AS `order_count`, SUM(`grand_total`) AS `revenue`, MAX(`created_at`) AS `last_order_at`, COUNT(*) AS `mview_row_count` FROM `sales_order` GROUP BY `customer_id`")).
+		WillReturnResult(sqlmock.NewResult(0, 12))
+	dbMock.ExpectExec("UNLOCK TABLES").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec("RENAME TABLE `mview_customer_revenue` TO .+`mview_customer_revenue_new` TO `mview_customer_revenue`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DROP TABLE IF EXISTS `mview_customer_revenue_new`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCheckpt)).WithArgs("mview_customer_revenue", file, pos).WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestView_Create(t *testing.T) {
+	t.Parallel()
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	dbMock.ExpectQuery("SELECT.+FROM information_schema.COLUMNS WHERE").
+		WillReturnRows(dmltest.MustMockRows(dmltest.WithFile("testdata/sales_order_columns.csv")))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE IF NOT EXISTS `mview_customer_revenue` (\n  `customer_id` int(10) unsigned NOT NULL,")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE IF NOT EXISTS `mview_checkpoint`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectRefresh(dbMock, "mysql-bin.000004", 4711)
+
+	v := newView(t, dbc, nil)
+	assert.NoError(t, v.Create(context.TODO()))
+	assert.Exactly(t, "mview.mview_customer_revenue", v.String())
+}
+
+func TestView_Do(t *testing.T) {
+	t.Parallel()
+
+	createdAt := time.Date(2019, 2, 3, 4, 5, 6, 0, time.UTC)
+	position := ddl.MasterStatus{File: "mysql-bin.000004", Position: 5000}
+
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+	v := newView(t, dbc, &mview.Options{
+		Position: func(context.Context) (ddl.MasterStatus, bool) { return position, true },
+	})
+	var _ binlogsync.RowsEventHandler = v
+
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta("SELECT `binlog_file` AS `File`, `binlog_position` AS `Position` FROM `mview_checkpoint` WHERE (`view_name` = ?)")).
+		WithArgs("mview_customer_revenue").WillReturnRows(sqlmock.NewRows([]string{"File", "Position"}).AddRow("mysql-bin.000004", 4711))
+	ms, err := v.Checkpoint(context.TODO())
+	assert.NoError(t, err)
+	assert.Exactly(t, ddl.MasterStatus{File: "mysql-bin.000004", Position: 4711}, ms)
+
+	t.Run("insert", func(t *testing.T) {
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlUpsert)).WithArgs(33, 1, "12.3400", createdAt, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlUpsert)).WithArgs(34, 1, nil, createdAt, 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCheckpt)).WithArgs("mview_customer_revenue", "mysql-bin.000004", 5000).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.InsertAction, salesOrderTable(), [][]interface{}{
+			{1, 33, "12.3400", createdAt},
+			{2, 34, nil, createdAt},
+		}))
+	})
+
+	t.Run("update moves row to another group", func(t *testing.T) {
+		position = ddl.MasterStatus{File: "mysql-bin.000004", Position: 5200}
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlRemove)).WithArgs(1, "12.3400", 33).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlMax)).WithArgs(33, 33, createdAt).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCleanup)).WithArgs(33).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlUpsert)).WithArgs(34, 1, "12.3400", createdAt, 1).WillReturnResult(sqlmock.NewResult(0, 2))
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCheckpt)).WithArgs("mview_customer_revenue", "mysql-bin.000004", 5200).WillReturnResult(sqlmock.NewResult(0, 1))
+		dbMock.ExpectCommit()
+
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.UpdateAction, salesOrderTable(), [][]interface{}{
+			{1, 33, "12.3400", createdAt},
+			{1, 34, "12.3400", createdAt},
+		}))
+	})
+
+	t.Run("other table ignored", func(t *testing.T) {
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.InsertAction, ddl.NewTable("sales_invoice"), [][]interface{}{{1}}))
+	})
+
+	t.Run("event before checkpoint skipped", func(t *testing.T) {
+		position = ddl.MasterStatus{File: "mysql-bin.000003", Position: 9000}
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.DeleteAction, salesOrderTable(), [][]interface{}{
+			{2, 34, nil, createdAt},
+		}))
+	})
+
+	t.Run("event at checkpoint skipped", func(t *testing.T) {
+		// after a restart the event which wrote the checkpoint gets replayed.
+		position = ddl.MasterStatus{File: "mysql-bin.000004", Position: 5000}
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.InsertAction, salesOrderTable(), [][]interface{}{
+			{1, 33, "12.3400", createdAt},
+		}))
+		position = ddl.MasterStatus{File: "mysql-bin.000004", Position: 6000}
+	})
+
+	t.Run("failure marks view stale and Complete refreshes", func(t *testing.T) {
+		dbMock.ExpectBegin()
+		dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlRemove)).WithArgs(1, nil, 34).WillReturnError(errors.ConnectionLost.Newf("Lost"))
+		dbMock.ExpectRollback()
+
+		err := v.Do(context.TODO(), binlogsync.DeleteAction, salesOrderTable(), [][]interface{}{
+			{2, 34, nil, createdAt},
+		})
+		assert.True(t, errors.ConnectionLost.Match(err), "%+v", err)
+		assert.True(t, v.IsStale())
+
+		// stale views ignore further events
+		assert.NoError(t, v.Do(context.TODO(), binlogsync.InsertAction, salesOrderTable(), [][]interface{}{
+			{3, 35, "1.0000", createdAt},
+		}))
+
+		expectRefresh(dbMock, "mysql-bin.000004", 7000)
+		assert.NoError(t, v.Complete(context.TODO()))
+		assert.False(t, v.IsStale())
+	})
+
+	t.Run("update with odd rows", func(t *testing.T) {
+		position = ddl.MasterStatus{File: "mysql-bin.000004", Position: 8000}
+		err := v.Do(context.TODO(), binlogsync.UpdateAction, salesOrderTable(), [][]interface{}{
+			{3, 35, "1.0000", createdAt},
+		})
+		assert.True(t, errors.NotValid.Match(err), "%+v", err)
+	})
+}
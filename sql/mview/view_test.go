@@ -0,0 +1,116 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mview
+
+import (
+	"testing"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+	"github.com/corestoreio/pkg/storage/null"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+func newTestView(t *testing.T) *View {
+	dbc, err := dml.NewConnPool()
+	assert.NoError(t, err)
+	sel := dml.NewSelect("so.customer_id").FromAlias("sales_order", "so").
+		AddColumnsConditions(
+			dml.Expr("COUNT(*)").Alias("order_count"),
+			dml.Expr("SUM(`so`.`grand_total`)").Alias("revenue"),
+			dml.Expr("max(created_at)").Alias("last_order_at"),
+		).
+		GroupBy("so.customer_id")
+	v, err := NewView(dbc, "mview_customer_revenue", sel, nil)
+	assert.NoError(t, err)
+	return v
+}
+
+func TestNewView_Definition(t *testing.T) {
+	t.Parallel()
+
+	dbc, err := dml.NewConnPool()
+	assert.NoError(t, err)
+
+	tests := []struct {
+		sel     *dml.Select
+		errKind errors.Kind
+	}{
+		{dml.NewSelect("customer_id").From("sales_order").AddColumnsConditions(dml.Expr("COUNT(*)").Alias("c")), errors.Empty},
+		{dml.NewSelect("customer_id").From("sales_order").GroupBy("customer_id"), errors.Empty},
+		{dml.NewSelect("store_id").From("sales_order").AddColumnsConditions(dml.Expr("COUNT(*)").Alias("c")).GroupBy("customer_id"), errors.NotValid},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("AVG(grand_total)").Alias("c")).GroupBy("customer_id"), errors.NotSupported},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("SUM(*)").Alias("c")).GroupBy("customer_id"), errors.NotSupported},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("SUM(grand_total)")).GroupBy("customer_id"), errors.Empty},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("COUNT(*)").Alias(ColumnRowCount)).GroupBy("customer_id"), errors.AlreadyExists},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("COUNT(*)").Alias("c")).GroupBy("customer_id").Where(dml.Column("store_id").Int(1)), errors.NotSupported},
+		{dml.NewSelect().From("sales_order").AddColumnsConditions(dml.Expr("COUNT(*)").Alias("c")).Unsafe().GroupBy("YEAR(created_at)"), errors.NotSupported},
+		{dml.NewSelect().AddColumnsConditions(dml.Expr("COUNT(*)").Alias("c")).GroupBy("customer_id"), errors.Empty},
+	}
+	for i, test := range tests {
+		_, err := NewView(dbc, "mview_test", test.sel, nil)
+		assert.True(t, test.errKind.Match(err), "Index %d => %+v", i, err)
+	}
+
+	_, err = NewView(nil, "mview_test", dml.NewSelect(), nil)
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+}
+
+func TestView_Statements(t *testing.T) {
+	t.Parallel()
+
+	v := newTestView(t)
+	assert.Exactly(t, "sales_order", v.Source)
+	assert.Exactly(t, []string{"customer_id"}, v.groupBys)
+
+	tests := []struct {
+		qb   dml.QueryBuilder
+		want string
+	}{
+		{v.selectDefinition(), "SELECT `customer_id`, COUNT(*) AS `order_count`, SUM(`grand_total`) AS `revenue`, MAX(`created_at`) AS `last_order_at`, COUNT(*) AS `mview_row_count` FROM `sales_order` GROUP BY `customer_id`"},
+		{v.stmtUpsert, "INSERT INTO `mview_customer_revenue` (`customer_id`,`order_count`,`revenue`,`last_order_at`,`mview_row_count`) VALUES (?,?,?,?,?) ON DUPLICATE KEY UPDATE `order_count`=`order_count`+VALUES(`order_count`), `revenue`=IF(VALUES(`revenue`) IS NULL,`revenue`,COALESCE(`revenue`,0)+VALUES(`revenue`)), `last_order_at`=GREATEST(COALESCE(`last_order_at`,VALUES(`last_order_at`)),COALESCE(VALUES(`last_order_at`),`last_order_at`)), `mview_row_count`=`mview_row_count`+VALUES(`mview_row_count`)"},
+		{v.stmtRemove, "UPDATE `mview_customer_revenue` SET `mview_row_count`=`mview_row_count`-1, `order_count`=`order_count`-?, `revenue`=`revenue`-COALESCE(?,0) WHERE (`customer_id` = ?)"},
+		{v.stmtRecompute[2], "UPDATE `mview_customer_revenue` SET `last_order_at`=(SELECT MAX(`created_at`) FROM `sales_order` WHERE `customer_id` = ?) WHERE (`customer_id` = ?) AND (`last_order_at` = ?)"},
+		{v.stmtCleanup, "DELETE FROM `mview_customer_revenue` WHERE (`customer_id` = ?) AND (`mview_row_count` <= 0)"},
+	}
+	for i, test := range tests {
+		sqlStr, _, err := test.qb.ToSQL()
+		assert.NoError(t, err, "Index %d", i)
+		assert.Exactly(t, test.want, sqlStr, "Index %d", i)
+	}
+}
+
+func TestView_CreateSyntax(t *testing.T) {
+	t.Parallel()
+
+	v := newTestView(t)
+	cols := ddl.Columns{
+		&ddl.Column{Field: "customer_id", Null: "NO", DataType: "int", ColumnType: "int(10) unsigned"},
+		&ddl.Column{Field: "grand_total", Null: "YES", DataType: "decimal", ColumnType: "decimal(12,4)", Scale: null.MakeInt64(4)},
+		&ddl.Column{Field: "created_at", Null: "NO", DataType: "timestamp", ColumnType: "timestamp"},
+	}
+
+	s, err := v.createSyntax(cols)
+	assert.NoError(t, err)
+	assert.Exactly(t, "CREATE TABLE IF NOT EXISTS `mview_customer_revenue` (\n  `customer_id` int(10) unsigned NOT NULL,\n  `order_count` BIGINT NOT NULL DEFAULT 0,\n  `revenue` DECIMAL(65,4) NULL,\n  `last_order_at` timestamp NULL,\n  `mview_row_count` BIGINT NOT NULL DEFAULT 0,\n  PRIMARY KEY (`customer_id`)\n)", s)
+
+	cols[0].Null = "YES"
+	_, err = v.createSyntax(cols)
+	assert.True(t, errors.NotSupported.Match(err), "%+v", err)
+
+	_, err = v.createSyntax(cols[1:])
+	assert.True(t, errors.NotFound.Match(err), "%+v", err)
+}
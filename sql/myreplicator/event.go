@@ -321,6 +321,13 @@ func (e *GTIDEvent) decode(data []byte) error {
 	return nil
 }
 
+// GTIDNext returns the global transaction identifier in the format
+// source_id:transaction_id as used for the variable GTID_NEXT.
+func (e *GTIDEvent) GTIDNext() string {
+	u, _ := uuid.FromBytes(e.SID)
+	return u.String() + ":" + strconv.FormatInt(e.GNO, 10)
+}
+
 func (e *GTIDEvent) Dump(w io.Writer) {
 	fmt.Fprintf(w, "Commit flag: %d\n", e.CommitFlag)
 	u, _ := uuid.FromBytes(e.SID)
@@ -0,0 +1,588 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osc
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dml"
+)
+
+// DefaultChunkSize defines the number of rows copied with one statement.
+const DefaultChunkSize = 1000
+
+// Options applies optional settings to an Alter.
+type Options struct {
+	Log log.Logger
+	// Position returns the binlog position up to which all row events have
+	// been applied, usually function binlogsync.Canal.SyncedPosition. See
+	// RegisterCanal.
+	Position func() ddl.MasterStatus
+	// ShadowTable defines the name of the table which receives the new
+	// structure. Defaults to the table name with suffix "osc".
+	ShadowTable string
+	// ChunkSize defaults to DefaultChunkSize.
+	ChunkSize int
+	// MaxThreadsRunning pauses the copy while the global status
+	// Threads_running exceeds the value. Zero disables the check.
+	MaxThreadsRunning int
+	// Throttle gets called before each chunk and pauses the copy while it
+	// returns true, e.g. to check the replication lag of the replicas.
+	Throttle func(context.Context) (bool, error)
+	// ThrottleInterval defines the pause before throttling gets checked again.
+	// Defaults to one second.
+	ThrottleInterval time.Duration
+	// PollInterval defines how often the position gets checked while waiting
+	// for the canal to apply the binlog. Defaults to 100ms.
+	PollInterval time.Duration
+	// SkipChecksum disables the comparison of both tables after the copy.
+	SkipChecksum bool
+	// ChecksumRetries defines how often the checksum of a chunk gets
+	// calculated again, after waiting for the binlog, before the mismatch
+	// aborts the schema change. Concurrent writes can lead to temporary
+	// differences. Defaults to 3.
+	ChecksumRetries int
+	// CutOverLockTimeout defines how long the cut-over waits for the table
+	// locks and then, with the locks held, for the canal to apply the last
+	// events. It gets also set, rounded up to seconds, as lock_wait_timeout of
+	// the session which replays the events. Defaults to 3s.
+	CutOverLockTimeout time.Duration
+	// DropOldTable drops the table with the old data after the cut-over,
+	// otherwise it stays available with the name of the shadow table.
+	DropOldTable bool
+}
+
+// Alter changes the structure of a table online. Alter implements the
+// interface binlogsync.RowsEventHandler to replay the changes of the original
+// table onto the shadow table.
+type Alter struct {
+	// Table defines the name of the table to alter.
+	Table string
+	// Shadow defines the name of the table with the new structure.
+	Shadow string
+	// Statement contains the alter specification without the leading ALTER
+	// TABLE name, e.g. "ADD COLUMN `x` INT NULL, DROP INDEX `y`".
+	Statement string
+	opts      Options
+	dbcp      *dml.ConnPool
+
+	// pk contains the primary key columns, columns the columns available in
+	// both tables and checksumColumns those which have the same type.
+	pk              []string
+	columns         []string
+	checksumColumns []string
+	sqlReplace      string
+	sqlDelete       string
+	rowsCopied      int64
+
+	// mu serializes the replay of the row events and the cut-over.
+	mu sync.Mutex
+	// applying gets set once the shadow table exists and until the cut-over
+	// has finished.
+	applying bool
+	// applier executes the replayed events. It is the session which later
+	// holds the table locks of the cut-over, hence a replayed event never
+	// waits for the locks of the cut-over.
+	applier dml.Execer
+	// err gets set when a row event could not be applied or the original
+	// table has been altered. It aborts the schema change.
+	err error
+}
+
+// NewAlter creates a new online schema change for `table`. Argument
+// `statement` contains the alter specification, without ALTER TABLE.
+//		a, err := osc.NewAlter(dbc, "sales_order_grid", "ADD INDEX `IDX_CHANNEL` (`channel`)", nil)
+func NewAlter(dbcp *dml.ConnPool, table, statement string, o *Options) (*Alter, error) {
+	if dbcp == nil {
+		return nil, errors.Empty.Newf("[osc] A database connection pool is required for table %q", table)
+	}
+	if err := dml.IsValidIdentifier(table); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	statement = strings.TrimSpace(statement)
+	if statement == "" {
+		return nil, errors.Empty.Newf("[osc] Alter statement for table %q is empty", table)
+	}
+	if strings.HasPrefix(strings.ToUpper(statement), "ALTER ") {
+		return nil, errors.NotValid.Newf("[osc] Alter statement for table %q must not start with ALTER TABLE", table)
+	}
+
+	a := &Alter{
+		Table:     table,
+		Statement: statement,
+		dbcp:      dbcp,
+	}
+	if o != nil {
+		a.opts = *o
+	}
+	if a.opts.Log == nil {
+		a.opts.Log = log.BlackHole{}
+	}
+	if a.opts.ShadowTable == "" {
+		a.opts.ShadowTable = ddl.TableName("", table, "osc")
+	}
+	if err := dml.IsValidIdentifier(a.opts.ShadowTable); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if a.opts.ChunkSize < 1 {
+		a.opts.ChunkSize = DefaultChunkSize
+	}
+	if a.opts.ThrottleInterval == 0 {
+		a.opts.ThrottleInterval = time.Second
+	}
+	if a.opts.PollInterval == 0 {
+		a.opts.PollInterval = 100 * time.Millisecond
+	}
+	if a.opts.ChecksumRetries == 0 {
+		a.opts.ChecksumRetries = 3
+	}
+	if a.opts.CutOverLockTimeout == 0 {
+		a.opts.CutOverLockTimeout = 3 * time.Second
+	}
+	a.Shadow = a.opts.ShadowTable
+	return a, nil
+}
+
+// RowsCopied returns the number of rows inserted into the shadow table by the
+// copy.
+func (a *Alter) RowsCopied() int64 {
+	return atomic.LoadInt64(&a.rowsCopied)
+}
+
+func (a *Alter) lastErr() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.err
+}
+
+// Run executes the schema change: creates the shadow table, copies the rows,
+// verifies the checksums and swaps both tables. The canal must run the whole
+// time. In case of an error the original table stays untouched and the shadow
+// table remains for inspection.
+func (a *Alter) Run(ctx context.Context) (err error) {
+	if a.opts.Position == nil {
+		return errors.NotValid.Newf("[osc] Table %q requires a binlog position, see function RegisterCanal", a.Table)
+	}
+	start := time.Now()
+
+	if err := a.createShadow(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+
+	conn, err := a.dbcp.Conn(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err2 := conn.Close(); err2 != nil && err == nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+	timeout := int64((a.opts.CutOverLockTimeout + time.Second - 1) / time.Second)
+	if err := a.exec(ctx, conn.DB, "SET SESSION lock_wait_timeout = "+strconv.FormatInt(timeout, 10)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	a.mu.Lock()
+	a.applier = conn.DB
+	a.applying = true
+	a.err = nil
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		a.applying = false
+		a.applier = nil
+		a.mu.Unlock()
+	}()
+
+	if err := a.copyRows(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := a.waitForBinlog(ctx); err != nil {
+		return errors.WithStack(err)
+	}
+	if !a.opts.SkipChecksum {
+		if err := a.verifyChecksums(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if err := a.cutOver(ctx, conn); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if a.opts.DropOldTable {
+		if err := ddl.NewTable(a.Shadow).Drop(ctx, a.dbcp.DB); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if a.opts.Log.IsInfo() {
+		a.opts.Log.Info("osc.Alter.Run.done", log.String("table", a.Table), log.String("shadow", a.Shadow),
+			log.Int64("rows_copied", a.RowsCopied()), log.Duration("duration", time.Since(start)))
+	}
+	return nil
+}
+
+func (a *Alter) exec(ctx context.Context, db dml.Execer, stmts ...string) error {
+	for _, stmt := range stmts {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return errors.Wrapf(err, "[osc] Failed to execute %q", stmt)
+		}
+	}
+	return nil
+}
+
+// createShadow creates the shadow table, applies the alter statement and
+// compares the columns of both tables.
+func (a *Alter) createShadow(ctx context.Context) error {
+	tc, err := ddl.LoadColumns(ctx, a.dbcp.DB, a.Table)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	src := tc[a.Table]
+	if len(src) == 0 {
+		return errors.NotFound.Newf("[osc] Table %q not found", a.Table)
+	}
+	a.pk = src.PrimaryKeys().FieldNames()
+	if len(a.pk) == 0 {
+		return errors.NotSupported.Newf("[osc] Table %q requires a primary key", a.Table)
+	}
+
+	qs, qt := dml.Quoter.Name(a.Shadow), dml.Quoter.Name(a.Table)
+	if err := a.exec(ctx, a.dbcp.DB,
+		"DROP TABLE IF EXISTS "+qs,
+		"CREATE TABLE "+qs+" LIKE "+qt,
+		"ALTER TABLE "+qs+" "+a.Statement,
+	); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if tc, err = ddl.LoadColumns(ctx, a.dbcp.DB, a.Shadow); err != nil {
+		return errors.WithStack(err)
+	}
+	dst := tc[a.Shadow]
+	if pk := dst.PrimaryKeys().FieldNames(); !reflect.DeepEqual(pk, a.pk) {
+		return errors.NotSupported.Newf("[osc] Alter statement must not change the primary key %v of table %q, got %v", a.pk, a.Table, pk)
+	}
+
+	a.columns = a.columns[:0]
+	a.checksumColumns = a.checksumColumns[:0]
+	for _, c := range src {
+		d := dst.ByField(c.Field)
+		if d.Field == "" {
+			continue
+		}
+		a.columns = append(a.columns, c.Field)
+		if d.ColumnType == c.ColumnType {
+			a.checksumColumns = append(a.checksumColumns, c.Field)
+		}
+	}
+
+	if a.sqlReplace, _, err = dml.NewInsert(a.Shadow).Replace().AddColumns(a.columns...).BuildValues().ToSQL(); err != nil {
+		return errors.WithStack(err)
+	}
+	del := dml.NewDelete(a.Shadow)
+	for _, pk := range a.pk {
+		del.Where(dml.Column(pk).PlaceHolder())
+	}
+	if a.sqlDelete, _, err = del.ToSQL(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if a.opts.Log.IsInfo() {
+		a.opts.Log.Info("osc.Alter.createShadow", log.String("table", a.Table), log.String("shadow", a.Shadow),
+			log.String("statement", a.Statement), log.Strings("columns", a.columns...))
+	}
+	return nil
+}
+
+// quotedColumns returns the quoted and comma separated column names with an
+// optional suffix for each column, like DESC.
+func quotedColumns(cols []string, suffix string) string {
+	var buf bytes.Buffer
+	for i, c := range cols {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		dml.Quoter.WriteIdentifier(&buf, c)
+		buf.WriteString(suffix)
+	}
+	return buf.String()
+}
+
+// rangeWhere creates the WHERE condition of a chunk. The lower bound is
+// exclusive and the upper bound inclusive. Composite primary keys use row
+// constructors.
+func (a *Alter) rangeWhere(hasLower bool) string {
+	tuple, ph := quotedColumns(a.pk, ""), "?"
+	if len(a.pk) > 1 {
+		tuple = "(" + tuple + ")"
+		ph = "(" + strings.TrimSuffix(strings.Repeat("?,", len(a.pk)), ",") + ")"
+	}
+	if hasLower {
+		return " WHERE " + tuple + " > " + ph + " AND " + tuple + " <= " + ph
+	}
+	return " WHERE " + tuple + " <= " + ph
+}
+
+func rangeArgs(lower, upper []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(lower)+len(upper))
+	return append(append(args, lower...), upper...)
+}
+
+// loadKey returns the primary key of the first row or nil if there is no row.
+func (a *Alter) loadKey(ctx context.Context, query string, args ...interface{}) (_ []interface{}, err error) {
+	rows, err := a.dbcp.DB.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "[osc] Failed to query %q", query)
+	}
+	defer func() {
+		if err2 := rows.Close(); err2 != nil && err == nil {
+			err = errors.WithStack(err2)
+		}
+	}()
+	if !rows.Next() {
+		return nil, errors.WithStack(rows.Err())
+	}
+	key := make([]interface{}, len(a.pk))
+	ptrs := make([]interface{}, len(a.pk))
+	for i := range key {
+		ptrs[i] = &key[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return nil, errors.Wrapf(err, "[osc] Failed to scan %q", query)
+	}
+	return key, nil
+}
+
+// walkChunks iterates over the original table in chunks ordered by the
+// primary key, up to the biggest key at the time of the call.
+func (a *Alter) walkChunks(ctx context.Context, fn func(lower, upper []interface{}) error) error {
+	qt, cols := dml.Quoter.Name(a.Table), quotedColumns(a.pk, "")
+	last, err := a.loadKey(ctx, "SELECT "+cols+" FROM "+qt+" ORDER BY "+quotedColumns(a.pk, " DESC")+" LIMIT 1")
+	if err != nil || last == nil {
+		return errors.WithStack(err) // no rows
+	}
+
+	offset := " LIMIT 1 OFFSET " + strconv.Itoa(a.opts.ChunkSize-1)
+	var lower []interface{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return errors.WithStack(err)
+		}
+		upper, err := a.loadKey(ctx, "SELECT "+cols+" FROM "+qt+a.rangeWhere(lower != nil)+" ORDER BY "+cols+offset, rangeArgs(lower, last)...)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		isLast := upper == nil || reflect.DeepEqual(upper, last)
+		if upper == nil {
+			upper = last
+		}
+		if err := fn(lower, upper); err != nil {
+			return errors.WithStack(err)
+		}
+		if isLast {
+			return nil
+		}
+		lower = upper
+	}
+}
+
+// copyRows copies the rows chunk by chunk into the shadow table. Existing rows
+// in the shadow table have been written by the binlog replay and are newer.
+func (a *Alter) copyRows(ctx context.Context) error {
+	cols := quotedColumns(a.columns, "")
+	ins := "INSERT IGNORE INTO " + dml.Quoter.Name(a.Shadow) + " (" + cols + ") SELECT " + cols + " FROM " + dml.Quoter.Name(a.Table)
+
+	return a.walkChunks(ctx, func(lower, upper []interface{}) error {
+		if err := a.throttle(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := a.lastErr(); err != nil {
+			return errors.WithStack(err)
+		}
+		res, err := a.dbcp.DB.ExecContext(ctx, ins+a.rangeWhere(lower != nil)+" LOCK IN SHARE MODE", rangeArgs(lower, upper)...)
+		if err != nil {
+			return errors.Wrapf(err, "[osc] Failed to copy chunk %v to %v of table %q", lower, upper, a.Table)
+		}
+		n, _ := res.RowsAffected()
+		copied := atomic.AddInt64(&a.rowsCopied, n)
+		if a.opts.Log.IsDebug() {
+			a.opts.Log.Debug("osc.Alter.copyRows", log.String("table", a.Table), log.Int64("rows_copied", copied))
+		}
+		return nil
+	})
+}
+
+// throttle blocks while the server is too busy.
+func (a *Alter) throttle(ctx context.Context) error {
+	for {
+		throttled, err := a.isThrottled(ctx)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if !throttled {
+			return nil
+		}
+		if a.opts.Log.IsInfo() {
+			a.opts.Log.Info("osc.Alter.throttle", log.String("table", a.Table), log.Duration("wait", a.opts.ThrottleInterval))
+		}
+		select {
+		case <-ctx.Done():
+			return errors.WithStack(ctx.Err())
+		case <-time.After(a.opts.ThrottleInterval):
+		}
+	}
+}
+
+func (a *Alter) isThrottled(ctx context.Context) (bool, error) {
+	if a.opts.MaxThreadsRunning > 0 {
+		var name string
+		var running int
+		if err := a.dbcp.DB.QueryRowContext(ctx, "SHOW GLOBAL STATUS LIKE 'Threads_running'").Scan(&name, &running); err != nil {
+			return false, errors.Wrap(err, "[osc] Failed to load status Threads_running")
+		}
+		if running > a.opts.MaxThreadsRunning {
+			return true, nil
+		}
+	}
+	if a.opts.Throttle != nil {
+		throttled, err := a.opts.Throttle(ctx)
+		return throttled, errors.WithStack(err)
+	}
+	return false, nil
+}
+
+// waitForBinlog waits until the canal has applied all events up to the current
+// master position.
+func (a *Alter) waitForBinlog(ctx context.Context) error {
+	var ms ddl.MasterStatus
+	if _, err := a.dbcp.WithQueryBuilder(&ms).Load(ctx, &ms); err != nil {
+		return errors.Wrapf(err, "[osc] Failed to load master status for table %q", a.Table)
+	}
+	for {
+		if err := a.lastErr(); err != nil {
+			return errors.WithStack(err)
+		}
+		if a.opts.Position().Compare(ms) >= 0 {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Wrapf(ctx.Err(), "[osc] Canal did not reach position %q for table %q", ms.String(), a.Table)
+		case <-time.After(a.opts.PollInterval):
+		}
+	}
+}
+
+// checksumQuery creates the query which counts the rows of a chunk and
+// calculates the XOR of all row checksums.
+func (a *Alter) checksumQuery(table string, hasLower bool) string {
+	var buf bytes.Buffer
+	buf.WriteString("SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#',")
+	buf.WriteString(quotedColumns(a.checksumColumns, ""))
+	buf.WriteString(",CONCAT(")
+	for i, c := range a.checksumColumns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		buf.WriteString("ISNULL(")
+		dml.Quoter.WriteIdentifier(&buf, c)
+		buf.WriteByte(')')
+	}
+	buf.WriteString(")))),0) FROM ")
+	dml.Quoter.WriteIdentifier(&buf, table)
+	buf.WriteString(a.rangeWhere(hasLower))
+	return buf.String()
+}
+
+func (a *Alter) checksum(ctx context.Context, table string, lower, upper []interface{}) (count int64, crc uint64, err error) {
+	q := a.checksumQuery(table, lower != nil)
+	err = a.dbcp.DB.QueryRowContext(ctx, q, rangeArgs(lower, upper)...).Scan(&count, &crc)
+	return count, crc, errors.Wrapf(err, "[osc] Failed to calculate checksum %q", q)
+}
+
+// verifyChecksums compares the checksum of each chunk in both tables. A
+// mismatch gets checked again after the canal has caught up.
+func (a *Alter) verifyChecksums(ctx context.Context) error {
+	if len(a.checksumColumns) == 0 {
+		return nil
+	}
+	return a.walkChunks(ctx, func(lower, upper []interface{}) error {
+		for i := 0; ; i++ {
+			srcCount, srcCRC, err := a.checksum(ctx, a.Table, lower, upper)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			dstCount, dstCRC, err := a.checksum(ctx, a.Shadow, lower, upper)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if srcCount == dstCount && srcCRC == dstCRC {
+				return nil
+			}
+			if i >= a.opts.ChecksumRetries {
+				return errors.Mismatch.Newf("[osc] Checksum of table %q (rows %d, crc %d) and %q (rows %d, crc %d) differs for the keys %v to %v",
+					a.Table, srcCount, srcCRC, a.Shadow, dstCount, dstCRC, lower, upper)
+			}
+			if a.opts.Log.IsInfo() {
+				a.opts.Log.Info("osc.Alter.verifyChecksums.mismatch", log.String("table", a.Table), log.Int("attempt", i+1))
+			}
+			if err := a.waitForBinlog(ctx); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	})
+}
+
+// cutOver locks both tables with the connection which replays the events,
+// waits until the canal has applied the remaining events and swaps the tables.
+// Renaming tables locked with LOCK TABLES requires at least MySQL 8.0.13.
+func (a *Alter) cutOver(ctx context.Context, conn *dml.Conn) (err error) {
+	if err := a.exec(ctx, conn.DB, "LOCK TABLES "+dml.Quoter.Name(a.Table)+" WRITE, "+dml.Quoter.Name(a.Shadow)+" WRITE"); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() {
+		if err2 := a.exec(context.Background(), conn.DB, "UNLOCK TABLES"); err2 != nil && err == nil {
+			err = err2
+		}
+	}()
+
+	wctx, cancel := context.WithTimeout(ctx, a.opts.CutOverLockTimeout)
+	defer cancel()
+	if err := a.waitForBinlog(wctx); err != nil {
+		return errors.Wrapf(err, "[osc] Cut-over of table %q failed", a.Table)
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if err := ddl.NewTable(a.Table).Swap(ctx, conn.DB, a.Shadow); err != nil {
+		return errors.WithStack(err)
+	}
+	a.applying = false
+	if a.opts.Log.IsInfo() {
+		a.opts.Log.Info("osc.Alter.cutOver", log.String("table", a.Table), log.String("shadow", a.Shadow))
+	}
+	return nil
+}
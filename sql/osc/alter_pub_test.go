@@ -0,0 +1,253 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osc_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+	"github.com/corestoreio/pkg/sql/dmltest"
+	"github.com/corestoreio/pkg/sql/osc"
+	"github.com/corestoreio/pkg/util/assert"
+)
+
+const (
+	alterStmt   = "ADD COLUMN `channel` VARCHAR(32) NULL, DROP COLUMN `customer_email`, MODIFY `grand_total` DECIMAL(20,4) NULL"
+	sqlMaxKey   = "SELECT `entity_id` FROM `sales_order_grid` ORDER BY `entity_id` DESC LIMIT 1"
+	sqlKeyFirst = "SELECT `entity_id` FROM `sales_order_grid` WHERE `entity_id` <= ? ORDER BY `entity_id` LIMIT 1 OFFSET 1"
+	sqlKeyNext  = "SELECT `entity_id` FROM `sales_order_grid` WHERE `entity_id` > ? AND `entity_id` <= ? ORDER BY `entity_id` LIMIT 1 OFFSET 1"
+	sqlCopy     = "INSERT IGNORE INTO `sales_order_grid_osc` (`entity_id`,`status`,`grand_total`) SELECT `entity_id`,`status`,`grand_total` FROM `sales_order_grid`"
+	sqlChecksum = "SELECT COUNT(*), COALESCE(BIT_XOR(CRC32(CONCAT_WS('#',`entity_id`,`status`,CONCAT(ISNULL(`entity_id`),ISNULL(`status`))))),0) FROM "
+	sqlReplace  = "REPLACE INTO `sales_order_grid_osc` (`entity_id`,`status`,`grand_total`) VALUES (?,?,?)"
+	sqlDelete   = "DELETE FROM `sales_order_grid_osc` WHERE (`entity_id` = ?)"
+	sqlThreads  = "SHOW GLOBAL STATUS LIKE 'Threads_running'"
+)
+
+func salesOrderGridTable() *ddl.Table {
+	return ddl.NewTable("sales_order_grid",
+		&ddl.Column{Field: "entity_id", DataType: "int", ColumnType: "int(10) unsigned", Key: "PRI"},
+		&ddl.Column{Field: "status", DataType: "varchar", ColumnType: "varchar(32)"},
+		&ddl.Column{Field: "grand_total", DataType: "decimal", ColumnType: "decimal(12,4)"},
+		&ddl.Column{Field: "customer_email", DataType: "varchar", ColumnType: "varchar(128)"},
+	)
+}
+
+func expectShadow(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectQuery("SELECT.+FROM information_schema.COLUMNS WHERE").
+		WillReturnRows(dmltest.MustMockRows(dmltest.WithFile("testdata/sales_order_grid.csv")))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DROP TABLE IF EXISTS `sales_order_grid_osc`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("CREATE TABLE `sales_order_grid_osc` LIKE `sales_order_grid`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("ALTER TABLE `sales_order_grid_osc` " + alterStmt)).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectQuery("SELECT.+FROM information_schema.COLUMNS WHERE").
+		WillReturnRows(dmltest.MustMockRows(dmltest.WithFile("testdata/sales_order_grid_osc.csv")))
+}
+
+func expectMasterStatus(dbMock sqlmock.Sqlmock) {
+	dbMock.ExpectQuery("SHOW MASTER STATUS").WillReturnRows(
+		sqlmock.NewRows([]string{"File", "Position", "Binlog_Do_DB", "Binlog_Ignore_DB", "Executed_Gtid_Set"}).
+			AddRow("mysql-bin.000002", 90, "", "", ""))
+}
+
+func expectKey(dbMock sqlmock.Sqlmock, query string, key int, args ...driver.Value) {
+	rows := sqlmock.NewRows([]string{"entity_id"})
+	if key > 0 {
+		rows.AddRow(key)
+	}
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(query)).WithArgs(args...).WillReturnRows(rows)
+}
+
+func expectChecksum(dbMock sqlmock.Sqlmock, table, where string, count, crc int, args ...driver.Value) {
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlChecksum + "`" + table + "`" + where)).WithArgs(args...).
+		WillReturnRows(sqlmock.NewRows([]string{"COUNT(*)", "crc"}).AddRow(count, crc))
+}
+
+func TestNewAlter(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	_, err := osc.NewAlter(nil, "sales_order_grid", alterStmt, nil)
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+	_, err = osc.NewAlter(dbc, "sales_order_grid", " ", nil)
+	assert.True(t, errors.Empty.Match(err), "%+v", err)
+	_, err = osc.NewAlter(dbc, "sales_order_grid", "alter table sales_order_grid ADD INDEX (`status`)", nil)
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+
+	a, err := osc.NewAlter(dbc, "sales_order_grid", alterStmt, nil)
+	assert.NoError(t, err)
+	assert.Exactly(t, "sales_order_grid_osc", a.Shadow)
+	assert.Exactly(t, "osc.sales_order_grid", a.String())
+
+	err = a.Run(context.TODO())
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
+
+func TestAlter_Run(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	var a *osc.Alter
+	ctx := context.TODO()
+	throttleCalls := 0
+	positionCalls := 0
+	a, err := osc.NewAlter(dbc, "sales_order_grid", alterStmt, &osc.Options{
+		Position: func() ddl.MasterStatus {
+			positionCalls++
+			if positionCalls == 3 {
+				// binlog event which gets replayed while the cut-over holds the locks
+				assert.NoError(t, a.Do(ctx, binlogsync.InsertAction, salesOrderGridTable(), [][]interface{}{
+					{int32(7), "pending", nil, nil},
+				}))
+			}
+			return ddl.MasterStatus{File: "mysql-bin.000002", Position: 100}
+		},
+		ChunkSize:         2,
+		MaxThreadsRunning: 50,
+		ThrottleInterval:  time.Millisecond,
+		PollInterval:      time.Millisecond,
+		DropOldTable:      true,
+		Throttle: func(ctx context.Context) (bool, error) {
+			throttleCalls++
+			if throttleCalls > 1 {
+				return false, nil
+			}
+			// binlog events which happen while the copy runs
+			tbl := salesOrderGridTable()
+			assert.NoError(t, a.Do(ctx, binlogsync.InsertAction, tbl, [][]interface{}{
+				{int32(4), "pending", "10.0000", "a@b.c"},
+			}))
+			assert.NoError(t, a.Do(ctx, binlogsync.UpdateAction, tbl, [][]interface{}{
+				{int32(1), "pending", nil, nil},
+				{int32(5), "complete", nil, nil},
+			}))
+			assert.NoError(t, a.Do(ctx, binlogsync.DeleteAction, tbl, [][]interface{}{
+				{int32(2), "pending", nil, nil},
+			}))
+			assert.NoError(t, a.Do(ctx, binlogsync.DeleteAction, ddl.NewTable("sales_order"), [][]interface{}{{1}}))
+			return false, nil
+		},
+	})
+	assert.NoError(t, err)
+
+	expectShadow(dbMock)
+	// the connection which replays the events and performs the cut-over
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("SET SESSION lock_wait_timeout = 3")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// copy
+	expectKey(dbMock, sqlMaxKey, 3)
+	expectKey(dbMock, sqlKeyFirst, 2, 3)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlThreads)).WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_running", 60))
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlThreads)).WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_running", 10))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlReplace)).WithArgs(int64(4), []byte("pending"), []byte("10.0000")).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlDelete)).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlReplace)).WithArgs(int64(5), []byte("complete"), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlDelete)).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCopy + " WHERE `entity_id` <= ? LOCK IN SHARE MODE")).WithArgs(2).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectKey(dbMock, sqlKeyNext, 0, 2, 3)
+	dbMock.ExpectQuery(dmltest.SQLMockQuoteMeta(sqlThreads)).WillReturnRows(sqlmock.NewRows([]string{"Variable_name", "Value"}).AddRow("Threads_running", 10))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlCopy+" WHERE `entity_id` > ? AND `entity_id` <= ? LOCK IN SHARE MODE")).WithArgs(2, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectMasterStatus(dbMock)
+
+	// checksum
+	expectKey(dbMock, sqlMaxKey, 3)
+	expectKey(dbMock, sqlKeyFirst, 2, 3)
+	expectChecksum(dbMock, "sales_order_grid", " WHERE `entity_id` <= ?", 1, 4711, 2)
+	expectChecksum(dbMock, "sales_order_grid_osc", " WHERE `entity_id` <= ?", 1, 4711, 2)
+	expectKey(dbMock, sqlKeyNext, 0, 2, 3)
+	expectChecksum(dbMock, "sales_order_grid", " WHERE `entity_id` > ? AND `entity_id` <= ?", 1, 815, 2, 3)
+	expectChecksum(dbMock, "sales_order_grid_osc", " WHERE `entity_id` > ? AND `entity_id` <= ?", 0, 0, 2, 3)
+	expectMasterStatus(dbMock)
+	expectChecksum(dbMock, "sales_order_grid", " WHERE `entity_id` > ? AND `entity_id` <= ?", 1, 815, 2, 3)
+	expectChecksum(dbMock, "sales_order_grid_osc", " WHERE `entity_id` > ? AND `entity_id` <= ?", 1, 815, 2, 3)
+
+	// cut-over
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("LOCK TABLES `sales_order_grid` WRITE, `sales_order_grid_osc` WRITE")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectMasterStatus(dbMock)
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta(sqlReplace)).WithArgs(int64(7), []byte("pending"), nil).WillReturnResult(sqlmock.NewResult(0, 1))
+	dbMock.ExpectExec("RENAME TABLE `sales_order_grid` TO .+`sales_order_grid_osc` TO `sales_order_grid`").WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("UNLOCK TABLES")).WillReturnResult(sqlmock.NewResult(0, 0))
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("DROP TABLE IF EXISTS `sales_order_grid_osc`")).WillReturnResult(sqlmock.NewResult(0, 0))
+	// the replaying connection is held during the run, hence the pool opens a
+	// second one.
+	dbMock.ExpectClose()
+
+	assert.NoError(t, a.Run(ctx))
+	assert.Exactly(t, int64(2), a.RowsCopied())
+	assert.Exactly(t, 2, throttleCalls)
+	assert.Exactly(t, 3, positionCalls)
+
+	// events after the cut-over get ignored
+	assert.NoError(t, a.Do(ctx, binlogsync.InsertAction, salesOrderGridTable(), [][]interface{}{{int32(6), "pending", nil, nil}}))
+	assert.NoError(t, a.SchemaChanged(ctx, "magento", "sales_order_grid"))
+}
+
+func TestAlter_Run_Aborted(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	var a *osc.Alter
+	a, err := osc.NewAlter(dbc, "sales_order_grid", alterStmt, &osc.Options{
+		Position:  func() ddl.MasterStatus { return ddl.MasterStatus{} },
+		ChunkSize: 2,
+		Throttle: func(ctx context.Context) (bool, error) {
+			assert.NoError(t, a.SchemaChanged(ctx, "magento", "sales_order"))
+			assert.NoError(t, a.SchemaChanged(ctx, "magento", "sales_order_grid"))
+			return false, nil
+		},
+	})
+	assert.NoError(t, err)
+
+	expectShadow(dbMock)
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("SET SESSION lock_wait_timeout = 3")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectKey(dbMock, sqlMaxKey, 3)
+	expectKey(dbMock, sqlKeyFirst, 2, 3)
+	dbMock.ExpectClose()
+
+	err = a.Run(context.TODO())
+	assert.True(t, errors.Aborted.Match(err), "%+v", err)
+}
+
+func TestAlter_Run_ReplayError(t *testing.T) {
+	dbc, dbMock := dmltest.MockDB(t)
+	defer dmltest.MockClose(t, dbc, dbMock)
+
+	var a *osc.Alter
+	a, err := osc.NewAlter(dbc, "sales_order_grid", alterStmt, &osc.Options{
+		Position:  func() ddl.MasterStatus { return ddl.MasterStatus{} },
+		ChunkSize: 2,
+		Throttle: func(ctx context.Context) (bool, error) {
+			err := a.Do(ctx, binlogsync.UpdateAction, salesOrderGridTable(), [][]interface{}{{int32(1), "pending", nil, nil}})
+			assert.True(t, errors.NotValid.Match(err), "%+v", err)
+			// further events get ignored
+			assert.NoError(t, a.Do(ctx, binlogsync.InsertAction, salesOrderGridTable(), [][]interface{}{{int32(1), "pending", nil, nil}}))
+			return false, nil
+		},
+	})
+	assert.NoError(t, err)
+
+	expectShadow(dbMock)
+	dbMock.ExpectExec(dmltest.SQLMockQuoteMeta("SET SESSION lock_wait_timeout = 3")).WillReturnResult(sqlmock.NewResult(0, 0))
+	expectKey(dbMock, sqlMaxKey, 3)
+	expectKey(dbMock, sqlKeyFirst, 2, 3)
+	dbMock.ExpectClose()
+
+	err = a.Run(context.TODO())
+	assert.True(t, errors.NotValid.Match(err), "%+v", err)
+}
@@ -0,0 +1,44 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package osc performs online schema changes without locking the table for
+// the duration of the ALTER statement.
+//
+// The approach follows gh-ost: Run creates a shadow table with the structure
+// of the original table and applies the ALTER statement to it. The rows get
+// copied in chunks, ordered by the primary key, with INSERT IGNORE ... SELECT.
+// Each chunk waits while the server is too busy, see Options.MaxThreadsRunning
+// and Options.Throttle. Concurrent changes to the original table get replayed
+// from the binary log via a binlogsync.Canal, with REPLACE and DELETE, hence
+// the copy never overwrites a newer row. After the copy, the checksums of
+// both tables get compared chunk by chunk. The cut-over locks both tables,
+// waits until the canal has applied all remaining events and swaps the tables
+// atomically with ddl.Table.Swap. The shadow table then contains the old data.
+// The events get replayed by the same connection which takes the locks of the
+// cut-over, so the replay can never wait for them.
+//
+//		a, err := osc.NewAlter(dbc, "sales_order_grid", "ADD COLUMN `channel` VARCHAR(32) NULL", &osc.Options{
+//			MaxThreadsRunning: 50,
+//			DropOldTable:      true,
+//		})
+//		a.RegisterCanal(canal) // canal must be running
+//		err = a.Run(ctx)
+//
+// The original table requires a primary key which must not be changed by the
+// ALTER statement. Columns which have been dropped get ignored, new columns
+// get their default value. Renaming a column loses its data. Renaming a table
+// locked with LOCK TABLES requires at least MySQL 8.0.13.
+//
+// https://github.com/github/gh-ost/blob/master/doc/why-triggerless.md
+package osc
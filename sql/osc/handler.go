@@ -0,0 +1,173 @@
+// Copyright 2015-present, Cyrill @ Schumacher.fm and the CoreStore contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package osc
+
+import (
+	"context"
+	"reflect"
+
+	"github.com/corestoreio/errors"
+	"github.com/corestoreio/log"
+	"github.com/corestoreio/pkg/sql/binlogsync"
+	"github.com/corestoreio/pkg/sql/ddl"
+)
+
+var (
+	_ binlogsync.RowsEventHandler    = (*Alter)(nil)
+	_ binlogsync.SchemaChangeHandler = (*Alter)(nil)
+)
+
+// RegisterCanal registers the schema change as event handler for its table
+// and uses the synced position of the canal to wait for the replay, if
+// Options.Position has not been set. The canal must have been started and
+// must not filter the table.
+func (a *Alter) RegisterCanal(c *binlogsync.Canal) {
+	a.mu.Lock()
+	if a.opts.Position == nil {
+		a.opts.Position = c.SyncedPosition
+	}
+	a.mu.Unlock()
+	c.RegisterRowsEventHandler(a.Table, a)
+}
+
+// String returns the name of the handler.
+func (a *Alter) String() string { return "osc." + a.Table }
+
+// Do replays the row events of the original table onto the shadow table,
+// while the schema change runs. Inserts and updates replace the row, deletes
+// remove it. A failure aborts the schema change.
+func (a *Alter) Do(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	if t == nil || t.Name != a.Table || len(rows) == 0 {
+		return nil
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.applying || a.err != nil {
+		return nil
+	}
+	if err := a.apply(ctx, action, t, rows); err != nil {
+		a.err = errors.Wrapf(err, "[osc] Failed to replay %q event of table %q", action, a.Table)
+		if a.opts.Log.IsInfo() {
+			a.opts.Log.Info("osc.Alter.Do.error", log.Err(err), log.String("table", a.Table), log.String("action", action))
+		}
+		return a.err
+	}
+	return nil
+}
+
+// Complete does nothing because all events get applied immediately.
+func (a *Alter) Complete(_ context.Context) error { return nil }
+
+// SchemaChanged aborts a running schema change when the original table gets
+// altered.
+func (a *Alter) SchemaChanged(_ context.Context, _, table string) error {
+	if table != a.Table {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.applying && a.err == nil {
+		a.err = errors.Aborted.Newf("[osc] Table %q has been changed during the online schema change", a.Table)
+	}
+	return nil
+}
+
+func (a *Alter) apply(ctx context.Context, action string, t *ddl.Table, rows [][]interface{}) error {
+	idxCols, err := columnIndexes(t, a.columns)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	idxPK, err := columnIndexes(t, a.pk)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	replace := func(row []interface{}) error {
+		_, err := a.applier.ExecContext(ctx, a.sqlReplace, rowValues(t, row, idxCols)...)
+		return errors.WithStack(err)
+	}
+	remove := func(row []interface{}) error {
+		_, err := a.applier.ExecContext(ctx, a.sqlDelete, rowValues(t, row, idxPK)...)
+		return errors.WithStack(err)
+	}
+
+	switch action {
+	case binlogsync.InsertAction:
+		for _, row := range rows {
+			if err := replace(row); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case binlogsync.DeleteAction:
+		for _, row := range rows {
+			if err := remove(row); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	case binlogsync.UpdateAction:
+		if len(rows)%2 == 1 {
+			return errors.NotValid.Newf("[osc] Update event for table %q requires an even number of rows, got %d", t.Name, len(rows))
+		}
+		for i := 0; i < len(rows); i += 2 {
+			if !reflect.DeepEqual(rowValues(t, rows[i], idxPK), rowValues(t, rows[i+1], idxPK)) {
+				if err := remove(rows[i]); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+			if err := replace(rows[i+1]); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	default:
+		return errors.NotSupported.Newf("[osc] Action %q not supported", action)
+	}
+	return nil
+}
+
+func columnIndexes(t *ddl.Table, fields []string) ([]int, error) {
+	idx := make([]int, len(fields))
+	for i, f := range fields {
+		idx[i] = -1
+		for j, c := range t.Columns {
+			if c.Field == f {
+				idx[i] = j
+				break
+			}
+		}
+		if idx[i] < 0 {
+			return nil, errors.NotFound.Newf("[osc] Column %q not found in table %q", f, t.Name)
+		}
+	}
+	return idx, nil
+}
+
+// rowValues extracts the values of the columns from a binlog row and converts
+// them into SQL arguments.
+func rowValues(t *ddl.Table, row []interface{}, idx []int) []interface{} {
+	args := make([]interface{}, len(idx))
+	for i, j := range idx {
+		if j >= len(row) {
+			continue
+		}
+		c := t.Columns[j]
+		v := binlogsync.ColumnValue(c, row[j])
+		if i64, ok := v.(int64); ok && c.DataType == "bigint" && c.IsUnsigned() {
+			v = uint64(i64)
+		}
+		args[i] = v
+	}
+	return args
+}